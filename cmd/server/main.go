@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
-	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -20,11 +20,15 @@ import (
 	"github.com/contextkeeper/service/internal/engines"
 	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
 	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/timeline"
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/metrics"
 	"github.com/contextkeeper/service/internal/models"
 	"github.com/contextkeeper/service/internal/services"
 	"github.com/contextkeeper/service/internal/store"
 	"github.com/contextkeeper/service/internal/utils"
 	"github.com/contextkeeper/service/pkg/aliyun"
+	"github.com/contextkeeper/service/pkg/embedding"
+	"github.com/contextkeeper/service/pkg/vectorstore"
 )
 
 // buildMultiDimensionalStorageRequest 构建多维度存储请求
@@ -140,6 +144,8 @@ func min(a, b int) int {
 // 添加日志工具函数
 // logToolCall 记录工具调用的详细日志
 func logToolCall(name string, request map[string]interface{}, response interface{}, err error, duration time.Duration) {
+	metrics.ObserveToolCall(name, err, duration)
+
 	// 将请求参数转为漂亮的JSON格式
 	requestJSON, jsonErr := json.MarshalIndent(request, "", "  ")
 	if jsonErr != nil {
@@ -194,21 +200,32 @@ func initializeServices() (*services.LLMDrivenContextService, context.Context, c
 	vectorDBURL := getEnv("VECTOR_DB_URL", cfg.VectorDBURL)
 	vectorDBAPIKey := getEnv("VECTOR_DB_API_KEY", cfg.VectorDBAPIKey)
 
+	// 嵌入服务提供商，非阿里云时不需要阿里云嵌入API配置
+	embeddingProviderType := strings.ToLower(strings.TrimSpace(getEnv("EMBEDDING_PROVIDER", cfg.EmbeddingProvider)))
+	useAliyunEmbedding := embeddingProviderType == "" || embeddingProviderType == "aliyun"
+
+	// 向量存储类型，qdrant时不需要阿里云向量数据库配置
+	vectorStoreType := vectorstore.GetVectorStoreTypeFromEnv()
+	useQdrant := vectorStoreType == models.VectorStoreTypeQdrant
+
 	// 检查是否在开发模式（HTTP模式允许演示运行）
 	isHTTPMode := os.Getenv("HTTP_MODE") == "true" || os.Getenv("STREAMABLE_HTTP_MODE") == "true"
 
 	if !isHTTPMode {
 		// STDIO模式需要完整配置
-		if embeddingAPIURL == "" {
+		if useAliyunEmbedding && embeddingAPIURL == "" {
 			log.Fatalf("错误: EMBEDDING_API_URL 未设置")
 		}
-		if embeddingAPIKey == "" {
+		if useAliyunEmbedding && embeddingAPIKey == "" {
 			log.Fatalf("错误: EMBEDDING_API_KEY 未设置")
 		}
-		if vectorDBURL == "" {
+		if useQdrant && os.Getenv("QDRANT_URL") == "" {
+			log.Fatalf("错误: QDRANT_URL 未设置")
+		}
+		if !useQdrant && vectorDBURL == "" {
 			log.Fatalf("错误: VECTOR_DB_URL 未设置")
 		}
-		if vectorDBAPIKey == "" {
+		if !useQdrant && vectorDBAPIKey == "" {
 			log.Fatalf("错误: VECTOR_DB_API_KEY 未设置")
 		}
 	} else {
@@ -254,9 +271,18 @@ func initializeServices() (*services.LLMDrivenContextService, context.Context, c
 	vectorDBMetric := getEnv("VECTOR_DB_METRIC", cfg.VectorDBMetric)
 	similarityThreshold := getFloatEnv("SIMILARITY_THRESHOLD", cfg.SimilarityThreshold)
 
+	// 创建嵌入服务提供商
+	embeddingProvider, err := createEmbeddingProvider(embeddingProviderType, cfg, vectorDBDimension)
+	if err != nil {
+		log.Fatalf("创建嵌入服务失败: %v", err)
+	}
+
 	// 创建向量服务
 	var vectorService *aliyun.VectorService
-	if embeddingAPIURL != "" && embeddingAPIKey != "" && vectorDBURL != "" && vectorDBAPIKey != "" {
+	hasEmbeddingConfig := embeddingProvider != nil || (embeddingAPIURL != "" && embeddingAPIKey != "")
+	if useQdrant {
+		log.Printf("使用Qdrant向量存储，跳过阿里云向量服务初始化")
+	} else if hasEmbeddingConfig && vectorDBURL != "" && vectorDBAPIKey != "" {
 		vectorService = aliyun.NewVectorService(
 			embeddingAPIURL,
 			embeddingAPIKey,
@@ -267,6 +293,9 @@ func initializeServices() (*services.LLMDrivenContextService, context.Context, c
 			vectorDBMetric,
 			similarityThreshold,
 		)
+		if embeddingProvider != nil {
+			vectorService.SetEmbeddingProvider(embeddingProvider)
+		}
 
 		// 确保向量集合存在
 		log.Println("确保向量集合存在...")
@@ -289,7 +318,6 @@ func initializeServices() (*services.LLMDrivenContextService, context.Context, c
 	// 检查是否为HTTP模式（已在上面定义过了）
 
 	var sessionStore *store.SessionStore
-	var err error
 
 	if isHTTPMode {
 		log.Println("HTTP模式：初始化用户隔离的存储系统")
@@ -325,6 +353,41 @@ func initializeServices() (*services.LLMDrivenContextService, context.Context, c
 
 	// 创建基础的ContextService
 	originalContextService := services.NewContextService(vectorService, sessionStore, cfg)
+	if embeddingProvider != nil {
+		originalContextService.SetEmbeddingProvider(embeddingProvider)
+	}
+
+	// 加载分析prompt模板，配置的模板文件不存在或解析失败时直接退出，避免带着错误的prompt运行
+	if err := originalContextService.LoadAnalysisPromptTemplates(); err != nil {
+		log.Fatalf("加载分析prompt模板失败: %v", err)
+	}
+
+	// VECTOR_STORE_TYPE=qdrant 时通过向量存储工厂创建Qdrant存储（自动创建集合）
+	if useQdrant {
+		log.Println("初始化Qdrant向量存储...")
+		qdrantStore, err := vectorstore.CreateVectorStoreFromEnv()
+		if err != nil {
+			if isHTTPMode {
+				log.Printf("警告: Qdrant向量存储初始化失败: %v (HTTP模式继续运行)", err)
+			} else {
+				log.Fatalf("Qdrant向量存储初始化失败: %v", err)
+			}
+		} else {
+			originalContextService.SetVectorStore(qdrantStore)
+		}
+	}
+
+	// 探测嵌入向量维度，与VECTOR_DB_DIMENSION不一致时写入的向量会被向量库拒绝
+	if hasEmbeddingConfig || useQdrant {
+		log.Println("探测嵌入向量维度...")
+		if _, err := originalContextService.DetectEmbeddingDimension(vectorDBDimension); err != nil {
+			if isHTTPMode {
+				log.Printf("⚠️⚠️⚠️ 警告: 嵌入向量维度校验失败: %v (HTTP模式继续运行，向量写入和检索可能失败)", err)
+			} else {
+				log.Fatalf("嵌入向量维度校验失败: %v", err)
+			}
+		}
+	}
 
 	// 初始化基础存储引擎（如果启用多维度存储）
 	var storageEngines map[string]interface{}
@@ -341,6 +404,13 @@ func initializeServices() (*services.LLMDrivenContextService, context.Context, c
 		storageEngines = make(map[string]interface{}) // 空的存储引擎映射
 	}
 
+	// 分别校验TimescaleDB和Neo4j的配置与连通性，不可用的引擎在智能存储时跳过
+	if cfg.EnableMultiDimensionalStorage {
+		for _, engine := range originalContextService.ValidateStorageEngines(context.Background()) {
+			log.Printf("🔌 存储引擎%s: %s %s", engine.Name, engine.State, engine.Reason)
+		}
+	}
+
 	// 🔥 重构：使用带存储引擎的构造函数创建LLMDrivenContextService
 	llmDrivenContextService := services.NewLLMDrivenContextServiceWithEngines(originalContextService, storageEngines)
 	log.Printf("🚀 LLMDrivenContextService v1.0 初始化完成，LLM驱动智能功能已启用")
@@ -351,19 +421,48 @@ func initializeServices() (*services.LLMDrivenContextService, context.Context, c
 	log.Printf("    ├── 多维度检索引擎 (并行检索：上下文、时间线、知识图谱、向量)")
 	log.Printf("    └── 内容合成引擎 (第二次LLM调用：结果融合、响应生成)")
 
-	// 创建会话清理的上下文
-	cleanupCtx, cancelCleanup := context.WithCancel(context.Background())
+	// 创建会话清理的上下文，取消时同时释放复用的TimescaleDB和Neo4j连接池
+	cleanupCtx, cancelTasks := context.WithCancel(context.Background())
+	cancelCleanup := func() {
+		cancelTasks()
+		originalContextService.Close()
+	}
 
 	// 启动会话清理任务，使用配置文件中的时间设置
 	log.Printf("启动会话清理任务: 超时=%v, 间隔=%v", cfg.SessionTimeout, cfg.CleanupInterval)
 	// 🔥 修复：LLMDrivenContextService通过代理模式支持会话清理，取消注释
 	llmDrivenContextService.StartSessionCleanupTask(cleanupCtx, cfg.SessionTimeout, cfg.CleanupInterval)
 
+	// 启动知识图谱关系清理任务（KG_PRUNE_INTERVAL<=0时不启动）
+	llmDrivenContextService.StartKnowledgeGraphPruneTask(cleanupCtx)
+
 	// 🔥 修改：返回完整的LLMDrivenContextService，提供LLM驱动的智能功能
 	// LLMDrivenContextService通过代理模式完全兼容ContextService的所有方法
 	return llmDrivenContextService, cleanupCtx, cancelCleanup
 }
 
+// createEmbeddingProvider 根据EMBEDDING_PROVIDER创建嵌入服务
+// 返回nil表示使用阿里云向量服务自带的嵌入能力
+func createEmbeddingProvider(providerType string, cfg *config.Config, dimension int) (models.EmbeddingProvider, error) {
+	switch providerType {
+	case "", "aliyun":
+		log.Printf("嵌入服务: 阿里云")
+		return nil, nil
+	case "openai":
+		baseURL := getEnv("OPENAI_EMBEDDING_BASE_URL", cfg.OpenAIEmbeddingBaseURL)
+		apiKey := getEnv("OPENAI_EMBEDDING_API_KEY", cfg.OpenAIEmbeddingAPIKey)
+		model := getEnv("OPENAI_EMBEDDING_MODEL", cfg.OpenAIEmbeddingModel)
+		apiVersion := getEnv("OPENAI_EMBEDDING_API_VERSION", cfg.OpenAIEmbeddingAPIVersion)
+		if baseURL == "" || model == "" {
+			return nil, fmt.Errorf("OpenAI兼容嵌入服务配置不完整，请检查环境变量: OPENAI_EMBEDDING_BASE_URL, OPENAI_EMBEDDING_MODEL")
+		}
+		log.Printf("嵌入服务: OpenAI兼容协议, 地址: %s, 模型: %s, 期望维度: %d", baseURL, model, dimension)
+		return embedding.NewOpenAIClient(baseURL, apiKey, model, dimension, apiVersion), nil
+	default:
+		return nil, fmt.Errorf("不支持的嵌入服务提供商: %s，可选值: aliyun, openai", providerType)
+	}
+}
+
 // initMultiDimensionalStorageEngine 初始化多维度存储引擎
 func initMultiDimensionalStorageEngine(cfg *config.Config) (interface{}, error) {
 	log.Printf("🔧 开始初始化多维度存储引擎...")
@@ -492,7 +591,7 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 			mcp.Description("文件路径"),
 		),
 	)
-	s.AddTool(associateFileTool, associateFileHandler(contextService))
+	s.AddTool(associateFileTool, withRateLimit(contextService, associateFileHandler(contextService)))
 
 	// 注册工具：记录编辑
 	recordEditTool := mcp.NewTool("record_edit",
@@ -510,7 +609,7 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 			mcp.Description("编辑差异内容"),
 		),
 	)
-	s.AddTool(recordEditTool, recordEditHandler(contextService))
+	s.AddTool(recordEditTool, withRateLimit(contextService, recordEditHandler(contextService)))
 
 	// 注册工具：检索上下文
 	retrieveContextTool := mcp.NewTool("retrieve_context",
@@ -523,8 +622,77 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 			mcp.Required(),
 			mcp.Description("查询内容"),
 		),
+		mcp.WithNumber("offset",
+			mcp.Description("分页偏移量，默认0，可使用上次返回的nextOffset继续获取"),
+		),
+		mcp.WithNumber("pageSize",
+			mcp.Description("每页返回的记忆条数，默认10"),
+		),
+		mcp.WithNumber("topK",
+			mcp.Description("返回的相关记忆条数(1-100)，默认10，超过100时按100返回；与pageSize同时指定时必须一致"),
+		),
+		mcp.WithNumber("threshold",
+			mcp.Description("本次检索的相似度阈值（0-1，越大越相似），不传或为0时使用配置值"),
+		),
+		mcp.WithBoolean("hybridSearch",
+			mcp.Description("是否启用混合检索：向量相似度与关键词匹配合并排序，适合查找函数名等精确标识符，结果附带得分明细"),
+		),
+		mcp.WithNumber("hybridAlpha",
+			mcp.Description("混合检索中向量得分的权重[0-1]，其余为关键词得分权重，0表示只按关键词得分，不传时使用配置值"),
+		),
+		mcp.WithBoolean("rerank",
+			mcp.Description("是否使用LLM按查询意图对前20条结果重新打分排序，结果附带重排序得分"),
+		),
+		mcp.WithBoolean("multiVector",
+			mcp.Description("同时检索核心意图、领域上下文和场景维度向量，按记忆保存的维度权重(0.5/0.3/0.15)融合得分；相似度阈值作用于融合后的得分。仅在向量存储启用多维度向量（如QDRANT_MULTI_VECTOR=true）时生效，否则使用主向量检索"),
+		),
+		mcp.WithNumber("startTime",
+			mcp.Description("时间范围起点（unix秒，含），不传或为0时不限制"),
+		),
+		mcp.WithNumber("endTime",
+			mcp.Description("时间范围终点（unix秒，含），不传或为0时不限制"),
+		),
+		mcp.WithString("sortBy",
+			mcp.Description("结果排序方式：默认按相似度，time按时间倒序"),
+		),
+		mcp.WithString("groupBy",
+			mcp.Description("按batch(对话批次)或session(会话)聚合相关记忆，以groups返回：每组包含最高得分、按时间正序的成员(最多5条)和可用的批次/会话摘要，此时longTermMemory为空"),
+		),
+		mcp.WithString("collection",
+			mcp.Description("只检索该命名集合中的记忆；不传时检索全部记忆"),
+		),
+		mcp.WithBoolean("structured",
+			mcp.Description("是否返回结构化结果：results数组中每条包含memoryId、content、score、type、timestamp、metadata，此时long_term_memory为空；默认返回拼接的文本"),
+		),
+		mcp.WithNumber("maxTokens",
+			mcp.Description("相关记忆的token预算（估算值，上限200000）：先保留最新的最近对话，再按排序保留相关历史，超出的截断或丢弃，响应的tokenBudget中列出保留和丢弃的条目；不传或为0时不限制"),
+		),
+		mcp.WithBoolean("graphExpand",
+			mcp.Description("以向量命中的前5条记忆为起点，在知识图谱中扩展一跳到相关实体，追加最多10条关联记忆（标记为图谱扩展来源，不计入分页）；Neo4j未启用时不生效"),
+		),
+		mcp.WithBoolean("priorityBoost",
+			mcp.Description("按相似度与记忆优先级(P0>P1>P2>P3)的加权得分排序，相关性接近时重要记忆排在前面；相似度始终占多数权重，开启explain时每个候选同时返回原始得分和加权得分，默认false"),
+		),
+		mcp.WithNumber("priorityWeight",
+			mcp.Description("priorityBoost中优先级得分的权重(0-0.5]，不传或为0时使用配置值(PRIORITY_BOOST_WEIGHT，默认0.2)"),
+		),
+		mcp.WithBoolean("recencyBoost",
+			mcp.Description("按相似度与记忆存储时间的指数衰减得分加权排序，相关性接近时新近的记忆排在前面；可与priorityBoost同时使用，相似度始终占多数权重，开启explain时每个候选同时返回时间衰减得分和加权得分，默认false"),
+		),
+		mcp.WithNumber("recencyWeight",
+			mcp.Description("recencyBoost中时间衰减得分的权重(0-0.5]，不传或为0时使用配置值(RECENCY_BOOST_WEIGHT，默认0.2)"),
+		),
+		mcp.WithNumber("recencyHalfLife",
+			mcp.Description("recencyBoost的半衰期（小时），记忆每经过一个半衰期时间衰减得分减半；不传或为0时使用配置值(RECENCY_HALF_LIFE_HOURS，默认168即7天)"),
+		),
+		mcp.WithBoolean("includeArchived",
+			mcp.Description("同时返回已归档(archive_memory)的记忆，默认false（归档的记忆不参与检索）"),
+		),
+		mcp.WithBoolean("explain",
+			mcp.Description("返回检索诊断信息(explain)：每个候选的原始得分、是否通过相似度阈值、命中的过滤条件(userId/session/workspace/timeRange)、重排序前后及最终排名，以及最终使用的过滤条件；只包含当前用户的记录，默认false"),
+		),
 	)
-	s.AddTool(retrieveContextTool, retrieveContextHandler(contextService))
+	s.AddTool(retrieveContextTool, withRateLimit(contextService, retrieveContextHandler(contextService)))
 
 	// 注册工具：获取上下文（新的统一接口）
 	getContextTool := mcp.NewTool("get_context",
@@ -544,7 +712,7 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 			mcp.Description("时间范围（仅对recent_changes有效）：1h/6h/1d/3d/1w"),
 		),
 	)
-	s.AddTool(getContextTool, getContextHandler(contextService))
+	s.AddTool(getContextTool, withRateLimit(contextService, getContextHandler(contextService)))
 
 	// 注册工具：编程上下文（保持向后兼容）
 	programmingContextTool := mcp.NewTool("programming_context",
@@ -556,15 +724,18 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 		mcp.WithString("query",
 			mcp.Description("可选查询参数"),
 		),
+		mcp.WithBoolean("includeTimeline",
+			mcp.Description("可选，为true时合并TimescaleDB时间线事件（决策、部署等）到活动统计；服务端开启PROGRAMMING_CONTEXT_TIMELINE时始终合并"),
+		),
 	)
-	s.AddTool(programmingContextTool, programmingContextHandler(contextService))
+	s.AddTool(programmingContextTool, withRateLimit(contextService, programmingContextHandler(contextService)))
 
 	// 注册工具：会话管理
 	sessionManagementTool := mcp.NewTool("session_management",
 		mcp.WithDescription("创建或获取会话信息"),
 		mcp.WithString("action",
 			mcp.Required(),
-			mcp.Description("操作类型: get_or_create"),
+			mcp.Description("操作类型: get_or_create, pin（置顶会话，不活跃时不会被清理）, unpin（取消置顶）, switch_workspace（切换到工作空间最近活跃的会话）"),
 		),
 		mcp.WithString("userId",
 			mcp.Required(),
@@ -574,11 +745,17 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 			mcp.Required(),
 			mcp.Description("工作空间根路径，必需参数，用于会话隔离，确保不同工作空间的session完全独立"),
 		),
+		mcp.WithString("workspaceHash",
+			mcp.Description("工作空间哈希（list_workspaces返回的hash），switch_workspace时可代替workspaceRoot"),
+		),
+		mcp.WithString("sessionId",
+			mcp.Description("会话ID，pin/unpin操作时必需"),
+		),
 		mcp.WithObject("metadata",
 			mcp.Description("会话元数据，可选"),
 		),
 	)
-	s.AddTool(sessionManagementTool, sessionManagementHandler(contextService))
+	s.AddTool(sessionManagementTool, withRateLimit(contextService, sessionManagementHandler(contextService)))
 
 	// 注册工具：存储对话
 	storeConversationTool := mcp.NewTool("store_conversation",
@@ -594,8 +771,25 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 		mcp.WithString("batchId",
 			mcp.Description("批次ID，可选，不提供则自动生成"),
 		),
+		mcp.WithString("idempotencyKey",
+			mcp.Description("幂等键，可选：网络重试时传入相同的键，保留时间(IDEMPOTENCY_KEY_TTL)内直接返回首次的batchId和结果，不重复存储；按用户隔离"),
+		),
+	)
+	s.AddTool(storeConversationTool, withRateLimit(contextService, storeConversationHandler(contextService)))
+
+	// 注册工具：批量存储对话
+	batchStoreConversationTool := mcp.NewTool("batch_store_conversation",
+		mcp.WithDescription("批量存储多个对话批次，全部成功才提交，任一批次失败则整体回滚"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithArray("batches",
+			mcp.Required(),
+			mcp.Description("批次列表，每个批次包含batchId（可选）和messages数组"),
+		),
 	)
-	s.AddTool(storeConversationTool, storeConversationHandler(contextService))
+	s.AddTool(batchStoreConversationTool, withRateLimit(contextService, batchStoreConversationHandler(contextService)))
 
 	// 注册工具：检索记忆
 	retrieveMemoryTool := mcp.NewTool("retrieve_memory",
@@ -613,8 +807,11 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 		mcp.WithString("format",
 			mcp.Description("返回格式: full, summary"),
 		),
+		mcp.WithBoolean("assembleChunks",
+			mcp.Description("memoryId为超长内容分块存储的父ID或分块ID时，重组并返回完整内容；父ID本身没有记录时自动重组"),
+		),
 	)
-	s.AddTool(retrieveMemoryTool, retrieveMemoryHandler(contextService))
+	s.AddTool(retrieveMemoryTool, withRateLimit(contextService, retrieveMemoryHandler(contextService)))
 
 	// 注册工具：记忆化上下文
 	memorizeContextTool := mcp.NewTool("memorize_context",
@@ -624,17 +821,40 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 			mcp.Description("当前会话ID"),
 		),
 		mcp.WithString("content",
-			mcp.Required(),
-			mcp.Description("要记忆的内容"),
+			mcp.Description("要记忆的内容；contentType为image时为可选的图片说明，用于检索"),
+		),
+		mcp.WithString("contentType",
+			mcp.Description("内容类型，可选: text, image，默认text；image时只保存contentRef引用，以content说明文字生成检索向量"),
+		),
+		mcp.WithString("contentRef",
+			mcp.Description("图片的外部URI或路径，contentType为image时必填，retrieve_context会随匹配的说明一并返回"),
+		),
+		mcp.WithString("collection",
+			mcp.Description("记忆所属的命名集合（如work、personal），只允许字母、数字、下划线、连字符和点；不传时不归属任何集合"),
 		),
 		mcp.WithString("priority",
-			mcp.Description("优先级，可选: P1(高), P2(中), P3(低)，默认P2"),
+			mcp.Description("优先级，可选: P1(高), P2(中), P3(低)；不传时按分析出的事件类型和置信度推断(PRIORITY_INFERENCE_RULES)，否则使用DEFAULT_MEMORY_PRIORITY(默认P2)"),
 		),
 		mcp.WithObject("metadata",
 			mcp.Description("记忆相关的元数据，可选"),
 		),
+		mcp.WithString("locale",
+			mcp.Description("内容语言，可选: auto(按内容自动判断), zh, en，默认auto；用于待办事项检测和时间线事件类型判断"),
+		),
+		mcp.WithBoolean("dedup",
+			mcp.Description("是否去重：同会话/用户下已有相似度达到阈值(STORE_DEDUP_THRESHOLD)的记忆时不再写入，返回已有记忆ID，默认false"),
+		),
+		mcp.WithBoolean("dryRun",
+			mcp.Description("是否试运行：只执行LLM分析并返回分析结果、存储策略和将写入的引擎，不写入任何存储，默认false"),
+		),
+		mcp.WithBoolean("async",
+			mcp.Description("是否异步存储：请求入队后立即返回jobId，由后台处理，可通过get_store_status查询结果，默认false"),
+		),
+		mcp.WithString("idempotencyKey",
+			mcp.Description("幂等键，可选：网络重试时传入相同的键，保留时间(IDEMPOTENCY_KEY_TTL)内直接返回首次的memoryId和结果，不重复存储；按用户隔离，试运行不记录"),
+		),
 	)
-	s.AddTool(memorizeContextTool, memorizeContextHandler(contextService))
+	s.AddTool(memorizeContextTool, withRateLimit(contextService, memorizeContextHandler(contextService)))
 
 	// 注册工具：检索待办事项
 	retrieveTodosTool := mcp.NewTool("retrieve_todos",
@@ -646,99 +866,509 @@ func registerMCPTools(s *server.MCPServer, llmDrivenService *services.LLMDrivenC
 		mcp.WithString("status",
 			mcp.Description("筛选状态: all, pending, completed"),
 		),
+		mcp.WithString("query",
+			mcp.Description("可选，按与查询的语义相关度检索待办并返回相似度score，可与status同时使用；不传时列出所有待办"),
+		),
+		mcp.WithBoolean("includeArchived",
+			mcp.Description("同时返回已归档的待办，默认false"),
+		),
 		mcp.WithString("limit",
 			mcp.Description("返回结果数量限制"),
 		),
 	)
-	s.AddTool(retrieveTodosTool, retrieveTodosHandler(contextService))
+	s.AddTool(retrieveTodosTool, withRateLimit(contextService, retrieveTodosHandler(contextService)))
 
-	// 注册工具：用户初始化对话
-	userInitDialogTool := mcp.NewTool("user_init_dialog",
-		mcp.WithDescription("用户初始化对话处理"),
+	// 注册工具：更新待办事项
+	updateTodoTool := mcp.NewTool("update_todo",
+		mcp.WithDescription("更新待办事项的状态、优先级或完成时间"),
 		mcp.WithString("sessionId",
 			mcp.Required(),
 			mcp.Description("当前会话ID"),
 		),
-		mcp.WithString("userResponse",
-			mcp.Description("用户对初始化提示的响应"),
+		mcp.WithString("memoryId",
+			mcp.Required(),
+			mcp.Description("待办事项的记忆ID"),
+		),
+		mcp.WithString("status",
+			mcp.Required(),
+			mcp.Description("新状态: pending, completed"),
+		),
+		mcp.WithString("priority",
+			mcp.Description("优先级，可选: P0, P1, P2, P3"),
+		),
+		mcp.WithNumber("completedAt",
+			mcp.Description("完成时间（Unix秒），可选，状态为completed时默认当前时间"),
 		),
 	)
-	s.AddTool(userInitDialogTool, userInitDialogHandler())
-}
-
-// 工具处理函数
+	s.AddTool(updateTodoTool, withRateLimit(contextService, updateTodoHandler(contextService)))
 
-// associateFileHandler 处理文件关联请求
-func associateFileHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		startTime := time.Now()
+	// 注册工具：查询知识图谱
+	queryKnowledgeGraphTool := mcp.NewTool("query_knowledge_graph",
+		mcp.WithDescription("从指定实体出发查询知识图谱中相关的概念和关系"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("entityName",
+			mcp.Required(),
+			mcp.Description("起始实体名称"),
+		),
+		mcp.WithNumber("maxDepth",
+			mcp.Description("最大遍历跳数，默认2，最大3"),
+		),
+	)
+	s.AddTool(queryKnowledgeGraphTool, withRateLimit(contextService, queryKnowledgeGraphHandler(contextService)))
 
-		// 验证参数
-		sessionID, ok := request.Params.Arguments["sessionId"].(string)
-		if !ok || sessionID == "" {
-			errMsg := "错误: sessionId必须是非空字符串"
-			log.Println(errMsg)
-			logToolCall("associate_file", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
-		}
+	// 注册工具：获取实体画像
+	getEntityTool := mcp.NewTool("get_entity",
+		mcp.WithDescription("获取实体画像：汇总知识图谱中该实体的直接关系（如使用它的项目、它解决的问题）和关联的来源记忆片段；实体不在图谱中或Neo4j未启用时按实体名向量检索相关记忆，只包含当前用户的数据"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("entityName",
+			mcp.Required(),
+			mcp.Description("实体名称，需与知识图谱中的名称一致（如TimescaleDB）"),
+		),
+		mcp.WithNumber("memoryLimit",
+			mcp.Description("返回的来源记忆数上限，默认10，最大50"),
+		),
+	)
+	s.AddTool(getEntityTool, withRateLimit(contextService, getEntityHandler(contextService)))
 
-		filePath, ok := request.Params.Arguments["filePath"].(string)
-		if !ok || filePath == "" {
-			errMsg := "错误: filePath必须是非空字符串"
-			log.Println(errMsg)
-			logToolCall("associate_file", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
-		}
+	// 注册工具：查询时间线
+	queryTimelineTool := mcp.NewTool("query_timeline",
+		mcp.WithDescription("按时间窗口查询时间线事件，按时间正序返回，并附带按事件类型的数量统计"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("from",
+			mcp.Description("开始时间，支持RFC3339、2006-01-02 15:04:05、2006-01-02或Unix秒级时间戳，默认为结束时间前7天"),
+		),
+		mcp.WithString("to",
+			mcp.Description("结束时间，格式同from，默认为当前时间"),
+		),
+		mcp.WithArray("eventTypes",
+			mcp.Description("事件类型过滤，如code_edit, decision，可选"),
+		),
+		mcp.WithString("workspaceId",
+			mcp.Description("工作空间（工程名）过滤，可选"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("返回事件数量限制，默认50，最大500"),
+		),
+	)
+	s.AddTool(queryTimelineTool, withRateLimit(contextService, queryTimelineHandler(contextService)))
 
-		log.Printf("关联文件: sessionID=%s, filePath=%s", sessionID, filePath)
+	// 注册工具：删除记忆
+	deleteMemoryTool := mcp.NewTool("delete_memory",
+		mcp.WithDescription("基于memoryId或batchId删除已存储的记忆，并同步清理关联的知识图谱和时间线数据"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("memoryId",
+			mcp.Description("记忆ID，与batchId二选一"),
+		),
+		mcp.WithString("batchId",
+			mcp.Description("批次ID，与memoryId二选一"),
+		),
+	)
+	s.AddTool(deleteMemoryTool, withRateLimit(contextService, deleteMemoryHandler(contextService)))
 
-		err := contextService.AssociateFile(ctx, models.AssociateFileRequest{
-			SessionID: sessionID,
-			FilePath:  filePath,
-		})
-		if err != nil {
-			errMsg := fmt.Sprintf("关联文件失败: %v", err)
-			log.Println(errMsg)
-			logToolCall("associate_file", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
-		}
+	// 注册工具：按条件批量删除记忆
+	deleteMemoriesByFilterTool := mcp.NewTool("delete_memories_by_filter",
+		mcp.WithDescription("按条件批量删除当前用户的记忆（会话、类型、优先级、时间范围），并同步清理关联的知识图谱和时间线数据；默认演练只返回匹配数量，confirm=true时才删除；条件为空或匹配全部记忆时需设置allowAll=true"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID，用于确定用户"),
+		),
+		mcp.WithString("filterSessionId",
+			mcp.Description("只删除该会话的记忆"),
+		),
+		mcp.WithString("type",
+			mcp.Description("记忆类型，如long_term_memory、todo、message、conversation_summary"),
+		),
+		mcp.WithString("priority",
+			mcp.Description("优先级，可选: P0, P1, P2, P3"),
+		),
+		mcp.WithNumber("startTime",
+			mcp.Description("时间范围起点（unix秒，含），不传或为0时不限制"),
+		),
+		mcp.WithNumber("endTime",
+			mcp.Description("时间范围终点（unix秒，含），不传或为0时不限制"),
+		),
+		mcp.WithBoolean("confirm",
+			mcp.Description("为true时执行删除，默认false只预览匹配数量"),
+		),
+		mcp.WithBoolean("allowAll",
+			mcp.Description("允许删除当前用户的全部记忆，过滤条件为空或匹配全部记忆时必须设置"),
+		),
+	)
+	s.AddTool(deleteMemoriesByFilterTool, withRateLimit(contextService, deleteMemoriesByFilterHandler(contextService)))
 
-		successMsg := fmt.Sprintf("成功关联文件: %s", filePath)
-		log.Println(successMsg)
-		logToolCall("associate_file", request.Params.Arguments, successMsg, nil, time.Since(startTime))
-		return mcp.NewToolResultText(successMsg), nil
-	}
-}
+	// 注册工具：归档记忆
+	archiveMemoryTool := mcp.NewTool("archive_memory",
+		mcp.WithDescription("归档（软删除）已存储的记忆：记录保留但默认不参与检索，可用restore_memory恢复；配置了archived保留策略时超期后永久删除"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("memoryId",
+			mcp.Required(),
+			mcp.Description("要归档的记忆ID"),
+		),
+	)
+	s.AddTool(archiveMemoryTool, withRateLimit(contextService, archiveMemoryHandler(contextService, "archive_memory", true)))
 
-// recordEditHandler 处理编辑记录请求
-func recordEditHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		startTime := time.Now()
+	// 注册工具：恢复归档的记忆
+	restoreMemoryTool := mcp.NewTool("restore_memory",
+		mcp.WithDescription("恢复已归档的记忆，恢复后重新参与检索"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("memoryId",
+			mcp.Required(),
+			mcp.Description("要恢复的记忆ID"),
+		),
+	)
+	s.AddTool(restoreMemoryTool, withRateLimit(contextService, archiveMemoryHandler(contextService, "restore_memory", false)))
 
-		// 验证参数
-		sessionID, ok := request.Params.Arguments["sessionId"].(string)
-		if !ok || sessionID == "" {
-			errMsg := "错误: sessionId必须是非空字符串"
-			log.Println(errMsg)
-			logToolCall("record_edit", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
-		}
+	// 注册工具：更新记忆
+	updateMemoryTool := mcp.NewTool("update_memory",
+		mcp.WithDescription("原地更新已存储记忆的内容和元数据，保留原记忆ID；内容变化时重新生成向量，并同步更新关联的时间线事件和知识图谱概念"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("memoryId",
+			mcp.Required(),
+			mcp.Description("要更新的记忆ID"),
+		),
+		mcp.WithString("content",
+			mcp.Description("新的记忆内容，不传时保持原内容；与metadata至少提供一个"),
+		),
+		mcp.WithObject("metadata",
+			mcp.Description("要合并到原元数据的字段，值为null的字段会被删除；不能修改type"),
+		),
+	)
+	s.AddTool(updateMemoryTool, withRateLimit(contextService, updateMemoryHandler(contextService)))
 
-		filePath, ok := request.Params.Arguments["filePath"].(string)
-		if !ok || filePath == "" {
-			errMsg := "错误: filePath必须是非空字符串"
-			log.Println(errMsg)
-			logToolCall("record_edit", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
-		}
+	// 注册工具：重新分析记忆
+	reanalyzeMemoryTool := mcp.NewTool("reanalyze_memory",
+		mcp.WithDescription("对已存储的记忆重新执行LLM分析，把时间线、知识图谱和多向量数据补充写入同一记忆ID，不新建记录；已写入过的存储引擎不会重复写入"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("memoryId",
+			mcp.Required(),
+			mcp.Description("要重新分析的记忆ID"),
+		),
+	)
+	s.AddTool(reanalyzeMemoryTool, withRateLimit(contextService, reanalyzeMemoryHandler(contextService)))
 
-		diff, ok := request.Params.Arguments["diff"].(string)
-		if !ok {
-			errMsg := "错误: diff必须是字符串"
-			log.Println(errMsg)
-			logToolCall("record_edit", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
-		}
+	// 注册工具：按metadata查询记忆
+	queryByMetadataTool := mcp.NewTool("query_by_metadata",
+		mcp.WithDescription("按metadata键值和键存在性精确查询当前用户的记忆，多个条件同时满足；键可用点号访问嵌套字段（含以JSON字符串存储的嵌套对象）。用户范围在向量存储服务端过滤，metadata条件在扫描结果上过滤"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithObject("metadata",
+			mcp.Description("键值相等条件，值为字符串、数字或bool；记录中的值为数组时包含该值即满足，如{\"team\": \"infra\", \"source.project\": \"OPS\"}"),
+		),
+		mcp.WithArray("exists",
+			mcp.Description("必须存在的metadata键列表"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("返回数量，默认20，最大100"),
+		),
+		mcp.WithBoolean("includeArchived",
+			mcp.Description("是否包含已归档的记忆，默认false"),
+		),
+	)
+	s.AddTool(queryByMetadataTool, withRateLimit(contextService, queryByMetadataHandler(contextService)))
+
+	// 注册工具：列出记忆
+	listMemoriesTool := mcp.NewTool("list_memories",
+		mcp.WithDescription("按类型、优先级过滤并排序浏览会话中已存储的记忆，返回分页结果和匹配总数"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("type",
+			mcp.Description("记忆类型，可选: long_term_memory, todo, conversation_summary，默认全部"),
+		),
+		mcp.WithString("priority",
+			mcp.Description("优先级，可选: P0, P1, P2, P3，默认全部"),
+		),
+		mcp.WithString("sortBy",
+			mcp.Description("排序方式: timestamp(默认，新的在前), priority(高优先级在前)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("每页返回数量，默认20，最大100"),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("分页偏移量，默认0"),
+		),
+		mcp.WithBoolean("includeArchived",
+			mcp.Description("同时列出已归档的记忆（列表项带archived标记），默认false"),
+		),
+	)
+	s.AddTool(listMemoriesTool, withRateLimit(contextService, listMemoriesHandler(contextService)))
+
+	// 注册工具：会话统计
+	sessionStatsTool := mcp.NewTool("session_stats",
+		mcp.WithDescription("获取会话统计：记忆按类型/优先级/存储引擎(timeline/knowledge_graph/vector)的分布、估算token数、消息数和最近活动时间；只统计当前用户的记录"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+	)
+	s.AddTool(sessionStatsTool, withRateLimit(contextService, sessionStatsHandler(contextService)))
+
+	// 注册工具：获取完整对话记录
+	getConversationTool := mcp.NewTool("get_conversation",
+		mcp.WithDescription("按时间顺序返回会话或批次的完整对话记录（角色、内容、时间戳），拆分批次({batchId}-N)合并为一份记录"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("batchId",
+			mcp.Description("store_conversation返回的批次ID，可选，不传时返回整个会话的对话"),
+		),
+		mcp.WithBoolean("includeArchived",
+			mcp.Description("从向量存储还原对话时同时返回已归档的批次，默认false"),
+		),
+	)
+	s.AddTool(getConversationTool, withRateLimit(contextService, getConversationHandler(contextService)))
+
+	// 注册工具：列出工作空间
+	listWorkspacesTool := mcp.NewTool("list_workspaces",
+		mcp.WithDescription("列出用户会话涉及的工作空间（名称、哈希、最近活跃时间、当前活跃会话），供客户端选择工作空间"),
+		mcp.WithString("userId",
+			mcp.Required(),
+			mcp.Description("用户ID，必需参数"),
+		),
+	)
+	s.AddTool(listWorkspacesTool, withRateLimit(contextService, listWorkspacesHandler(contextService)))
+
+	// 注册工具：查询异步存储状态
+	getStoreStatusTool := mcp.NewTool("get_store_status",
+		mcp.WithDescription("查询异步memorize_context任务的状态(queued/processing/done/failed)，完成后返回记忆ID和分析结果"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("提交任务时使用的会话ID"),
+		),
+		mcp.WithString("jobId",
+			mcp.Required(),
+			mcp.Description("memorize_context异步调用返回的任务ID"),
+		),
+	)
+	s.AddTool(getStoreStatusTool, withRateLimit(contextService, getStoreStatusHandler(contextService)))
+
+	// 注册工具：导出会话
+	exportSessionTool := mcp.NewTool("export_session",
+		mcp.WithDescription("导出会话的元数据、消息、代码上下文、编辑历史及关联的长期记忆，用于备份或迁移到其他设备"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("要导出的会话ID"),
+		),
+	)
+	s.AddTool(exportSessionTool, withRateLimit(contextService, exportSessionHandler(contextService)))
+
+	// 注册工具：导入会话
+	importSessionTool := mcp.NewTool("import_session",
+		mcp.WithDescription("将export_session导出的数据恢复到当前用户名下，缺失的长期记忆会重新生成向量"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("data",
+			mcp.Required(),
+			mcp.Description("export_session返回的JSON数据"),
+		),
+		mcp.WithString("targetSessionId",
+			mcp.Description("导入后的会话ID，可选，默认使用导出数据中的会话ID"),
+		),
+		mcp.WithBoolean("force",
+			mcp.Description("目标会话已存在时是否覆盖，默认false"),
+		),
+	)
+	s.AddTool(importSessionTool, withRateLimit(contextService, importSessionHandler(contextService)))
+
+	// 注册工具：合并会话
+	mergeSessionsTool := mcp.NewTool("merge_sessions",
+		mcp.WithDescription("将源会话的消息、代码上下文、编辑历史和长期记忆并入目标会话，并归档源会话。两个会话必须属于同一用户"),
+		mcp.WithString("targetSessionId",
+			mcp.Required(),
+			mcp.Description("合并后保留的目标会话ID"),
+		),
+		mcp.WithString("sourceSessionId",
+			mcp.Required(),
+			mcp.Description("被并入并归档的源会话ID"),
+		),
+	)
+	s.AddTool(mergeSessionsTool, withRateLimit(contextService, mergeSessionsHandler(contextService)))
+
+	// 注册工具：关联会话
+	linkSessionsTool := mcp.NewTool("link_sessions",
+		mcp.WithDescription("在两个会话之间建立带类型的关联（continues/related/forked-from），双向记录并在programming_context的关联会话中返回。两个会话必须属于同一用户，不能重复关联"),
+		mcp.WithString("sourceSessionId",
+			mcp.Required(),
+			mcp.Description("源会话ID"),
+		),
+		mcp.WithString("targetSessionId",
+			mcp.Required(),
+			mcp.Description("目标会话ID"),
+		),
+		mcp.WithString("relationship",
+			mcp.Description("从源会话看目标会话的关系: continues（源会话延续目标会话）, related（默认）, forked-from（源会话从目标会话分出）"),
+		),
+		mcp.WithString("description",
+			mcp.Description("关联说明，可选"),
+		),
+		mcp.WithArray("topics",
+			mcp.Description("关联涉及的主题，可选"),
+		),
+	)
+	s.AddTool(linkSessionsTool, withRateLimit(contextService, linkSessionsHandler(contextService)))
+
+	// 注册工具：获取未确认的本地指令
+	getPendingInstructionsTool := mcp.NewTool("get_pending_instructions",
+		mcp.WithDescription("获取通过WebSocket推送但尚未确认的本地指令，用于补拉断线期间错过的指令；执行后通过回调确认"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+	)
+	s.AddTool(getPendingInstructionsTool, withRateLimit(contextService, getPendingInstructionsHandler()))
+
+	// 注册工具：用户初始化对话
+	userInitDialogTool := mcp.NewTool("user_init_dialog",
+		mcp.WithDescription("用户初始化对话处理"),
+		mcp.WithString("sessionId",
+			mcp.Required(),
+			mcp.Description("当前会话ID"),
+		),
+		mcp.WithString("userResponse",
+			mcp.Description("用户对初始化提示的响应"),
+		),
+	)
+	s.AddTool(userInitDialogTool, userInitDialogHandler())
+}
+
+// 工具处理函数
+
+// toolErrorResult 构建带错误码的工具错误结果，message为本地化描述，客户端可按code判断是否重试
+func toolErrorResult(message string, err error) *mcp.CallToolResult {
+	errorObj := apperrors.Response(err)
+	errorObj["message"] = message
+	jsonBytes, _ := json.Marshal(map[string]interface{}{
+		"success": false,
+		"error":   errorObj,
+	})
+
+	result := mcp.NewToolResultText(string(jsonBytes))
+	result.IsError = true
+	return result
+}
+
+// withRateLimit 在调用工具处理器前检查限流，超出时直接返回带retryAfter的结构化错误
+func withRateLimit(contextService *services.ContextService, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+		toolName := request.Params.Name
+
+		err := contextService.CheckToolRateLimit(toolName, request.Params.Arguments, utils.GetCachedUserID())
+		if err == nil {
+			return handler(ctx, request)
+		}
+
+		response := map[string]interface{}{"success": false, "error": err.Error()}
+		if limited, ok := err.(*services.RateLimitError); ok {
+			response = limited.ToResponse()
+		}
+		jsonBytes, _ := json.Marshal(response)
+		logToolCall(toolName, request.Params.Arguments, string(jsonBytes), err, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonBytes)), nil
+	}
+}
+
+// associateFileHandler 处理文件关联请求
+func associateFileHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("associate_file", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		filePath, ok := request.Params.Arguments["filePath"].(string)
+		if !ok || filePath == "" {
+			errMsg := "错误: filePath必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("associate_file", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		log.Printf("关联文件: sessionID=%s, filePath=%s", sessionID, filePath)
+
+		err := contextService.AssociateFile(ctx, models.AssociateFileRequest{
+			SessionID: sessionID,
+			FilePath:  filePath,
+		})
+		if err != nil {
+			errMsg := fmt.Sprintf("关联文件失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("associate_file", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		successMsg := fmt.Sprintf("成功关联文件: %s", filePath)
+		log.Println(successMsg)
+		logToolCall("associate_file", request.Params.Arguments, successMsg, nil, time.Since(startTime))
+		return mcp.NewToolResultText(successMsg), nil
+	}
+}
+
+// recordEditHandler 处理编辑记录请求
+func recordEditHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("record_edit", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		filePath, ok := request.Params.Arguments["filePath"].(string)
+		if !ok || filePath == "" {
+			errMsg := "错误: filePath必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("record_edit", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		diff, ok := request.Params.Arguments["diff"].(string)
+		if !ok {
+			errMsg := "错误: diff必须是字符串"
+			log.Println(errMsg)
+			logToolCall("record_edit", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
 
 		log.Printf("记录编辑: sessionID=%s, filePath=%s, diff长度=%d", sessionID, filePath, len(diff))
 
@@ -751,7 +1381,7 @@ func recordEditHandler(contextService *services.ContextService) func(ctx context
 			errMsg := fmt.Sprintf("记录编辑失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("record_edit", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		successMsg := "成功记录编辑操作"
@@ -793,18 +1423,80 @@ func retrieveContextHandler(contextService *services.ContextService) func(ctx co
 			}
 		}
 
-		log.Printf("检索上下文: sessionID=%s, query=%s, isBruteSearch=%d", sessionID, query, isBruteSearch)
+		// 分页参数
+		offset := getIntArgument(request.Params.Arguments, "offset", 0)
+		pageSize := getIntArgument(request.Params.Arguments, "pageSize", 0)
+		topK := getIntArgument(request.Params.Arguments, "topK", 0)
+		// 单次调用的相似度阈值
+		threshold := getFloatArgument(request.Params.Arguments, "threshold", 0)
+		// 混合检索参数
+		hybridSearch, _ := request.Params.Arguments["hybridSearch"].(bool)
+		hybridAlpha := getOptionalFloatArgument(request.Params.Arguments, "hybridAlpha")
+		// LLM重排序
+		rerank, _ := request.Params.Arguments["rerank"].(bool)
+		// 多维度向量检索
+		multiVector, _ := request.Params.Arguments["multiVector"].(bool)
+		// 时间范围（unix秒）与排序方式
+		startTimeArg := int64(getIntArgument(request.Params.Arguments, "startTime", 0))
+		endTimeArg := int64(getIntArgument(request.Params.Arguments, "endTime", 0))
+		sortBy, _ := request.Params.Arguments["sortBy"].(string)
+		groupBy, _ := request.Params.Arguments["groupBy"].(string)
+		// 命名集合
+		collection, _ := request.Params.Arguments["collection"].(string)
+		// 结构化结果
+		structured, _ := request.Params.Arguments["structured"].(bool)
+		// 知识图谱扩展
+		graphExpand, _ := request.Params.Arguments["graphExpand"].(bool)
+		// token预算
+		maxTokens := getIntArgument(request.Params.Arguments, "maxTokens", 0)
+		// 检索诊断
+		explain, _ := request.Params.Arguments["explain"].(bool)
+		// 优先级加权排序
+		priorityBoost, _ := request.Params.Arguments["priorityBoost"].(bool)
+		priorityWeight := getFloatArgument(request.Params.Arguments, "priorityWeight", 0)
+		// 时间衰减加权排序
+		recencyBoost, _ := request.Params.Arguments["recencyBoost"].(bool)
+		recencyWeight := getFloatArgument(request.Params.Arguments, "recencyWeight", 0)
+		recencyHalfLife := getFloatArgument(request.Params.Arguments, "recencyHalfLife", 0)
+		// 是否同时返回已归档的记忆
+		includeArchived, _ := request.Params.Arguments["includeArchived"].(bool)
+
+		log.Printf("检索上下文: sessionID=%s, query=%s, isBruteSearch=%d, offset=%d, pageSize=%d, topK=%d, threshold=%.4f, hybridSearch=%v, rerank=%v, multiVector=%v, timeRange=[%d, %d], sortBy=%s, groupBy=%s, structured=%v, graphExpand=%v, maxTokens=%d, explain=%v, priorityBoost=%v, recencyBoost=%v, includeArchived=%v",
+			sessionID, query, isBruteSearch, offset, pageSize, topK, threshold, hybridSearch, rerank, multiVector, startTimeArg, endTimeArg, sortBy, groupBy, structured, graphExpand, maxTokens, explain, priorityBoost, recencyBoost, includeArchived)
 
 		result, err := contextService.RetrieveContext(ctx, models.RetrieveContextRequest{
-			SessionID:     sessionID,
-			Query:         query,
-			IsBruteSearch: isBruteSearch, // 传递暴力搜索参数
+			SessionID:       sessionID,
+			Query:           query,
+			IsBruteSearch:   isBruteSearch, // 传递暴力搜索参数
+			Threshold:       threshold,
+			Offset:          offset,
+			PageSize:        pageSize,
+			TopK:            topK,
+			HybridSearch:    hybridSearch,
+			HybridAlpha:     hybridAlpha,
+			Rerank:          rerank,
+			MultiVector:     multiVector,
+			StartTime:       startTimeArg,
+			EndTime:         endTimeArg,
+			SortBy:          sortBy,
+			GroupBy:         groupBy,
+			Collection:      collection,
+			Structured:      structured,
+			GraphExpand:     graphExpand,
+			MaxTokens:       maxTokens,
+			Explain:         explain,
+			PriorityBoost:   priorityBoost,
+			PriorityWeight:  priorityWeight,
+			RecencyBoost:    recencyBoost,
+			RecencyWeight:   recencyWeight,
+			RecencyHalfLife: recencyHalfLife,
+			IncludeArchived: includeArchived,
 		})
 		if err != nil {
 			errMsg := fmt.Sprintf("检索上下文失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("retrieve_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		// 使用json.Marshal正确序列化结果
@@ -813,7 +1505,7 @@ func retrieveContextHandler(contextService *services.ContextService) func(ctx co
 			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("retrieve_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		log.Printf("检索上下文成功: 结果长度=%d字节", len(jsonData))
@@ -846,15 +1538,21 @@ func programmingContextHandler(contextService *services.ContextService) func(ctx
 			}
 		}
 
-		log.Printf("获取编程上下文: sessionID=%s, query=%s", sessionID, query)
+		includeTimeline, _ := request.Params.Arguments["includeTimeline"].(bool)
+
+		log.Printf("获取编程上下文: sessionID=%s, query=%s, includeTimeline=%v", sessionID, query, includeTimeline)
 
-		// 使用GetProgrammingContext方法获取编程上下文
-		result, err := contextService.GetProgrammingContext(ctx, sessionID, query)
+		// 使用GetProgrammingContextWithOptions方法获取编程上下文
+		result, err := contextService.GetProgrammingContextWithOptions(ctx, models.ProgrammingContextRequest{
+			SessionID:       sessionID,
+			Query:           query,
+			IncludeTimeline: includeTimeline,
+		})
 		if err != nil {
 			errMsg := fmt.Sprintf("获取编程上下文失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("programming_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		// 使用json.Marshal正确序列化结果
@@ -863,7 +1561,7 @@ func programmingContextHandler(contextService *services.ContextService) func(ctx
 			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("programming_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		log.Printf("获取编程上下文成功: 结果长度=%d字节", len(jsonData))
@@ -895,6 +1593,11 @@ func sessionManagementHandler(contextService *services.ContextService) func(ctx
 			userID = utils.GetCachedUserID()
 			log.Printf("🔍 [会话管理] 从缓存获取userID: %s", userID)
 		}
+		if userID != "" && !models.IsValidUserID(userID) {
+			errMsg := fmt.Sprintf("用户ID格式非法: %q（应为user_加字母、数字或下划线）", userID)
+			logToolCall("session_management", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
 
 		// 获取元数据
 		metadataRaw, hasMetadata := request.Params.Arguments["metadata"]
@@ -948,7 +1651,7 @@ func sessionManagementHandler(contextService *services.ContextService) func(ctx
 			errMsg := fmt.Sprintf("获取用户会话存储失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("session_management", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		switch action {
@@ -975,7 +1678,7 @@ func sessionManagementHandler(contextService *services.ContextService) func(ctx
 				log.Printf("🔍 [会话管理] 步骤5 - GetWorkspaceSessionID失败: %v", err)
 				log.Println(errMsg)
 				logToolCall("session_management", request.Params.Arguments, errMsg, err, time.Since(startTime))
-				return mcp.NewToolResultText(errMsg), nil
+				return toolErrorResult(errMsg, err), nil
 			}
 
 			log.Printf("🔍 [会话管理] 步骤5 - GetWorkspaceSessionID成功: sessionID=%s, isNew=%t", session.ID, isNewSession)
@@ -1018,7 +1721,7 @@ func sessionManagementHandler(contextService *services.ContextService) func(ctx
 				errMsg := fmt.Sprintf("获取会话失败: %v", err)
 				log.Println(errMsg)
 				logToolCall("session_management", request.Params.Arguments, errMsg, err, time.Since(startTime))
-				return mcp.NewToolResultText(errMsg), nil
+				return toolErrorResult(errMsg, err), nil
 			}
 
 			// 构建会话信息响应
@@ -1062,12 +1765,11 @@ func sessionManagementHandler(contextService *services.ContextService) func(ctx
 				return mcp.NewToolResultText(errMsg), nil
 			}
 
-			session, err := sessionStore.GetSession(sessionID)
-			if err != nil {
+			if _, err := sessionStore.GetSession(sessionID); err != nil {
 				errMsg := fmt.Sprintf("获取会话失败: %v", err)
 				log.Println(errMsg)
 				logToolCall("session_management", request.Params.Arguments, errMsg, err, time.Since(startTime))
-				return mcp.NewToolResultText(errMsg), nil
+				return toolErrorResult(errMsg, err), nil
 			}
 
 			// 如果有用户ID，添加到元数据
@@ -1078,29 +1780,76 @@ func sessionManagementHandler(contextService *services.ContextService) func(ctx
 				metadata["userId"] = userID
 			}
 
-			// 更新元数据
-			if metadata != nil {
-				if session.Metadata == nil {
-					session.Metadata = metadata
-				} else {
-					for k, v := range metadata {
-						session.Metadata[k] = v
+			// 在存储写锁内更新元数据和最后活动时间并保存，避免与清理任务的写入交错
+			err := sessionStore.ModifySession(sessionID, func(session *models.Session) error {
+				if metadata != nil {
+					if session.Metadata == nil {
+						session.Metadata = metadata
+					} else {
+						for k, v := range metadata {
+							session.Metadata[k] = v
+						}
 					}
 				}
+				session.LastActive = time.Now()
+				return nil
+			})
+			if err != nil {
+				errMsg := fmt.Sprintf("更新会话失败: %v", err)
+				log.Println(errMsg)
+				logToolCall("session_management", request.Params.Arguments, errMsg, err, time.Since(startTime))
+				return toolErrorResult(errMsg, err), nil
 			}
 
-			// 更新最后活动时间
-			session.LastActive = time.Now()
+			responseStr := fmt.Sprintf("{\"status\":\"success\",\"sessionId\":\"%s\"}", sessionID)
+			logToolCall("session_management", request.Params.Arguments, responseStr, nil, time.Since(startTime))
+			return mcp.NewToolResultText(responseStr), nil
 
-			// 保存会话
-			if err := sessionStore.SaveSession(session); err != nil {
-				errMsg := fmt.Sprintf("更新会话失败: %v", err)
+		case "pin", "unpin":
+			if sessionID == "" {
+				errMsg := fmt.Sprintf("错误: %s会话时sessionId不能为空", action)
 				log.Println(errMsg)
-				logToolCall("session_management", request.Params.Arguments, errMsg, err, time.Since(startTime))
+				logToolCall("session_management", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
 				return mcp.NewToolResultText(errMsg), nil
 			}
 
-			responseStr := fmt.Sprintf("{\"status\":\"success\",\"sessionId\":\"%s\"}", sessionID)
+			pinned := action == "pin"
+			if err := contextService.SetSessionPinned(userID, sessionID, pinned); err != nil {
+				errMsg := fmt.Sprintf("设置会话置顶状态失败: %v", err)
+				log.Println(errMsg)
+				logToolCall("session_management", request.Params.Arguments, errMsg, err, time.Since(startTime))
+				return toolErrorResult(errMsg, err), nil
+			}
+
+			responseStr := fmt.Sprintf("{\"status\":\"success\",\"sessionId\":\"%s\",\"pinned\":%t}", sessionID, pinned)
+			logToolCall("session_management", request.Params.Arguments, responseStr, nil, time.Since(startTime))
+			return mcp.NewToolResultText(responseStr), nil
+
+		case "switch_workspace":
+			workspace, _ := request.Params.Arguments["workspaceHash"].(string)
+			if workspace == "" {
+				workspace, _ = request.Params.Arguments["workspaceRoot"].(string)
+			}
+
+			session, err := contextService.SwitchWorkspace(userID, workspace)
+			if err != nil {
+				errMsg := fmt.Sprintf("切换工作空间失败: %v", err)
+				log.Println(errMsg)
+				logToolCall("session_management", request.Params.Arguments, errMsg, err, time.Since(startTime))
+				return toolErrorResult(errMsg, err), nil
+			}
+
+			workspaceHash, _ := session.Metadata["workspaceHash"].(string)
+			result := map[string]interface{}{
+				"sessionId":     session.ID,
+				"status":        "active",
+				"lastActive":    session.LastActive,
+				"userID":        userID,
+				"workspaceHash": workspaceHash,
+			}
+
+			jsonData, _ := json.Marshal(result)
+			responseStr := string(jsonData)
 			logToolCall("session_management", request.Params.Arguments, responseStr, nil, time.Since(startTime))
 			return mcp.NewToolResultText(responseStr), nil
 
@@ -1130,6 +1879,7 @@ func sessionManagementHandler(contextService *services.ContextService) func(ctx
 					"lastActive": session.LastActive,
 					"status":     session.Status,
 					"summary":    session.Summary,
+					"pinned":     session.Metadata[models.SessionMetadataPinned] == true,
 				}
 				responseList = append(responseList, sessionInfo)
 			}
@@ -1187,6 +1937,32 @@ func storeConversationHandler(contextService *services.ContextService) func(ctx
 		// 可选的批次ID
 		batchID, _ := request.Params.Arguments["batchId"].(string)
 
+		// 幂等键：窗口内的重复请求直接返回首次的batchId和结果，不重复写入；未获取到用户时按会话隔离
+		idempotencyKey, _ := request.Params.Arguments["idempotencyKey"].(string)
+		idempotencyScope, _, _ := utils.GetUserID()
+		if idempotencyScope == "" {
+			idempotencyScope = sessionID
+		}
+		replay, err := contextService.BeginIdempotentRequest("store_conversation", idempotencyScope, idempotencyKey)
+		if err != nil {
+			errMsg := fmt.Sprintf("存储对话到短期记忆失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("store_conversation", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+		if replay != nil {
+			jsonData, _ := json.Marshal(replay)
+			log.Printf("[对话存储] 幂等键 %s 已处理，返回首次结果", idempotencyKey)
+			logToolCall("store_conversation", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+			return mcp.NewToolResultText(string(jsonData)), nil
+		}
+		idempotencyCompleted := false
+		defer func() {
+			if !idempotencyCompleted {
+				contextService.AbortIdempotentRequest("store_conversation", idempotencyScope, idempotencyKey)
+			}
+		}()
+
 		// 如果未提供batchID，生成一个新的memoryId作为batchId
 		// memoryId格式为UUID，如果有需要拆分，可以按"memoryId-1", "memoryId-2"等格式拆分
 		if batchID == "" {
@@ -1276,7 +2052,7 @@ func storeConversationHandler(contextService *services.ContextService) func(ctx
 			errMsg := fmt.Sprintf("存储对话到短期记忆失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("store_conversation", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 		// 生成对话摘要
 		summary, err := contextService.SummarizeContext(ctx, models.SummarizeContextRequest{
@@ -1295,78 +2071,11 @@ func storeConversationHandler(contextService *services.ContextService) func(ctx
 		// 获取用户ID用于WebSocket推送
 		userID, _, err := utils.GetUserID()
 		if err == nil && userID != "" {
-			// 构建本地指令
-			localInstruction := map[string]interface{}{
-				"type":    "short_memory",
-				"target":  fmt.Sprintf("~/Library/Application Support/context-keeper/users/%s/histories/%s.json", userID, sessionID),
-				"content": msgReqs,
-				"options": map[string]interface{}{
-					"createDir":  true,
-					"merge":      true,
-					"maxAge":     604800, // 7天
-					"cleanupOld": true,
-				},
-				"callbackId": fmt.Sprintf("short_memory_%s_%d", sessionID, time.Now().UnixNano()),
-				"priority":   "normal",
-			}
-
-			// 尝试通过WebSocket推送本地指令
-			// 注意：这里我们需要导入WebSocket管理器
 			// 推送失败不影响MCP响应的正常返回
-			result["localInstruction"] = localInstruction
-
-			log.Printf("[WebSocket] 准备推送本地指令到用户: %s", userID)
-			// TODO: 这里需要调用WebSocket推送逻辑
-
-			// 尝试通过WebSocket推送指令
-			if services.GlobalWSManager != nil {
-				instruction := models.LocalInstruction{
-					Type:    models.LocalInstructionType(localInstruction["type"].(string)),
-					Target:  localInstruction["target"].(string),
-					Content: localInstruction["content"],
-					Options: models.LocalOperationOptions{
-						CreateDir:  true,
-						Merge:      true,
-						MaxAge:     604800,
-						CleanupOld: true,
-					},
-					CallbackID: localInstruction["callbackId"].(string),
-					Priority:   localInstruction["priority"].(string),
-				}
-
-				// 🔥 精确推送：优先使用基于sessionId的精确推送
-				var callbackChan chan models.CallbackResult
-				if sessionChan, sessionErr := services.GlobalWSManager.PushInstructionToSession(sessionID, instruction); sessionErr == nil {
-					callbackChan = sessionChan
-					log.Printf("[WebSocket] 本地指令已精确推送到会话 %s: %s", sessionID, instruction.CallbackID)
-				} else {
-					log.Printf("[WebSocket] 精确推送失败 (会话 %s 未注册)，回退到用户级别推送: %v", sessionID, sessionErr)
-					// 回退到传统的用户级别推送
-					if fallbackChan, fallbackErr := services.GlobalWSManager.PushInstruction(userID, instruction); fallbackErr == nil {
-						callbackChan = fallbackChan
-						log.Printf("[WebSocket] 回退推送成功: %s", instruction.CallbackID)
-					} else {
-						log.Printf("[WebSocket] 回退推送也失败: %v", fallbackErr)
-					}
-				}
-
-				if callbackChan != nil {
-					log.Printf("[WebSocket] 本地指令已推送: %s", instruction.CallbackID)
-
-					// 异步等待回调结果（不阻塞MCP响应）
-					go func() {
-						select {
-						case callbackResult := <-callbackChan:
-							log.Printf("[WebSocket] 本地指令执行完成: %s - %s", instruction.CallbackID, callbackResult.Message)
-						case <-time.After(30 * time.Second):
-							log.Printf("[WebSocket] 本地指令执行超时: %s", instruction.CallbackID)
-						}
-					}()
-				} else {
-					log.Printf("[WebSocket] 推送指令失败: %v, 用户可能未连接WebSocket", err)
-				}
-			}
+			result["localInstruction"] = pushShortMemoryInstruction(sessionID, userID, msgReqs)
 		}
+		contextService.CompleteIdempotentRequest("store_conversation", idempotencyScope, idempotencyKey, result)
+		idempotencyCompleted = true
 
 		jsonData, _ := json.Marshal(result)
 		responseStr := string(jsonData)
@@ -1399,6 +2108,7 @@ func retrieveMemoryHandler(contextService *services.ContextService) func(ctx con
 		}
 
 		format, _ := request.Params.Arguments["format"].(string)
+		assembleChunks, _ := request.Params.Arguments["assembleChunks"].(bool)
 
 		if memoryID == "" && batchID == "" {
 			errMsg := "错误: 必须至少提供memoryId或batchId之一"
@@ -1412,10 +2122,11 @@ func retrieveMemoryHandler(contextService *services.ContextService) func(ctx con
 
 		// 创建检索请求
 		req := models.RetrieveContextRequest{
-			SessionID:     sessionID,
-			MemoryID:      memoryID,
-			BatchID:       batchID,
-			SkipThreshold: true, // 对精确ID检索跳过相似度过滤
+			SessionID:      sessionID,
+			MemoryID:       memoryID,
+			BatchID:        batchID,
+			SkipThreshold:  true, // 对精确ID检索跳过相似度过滤
+			AssembleChunks: assembleChunks,
 		}
 
 		// 执行检索
@@ -1424,7 +2135,7 @@ func retrieveMemoryHandler(contextService *services.ContextService) func(ctx con
 			errMsg := fmt.Sprintf("检索记忆失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("retrieve_memory", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		// 根据格式选择返回方式
@@ -1450,7 +2161,7 @@ func retrieveMemoryHandler(contextService *services.ContextService) func(ctx con
 			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("retrieve_memory", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		log.Printf("检索记忆成功: 结果长度=%d字节", len(jsonData))
@@ -1474,8 +2185,12 @@ func memorizeContextHandler(contextService *services.ContextService) func(ctx co
 			return mcp.NewToolResultText(errMsg), nil
 		}
 
-		content, ok := request.Params.Arguments["content"].(string)
-		if !ok || content == "" {
+		// 图片记忆的说明文字可选，文本记忆必须提供内容
+		contentType, _ := request.Params.Arguments["contentType"].(string)
+		contentRef, _ := request.Params.Arguments["contentRef"].(string)
+		collection, _ := request.Params.Arguments["collection"].(string)
+		content, _ := request.Params.Arguments["content"].(string)
+		if content == "" && contentType != models.ContentTypeImage {
 			errMsg := "错误: content必须是非空字符串"
 			log.Println(errMsg)
 			logToolCall("memorize_context", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
@@ -1483,12 +2198,18 @@ func memorizeContextHandler(contextService *services.ContextService) func(ctx co
 		}
 
 		// 可选参数
+		// 未指定时由服务端按分析结果推断
 		priority, _ := request.Params.Arguments["priority"].(string)
-		if priority == "" {
-			priority = "P2" // 默认中等优先级
-		}
 
-		// 处理元数据
+		locale, _ := request.Params.Arguments["locale"].(string)
+		if err := services.ValidateLocale(locale); err != nil {
+			errMsg := fmt.Sprintf("错误: %v", err)
+			log.Println(errMsg)
+			logToolCall("memorize_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		// 处理元数据
 		metadata := make(map[string]interface{})
 		if metadataRaw, ok := request.Params.Arguments["metadata"]; ok {
 			if metadataMap, ok := metadataRaw.(map[string]interface{}); ok {
@@ -1537,12 +2258,8 @@ func memorizeContextHandler(contextService *services.ContextService) func(ctx co
 			bizType = models.BizTypeTodo
 			log.Printf("[记忆上下文] 设置bizType=%d (BizTypeTodo)", models.BizTypeTodo)
 		} else {
-			// 2. 使用扩展的正则表达式检查内容格式
-			todoRegex := regexp.MustCompile(`(?i)^(- \[ \]|TODO:|待办:|提醒:|task:)`)
-			// 3. 检查内容中是否包含待办关键词
-			todoKeywordsRegex := regexp.MustCompile(`(?i)(待办事项|todo item|task list|待完成|to-do|to do)`)
-
-			if todoRegex.MatchString(content) || todoKeywordsRegex.MatchString(content) {
+			// 2. 按内容语言检查待办标记和待办关键词
+			if services.IsTodoContent(content, locale) {
 				log.Printf("[记忆上下文] 检测到待办事项: %s", content)
 				metadata["type"] = "todo" // 确保type字段为todo
 				bizType = models.BizTypeTodo
@@ -1558,27 +2275,136 @@ func memorizeContextHandler(contextService *services.ContextService) func(ctx co
 			sessionID, userID, metadata["type"], priority)
 
 		// 创建存储上下文请求
+		dedup, _ := request.Params.Arguments["dedup"].(bool)
 		storeRequest := models.StoreContextRequest{
-			SessionID: sessionID,
-			UserID:    userID,
-			Content:   content,
-			Priority:  priority,
-			Metadata:  metadata,
-			BizType:   bizType,
+			SessionID:   sessionID,
+			UserID:      userID,
+			Content:     content,
+			Priority:    priority,
+			Metadata:    metadata,
+			BizType:     bizType,
+			Dedup:       dedup,
+			Locale:      locale,
+			ContentType: contentType,
+			ContentRef:  contentRef,
+			Collection:  collection,
+		}
+
+		// 试运行：只返回分析结果，不写入存储
+		if dryRun, _ := request.Params.Arguments["dryRun"].(bool); dryRun {
+			dryRunResult, err := contextService.DryRunStoreContext(ctx, storeRequest)
+			if err != nil {
+				errMsg := fmt.Sprintf("试运行分析失败: %v", err)
+				log.Println(errMsg)
+				logToolCall("memorize_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
+				return toolErrorResult(errMsg, err), nil
+			}
+
+			response := map[string]interface{}{
+				"success":         true,
+				"dryRun":          true,
+				"message":         "试运行完成，未写入任何存储",
+				"type":            metadata["type"],
+				"analysisResult":  dryRunResult.AnalysisResult,
+				"storageStrategy": dryRunResult.StorageStrategy,
+				"confidence":      dryRunResult.Confidence,
+				"priority":        dryRunResult.Priority,
+				"targetEngines":   dryRunResult.Metadata["targetEngines"],
+				"needUserInit":    needUserInit,
+			}
+			if userID != "" {
+				response["userId"] = userID
+			}
+			if needUserInit {
+				response["initPrompt"] = "需要进行用户初始化才能将记忆与您的个人账户关联。请完成用户初始化流程。"
+			}
+
+			jsonData, err := json.Marshal(response)
+			if err != nil {
+				errMsg := fmt.Sprintf("序列化响应失败: %v", err)
+				log.Println(errMsg)
+				logToolCall("memorize_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
+				return toolErrorResult(errMsg, err), nil
+			}
+			logToolCall("memorize_context", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+			return mcp.NewToolResultText(string(jsonData)), nil
+		}
+
+		// 幂等键：窗口内的重复请求直接返回首次结果，不重复写入；未获取到用户时按会话隔离
+		idempotencyKey, _ := request.Params.Arguments["idempotencyKey"].(string)
+		idempotencyScope := userID
+		if idempotencyScope == "" {
+			idempotencyScope = sessionID
+		}
+		replay, err := contextService.BeginIdempotentRequest("memorize_context", idempotencyScope, idempotencyKey)
+		if err != nil {
+			errMsg := fmt.Sprintf("存储长期记忆失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("memorize_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+		if replay != nil {
+			jsonData, _ := json.Marshal(replay)
+			log.Printf("[记忆上下文] 幂等键 %s 已处理，返回首次结果", idempotencyKey)
+			logToolCall("memorize_context", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+			return mcp.NewToolResultText(string(jsonData)), nil
+		}
+		idempotencyCompleted := false
+		defer func() {
+			if !idempotencyCompleted {
+				contextService.AbortIdempotentRequest("memorize_context", idempotencyScope, idempotencyKey)
+			}
+		}()
+
+		// 异步存储：入队后立即返回任务ID
+		if async, _ := request.Params.Arguments["async"].(bool); async {
+			job, err := contextService.EnqueueStoreContext(storeRequest)
+			if err != nil {
+				errMsg := fmt.Sprintf("提交异步存储任务失败: %v", err)
+				log.Println(errMsg)
+				logToolCall("memorize_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
+				return toolErrorResult(errMsg, err), nil
+			}
+
+			response := map[string]interface{}{
+				"success":      true,
+				"async":        true,
+				"jobId":        job.JobID,
+				"status":       job.Status,
+				"message":      "存储任务已提交，可通过get_store_status查询结果",
+				"type":         metadata["type"],
+				"needUserInit": needUserInit,
+			}
+			if userID != "" {
+				response["userId"] = userID
+			}
+
+			jsonData, err := json.Marshal(response)
+			if err != nil {
+				errMsg := fmt.Sprintf("序列化响应失败: %v", err)
+				log.Println(errMsg)
+				logToolCall("memorize_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
+				return toolErrorResult(errMsg, err), nil
+			}
+			contextService.CompleteIdempotentRequest("memorize_context", idempotencyScope, idempotencyKey, response)
+			idempotencyCompleted = true
+			logToolCall("memorize_context", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+			return mcp.NewToolResultText(string(jsonData)), nil
 		}
 
 		log.Printf("存储长期记忆: sessionID=%s, 内容长度=%d, 优先级=%s, 类型=%s",
 			sessionID, len(content), priority, metadata["type"])
 
 		// 调用长期记忆存储
-		memoryID, err := contextService.StoreContext(ctx, storeRequest)
+		storeResponse, err := contextService.StoreContextDetailed(ctx, storeRequest)
 
 		if err != nil {
 			errMsg := fmt.Sprintf("存储长期记忆失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("memorize_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
+		memoryID := storeResponse.MemoryID
 
 		// 构建响应
 		response := map[string]interface{}{
@@ -1587,6 +2413,22 @@ func memorizeContextHandler(contextService *services.ContextService) func(ctx co
 			"message":      "成功将内容存储到长期记忆",
 			"type":         metadata["type"],
 			"needUserInit": needUserInit,
+			"deduplicated": storeResponse.Deduplicated,
+			"priority":     storeResponse.Priority,
+		}
+		if storeResponse.Deduplicated {
+			response["message"] = "已存在近似重复的记忆，未重复写入"
+		}
+		if chunkCount, ok := storeResponse.Metadata["chunkCount"]; ok {
+			response["chunkCount"] = chunkCount
+			response["message"] = fmt.Sprintf("内容较长，已分%v块存储到长期记忆", chunkCount)
+		}
+		if len(storeResponse.EngineResults) > 0 {
+			response["engineResults"] = storeResponse.EngineResults
+			response["partialFailure"] = storeResponse.PartialFailure
+		}
+		if storeResponse.PartialFailure {
+			response["message"] = fmt.Sprintf("已存储到长期记忆，但部分存储引擎写入失败: %s，可稍后重试", strings.Join(storeResponse.FailedEngines(), ", "))
 		}
 
 		if userID != "" {
@@ -1603,9 +2445,12 @@ func memorizeContextHandler(contextService *services.ContextService) func(ctx co
 			errMsg := fmt.Sprintf("序列化响应失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("memorize_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
+		contextService.CompleteIdempotentRequest("memorize_context", idempotencyScope, idempotencyKey, response)
+		idempotencyCompleted = true
+
 		log.Printf("[记忆上下文] 成功存储记忆: memoryID=%s, 类型=%s", memoryID, metadata["type"])
 		logToolCall("memorize_context", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
 		return mcp.NewToolResultText(string(jsonData)), nil
@@ -1681,6 +2526,79 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getIntArgument 从工具调用参数中读取整数，兼容JSON数字和字符串形式
+func getIntArgument(arguments map[string]interface{}, key string, defaultValue int) int {
+	switch v := arguments[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		if intValue, err := strconv.Atoi(v); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+// getFloatArgument 从工具调用参数中读取浮点数，兼容JSON数字和字符串形式
+func getFloatArgument(arguments map[string]interface{}, key string, defaultValue float64) float64 {
+	switch v := arguments[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		if floatValue, err := strconv.ParseFloat(v, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getOptionalFloatArgument 从工具调用参数中读取浮点数，未传或无法解析时返回nil，用于区分未设置和显式传0
+func getOptionalFloatArgument(arguments map[string]interface{}, key string) *float64 {
+	if _, ok := arguments[key]; !ok {
+		return nil
+	}
+	value := getFloatArgument(arguments, key, math.NaN())
+	if math.IsNaN(value) {
+		return nil
+	}
+	return &value
+}
+
+// getStringSliceArgument 从工具调用参数中读取字符串列表，兼容数组和逗号分隔字符串
+func getStringSliceArgument(arguments map[string]interface{}, key string) []string {
+	var values []string
+	switch v := arguments[key].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok && strings.TrimSpace(str) != "" {
+				values = append(values, strings.TrimSpace(str))
+			}
+		}
+	case string:
+		for _, str := range strings.Split(v, ",") {
+			if strings.TrimSpace(str) != "" {
+				values = append(values, strings.TrimSpace(str))
+			}
+		}
+	}
+	return values
+}
+
+// getTimeArgument 从工具调用参数中读取时间，兼容时间字符串和Unix秒级时间戳，未提供时返回零值
+func getTimeArgument(arguments map[string]interface{}, key string) (time.Time, error) {
+	switch v := arguments[key].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), nil
+	case string:
+		return services.ParseTimelineQueryTime(v)
+	}
+	return time.Time{}, nil
+}
+
 func getFloatEnv(key string, defaultValue float64) float64 {
 	if value, exists := os.LookupEnv(key); exists {
 		if floatValue, err := TryParseFloat(value); err == nil {
@@ -1762,22 +2680,27 @@ func retrieveTodosHandler(contextService *services.ContextService) func(ctx cont
 			}
 		}
 
-		log.Printf("[检索待办] 执行检索: sessionID=%s, userID=%s, status=%s, limit=%d",
-			sessionID, userID, status, limit)
+		query, _ := request.Params.Arguments["query"].(string)
+
+		log.Printf("[检索待办] 执行检索: sessionID=%s, userID=%s, status=%s, query=%s, limit=%d",
+			sessionID, userID, status, query, limit)
 
 		// 调用服务执行检索
-		todosResp, err := contextService.RetrieveTodos(ctx, models.RetrieveTodosRequest{
+		todosReq := models.RetrieveTodosRequest{
 			SessionID: sessionID,
 			UserID:    userID,
 			Status:    status,
 			Limit:     limit,
-		})
+			Query:     query,
+		}
+		todosReq.IncludeArchived, _ = request.Params.Arguments["includeArchived"].(bool)
+		todosResp, err := contextService.RetrieveTodos(ctx, todosReq)
 
 		if err != nil {
 			errMsg := fmt.Sprintf("检索待办事项失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("retrieve_todos", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		// 构建自定义响应，包含needUserInit字段
@@ -1800,7 +2723,7 @@ func retrieveTodosHandler(contextService *services.ContextService) func(ctx cont
 			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
 			log.Println(errMsg)
 			logToolCall("retrieve_todos", request.Params.Arguments, errMsg, err, time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			return toolErrorResult(errMsg, err), nil
 		}
 
 		log.Printf("[检索待办] 检索成功: 找到%d个待办事项", len(todosResp.Items))
@@ -1809,190 +2732,1351 @@ func retrieveTodosHandler(contextService *services.ContextService) func(ctx cont
 	}
 }
 
-// userInitDialogHandler 处理用户初始化对话请求
-func userInitDialogHandler() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// updateTodoHandler 处理更新待办事项请求
+func updateTodoHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		startTime := time.Now()
 
-		// 详细日志：开始处理用户初始化对话
-		log.Printf("[用户初始化对话] 开始处理请求，参数: %+v", request.Params.Arguments)
-
 		// 验证参数
 		sessionID, ok := request.Params.Arguments["sessionId"].(string)
 		if !ok || sessionID == "" {
 			errMsg := "错误: sessionId必须是非空字符串"
 			log.Println(errMsg)
-			logToolCall("user_init_dialog", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			logToolCall("update_todo", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
 			return mcp.NewToolResultText(errMsg), nil
 		}
 
-		userResponse, _ := request.Params.Arguments["userResponse"].(string)
-		log.Printf("[用户初始化对话] 处理会话ID=%s, 用户响应=%q", sessionID, userResponse)
-
-		// 如果有用户响应，则处理响应
-		var state *utils.DialogState
-		var err error
-
-		// 使用defer捕获和记录任何可能的panic
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("[用户初始化对话] 发生panic: %v", r)
-				// 记录堆栈信息
-				buf := make([]byte, 4096)
-				n := runtime.Stack(buf, false)
-				log.Printf("[用户初始化对话] 堆栈: %s", buf[:n])
-			}
-		}()
-
-		// 首先检查会话状态是否已经存在
-		dialogExists := false
-		// 这里不直接访问dialogStates，而是通过尝试初始化来检查
-		tmpState, _ := utils.InitializeUserByDialog(sessionID)
-		if tmpState != nil {
-			dialogExists = true
-			log.Printf("[用户初始化对话] 检测到会话状态已存在: state=%s", tmpState.State)
+		memoryID, ok := request.Params.Arguments["memoryId"].(string)
+		if !ok || memoryID == "" {
+			errMsg := "错误: memoryId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("update_todo", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
 		}
 
-		if userResponse != "" {
-			log.Printf("[用户初始化对话] 处理用户响应: %q", userResponse)
+		status, _ := request.Params.Arguments["status"].(string)
+		if status != "pending" && status != "completed" {
+			errMsg := "错误: status必须是pending或completed"
+			log.Println(errMsg)
+			logToolCall("update_todo", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
 
-			// 如果有响应但没有会话状态，可能是第一次调用，先确保初始化
-			if !dialogExists {
-				log.Printf("[用户初始化对话] 警告: 收到用户响应但会话状态不存在，先初始化状态")
-				tmpState, err = utils.InitializeUserByDialog(sessionID)
-				if err != nil {
-					log.Printf("[用户初始化对话] 初始化对话状态失败: %v", err)
-					logToolCall("user_init_dialog", request.Params.Arguments, err.Error(), err, time.Since(startTime))
-					return mcp.NewToolResultText(fmt.Sprintf("处理用户配置对话出错: 无法初始化会话状态: %v", err)), nil
-				}
-			}
+		priority, _ := request.Params.Arguments["priority"].(string)
+		completedAt := getIntArgument(request.Params.Arguments, "completedAt", 0)
 
-			// 添加详细的错误处理
-			state, err = utils.HandleUserDialogResponse(sessionID, userResponse)
-			if err != nil {
-				log.Printf("[用户初始化对话] 处理用户响应失败: %v", err)
-			}
-		} else {
-			log.Printf("[用户初始化对话] 初始化或获取当前对话状态")
-			// 初始化或获取当前对话状态
-			state, err = utils.InitializeUserByDialog(sessionID)
+		// 获取用户ID
+		userID, _ := request.Params.Arguments["userId"].(string)
+		if userID == "" {
+			var err error
+			userID, _, err = utils.GetUserID()
 			if err != nil {
-				log.Printf("[用户初始化对话] 初始化对话状态失败: %v", err)
+				log.Printf("[更新待办] 获取用户ID失败: %v", err)
 			}
 		}
 
+		log.Printf("[更新待办] 执行更新: sessionID=%s, userID=%s, memoryID=%s, status=%s, priority=%s",
+			sessionID, userID, memoryID, status, priority)
+
+		todoItem, err := contextService.UpdateTodo(ctx, models.UpdateTodoRequest{
+			SessionID:   sessionID,
+			UserID:      userID,
+			MemoryID:    memoryID,
+			Status:      status,
+			Priority:    priority,
+			CompletedAt: int64(completedAt),
+		})
 		if err != nil {
-			log.Printf("[用户初始化对话] 错误: %v", err)
-			logToolCall("user_init_dialog", request.Params.Arguments, err.Error(), err, time.Since(startTime))
-			return mcp.NewToolResultText(fmt.Sprintf("处理用户配置对话出错: %v", err)), nil
+			errMsg := fmt.Sprintf("更新待办事项失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("update_todo", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
 		}
 
-		log.Printf("[用户初始化对话] 获取到对话状态: state=%s, userID=%s", state.State, state.UserID)
-
-		// 如果用户配置完成，更新全局缓存
-		if state.State == utils.DialogStateCompleted && state.UserID != "" {
-			log.Printf("[用户初始化对话] 用户配置完成，确保全局缓存已更新，UserID: %s", state.UserID)
-			// 确保用户ID被缓存
-			utils.SetCachedUserID(state.UserID)
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(todoItem)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("update_todo", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
 		}
 
-		// 构建响应
-		result := map[string]interface{}{
-			"state": state.State,
+		logToolCall("update_todo", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// exportSessionHandler 处理会话导出请求
+func exportSessionHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("export_session", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
 		}
 
-		// 根据状态添加相应字段
-		switch state.State {
-		case utils.DialogStateNewUser:
-			result["userId"] = state.UserID
-			result["message"] = "已为您创建新用户账号"
-			result["welcomeMessage"] = "欢迎使用上下文记忆管理工具！您的数据将与您的用户ID关联。请妥善保管您的用户ID，当您在其他设备使用时需要输入它。"
-			log.Printf("[用户初始化对话] 新用户状态: userID=%s", state.UserID)
-		case utils.DialogStateExisting:
-			result["message"] = "请输入您的用户ID以继续"
-			result["prompt"] = "用户ID格式为'user_'开头加8位字母数字，您可以直接粘贴完整ID"
-			result["helpText"] = "如果您没有用户ID或想创建新账号，请回复'创建新账号'。如需重置流程，请回复'重置'"
-			log.Printf("[用户初始化对话] 已有用户状态，等待输入用户ID")
-		case utils.DialogStateCompleted:
-			result["userId"] = state.UserID
-			result["message"] = "用户配置已完成"
-			result["isFirstTime"] = (userResponse != "") // 标记是否是首次配置完成
-			log.Printf("[用户初始化对话] 配置完成状态: userID=%s, isFirstTime=%v", state.UserID, userResponse != "")
-		default:
-			result["message"] = "欢迎使用上下文记忆管理工具。为了在多设备间同步您的数据，我们需要创建一个用户ID。请问您是否已在其他设备上使用过该工具？"
-			result["prompt"] = "回答'是'或'否'"
-			result["helpText"] = "如果您以前使用过，我们将引导您输入用户ID；如果没有，我们将为您创建新账号"
-			log.Printf("[用户初始化对话] 初始询问状态")
+		// 获取用户ID
+		userID, _ := request.Params.Arguments["userId"].(string)
+		if userID == "" {
+			var err error
+			userID, _, err = utils.GetUserID()
+			if err != nil {
+				log.Printf("[导出会话] 获取用户ID失败: %v", err)
+			}
 		}
 
-		// 记录要返回的结果对象
-		log.Printf("[用户初始化对话] 准备返回结果: %+v", result)
+		log.Printf("[导出会话] 执行导出: sessionID=%s, userID=%s", sessionID, userID)
 
-		// 记录工具调用日志
-		logToolCall("user_init_dialog", request.Params.Arguments, result, nil, time.Since(startTime))
+		export, err := contextService.ExportSession(ctx, userID, sessionID)
+		if err != nil {
+			errMsg := fmt.Sprintf("导出会话失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("export_session", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
 
-		// 序列化JSON结果，但不要在外层再包装成字符串
-		jsonData, err := json.Marshal(result)
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(export)
 		if err != nil {
-			log.Printf("[用户初始化对话] 错误: 无法序列化结果: %v", err)
-			return mcp.NewToolResultText(fmt.Sprintf("处理用户配置对话出错: %v", err)), nil
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("export_session", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
 		}
 
-		// 使用原始JSON字符串返回，不要添加额外的引号
-		log.Printf("[用户初始化对话] 完成处理，耗时: %v", time.Since(startTime))
+		logToolCall("export_session", request.Params.Arguments, fmt.Sprintf("导出%d字节", len(jsonData)), nil, time.Since(startTime))
 		return mcp.NewToolResultText(string(jsonData)), nil
 	}
 }
 
-// getContextHandler 处理获取上下文请求（新的统一接口）
-func getContextHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// importSessionHandler 处理会话导入请求
+func importSessionHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		startTime := time.Now()
 
-		// 验证必需参数
+		// 验证参数
 		sessionID, ok := request.Params.Arguments["sessionId"].(string)
 		if !ok || sessionID == "" {
 			errMsg := "错误: sessionId必须是非空字符串"
 			log.Println(errMsg)
-			logToolCall("get_context", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			logToolCall("import_session", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
 			return mcp.NewToolResultText(errMsg), nil
 		}
 
-		contextType, ok := request.Params.Arguments["contextType"].(string)
-		if !ok || contextType == "" {
-			errMsg := "错误: contextType必须是非空字符串"
+		export, err := services.ParseSessionExport(request.Params.Arguments["data"])
+		if err != nil {
+			errMsg := fmt.Sprintf("错误: %v", err)
 			log.Println(errMsg)
-			logToolCall("get_context", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
-			return mcp.NewToolResultText(errMsg), nil
+			logToolCall("import_session", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
 		}
 
-		// 处理可选参数
-		var summaryLevel string
-		if summaryVal, ok := request.Params.Arguments["summaryLevel"]; ok && summaryVal != nil {
-			summaryLevel, _ = summaryVal.(string)
+		targetSessionID, _ := request.Params.Arguments["targetSessionId"].(string)
+		force, _ := request.Params.Arguments["force"].(bool)
+
+		// 获取用户ID
+		userID, _ := request.Params.Arguments["userId"].(string)
+		if userID == "" {
+			userID, _, err = utils.GetUserID()
+			if err != nil {
+				log.Printf("[导入会话] 获取用户ID失败: %v", err)
+			}
 		}
-		if summaryLevel == "" {
-			summaryLevel = "summary" // 默认值
+
+		log.Printf("[导入会话] 执行导入: sessionID=%s, userID=%s, targetSessionID=%s, force=%v",
+			sessionID, userID, targetSessionID, force)
+
+		result, err := contextService.ImportSession(ctx, models.ImportSessionRequest{
+			UserID:          userID,
+			Data:            export,
+			TargetSessionID: targetSessionID,
+			Force:           force,
+		})
+		if err != nil {
+			errMsg := fmt.Sprintf("导入会话失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("import_session", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
 		}
 
-		var timeRange string
-		if timeVal, ok := request.Params.Arguments["timeRange"]; ok && timeVal != nil {
-			timeRange, _ = timeVal.(string)
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("import_session", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
 		}
 
-		log.Printf("获取上下文: sessionID=%s, contextType=%s, summaryLevel=%s, timeRange=%s",
-			sessionID, contextType, summaryLevel, timeRange)
+		logToolCall("import_session", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
 
-		// 根据contextType调用不同的获取方法
-		switch contextType {
-		case "all", "code":
-			// 获取编程上下文（保持向后兼容）
-			result, err := contextService.GetProgrammingContext(ctx, sessionID, "")
+// mergeSessionsHandler 处理会话合并请求
+func mergeSessionsHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		targetSessionID, ok := request.Params.Arguments["targetSessionId"].(string)
+		if !ok || targetSessionID == "" {
+			errMsg := "错误: targetSessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("merge_sessions", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+		sourceSessionID, ok := request.Params.Arguments["sourceSessionId"].(string)
+		if !ok || sourceSessionID == "" {
+			errMsg := "错误: sourceSessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("merge_sessions", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		// 获取用户ID
+		userID, _ := request.Params.Arguments["userId"].(string)
+		if userID == "" {
+			var err error
+			userID, _, err = utils.GetUserID()
+			if err != nil {
+				log.Printf("[合并会话] 获取用户ID失败: %v", err)
+			}
+		}
+
+		log.Printf("[合并会话] 执行合并: %s -> %s, userID=%s", sourceSessionID, targetSessionID, userID)
+
+		result, err := contextService.MergeSessions(ctx, models.MergeSessionsRequest{
+			UserID:          userID,
+			TargetSessionID: targetSessionID,
+			SourceSessionID: sourceSessionID,
+		})
+		if err != nil {
+			errMsg := fmt.Sprintf("合并会话失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("merge_sessions", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("merge_sessions", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("merge_sessions", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// linkSessionsHandler 处理会话关联请求
+func linkSessionsHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sourceSessionID, ok := request.Params.Arguments["sourceSessionId"].(string)
+		if !ok || sourceSessionID == "" {
+			errMsg := "错误: sourceSessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("link_sessions", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+		targetSessionID, ok := request.Params.Arguments["targetSessionId"].(string)
+		if !ok || targetSessionID == "" {
+			errMsg := "错误: targetSessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("link_sessions", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+		relationship, _ := request.Params.Arguments["relationship"].(string)
+		description, _ := request.Params.Arguments["description"].(string)
+
+		// 获取用户ID
+		userID, _ := request.Params.Arguments["userId"].(string)
+		if userID == "" {
+			var err error
+			userID, _, err = utils.GetUserID()
+			if err != nil {
+				log.Printf("[关联会话] 获取用户ID失败: %v", err)
+			}
+		}
+
+		result, err := contextService.LinkSessions(models.LinkSessionsRequest{
+			UserID:          userID,
+			SourceSessionID: sourceSessionID,
+			TargetSessionID: targetSessionID,
+			Relationship:    relationship,
+			Description:     description,
+			Topics:          getStringSliceArgument(request.Params.Arguments, "topics"),
+		})
+		if err != nil {
+			errMsg := fmt.Sprintf("关联会话失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("link_sessions", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("link_sessions", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("link_sessions", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// getPendingInstructionsHandler 处理未确认本地指令查询请求
+func getPendingInstructionsHandler() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("get_pending_instructions", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		// 获取用户ID
+		userID, _ := request.Params.Arguments["userId"].(string)
+		if userID == "" {
+			var err error
+			userID, _, err = utils.GetUserID()
+			if err != nil {
+				log.Printf("[未确认指令] 获取用户ID失败: %v", err)
+			}
+		}
+
+		instructions := []models.PendingInstruction{}
+		if services.GlobalWSManager != nil && userID != "" {
+			instructions = services.GlobalWSManager.GetPendingInstructions(userID)
+		}
+
+		jsonData, err := json.Marshal(map[string]interface{}{
+			"success":      true,
+			"userId":       userID,
+			"instructions": instructions,
+			"queueDepth":   len(instructions),
+		})
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("get_pending_instructions", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("get_pending_instructions", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// queryTimelineHandler 处理时间线查询请求
+func queryTimelineHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("query_timeline", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		from, err := getTimeArgument(request.Params.Arguments, "from")
+		if err != nil {
+			errMsg := fmt.Sprintf("错误: from参数无效: %v", err)
+			log.Println(errMsg)
+			logToolCall("query_timeline", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+		to, err := getTimeArgument(request.Params.Arguments, "to")
+		if err != nil {
+			errMsg := fmt.Sprintf("错误: to参数无效: %v", err)
+			log.Println(errMsg)
+			logToolCall("query_timeline", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		eventTypes := getStringSliceArgument(request.Params.Arguments, "eventTypes")
+		workspaceID, _ := request.Params.Arguments["workspaceId"].(string)
+		limit := getIntArgument(request.Params.Arguments, "limit", 0)
+
+		// 获取用户ID
+		userID, _ := request.Params.Arguments["userId"].(string)
+		if userID == "" {
+			userID, _, err = utils.GetUserID()
+			if err != nil || userID == "" {
+				errMsg := "错误: 未能获取有效用户ID，无法查询时间线"
+				log.Println(errMsg)
+				logToolCall("query_timeline", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+				return mcp.NewToolResultText(errMsg), nil
+			}
+		}
+
+		log.Printf("[时间线查询] 执行查询: sessionID=%s, userID=%s, workspaceID=%s, eventTypes=%v, limit=%d",
+			sessionID, userID, workspaceID, eventTypes, limit)
+
+		timelineResp, err := contextService.QueryTimeline(ctx, userID, workspaceID, from, to, eventTypes, limit)
+		if err != nil {
+			errMsg := fmt.Sprintf("查询时间线失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("query_timeline", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(timelineResp)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("query_timeline", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("query_timeline", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// queryKnowledgeGraphHandler 处理知识图谱查询请求
+func queryKnowledgeGraphHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("query_knowledge_graph", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		entityName, ok := request.Params.Arguments["entityName"].(string)
+		if !ok || entityName == "" {
+			errMsg := "错误: entityName必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("query_knowledge_graph", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		maxDepth := getIntArgument(request.Params.Arguments, "maxDepth", 0)
+
+		// 获取用户ID
+		userID, _ := request.Params.Arguments["userId"].(string)
+		if userID == "" {
+			var err error
+			userID, _, err = utils.GetUserID()
+			if err != nil || userID == "" {
+				errMsg := "错误: 未能获取有效用户ID，无法查询知识图谱"
+				log.Println(errMsg)
+				logToolCall("query_knowledge_graph", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+				return mcp.NewToolResultText(errMsg), nil
+			}
+		}
+
+		log.Printf("[知识图谱查询] 执行查询: sessionID=%s, userID=%s, entityName=%s, maxDepth=%d",
+			sessionID, userID, entityName, maxDepth)
+
+		graphResp, err := contextService.QueryKnowledgeGraph(ctx, userID, entityName, maxDepth)
+		if err != nil {
+			errMsg := fmt.Sprintf("查询知识图谱失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("query_knowledge_graph", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(graphResp)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("query_knowledge_graph", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("query_knowledge_graph", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// listMemoriesHandler 处理列出记忆请求
+func listMemoriesHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("list_memories", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		listReq := models.ListMemoriesRequest{SessionID: sessionID}
+		listReq.Type, _ = request.Params.Arguments["type"].(string)
+		listReq.Priority, _ = request.Params.Arguments["priority"].(string)
+		listReq.SortBy, _ = request.Params.Arguments["sortBy"].(string)
+		listReq.IncludeArchived, _ = request.Params.Arguments["includeArchived"].(bool)
+		if limit, ok := request.Params.Arguments["limit"].(float64); ok {
+			listReq.Limit = int(limit)
+		}
+		if offset, ok := request.Params.Arguments["offset"].(float64); ok {
+			listReq.Offset = int(offset)
+		}
+
+		listResp, err := contextService.ListMemories(ctx, listReq)
+		if err != nil {
+			errMsg := fmt.Sprintf("列出记忆失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("list_memories", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(listResp)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("list_memories", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("list_memories", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// sessionStatsHandler 处理会话统计请求
+func sessionStatsHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("session_stats", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		stats, err := contextService.GetSessionStats(ctx, sessionID)
+		if err != nil {
+			errMsg := fmt.Sprintf("获取会话统计失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("session_stats", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(stats)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("session_stats", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("session_stats", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// getConversationHandler 处理获取完整对话记录请求
+func getConversationHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("get_conversation", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+		batchID, _ := request.Params.Arguments["batchId"].(string)
+		includeArchived, _ := request.Params.Arguments["includeArchived"].(bool)
+
+		transcript, err := contextService.GetConversation(ctx, models.GetConversationRequest{SessionID: sessionID, BatchID: batchID, IncludeArchived: includeArchived})
+		if err != nil {
+			errMsg := fmt.Sprintf("获取对话记录失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("get_conversation", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		jsonData, err := json.Marshal(transcript)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("get_conversation", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("get_conversation", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// listWorkspacesHandler 处理列出用户工作空间请求
+func listWorkspacesHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		userID, ok := request.Params.Arguments["userId"].(string)
+		if !ok || userID == "" {
+			errMsg := "错误: userId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("list_workspaces", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+		if !models.IsValidUserID(userID) {
+			errMsg := fmt.Sprintf("用户ID格式非法: %q（应为user_加字母、数字或下划线）", userID)
+			logToolCall("list_workspaces", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		workspaces, err := contextService.ListWorkspaces(userID)
+		if err != nil {
+			errMsg := fmt.Sprintf("获取工作空间列表失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("list_workspaces", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		jsonData, err := json.Marshal(map[string]interface{}{"userId": userID, "workspaces": workspaces})
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("list_workspaces", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("list_workspaces", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// getStoreStatusHandler 处理查询异步存储状态请求
+func getStoreStatusHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("get_store_status", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+		jobID, ok := request.Params.Arguments["jobId"].(string)
+		if !ok || jobID == "" {
+			errMsg := "错误: jobId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("get_store_status", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		job, err := contextService.GetStoreJob(sessionID, jobID)
+		if err != nil {
+			errMsg := fmt.Sprintf("查询存储任务失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("get_store_status", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(job)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("get_store_status", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("get_store_status", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// deleteMemoryHandler 处理删除记忆请求
+func deleteMemoryHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("delete_memory", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		memoryID, _ := request.Params.Arguments["memoryId"].(string)
+		batchID, _ := request.Params.Arguments["batchId"].(string)
+		if memoryID == "" && batchID == "" {
+			errMsg := "错误: 必须提供memoryId或batchId"
+			log.Println(errMsg)
+			logToolCall("delete_memory", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		log.Printf("[删除记忆] 执行删除: sessionID=%s, memoryID=%s, batchID=%s", sessionID, memoryID, batchID)
+
+		deleteResp, err := contextService.DeleteMemory(ctx, models.DeleteMemoryRequest{
+			SessionID: sessionID,
+			MemoryID:  memoryID,
+			BatchID:   batchID,
+		})
+		if err != nil {
+			errMsg := fmt.Sprintf("删除记忆失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("delete_memory", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(deleteResp)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("delete_memory", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("delete_memory", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// getEntityHandler 处理实体画像请求
+func getEntityHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("get_entity", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		entityName, ok := request.Params.Arguments["entityName"].(string)
+		if !ok || entityName == "" {
+			errMsg := "错误: entityName必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("get_entity", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		entityReq := models.GetEntityRequest{
+			SessionID:   sessionID,
+			EntityName:  entityName,
+			MemoryLimit: getIntArgument(request.Params.Arguments, "memoryLimit", 0),
+		}
+
+		log.Printf("[实体画像] sessionID=%s, entityName=%s, memoryLimit=%d", sessionID, entityName, entityReq.MemoryLimit)
+
+		profile, err := contextService.GetEntityProfile(ctx, entityReq)
+		if err != nil {
+			errMsg := fmt.Sprintf("获取实体画像失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("get_entity", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(profile)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("get_entity", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("get_entity", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// deleteMemoriesByFilterHandler 处理按条件批量删除记忆请求
+func deleteMemoriesByFilterHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("delete_memories_by_filter", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		deleteReq := models.DeleteMemoriesByFilterRequest{
+			SessionID: sessionID,
+			StartTime: int64(getIntArgument(request.Params.Arguments, "startTime", 0)),
+			EndTime:   int64(getIntArgument(request.Params.Arguments, "endTime", 0)),
+		}
+		deleteReq.FilterSessionID, _ = request.Params.Arguments["filterSessionId"].(string)
+		deleteReq.Type, _ = request.Params.Arguments["type"].(string)
+		deleteReq.Priority, _ = request.Params.Arguments["priority"].(string)
+		deleteReq.Confirm, _ = request.Params.Arguments["confirm"].(bool)
+		deleteReq.AllowAll, _ = request.Params.Arguments["allowAll"].(bool)
+
+		log.Printf("[批量删除] sessionID=%s, filterSessionId=%s, type=%s, priority=%s, confirm=%v",
+			sessionID, deleteReq.FilterSessionID, deleteReq.Type, deleteReq.Priority, deleteReq.Confirm)
+
+		deleteResp, err := contextService.DeleteMemoriesByFilter(ctx, deleteReq)
+		if err != nil {
+			errMsg := fmt.Sprintf("批量删除记忆失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("delete_memories_by_filter", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(deleteResp)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("delete_memories_by_filter", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("delete_memories_by_filter", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// archiveMemoryHandler 处理归档(archived=true)或恢复(archived=false)记忆请求
+func archiveMemoryHandler(contextService *services.ContextService, toolName string, archived bool) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall(toolName, request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		memoryID, ok := request.Params.Arguments["memoryId"].(string)
+		if !ok || memoryID == "" {
+			errMsg := "错误: memoryId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall(toolName, request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		log.Printf("[记忆归档] 执行%s: sessionID=%s, memoryID=%s", toolName, sessionID, memoryID)
+
+		archiveReq := models.ArchiveMemoryRequest{SessionID: sessionID, MemoryID: memoryID}
+		var archiveResp *models.ArchiveMemoryResponse
+		var err error
+		if archived {
+			archiveResp, err = contextService.ArchiveMemory(ctx, archiveReq)
+		} else {
+			archiveResp, err = contextService.RestoreMemory(ctx, archiveReq)
+		}
+		if err != nil {
+			errMsg := fmt.Sprintf("更新记忆归档状态失败: %v", err)
+			log.Println(errMsg)
+			logToolCall(toolName, request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(archiveResp)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall(toolName, request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall(toolName, request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// updateMemoryHandler 处理更新记忆请求
+func updateMemoryHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("update_memory", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		memoryID, ok := request.Params.Arguments["memoryId"].(string)
+		if !ok || memoryID == "" {
+			errMsg := "错误: memoryId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("update_memory", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		content, _ := request.Params.Arguments["content"].(string)
+		metadata, _ := request.Params.Arguments["metadata"].(map[string]interface{})
+		if content == "" && len(metadata) == 0 {
+			errMsg := "错误: 必须提供content或metadata"
+			log.Println(errMsg)
+			logToolCall("update_memory", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		log.Printf("[更新记忆] 执行更新: sessionID=%s, memoryID=%s, 内容长度=%d, metadata字段=%d",
+			sessionID, memoryID, len(content), len(metadata))
+
+		updateResp, err := contextService.UpdateMemory(ctx, models.UpdateMemoryRequest{
+			SessionID: sessionID,
+			MemoryID:  memoryID,
+			Content:   content,
+			Metadata:  metadata,
+		})
+		if err != nil {
+			errMsg := fmt.Sprintf("更新记忆失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("update_memory", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(updateResp)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("update_memory", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("update_memory", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// reanalyzeMemoryHandler 处理重新分析记忆请求
+func reanalyzeMemoryHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("reanalyze_memory", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		memoryID, ok := request.Params.Arguments["memoryId"].(string)
+		if !ok || memoryID == "" {
+			errMsg := "错误: memoryId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("reanalyze_memory", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		log.Printf("[重新分析] 执行重新分析: sessionID=%s, memoryID=%s", sessionID, memoryID)
+
+		reanalyzeResp, err := contextService.ReanalyzeMemory(ctx, models.ReanalyzeMemoryRequest{
+			SessionID: sessionID,
+			MemoryID:  memoryID,
+		})
+		if err != nil {
+			errMsg := fmt.Sprintf("重新分析记忆失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("reanalyze_memory", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(reanalyzeResp)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("reanalyze_memory", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("reanalyze_memory", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// queryByMetadataHandler 处理按metadata键值查询记忆请求
+func queryByMetadataHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("query_by_metadata", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		queryReq := models.QueryByMetadataRequest{
+			SessionID: sessionID,
+			Exists:    getStringSliceArgument(request.Params.Arguments, "exists"),
+		}
+		queryReq.Metadata, _ = request.Params.Arguments["metadata"].(map[string]interface{})
+		if len(queryReq.Metadata) == 0 && len(queryReq.Exists) == 0 {
+			errMsg := "错误: 必须提供metadata或exists"
+			log.Println(errMsg)
+			logToolCall("query_by_metadata", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+		if limit, ok := request.Params.Arguments["limit"].(float64); ok {
+			queryReq.Limit = int(limit)
+		}
+		queryReq.IncludeArchived, _ = request.Params.Arguments["includeArchived"].(bool)
+
+		log.Printf("[metadata查询] 执行查询: sessionID=%s, metadata=%v, exists=%v, limit=%d",
+			sessionID, queryReq.Metadata, queryReq.Exists, queryReq.Limit)
+
+		queryResp, err := contextService.QueryByMetadata(ctx, queryReq)
+		if err != nil {
+			errMsg := fmt.Sprintf("按metadata查询记忆失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("query_by_metadata", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		// 转换为JSON字符串响应
+		jsonData, err := json.Marshal(queryResp)
+		if err != nil {
+			errMsg := fmt.Sprintf("序列化结果失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("query_by_metadata", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		logToolCall("query_by_metadata", request.Params.Arguments, string(jsonData), nil, time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// batchStoreConversationHandler 处理批量存储对话请求
+func batchStoreConversationHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("batch_store_conversation", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		batchesRaw, ok := request.Params.Arguments["batches"].([]interface{})
+		if !ok || len(batchesRaw) == 0 {
+			errMsg := "错误: batches必须是非空数组"
+			log.Println(errMsg)
+			logToolCall("batch_store_conversation", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		// 通过JSON转换为批次结构
+		var batches []models.ConversationBatch
+		batchesJSON, _ := json.Marshal(batchesRaw)
+		if err := json.Unmarshal(batchesJSON, &batches); err != nil {
+			errMsg := fmt.Sprintf("错误: batches格式无效: %v", err)
+			log.Println(errMsg)
+			logToolCall("batch_store_conversation", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		userID, _, _ := utils.GetUserID()
+
+		log.Printf("批量存储对话: sessionID=%s, 批次数量=%d", sessionID, len(batches))
+
+		resp, err := contextService.BatchStoreConversation(ctx, models.BatchStoreConversationRequest{
+			SessionID: sessionID,
+			UserID:    userID,
+			Batches:   batches,
+		})
+		if err != nil {
+			errMsg := fmt.Sprintf("批量存储对话失败: %v", err)
+			log.Println(errMsg)
+			logToolCall("batch_store_conversation", request.Params.Arguments, errMsg, err, time.Since(startTime))
+			return toolErrorResult(errMsg, err), nil
+		}
+
+		result := map[string]interface{}{
+			"committed": resp.Committed,
+			"batches":   resp.Batches,
+		}
+		if resp.Error != "" {
+			result["error"] = resp.Error
+		}
+
+		// 只有整体提交成功后，才按批次推送本地指令
+		if resp.Committed && userID != "" {
+			var localInstructions []map[string]interface{}
+			for _, batch := range resp.Batches {
+				content := make([]map[string]interface{}, 0, len(batch.Messages))
+				for _, msg := range batch.Messages {
+					content = append(content, map[string]interface{}{
+						"role":        msg.Role,
+						"content":     msg.Content,
+						"contentType": msg.ContentType,
+						"priority":    msg.Priority,
+						"metadata":    msg.Metadata,
+					})
+				}
+				localInstructions = append(localInstructions, pushShortMemoryInstruction(sessionID, userID, content))
+			}
+			result["localInstructions"] = localInstructions
+		}
+
+		jsonData, _ := json.Marshal(result)
+		responseStr := string(jsonData)
+		logToolCall("batch_store_conversation", request.Params.Arguments, responseStr, nil, time.Since(startTime))
+		return mcp.NewToolResultText(responseStr), nil
+	}
+}
+
+// pushShortMemoryInstruction 构建短期记忆本地指令并通过WebSocket推送，返回指令内容用于响应
+func pushShortMemoryInstruction(sessionID, userID string, content interface{}) map[string]interface{} {
+	// 构建本地指令
+	localInstruction := map[string]interface{}{
+		"type":    "short_memory",
+		"target":  fmt.Sprintf("~/Library/Application Support/context-keeper/users/%s/histories/%s.json", userID, sessionID),
+		"content": content,
+		"options": map[string]interface{}{
+			"createDir":  true,
+			"merge":      true,
+			"maxAge":     604800, // 7天
+			"cleanupOld": true,
+		},
+		"callbackId": fmt.Sprintf("short_memory_%s_%d", sessionID, time.Now().UnixNano()),
+		"priority":   "normal",
+	}
+
+	log.Printf("[WebSocket] 准备推送本地指令到用户: %s", userID)
+
+	// 尝试通过WebSocket推送指令
+	if services.GlobalWSManager != nil {
+		instruction := models.LocalInstruction{
+			Type:    models.LocalInstructionType(localInstruction["type"].(string)),
+			Target:  localInstruction["target"].(string),
+			Content: localInstruction["content"],
+			Options: models.LocalOperationOptions{
+				CreateDir:  true,
+				Merge:      true,
+				MaxAge:     604800,
+				CleanupOld: true,
+			},
+			CallbackID: localInstruction["callbackId"].(string),
+			Priority:   localInstruction["priority"].(string),
+		}
+
+		// 优先按会话精确推送，未确认的指令在客户端重连后重新推送
+		if services.GlobalWSManager.DeliverInstruction(sessionID, userID, instruction) {
+			log.Printf("[WebSocket] 本地指令已推送: %s", instruction.CallbackID)
+		} else {
+			log.Printf("[WebSocket] 推送指令失败，用户可能未连接WebSocket，指令已保留待重连后推送: %s", instruction.CallbackID)
+		}
+	}
+
+	return localInstruction
+}
+
+// userInitDialogHandler 处理用户初始化对话请求
+func userInitDialogHandler() func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 详细日志：开始处理用户初始化对话
+		log.Printf("[用户初始化对话] 开始处理请求，参数: %+v", request.Params.Arguments)
+
+		// 验证参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("user_init_dialog", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		userResponse, _ := request.Params.Arguments["userResponse"].(string)
+		log.Printf("[用户初始化对话] 处理会话ID=%s, 用户响应=%q", sessionID, userResponse)
+
+		// 如果有用户响应，则处理响应
+		var state *utils.DialogState
+		var err error
+
+		// 使用defer捕获和记录任何可能的panic
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("[用户初始化对话] 发生panic: %v", r)
+				// 记录堆栈信息
+				buf := make([]byte, 4096)
+				n := runtime.Stack(buf, false)
+				log.Printf("[用户初始化对话] 堆栈: %s", buf[:n])
+			}
+		}()
+
+		// 初始化和处理响应在同一会话锁内完成，同一会话的并发请求不会基于过期状态推进对话
+		if userResponse != "" {
+			log.Printf("[用户初始化对话] 处理用户响应: %q", userResponse)
+		} else {
+			log.Printf("[用户初始化对话] 初始化或获取当前对话状态")
+		}
+		state, err = utils.ProcessUserDialog(sessionID, userResponse)
+
+		if err != nil {
+			log.Printf("[用户初始化对话] 错误: %v", err)
+			logToolCall("user_init_dialog", request.Params.Arguments, err.Error(), err, time.Since(startTime))
+			return mcp.NewToolResultText(fmt.Sprintf("处理用户配置对话出错: %v", err)), nil
+		}
+
+		log.Printf("[用户初始化对话] 获取到对话状态: state=%s, userID=%s", state.State, state.UserID)
+
+		// 如果用户配置完成，更新全局缓存
+		if state.State == utils.DialogStateCompleted && state.UserID != "" {
+			log.Printf("[用户初始化对话] 用户配置完成，确保全局缓存已更新，UserID: %s", state.UserID)
+			// 确保用户ID被缓存
+			utils.SetCachedUserID(state.UserID)
+		}
+
+		// 构建响应
+		result := map[string]interface{}{
+			"state": state.State,
+		}
+
+		// 根据状态添加相应字段
+		switch state.State {
+		case utils.DialogStateNewUser:
+			result["userId"] = state.UserID
+			result["message"] = "已为您创建新用户账号"
+			result["welcomeMessage"] = "欢迎使用上下文记忆管理工具！您的数据将与您的用户ID关联。请妥善保管您的用户ID，当您在其他设备使用时需要输入它。"
+			log.Printf("[用户初始化对话] 新用户状态: userID=%s", state.UserID)
+		case utils.DialogStateExisting:
+			result["message"] = "请输入您的用户ID以继续"
+			result["prompt"] = "用户ID格式为'user_'开头加8位字母数字，您可以直接粘贴完整ID"
+			result["helpText"] = "如果您没有用户ID或想创建新账号，请回复'创建新账号'。如需重置流程，请回复'重置'"
+			log.Printf("[用户初始化对话] 已有用户状态，等待输入用户ID")
+		case utils.DialogStateCompleted:
+			result["userId"] = state.UserID
+			result["message"] = "用户配置已完成"
+			result["isFirstTime"] = (userResponse != "") // 标记是否是首次配置完成
+			log.Printf("[用户初始化对话] 配置完成状态: userID=%s, isFirstTime=%v", state.UserID, userResponse != "")
+		default:
+			result["message"] = "欢迎使用上下文记忆管理工具。为了在多设备间同步您的数据，我们需要创建一个用户ID。请问您是否已在其他设备上使用过该工具？"
+			result["prompt"] = "回答'是'或'否'"
+			result["helpText"] = "如果您以前使用过，我们将引导您输入用户ID；如果没有，我们将为您创建新账号"
+			log.Printf("[用户初始化对话] 初始询问状态")
+		}
+
+		// 记录要返回的结果对象
+		log.Printf("[用户初始化对话] 准备返回结果: %+v", result)
+
+		// 记录工具调用日志
+		logToolCall("user_init_dialog", request.Params.Arguments, result, nil, time.Since(startTime))
+
+		// 序列化JSON结果，但不要在外层再包装成字符串
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			log.Printf("[用户初始化对话] 错误: 无法序列化结果: %v", err)
+			return mcp.NewToolResultText(fmt.Sprintf("处理用户配置对话出错: %v", err)), nil
+		}
+
+		// 使用原始JSON字符串返回，不要添加额外的引号
+		log.Printf("[用户初始化对话] 完成处理，耗时: %v", time.Since(startTime))
+		return mcp.NewToolResultText(string(jsonData)), nil
+	}
+}
+
+// getContextHandler 处理获取上下文请求（新的统一接口）
+func getContextHandler(contextService *services.ContextService) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+
+		// 验证必需参数
+		sessionID, ok := request.Params.Arguments["sessionId"].(string)
+		if !ok || sessionID == "" {
+			errMsg := "错误: sessionId必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("get_context", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		contextType, ok := request.Params.Arguments["contextType"].(string)
+		if !ok || contextType == "" {
+			errMsg := "错误: contextType必须是非空字符串"
+			log.Println(errMsg)
+			logToolCall("get_context", request.Params.Arguments, errMsg, fmt.Errorf(errMsg), time.Since(startTime))
+			return mcp.NewToolResultText(errMsg), nil
+		}
+
+		// 处理可选参数
+		var summaryLevel string
+		if summaryVal, ok := request.Params.Arguments["summaryLevel"]; ok && summaryVal != nil {
+			summaryLevel, _ = summaryVal.(string)
+		}
+		if summaryLevel == "" {
+			summaryLevel = "summary" // 默认值
+		}
+
+		var timeRange string
+		if timeVal, ok := request.Params.Arguments["timeRange"]; ok && timeVal != nil {
+			timeRange, _ = timeVal.(string)
+		}
+
+		log.Printf("获取上下文: sessionID=%s, contextType=%s, summaryLevel=%s, timeRange=%s",
+			sessionID, contextType, summaryLevel, timeRange)
+
+		// 根据contextType调用不同的获取方法
+		switch contextType {
+		case "all", "code":
+			// 获取编程上下文（保持向后兼容）
+			result, err := contextService.GetProgrammingContext(ctx, sessionID, "")
 			if err != nil {
 				errMsg := fmt.Sprintf("获取编程上下文失败: %v", err)
 				log.Println(errMsg)
 				logToolCall("get_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
-				return mcp.NewToolResultText(errMsg), nil
+				return toolErrorResult(errMsg, err), nil
 			}
 
 			// 根据summaryLevel调整返回内容
@@ -2015,7 +4099,7 @@ func getContextHandler(contextService *services.ContextService) func(ctx context
 				errMsg := fmt.Sprintf("序列化结果失败: %v", err)
 				log.Println(errMsg)
 				logToolCall("get_context", request.Params.Arguments, errMsg, err, time.Since(startTime))
-				return mcp.NewToolResultText(errMsg), nil
+				return toolErrorResult(errMsg, err), nil
 			}
 
 			logToolCall("get_context", request.Params.Arguments, "", nil, time.Since(startTime))
@@ -315,6 +315,12 @@ func setupRoutesAndStartServer(router *gin.Engine, handler *api.Handler, cfg *co
 	// 🔥 新增：注册Session管理接口 - 独立于MCP协议的管理端点
 	handler.RegisterManagementRoutes(router)
 
+	// 注册存活与就绪探测接口
+	handler.RegisterHealthRoutes(router)
+
+	// 注册Prometheus指标接口
+	handler.RegisterMetricsRoutes(router)
+
 	// 🔥 新增：注册批量embedding路由 - 直接在这里调用，不通过RegisterRoutes
 	if handler.GetBatchEmbeddingHandler() != nil {
 		handler.GetBatchEmbeddingHandler().RegisterBatchEmbeddingRoutes(router)
@@ -117,6 +117,12 @@ func main() {
 	// 注册WebSocket路由
 	handler.RegisterWebSocketRoutes(router)
 
+	// 注册存活与就绪探测接口
+	handler.RegisterHealthRoutes(router)
+
+	// 注册Prometheus指标接口
+	handler.RegisterMetricsRoutes(router)
+
 	// 创建并注册Streamable HTTP处理器（支持MCP协议）
 	streamableHandler := api.NewStreamableHTTPHandler(handler)
 	streamableHandler.RegisterStreamableHTTPRoutes(router)
@@ -2,13 +2,15 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,6 +18,8 @@ import (
 	"time"
 
 	"github.com/contextkeeper/service/internal/config"
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/metrics"
 	"github.com/contextkeeper/service/internal/models"
 	"github.com/contextkeeper/service/internal/services"
 	"github.com/contextkeeper/service/internal/utils"
@@ -112,13 +116,13 @@ func BroadcastRequest(request map[string]interface{}) {
 	// 广播到所有通道，不持有锁
 	for connID, channel := range channelCopy {
 		// 使用goroutine避免阻塞
-		go func(id uint64, ch chan map[string]interface{}) {
+		go func(connID uint64, ch chan map[string]interface{}) {
 			// 使用超时机制发送
 			select {
 			case ch <- requestCopy:
-				log.Printf("[广播] 已将请求发送到SSE连接 %d, 方法: %s, ID: %s", id, method, id)
+				log.Printf("[广播] 已将请求发送到SSE连接 %d, 方法: %s, ID: %s", connID, method, id)
 			case <-time.After(500 * time.Millisecond):
-				log.Printf("[广播错误] 发送请求到SSE连接 %d 超时: 通道可能已满, 方法: %s, ID: %s", id, method, id)
+				log.Printf("[广播错误] 发送请求到SSE连接 %d 超时: 通道可能已满, 方法: %s, ID: %s", connID, method, id)
 			}
 		}(connID, channel)
 	}
@@ -292,6 +296,7 @@ func (h *Handler) RegisterRoutes(router *gin.Engine) {
 	{
 		mcp.POST("/storeContext", h.handleStoreContext)
 		mcp.POST("/retrieveContext", h.handleRetrieveContext)
+		mcp.POST("/retrieveContextStream", h.handleRetrieveContextStream)
 		mcp.POST("/summarizeContext", h.handleSummarizeContext)
 		mcp.POST("/searchContext", h.handleSearchContext)
 		mcp.POST("/associateFile", h.handleAssociateFile)
@@ -337,7 +342,8 @@ func (h *Handler) RegisterRoutes(router *gin.Engine) {
 // 健康检查处理函数
 func (h *Handler) handleHealth(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"status": "healthy",
+		"status":  "healthy",
+		"engines": h.contextService.StorageEngineAvailability(),
 	})
 }
 
@@ -370,7 +376,7 @@ func (h *Handler) handleStoreContext(c *gin.Context) {
 	}
 
 	// 处理存储逻辑
-	memoryID, err := h.contextService.StoreContext(c.Request.Context(), req)
+	response, err := h.contextService.StoreContextDetailed(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status": "error",
@@ -381,8 +387,12 @@ func (h *Handler) handleStoreContext(c *gin.Context) {
 
 	// 返回成功响应
 	c.JSON(http.StatusOK, gin.H{
-		"status":   "success",
-		"memoryId": memoryID,
+		"status":         "success",
+		"memoryId":       response.MemoryID,
+		"deduplicated":   response.Deduplicated,
+		"engineResults":  response.EngineResults,
+		"partialFailure": response.PartialFailure,
+		"skipped":        response.Skipped,
 	})
 }
 
@@ -726,7 +736,7 @@ func (h *Handler) handleListRoutes(c *gin.Context) {
 		{
 			"path":        "/health",
 			"method":      "GET",
-			"description": "健康检查端点",
+			"description": "健康检查端点，同时返回TimescaleDB和Neo4j存储引擎的可用性",
 		},
 		{
 			"path":        "/sse",
@@ -1106,16 +1116,12 @@ func (h *Handler) updateSessionActivity(sessionID string) {
 		return
 	}
 
-	// 🔥 修复：直接获取已存在的会话，不创建新会话
-	session, err := userSessionStore.GetSession(sessionID)
+	// 🔥 修复：只更新已存在的会话，不创建新会话
+	err = userSessionStore.ModifySession(sessionID, func(session *models.Session) error {
+		session.LastActive = time.Now()
+		return nil
+	})
 	if err != nil {
-		log.Printf("[会话活跃度更新] 获取会话失败: %v", err)
-		return
-	}
-
-	// 更新最后活跃时间
-	session.LastActive = time.Now()
-	if err := userSessionStore.SaveSession(session); err != nil {
 		log.Printf("[会话活跃度更新] 保存会话失败: %v", err)
 	} else {
 		log.Printf("[会话活跃度更新] ✅ 已更新会话 %s 的活跃时间", sessionID)
@@ -1672,11 +1678,15 @@ func (h *Handler) handleMCPRequest(c *gin.Context) {
 				response["error"] = map[string]interface{}{
 					"code":    -32000,
 					"message": err.Error(),
+					"data":    apperrors.Response(err),
 				}
 			} else {
 				response["result"] = result
 			}
 		}
+	case "notifications/cancelled":
+		// 取消通知已广播到各SSE连接（如流式检索），由对应连接停止处理
+		response["result"] = map[string]interface{}{}
 	default:
 		// 未知请求类型
 		response["error"] = map[string]interface{}{
@@ -1694,7 +1704,21 @@ func (h *Handler) dispatchToolCall(toolName string, params map[string]interface{
 }
 
 // dispatchToolCallWithContext 分派工具调用到相应的处理函数（支持上下文传递）
-func (h *Handler) dispatchToolCallWithContext(ctx context.Context, toolName string, params map[string]interface{}) (interface{}, error) {
+func (h *Handler) dispatchToolCallWithContext(ctx context.Context, toolName string, params map[string]interface{}) (result interface{}, err error) {
+	// 未知工具统一记为unknown，避免任意工具名撑大指标基数
+	toolLabel := toolName
+	defer func(start time.Time) {
+		metrics.ObserveToolCall(toolLabel, err, time.Since(start))
+	}(time.Now())
+
+	// 超出限流时直接返回带retryAfter的结构化错误，不排队等待
+	if limitErr := h.contextService.CheckToolRateLimit(toolName, params, ""); limitErr != nil {
+		if limited, ok := limitErr.(*services.RateLimitError); ok {
+			return limited.ToResponse(), nil
+		}
+		return nil, limitErr
+	}
+
 	switch toolName {
 	case "associate_file":
 		return h.handleToolAssociateFile(ctx, params)
@@ -1712,13 +1736,58 @@ func (h *Handler) dispatchToolCallWithContext(ctx context.Context, toolName stri
 		return h.handleToolStoreConversation(ctx, params)
 	case "retrieve_memory":
 		return h.handleToolRetrieveMemory(ctx, params)
+	case "batch_store_conversation":
+		return h.handleToolBatchStoreConversation(ctx, params)
 	case "retrieve_todos":
 		return h.handleToolRetrieveTodos(ctx, params)
+	case "update_todo":
+		return h.handleToolUpdateTodo(ctx, params)
+	case "query_timeline":
+		return h.handleToolQueryTimeline(ctx, params)
+	case "query_knowledge_graph":
+		return h.handleToolQueryKnowledgeGraph(ctx, params)
+	case "get_entity":
+		return h.handleToolGetEntity(ctx, params)
+	case "delete_memory":
+		return h.handleToolDeleteMemory(ctx, params)
+	case "delete_memories_by_filter":
+		return h.handleToolDeleteMemoriesByFilter(ctx, params)
+	case "archive_memory":
+		return h.handleToolArchiveMemory(ctx, params, true)
+	case "restore_memory":
+		return h.handleToolArchiveMemory(ctx, params, false)
+	case "update_memory":
+		return h.handleToolUpdateMemory(ctx, params)
+	case "reanalyze_memory":
+		return h.handleToolReanalyzeMemory(ctx, params)
+	case "query_by_metadata":
+		return h.handleToolQueryByMetadata(ctx, params)
+	case "list_memories":
+		return h.handleToolListMemories(ctx, params)
+	case "session_stats":
+		return h.handleToolSessionStats(ctx, params)
+	case "get_conversation":
+		return h.handleToolGetConversation(ctx, params)
+	case "list_workspaces":
+		return h.handleToolListWorkspaces(ctx, params)
+	case "get_store_status":
+		return h.handleToolGetStoreStatus(ctx, params)
+	case "export_session":
+		return h.handleToolExportSession(ctx, params)
+	case "import_session":
+		return h.handleToolImportSession(ctx, params)
+	case "merge_sessions":
+		return h.handleToolMergeSessions(ctx, params)
+	case "link_sessions":
+		return h.handleToolLinkSessions(ctx, params)
 	case "user_init_dialog":
 		return h.handleToolUserInitDialog(ctx, params)
 	case "local_operation_callback":
 		return h.handleToolLocalOperationCallback(ctx, params)
+	case "get_pending_instructions":
+		return h.handleToolGetPendingInstructions(ctx, params)
 	default:
+		toolLabel = "unknown"
 		return nil, fmt.Errorf("未知的工具: %s", toolName)
 	}
 }
@@ -1750,7 +1819,7 @@ func (h *Handler) handleToolAssociateFile(ctx context.Context, params map[string
 		FilePath:  filePath,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("关联文件失败: %v", err)
+		return nil, fmt.Errorf("关联文件失败: %w", err)
 	}
 
 	successMsg := fmt.Sprintf("成功关联文件: %s", filePath)
@@ -1816,7 +1885,7 @@ func (h *Handler) handleToolRecordEdit(ctx context.Context, params map[string]in
 		Diff:      diff,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("记录编辑失败: %v", err)
+		return nil, fmt.Errorf("记录编辑失败: %w", err)
 	}
 
 	successMsg := "成功记录编辑操作"
@@ -1859,6 +1928,44 @@ func (h *Handler) handleToolRetrieveContext(ctx context.Context, params map[stri
 	query, _ := params["query"].(string)
 	// 🔥 新增：获取项目分析参数
 	projectAnalysis, _ := params["projectAnalysis"].(string)
+	// 分页参数
+	offset := getIntParam(params, "offset", 0)
+	pageSize := getIntParam(params, "pageSize", 0)
+	topK := getIntParam(params, "topK", 0)
+	// 单次调用的相似度阈值
+	threshold := getFloatParam(params, "threshold", 0)
+	// 混合检索参数
+	hybridSearch, _ := params["hybridSearch"].(bool)
+	hybridAlpha := getOptionalFloatParam(params, "hybridAlpha")
+	// LLM重排序
+	rerank, _ := params["rerank"].(bool)
+	// 多维度向量检索
+	multiVector, _ := params["multiVector"].(bool)
+	// 时间范围（unix秒）与排序方式
+	startTime := int64(getIntParam(params, "startTime", 0))
+	endTime := int64(getIntParam(params, "endTime", 0))
+	sortBy, _ := params["sortBy"].(string)
+	// 按批次或会话分组
+	groupBy, _ := params["groupBy"].(string)
+	// 命名集合
+	collection, _ := params["collection"].(string)
+	// 结构化结果
+	structured, _ := params["structured"].(bool)
+	// 知识图谱扩展
+	graphExpand, _ := params["graphExpand"].(bool)
+	// token预算
+	maxTokens := getIntParam(params, "maxTokens", 0)
+	// 检索诊断
+	explain, _ := params["explain"].(bool)
+	// 优先级加权排序
+	priorityBoost, _ := params["priorityBoost"].(bool)
+	priorityWeight := getFloatParam(params, "priorityWeight", 0)
+	// 时间衰减加权排序
+	recencyBoost, _ := params["recencyBoost"].(bool)
+	recencyWeight := getFloatParam(params, "recencyWeight", 0)
+	recencyHalfLife := getFloatParam(params, "recencyHalfLife", 0)
+	// 是否同时返回已归档的记忆
+	includeArchived, _ := params["includeArchived"].(bool)
 
 	if sessionID == "" || query == "" {
 		return nil, fmt.Errorf("缺少必需参数")
@@ -1935,12 +2042,35 @@ func (h *Handler) handleToolRetrieveContext(ctx context.Context, params map[stri
 		Query:           query,
 		ProjectAnalysis: projectAnalysis, // 🆕 传递工程分析结果
 		Limit:           2000,            // 默认限制
+		Threshold:       threshold,
+		Offset:          offset,
+		PageSize:        pageSize,
+		TopK:            topK,
+		HybridSearch:    hybridSearch,
+		HybridAlpha:     hybridAlpha,
+		Rerank:          rerank,
+		MultiVector:     multiVector,
+		StartTime:       startTime,
+		EndTime:         endTime,
+		SortBy:          sortBy,
+		GroupBy:         groupBy,
+		Collection:      collection,
+		Structured:      structured,
+		GraphExpand:     graphExpand,
+		MaxTokens:       maxTokens,
+		Explain:         explain,
+		PriorityBoost:   priorityBoost,
+		PriorityWeight:  priorityWeight,
+		RecencyBoost:    recencyBoost,
+		RecencyWeight:   recencyWeight,
+		RecencyHalfLife: recencyHalfLife,
+		IncludeArchived: includeArchived,
 	}
 
 	// 🔥 直接使用传入的上下文（统一拦截器已注入会话信息）
 	result, err := h.contextService.RetrieveContext(ctx, retrieveReq)
 	if err != nil {
-		return nil, fmt.Errorf("检索上下文失败: %v", err)
+		return nil, fmt.Errorf("检索上下文失败: %w", err)
 	}
 
 	// 构建响应
@@ -1949,12 +2079,116 @@ func (h *Handler) handleToolRetrieveContext(ctx context.Context, params map[stri
 		"shortTermMemory":   result.ShortTermMemory,
 		"longTermMemory":    result.LongTermMemory,
 		"relevantKnowledge": result.RelevantKnowledge,
+		"hasMore":           result.HasMore,
+		"nextOffset":        result.NextOffset,
 		"success":           true,
 	}
+	if len(result.ScoreBreakdown) > 0 {
+		response["scoreBreakdown"] = result.ScoreBreakdown
+	}
+	if len(result.RerankScores) > 0 {
+		response["rerankScores"] = result.RerankScores
+	}
+	if result.TokenBudget != nil {
+		response["tokenBudget"] = result.TokenBudget
+	}
+	if result.Explain != nil {
+		response["explain"] = result.Explain
+	}
+	if result.EmbeddingDrift != nil {
+		response["embeddingDrift"] = result.EmbeddingDrift
+	}
+	if structured {
+		results := result.Results
+		if results == nil {
+			results = []models.MemoryResult{}
+		}
+		response["results"] = results
+	}
+	if groupBy != "" {
+		groups := result.Groups
+		if groups == nil {
+			groups = []models.MemoryGroup{}
+		}
+		response["groups"] = groups
+	}
 
 	return response, nil
 }
 
+// getFloatParam 从工具参数中读取浮点数，兼容JSON数字和字符串形式
+func getFloatParam(params map[string]interface{}, key string, defaultValue float64) float64 {
+	switch v := params[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		if floatValue, err := strconv.ParseFloat(v, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getOptionalFloatParam 从工具参数中读取浮点数，未传或无法解析时返回nil，用于区分未设置和显式传0
+func getOptionalFloatParam(params map[string]interface{}, key string) *float64 {
+	if _, ok := params[key]; !ok {
+		return nil
+	}
+	value := getFloatParam(params, key, math.NaN())
+	if math.IsNaN(value) {
+		return nil
+	}
+	return &value
+}
+
+// getStringSliceParam 从工具参数中读取字符串列表，兼容数组和逗号分隔字符串
+func getStringSliceParam(params map[string]interface{}, key string) []string {
+	var values []string
+	switch v := params[key].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok && strings.TrimSpace(str) != "" {
+				values = append(values, strings.TrimSpace(str))
+			}
+		}
+	case string:
+		for _, str := range strings.Split(v, ",") {
+			if strings.TrimSpace(str) != "" {
+				values = append(values, strings.TrimSpace(str))
+			}
+		}
+	}
+	return values
+}
+
+// getTimeParam 从工具参数中读取时间，兼容时间字符串和Unix秒级时间戳，未提供时返回零值
+func getTimeParam(params map[string]interface{}, key string) (time.Time, error) {
+	switch v := params[key].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), nil
+	case string:
+		return services.ParseTimelineQueryTime(v)
+	}
+	return time.Time{}, nil
+}
+
+// getIntParam 从工具参数中读取整数，兼容JSON数字和字符串形式
+func getIntParam(params map[string]interface{}, key string, defaultValue int) int {
+	switch v := params[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		if intValue, err := strconv.Atoi(v); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
 // handleToolProgrammingContext 处理获取编程上下文摘要请求
 func (h *Handler) handleToolProgrammingContext(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	sessionID, _ := params["sessionId"].(string)
@@ -1974,12 +2208,18 @@ func (h *Handler) handleToolProgrammingContext(ctx context.Context, params map[s
 		}, nil
 	}
 
-	log.Printf("获取编程上下文摘要: 会话=%s, 用户ID=%s, 查询=%s", sessionID, userID, query)
+	includeTimeline, _ := params["includeTimeline"].(bool)
+
+	log.Printf("获取编程上下文摘要: 会话=%s, 用户ID=%s, 查询=%s, 合并时间线=%v", sessionID, userID, query, includeTimeline)
 
-	// 使用GetProgrammingContext方法获取编程上下文（与STDIO版本保持一致）
-	result, err := h.contextService.GetProgrammingContext(context.Background(), sessionID, query)
+	// 使用GetProgrammingContextWithOptions方法获取编程上下文（与STDIO版本保持一致）
+	result, err := h.contextService.GetProgrammingContextWithOptions(context.Background(), models.ProgrammingContextRequest{
+		SessionID:       sessionID,
+		Query:           query,
+		IncludeTimeline: includeTimeline,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("获取编程上下文失败: %v", err)
+		return nil, fmt.Errorf("获取编程上下文失败: %w", err)
 	}
 
 	log.Printf("获取编程上下文成功")
@@ -1994,15 +2234,22 @@ func (h *Handler) handleToolMemorizeContext(ctx context.Context, params map[stri
 		return nil, fmt.Errorf("缺少必要参数: sessionId")
 	}
 
-	content, ok := params["content"].(string)
-	if !ok || content == "" {
+	// 图片记忆的说明文字可选，文本记忆必须提供内容
+	contentType, _ := params["contentType"].(string)
+	contentRef, _ := params["contentRef"].(string)
+	collection, _ := params["collection"].(string)
+	content, _ := params["content"].(string)
+	if content == "" && contentType != models.ContentTypeImage {
 		return nil, fmt.Errorf("缺少必要参数: content")
 	}
 
 	// 可选参数
+	// 未指定时由服务端按分析结果推断
 	priority, _ := params["priority"].(string)
-	if priority == "" {
-		priority = "P2" // 默认中等优先级
+
+	locale, _ := params["locale"].(string)
+	if err := services.ValidateLocale(locale); err != nil {
+		return nil, err
 	}
 
 	// 处理元数据
@@ -2030,11 +2277,8 @@ func (h *Handler) handleToolMemorizeContext(ctx context.Context, params map[stri
 		bizType = models.BizTypeTodo
 		log.Printf("[记忆上下文] 设置bizType=%d (BizTypeTodo)", models.BizTypeTodo)
 	} else {
-		// 使用正则表达式检查内容格式
-		todoRegex := regexp.MustCompile(`(?i)^(- \[ \]|TODO:|待办:|提醒:|task:)`)
-		todoKeywordsRegex := regexp.MustCompile(`(?i)(待办事项|todo item|task list|待完成|to-do|to do)`)
-
-		if todoRegex.MatchString(content) || todoKeywordsRegex.MatchString(content) {
+		// 按内容语言检查待办标记和待办关键词
+		if services.IsTodoContent(content, locale) {
 			log.Printf("[记忆上下文] 检测到待办事项: %s", content)
 			metadata["type"] = "todo"
 			bizType = models.BizTypeTodo
@@ -2059,35 +2303,125 @@ func (h *Handler) handleToolMemorizeContext(ctx context.Context, params map[stri
 		sessionID, userID, metadata["type"], priority)
 
 	// 创建存储上下文请求
+	dedup, _ := params["dedup"].(bool)
 	storeRequest := models.StoreContextRequest{
-		SessionID: sessionID,
-		UserID:    userID,
-		Content:   content,
-		Priority:  priority,
-		Metadata:  metadata,
-		BizType:   bizType,
+		SessionID:   sessionID,
+		UserID:      userID,
+		Content:     content,
+		Priority:    priority,
+		Metadata:    metadata,
+		BizType:     bizType,
+		Dedup:       dedup,
+		Locale:      locale,
+		ContentType: contentType,
+		ContentRef:  contentRef,
+		Collection:  collection,
+	}
+
+	// 试运行：只返回分析结果，不写入存储
+	if dryRun, _ := params["dryRun"].(bool); dryRun {
+		dryRunResult, err := h.contextService.DryRunStoreContext(ctx, storeRequest)
+		if err != nil {
+			return nil, fmt.Errorf("试运行分析失败: %w", err)
+		}
+
+		log.Printf("[记忆上下文] 试运行完成: 策略=%s, 置信度=%.2f", dryRunResult.StorageStrategy, dryRunResult.Confidence)
+		return map[string]interface{}{
+			"success":         true,
+			"dryRun":          true,
+			"message":         "试运行完成，未写入任何存储",
+			"type":            metadata["type"],
+			"userId":          userID,
+			"analysisResult":  dryRunResult.AnalysisResult,
+			"storageStrategy": dryRunResult.StorageStrategy,
+			"confidence":      dryRunResult.Confidence,
+			"priority":        dryRunResult.Priority,
+			"targetEngines":   dryRunResult.Metadata["targetEngines"],
+		}, nil
+	}
+
+	// 幂等键：窗口内的重复请求直接返回首次结果，不重复写入
+	idempotencyKey, _ := params["idempotencyKey"].(string)
+	replay, err := h.contextService.BeginIdempotentRequest("memorize_context", userID, idempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("存储长期记忆失败: %w", err)
+	}
+	if replay != nil {
+		log.Printf("[记忆上下文] 幂等键 %s 已处理，返回首次结果", idempotencyKey)
+		return replay, nil
+	}
+	idempotencyCompleted := false
+	defer func() {
+		if !idempotencyCompleted {
+			h.contextService.AbortIdempotentRequest("memorize_context", userID, idempotencyKey)
+		}
+	}()
+
+	// 异步存储：入队后立即返回任务ID
+	if async, _ := params["async"].(bool); async {
+		job, err := h.contextService.EnqueueStoreContext(storeRequest)
+		if err != nil {
+			return nil, fmt.Errorf("提交异步存储任务失败: %w", err)
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"async":   true,
+			"jobId":   job.JobID,
+			"status":  job.Status,
+			"message": "存储任务已提交，可通过get_store_status查询结果",
+			"type":    metadata["type"],
+			"userId":  userID,
+		}
+		h.contextService.CompleteIdempotentRequest("memorize_context", userID, idempotencyKey, response)
+		idempotencyCompleted = true
+		return response, nil
 	}
 
 	log.Printf("存储长期记忆: sessionID=%s, 内容长度=%d, 优先级=%s, 类型=%s",
 		sessionID, len(content), priority, metadata["type"])
 
 	// 调用长期记忆存储
-	memoryID, err := h.contextService.StoreContext(context.Background(), storeRequest)
+	storeResponse, err := h.contextService.StoreContextDetailed(context.Background(), storeRequest)
 	if err != nil {
-		return nil, fmt.Errorf("存储长期记忆失败: %v", err)
+		return nil, fmt.Errorf("存储长期记忆失败: %w", err)
 	}
+	memoryID := storeResponse.MemoryID
 
 	response := map[string]interface{}{
-		"memoryId": memoryID,
-		"success":  true,
-		"message":  "成功将内容存储到长期记忆",
-		"type":     metadata["type"],
+		"memoryId":     memoryID,
+		"success":      true,
+		"message":      "成功将内容存储到长期记忆",
+		"type":         metadata["type"],
+		"deduplicated": storeResponse.Deduplicated,
+		"priority":     storeResponse.Priority,
+	}
+	if storeResponse.Deduplicated {
+		response["message"] = "已存在近似重复的记忆，未重复写入"
+	}
+	if storeResponse.Skipped {
+		response["skipped"] = true
+		response["message"] = "内容过短，未写入长期记忆"
+	}
+	if chunkCount, ok := storeResponse.Metadata["chunkCount"]; ok {
+		response["chunkCount"] = chunkCount
+		response["message"] = fmt.Sprintf("内容较长，已分%v块存储到长期记忆", chunkCount)
+	}
+	if len(storeResponse.EngineResults) > 0 {
+		response["engineResults"] = storeResponse.EngineResults
+		response["partialFailure"] = storeResponse.PartialFailure
+	}
+	if storeResponse.PartialFailure {
+		response["message"] = fmt.Sprintf("已存储到长期记忆，但部分存储引擎写入失败: %s，可稍后重试", strings.Join(storeResponse.FailedEngines(), ", "))
 	}
 
 	if userID != "" {
 		response["userId"] = userID
 	}
 
+	h.contextService.CompleteIdempotentRequest("memorize_context", userID, idempotencyKey, response)
+	idempotencyCompleted = true
+
 	log.Printf("[记忆上下文] 成功存储记忆: memoryID=%s, 类型=%s", memoryID, metadata["type"])
 	return response, nil
 }
@@ -2153,6 +2487,12 @@ func (h *Handler) handleToolSessionManagement(ctx context.Context, params map[st
 				"message": "缺少必需参数: userId（用户ID不能为空）",
 			}, nil
 		}
+		if !models.IsValidUserID(userID) {
+			return map[string]interface{}{
+				"status":  "error",
+				"message": fmt.Sprintf("用户ID格式非法: %q（应为user_加字母、数字或下划线）", userID),
+			}, nil
+		}
 
 		if workspaceRoot == "" {
 			return map[string]interface{}{
@@ -2171,7 +2511,7 @@ func (h *Handler) handleToolSessionManagement(ctx context.Context, params map[st
 		session, isNewSession, err := utils.GetWorkspaceSessionID(sessionStore, userID, sessionID, workspaceRoot, metadata, h.config.SessionTimeout)
 		if err != nil {
 			log.Printf("🔄 [MCP会话管理] ❌ 获取或创建会话失败: %v", err)
-			return nil, fmt.Errorf("获取或创建会话失败: %v", err)
+			return nil, fmt.Errorf("获取或创建会话失败: %w", err)
 		}
 
 		log.Printf("🔄 [MCP会话管理] ✅ 会话处理成功: sessionID=%s, isNew=%t, 工作空间=%s", session.ID, isNewSession, workspaceRoot)
@@ -2199,8 +2539,10 @@ func (h *Handler) handleToolSessionManagement(ctx context.Context, params map[st
 		}
 
 		// 更新会话活跃时间
-		session.LastActive = time.Now()
-		if err := sessionStore.SaveSession(session); err != nil {
+		if err := sessionStore.ModifySession(session.ID, func(session *models.Session) error {
+			session.LastActive = time.Now()
+			return nil
+		}); err != nil {
 			log.Printf("[会话管理-获取或创建] 更新会话活跃时间失败: %v", err)
 		}
 
@@ -2267,6 +2609,104 @@ func (h *Handler) handleToolSessionManagement(ctx context.Context, params map[st
 
 		return sessionInfo, nil
 
+	case "pin", "unpin":
+		if sessionID == "" {
+			return map[string]interface{}{
+				"status":  "error",
+				"message": "缺少必需参数: sessionId",
+			}, nil
+		}
+
+		userID, _ := params["userId"].(string)
+		if userID == "" {
+			var err error
+			userID, err = h.contextService.GetUserIDFromSessionID(sessionID)
+			if err != nil || userID == "" {
+				return map[string]interface{}{
+					"status":  "error",
+					"message": "缺少必需参数: userId（用户ID不能为空）",
+				}, nil
+			}
+		}
+
+		pinned := action == "pin"
+		if err := h.contextService.SetSessionPinned(userID, sessionID, pinned); err != nil {
+			return map[string]interface{}{
+				"status":  "error",
+				"message": err.Error(),
+			}, nil
+		}
+
+		return map[string]interface{}{
+			"status":    "success",
+			"sessionId": sessionID,
+			"pinned":    pinned,
+		}, nil
+
+	case "update":
+		if sessionID == "" {
+			return map[string]interface{}{
+				"status":  "error",
+				"message": "缺少必需参数: sessionId",
+			}, nil
+		}
+
+		userID, _ := params["userId"].(string)
+		if userID == "" {
+			var err error
+			userID, err = h.contextService.GetUserIDFromSessionID(sessionID)
+			if err != nil || userID == "" {
+				return map[string]interface{}{
+					"status":  "error",
+					"message": "缺少必需参数: userId（用户ID不能为空）",
+				}, nil
+			}
+		}
+
+		updated, err := h.contextService.UpdateSessionMetadata(userID, sessionID, metadata)
+		if err != nil {
+			return map[string]interface{}{
+				"status":  "error",
+				"message": err.Error(),
+			}, nil
+		}
+
+		return map[string]interface{}{
+			"status":    "success",
+			"sessionId": sessionID,
+			"metadata":  updated,
+		}, nil
+
+	case "switch_workspace":
+		userID, _ := params["userId"].(string)
+		if userID == "" || !models.IsValidUserID(userID) {
+			return map[string]interface{}{
+				"status":  "error",
+				"message": fmt.Sprintf("用户ID格式非法: %q（应为user_加字母、数字或下划线）", userID),
+			}, nil
+		}
+		workspace, _ := params["workspaceHash"].(string)
+		if workspace == "" {
+			workspace, _ = params["workspaceRoot"].(string)
+		}
+
+		session, err := h.contextService.SwitchWorkspace(userID, workspace)
+		if err != nil {
+			return map[string]interface{}{
+				"status":  "error",
+				"message": err.Error(),
+			}, nil
+		}
+
+		workspaceHash, _ := session.Metadata["workspaceHash"].(string)
+		return map[string]interface{}{
+			"status":        "success",
+			"sessionId":     session.ID,
+			"lastActive":    session.LastActive,
+			"workspaceHash": workspaceHash,
+			"metadata":      session.Metadata,
+		}, nil
+
 	default:
 		return nil, fmt.Errorf("不支持的操作: %s", action)
 	}
@@ -2297,7 +2737,7 @@ func (h *Handler) parseProjectAnalysisJSON(projectAnalysis, workspaceID string)
 	// 尝试解析JSON
 	err := json.Unmarshal([]byte(projectAnalysis), &analysisResult)
 	if err != nil {
-		return nil, fmt.Errorf("JSON解析失败: %v", err)
+		return nil, fmt.Errorf("JSON解析失败: %w", err)
 	}
 
 	// 转换为ProjectContext
@@ -2497,6 +2937,23 @@ func (h *Handler) handleToolStoreConversation(ctx context.Context, params map[st
 
 	log.Printf("存储对话: 会话=%s, 用户ID=%s, 消息数=%d", sessionID, userID, len(messages))
 
+	// 幂等键：窗口内的重复请求直接返回首次的batchId和结果，不重复写入
+	idempotencyKey, _ := params["idempotencyKey"].(string)
+	replay, err := h.contextService.BeginIdempotentRequest("store_conversation", userID, idempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("存储对话失败: %w", err)
+	}
+	if replay != nil {
+		log.Printf("[存储对话] 幂等键 %s 已处理，返回首次结果", idempotencyKey)
+		return replay, nil
+	}
+	idempotencyCompleted := false
+	defer func() {
+		if !idempotencyCompleted {
+			h.contextService.AbortIdempotentRequest("store_conversation", userID, idempotencyKey)
+		}
+	}()
+
 	// 如果未提供batchID，生成一个新的
 	if batchID == "" {
 		batchID = models.GenerateMemoryID("")
@@ -2552,7 +3009,7 @@ func (h *Handler) handleToolStoreConversation(ctx context.Context, params map[st
 		Messages:  msgReqs,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("存储对话失败: %v", err)
+		return nil, fmt.Errorf("存储对话失败: %w", err)
 	}
 
 	// 生成对话摘要
@@ -2592,7 +3049,76 @@ func (h *Handler) handleToolStoreConversation(ctx context.Context, params map[st
 	}
 
 	// userID 已经在函数开头定义，直接使用
-	return h.enhanceResponseWithLocalInstruction(result, sessionID, userID, models.LocalInstructionShortMemory, context), nil
+	response := h.enhanceResponseWithLocalInstruction(result, sessionID, userID, models.LocalInstructionShortMemory, context)
+	h.contextService.CompleteIdempotentRequest("store_conversation", userID, idempotencyKey, response)
+	idempotencyCompleted = true
+	return response, nil
+}
+
+// handleToolBatchStoreConversation 处理批量存储对话请求
+func (h *Handler) handleToolBatchStoreConversation(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	batchesRaw, ok := params["batches"].([]interface{})
+	if !ok || len(batchesRaw) == 0 {
+		return nil, fmt.Errorf("batches必须是非空数组")
+	}
+
+	var batches []models.ConversationBatch
+	batchesJSON, _ := json.Marshal(batchesRaw)
+	if err := json.Unmarshal(batchesJSON, &batches); err != nil {
+		return nil, fmt.Errorf("batches格式无效: %w", err)
+	}
+
+	userID, err := h.contextService.GetUserIDFromSessionID(sessionID)
+	if err != nil {
+		log.Printf("[批量存储对话] 从会话获取用户ID失败: %v", err)
+		return map[string]interface{}{
+			"committed": false,
+			"message":   fmt.Sprintf("从会话获取用户ID失败: %v", err),
+		}, nil
+	}
+
+	log.Printf("批量存储对话: 会话=%s, 用户ID=%s, 批次数=%d", sessionID, userID, len(batches))
+
+	resp, err := h.contextService.BatchStoreConversation(ctx, models.BatchStoreConversationRequest{
+		SessionID: sessionID,
+		UserID:    userID,
+		Batches:   batches,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("批量存储对话失败: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"committed": resp.Committed,
+		"batches":   resp.Batches,
+	}
+	if resp.Error != "" {
+		result["error"] = resp.Error
+	}
+
+	// 只有整体提交成功后，才按批次推送本地指令
+	if resp.Committed {
+		var localInstructions []interface{}
+		for _, batch := range resp.Batches {
+			batchResponse := h.enhanceResponseWithLocalInstruction(map[string]interface{}{}, sessionID, userID, models.LocalInstructionShortMemory, map[string]interface{}{
+				"messages":       batch.Messages,
+				"hasNewMessages": len(batch.Messages) > 0,
+			})
+			if instruction, ok := batchResponse["localInstruction"]; ok {
+				localInstructions = append(localInstructions, instruction)
+			}
+		}
+		if len(localInstructions) > 0 {
+			result["localInstructions"] = localInstructions
+		}
+	}
+
+	return result, nil
 }
 
 // handleToolRetrieveMemory 处理记忆检索请求
@@ -2605,6 +3131,7 @@ func (h *Handler) handleToolRetrieveMemory(ctx context.Context, params map[strin
 	memoryID, _ := params["memoryId"].(string)
 	batchID, _ := params["batchId"].(string)
 	format, _ := params["format"].(string)
+	assembleChunks, _ := params["assembleChunks"].(bool)
 
 	if format == "" {
 		format = "full"
@@ -2635,13 +3162,14 @@ func (h *Handler) handleToolRetrieveMemory(ctx context.Context, params map[strin
 
 	// 调用上下文服务检索记忆
 	result, err := h.contextService.RetrieveContext(context.Background(), models.RetrieveContextRequest{
-		SessionID:     sessionID,
-		MemoryID:      memoryID,
-		BatchID:       batchID,
-		SkipThreshold: true,
+		SessionID:      sessionID,
+		MemoryID:       memoryID,
+		BatchID:        batchID,
+		SkipThreshold:  true,
+		AssembleChunks: assembleChunks,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("检索记忆失败: %v", err)
+		return nil, fmt.Errorf("检索记忆失败: %w", err)
 	}
 
 	return map[string]interface{}{
@@ -2684,17 +3212,22 @@ func (h *Handler) handleToolRetrieveTodos(ctx context.Context, params map[string
 		}, nil
 	}
 
-	log.Printf("🔐 [DEBUG] 检索待办事项: 会话=%s, 用户ID=%s, 状态=%s, 限制=%d", sessionID, userID, status, limit)
+	query, _ := params["query"].(string)
+
+	log.Printf("🔐 [DEBUG] 检索待办事项: 会话=%s, 用户ID=%s, 状态=%s, 查询=%s, 限制=%d", sessionID, userID, status, query, limit)
 
 	// 调用上下文服务检索待办事项 - 🔐 传递用户ID确保隔离
-	todoResponse, err := h.contextService.RetrieveTodos(context.Background(), models.RetrieveTodosRequest{
+	todoRequest := models.RetrieveTodosRequest{
 		SessionID: sessionID,
 		UserID:    userID, // 🔐 关键修复：传递用户ID
 		Status:    status,
 		Limit:     limit,
-	})
+		Query:     query,
+	}
+	todoRequest.IncludeArchived, _ = params["includeArchived"].(bool)
+	todoResponse, err := h.contextService.RetrieveTodos(context.Background(), todoRequest)
 	if err != nil {
-		return nil, fmt.Errorf("检索待办事项失败: %v", err)
+		return nil, fmt.Errorf("检索待办事项失败: %w", err)
 	}
 
 	// 构建响应，包含用户隔离信息
@@ -2707,88 +3240,734 @@ func (h *Handler) handleToolRetrieveTodos(ctx context.Context, params map[string
 	return response, nil
 }
 
-// handleToolUserInitDialog 处理用户初始化对话请求（完全参照一期stdio协议实现）
-func (h *Handler) handleToolUserInitDialog(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	// 详细日志：开始处理用户初始化对话
-	log.Printf("[用户初始化对话] 开始处理请求，参数: %+v", params)
-
-	// 验证参数
+// handleToolUpdateTodo 处理更新待办事项请求
+func (h *Handler) handleToolUpdateTodo(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	sessionID, ok := params["sessionId"].(string)
 	if !ok || sessionID == "" {
-		return nil, fmt.Errorf("错误: sessionId必须是非空字符串")
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
 	}
 
-	userResponse, _ := params["userResponse"].(string)
-	log.Printf("[用户初始化对话] 处理会话ID=%s, 用户响应=%q", sessionID, userResponse)
+	memoryID, ok := params["memoryId"].(string)
+	if !ok || memoryID == "" {
+		return nil, fmt.Errorf("缺少必需参数: memoryId")
+	}
 
-	// 如果有用户响应，则处理响应
-	var state *utils.DialogState
-	var err error
+	status, _ := params["status"].(string)
+	if status != "pending" && status != "completed" {
+		return nil, fmt.Errorf("无效的status参数: %s，可选值: pending, completed", status)
+	}
 
-	// 使用defer捕获和记录任何可能的panic
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("[用户初始化对话] 发生panic: %v", r)
-		}
-	}()
+	priority, _ := params["priority"].(string)
+	completedAt := getIntParam(params, "completedAt", 0)
 
-	// 首先检查会话状态是否已经存在
-	dialogExists := false
-	// 这里不直接访问dialogStates，而是通过尝试初始化来检查
-	tmpState, _ := utils.InitializeUserByDialog(sessionID)
-	if tmpState != nil {
-		dialogExists = true
-		log.Printf("[用户初始化对话] 检测到会话状态已存在: state=%s", tmpState.State)
+	// 从会话ID获取用户ID，确保只能更新自己的待办
+	userID, err := h.contextService.GetUserIDFromSessionID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("从会话获取用户ID失败: %w", err)
 	}
 
-	if userResponse != "" {
-		log.Printf("[用户初始化对话] 处理用户响应: %q", userResponse)
+	log.Printf("📝 [更新待办] 会话=%s, 用户ID=%s, memoryID=%s, status=%s, priority=%s",
+		sessionID, userID, memoryID, status, priority)
 
-		// 如果有响应但没有会话状态，可能是第一次调用，先确保初始化
-		if !dialogExists {
-			log.Printf("[用户初始化对话] 警告: 收到用户响应但会话状态不存在，先初始化状态")
-			tmpState, err = utils.InitializeUserByDialog(sessionID)
-			if err != nil {
-				log.Printf("[用户初始化对话] 初始化对话状态失败: %v", err)
-				return nil, fmt.Errorf("处理用户配置对话出错: 无法初始化会话状态: %v", err)
-			}
-		}
+	todoItem, err := h.contextService.UpdateTodo(ctx, models.UpdateTodoRequest{
+		SessionID:   sessionID,
+		UserID:      userID,
+		MemoryID:    memoryID,
+		Status:      status,
+		Priority:    priority,
+		CompletedAt: int64(completedAt),
+	})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("更新待办事项失败: %v", err),
+		}, nil
+	}
 
-		// 添加详细的错误处理
-		state, err = utils.HandleUserDialogResponse(sessionID, userResponse)
-		if err != nil {
-			log.Printf("[用户初始化对话] 处理用户响应失败: %v", err)
-		}
-	} else {
-		log.Printf("[用户初始化对话] 初始化或获取当前对话状态")
-		// 初始化或获取当前对话状态
-		state, err = utils.InitializeUserByDialog(sessionID)
-		if err != nil {
-			log.Printf("[用户初始化对话] 初始化对话状态失败: %v", err)
-		}
+	return map[string]interface{}{
+		"success": true,
+		"todo":    todoItem,
+	}, nil
+}
+
+// handleToolExportSession 处理会话导出请求
+func (h *Handler) handleToolExportSession(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
 	}
 
+	// 从会话ID获取用户ID，确保只能导出自己的会话
+	userID, err := h.contextService.GetUserIDFromSessionID(sessionID)
 	if err != nil {
-		log.Printf("[用户初始化对话] 错误: %v", err)
-		return nil, fmt.Errorf("处理用户配置对话出错: %v", err)
+		return nil, fmt.Errorf("从会话获取用户ID失败: %w", err)
 	}
 
-	log.Printf("[用户初始化对话] 获取到对话状态: state=%s, userID=%s", state.State, state.UserID)
-
-	// 严格按照一期逻辑：如果用户配置完成，强制更新全局缓存
-	if state.State == utils.DialogStateCompleted && state.UserID != "" {
-		log.Printf("[用户初始化对话] 用户配置完成，强制更新全局缓存，UserID: %s", state.UserID)
-		// 强制确保用户ID被缓存（这是关键修复）
-		utils.SetCachedUserID(state.UserID)
-		log.Printf("[用户初始化对话] 缓存设置完成，验证: %s", utils.GetCachedUserID())
-	} else if state.State == utils.DialogStateNewUser && state.UserID != "" {
-		log.Printf("[用户初始化对话] 新用户创建完成，立即更新缓存，UserID: %s", state.UserID)
-		// 新用户也需要立即设置缓存
-		utils.SetCachedUserID(state.UserID)
-		log.Printf("[用户初始化对话] 新用户缓存设置完成，验证: %s", utils.GetCachedUserID())
-	}
+	log.Printf("📦 [导出会话] 会话=%s, 用户ID=%s", sessionID, userID)
 
-	// 构建响应
+	export, err := h.contextService.ExportSession(ctx, userID, sessionID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("导出会话失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"data":    export,
+	}, nil
+}
+
+// handleToolImportSession 处理会话导入请求
+func (h *Handler) handleToolImportSession(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	export, err := services.ParseSessionExport(params["data"])
+	if err != nil {
+		return nil, fmt.Errorf("无效的data参数: %w", err)
+	}
+
+	targetSessionID, _ := params["targetSessionId"].(string)
+	force, _ := params["force"].(bool)
+
+	// 从会话ID获取导入者用户ID，导入的数据统一归属到该用户
+	userID, err := h.contextService.GetUserIDFromSessionID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("从会话获取用户ID失败: %w", err)
+	}
+
+	log.Printf("📦 [导入会话] 会话=%s, 用户ID=%s, 目标会话=%s, force=%v", sessionID, userID, targetSessionID, force)
+
+	result, err := h.contextService.ImportSession(ctx, models.ImportSessionRequest{
+		UserID:          userID,
+		Data:            export,
+		TargetSessionID: targetSessionID,
+		Force:           force,
+	})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("导入会话失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"result":  result,
+	}, nil
+}
+
+// handleToolMergeSessions 处理会话合并请求
+func (h *Handler) handleToolMergeSessions(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	targetSessionID, ok := params["targetSessionId"].(string)
+	if !ok || targetSessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: targetSessionId")
+	}
+	sourceSessionID, ok := params["sourceSessionId"].(string)
+	if !ok || sourceSessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sourceSessionId")
+	}
+
+	// 从目标会话获取用户ID，源会话须属于同一用户
+	userID, err := h.contextService.GetUserIDFromSessionID(targetSessionID)
+	if err != nil {
+		return nil, fmt.Errorf("从会话获取用户ID失败: %w", err)
+	}
+
+	log.Printf("🔀 [合并会话] %s -> %s, 用户ID=%s", sourceSessionID, targetSessionID, userID)
+
+	result, err := h.contextService.MergeSessions(ctx, models.MergeSessionsRequest{
+		UserID:          userID,
+		TargetSessionID: targetSessionID,
+		SourceSessionID: sourceSessionID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("合并会话失败: %w", err)
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"result":  result,
+	}, nil
+}
+
+// handleToolLinkSessions 处理会话关联请求
+func (h *Handler) handleToolLinkSessions(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sourceSessionID, ok := params["sourceSessionId"].(string)
+	if !ok || sourceSessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sourceSessionId")
+	}
+	targetSessionID, ok := params["targetSessionId"].(string)
+	if !ok || targetSessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: targetSessionId")
+	}
+	relationship, _ := params["relationship"].(string)
+	description, _ := params["description"].(string)
+
+	// 从源会话获取用户ID，目标会话须属于同一用户
+	userID, err := h.contextService.GetUserIDFromSessionID(sourceSessionID)
+	if err != nil {
+		return nil, fmt.Errorf("从会话获取用户ID失败: %w", err)
+	}
+
+	log.Printf("🔗 [关联会话] %s -[%s]-> %s, 用户ID=%s", sourceSessionID, relationship, targetSessionID, userID)
+
+	result, err := h.contextService.LinkSessions(models.LinkSessionsRequest{
+		UserID:          userID,
+		SourceSessionID: sourceSessionID,
+		TargetSessionID: targetSessionID,
+		Relationship:    relationship,
+		Description:     description,
+		Topics:          getStringSliceParam(params, "topics"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("关联会话失败: %w", err)
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"result":  result,
+	}, nil
+}
+
+// handleToolQueryTimeline 处理时间线查询请求
+func (h *Handler) handleToolQueryTimeline(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	from, err := getTimeParam(params, "from")
+	if err != nil {
+		return nil, fmt.Errorf("无效的from参数: %w", err)
+	}
+	to, err := getTimeParam(params, "to")
+	if err != nil {
+		return nil, fmt.Errorf("无效的to参数: %w", err)
+	}
+
+	eventTypes := getStringSliceParam(params, "eventTypes")
+	workspaceID, _ := params["workspaceId"].(string)
+	limit := getIntParam(params, "limit", 0)
+
+	// 从会话ID获取用户ID，实现多用户隔离
+	userID, err := h.contextService.GetUserIDFromSessionID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("从会话获取用户ID失败: %w", err)
+	}
+
+	log.Printf("🕒 [时间线查询] 会话=%s, 用户ID=%s, 工作空间=%s, 事件类型=%v, 限制=%d",
+		sessionID, userID, workspaceID, eventTypes, limit)
+
+	timelineResponse, err := h.contextService.QueryTimeline(ctx, userID, workspaceID, from, to, eventTypes, limit)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("查询时间线失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success":         true,
+		"from":            timelineResponse.From,
+		"to":              timelineResponse.To,
+		"events":          timelineResponse.Events,
+		"total":           timelineResponse.Total,
+		"eventTypeCounts": timelineResponse.EventTypeCounts,
+	}, nil
+}
+
+// handleToolQueryKnowledgeGraph 处理知识图谱查询请求
+func (h *Handler) handleToolQueryKnowledgeGraph(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	entityName, ok := params["entityName"].(string)
+	if !ok || entityName == "" {
+		return nil, fmt.Errorf("缺少必需参数: entityName")
+	}
+
+	maxDepth := getIntParam(params, "maxDepth", 0)
+
+	// 从会话ID获取用户ID，只返回该用户写入的知识图谱
+	userID, err := h.contextService.GetUserIDFromSessionID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("从会话获取用户ID失败: %w", err)
+	}
+
+	log.Printf("🕸️ [知识图谱查询] 会话=%s, 用户ID=%s, 实体=%s, 深度=%d", sessionID, userID, entityName, maxDepth)
+
+	graphResponse, err := h.contextService.QueryKnowledgeGraph(ctx, userID, entityName, maxDepth)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("查询知识图谱失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success":       true,
+		"entityName":    graphResponse.EntityName,
+		"maxDepth":      graphResponse.MaxDepth,
+		"nodes":         graphResponse.Nodes,
+		"relationships": graphResponse.Relationships,
+		"truncated":     graphResponse.Truncated,
+	}, nil
+}
+
+// handleToolGetEntity 处理实体画像请求
+func (h *Handler) handleToolGetEntity(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	entityName, ok := params["entityName"].(string)
+	if !ok || entityName == "" {
+		return nil, fmt.Errorf("缺少必需参数: entityName")
+	}
+
+	req := models.GetEntityRequest{
+		SessionID:   sessionID,
+		EntityName:  entityName,
+		MemoryLimit: getIntParam(params, "memoryLimit", 0),
+	}
+
+	log.Printf("🕸️ [实体画像] 会话=%s, 实体=%s, memoryLimit=%d", sessionID, entityName, req.MemoryLimit)
+
+	profile, err := h.contextService.GetEntityProfile(ctx, req)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("获取实体画像失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"result":  profile,
+		"message": profile.Description,
+	}, nil
+}
+
+// handleToolListMemories 处理列出记忆请求
+func (h *Handler) handleToolListMemories(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	listReq := models.ListMemoriesRequest{SessionID: sessionID}
+	listReq.Type, _ = params["type"].(string)
+	listReq.Priority, _ = params["priority"].(string)
+	listReq.SortBy, _ = params["sortBy"].(string)
+	listReq.IncludeArchived, _ = params["includeArchived"].(bool)
+	if limit, ok := params["limit"].(float64); ok {
+		listReq.Limit = int(limit)
+	}
+	if offset, ok := params["offset"].(float64); ok {
+		listReq.Offset = int(offset)
+	}
+
+	listResponse, err := h.contextService.ListMemories(ctx, listReq)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("列出记忆失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"items":   listResponse.Items,
+		"total":   listResponse.Total,
+		"limit":   listResponse.Limit,
+		"offset":  listResponse.Offset,
+	}, nil
+}
+
+// handleToolSessionStats 处理会话统计请求
+func (h *Handler) handleToolSessionStats(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	stats, err := h.contextService.GetSessionStats(ctx, sessionID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("获取会话统计失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"stats":   stats,
+	}, nil
+}
+
+// handleToolListWorkspaces 处理列出用户工作空间请求
+func (h *Handler) handleToolListWorkspaces(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	userID, _ := params["userId"].(string)
+	if userID == "" {
+		return nil, fmt.Errorf("缺少必需参数: userId")
+	}
+	if !models.IsValidUserID(userID) {
+		return nil, fmt.Errorf("用户ID格式非法: %q（应为user_加字母、数字或下划线）", userID)
+	}
+
+	workspaces, err := h.contextService.ListWorkspaces(userID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("获取工作空间列表失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success":    true,
+		"userId":     userID,
+		"workspaces": workspaces,
+	}, nil
+}
+
+// handleToolGetConversation 处理获取完整对话记录请求
+func (h *Handler) handleToolGetConversation(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+	batchID, _ := params["batchId"].(string)
+	includeArchived, _ := params["includeArchived"].(bool)
+
+	transcript, err := h.contextService.GetConversation(ctx, models.GetConversationRequest{SessionID: sessionID, BatchID: batchID, IncludeArchived: includeArchived})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("获取对话记录失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success":   true,
+		"sessionId": transcript.SessionID,
+		"batchId":   transcript.BatchID,
+		"batches":   transcript.Batches,
+		"source":    transcript.Source,
+		"messages":  transcript.Messages,
+	}, nil
+}
+
+// handleToolGetStoreStatus 处理查询异步存储状态请求
+func (h *Handler) handleToolGetStoreStatus(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+	jobID, ok := params["jobId"].(string)
+	if !ok || jobID == "" {
+		return nil, fmt.Errorf("缺少必需参数: jobId")
+	}
+
+	job, err := h.contextService.GetStoreJob(sessionID, jobID)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("查询存储任务失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"job":     job,
+	}, nil
+}
+
+// handleToolDeleteMemory 处理删除记忆请求
+func (h *Handler) handleToolDeleteMemory(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	memoryID, _ := params["memoryId"].(string)
+	batchID, _ := params["batchId"].(string)
+	if memoryID == "" && batchID == "" {
+		return nil, fmt.Errorf("缺少必需参数: memoryId或batchId")
+	}
+
+	log.Printf("🗑️ [删除记忆] 会话=%s, memoryID=%s, batchID=%s", sessionID, memoryID, batchID)
+
+	deleteResponse, err := h.contextService.DeleteMemory(ctx, models.DeleteMemoryRequest{
+		SessionID: sessionID,
+		MemoryID:  memoryID,
+		BatchID:   batchID,
+	})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("删除记忆失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success":          true,
+		"deletedCount":     deleteResponse.DeletedCount,
+		"timelineDeleted":  deleteResponse.TimelineDeleted,
+		"conceptsDeleted":  deleteResponse.ConceptsDeleted,
+		"relationsDeleted": deleteResponse.RelationsDeleted,
+		"memoryId":         deleteResponse.MemoryID,
+		"batchId":          deleteResponse.BatchID,
+		"message":          deleteResponse.Description,
+	}, nil
+}
+
+// handleToolDeleteMemoriesByFilter 处理按条件批量删除记忆请求，默认演练
+func (h *Handler) handleToolDeleteMemoriesByFilter(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	req := models.DeleteMemoriesByFilterRequest{
+		SessionID: sessionID,
+		StartTime: int64(getIntParam(params, "startTime", 0)),
+		EndTime:   int64(getIntParam(params, "endTime", 0)),
+	}
+	req.FilterSessionID, _ = params["filterSessionId"].(string)
+	req.Type, _ = params["type"].(string)
+	req.Priority, _ = params["priority"].(string)
+	req.Confirm, _ = params["confirm"].(bool)
+	req.AllowAll, _ = params["allowAll"].(bool)
+
+	log.Printf("🗑️ [批量删除] 会话=%s, filterSessionId=%s, type=%s, priority=%s, confirm=%v",
+		sessionID, req.FilterSessionID, req.Type, req.Priority, req.Confirm)
+
+	response, err := h.contextService.DeleteMemoriesByFilter(ctx, req)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("批量删除记忆失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"result":  response,
+		"message": response.Description,
+	}, nil
+}
+
+// handleToolArchiveMemory 处理归档(archived=true)或恢复(archived=false)记忆请求
+func (h *Handler) handleToolArchiveMemory(ctx context.Context, params map[string]interface{}, archived bool) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	memoryID, ok := params["memoryId"].(string)
+	if !ok || memoryID == "" {
+		return nil, fmt.Errorf("缺少必需参数: memoryId")
+	}
+
+	log.Printf("🗄️ [记忆归档] 会话=%s, memoryID=%s, archived=%v", sessionID, memoryID, archived)
+
+	archiveReq := models.ArchiveMemoryRequest{SessionID: sessionID, MemoryID: memoryID}
+	var archiveResponse *models.ArchiveMemoryResponse
+	var err error
+	if archived {
+		archiveResponse, err = h.contextService.ArchiveMemory(ctx, archiveReq)
+	} else {
+		archiveResponse, err = h.contextService.RestoreMemory(ctx, archiveReq)
+	}
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("更新记忆归档状态失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success":    true,
+		"memoryId":   archiveResponse.MemoryID,
+		"archived":   archiveResponse.Archived,
+		"archivedAt": archiveResponse.ArchivedAt,
+		"memory":     archiveResponse.Memory,
+	}, nil
+}
+
+// handleToolUpdateMemory 处理更新记忆请求
+func (h *Handler) handleToolUpdateMemory(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	memoryID, ok := params["memoryId"].(string)
+	if !ok || memoryID == "" {
+		return nil, fmt.Errorf("缺少必需参数: memoryId")
+	}
+
+	content, _ := params["content"].(string)
+	metadata, _ := params["metadata"].(map[string]interface{})
+	if content == "" && len(metadata) == 0 {
+		return nil, fmt.Errorf("缺少必需参数: content或metadata")
+	}
+
+	log.Printf("✏️ [更新记忆] 会话=%s, memoryID=%s, 内容长度=%d, metadata字段=%d", sessionID, memoryID, len(content), len(metadata))
+
+	updateResponse, err := h.contextService.UpdateMemory(ctx, models.UpdateMemoryRequest{
+		SessionID: sessionID,
+		MemoryID:  memoryID,
+		Content:   content,
+		Metadata:  metadata,
+	})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("更新记忆失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success":         true,
+		"memory":          updateResponse.Memory,
+		"contentChanged":  updateResponse.ContentChanged,
+		"timelineUpdated": updateResponse.TimelineUpdated,
+		"conceptsUpdated": updateResponse.ConceptsUpdated,
+	}, nil
+}
+
+// handleToolReanalyzeMemory 处理重新分析记忆请求
+func (h *Handler) handleToolReanalyzeMemory(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	memoryID, ok := params["memoryId"].(string)
+	if !ok || memoryID == "" {
+		return nil, fmt.Errorf("缺少必需参数: memoryId")
+	}
+
+	log.Printf("🔁 [重新分析] 会话=%s, memoryID=%s", sessionID, memoryID)
+
+	reanalyzeResponse, err := h.contextService.ReanalyzeMemory(ctx, models.ReanalyzeMemoryRequest{
+		SessionID: sessionID,
+		MemoryID:  memoryID,
+	})
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("重新分析记忆失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"result":  reanalyzeResponse,
+		"message": fmt.Sprintf("新写入的存储引擎: %v", reanalyzeResponse.NewlyPopulated),
+	}, nil
+}
+
+// handleToolQueryByMetadata 处理按metadata键值查询记忆请求
+func (h *Handler) handleToolQueryByMetadata(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	queryReq := models.QueryByMetadataRequest{
+		SessionID: sessionID,
+		Exists:    getStringSliceParam(params, "exists"),
+	}
+	queryReq.Metadata, _ = params["metadata"].(map[string]interface{})
+	if len(queryReq.Metadata) == 0 && len(queryReq.Exists) == 0 {
+		return nil, fmt.Errorf("缺少必需参数: metadata或exists")
+	}
+	if limit, ok := params["limit"].(float64); ok {
+		queryReq.Limit = int(limit)
+	}
+	queryReq.IncludeArchived, _ = params["includeArchived"].(bool)
+
+	log.Printf("🏷️ [metadata查询] 会话=%s, 条件=%v, 存在=%v", sessionID, queryReq.Metadata, queryReq.Exists)
+
+	queryResponse, err := h.contextService.QueryByMetadata(ctx, queryReq)
+	if err != nil {
+		return map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("按metadata查询记忆失败: %v", err),
+		}, nil
+	}
+
+	return map[string]interface{}{
+		"success": true,
+		"result":  queryResponse,
+		"message": fmt.Sprintf("匹配%d条记忆，返回%d条", queryResponse.Total, len(queryResponse.Memories)),
+	}, nil
+}
+
+// handleToolUserInitDialog 处理用户初始化对话请求（完全参照一期stdio协议实现）
+func (h *Handler) handleToolUserInitDialog(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	// 详细日志：开始处理用户初始化对话
+	log.Printf("[用户初始化对话] 开始处理请求，参数: %+v", params)
+
+	// 验证参数
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("错误: sessionId必须是非空字符串")
+	}
+
+	userResponse, _ := params["userResponse"].(string)
+	log.Printf("[用户初始化对话] 处理会话ID=%s, 用户响应=%q", sessionID, userResponse)
+
+	// 如果有用户响应，则处理响应
+	var state *utils.DialogState
+	var err error
+
+	// 使用defer捕获和记录任何可能的panic
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[用户初始化对话] 发生panic: %v", r)
+		}
+	}()
+
+	// 初始化和处理响应在同一会话锁内完成，同一会话的并发请求不会基于过期状态推进对话
+	if userResponse != "" {
+		log.Printf("[用户初始化对话] 处理用户响应: %q", userResponse)
+	} else {
+		log.Printf("[用户初始化对话] 初始化或获取当前对话状态")
+	}
+	state, err = utils.ProcessUserDialog(sessionID, userResponse)
+
+	if err != nil {
+		log.Printf("[用户初始化对话] 错误: %v", err)
+		return nil, fmt.Errorf("处理用户配置对话出错: %w", err)
+	}
+
+	log.Printf("[用户初始化对话] 获取到对话状态: state=%s, userID=%s", state.State, state.UserID)
+
+	// 严格按照一期逻辑：如果用户配置完成，强制更新全局缓存
+	if state.State == utils.DialogStateCompleted && state.UserID != "" {
+		log.Printf("[用户初始化对话] 用户配置完成，强制更新全局缓存，UserID: %s", state.UserID)
+		// 强制确保用户ID被缓存（这是关键修复）
+		utils.SetCachedUserID(state.UserID)
+		log.Printf("[用户初始化对话] 缓存设置完成，验证: %s", utils.GetCachedUserID())
+	} else if state.State == utils.DialogStateNewUser && state.UserID != "" {
+		log.Printf("[用户初始化对话] 新用户创建完成，立即更新缓存，UserID: %s", state.UserID)
+		// 新用户也需要立即设置缓存
+		utils.SetCachedUserID(state.UserID)
+		log.Printf("[用户初始化对话] 新用户缓存设置完成，验证: %s", utils.GetCachedUserID())
+	}
+
+	// 构建响应
 	result := map[string]interface{}{
 		"state": state.State,
 	}
@@ -2921,45 +4100,12 @@ func (h *Handler) enhanceResponseWithLocalInstruction(response map[string]interf
 			instruction.Type, instruction.Target, instruction.CallbackID)
 		response["localInstruction"] = instruction
 
-		// 🔥 关键：通过WebSocket推送指令到客户端 - 使用精确推送
+		// 🔥 关键：通过WebSocket推送指令到客户端 - 优先按会话精确推送，未确认的指令在重连后重新推送
 		if services.GlobalWSManager != nil {
-			var callbackChan chan models.CallbackResult
-
-			// 优先尝试基于sessionID的精确推送
-			if sessionID != "" {
-				if sessionChan, sessionErr := services.GlobalWSManager.PushInstructionToSession(sessionID, *instruction); sessionErr == nil {
-					callbackChan = sessionChan
-					log.Printf("[WebSocket] 本地指令已精确推送到会话 %s -> 用户: %s", sessionID, userID)
-				} else {
-					log.Printf("[WebSocket] 精确推送失败 (会话 %s 未注册)，回退到用户级别推送: %v", sessionID, sessionErr)
-					// 回退到传统的用户级别推送
-					if fallbackChan, fallbackErr := services.GlobalWSManager.PushInstruction(userID, *instruction); fallbackErr == nil {
-						callbackChan = fallbackChan
-						log.Printf("[WebSocket] 回退推送成功: %s -> 用户: %s", instruction.CallbackID, userID)
-					} else {
-						log.Printf("[WebSocket] 回退推送也失败: %v", fallbackErr)
-					}
-				}
+			if services.GlobalWSManager.DeliverInstruction(sessionID, userID, *instruction) {
+				log.Printf("[WebSocket] 本地指令已推送: %s -> 用户: %s", instruction.CallbackID, userID)
 			} else {
-				// 如果没有sessionID，直接使用用户级别推送
-				if userChan, userErr := services.GlobalWSManager.PushInstruction(userID, *instruction); userErr == nil {
-					callbackChan = userChan
-					log.Printf("[WebSocket] 本地指令已推送: %s -> 用户: %s", instruction.CallbackID, userID)
-				} else {
-					log.Printf("[WebSocket] 推送指令失败: %v, 用户可能未连接WebSocket: %s", userErr, userID)
-				}
-			}
-
-			// 如果推送成功，异步等待回调结果
-			if callbackChan != nil {
-				go func() {
-					select {
-					case callbackResult := <-callbackChan:
-						log.Printf("[WebSocket] 本地指令执行完成: %s - %s", instruction.CallbackID, callbackResult.Message)
-					case <-time.After(30 * time.Second):
-						log.Printf("[WebSocket] 本地指令执行超时: %s", instruction.CallbackID)
-					}
-				}()
+				log.Printf("[WebSocket] 推送指令失败，用户可能未连接WebSocket，指令已保留待重连后推送: %s -> 用户: %s", instruction.CallbackID, userID)
 			}
 		} else {
 			log.Printf("[WebSocket] WebSocket管理器未初始化，跳过推送")
@@ -3008,6 +4154,16 @@ func (h *Handler) handleToolLocalOperationCallback(ctx context.Context, params m
 		log.Printf("[工具回调] 本地操作失败: %s, 错误: %s", callbackID, errorMsg)
 	}
 
+	// 确认指令，通知等待中的推送方并移出待确认队列
+	if services.GlobalWSManager != nil {
+		services.GlobalWSManager.HandleCallback(callbackID, models.CallbackResult{
+			Success:   success,
+			Message:   errorMsg,
+			Data:      data,
+			Timestamp: time.Now(),
+		})
+	}
+
 	return map[string]interface{}{
 		"status":       "success",
 		"message":      "回调已处理",
@@ -3018,6 +4174,31 @@ func (h *Handler) handleToolLocalOperationCallback(ctx context.Context, params m
 	}, nil
 }
 
+// handleToolGetPendingInstructions 获取断线期间未确认的本地指令
+func (h *Handler) handleToolGetPendingInstructions(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	sessionID, ok := params["sessionId"].(string)
+	if !ok || sessionID == "" {
+		return nil, fmt.Errorf("缺少必需参数: sessionId")
+	}
+
+	userID, err := h.contextService.GetUserIDFromSessionID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("从会话获取用户ID失败: %w", err)
+	}
+
+	instructions := []models.PendingInstruction{}
+	if services.GlobalWSManager != nil {
+		instructions = services.GlobalWSManager.GetPendingInstructions(userID)
+	}
+
+	return map[string]interface{}{
+		"success":      true,
+		"userId":       userID,
+		"instructions": instructions,
+		"queueDepth":   len(instructions),
+	}, nil
+}
+
 // 在init函数或者路由注册函数中添加WebSocket路由
 func (h *Handler) RegisterWebSocketRoutes(router *gin.Engine) {
 	// WebSocket连接端点
@@ -3334,6 +4515,76 @@ func min(a, b int) int {
 	return b
 }
 
+// RegisterHealthRoutes 注册存活与就绪探测接口
+func (h *Handler) RegisterHealthRoutes(router *gin.Engine) {
+	router.GET("/healthz", h.handleHealthz)
+	router.GET("/readyz", h.handleReadyz)
+
+	log.Println("健康检查接口已注册:")
+	log.Println("  GET  /healthz - 存活探测")
+	log.Println("  GET  /readyz - 就绪探测（向量库、Neo4j、TimescaleDB）")
+}
+
+// RegisterMetricsRoutes 注册Prometheus文本格式的指标接口
+func (h *Handler) RegisterMetricsRoutes(router *gin.Engine) {
+	metrics.RegisterGaugeFunc("context_keeper_embedding_cache_hit_ratio",
+		"Embedding cache hit ratio since startup.", func() float64 {
+			return h.GetContextService().GetEmbeddingCacheStats().HitRate
+		})
+	metrics.RegisterGaugeFunc("context_keeper_embedding_cache_entries",
+		"Number of entries currently held in the embedding cache.", func() float64 {
+			return float64(h.GetContextService().GetEmbeddingCacheStats().Size)
+		})
+
+	metrics.RegisterGaugeFunc("context_keeper_ws_pending_instructions",
+		"Number of local instructions pushed over WebSocket and not yet acknowledged.", func() float64 {
+			return float64(services.GlobalWSManager.PendingInstructionCount())
+		})
+
+	router.GET("/metrics", h.handleMetrics)
+
+	log.Println("指标接口已注册:")
+	log.Println("  GET  /metrics - Prometheus指标")
+}
+
+// handleMetrics 以Prometheus文本格式输出进程内指标
+func (h *Handler) handleMetrics(c *gin.Context) {
+	c.Header("Content-Type", metrics.ContentType)
+	c.Status(http.StatusOK)
+	if err := metrics.Default().WritePrometheus(c.Writer); err != nil {
+		log.Printf("⚠️ [指标] 输出指标失败: %v", err)
+	}
+}
+
+// handleHealthz 存活探测，进程能响应即返回200
+func (h *Handler) handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "alive",
+		"uptime": time.Since(startTime).String(),
+	})
+}
+
+// handleReadyz 就绪探测，所有已启用的后端可达时返回200，否则返回503
+func (h *Handler) handleReadyz(c *gin.Context) {
+	backends := h.contextService.CheckReadiness(c.Request.Context())
+
+	status := "ready"
+	httpStatus := http.StatusOK
+	for _, backend := range backends {
+		if backend.Status == models.BackendStatusError {
+			status = "not_ready"
+			httpStatus = http.StatusServiceUnavailable
+			log.Printf("⚠️ [就绪探测] %s 不可用: %s", backend.Name, backend.Error)
+		}
+	}
+
+	c.JSON(httpStatus, gin.H{
+		"status":    status,
+		"backends":  backends,
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
 // RegisterManagementRoutes 注册Session管理接口 - 独立于MCP协议的管理端点
 func (h *Handler) RegisterManagementRoutes(router *gin.Engine) {
 	// Session管理接口组 - 专用于系统监控和管理
@@ -3344,6 +4595,31 @@ func (h *Handler) RegisterManagementRoutes(router *gin.Engine) {
 
 		// 根据用户ID查询session详情
 		management.GET("/users/:userId/sessions", h.HandleGetUserSessionDetail)
+
+		// 切换embedding模型后重建用户记忆向量，需要管理员令牌
+		management.POST("/users/:userId/reindex", h.requireAdminToken(), h.handleReindexUserMemories)
+		management.GET("/users/:userId/reindex", h.requireAdminToken(), h.handleGetReindexState)
+
+		// 清除用户全部数据，需要管理员令牌
+		management.POST("/users/:userId/purge", h.requireAdminToken(), h.handlePurgeUser)
+
+		// 检查并清理会话已不存在的孤立向量，默认演练，需要管理员令牌
+		management.POST("/users/:userId/reconcile", h.requireAdminToken(), h.handleReconcileStorage)
+
+		// 从已存储的记忆重建知识图谱，默认演练，需要管理员令牌
+		management.POST("/users/:userId/kg-rebuild", h.requireAdminToken(), h.handleRebuildKnowledgeGraph)
+		management.GET("/users/:userId/kg-rebuild", h.requireAdminToken(), h.handleGetKnowledgeGraphRebuildState)
+
+		// LLM调用的token用量与估算费用，需要管理员令牌
+		management.GET("/llm/usage", h.requireAdminToken(), h.handleLLMUsage)
+
+		// 会话清理审计与演练，演练需要管理员令牌
+		management.GET("/cleanup/audit", h.requireAdminToken(), h.handleCleanupAudit)
+		management.POST("/cleanup/dry-run", h.requireAdminToken(), h.handleCleanupDryRun)
+
+		// LLM驱动配置查看与热重载，热重载需要管理员令牌
+		management.GET("/llm-driven/config", h.handleLLMDrivenConfig)
+		management.POST("/llm-driven/reload", h.requireAdminToken(), h.handleReloadLLMDrivenConfig)
 	}
 
 	// 🔥 新增：用户管理接口组
@@ -3358,12 +4634,360 @@ func (h *Handler) RegisterManagementRoutes(router *gin.Engine) {
 	log.Println("Session管理接口已注册:")
 	log.Println("  GET  /management/sessions - 查询所有会话列表（分页）")
 	log.Println("  GET  /management/users/:userId/sessions - 查询用户会话详情")
+	log.Println("  POST /management/users/:userId/reindex - 重建用户记忆向量（需confirm=true，failedOnly=true只重试失败记录）")
+	log.Println("  GET  /management/users/:userId/reindex - 查询记忆重建进度")
+	log.Println("  POST /management/users/:userId/purge - 清除用户全部数据（需管理员令牌，confirm为该userId）")
+	log.Println("  POST /management/users/:userId/reconcile - 检查孤立向量和缺失记忆（需管理员令牌，dryRun=false时删除孤立向量）")
+	log.Println("  POST /management/users/:userId/kg-rebuild - 从已存储记忆重建知识图谱（需管理员令牌，dryRun=false时后台写入Neo4j）")
+	log.Println("  GET  /management/users/:userId/kg-rebuild - 查询知识图谱重建进度（需管理员令牌）")
+	log.Println("  GET  /management/llm/usage - 查询LLM用量统计")
+	log.Println("  GET  /management/cleanup/audit - 查询最近一次会话清理的审计记录")
+	log.Println("  POST /management/cleanup/dry-run - 演练会话清理，只返回将被清理的会话和消息")
+	log.Println("  GET  /management/llm-driven/config - 查询LLM驱动配置摘要")
+	log.Println("  POST /management/llm-driven/reload - 重新加载LLM驱动配置")
 	log.Println("用户管理接口已注册:")
 	log.Println("  POST /api/users - 新增用户（包含唯一性校验）")
 	log.Println("  PUT  /api/users/:userId - 变更用户信息")
 	log.Println("  GET  /api/users/:userId - 查询用户信息")
 }
 
+// handleLLMUsage 查询LLM调用的累计token用量和估算费用
+func (h *Handler) handleLLMUsage(c *gin.Context) {
+	c.JSON(http.StatusOK, h.contextService.GetLLMUsage())
+}
+
+// handleReindexUserMemories 在后台用当前embedding模型重建用户全部记忆的向量
+// 调用开销大，必须显式传入confirm=true；restart=true时丢弃上次进度从头开始，否则从断点继续
+// failedOnly=true时只重试上次重建中失败的记录
+func (h *Handler) handleReindexUserMemories(c *gin.Context) {
+	userID := c.Param("userId")
+
+	var req struct {
+		Confirm    bool `json:"confirm"`
+		Restart    bool `json:"restart"`
+		FailedOnly bool `json:"failedOnly"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求格式: " + err.Error(),
+			})
+			return
+		}
+	}
+	req.Confirm = req.Confirm || c.Query("confirm") == "true"
+	req.Restart = req.Restart || c.Query("restart") == "true"
+	req.FailedOnly = req.FailedOnly || c.Query("failedOnly") == "true"
+
+	if !req.Confirm {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "重建会为该用户的全部记忆重新调用embedding接口，开销较大，请设置confirm=true确认",
+		})
+		return
+	}
+	if req.Restart && req.FailedOnly {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "restart和failedOnly不能同时设置",
+		})
+		return
+	}
+
+	if req.FailedOnly {
+		if err := h.contextService.StartRetryFailedReindex(userID); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, services.ErrReindexRunning) {
+				status = http.StatusConflict
+			} else if errors.Is(err, services.ErrNoReindexFailures) {
+				status = http.StatusNotFound
+			}
+			c.JSON(status, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+
+		log.Printf("[API] 已启动用户 %s 的重建失败记录重试", userID)
+		c.JSON(http.StatusAccepted, gin.H{
+			"success": true,
+			"message": "失败记录重试已在后台启动，可通过GET查询进度",
+			"userId":  userID,
+		})
+		return
+	}
+
+	if req.Restart {
+		if err := h.contextService.ResetReindexState(userID); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrReindexRunning) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+	}
+
+	if err := h.contextService.StartReindexAllMemories(userID); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrReindexRunning) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	log.Printf("[API] 已启动用户 %s 的记忆重建, restart=%v", userID, req.Restart)
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "记忆重建已在后台启动，可通过GET查询进度",
+		"userId":  userID,
+	})
+}
+
+// handlePurgeUser 清除用户在会话存储、向量存储、时间线和知识图谱中的全部数据
+// 请求体中的confirm必须与路径中的userId一致，防止误删；可重复执行，部分后端失败时complete为false
+func (h *Handler) handlePurgeUser(c *gin.Context) {
+	userID := c.Param("userId")
+
+	var req struct {
+		Confirm string `json:"confirm"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求格式: " + err.Error(),
+			})
+			return
+		}
+	}
+	if req.Confirm == "" || req.Confirm != userID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "清除会永久删除该用户的全部数据，请在confirm中填写该userId确认",
+		})
+		return
+	}
+
+	log.Printf("[API] 管理员请求清除用户 %s 的全部数据", userID)
+	report, err := h.contextService.PurgeUser(c.Request.Context(), userID)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrPurgeUserConflict) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": report.Complete, "report": report})
+}
+
+// handleReconcileStorage 检查用户向量记录与会话存储的一致性
+// 默认演练只返回报告；请求体dryRun为false（或查询参数dryRun=false）时删除所属会话已不存在的孤立向量
+func (h *Handler) handleReconcileStorage(c *gin.Context) {
+	userID := c.Param("userId")
+
+	var req struct {
+		DryRun *bool `json:"dryRun"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求格式: " + err.Error(),
+			})
+			return
+		}
+	}
+	dryRun := c.Query("dryRun") != "false"
+	if req.DryRun != nil {
+		dryRun = *req.DryRun
+	}
+
+	log.Printf("[API] 检查用户 %s 的存储一致性, dryRun=%v", userID, dryRun)
+	report, err := h.contextService.ReconcileStorage(c.Request.Context(), userID, dryRun)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrPurgeUserConflict) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "report": report})
+}
+
+// handleRebuildKnowledgeGraph 从用户已存储的记忆重新抽取实体和关系，以合并语义写入知识图谱
+// 默认演练，同步返回当前游标起一批记录的抽取统计；dryRun为false时在后台执行，restart=true时丢弃上次进度从头开始
+func (h *Handler) handleRebuildKnowledgeGraph(c *gin.Context) {
+	userID := c.Param("userId")
+
+	var req struct {
+		DryRun  *bool `json:"dryRun"`
+		Restart bool  `json:"restart"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "无效的请求格式: " + err.Error(),
+			})
+			return
+		}
+	}
+	dryRun := c.Query("dryRun") != "false"
+	if req.DryRun != nil {
+		dryRun = *req.DryRun
+	}
+	req.Restart = req.Restart || c.Query("restart") == "true"
+
+	if dryRun {
+		state, err := h.contextService.PreviewKnowledgeGraphRebuild(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "dryRun": true, "state": state})
+		return
+	}
+
+	if req.Restart {
+		if err := h.contextService.ResetKnowledgeGraphRebuildState(userID); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrKnowledgeGraphRebuildRunning) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"success": false, "message": err.Error()})
+			return
+		}
+	}
+
+	if err := h.contextService.StartRebuildKnowledgeGraph(userID); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrKnowledgeGraphRebuildRunning) {
+			status = http.StatusConflict
+		} else if errors.Is(err, services.ErrKnowledgeGraphDisabled) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	log.Printf("[API] 已启动用户 %s 的知识图谱重建, restart=%v", userID, req.Restart)
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "知识图谱重建已在后台启动，可通过GET查询进度",
+		"userId":  userID,
+	})
+}
+
+// handleGetKnowledgeGraphRebuildState 查询用户知识图谱重建进度
+func (h *Handler) handleGetKnowledgeGraphRebuildState(c *gin.Context) {
+	userID := c.Param("userId")
+
+	state, err := h.contextService.GetKnowledgeGraphRebuildState(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if state == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "该用户没有知识图谱重建记录"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "state": state})
+}
+
+// requireAdminToken 校验管理员令牌，支持Authorization: Bearer和X-Admin-Token请求头
+// 未配置ADMIN_TOKEN时拒绝所有请求
+func (h *Handler) requireAdminToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.config == nil || h.config.AdminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "未配置ADMIN_TOKEN，管理接口已禁用",
+			})
+			return
+		}
+
+		token := c.GetHeader("X-Admin-Token")
+		if token == "" {
+			token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminToken)) != 1 {
+			log.Printf("⚠️ [API] 管理员令牌校验失败: %s %s", c.Request.Method, c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "管理员令牌无效",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// handleGetReindexState 查询用户记忆重建进度
+func (h *Handler) handleGetReindexState(c *gin.Context) {
+	userID := c.Param("userId")
+
+	state, err := h.contextService.GetReindexState(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if state == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "该用户没有记忆重建记录"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "state": state})
+}
+
+// handleCleanupAudit 查询最近一次会话清理（含演练）的审计记录
+func (h *Handler) handleCleanupAudit(c *gin.Context) {
+	audit, err := h.contextService.GetLastCleanupAudit()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+	if audit == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "尚未执行过会话清理"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "audit": audit})
+}
+
+// handleCleanupDryRun 按当前配置演练一次会话清理，不删除任何数据
+func (h *Handler) handleCleanupDryRun(c *gin.Context) {
+	audit := h.contextService.RunSessionCleanup(c.Request.Context(), h.config.SessionTimeout, true)
+	c.JSON(http.StatusOK, gin.H{"success": true, "audit": audit})
+}
+
+// handleLLMDrivenConfig 查询当前生效的LLM驱动配置摘要
+func (h *Handler) handleLLMDrivenConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, h.contextService.GetLLMDrivenConfigSummary())
+}
+
+// handleReloadLLMDrivenConfig 重新加载LLM驱动配置，校验失败时保留原有配置并返回400
+func (h *Handler) handleReloadLLMDrivenConfig(c *gin.Context) {
+	summary, err := h.contextService.ReloadLLMDrivenConfig()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"config":  summary,
+	})
+}
+
 // handleCreateUser 新增用户接口（包含唯一性校验）
 func (h *Handler) handleCreateUser(c *gin.Context) {
 	log.Printf("🔥 [用户管理] ===== 开始处理用户创建请求 =====")
@@ -12,6 +12,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	apperrors "github.com/contextkeeper/service/internal/errors"
 	"github.com/contextkeeper/service/internal/models"
 	"github.com/gin-gonic/gin"
 )
@@ -320,6 +321,7 @@ func (h *Handler) HandleSSE(c *gin.Context) {
 						"error": map[string]interface{}{
 							"code":    -32603,
 							"message": err.Error(),
+							"data":    apperrors.Response(err),
 						},
 					}
 				} else {
@@ -483,12 +485,24 @@ func (h *Handler) getRegisteredTools() []map[string]interface{} {
 					},
 					"priority": map[string]interface{}{
 						"type":        "string",
-						"description": "优先级，可选: P1(高), P2(中), P3(低)，默认P2",
+						"description": "优先级，可选: P1(高), P2(中), P3(低)；不传时按分析出的事件类型和置信度推断(PRIORITY_INFERENCE_RULES)，否则使用DEFAULT_MEMORY_PRIORITY(默认P2)",
 					},
 					"metadata": map[string]interface{}{
 						"type":        "object",
 						"description": "记忆相关的元数据，可选",
 					},
+					"dedup": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否去重：同会话/用户下已有相似度达到阈值(STORE_DEDUP_THRESHOLD)的记忆时不再写入，返回已有记忆ID，默认false",
+					},
+					"dryRun": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否试运行：只执行LLM分析并返回分析结果、存储策略和将写入的引擎，不写入任何存储，默认false",
+					},
+					"async": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否异步存储：请求入队后立即返回jobId，由后台处理，可通过get_store_status查询结果，默认false",
+					},
 				},
 				"required": []string{"sessionId", "content"},
 			},
@@ -515,6 +529,10 @@ func (h *Handler) getRegisteredTools() []map[string]interface{} {
 						"type":        "string",
 						"description": "返回格式: full, summary",
 					},
+					"assembleChunks": map[string]interface{}{
+						"type":        "boolean",
+						"description": "memoryId为超长内容分块存储的父ID或分块ID时，重组并返回完整内容；父ID本身没有记录时自动重组",
+					},
 				},
 				"required": []string{"sessionId"},
 			},
@@ -611,6 +629,105 @@ func (h *Handler) processMCPToolRequest(ctx context.Context, request models.MCPR
 	return h.dispatchToolCallWithContext(ctx, toolName, arguments)
 }
 
+// handleRetrieveContextStream 以SSE流式返回检索结果
+// 先发送connected事件（携带requestId），向量检索完成后立即发送candidate事件，之后按最终顺序发送result事件，
+// 最后发送complete事件；客户端断开，或通过RPC端点广播notifications/cancelled（params.requestId）时，
+// 请求context被取消，后端检索和LLM重排序随之停止
+func (h *Handler) handleRetrieveContextStream(c *gin.Context) {
+	var req models.RetrieveContextRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"type":    "error",
+			"message": "无效的请求格式: " + err.Error(),
+		})
+		return
+	}
+	if req.SessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"type":    "error",
+			"message": "缺少必需的sessionId字段",
+		})
+		return
+	}
+
+	// 设置SSE相关的HTTP头
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("X-Accel-Buffering", "no") // 防止Nginx缓冲
+
+	// 分配连接ID并更新连接计数，与MCP SSE连接共用统计
+	connID := atomic.AddUint64(&connectionCounter, 1)
+	requestID := fmt.Sprintf("retrieve-%d", connID)
+	connMutex.Lock()
+	activeConnections++
+	totalConnections++
+	connMutex.Unlock()
+	defer func() {
+		connMutex.Lock()
+		activeConnections--
+		connMutex.Unlock()
+	}()
+	log.Printf("[conn-%d] 流式检索开始: 会话=%s, 查询=%s, rerank=%v", connID, req.SessionID, req.Query, req.Rerank)
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	// 注册请求通道，接收BroadcastRequest广播的取消通知
+	requestChan := make(chan map[string]interface{}, 10)
+	RegisterSSERequestChannel(connID, requestChan)
+	defer UnregisterSSERequestChannel(connID)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case request := <-requestChan:
+				if isCancelRequest(request, requestID) {
+					log.Printf("[conn-%d] 收到取消通知，停止流式检索", connID)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	if err := writeSSEEvent(c.Writer, models.RetrievalEventConnected, gin.H{"requestId": requestID}); err != nil {
+		log.Printf("[conn-%d] 发送连接事件失败: %v", connID, err)
+		return
+	}
+
+	err := h.contextService.StreamRetrieveContext(ctx, req, func(event string, data interface{}) error {
+		return writeSSEEvent(c.Writer, event, data)
+	})
+	if err == nil {
+		return
+	}
+	if c.Request.Context().Err() != nil {
+		log.Printf("[conn-%d] 客户端已断开，流式检索已停止: %v", connID, err)
+		return
+	}
+
+	log.Printf("[conn-%d] 流式检索失败: %v", connID, err)
+	if writeErr := writeSSEEvent(c.Writer, models.RetrievalEventError, gin.H{
+		"message": "检索上下文失败: " + err.Error(),
+		"code":    apperrors.CodeOf(err),
+	}); writeErr != nil {
+		log.Printf("[conn-%d] 发送错误事件失败: %v", connID, writeErr)
+	}
+}
+
+// isCancelRequest 广播的请求是否为取消指定requestId的通知
+func isCancelRequest(request map[string]interface{}, requestID string) bool {
+	if method, _ := request["method"].(string); method != "notifications/cancelled" {
+		return false
+	}
+	params, _ := request["params"].(map[string]interface{})
+	cancelled, _ := params["requestId"].(string)
+	return cancelled == requestID
+}
+
 // generateRandomID 生成随机ID
 func generateRandomID(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
@@ -630,3 +747,12 @@ func writeSSE(w http.ResponseWriter, data string) error {
 	w.(http.Flusher).Flush()
 	return nil
 }
+
+// writeSSEEvent 发送带事件名的SSE消息，data序列化为JSON
+func writeSSEEvent(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化SSE事件失败: %w", err)
+	}
+	return writeSSE(w, "event: "+event+"\ndata: "+string(payload)+"\n\n")
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	apperrors "github.com/contextkeeper/service/internal/errors"
 	"github.com/gin-gonic/gin"
 )
 
@@ -122,7 +123,8 @@ func (sh *StreamableHTTPHandler) HandleStreamableHTTP(c *gin.Context) {
 
 		if strings.Contains(errorMessage, "方法不支持") {
 			errorCode = -32601 // Method not found
-		} else if strings.Contains(errorMessage, "缺少") || strings.Contains(errorMessage, "无效") {
+		} else if apperrors.CodeOf(err) == apperrors.CodeInvalidArgument ||
+			strings.Contains(errorMessage, "缺少") || strings.Contains(errorMessage, "无效") {
 			errorCode = -32602 // Invalid params
 		} else {
 			errorCode = -32603 // Internal error
@@ -134,6 +136,8 @@ func (sh *StreamableHTTPHandler) HandleStreamableHTTP(c *gin.Context) {
 			Error: &MCPError{
 				Code:    errorCode,
 				Message: errorMessage,
+				// 机器可读的错误码，客户端据此判断是否重试
+				Data: apperrors.Response(err),
 			},
 		})
 		return
@@ -336,6 +340,98 @@ func (sh *StreamableHTTPHandler) getToolsDefinition() []map[string]interface{} {
 						"type":        "string",
 						"description": "工程分析结果（可选，用于检索增强）",
 					},
+					"offset": map[string]interface{}{
+						"type":        "number",
+						"description": "分页偏移量，默认0，可使用上次返回的nextOffset继续获取",
+					},
+					"pageSize": map[string]interface{}{
+						"type":        "number",
+						"description": "每页返回的记忆条数，默认10",
+					},
+					"topK": map[string]interface{}{
+						"type":        "number",
+						"description": "返回的相关记忆条数(1-100)，默认10，超过100时按100返回；与pageSize同时指定时必须一致",
+					},
+					"threshold": map[string]interface{}{
+						"type":        "number",
+						"description": "本次检索的相似度阈值（0-1，越大越相似），不传或为0时使用配置值",
+					},
+					"hybridSearch": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否启用混合检索：向量相似度与关键词匹配合并排序，适合查找函数名等精确标识符，结果附带得分明细",
+					},
+					"hybridAlpha": map[string]interface{}{
+						"type":        "number",
+						"description": "混合检索中向量得分的权重[0-1]，其余为关键词得分权重，0表示只按关键词得分，不传时使用配置值",
+					},
+					"rerank": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否使用LLM按查询意图对前20条结果重新打分排序，结果附带重排序得分",
+					},
+					"multiVector": map[string]interface{}{
+						"type":        "boolean",
+						"description": "同时检索核心意图、领域上下文和场景维度向量，按记忆保存的维度权重(0.5/0.3/0.15)融合得分；相似度阈值作用于融合后的得分。仅在向量存储启用多维度向量（如QDRANT_MULTI_VECTOR=true）时生效，否则使用主向量检索",
+					},
+					"startTime": map[string]interface{}{
+						"type":        "number",
+						"description": "时间范围起点（unix秒，含），不传或为0时不限制",
+					},
+					"endTime": map[string]interface{}{
+						"type":        "number",
+						"description": "时间范围终点（unix秒，含），不传或为0时不限制",
+					},
+					"sortBy": map[string]interface{}{
+						"type":        "string",
+						"description": "结果排序方式：默认按相似度，time按时间倒序",
+					},
+					"groupBy": map[string]interface{}{
+						"type":        "string",
+						"description": "按batch(对话批次)或session(会话)聚合相关记忆，以groups返回：每组包含最高得分、按时间正序的成员(最多5条)和可用的批次/会话摘要，此时longTermMemory为空",
+					},
+					"collection": map[string]interface{}{
+						"type":        "string",
+						"description": "只检索该命名集合中的记忆；不传时检索全部记忆",
+					},
+					"structured": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否返回结构化结果：results数组中每条包含memoryId、content、score、type、timestamp、metadata，此时longTermMemory为空；默认返回拼接的文本",
+					},
+					"maxTokens": map[string]interface{}{
+						"type":        "number",
+						"description": "相关记忆的token预算（估算值，上限200000）：先保留最新的最近对话，再按排序保留相关历史，超出的截断或丢弃，响应的tokenBudget中列出保留和丢弃的条目；不传或为0时不限制",
+					},
+					"graphExpand": map[string]interface{}{
+						"type":        "boolean",
+						"description": "以向量命中的前5条记忆为起点，在知识图谱中扩展一跳到相关实体，追加最多10条关联记忆（标记为图谱扩展来源，不计入分页）；Neo4j未启用时不生效",
+					},
+					"priorityBoost": map[string]interface{}{
+						"type":        "boolean",
+						"description": "按相似度与记忆优先级(P0>P1>P2>P3)的加权得分排序，相关性接近时重要记忆排在前面；相似度始终占多数权重，开启explain时每个候选同时返回原始得分和加权得分，默认false",
+					},
+					"priorityWeight": map[string]interface{}{
+						"type":        "number",
+						"description": "priorityBoost中优先级得分的权重(0-0.5]，不传或为0时使用配置值(PRIORITY_BOOST_WEIGHT，默认0.2)",
+					},
+					"recencyBoost": map[string]interface{}{
+						"type":        "boolean",
+						"description": "按相似度与记忆存储时间的指数衰减得分加权排序，相关性接近时新近的记忆排在前面；可与priorityBoost同时使用，相似度始终占多数权重，开启explain时每个候选同时返回时间衰减得分和加权得分，默认false",
+					},
+					"recencyWeight": map[string]interface{}{
+						"type":        "number",
+						"description": "recencyBoost中时间衰减得分的权重(0-0.5]，不传或为0时使用配置值(RECENCY_BOOST_WEIGHT，默认0.2)",
+					},
+					"recencyHalfLife": map[string]interface{}{
+						"type":        "number",
+						"description": "recencyBoost的半衰期（小时），记忆每经过一个半衰期时间衰减得分减半；不传或为0时使用配置值(RECENCY_HALF_LIFE_HOURS，默认168即7天)",
+					},
+					"includeArchived": map[string]interface{}{
+						"type":        "boolean",
+						"description": "同时返回已归档(archive_memory)的记忆，默认false（归档的记忆不参与检索）",
+					},
+					"explain": map[string]interface{}{
+						"type":        "boolean",
+						"description": "返回检索诊断信息(explain)：每个候选的原始得分、是否通过相似度阈值、命中的过滤条件(userId/session/workspace/timeRange)、重排序前后及最终排名，以及最终使用的过滤条件；只包含当前用户的记录，默认false",
+					},
 				},
 				"required": []string{"sessionId", "query"},
 			},
@@ -354,6 +450,10 @@ func (sh *StreamableHTTPHandler) getToolsDefinition() []map[string]interface{} {
 						"type":        "string",
 						"description": "可选查询参数",
 					},
+					"includeTimeline": map[string]interface{}{
+						"type":        "boolean",
+						"description": "可选，为true时合并TimescaleDB时间线事件（决策、部署等）到活动统计；服务端开启PROGRAMMING_CONTEXT_TIMELINE时始终合并",
+					},
 				},
 				"required": []string{"sessionId"},
 			},
@@ -366,7 +466,7 @@ func (sh *StreamableHTTPHandler) getToolsDefinition() []map[string]interface{} {
 				"properties": map[string]interface{}{
 					"action": map[string]interface{}{
 						"type":        "string",
-						"description": "操作类型: get_or_create",
+						"description": "操作类型: get_or_create, pin（置顶会话，不活跃时不会被清理）, unpin（取消置顶）, update（合并更新会话元数据，如llmProvider/llmModel指定会话使用的LLM）, switch_workspace（切换到工作空间最近活跃的会话）",
 					},
 					"userId": map[string]interface{}{
 						"type":        "string",
@@ -376,9 +476,17 @@ func (sh *StreamableHTTPHandler) getToolsDefinition() []map[string]interface{} {
 						"type":        "string",
 						"description": "工作空间根路径，必需参数，用于会话隔离，确保不同工作空间的session完全独立",
 					},
+					"workspaceHash": map[string]interface{}{
+						"type":        "string",
+						"description": "工作空间哈希（list_workspaces返回的hash），switch_workspace时可代替workspaceRoot",
+					},
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "会话ID，pin/unpin/update操作时必需",
+					},
 					"metadata": map[string]interface{}{
 						"type":        "object",
-						"description": "会话元数据，可选",
+						"description": "会话元数据，可选；update操作时为要合并的键值，值为null时删除该键，llmProvider可选deepseek/openai/claude/qianwen/ollama_local",
 					},
 				},
 				"required": []string{"action", "userId", "workspaceRoot"},
@@ -402,10 +510,32 @@ func (sh *StreamableHTTPHandler) getToolsDefinition() []map[string]interface{} {
 						"type":        "string",
 						"description": "批次ID，可选，不提供则自动生成",
 					},
+					"idempotencyKey": map[string]interface{}{
+						"type":        "string",
+						"description": "幂等键，可选：网络重试时传入相同的键，保留时间(IDEMPOTENCY_KEY_TTL)内直接返回首次的batchId和结果，不重复存储；按用户隔离",
+					},
 				},
 				"required": []string{"sessionId", "messages"},
 			},
 		},
+		{
+			"name":        "batch_store_conversation",
+			"description": "批量存储多个对话批次，全部成功才提交，任一批次失败则整体回滚",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"batches": map[string]interface{}{
+						"type":        "array",
+						"description": "批次列表，每个批次包含batchId（可选）和messages数组",
+					},
+				},
+				"required": []string{"sessionId", "batches"},
+			},
+		},
 		{
 			"name":        "retrieve_memory",
 			"description": "基于memoryId或batchId检索历史对话",
@@ -428,6 +558,10 @@ func (sh *StreamableHTTPHandler) getToolsDefinition() []map[string]interface{} {
 						"type":        "string",
 						"description": "返回格式: full, summary",
 					},
+					"assembleChunks": map[string]interface{}{
+						"type":        "boolean",
+						"description": "memoryId为超长内容分块存储的父ID或分块ID时，重组并返回完整内容；父ID本身没有记录时自动重组",
+					},
 				},
 				"required": []string{"sessionId"},
 			},
@@ -444,18 +578,50 @@ func (sh *StreamableHTTPHandler) getToolsDefinition() []map[string]interface{} {
 					},
 					"content": map[string]interface{}{
 						"type":        "string",
-						"description": "要记忆的内容",
+						"description": "要记忆的内容；contentType为image时为可选的图片说明，用于检索",
+					},
+					"contentType": map[string]interface{}{
+						"type":        "string",
+						"description": "内容类型，可选: text, image，默认text；image时只保存contentRef引用，以content说明文字生成检索向量",
+					},
+					"contentRef": map[string]interface{}{
+						"type":        "string",
+						"description": "图片的外部URI或路径，contentType为image时必填，retrieve_context会随匹配的说明一并返回",
+					},
+					"collection": map[string]interface{}{
+						"type":        "string",
+						"description": "记忆所属的命名集合（如work、personal），只允许字母、数字、下划线、连字符和点；不传时不归属任何集合",
 					},
 					"priority": map[string]interface{}{
 						"type":        "string",
-						"description": "优先级，可选: P1(高), P2(中), P3(低)，默认P2",
+						"description": "优先级，可选: P1(高), P2(中), P3(低)；不传时按分析出的事件类型和置信度推断(PRIORITY_INFERENCE_RULES)，否则使用DEFAULT_MEMORY_PRIORITY(默认P2)",
 					},
 					"metadata": map[string]interface{}{
 						"type":        "object",
 						"description": "记忆相关的元数据，可选",
 					},
+					"locale": map[string]interface{}{
+						"type":        "string",
+						"description": "内容语言，可选: auto(按内容自动判断), zh, en，默认auto；用于待办事项检测和时间线事件类型判断",
+					},
+					"dedup": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否去重：同会话/用户下已有相似度达到阈值(STORE_DEDUP_THRESHOLD)的记忆时不再写入，返回已有记忆ID，默认false",
+					},
+					"dryRun": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否试运行：只执行LLM分析并返回分析结果、存储策略和将写入的引擎，不写入任何存储，默认false",
+					},
+					"async": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否异步存储：请求入队后立即返回jobId，由后台处理，可通过get_store_status查询结果，默认false",
+					},
+					"idempotencyKey": map[string]interface{}{
+						"type":        "string",
+						"description": "幂等键，可选：网络重试时传入相同的键，保留时间(IDEMPOTENCY_KEY_TTL)内直接返回首次的memoryId和结果，不重复存储；按用户隔离，试运行不记录",
+					},
 				},
-				"required": []string{"sessionId", "content"},
+				"required": []string{"sessionId"},
 			},
 		},
 		{
@@ -472,6 +638,14 @@ func (sh *StreamableHTTPHandler) getToolsDefinition() []map[string]interface{} {
 						"type":        "string",
 						"description": "筛选状态: all, pending, completed",
 					},
+					"query": map[string]interface{}{
+						"type":        "string",
+						"description": "可选，按与查询的语义相关度检索待办并返回相似度score，可与status同时使用；不传时列出所有待办",
+					},
+					"includeArchived": map[string]interface{}{
+						"type":        "boolean",
+						"description": "同时返回已归档的待办，默认false",
+					},
 					"limit": map[string]interface{}{
 						"type":        "string",
 						"description": "返回结果数量限制",
@@ -480,6 +654,499 @@ func (sh *StreamableHTTPHandler) getToolsDefinition() []map[string]interface{} {
 				"required": []string{"sessionId"},
 			},
 		},
+		{
+			"name":        "update_todo",
+			"description": "更新待办事项的状态、优先级或完成时间",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"memoryId": map[string]interface{}{
+						"type":        "string",
+						"description": "待办事项的记忆ID",
+					},
+					"status": map[string]interface{}{
+						"type":        "string",
+						"description": "新状态: pending, completed",
+					},
+					"priority": map[string]interface{}{
+						"type":        "string",
+						"description": "优先级，可选: P0, P1, P2, P3",
+					},
+					"completedAt": map[string]interface{}{
+						"type":        "number",
+						"description": "完成时间（Unix秒），可选，状态为completed时默认当前时间",
+					},
+				},
+				"required": []string{"sessionId", "memoryId", "status"},
+			},
+		},
+		{
+			"name":        "query_timeline",
+			"description": "按时间窗口查询时间线事件，按时间正序返回，并附带按事件类型的数量统计",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"from": map[string]interface{}{
+						"type":        "string",
+						"description": "开始时间，支持RFC3339、2006-01-02 15:04:05、2006-01-02或Unix秒级时间戳，默认为结束时间前7天",
+					},
+					"to": map[string]interface{}{
+						"type":        "string",
+						"description": "结束时间，格式同from，默认为当前时间",
+					},
+					"eventTypes": map[string]interface{}{
+						"type":        "array",
+						"description": "事件类型过滤，如code_edit, decision，可选",
+						"items": map[string]interface{}{
+							"type": "string",
+						},
+					},
+					"workspaceId": map[string]interface{}{
+						"type":        "string",
+						"description": "工作空间（工程名）过滤，可选",
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "返回事件数量限制，默认50，最大500",
+					},
+				},
+				"required": []string{"sessionId"},
+			},
+		},
+		{
+			"name":        "query_knowledge_graph",
+			"description": "从指定实体出发查询知识图谱中相关的概念和关系",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"entityName": map[string]interface{}{
+						"type":        "string",
+						"description": "起始实体名称",
+					},
+					"maxDepth": map[string]interface{}{
+						"type":        "number",
+						"description": "最大遍历跳数，默认2，最大3",
+					},
+				},
+				"required": []string{"sessionId", "entityName"},
+			},
+		},
+		{
+			"name":        "get_entity",
+			"description": "获取实体画像：汇总知识图谱中该实体的直接关系（如使用它的项目、它解决的问题）和关联的来源记忆片段；实体不在图谱中或Neo4j未启用时按实体名向量检索相关记忆，只包含当前用户的数据",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"entityName": map[string]interface{}{
+						"type":        "string",
+						"description": "实体名称，需与知识图谱中的名称一致（如TimescaleDB）",
+					},
+					"memoryLimit": map[string]interface{}{
+						"type":        "number",
+						"description": "返回的来源记忆数上限，默认10，最大50",
+					},
+				},
+				"required": []string{"sessionId", "entityName"},
+			},
+		},
+		{
+			"name":        "delete_memory",
+			"description": "基于memoryId或batchId删除已存储的记忆，并同步清理关联的知识图谱和时间线数据",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"memoryId": map[string]interface{}{
+						"type":        "string",
+						"description": "记忆ID，与batchId二选一",
+					},
+					"batchId": map[string]interface{}{
+						"type":        "string",
+						"description": "批次ID，与memoryId二选一",
+					},
+				},
+				"required": []string{"sessionId"},
+			},
+		},
+		{
+			"name":        "delete_memories_by_filter",
+			"description": "按条件批量删除当前用户的记忆（会话、类型、优先级、时间范围），并同步清理关联的知识图谱和时间线数据；默认演练只返回匹配数量，confirm=true时才删除；条件为空或匹配全部记忆时需设置allowAll=true",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID，用于确定用户",
+					},
+					"filterSessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "只删除该会话的记忆",
+					},
+					"type": map[string]interface{}{
+						"type":        "string",
+						"description": "记忆类型，如long_term_memory、todo、message、conversation_summary",
+					},
+					"priority": map[string]interface{}{
+						"type":        "string",
+						"description": "优先级，可选: P0, P1, P2, P3",
+					},
+					"startTime": map[string]interface{}{
+						"type":        "number",
+						"description": "时间范围起点（unix秒，含），不传或为0时不限制",
+					},
+					"endTime": map[string]interface{}{
+						"type":        "number",
+						"description": "时间范围终点（unix秒，含），不传或为0时不限制",
+					},
+					"confirm": map[string]interface{}{
+						"type":        "boolean",
+						"description": "为true时执行删除，默认false只预览匹配数量",
+					},
+					"allowAll": map[string]interface{}{
+						"type":        "boolean",
+						"description": "允许删除当前用户的全部记忆，过滤条件为空或匹配全部记忆时必须设置",
+					},
+				},
+				"required": []string{"sessionId"},
+			},
+		},
+		{
+			"name":        "archive_memory",
+			"description": "归档（软删除）已存储的记忆：记录保留但默认不参与检索，可用restore_memory恢复；配置了archived保留策略时超期后永久删除",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"memoryId": map[string]interface{}{
+						"type":        "string",
+						"description": "要归档的记忆ID",
+					},
+				},
+				"required": []string{"sessionId", "memoryId"},
+			},
+		},
+		{
+			"name":        "restore_memory",
+			"description": "恢复已归档的记忆，恢复后重新参与检索",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"memoryId": map[string]interface{}{
+						"type":        "string",
+						"description": "要恢复的记忆ID",
+					},
+				},
+				"required": []string{"sessionId", "memoryId"},
+			},
+		},
+		{
+			"name":        "update_memory",
+			"description": "原地更新已存储记忆的内容和元数据，保留原记忆ID；内容变化时重新生成向量，并同步更新关联的时间线事件和知识图谱概念",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"memoryId": map[string]interface{}{
+						"type":        "string",
+						"description": "要更新的记忆ID",
+					},
+					"content": map[string]interface{}{
+						"type":        "string",
+						"description": "新的记忆内容，不传时保持原内容；与metadata至少提供一个",
+					},
+					"metadata": map[string]interface{}{
+						"type":        "object",
+						"description": "要合并到原元数据的字段，值为null的字段会被删除；不能修改type",
+					},
+				},
+				"required": []string{"sessionId", "memoryId"},
+			},
+		},
+		{
+			"name":        "reanalyze_memory",
+			"description": "对已存储的记忆重新执行LLM分析，把时间线、知识图谱和多向量数据补充写入同一记忆ID，不新建记录；已写入过的存储引擎不会重复写入",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"memoryId": map[string]interface{}{
+						"type":        "string",
+						"description": "要重新分析的记忆ID",
+					},
+				},
+				"required": []string{"sessionId", "memoryId"},
+			},
+		},
+		{
+			"name":        "query_by_metadata",
+			"description": "按metadata键值和键存在性精确查询当前用户的记忆，多个条件同时满足；键可用点号访问嵌套字段（含以JSON字符串存储的嵌套对象）。用户范围在向量存储服务端过滤，metadata条件在扫描结果上过滤",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"metadata": map[string]interface{}{
+						"type":        "object",
+						"description": "键值相等条件，值为字符串、数字或bool；记录中的值为数组时包含该值即满足，如{\"team\": \"infra\", \"source.project\": \"OPS\"}",
+					},
+					"exists": map[string]interface{}{
+						"type":        "array",
+						"description": "必须存在的metadata键列表",
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "返回数量，默认20，最大100",
+					},
+					"includeArchived": map[string]interface{}{
+						"type":        "boolean",
+						"description": "是否包含已归档的记忆，默认false",
+					},
+				},
+				"required": []string{"sessionId"},
+			},
+		},
+		{
+			"name":        "list_memories",
+			"description": "按类型、优先级过滤并排序浏览会话中已存储的记忆，返回分页结果和匹配总数",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"type": map[string]interface{}{
+						"type":        "string",
+						"description": "记忆类型，可选: long_term_memory, todo, conversation_summary，默认全部",
+					},
+					"priority": map[string]interface{}{
+						"type":        "string",
+						"description": "优先级，可选: P0, P1, P2, P3，默认全部",
+					},
+					"sortBy": map[string]interface{}{
+						"type":        "string",
+						"description": "排序方式: timestamp(默认，新的在前), priority(高优先级在前)",
+					},
+					"limit": map[string]interface{}{
+						"type":        "number",
+						"description": "每页返回数量，默认20，最大100",
+					},
+					"offset": map[string]interface{}{
+						"type":        "number",
+						"description": "分页偏移量，默认0",
+					},
+					"includeArchived": map[string]interface{}{
+						"type":        "boolean",
+						"description": "同时列出已归档的记忆（列表项带archived标记），默认false",
+					},
+				},
+				"required": []string{"sessionId"},
+			},
+		},
+		{
+			"name":        "session_stats",
+			"description": "获取会话统计：记忆按类型/优先级/存储引擎(timeline/knowledge_graph/vector)的分布、估算token数、消息数和最近活动时间；只统计当前用户的记录",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+				},
+				"required": []string{"sessionId"},
+			},
+		},
+		{
+			"name":        "get_conversation",
+			"description": "按时间顺序返回会话或批次的完整对话记录（角色、内容、时间戳），拆分批次({batchId}-N)合并为一份记录",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"batchId": map[string]interface{}{
+						"type":        "string",
+						"description": "store_conversation返回的批次ID，可选，不传时返回整个会话的对话",
+					},
+					"includeArchived": map[string]interface{}{
+						"type":        "boolean",
+						"description": "从向量存储还原对话时同时返回已归档的批次，默认false",
+					},
+				},
+				"required": []string{"sessionId"},
+			},
+		},
+		{
+			"name":        "list_workspaces",
+			"description": "列出用户会话涉及的工作空间（名称、哈希、最近活跃时间、当前活跃会话），供客户端选择工作空间",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"userId": map[string]interface{}{
+						"type":        "string",
+						"description": "用户ID，必需参数",
+					},
+				},
+				"required": []string{"userId"},
+			},
+		},
+		{
+			"name":        "get_store_status",
+			"description": "查询异步memorize_context任务的状态(queued/processing/done/failed)，完成后返回记忆ID和分析结果",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "提交任务时使用的会话ID",
+					},
+					"jobId": map[string]interface{}{
+						"type":        "string",
+						"description": "memorize_context异步调用返回的任务ID",
+					},
+				},
+				"required": []string{"sessionId", "jobId"},
+			},
+		},
+		{
+			"name":        "export_session",
+			"description": "导出会话的元数据、消息、代码上下文、编辑历史及关联的长期记忆，用于备份或迁移到其他设备",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "要导出的会话ID",
+					},
+				},
+				"required": []string{"sessionId"},
+			},
+		},
+		{
+			"name":        "import_session",
+			"description": "将export_session导出的数据恢复到当前用户名下，缺失的长期记忆会重新生成向量",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+					"data": map[string]interface{}{
+						"type":        "string",
+						"description": "export_session返回的JSON数据",
+					},
+					"targetSessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "导入后的会话ID，可选，默认使用导出数据中的会话ID",
+					},
+					"force": map[string]interface{}{
+						"type":        "boolean",
+						"description": "目标会话已存在时是否覆盖，默认false",
+					},
+				},
+				"required": []string{"sessionId", "data"},
+			},
+		},
+		{
+			"name":        "merge_sessions",
+			"description": "将源会话的消息、代码上下文、编辑历史和长期记忆并入目标会话，并归档源会话。两个会话必须属于同一用户",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"targetSessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "合并后保留的目标会话ID",
+					},
+					"sourceSessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "被并入并归档的源会话ID",
+					},
+				},
+				"required": []string{"targetSessionId", "sourceSessionId"},
+			},
+		},
+		{
+			"name":        "link_sessions",
+			"description": "在两个会话之间建立带类型的关联（continues/related/forked-from），双向记录并在programming_context的关联会话中返回。两个会话必须属于同一用户，不能重复关联",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sourceSessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "源会话ID",
+					},
+					"targetSessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "目标会话ID",
+					},
+					"relationship": map[string]interface{}{
+						"type":        "string",
+						"description": "从源会话看目标会话的关系: continues（源会话延续目标会话）, related（默认）, forked-from（源会话从目标会话分出）",
+					},
+					"description": map[string]interface{}{
+						"type":        "string",
+						"description": "关联说明，可选",
+					},
+					"topics": map[string]interface{}{
+						"type":        "array",
+						"description": "关联涉及的主题，可选",
+					},
+				},
+				"required": []string{"sourceSessionId", "targetSessionId"},
+			},
+		},
+		{
+			"name":        "get_pending_instructions",
+			"description": "获取通过WebSocket推送但尚未确认的本地指令，用于补拉断线期间错过的指令；执行后通过回调确认",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"sessionId": map[string]interface{}{
+						"type":        "string",
+						"description": "当前会话ID",
+					},
+				},
+				"required": []string{"sessionId"},
+			},
+		},
 		{
 			"name":        "user_init_dialog",
 			"description": "用户初始化对话处理",
@@ -32,6 +32,13 @@ type Config struct {
 	EmbeddingAPIURL string
 	EmbeddingAPIKey string
 
+	// 嵌入服务提供商: aliyun（默认）, openai（OpenAI兼容协议，含Azure OpenAI和本地服务）
+	EmbeddingProvider         string
+	OpenAIEmbeddingBaseURL    string
+	OpenAIEmbeddingAPIKey     string
+	OpenAIEmbeddingModel      string
+	OpenAIEmbeddingAPIVersion string // Azure OpenAI的api-version，非Azure留空
+
 	// 🔥 新增：批量embedding配置
 	BatchEmbeddingAPIURL    string        // 批量embedding API端点
 	BatchEmbeddingAPIKey    string        // 批量embedding API密钥
@@ -46,6 +53,81 @@ type Config struct {
 	VectorDBDimension   int
 	VectorDBMetric      string
 	SimilarityThreshold float64
+	HybridSearchAlpha   float64 // 混合检索中向量得分的权重(0-1]，其余为关键词得分权重
+	PriorityBoostWeight float64 // priorityBoost检索中优先级得分的权重(0-0.5]，其余为相似度权重
+	RecencyBoostWeight  float64 // recencyBoost检索中时间衰减得分的权重(0-0.5]，其余为相似度权重
+	RecencyHalfLife     float64 // recencyBoost时间衰减的半衰期（小时）
+
+	// 存储优先级推断（memorize_context未指定priority时生效）
+	DefaultMemoryPriority  string  // 默认优先级(P0-P3)
+	PriorityInferenceRules string  // 逗号分隔的event_type=优先级规则，如decision=P1
+	PriorityHighConfidence float64 // 置信度达到该值时比默认优先级高一级，<=0表示不启用
+	PriorityLowConfidence  float64 // 置信度低于该值时比默认优先级低一级，<=0表示不启用
+
+	// 向量缓存配置
+	EmbeddingCacheSize int           // 向量缓存最大条目数，<=0表示禁用
+	EmbeddingCacheTTL  time.Duration // 向量缓存过期时间，<=0表示不过期
+	EmbeddingBatchSize int           // 存储多条消息时单次嵌入请求的最大文本数，<=1表示逐条生成
+	EmbeddingTimeout   time.Duration // 单次嵌入请求的超时时间，独立于LLM超时，<=0表示不限制
+	EmbeddingNormalize bool          // 是否对嵌入向量做L2归一化，存储向量和查询向量一致处理
+
+	// 向量存储写入重试配置（仅对网络超时、5xx等瞬时错误重试）
+	StoreRetryMaxAttempts int           // 最大尝试次数（含首次），<=1表示不重试
+	StoreRetryBaseDelay   time.Duration // 首次重试前的等待时间，之后按指数增长
+	StoreRetryMaxDelay    time.Duration // 单次等待时间上限
+	StoreRetryJitter      float64       // 等待时间的随机抖动比例(0-1)
+
+	// 重要记忆存储完成后的出站Webhook，URL为空表示不启用
+	StoreWebhookURL           string        // 接收通知的地址
+	StoreWebhookSecret        string        // HMAC-SHA256签名密钥，为空时不签名
+	StoreWebhookMinImportance float64       // 重要性/置信度达到该值时通知
+	StoreWebhookEventTypes    string        // 逗号分隔的事件类型，命中任一类型时通知
+	StoreWebhookMaxAttempts   int           // 最大投递次数（含首次），<=1表示不重试
+	StoreWebhookTimeout       time.Duration // 单次投递的超时时间
+
+	// 智能存储并行写入各存储引擎的超时时间，<=0表示只受请求上下文控制
+	SmartStorageTimeout time.Duration
+
+	// LLM驱动配置(config/llm_driven.yaml)自动重载的检查间隔，<=0表示不自动重载
+	LLMDrivenConfigReloadInterval time.Duration
+
+	// 异步存储任务配置
+	StoreJobWorkers   int           // 后台处理异步存储任务的worker数，<=0表示不启用异步存储
+	StoreJobQueueSize int           // 排队任务上限，队列满时拒绝新任务
+	StoreJobResultTTL time.Duration // 已完成任务结果的保留时间，过期后清理
+
+	// 存储去重配置（请求开启dedup时生效）
+	StoreDedupThreshold float64 // 与同会话已有记忆的相似度达到该值时视为重复，跳过写入
+
+	// 幂等键配置（请求携带idempotencyKey时生效）
+	IdempotencyKeyTTL time.Duration // 幂等键的保留时间，窗口内重复请求直接返回首次结果，<=0表示不启用
+
+	// 超长内容分块存储配置
+	StoreChunkMaxChars int // 内容超过该字符数时分块存储，<=0表示不分块
+	StoreChunkOverlap  int // 相邻分块重叠的字符数
+
+	// 过短内容跳过长期存储配置（默认关闭）
+	StoreMinContentChars int // 内容少于该字符数时不写入长期记忆，<=0表示不限制
+	StoreMinContentWords int // 内容少于该词数时不写入长期记忆（中日韩字符每字计一词），<=0表示不限制
+
+	// 记忆重建向量配置（切换embedding模型后使用）
+	ReindexBatchSize int // 每批重新生成向量的记录数，每批完成后保存进度
+
+	// 知识图谱重建配置（从已有记忆回填Neo4j）
+	KGRebuildExtraction string // 实体抽取方式: rule（规则匹配，默认）, llm（按存储链路的LLM分析）
+
+	// MCP工具调用限流配置（按用户的令牌桶）
+	RateLimitEnabled       bool   // 是否启用限流，默认关闭
+	RateLimitUserPerMinute int    // 每个用户所有工具调用的每分钟额度，<=0表示不限制
+	RateLimitBurst         int    // 允许的瞬时突发调用数，<=0表示与每分钟额度相同
+	RateLimitToolLimits    string // 单个工具的每用户每分钟额度，格式 tool=次数，逗号分隔
+	RateLimitUserOverrides string // 指定用户的每分钟总额度，格式 userId=次数，逗号分隔，<=0表示不限制
+
+	// 管理员令牌，清除用户数据等管理接口需要在请求头中携带，为空时这些接口禁用
+	AdminToken string
+
+	// 关联代码文件时推断语言的扩展名映射，格式 .ext=language，逗号分隔，追加或覆盖默认映射
+	CodeLanguageExtensions string
 
 	// 服务器端口配置
 	HTTPServerPort      string // HTTP服务端口
@@ -56,12 +138,20 @@ type Config struct {
 	SessionTimeout    time.Duration // 会话超时时间，默认30分钟
 	CleanupInterval   time.Duration // 清理检查间隔，默认10分钟
 	ShortMemoryMaxAge int           // 短期记忆保留天数，默认2天
+	CleanupDryRun     bool          // 清理演练模式：只记录将被清理的会话和消息，不实际删除
+
+	// 记忆保留策略，格式 type=期限，逗号分隔，期限支持天数(90d)或时长(720h)；未列出或期限为infinite的类型永久保留
+	MemoryRetentionPolicies string
+	MemoryRetentionInterval time.Duration // 按保留策略清理过期记忆的间隔，<=0表示不启用
 
 	// 自动汇总相关
 	SummaryIntervalMultiplier int // 自动汇总间隔倍数（相对于清理间隔），默认5倍
 	MinMessageCount           int // 最小消息数阈值，少于此数量不汇总，默认20
 	MinTimeSinceLastSummary   int // 距离上次汇总的最小小时数，默认24小时
 	MaxMessageCount           int // 触发汇总的消息数阈值，默认100
+	SummaryTokenThreshold     int // 触发汇总的未汇总内容累计token数阈值，少量长消息也能触发汇总，<=0表示不启用，默认8000
+	SessionMaxMessages        int // 单个会话保留的最大消息数，超出部分汇总为长期记忆后移出会话，<=0表示不限制
+	SummaryConcurrency        int // 自动汇总时并发处理的会话数，同时受LLM_MAX_CONCURRENCY限制，<=1表示逐个处理
 
 	// 多维度存储配置
 	EnableMultiDimensionalStorage bool   `json:"enable_multi_dimensional_storage"` // 多维度存储总开关
@@ -70,6 +160,35 @@ type Config struct {
 	MultiDimVectorEnabled         bool   `json:"multi_dim_vector_enabled"`         // 增强向量存储开关
 	MultiDimLLMProvider           string `json:"multi_dim_llm_provider"`           // LLM提供商
 	MultiDimLLMModel              string `json:"multi_dim_llm_model"`              // LLM模型
+
+	// 摘要LLM配置：自动汇总和会话摘要使用的模型，可配置为比分析模型更便宜的模型；未配置时使用关键词启发式摘要
+	SummaryLLMProvider string
+	SummaryLLMModel    string
+
+	// 分析Prompt模板：Go text/template文件路径，留空时使用内置默认模板
+	SmartAnalysisPromptTemplate string // 智能存储分析prompt模板
+	KGPromptTemplate            string // 专门化知识图谱抽取prompt模板
+	AnalysisPromptMaxTokens     int    // 分析prompt的估算token上限，超过时先改用基础prompt再截断用户内容，<=0表示不限制
+
+	// 低置信度实体保留配置：仅记录上下文时仍以规则匹配抽取实体写入知识图谱，不推断关系
+	ContextOnlyEntityExtraction    bool    // 是否启用
+	ContextOnlyEntityMinConfidence float64 // 写入的实体置信度下限(0-1)
+
+	// 知识图谱关系清理配置：强度低于阈值且被重复写入次数不足的关系在超过最短保留时间后删除
+	KnowledgeGraphPruneInterval    time.Duration // 清理间隔，<=0表示不启用
+	KnowledgeGraphPruneMinStrength float64       // 关系强度阈值(0-1)
+	KnowledgeGraphPruneMinWeight   int           // 关系被重复写入的次数阈值
+	KnowledgeGraphPruneMinAge      time.Duration // 关系最近一次写入后的最短保留时间
+
+	// LLM用量统计与并发配置
+	LLMTokenPricing   string // 每1K token价格，格式 provider=输入价格/输出价格，逗号分隔
+	LLMMaxConcurrency int    // 所有LLM调用共享的最大并发数，<=0表示不限制
+
+	// LLM降级链配置：主提供商瞬时故障时按顺序尝试的备用提供商，格式 provider[:model]，逗号分隔
+	LLMFallbackProviders string
+
+	// 编程上下文配置
+	ProgrammingContextTimeline bool // programming_context默认合并TimescaleDB时间线事件
 }
 
 // Load 从环境变量加载配置
@@ -106,7 +225,7 @@ func Load() *Config {
 		GinMode:     getEnv("GIN_MODE", "release"),
 
 		// 向量存储配置
-		VectorStoreType: getEnv("VECTOR_STORE_TYPE", "aliyun"),
+		VectorStoreType: getEnv("VECTOR_STORE_TYPE", getEnv("VECTOR_STORE_PROVIDER", "aliyun")),
 
 		// 用户存储配置
 		UserRepositoryType: getEnv("USER_REPOSITORY_TYPE", "aliyun"),
@@ -115,6 +234,13 @@ func Load() *Config {
 		EmbeddingAPIURL: getEnv("EMBEDDING_API_URL", "https://dashscope.aliyuncs.com/compatible-mode/v1/embeddings"),
 		EmbeddingAPIKey: getEnv("EMBEDDING_API_KEY", "sk-25be9b8a195145fb994f1d9b6ac26c82"),
 
+		// 嵌入服务提供商配置
+		EmbeddingProvider:         getEnv("EMBEDDING_PROVIDER", "aliyun"),
+		OpenAIEmbeddingBaseURL:    getEnv("OPENAI_EMBEDDING_BASE_URL", "https://api.openai.com/v1"),
+		OpenAIEmbeddingAPIKey:     getEnv("OPENAI_EMBEDDING_API_KEY", ""),
+		OpenAIEmbeddingModel:      getEnv("OPENAI_EMBEDDING_MODEL", "text-embedding-3-small"),
+		OpenAIEmbeddingAPIVersion: getEnv("OPENAI_EMBEDDING_API_VERSION", ""),
+
 		// 🔥 新增：批量embedding配置
 		BatchEmbeddingAPIURL:    getEnv("BATCH_EMBEDDING_API_URL", "https://dashscope.aliyuncs.com/api/v1/services/embeddings/text-embedding/text-embedding"),
 		BatchEmbeddingAPIKey:    getEnv("BATCH_EMBEDDING_API_KEY", getEnv("EMBEDDING_API_KEY", "sk-25be9b8a195145fb994f1d9b6ac26c82")), // 默认使用单一embedding的API密钥
@@ -129,6 +255,79 @@ func Load() *Config {
 		VectorDBDimension:   getEnvAsInt("VECTOR_DB_DIMENSION", 1536),
 		VectorDBMetric:      getEnv("VECTOR_DB_METRIC", "cosine"),
 		SimilarityThreshold: getEnvAsFloat("SIMILARITY_THRESHOLD", 0.3),
+		HybridSearchAlpha:   getEnvAsFloat("HYBRID_SEARCH_ALPHA", 0.7),
+		PriorityBoostWeight: getEnvAsFloat("PRIORITY_BOOST_WEIGHT", 0.2),
+		RecencyBoostWeight:  getEnvAsFloat("RECENCY_BOOST_WEIGHT", 0.2),
+		RecencyHalfLife:     getEnvAsFloat("RECENCY_HALF_LIFE_HOURS", 168),
+
+		// 存储优先级推断配置
+		DefaultMemoryPriority:  getEnv("DEFAULT_MEMORY_PRIORITY", "P2"),
+		PriorityInferenceRules: getEnv("PRIORITY_INFERENCE_RULES", "decision=P1,problem_solve=P1"),
+		PriorityHighConfidence: getEnvAsFloat("PRIORITY_HIGH_CONFIDENCE", 0.9),
+		PriorityLowConfidence:  getEnvAsFloat("PRIORITY_LOW_CONFIDENCE", 0.3),
+
+		// 向量缓存配置
+		EmbeddingCacheSize: getEnvAsInt("EMBEDDING_CACHE_SIZE", 1000),
+		EmbeddingCacheTTL:  getEnvAsDuration("EMBEDDING_CACHE_TTL", time.Hour),
+		EmbeddingBatchSize: getEnvAsInt("EMBEDDING_BATCH_SIZE", 10),
+		EmbeddingTimeout:   getEnvAsDuration("EMBEDDING_TIMEOUT", 15*time.Second),
+		EmbeddingNormalize: getEnvAsBool("EMBEDDING_NORMALIZE", false),
+
+		// 向量存储写入重试配置
+		StoreRetryMaxAttempts: getEnvAsInt("STORE_RETRY_MAX_ATTEMPTS", 3),
+		StoreRetryBaseDelay:   getEnvAsDuration("STORE_RETRY_BASE_DELAY", 200*time.Millisecond),
+		StoreRetryMaxDelay:    getEnvAsDuration("STORE_RETRY_MAX_DELAY", 2*time.Second),
+		StoreRetryJitter:      getEnvAsFloat("STORE_RETRY_JITTER", 0.2),
+
+		// 重要记忆出站Webhook配置
+		StoreWebhookURL:           getEnv("STORE_WEBHOOK_URL", ""),
+		StoreWebhookSecret:        getEnv("STORE_WEBHOOK_SECRET", ""),
+		StoreWebhookMinImportance: getEnvAsFloat("STORE_WEBHOOK_MIN_IMPORTANCE", 0.8),
+		StoreWebhookEventTypes:    getEnv("STORE_WEBHOOK_EVENT_TYPES", "decision,deployment,problem_solve"),
+		StoreWebhookMaxAttempts:   getEnvAsInt("STORE_WEBHOOK_MAX_ATTEMPTS", 3),
+		StoreWebhookTimeout:       getEnvAsDuration("STORE_WEBHOOK_TIMEOUT", 5*time.Second),
+
+		SmartStorageTimeout: getEnvAsDuration("SMART_STORAGE_TIMEOUT", 30*time.Second),
+
+		LLMDrivenConfigReloadInterval: getEnvAsDuration("LLM_DRIVEN_CONFIG_RELOAD_INTERVAL", 30*time.Second),
+
+		// 异步存储任务配置
+		StoreJobWorkers:   getEnvAsInt("STORE_JOB_WORKERS", 2),
+		StoreJobQueueSize: getEnvAsInt("STORE_JOB_QUEUE_SIZE", 100),
+		StoreJobResultTTL: getEnvAsDuration("STORE_JOB_RESULT_TTL", time.Hour),
+
+		// 存储去重配置
+		StoreDedupThreshold: getEnvAsFloat("STORE_DEDUP_THRESHOLD", 0.97),
+
+		// 幂等键配置
+		IdempotencyKeyTTL: getEnvAsDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+
+		// 超长内容分块存储配置
+		StoreChunkMaxChars: getEnvAsInt("STORE_CHUNK_MAX_CHARS", 4000),
+		StoreChunkOverlap:  getEnvAsInt("STORE_CHUNK_OVERLAP", 200),
+
+		// 过短内容跳过长期存储配置
+		StoreMinContentChars: getEnvAsInt("STORE_MIN_CONTENT_CHARS", 0),
+		StoreMinContentWords: getEnvAsInt("STORE_MIN_CONTENT_WORDS", 0),
+
+		// 记忆重建向量配置
+		ReindexBatchSize: getEnvAsInt("REINDEX_BATCH_SIZE", 50),
+
+		// 知识图谱重建配置
+		KGRebuildExtraction: getEnv("KG_REBUILD_EXTRACTION", "rule"),
+
+		// MCP工具调用限流配置
+		RateLimitEnabled:       getEnvAsBool("RATE_LIMIT_ENABLED", false),
+		RateLimitUserPerMinute: getEnvAsInt("RATE_LIMIT_USER_PER_MINUTE", 120),
+		RateLimitBurst:         getEnvAsInt("RATE_LIMIT_BURST", 20),
+		RateLimitToolLimits:    getEnv("RATE_LIMIT_TOOL_LIMITS", "store_conversation=30,batch_store_conversation=10"),
+		RateLimitUserOverrides: getEnv("RATE_LIMIT_USER_OVERRIDES", ""),
+
+		// 管理员令牌
+		AdminToken: getEnv("ADMIN_TOKEN", ""),
+
+		// 代码语言推断
+		CodeLanguageExtensions: getEnv("CODE_LANGUAGE_EXTENSIONS", ""),
 
 		// 服务器端口配置
 		HTTPServerPort:      getEnv("HTTP_SERVER_PORT", "8088"),
@@ -139,12 +338,20 @@ func Load() *Config {
 		SessionTimeout:    getEnvAsDuration("SESSION_TIMEOUT", 30*time.Minute),
 		CleanupInterval:   getEnvAsDuration("CLEANUP_INTERVAL", 10*time.Minute),
 		ShortMemoryMaxAge: getEnvAsInt("SHORT_MEMORY_MAX_AGE", 2),
+		CleanupDryRun:     getEnvAsBool("CLEANUP_DRY_RUN", false),
+
+		// 记忆保留策略
+		MemoryRetentionPolicies: getEnv("MEMORY_RETENTION_POLICIES", ""),
+		MemoryRetentionInterval: getEnvAsDuration("MEMORY_RETENTION_INTERVAL", 24*time.Hour),
 
 		// 自动汇总相关
 		SummaryIntervalMultiplier: getEnvAsInt("SUMMARY_INTERVAL_MULTIPLIER", 5),
 		MinMessageCount:           getEnvAsInt("MIN_MESSAGE_COUNT", 20),
 		MinTimeSinceLastSummary:   getEnvAsInt("MIN_TIME_SINCE_LAST_SUMMARY", 24),
 		MaxMessageCount:           getEnvAsInt("MAX_MESSAGE_COUNT", 100),
+		SummaryTokenThreshold:     getEnvAsInt("SUMMARY_TOKEN_THRESHOLD", 8000),
+		SessionMaxMessages:        getEnvAsInt("SESSION_MAX_MESSAGES", 0),
+		SummaryConcurrency:        getEnvAsInt("SUMMARY_CONCURRENCY", 4),
 
 		// 多维度存储配置
 		EnableMultiDimensionalStorage: getEnvAsBool("ENABLE_MULTI_DIMENSIONAL_STORAGE", false), // 默认关闭
@@ -153,6 +360,35 @@ func Load() *Config {
 		MultiDimVectorEnabled:         getEnvAsBool("MULTI_DIM_VECTOR_ENABLED", true), // 向量存储默认启用
 		MultiDimLLMProvider:           getEnv("MULTI_DIM_LLM_PROVIDER", "deepseek"),
 		MultiDimLLMModel:              getEnv("MULTI_DIM_LLM_MODEL", "deepseek-chat"),
+
+		// 摘要LLM配置
+		SummaryLLMProvider: getEnv("SUMMARY_LLM_PROVIDER", ""),
+		SummaryLLMModel:    getEnv("SUMMARY_LLM_MODEL", ""),
+
+		// 分析Prompt模板
+		SmartAnalysisPromptTemplate: getEnv("SMART_ANALYSIS_PROMPT_TEMPLATE", ""),
+		KGPromptTemplate:            getEnv("KG_PROMPT_TEMPLATE", ""),
+		AnalysisPromptMaxTokens:     getEnvAsInt("ANALYSIS_PROMPT_MAX_TOKENS", 24000),
+
+		// 低置信度实体保留配置
+		ContextOnlyEntityExtraction:    getEnvAsBool("CONTEXT_ONLY_ENTITY_EXTRACTION", false),
+		ContextOnlyEntityMinConfidence: getEnvAsFloat("CONTEXT_ONLY_ENTITY_MIN_CONFIDENCE", 0.8),
+
+		// 知识图谱关系清理配置
+		KnowledgeGraphPruneInterval:    getEnvAsDuration("KG_PRUNE_INTERVAL", 0),
+		KnowledgeGraphPruneMinStrength: getEnvAsFloat("KG_PRUNE_MIN_STRENGTH", 0.5),
+		KnowledgeGraphPruneMinWeight:   getEnvAsInt("KG_PRUNE_MIN_WEIGHT", 2),
+		KnowledgeGraphPruneMinAge:      getEnvAsDuration("KG_PRUNE_MIN_AGE", 7*24*time.Hour),
+
+		// LLM用量统计与并发配置
+		LLMTokenPricing:   getEnv("LLM_TOKEN_PRICING", ""),
+		LLMMaxConcurrency: getEnvAsInt("LLM_MAX_CONCURRENCY", 8),
+
+		// LLM降级链配置
+		LLMFallbackProviders: getEnv("LLM_FALLBACK_PROVIDERS", ""),
+
+		// 编程上下文配置
+		ProgrammingContextTimeline: getEnvAsBool("PROGRAMMING_CONTEXT_TIMELINE", false),
 	}
 
 	// 确保存储路径存在
@@ -167,12 +403,12 @@ func Load() *Config {
 func (c *Config) String() string {
 	return fmt.Sprintf(
 		"服务名称: %s, 端口: %d, 调试模式: %v, 存储路径: %s, 向量DB: %s, 嵌入API: %s, "+
-			"会话超时: %v, 清理间隔: %v, 短期记忆保留: %d天, 汇总间隔倍数: %dx, "+
-			"最小消息数: %d, 最大消息数: %d, 汇总间隔: %d小时",
+			"会话超时: %v, 清理间隔: %v, 清理演练: %v, 短期记忆保留: %d天, 汇总间隔倍数: %dx, "+
+			"最小消息数: %d, 最大消息数: %d, 汇总token阈值: %d, 汇总间隔: %d小时",
 		c.ServiceName, c.Port, c.Debug, c.StoragePath,
 		maskString(c.VectorDBURL), maskString(c.EmbeddingAPIURL),
-		c.SessionTimeout, c.CleanupInterval, c.ShortMemoryMaxAge, c.SummaryIntervalMultiplier,
-		c.MinMessageCount, c.MaxMessageCount, c.MinTimeSinceLastSummary,
+		c.SessionTimeout, c.CleanupInterval, c.CleanupDryRun, c.ShortMemoryMaxAge, c.SummaryIntervalMultiplier,
+		c.MinMessageCount, c.MaxMessageCount, c.SummaryTokenThreshold, c.MinTimeSinceLastSummary,
 	)
 }
 
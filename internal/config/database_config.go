@@ -53,188 +53,202 @@ type VectorConfig struct {
 }
 
 // LoadDatabaseConfig 加载数据库配置
+// 任一已启用引擎的配置不完整时返回错误；只需要单个引擎时使用LoadTimescaleDBConfig或LoadNeo4jConfig，互不影响
 func LoadDatabaseConfig() (*DatabaseConfig, error) {
-	// 加载.env文件（必须存在）
-	if err := godotenv.Load("config/.env"); err != nil {
-		return nil, fmt.Errorf("❌ 配置文件 config/.env 不存在或加载失败: %w", err)
+	timescaleConfig, err := LoadTimescaleDBConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	// 辅助函数：从环境变量获取必需的字符串值
-	getRequiredEnv := func(key string) (string, error) {
-		if value := os.Getenv(key); value != "" {
-			return value, nil
-		}
-		return "", fmt.Errorf("❌ 必需的环境变量 %s 未设置或为空", key)
+	neo4jConfig, err := LoadNeo4jConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	// 辅助函数：从环境变量获取可选的字符串值
-	getOptionalEnv := func(key string) string {
-		return os.Getenv(key)
+	// 加载向量存储配置
+	vectorEnabled, err := requiredBoolEnv("MULTI_DIM_VECTOR_ENABLED")
+	if err != nil {
+		return nil, err
 	}
 
-	// 辅助函数：从环境变量获取布尔值
-	getRequiredBoolEnv := func(key string) (bool, error) {
-		value := os.Getenv(key)
-		if value == "" {
-			return false, fmt.Errorf("❌ 必需的环境变量 %s 未设置", key)
-		}
-		return getEnvAsBool(key, false), nil
+	vectorType, err := requiredEnv("VECTOR_STORE_TYPE")
+	if err != nil {
+		return nil, err
 	}
 
-	// 辅助函数：从环境变量获取整数值
-	getRequiredIntEnv := func(key string) (int, error) {
-		value := os.Getenv(key)
-		if value == "" {
-			return 0, fmt.Errorf("❌ 必需的环境变量 %s 未设置", key)
-		}
-		return getEnvAsInt(key, 0), nil
+	config := &DatabaseConfig{
+		TimescaleDB: *timescaleConfig,
+		Neo4j:       *neo4jConfig,
+		Vector: VectorConfig{
+			Enabled: vectorEnabled,
+			Type:    vectorType,
+		},
 	}
 
-	// 辅助函数：从环境变量获取时间间隔值
-	getRequiredDurationEnv := func(key string) (time.Duration, error) {
-		value := os.Getenv(key)
-		if value == "" {
-			return 0, fmt.Errorf("❌ 必需的环境变量 %s 未设置", key)
-		}
-		return getEnvAsDuration(key, 0), nil
+	return config, nil
+}
+
+// LoadTimescaleDBConfig 加载TimescaleDB配置，未启用时返回Enabled=false的配置
+func LoadTimescaleDBConfig() (*TimescaleDBConfig, error) {
+	if err := loadDatabaseEnv(); err != nil {
+		return nil, err
 	}
 
-	// 加载TimescaleDB配置
-	timelineEnabled, err := getRequiredBoolEnv("TIMELINE_STORAGE_ENABLED")
+	timelineEnabled, err := requiredBoolEnv("TIMELINE_STORAGE_ENABLED")
 	if err != nil {
 		return nil, err
 	}
+	if !timelineEnabled {
+		return &TimescaleDBConfig{Enabled: false}, nil
+	}
 
-	var timescaleConfig TimescaleDBConfig
-	if timelineEnabled {
-		host, err := getRequiredEnv("TIMESCALEDB_HOST")
-		if err != nil {
-			return nil, err
-		}
-
-		port, err := getRequiredIntEnv("TIMESCALEDB_PORT")
-		if err != nil {
-			return nil, err
-		}
-
-		database, err := getRequiredEnv("TIMESCALEDB_DATABASE")
-		if err != nil {
-			return nil, err
-		}
+	host, err := requiredEnv("TIMESCALEDB_HOST")
+	if err != nil {
+		return nil, err
+	}
 
-		username, err := getRequiredEnv("TIMESCALEDB_USERNAME")
-		if err != nil {
-			return nil, err
-		}
+	port, err := requiredIntEnv("TIMESCALEDB_PORT")
+	if err != nil {
+		return nil, err
+	}
 
-		sslMode, err := getRequiredEnv("TIMESCALEDB_SSL_MODE")
-		if err != nil {
-			return nil, err
-		}
+	database, err := requiredEnv("TIMESCALEDB_DATABASE")
+	if err != nil {
+		return nil, err
+	}
 
-		maxConns, err := getRequiredIntEnv("TIMESCALEDB_MAX_CONNS")
-		if err != nil {
-			return nil, err
-		}
+	username, err := requiredEnv("TIMESCALEDB_USERNAME")
+	if err != nil {
+		return nil, err
+	}
 
-		maxIdleTime, err := getRequiredDurationEnv("TIMESCALEDB_MAX_IDLE_TIME")
-		if err != nil {
-			return nil, err
-		}
+	sslMode, err := requiredEnv("TIMESCALEDB_SSL_MODE")
+	if err != nil {
+		return nil, err
+	}
 
-		timescaleConfig = TimescaleDBConfig{
-			Enabled:     timelineEnabled,
-			Host:        host,
-			Port:        port,
-			Database:    database,
-			Username:    username,
-			Password:    getOptionalEnv("TIMESCALEDB_PASSWORD"), // 密码可以为空
-			SSLMode:     sslMode,
-			MaxConns:    maxConns,
-			MaxIdleTime: maxIdleTime,
-		}
-	} else {
-		timescaleConfig = TimescaleDBConfig{Enabled: false}
+	maxConns, err := requiredIntEnv("TIMESCALEDB_MAX_CONNS")
+	if err != nil {
+		return nil, err
 	}
 
-	// 加载Neo4j配置
-	knowledgeEnabled, err := getRequiredBoolEnv("KNOWLEDGE_GRAPH_ENABLED")
+	maxIdleTime, err := requiredDurationEnv("TIMESCALEDB_MAX_IDLE_TIME")
 	if err != nil {
 		return nil, err
 	}
 
-	var neo4jConfig Neo4jConfig
-	if knowledgeEnabled {
-		uri, err := getRequiredEnv("NEO4J_URI")
-		if err != nil {
-			return nil, err
-		}
+	return &TimescaleDBConfig{
+		Enabled:     timelineEnabled,
+		Host:        host,
+		Port:        port,
+		Database:    database,
+		Username:    username,
+		Password:    os.Getenv("TIMESCALEDB_PASSWORD"), // 密码可以为空
+		SSLMode:     sslMode,
+		MaxConns:    maxConns,
+		MaxIdleTime: maxIdleTime,
+	}, nil
+}
 
-		username, err := getRequiredEnv("NEO4J_USERNAME")
-		if err != nil {
-			return nil, err
-		}
+// LoadNeo4jConfig 加载Neo4j配置，未启用时返回Enabled=false的配置
+func LoadNeo4jConfig() (*Neo4jConfig, error) {
+	if err := loadDatabaseEnv(); err != nil {
+		return nil, err
+	}
 
-		password, err := getRequiredEnv("NEO4J_PASSWORD")
-		if err != nil {
-			return nil, err
-		}
+	knowledgeEnabled, err := requiredBoolEnv("KNOWLEDGE_GRAPH_ENABLED")
+	if err != nil {
+		return nil, err
+	}
+	if !knowledgeEnabled {
+		return &Neo4jConfig{Enabled: false}, nil
+	}
 
-		database, err := getRequiredEnv("NEO4J_DATABASE")
-		if err != nil {
-			return nil, err
-		}
+	uri, err := requiredEnv("NEO4J_URI")
+	if err != nil {
+		return nil, err
+	}
 
-		maxPoolSize, err := getRequiredIntEnv("NEO4J_MAX_CONNECTION_POOL_SIZE")
-		if err != nil {
-			return nil, err
-		}
+	username, err := requiredEnv("NEO4J_USERNAME")
+	if err != nil {
+		return nil, err
+	}
 
-		connTimeout, err := getRequiredDurationEnv("NEO4J_CONNECTION_TIMEOUT")
-		if err != nil {
-			return nil, err
-		}
+	password, err := requiredEnv("NEO4J_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
 
-		retryTime, err := getRequiredDurationEnv("NEO4J_MAX_TRANSACTION_RETRY_TIME")
-		if err != nil {
-			return nil, err
-		}
+	database, err := requiredEnv("NEO4J_DATABASE")
+	if err != nil {
+		return nil, err
+	}
 
-		neo4jConfig = Neo4jConfig{
-			Enabled:                 knowledgeEnabled,
-			URI:                     uri,
-			Username:                username,
-			Password:                password,
-			Database:                database,
-			MaxConnectionPoolSize:   maxPoolSize,
-			ConnectionTimeout:       connTimeout,
-			MaxTransactionRetryTime: retryTime,
-		}
-	} else {
-		neo4jConfig = Neo4jConfig{Enabled: false}
+	maxPoolSize, err := requiredIntEnv("NEO4J_MAX_CONNECTION_POOL_SIZE")
+	if err != nil {
+		return nil, err
 	}
 
-	// 加载向量存储配置
-	vectorEnabled, err := getRequiredBoolEnv("MULTI_DIM_VECTOR_ENABLED")
+	connTimeout, err := requiredDurationEnv("NEO4J_CONNECTION_TIMEOUT")
 	if err != nil {
 		return nil, err
 	}
 
-	vectorType, err := getRequiredEnv("VECTOR_STORE_TYPE")
+	retryTime, err := requiredDurationEnv("NEO4J_MAX_TRANSACTION_RETRY_TIME")
 	if err != nil {
 		return nil, err
 	}
 
-	config := &DatabaseConfig{
-		TimescaleDB: timescaleConfig,
-		Neo4j:       neo4jConfig,
-		Vector: VectorConfig{
-			Enabled: vectorEnabled,
-			Type:    vectorType,
-		},
+	return &Neo4jConfig{
+		Enabled:                 knowledgeEnabled,
+		URI:                     uri,
+		Username:                username,
+		Password:                password,
+		Database:                database,
+		MaxConnectionPoolSize:   maxPoolSize,
+		ConnectionTimeout:       connTimeout,
+		MaxTransactionRetryTime: retryTime,
+	}, nil
+}
+
+// loadDatabaseEnv 加载.env文件（必须存在）
+func loadDatabaseEnv() error {
+	if err := godotenv.Load("config/.env"); err != nil {
+		return fmt.Errorf("❌ 配置文件 config/.env 不存在或加载失败: %w", err)
 	}
+	return nil
+}
 
-	return config, nil
+// requiredEnv 从环境变量获取必需的字符串值
+func requiredEnv(key string) (string, error) {
+	if value := os.Getenv(key); value != "" {
+		return value, nil
+	}
+	return "", fmt.Errorf("❌ 必需的环境变量 %s 未设置或为空", key)
+}
+
+// requiredBoolEnv 从环境变量获取必需的布尔值
+func requiredBoolEnv(key string) (bool, error) {
+	if os.Getenv(key) == "" {
+		return false, fmt.Errorf("❌ 必需的环境变量 %s 未设置", key)
+	}
+	return getEnvAsBool(key, false), nil
+}
+
+// requiredIntEnv 从环境变量获取必需的整数值
+func requiredIntEnv(key string) (int, error) {
+	if os.Getenv(key) == "" {
+		return 0, fmt.Errorf("❌ 必需的环境变量 %s 未设置", key)
+	}
+	return getEnvAsInt(key, 0), nil
+}
+
+// requiredDurationEnv 从环境变量获取必需的时间间隔值
+func requiredDurationEnv(key string) (time.Duration, error) {
+	if os.Getenv(key) == "" {
+		return 0, fmt.Errorf("❌ 必需的环境变量 %s 未设置", key)
+	}
+	return getEnvAsDuration(key, 0), nil
 }
 
 // 使用config包中已有的辅助函数
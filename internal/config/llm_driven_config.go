@@ -6,14 +6,35 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// 知识图谱抽取模式
+const (
+	KGExtractionModeDisabled          = "disabled"           // 不抽取
+	KGExtractionModeEnhancedPrompt    = "enhanced_prompt"    // 在智能分析prompt中一并抽取
+	KGExtractionModeParallelDedicated = "parallel_dedicated" // 并行发起专用抽取请求
+)
+
+// validKGExtractionModes 支持的知识图谱抽取模式
+var validKGExtractionModes = []string{
+	KGExtractionModeDisabled,
+	KGExtractionModeEnhancedPrompt,
+	KGExtractionModeParallelDedicated,
+}
+
 // LLMDrivenConfigManager LLM驱动配置管理器
 type LLMDrivenConfigManager struct {
 	configPath string
-	config     *LLMDrivenFullConfig
+
+	mu           sync.RWMutex
+	config       *LLMDrivenFullConfig
+	kgModeSource string    // 知识图谱抽取模式的生效来源：环境变量/配置文件/默认值
+	loadedMTime  time.Time // 最近一次加载时配置文件的修改时间，用于自动重载
 }
 
 // LLMDrivenFullConfig 完整的LLM驱动配置
@@ -95,6 +116,11 @@ type LLMDrivenFullConfig struct {
 		CacheTTL              int  `json:"cache_ttl" yaml:"cache_ttl"`
 	} `json:"performance" yaml:"performance"`
 
+	// 知识图谱抽取配置，环境变量KNOWLEDGE_GRAPH_EXTRACTION_MODE优先
+	KnowledgeGraphExtraction struct {
+		Mode string `json:"mode" yaml:"mode"` // disabled, enhanced_prompt, parallel_dedicated
+	} `json:"knowledge_graph_extraction" yaml:"knowledge_graph_extraction"`
+
 	// 监控配置
 	Monitoring struct {
 		MetricsEnabled bool   `json:"metrics_enabled" yaml:"metrics_enabled"`
@@ -110,7 +136,7 @@ func NewLLMDrivenConfigManager(configPath string) *LLMDrivenConfigManager {
 	}
 }
 
-// LoadConfig 加载配置
+// LoadConfig 加载配置，校验失败时保留原有配置
 func (cm *LLMDrivenConfigManager) LoadConfig() (*LLMDrivenFullConfig, error) {
 	// 如果配置文件不存在，创建默认配置
 	if _, err := os.Stat(cm.configPath); os.IsNotExist(err) {
@@ -121,6 +147,10 @@ func (cm *LLMDrivenConfigManager) LoadConfig() (*LLMDrivenFullConfig, error) {
 	}
 
 	// 读取配置文件
+	info, err := os.Stat(cm.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
 	data, err := os.ReadFile(cm.configPath)
 	if err != nil {
 		return nil, fmt.Errorf("读取配置文件失败: %w", err)
@@ -135,11 +165,53 @@ func (cm *LLMDrivenConfigManager) LoadConfig() (*LLMDrivenFullConfig, error) {
 	// 应用环境变量覆盖
 	cm.applyEnvironmentOverrides(config)
 
+	kgModeSource, err := resolveKGExtractionMode(config)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("🕸️ [配置管理] 知识图谱抽取模式: %s（来源: %s）", config.KnowledgeGraphExtraction.Mode, kgModeSource)
+
+	cm.mu.Lock()
 	cm.config = config
+	cm.kgModeSource = kgModeSource
+	cm.loadedMTime = info.ModTime()
+	cm.mu.Unlock()
+
 	log.Printf("✅ [配置管理] LLM驱动配置加载完成，启用状态: %v", config.Enabled)
 	return config, nil
 }
 
+// resolveKGExtractionMode 确定知识图谱抽取模式并校验，返回生效来源
+// 环境变量优先于配置文件，两者都未设置时为disabled
+func resolveKGExtractionMode(config *LLMDrivenFullConfig) (string, error) {
+	source := "配置文件"
+	if val := os.Getenv("KNOWLEDGE_GRAPH_EXTRACTION_MODE"); val != "" {
+		if config.KnowledgeGraphExtraction.Mode != "" && config.KnowledgeGraphExtraction.Mode != val {
+			log.Printf("🔧 [配置管理] 环境变量覆盖 - 知识图谱抽取模式: %s -> %s", config.KnowledgeGraphExtraction.Mode, val)
+		}
+		config.KnowledgeGraphExtraction.Mode = val
+		source = "环境变量"
+	} else if config.KnowledgeGraphExtraction.Mode == "" {
+		config.KnowledgeGraphExtraction.Mode = KGExtractionModeDisabled
+		source = "默认值"
+	}
+
+	if err := validateKGExtractionMode(config.KnowledgeGraphExtraction.Mode); err != nil {
+		return "", fmt.Errorf("%w（来源: %s）", err, source)
+	}
+	return source, nil
+}
+
+// validateKGExtractionMode 校验知识图谱抽取模式
+func validateKGExtractionMode(mode string) error {
+	for _, valid := range validKGExtractionModes {
+		if mode == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("无效的知识图谱抽取模式: %q，可选值: %s", mode, strings.Join(validKGExtractionModes, ", "))
+}
+
 // createDefaultConfig 创建默认配置文件
 func (cm *LLMDrivenConfigManager) createDefaultConfig() error {
 	defaultConfig := &LLMDrivenFullConfig{
@@ -232,6 +304,7 @@ func (cm *LLMDrivenConfigManager) createDefaultConfig() error {
 			AlertEnabled:   false,
 		},
 	}
+	defaultConfig.KnowledgeGraphExtraction.Mode = KGExtractionModeDisabled
 
 	// 确保配置目录存在
 	configDir := filepath.Dir(cm.configPath)
@@ -316,16 +389,33 @@ func (cm *LLMDrivenConfigManager) SaveConfig(config *LLMDrivenFullConfig) error
 		return fmt.Errorf("写入配置文件失败: %w", err)
 	}
 
+	cm.mu.Lock()
 	cm.config = config
+	if info, err := os.Stat(cm.configPath); err == nil {
+		cm.loadedMTime = info.ModTime()
+	}
+	cm.mu.Unlock()
 	log.Printf("✅ [配置管理] 配置已保存: %s", cm.configPath)
 	return nil
 }
 
 // GetConfig 获取当前配置
 func (cm *LLMDrivenConfigManager) GetConfig() *LLMDrivenFullConfig {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 	return cm.config
 }
 
+// GetKnowledgeGraphExtractionMode 获取知识图谱抽取模式及其生效来源，配置未加载时为disabled
+func (cm *LLMDrivenConfigManager) GetKnowledgeGraphExtractionMode() (string, string) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	if cm.config == nil {
+		return KGExtractionModeDisabled, "默认值"
+	}
+	return cm.config.KnowledgeGraphExtraction.Mode, cm.kgModeSource
+}
+
 // ValidateConfig 验证配置
 func (cm *LLMDrivenConfigManager) ValidateConfig(config *LLMDrivenFullConfig) error {
 	// 验证LLM配置
@@ -357,6 +447,13 @@ func (cm *LLMDrivenConfigManager) ValidateConfig(config *LLMDrivenFullConfig) er
 		return fmt.Errorf("最大并发请求数必须大于0")
 	}
 
+	// 验证知识图谱抽取模式（空值表示使用默认值）
+	if mode := config.KnowledgeGraphExtraction.Mode; mode != "" {
+		if err := validateKGExtractionMode(mode); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -366,8 +463,49 @@ func (cm *LLMDrivenConfigManager) ReloadConfig() (*LLMDrivenFullConfig, error) {
 	return cm.LoadConfig()
 }
 
+// StartAutoReload 按interval检查配置文件修改时间，变化时自动重新加载；返回停止函数
+// 重新加载失败时保留原有配置并记录日志
+func (cm *LLMDrivenConfigManager) StartAutoReload(interval time.Duration) func() {
+	stop := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				info, err := os.Stat(cm.configPath)
+				if err != nil {
+					continue
+				}
+				cm.mu.RLock()
+				changed := !info.ModTime().Equal(cm.loadedMTime)
+				cm.mu.RUnlock()
+				if !changed {
+					continue
+				}
+				if _, err := cm.ReloadConfig(); err != nil {
+					log.Printf("❌ [配置管理] 配置文件已修改但重新加载失败，继续使用原配置: %v", err)
+					// 记录本次修改时间，避免对同一份错误配置反复重试
+					cm.mu.Lock()
+					cm.loadedMTime = info.ModTime()
+					cm.mu.Unlock()
+				}
+			}
+		}
+	}()
+
+	log.Printf("🔄 [配置管理] 已启用配置自动重载，检查间隔: %v", interval)
+	return func() { once.Do(func() { close(stop) }) }
+}
+
 // GetConfigSummary 获取配置摘要
 func (cm *LLMDrivenConfigManager) GetConfigSummary() map[string]interface{} {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 	if cm.config == nil {
 		return map[string]interface{}{
 			"status": "not_loaded",
@@ -385,13 +523,16 @@ func (cm *LLMDrivenConfigManager) GetConfigSummary() map[string]interface{} {
 		"timeline_db_enabled":     cm.config.Storage.TimelineDB.Enabled,
 		"knowledge_graph_enabled": cm.config.Storage.KnowledgeGraph.Enabled,
 		"metrics_enabled":         cm.config.Monitoring.MetricsEnabled,
+		"kg_extraction_mode":      cm.config.KnowledgeGraphExtraction.Mode,
+		"kg_extraction_source":    cm.kgModeSource,
 	}
 }
 
 // GetContextOnlyThreshold 获取仅上下文记录的置信度阈值
 func (cm *LLMDrivenConfigManager) GetContextOnlyThreshold() float64 {
-	if cm.config == nil {
+	config := cm.GetConfig()
+	if config == nil {
 		return 0.7 // 默认阈值
 	}
-	return cm.config.SmartStorage.ConfidenceThresholds.ContextOnlyThreshold
+	return config.SmartStorage.ConfidenceThresholds.ContextOnlyThreshold
 }
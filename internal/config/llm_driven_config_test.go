@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadConfigKGExtractionMode 测试抽取模式的来源优先级，以及无效模式被拒绝且保留原配置
+func TestLoadConfigKGExtractionMode(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "llm_driven.yaml")
+	writeConfig := func(mode string) {
+		content := "fallback:\n  fallback_threshold: 3\nknowledge_graph_extraction:\n  mode: \"" + mode + "\"\n"
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("写入配置失败: %v", err)
+		}
+	}
+
+	t.Setenv("KNOWLEDGE_GRAPH_EXTRACTION_MODE", "")
+	cm := NewLLMDrivenConfigManager(configPath)
+
+	writeConfig(KGExtractionModeParallelDedicated)
+	if _, err := cm.LoadConfig(); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	if mode, source := cm.GetKnowledgeGraphExtractionMode(); mode != KGExtractionModeParallelDedicated || source != "配置文件" {
+		t.Errorf("应使用配置文件中的模式: %s (%s)", mode, source)
+	}
+
+	t.Setenv("KNOWLEDGE_GRAPH_EXTRACTION_MODE", KGExtractionModeEnhancedPrompt)
+	if _, err := cm.ReloadConfig(); err != nil {
+		t.Fatalf("重新加载配置失败: %v", err)
+	}
+	if mode, source := cm.GetKnowledgeGraphExtractionMode(); mode != KGExtractionModeEnhancedPrompt || source != "环境变量" {
+		t.Errorf("环境变量应优先: %s (%s)", mode, source)
+	}
+
+	t.Setenv("KNOWLEDGE_GRAPH_EXTRACTION_MODE", "")
+	writeConfig("parallel")
+	if _, err := cm.ReloadConfig(); err == nil {
+		t.Fatal("无效模式应返回错误")
+	}
+	if mode, _ := cm.GetKnowledgeGraphExtractionMode(); mode != KGExtractionModeEnhancedPrompt {
+		t.Errorf("加载失败时应保留原配置: %s", mode)
+	}
+}
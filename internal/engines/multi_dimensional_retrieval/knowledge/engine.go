@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
@@ -84,8 +85,9 @@ func (engine *Neo4jEngine) initializeGraph(ctx context.Context) error {
 
 	// 创建约束和索引
 	constraints := []string{
-		// 概念节点唯一性约束
-		"CREATE CONSTRAINT concept_name_unique IF NOT EXISTS FOR (c:Concept) REQUIRE c.name IS UNIQUE",
+		// 概念节点按名称+分类唯一（同名不同类型的实体是不同节点）
+		"DROP CONSTRAINT concept_name_unique IF EXISTS",
+		"CREATE CONSTRAINT concept_name_category_unique IF NOT EXISTS FOR (c:Concept) REQUIRE (c.name, c.category) IS UNIQUE",
 
 		// 技术节点唯一性约束
 		"CREATE CONSTRAINT technology_name_unique IF NOT EXISTS FOR (t:Technology) REQUIRE t.name IS UNIQUE",
@@ -124,42 +126,112 @@ func (engine *Neo4jEngine) initializeGraph(ctx context.Context) error {
 	return nil
 }
 
-// CreateConcept 创建概念节点
+// CreateConcept 创建概念节点，已存在时合并
 func (engine *Neo4jEngine) CreateConcept(ctx context.Context, concept *Concept) error {
+	_, err := engine.MergeConcept(ctx, concept)
+	return err
+}
+
+// MergeConcept 按名称+分类合并写入概念节点
+// 已存在时累加occurrence并保留较高的importance，不重复创建
+func (engine *Neo4jEngine) MergeConcept(ctx context.Context, concept *Concept) (MergeResult, error) {
 	session := engine.driver.NewSession(ctx, neo4j.SessionConfig{
 		DatabaseName: engine.config.Database,
 	})
 	defer session.Close(ctx)
 
-	query := `
-		MERGE (c:Concept {name: $name})
+	query := fmt.Sprintf(`
+		MERGE (c:Concept {name: $name, category: $category})
+		ON CREATE SET c.occurrence = 1,
+		              c.created_at = datetime()
+		ON MATCH SET c.occurrence = coalesce(c.occurrence, 1) + 1
 		SET c.description = $description,
-		    c.category = $category,
 		    c.keywords = $keywords,
-		    c.importance = $importance,
-		    c.created_at = datetime(),
+		    c.importance = CASE WHEN coalesce(c.importance, 0.0) > $importance THEN c.importance ELSE $importance END,
+		    c.user_ids = %s,
+		    c.memory_ids_truncated = %s,
+		    c.memory_ids = %s,
+		    c.memory_owners = %s,
 		    c.updated_at = datetime()
-		RETURN c.name as name`
+		RETURN c.name as name, c.occurrence as occurrence`, userIDsMergeExpr("c"), memoryIDsTruncatedExpr("c"), memoryIDsMergeExpr("c"), memoryOwnersMergeExpr("c"))
 
 	parameters := map[string]interface{}{
-		"name":        concept.Name,
-		"description": concept.Description,
-		"category":    concept.Category,
-		"keywords":    concept.Keywords,
-		"importance":  concept.Importance,
+		"name":         concept.Name,
+		"description":  concept.Description,
+		"category":     concept.Category,
+		"keywords":     concept.Keywords,
+		"importance":   concept.Importance,
+		"user_id":      concept.UserID,
+		"memory_id":    concept.MemoryID,
+		"memory_owner": memoryOwner(concept.UserID, concept.MemoryID),
 	}
 
 	result, err := session.Run(ctx, query, parameters)
 	if err != nil {
-		return fmt.Errorf("创建概念节点失败: %w", err)
+		return "", fmt.Errorf("创建概念节点失败: %w", err)
 	}
 
+	mergeResult := MergeResultSkipped
 	if result.Next(ctx) {
+		mergeResult = mergeResultFromRecord(result.Record(), "occurrence")
 		name, _ := result.Record().Get("name")
-		log.Printf("✅ 创建概念节点: %s", name)
+		log.Printf("✅ 写入概念节点: %s (%s)", name, mergeResult)
 	}
 
-	return result.Err()
+	return mergeResult, result.Err()
+}
+
+// mergeResultFromRecord 根据合并后的计数判断是新建还是合并（计数为1表示本次新建）
+func mergeResultFromRecord(record *neo4j.Record, counterKey string) MergeResult {
+	if val, ok := record.Get(counterKey); ok {
+		if n, ok := val.(int64); ok && n > 1 {
+			return MergeResultMerged
+		}
+	}
+	return MergeResultCreated
+}
+
+// userIDsMergeExpr 生成将$user_id追加到user_ids列表的Cypher表达式（去重，空用户不追加）
+// 概念和关系按名称MERGE，多个用户共享同一节点，因此用列表记录归属
+func userIDsMergeExpr(variable string) string {
+	return fmt.Sprintf(`CASE WHEN $user_id = '' OR $user_id IN coalesce(%[1]s.user_ids, []) `+
+		`THEN coalesce(%[1]s.user_ids, []) ELSE coalesce(%[1]s.user_ids, []) + $user_id END`, variable)
+}
+
+// maxGraphMemoryIDs 概念节点和关系上保留的记忆ID数量上限，超出时丢弃最早的记忆ID
+const maxGraphMemoryIDs = 100
+
+// memoryIDsTruncatedExpr 生成标记memory_ids/memory_owners是否曾因上限丢弃记忆的Cypher表达式，需在追加列表之前求值
+// 被丢弃的记忆仍引用该节点或关系，删除记忆时列表为空也不能据此删除
+func memoryIDsTruncatedExpr(variable string) string {
+	return fmt.Sprintf(`coalesce(%[1]s.memory_ids_truncated, false) OR ($memory_id <> '' `+
+		`AND NOT $memory_id IN coalesce(%[1]s.memory_ids, []) AND size(coalesce(%[1]s.memory_ids, [])) >= %[2]d)`, variable, maxGraphMemoryIDs)
+}
+
+// memoryIDsMergeExpr 生成将$memory_id追加到memory_ids列表的Cypher表达式（去重，空ID不追加，只保留最近的记忆ID）
+// 图谱扩展检索通过该列表从概念找回产生它的记忆
+func memoryIDsMergeExpr(variable string) string {
+	return cappedListAppendExpr(variable, "memory_ids", "memory_id")
+}
+
+// memoryOwnersMergeExpr 生成将$memory_owner追加到memory_owners列表的Cypher表达式
+// memory_owners与memory_ids一一对应记录"用户ID/记忆ID"，删除记忆时据此判断用户在节点上是否还有其他记忆
+func memoryOwnersMergeExpr(variable string) string {
+	return cappedListAppendExpr(variable, "memory_owners", "memory_owner")
+}
+
+// cappedListAppendExpr 生成将参数追加到列表属性的Cypher表达式（去重，空值不追加，只保留最近的maxGraphMemoryIDs个）
+func cappedListAppendExpr(variable, property, param string) string {
+	return fmt.Sprintf(`CASE WHEN $%[3]s = '' OR $%[3]s IN coalesce(%[1]s.%[2]s, []) `+
+		`THEN coalesce(%[1]s.%[2]s, []) ELSE (coalesce(%[1]s.%[2]s, []) + $%[3]s)[-%[4]d..] END`, variable, property, param, maxGraphMemoryIDs)
+}
+
+// memoryOwner 记忆归属记录"用户ID/记忆ID"，记忆ID为空时返回空串（不追加）
+func memoryOwner(userID, memoryID string) string {
+	if memoryID == "" {
+		return ""
+	}
+	return userID + "/" + memoryID
 }
 
 // CreateTechnology 创建技术节点
@@ -202,41 +274,102 @@ func (engine *Neo4jEngine) CreateTechnology(ctx context.Context, tech *Technolog
 	return result.Err()
 }
 
-// CreateRelationship 创建关系
+// CreateRelationship 创建关系，已存在时合并
 func (engine *Neo4jEngine) CreateRelationship(ctx context.Context, rel *Relationship) error {
+	_, err := engine.MergeRelationship(ctx, rel)
+	return err
+}
+
+// MergeRelationship 按起点+终点+类型合并写入关系
+// 已存在时累加weight并保留较高的strength；端点不存在时返回MergeResultSkipped
+func (engine *Neo4jEngine) MergeRelationship(ctx context.Context, rel *Relationship) (MergeResult, error) {
 	session := engine.driver.NewSession(ctx, neo4j.SessionConfig{
 		DatabaseName: engine.config.Database,
 	})
 	defer session.Close(ctx)
 
 	query := fmt.Sprintf(`
-		MATCH (from {name: $from_name})
-		MATCH (to {name: $to_name})
+		MATCH (from %s)
+		MATCH (to %s)
 		MERGE (from)-[r:%s]->(to)
-		SET r.strength = $strength,
+		ON CREATE SET r.weight = 1,
+		              r.created_at = datetime()
+		ON MATCH SET r.weight = coalesce(r.weight, 1) + 1
+		SET r.strength = CASE WHEN coalesce(r.strength, 0.0) > $strength THEN r.strength ELSE $strength END,
 		    r.description = $description,
-		    r.created_at = datetime(),
+		    r.user_ids = %s,
+		    r.memory_ids_truncated = %s,
+		    r.memory_ids = %s,
+		    r.memory_owners = %s,
 		    r.updated_at = datetime()
-		RETURN type(r) as relationship_type`, rel.Type)
+		RETURN type(r) as relationship_type, r.weight as weight`,
+		endpointPattern("from", rel.FromCategory), endpointPattern("to", rel.ToCategory), rel.Type,
+		userIDsMergeExpr("r"), memoryIDsTruncatedExpr("r"), memoryIDsMergeExpr("r"), memoryOwnersMergeExpr("r"))
 
 	parameters := map[string]interface{}{
-		"from_name":   rel.FromName,
-		"to_name":     rel.ToName,
-		"strength":    rel.Strength,
-		"description": rel.Description,
+		"from_name":     rel.FromName,
+		"from_category": rel.FromCategory,
+		"to_name":       rel.ToName,
+		"to_category":   rel.ToCategory,
+		"strength":      rel.Strength,
+		"description":   rel.Description,
+		"user_id":       rel.UserID,
+		"memory_id":     rel.MemoryID,
+		"memory_owner":  memoryOwner(rel.UserID, rel.MemoryID),
 	}
 
 	result, err := session.Run(ctx, query, parameters)
 	if err != nil {
-		return fmt.Errorf("创建关系失败: %w", err)
+		return "", fmt.Errorf("创建关系失败: %w", err)
 	}
 
+	mergeResult := MergeResultSkipped
 	if result.Next(ctx) {
+		mergeResult = mergeResultFromRecord(result.Record(), "weight")
 		relType, _ := result.Record().Get("relationship_type")
-		log.Printf("✅ 创建关系: %s -[%s]-> %s", rel.FromName, relType, rel.ToName)
+		log.Printf("✅ 写入关系: %s -[%s]-> %s (%s)", rel.FromName, relType, rel.ToName, mergeResult)
 	}
 
-	return result.Err()
+	return mergeResult, result.Err()
+}
+
+// endpointPattern 生成关系端点的匹配模式，指定分类时精确匹配概念节点
+func endpointPattern(variable, category string) string {
+	if category == "" {
+		return fmt.Sprintf("{name: $%s_name}", variable)
+	}
+	return fmt.Sprintf(":Concept {name: $%[1]s_name, category: $%[1]s_category}", variable)
+}
+
+// PruneRelationships 删除强度低于minStrength、写入次数低于minWeight且最近写入早于minAge的关系
+// 多次被写入的关系即使单次强度较低也会保留；返回删除的关系数
+func (engine *Neo4jEngine) PruneRelationships(ctx context.Context, minStrength float64, minWeight int, minAge time.Duration) (int, error) {
+	session := engine.driver.NewSession(ctx, neo4j.SessionConfig{
+		DatabaseName: engine.config.Database,
+	})
+	defer session.Close(ctx)
+
+	query := `
+		MATCH ()-[r]->()
+		WHERE coalesce(r.strength, 0.0) < $min_strength
+		  AND coalesce(r.weight, 1) < $min_weight
+		  AND r.updated_at < datetime() - duration({seconds: $min_age_seconds})
+		DELETE r
+		RETURN count(r) as deleted`
+
+	parameters := map[string]interface{}{
+		"min_strength":    minStrength,
+		"min_weight":      minWeight,
+		"min_age_seconds": int64(minAge.Seconds()),
+	}
+
+	deleted, err := engine.runDeleteCount(ctx, session, query, parameters)
+	if err != nil {
+		return 0, fmt.Errorf("清理低质量关系失败: %w", err)
+	}
+
+	log.Printf("🧹 知识图谱关系清理完成 - 删除: %d (强度<%.2f, 写入次数<%d, 保留期%v)", deleted, minStrength, minWeight, minAge)
+	return deleted, nil
 }
 
 // ExpandKnowledge 知识图谱扩展检索
@@ -435,7 +568,577 @@ func (engine *Neo4jEngine) HealthCheck(ctx context.Context) error {
 	return engine.driver.VerifyConnectivity(ctx)
 }
 
+// Probe 就绪探测：打开会话执行 RETURN 1，不初始化图谱结构
+func Probe(ctx context.Context, config *Neo4jConfig) error {
+	if config == nil {
+		return fmt.Errorf("Neo4j配置不能为空")
+	}
+
+	driver, err := neo4j.NewDriverWithContext(
+		config.URI,
+		neo4j.BasicAuth(config.Username, config.Password, ""),
+	)
+	if err != nil {
+		return fmt.Errorf("创建Neo4j驱动失败: %w", err)
+	}
+	defer driver.Close(ctx)
+
+	session := driver.NewSession(ctx, neo4j.SessionConfig{
+		DatabaseName: config.Database,
+		AccessMode:   neo4j.AccessModeRead,
+	})
+	defer session.Close(ctx)
+
+	result, err := session.Run(ctx, "RETURN 1", nil)
+	if err != nil {
+		return fmt.Errorf("打开Neo4j会话失败: %w", err)
+	}
+	if _, err := result.Consume(ctx); err != nil {
+		return fmt.Errorf("执行RETURN 1失败: %w", err)
+	}
+	return nil
+}
+
 // Close 关闭连接
 func (engine *Neo4jEngine) Close(ctx context.Context) error {
 	return engine.driver.Close(ctx)
 }
+
+// DetachMemories 从知识图谱中移除用户已删除的记忆：从概念节点和关系的memory_ids/memory_owners中移除这些记忆，
+// 用户在节点或关系上没有其他记忆时同时从user_ids中移除该用户；归属列表都为空时才删除节点或关系
+// 概念按名称和分类合并、由多个用户和记忆共享，只按memory_ids匹配，不按description匹配（description以最后一次写入为准）
+// dryRun为true时只统计将删除和将移除归属的数量，不修改图谱
+func (engine *Neo4jEngine) DetachMemories(ctx context.Context, userID string, memoryIDs []string, dryRun bool) (MemoryDetachCounts, error) {
+	var counts MemoryDetachCounts
+	if len(memoryIDs) == 0 {
+		return counts, nil
+	}
+
+	session := engine.driver.NewSession(ctx, neo4j.SessionConfig{
+		DatabaseName: engine.config.Database,
+	})
+	defer session.Close(ctx)
+
+	removeIDs := make(map[string]bool, len(memoryIDs))
+	for _, id := range memoryIDs {
+		removeIDs[id] = true
+	}
+
+	// 先处理关系，再处理节点（节点删除时顺带移除残留关系）；读取和修改在同一事务中，避免与并发写入交错
+	_, err := session.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		targets := []struct {
+			match    string
+			remove   string
+			deleted  *int
+			detached *int
+			desc     string
+		}{
+			{"MATCH ()-[e]->()", "DELETE e", &counts.Relations, &counts.DetachedRelations, "关系"},
+			{"MATCH (e:Concept)", "DETACH DELETE e", &counts.Concepts, &counts.DetachedConcepts, "概念节点"},
+		}
+		for _, target := range targets {
+			plans, err := engine.planMemoryDetach(ctx, tx, target.match, userID, memoryIDs, removeIDs)
+			if err != nil {
+				return nil, fmt.Errorf("查询%s归属失败: %w", target.desc, err)
+			}
+			var removeElements []string
+			var updates []map[string]interface{}
+			for _, plan := range plans {
+				if plan.detachment.Remove {
+					removeElements = append(removeElements, plan.elementID)
+					continue
+				}
+				updates = append(updates, map[string]interface{}{
+					"id":            plan.elementID,
+					"user_ids":      plan.detachment.UserIDs,
+					"memory_ids":    plan.detachment.MemoryIDs,
+					"memory_owners": plan.detachment.MemoryOwners,
+				})
+			}
+			*target.deleted, *target.detached = len(removeElements), len(updates)
+			if dryRun {
+				continue
+			}
+
+			if len(updates) > 0 {
+				updateQuery := "UNWIND $updates AS u " + target.match + `
+					WHERE elementId(e) = u.id
+					SET e.user_ids = u.user_ids, e.memory_ids = u.memory_ids, e.memory_owners = u.memory_owners`
+				if _, err := tx.Run(ctx, updateQuery, map[string]interface{}{"updates": updates}); err != nil {
+					return nil, fmt.Errorf("移除%s的记忆归属失败: %w", target.desc, err)
+				}
+			}
+			if len(removeElements) > 0 {
+				deleteQuery := "UNWIND $ids AS id " + target.match + " WHERE elementId(e) = id " + target.remove
+				if _, err := tx.Run(ctx, deleteQuery, map[string]interface{}{"ids": removeElements}); err != nil {
+					return nil, fmt.Errorf("删除%s失败: %w", target.desc, err)
+				}
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return MemoryDetachCounts{}, err
+	}
+
+	log.Printf("🗑️ 知识图谱记忆移除完成 - 用户: %s, 记忆数: %d, 演练: %v, 删除概念: %d, 删除关系: %d, 移除归属的概念: %d, 移除归属的关系: %d",
+		userID, len(memoryIDs), dryRun, counts.Concepts, counts.Relations, counts.DetachedConcepts, counts.DetachedRelations)
+	return counts, nil
+}
+
+// MemoryDetachCounts 从知识图谱移除记忆的计数
+type MemoryDetachCounts struct {
+	Concepts          int // 归属列表已为空、删除的概念节点数
+	Relations         int // 归属列表已为空、删除的关系数
+	DetachedConcepts  int // 仍有其他记忆或用户、只移除了这些记忆的概念节点数
+	DetachedRelations int // 仍有其他记忆或用户、只移除了这些记忆的关系数
+}
+
+// memoryDetachPlan 单个节点或关系的归属移除计划
+type memoryDetachPlan struct {
+	elementID  string
+	detachment memoryDetachment
+}
+
+// planMemoryDetach 查询memory_ids中包含这些记忆的节点或关系，计算移除记忆后的归属列表
+func (engine *Neo4jEngine) planMemoryDetach(ctx context.Context, tx neo4j.ManagedTransaction, match, userID string, memoryIDs []string, removeIDs map[string]bool) ([]memoryDetachPlan, error) {
+	query := match + `
+		WHERE any(id IN $memory_ids WHERE id IN coalesce(e.memory_ids, []))
+		RETURN elementId(e) as id, coalesce(e.user_ids, []) as user_ids,
+		       coalesce(e.memory_ids, []) as memory_ids, coalesce(e.memory_owners, []) as memory_owners,
+		       coalesce(e.memory_ids_truncated, false) as truncated`
+	result, err := tx.Run(ctx, query, map[string]interface{}{"memory_ids": memoryIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []memoryDetachPlan
+	for result.Next(ctx) {
+		record := result.Record()
+		id, _ := record.Get("id")
+		userIDs, _ := record.Get("user_ids")
+		ids, _ := record.Get("memory_ids")
+		owners, _ := record.Get("memory_owners")
+		truncated, _ := record.Get("truncated")
+		elementID, _ := id.(string)
+		wasTruncated, _ := truncated.(bool)
+		plans = append(plans, memoryDetachPlan{
+			elementID:  elementID,
+			detachment: detachMemories(toStringSlice(userIDs), toStringSlice(ids), toStringSlice(owners), wasTruncated, removeIDs, userID),
+		})
+	}
+	return plans, result.Err()
+}
+
+// memoryDetachment 从归属列表中移除记忆后的结果
+type memoryDetachment struct {
+	UserIDs      []string
+	MemoryIDs    []string
+	MemoryOwners []string
+	Remove       bool // 用户和记忆归属都已为空，节点或关系应删除
+}
+
+// detachMemories 从归属列表中移除记忆；用户在剩余的归属记录中没有其他记忆时同时移除该用户
+// 早期写入的节点或关系缺少部分memory_owners记录，或列表曾因上限丢弃过记忆(truncated)，无法判断用户是否还有其他记忆，
+// 此时保留用户归属；truncated时即使列表为空也不删除
+func detachMemories(userIDs, memoryIDs, owners []string, truncated bool, removeIDs map[string]bool, userID string) memoryDetachment {
+	result := memoryDetachment{UserIDs: []string{}, MemoryIDs: []string{}, MemoryOwners: []string{}}
+	for _, id := range memoryIDs {
+		if !removeIDs[id] {
+			result.MemoryIDs = append(result.MemoryIDs, id)
+		}
+	}
+
+	ownersComplete := !truncated && len(owners) >= len(memoryIDs)
+	userHasOthers := false
+	for _, owner := range owners {
+		ownerUser, ownerMemory, _ := strings.Cut(owner, "/")
+		if removeIDs[ownerMemory] {
+			continue
+		}
+		result.MemoryOwners = append(result.MemoryOwners, owner)
+		if ownerUser == userID {
+			userHasOthers = true
+		}
+	}
+
+	for _, id := range userIDs {
+		if id == userID && ownersComplete && !userHasOthers {
+			continue
+		}
+		result.UserIDs = append(result.UserIDs, id)
+	}
+	result.Remove = !truncated && len(result.UserIDs) == 0 && len(result.MemoryIDs) == 0
+	return result
+}
+
+// toStringSlice 将Neo4j返回的列表转换为字符串切片，忽略非字符串元素
+func toStringSlice(value interface{}) []string {
+	items, _ := value.([]interface{})
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// PurgeUser 清除用户在知识图谱中的全部数据
+// 只属于该用户的概念和关系直接删除；与其他用户共享的只从user_ids中移除该用户，返回被移除归属的数量
+// 同时删除该用户的User节点，已清除过的用户再次执行时各计数均为0
+func (engine *Neo4jEngine) PurgeUser(ctx context.Context, userID string) (deleted UserPurgeCounts, err error) {
+	if userID == "" {
+		return deleted, fmt.Errorf("用户ID不能为空")
+	}
+
+	session := engine.driver.NewSession(ctx, neo4j.SessionConfig{
+		DatabaseName: engine.config.Database,
+	})
+	defer session.Close(ctx)
+
+	parameters := map[string]interface{}{
+		"user_id": userID,
+	}
+
+	// 先处理关系，再处理节点（节点删除时顺带移除残留关系）
+	steps := []struct {
+		target *int
+		desc   string
+		query  string
+	}{
+		{&deleted.Relations, "删除用户独有的关系", `
+			MATCH ()-[r]->()
+			WHERE $user_id IN coalesce(r.user_ids, [])
+			  AND size([id IN r.user_ids WHERE id <> $user_id]) = 0
+			DELETE r
+			RETURN count(r) as deleted`},
+		{&deleted.SharedRelations, "移除共享关系的用户归属", `
+			MATCH ()-[r]->()
+			WHERE $user_id IN coalesce(r.user_ids, [])
+			SET r.user_ids = [id IN r.user_ids WHERE id <> $user_id]
+			RETURN count(r) as deleted`},
+		{&deleted.Concepts, "删除用户独有的概念节点", `
+			MATCH (c:Concept)
+			WHERE $user_id IN coalesce(c.user_ids, [])
+			  AND size([id IN c.user_ids WHERE id <> $user_id]) = 0
+			DETACH DELETE c
+			RETURN count(c) as deleted`},
+		{&deleted.SharedConcepts, "移除共享概念的用户归属", `
+			MATCH (c:Concept)
+			WHERE $user_id IN coalesce(c.user_ids, [])
+			SET c.user_ids = [id IN c.user_ids WHERE id <> $user_id]
+			RETURN count(c) as deleted`},
+		{&deleted.Users, "删除User节点", `
+			MATCH (u:User {id: $user_id})
+			DETACH DELETE u
+			RETURN count(u) as deleted`},
+	}
+	for _, step := range steps {
+		if *step.target, err = engine.runDeleteCount(ctx, session, step.query, parameters); err != nil {
+			return deleted, fmt.Errorf("%s失败: %w", step.desc, err)
+		}
+	}
+
+	log.Printf("🗑️ 知识图谱用户数据清除完成 - 用户: %s, 概念: %d, 关系: %d, 共享概念: %d, 共享关系: %d",
+		userID, deleted.Concepts, deleted.Relations, deleted.SharedConcepts, deleted.SharedRelations)
+	return deleted, nil
+}
+
+// UserPurgeCounts 清除用户知识图谱数据的计数
+type UserPurgeCounts struct {
+	Concepts        int // 删除的概念节点数
+	Relations       int // 删除的关系数
+	SharedConcepts  int // 与其他用户共享、只移除了该用户归属的概念节点数
+	SharedRelations int // 与其他用户共享、只移除了该用户归属的关系数
+	Users           int // 删除的User节点数
+}
+
+// runDeleteCount 执行删除语句并读取返回的deleted计数
+func (engine *Neo4jEngine) runDeleteCount(ctx context.Context, session neo4j.SessionWithContext, query string, parameters map[string]interface{}) (int, error) {
+	result, err := session.Run(ctx, query, parameters)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	if result.Next(ctx) {
+		if val, ok := result.Record().Get("deleted"); ok {
+			if n, ok := val.(int64); ok {
+				deleted = int(n)
+			}
+		}
+	}
+
+	return deleted, result.Err()
+}
+
+// MarkMemoryUpdated 记忆内容更新后刷新由该记忆产生的概念节点的更新时间，返回涉及的概念数
+// 概念由LLM从原内容中抽取，这里不重新抽取，只标记变化；只处理属于该用户的概念
+func (engine *Neo4jEngine) MarkMemoryUpdated(ctx context.Context, memoryID, userID string) (int, error) {
+	session := engine.driver.NewSession(ctx, neo4j.SessionConfig{
+		DatabaseName: engine.config.Database,
+	})
+	defer session.Close(ctx)
+
+	cypherQuery := `
+		MATCH (c:Concept)
+		WHERE $memory_id IN coalesce(c.memory_ids, [])
+		  AND $user_id IN coalesce(c.user_ids, [])
+		SET c.updated_at = datetime()
+		RETURN count(c) as updated`
+
+	result, err := session.Run(ctx, cypherQuery, map[string]interface{}{
+		"memory_id": memoryID,
+		"user_id":   userID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("更新概念节点失败: %w", err)
+	}
+
+	updated := 0
+	if result.Next(ctx) {
+		if val, ok := result.Record().Get("updated"); ok {
+			if n, ok := val.(int64); ok {
+				updated = int(n)
+			}
+		}
+	}
+	return updated, result.Err()
+}
+
+// RelatedMemoryIDs 查找与给定记忆在知识图谱中相关的其他记忆
+// 先找到这些记忆产生的概念（最多maxConcepts个），再沿属于该用户的关系扩展一跳，返回这些概念关联的其他记忆ID，最多maxMemories个
+// 只按memory_ids匹配起点：概念由多个记忆合并写入，description只保留最后一次写入的记忆ID
+func (engine *Neo4jEngine) RelatedMemoryIDs(ctx context.Context, userID string, memoryIDs []string, maxConcepts, maxMemories int) ([]string, error) {
+	if userID == "" || len(memoryIDs) == 0 || maxConcepts <= 0 || maxMemories <= 0 {
+		return nil, nil
+	}
+
+	session := engine.driver.NewSession(ctx, neo4j.SessionConfig{
+		DatabaseName: engine.config.Database,
+	})
+	defer session.Close(ctx)
+
+	cypherQuery := `
+		MATCH (c:Concept)
+		WHERE $user_id IN coalesce(c.user_ids, [])
+		  AND any(id IN $memory_ids WHERE id IN coalesce(c.memory_ids, []))
+		WITH c LIMIT $concept_limit
+		OPTIONAL MATCH (c)-[r]-(related:Concept)
+		WHERE $user_id IN coalesce(r.user_ids, []) AND $user_id IN coalesce(related.user_ids, [])
+		WITH collect(DISTINCT c) + collect(DISTINCT related)[..$concept_limit] AS nodes
+		UNWIND nodes AS n
+		UNWIND coalesce(n.memory_ids, []) AS memory_id
+		WITH DISTINCT memory_id
+		WHERE NOT memory_id IN $memory_ids
+		RETURN memory_id
+		LIMIT $memory_limit`
+
+	parameters := map[string]interface{}{
+		"user_id":       userID,
+		"memory_ids":    memoryIDs,
+		"concept_limit": maxConcepts,
+		"memory_limit":  maxMemories,
+	}
+
+	result, err := session.Run(ctx, cypherQuery, parameters)
+	if err != nil {
+		return nil, fmt.Errorf("查询相关记忆失败: %w", err)
+	}
+
+	var related []string
+	for result.Next(ctx) {
+		if value, ok := result.Record().Get("memory_id"); ok {
+			if id, ok := value.(string); ok && id != "" {
+				related = append(related, id)
+			}
+		}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("解析相关记忆失败: %w", err)
+	}
+	return related, nil
+}
+
+// QuerySubgraph 从指定实体出发，查询maxDepth跳以内属于该用户的子图
+// 路径上的节点和关系都必须包含该用户，节点总数达到maxNodes时截断
+func (engine *Neo4jEngine) QuerySubgraph(ctx context.Context, userID, entityName string, maxDepth, maxNodes int) (*KnowledgeResult, error) {
+	session := engine.driver.NewSession(ctx, neo4j.SessionConfig{
+		DatabaseName: engine.config.Database,
+	})
+	defer session.Close(ctx)
+
+	startTime := time.Now()
+
+	parameters := map[string]interface{}{
+		"entity_name": entityName,
+		"user_id":     userID,
+		"path_limit":  maxNodes * 10,
+	}
+
+	log.Printf("🔍 执行子图查询: 实体=%s, 用户=%s, 深度=%d", entityName, userID, maxDepth)
+
+	result, err := session.Run(ctx, subgraphQuery(maxDepth), parameters)
+	if err != nil {
+		return nil, fmt.Errorf("执行子图查询失败: %w", err)
+	}
+
+	collector := newSubgraphCollector(userID, maxNodes)
+	for !collector.truncated && result.Next(ctx) {
+		record := result.Record()
+
+		var start *neo4j.Node
+		if startValue, found := record.Get("start"); found {
+			if node, ok := startValue.(neo4j.Node); ok {
+				start = &node
+			}
+		}
+
+		var pathNodes []neo4j.Node
+		if value, found := record.Get("path_nodes"); found {
+			if list, ok := value.([]interface{}); ok {
+				for _, item := range list {
+					if node, ok := item.(neo4j.Node); ok {
+						pathNodes = append(pathNodes, node)
+					}
+				}
+			}
+		}
+
+		var pathRels []neo4j.Relationship
+		if value, found := record.Get("path_rels"); found {
+			if list, ok := value.([]interface{}); ok {
+				for _, item := range list {
+					if rel, ok := item.(neo4j.Relationship); ok {
+						pathRels = append(pathRels, rel)
+					}
+				}
+			}
+		}
+
+		collector.addPath(start, pathNodes, pathRels)
+	}
+
+	if err = result.Err(); err != nil {
+		return nil, fmt.Errorf("解析子图查询结果失败: %w", err)
+	}
+
+	nodes := make([]KnowledgeNode, 0, len(collector.nodes))
+	for _, node := range collector.nodes {
+		nodes = append(nodes, engine.parseNode(node))
+	}
+	relationships := make([]KnowledgeRelationship, 0, len(collector.relationships))
+	for _, rel := range collector.relationships {
+		relationships = append(relationships, engine.parseRelationship(rel))
+	}
+
+	return &KnowledgeResult{
+		Nodes:         nodes,
+		Relationships: relationships,
+		Total:         len(nodes),
+		Duration:      time.Since(startTime),
+		Query: &KnowledgeQuery{
+			QueryType:     "subgraph",
+			StartConcepts: []string{entityName},
+			MaxDepth:      maxDepth,
+			Limit:         maxNodes,
+			UserID:        userID,
+		},
+		Truncated: collector.truncated,
+	}, nil
+}
+
+// subgraphQuery 生成子图查询语句
+// 可变长度路径的跳数不支持参数化，maxDepth由调用方限制范围
+func subgraphQuery(maxDepth int) string {
+	return fmt.Sprintf(`
+		MATCH (start {name: $entity_name})
+		WHERE $user_id IN coalesce(start.user_ids, [])
+		OPTIONAL MATCH path = (start)-[*1..%d]-(other)
+		WHERE all(n IN nodes(path) WHERE $user_id IN coalesce(n.user_ids, []))
+		  AND all(r IN relationships(path) WHERE $user_id IN coalesce(r.user_ids, []))
+		RETURN start, nodes(path) as path_nodes, relationships(path) as path_rels
+		LIMIT $path_limit`, maxDepth)
+}
+
+// subgraphCollector 按查询返回的路径收集子图：节点去重，达到节点上限时截断，只保留两端节点都已收集的关系
+type subgraphCollector struct {
+	userID        string
+	maxNodes      int
+	nodes         []neo4j.Node
+	relationships []neo4j.Relationship
+	seenNodes     map[string]bool
+	seenRels      map[string]bool
+	truncated     bool
+}
+
+func newSubgraphCollector(userID string, maxNodes int) *subgraphCollector {
+	return &subgraphCollector{
+		userID:    userID,
+		maxNodes:  maxNodes,
+		seenNodes: make(map[string]bool),
+		seenRels:  make(map[string]bool),
+	}
+}
+
+// addPath 收集一条路径；起点或路径上有不属于该用户的节点或关系时跳过（与查询条件一致，再次校验防止越权）
+func (c *subgraphCollector) addPath(start *neo4j.Node, pathNodes []neo4j.Node, pathRels []neo4j.Relationship) {
+	if start == nil || !c.ownedByUser(start.Props) {
+		return
+	}
+	for _, node := range pathNodes {
+		if !c.ownedByUser(node.Props) {
+			pathNodes, pathRels = nil, nil
+			break
+		}
+	}
+	for _, rel := range pathRels {
+		if !c.ownedByUser(rel.Props) {
+			pathNodes, pathRels = nil, nil
+			break
+		}
+	}
+
+	if !c.addNode(*start) {
+		return
+	}
+	for _, node := range pathNodes {
+		if !c.addNode(node) {
+			break
+		}
+	}
+	for _, rel := range pathRels {
+		if c.seenRels[rel.ElementId] {
+			continue
+		}
+		if c.seenNodes[rel.StartElementId] && c.seenNodes[rel.EndElementId] {
+			c.seenRels[rel.ElementId] = true
+			c.relationships = append(c.relationships, rel)
+		}
+	}
+}
+
+// addNode 收集节点，节点数已达上限时标记截断并返回false
+func (c *subgraphCollector) addNode(node neo4j.Node) bool {
+	if c.seenNodes[node.ElementId] {
+		return true
+	}
+	if len(c.nodes) >= c.maxNodes {
+		c.truncated = true
+		return false
+	}
+	c.seenNodes[node.ElementId] = true
+	c.nodes = append(c.nodes, node)
+	return true
+}
+
+// ownedByUser 节点或关系的user_ids是否包含该用户
+func (c *subgraphCollector) ownedByUser(props map[string]interface{}) bool {
+	for _, userID := range getStringArrayProp(props, "user_ids") {
+		if userID == c.userID {
+			return true
+		}
+	}
+	return false
+}
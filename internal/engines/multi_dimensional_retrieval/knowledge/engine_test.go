@@ -0,0 +1,163 @@
+package knowledge
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// TestDetachMemories 测试两个记忆共享同一概念时，删除其中一个只移除其归属，删除最后一个才删除节点；
+// 其他用户共享的节点保留该用户的归属，缺少归属记录的早期节点保留用户
+func TestDetachMemories(t *testing.T) {
+	userIDs := []string{"user_a", "user_b"}
+	memoryIDs := []string{"m1", "m2", "m3"}
+	owners := []string{"user_a/m1", "user_a/m2", "user_b/m3"}
+
+	// user_a删除m1，m2仍属于user_a
+	got := detachMemories(userIDs, memoryIDs, owners, false, map[string]bool{"m1": true}, "user_a")
+	want := memoryDetachment{UserIDs: []string{"user_a", "user_b"}, MemoryIDs: []string{"m2", "m3"}, MemoryOwners: []string{"user_a/m2", "user_b/m3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("删除其中一个记忆后应保留节点和用户归属:\n期望 %+v\n实际 %+v", want, got)
+	}
+
+	// user_a删除m2后在节点上没有其他记忆，移除user_a；user_b的记忆和归属不受影响
+	got = detachMemories(got.UserIDs, got.MemoryIDs, got.MemoryOwners, false, map[string]bool{"m2": true}, "user_a")
+	want = memoryDetachment{UserIDs: []string{"user_b"}, MemoryIDs: []string{"m3"}, MemoryOwners: []string{"user_b/m3"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("用户没有其他记忆时应移除用户归属但保留节点:\n期望 %+v\n实际 %+v", want, got)
+	}
+
+	// 同一用户的两个记忆一起删除时节点不再有任何归属，应删除
+	got = detachMemories([]string{"user_a"}, []string{"m1", "m2"}, []string{"user_a/m1", "user_a/m2"}, false, map[string]bool{"m1": true, "m2": true}, "user_a")
+	if !got.Remove {
+		t.Errorf("归属列表都为空时应删除节点: %+v", got)
+	}
+
+	// 早期节点没有归属记录，无法判断用户是否还有其他记忆，保留用户和节点
+	got = detachMemories([]string{"user_a"}, []string{"m1"}, nil, false, map[string]bool{"m1": true}, "user_a")
+	if got.Remove || !reflect.DeepEqual(got.UserIDs, []string{"user_a"}) {
+		t.Errorf("缺少归属记录时应保留用户: %+v", got)
+	}
+}
+
+// TestDetachMemoriesPastCap 测试概念被超过上限的记忆引用时，列表中只保留最近的记忆；
+// 删除列表中的全部记忆后，被丢弃的早期记忆仍引用该概念，节点和用户归属都应保留
+func TestDetachMemoriesPastCap(t *testing.T) {
+	var memoryIDs, owners []string
+	removeIDs := make(map[string]bool)
+	// 共150个记忆引用该概念，最早的50个已因上限被丢弃
+	for i := 50; i < maxGraphMemoryIDs+50; i++ {
+		id := fmt.Sprintf("m%d", i)
+		memoryIDs = append(memoryIDs, id)
+		owners = append(owners, "user_a/"+id)
+		removeIDs[id] = true
+	}
+	if len(memoryIDs) != maxGraphMemoryIDs {
+		t.Fatalf("测试数据应填满上限: %d", len(memoryIDs))
+	}
+
+	got := detachMemories([]string{"user_a"}, memoryIDs, owners, true, removeIDs, "user_a")
+	if got.Remove || len(got.MemoryIDs) != 0 || !reflect.DeepEqual(got.UserIDs, []string{"user_a"}) {
+		t.Errorf("列表曾被截断时不应删除节点或移除用户: %+v", got)
+	}
+
+	// 未被截断的节点删除全部记忆后应删除
+	got = detachMemories([]string{"user_a"}, memoryIDs, owners, false, removeIDs, "user_a")
+	if !got.Remove {
+		t.Errorf("未截断且归属列表都为空时应删除节点: %+v", got)
+	}
+
+	if expr := memoryIDsTruncatedExpr("c"); !strings.Contains(expr, fmt.Sprintf(">= %d", maxGraphMemoryIDs)) {
+		t.Errorf("截断标记应在列表达到上限时设置: %s", expr)
+	}
+}
+
+// subgraphNode 构造属于指定用户的测试节点
+func subgraphNode(id string, userIDs ...string) neo4j.Node {
+	owners := make([]interface{}, len(userIDs))
+	for i, userID := range userIDs {
+		owners[i] = userID
+	}
+	return neo4j.Node{ElementId: id, Props: map[string]interface{}{"name": id, "user_ids": owners}}
+}
+
+// subgraphRel 构造属于指定用户的测试关系
+func subgraphRel(id, from, to string, userIDs ...string) neo4j.Relationship {
+	owners := make([]interface{}, len(userIDs))
+	for i, userID := range userIDs {
+		owners[i] = userID
+	}
+	return neo4j.Relationship{ElementId: id, StartElementId: from, EndElementId: to, Props: map[string]interface{}{"user_ids": owners}}
+}
+
+// collectedNodeIDs 收集到的节点ID
+func collectedNodeIDs(c *subgraphCollector) []string {
+	ids := make([]string, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		ids = append(ids, node.ElementId)
+	}
+	return ids
+}
+
+// TestSubgraphCollectorUserScope 测试路径上有其他用户的节点或关系时跳过整条路径，起点不属于该用户时不返回任何节点
+func TestSubgraphCollectorUserScope(t *testing.T) {
+	start := subgraphNode("a", "user_a")
+	collector := newSubgraphCollector("user_a", 10)
+	collector.addPath(&start, []neo4j.Node{start, subgraphNode("b", "user_a")}, []neo4j.Relationship{subgraphRel("ab", "a", "b", "user_a")})
+	collector.addPath(&start, []neo4j.Node{start, subgraphNode("c", "user_b")}, []neo4j.Relationship{subgraphRel("ac", "a", "c", "user_a")})
+	collector.addPath(&start, []neo4j.Node{start, subgraphNode("d", "user_a", "user_b")}, []neo4j.Relationship{subgraphRel("ad", "a", "d", "user_b")})
+	collector.addPath(&start, nil, nil)
+
+	if got := collectedNodeIDs(collector); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("只应收集该用户路径上的节点: %v", got)
+	}
+	if len(collector.relationships) != 1 || collector.relationships[0].ElementId != "ab" || collector.truncated {
+		t.Errorf("只应收集该用户的关系: %+v", collector.relationships)
+	}
+
+	other := subgraphNode("x", "user_b")
+	collector = newSubgraphCollector("user_a", 10)
+	collector.addPath(&other, []neo4j.Node{other, subgraphNode("y", "user_a")}, nil)
+	collector.addPath(nil, nil, nil)
+	if len(collector.nodes) != 0 {
+		t.Errorf("起点不属于该用户时不应返回节点: %v", collectedNodeIDs(collector))
+	}
+}
+
+// TestSubgraphCollectorNodeCap 测试节点数达到上限时截断，关系只保留两端节点都已收集的
+func TestSubgraphCollectorNodeCap(t *testing.T) {
+	start := subgraphNode("a", "user_a")
+	collector := newSubgraphCollector("user_a", 3)
+	collector.addPath(&start, []neo4j.Node{start, subgraphNode("b", "user_a"), subgraphNode("c", "user_a")},
+		[]neo4j.Relationship{subgraphRel("ab", "a", "b", "user_a"), subgraphRel("bc", "b", "c", "user_a")})
+	if collector.truncated {
+		t.Fatal("恰好达到上限时不应标记截断")
+	}
+	collector.addPath(&start, []neo4j.Node{start, subgraphNode("b", "user_a"), subgraphNode("d", "user_a")},
+		[]neo4j.Relationship{subgraphRel("ab", "a", "b", "user_a"), subgraphRel("bd", "b", "d", "user_a")})
+
+	if got := collectedNodeIDs(collector); !collector.truncated || !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("超过上限的节点应被截断: truncated=%v, 节点=%v", collector.truncated, got)
+	}
+	var relIDs []string
+	for _, rel := range collector.relationships {
+		relIDs = append(relIDs, rel.ElementId)
+	}
+	if !reflect.DeepEqual(relIDs, []string{"ab", "bc"}) {
+		t.Errorf("关系应去重且不包含被截断的节点: %v", relIDs)
+	}
+}
+
+// TestSubgraphQueryDepth 测试查询语句按深度限制可变长度路径的跳数，并按用户过滤路径
+func TestSubgraphQueryDepth(t *testing.T) {
+	query := subgraphQuery(3)
+	if !strings.Contains(query, "[*1..3]") {
+		t.Errorf("查询应限制为3跳: %s", query)
+	}
+	if strings.Count(query, "$user_id IN") != 3 {
+		t.Errorf("起点、路径节点和关系都应按用户过滤: %s", query)
+	}
+}
@@ -12,6 +12,8 @@ type Concept struct {
 	Category    string    `json:"category"` // "技术概念", "业务概念", "架构模式"等
 	Keywords    []string  `json:"keywords"`
 	Importance  float64   `json:"importance"` // 重要性评分 0-1
+	UserID      string    `json:"user_id"`    // 写入该概念的用户，追加到节点的user_ids列表
+	MemoryID    string    `json:"memory_id"`  // 产生该概念的记忆，追加到节点的memory_ids列表
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -52,15 +54,28 @@ type User struct {
 
 // Relationship 关系
 type Relationship struct {
-	FromName    string    `json:"from_name"`
-	ToName      string    `json:"to_name"`
-	Type        string    `json:"type"`     // 关系类型
-	Strength    float64   `json:"strength"` // 关系强度 0-1
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	FromName     string    `json:"from_name"`
+	FromCategory string    `json:"from_category,omitempty"` // 起点概念的分类，为空时只按名称匹配起点
+	ToName       string    `json:"to_name"`
+	ToCategory   string    `json:"to_category,omitempty"` // 终点概念的分类，为空时只按名称匹配终点
+	Type         string    `json:"type"`                  // 关系类型
+	Strength     float64   `json:"strength"`              // 关系强度 0-1
+	Description  string    `json:"description"`
+	UserID       string    `json:"user_id"`   // 写入该关系的用户，追加到关系的user_ids列表
+	MemoryID     string    `json:"memory_id"` // 产生该关系的记忆，追加到关系的memory_ids列表
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// MergeResult 合并写入的结果
+type MergeResult string
+
+const (
+	MergeResultCreated MergeResult = "created" // 新建节点或关系
+	MergeResultMerged  MergeResult = "merged"  // 已存在，累加出现次数
+	MergeResultSkipped MergeResult = "skipped" // 关系端点不存在，未写入
+)
+
 // 关系类型常量
 const (
 	// 概念关系
@@ -128,6 +143,7 @@ type KnowledgeResult struct {
 	Paths       []KnowledgePath    `json:"paths,omitempty"`
 	Clusters    []KnowledgeCluster `json:"clusters,omitempty"`
 	Suggestions []string           `json:"suggestions,omitempty"`
+	Truncated   bool               `json:"truncated,omitempty"` // 结果是否因节点数上限被截断
 }
 
 // KnowledgeNode 知识节点
@@ -37,16 +37,8 @@ func NewTimescaleDBEngine(config *TimescaleDBConfig) (*TimescaleDBEngine, error)
 		return nil, fmt.Errorf("TimescaleDB配置不能为空，请使用统一配置管理器加载配置")
 	}
 
-	// 构建连接字符串
-	connStr := fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=%s",
-		config.Host, config.Port, config.Username, config.Database, config.SSLMode)
-
-	if config.Password != "" {
-		connStr += fmt.Sprintf(" password=%s", config.Password)
-	}
-
 	// 连接数据库
-	db, err := sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", buildConnString(config))
 	if err != nil {
 		return nil, fmt.Errorf("连接TimescaleDB失败: %w", err)
 	}
@@ -78,6 +70,37 @@ func NewTimescaleDBEngine(config *TimescaleDBConfig) (*TimescaleDBEngine, error)
 	return engine, nil
 }
 
+// buildConnString 构建连接字符串
+func buildConnString(config *TimescaleDBConfig) string {
+	connStr := fmt.Sprintf("host=%s port=%d user=%s dbname=%s sslmode=%s",
+		config.Host, config.Port, config.Username, config.Database, config.SSLMode)
+
+	if config.Password != "" {
+		connStr += fmt.Sprintf(" password=%s", config.Password)
+	}
+	return connStr
+}
+
+// Probe 就绪探测：建立单个连接执行 SELECT 1，不初始化表结构
+func Probe(ctx context.Context, config *TimescaleDBConfig) error {
+	if config == nil {
+		return fmt.Errorf("TimescaleDB配置不能为空")
+	}
+
+	db, err := sql.Open("postgres", buildConnString(config))
+	if err != nil {
+		return fmt.Errorf("连接TimescaleDB失败: %w", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var one int
+	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+		return fmt.Errorf("执行SELECT 1失败: %w", err)
+	}
+	return nil
+}
+
 // initializeDatabase 初始化数据库结构
 func (engine *TimescaleDBEngine) initializeDatabase() error {
 	ctx := context.Background()
@@ -329,6 +352,36 @@ func (engine *TimescaleDBEngine) RetrieveEvents(ctx context.Context, query *Time
 	defer rows.Close()
 
 	// 解析结果
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// 获取总数
+	total, err := engine.getEventCount(ctx, query)
+	if err != nil {
+		log.Printf("⚠️ 获取总数失败: %v", err)
+		total = len(events)
+	}
+
+	return &TimelineResult{
+		Events: events,
+		Total:  total,
+	}, nil
+}
+
+// eventColumns 查询时间线事件的字段列表，顺序与scanEvents一致
+const eventColumns = `
+			id, user_id, session_id, workspace_id,
+			timestamp, event_duration,
+			event_type, title, content, summary,
+			related_files, related_concepts, parent_event_id,
+			intent, keywords, entities, categories,
+			importance_score, relevance_score,
+			created_at, updated_at`
+
+// scanEvents 解析时间线事件查询结果
+func scanEvents(rows *sql.Rows) ([]TimelineEvent, error) {
 	events := []TimelineEvent{}
 	for rows.Next() {
 		var event TimelineEvent
@@ -347,34 +400,17 @@ func (engine *TimescaleDBEngine) RetrieveEvents(ctx context.Context, query *Time
 		events = append(events, event)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("查询结果遍历失败: %w", err)
 	}
 
-	// 获取总数
-	total, err := engine.getEventCount(ctx, query)
-	if err != nil {
-		log.Printf("⚠️ 获取总数失败: %v", err)
-		total = len(events)
-	}
-
-	return &TimelineResult{
-		Events: events,
-		Total:  total,
-	}, nil
+	return events, nil
 }
 
 // buildRetrievalQuery 构建检索查询
 func (engine *TimescaleDBEngine) buildRetrievalQuery(query *TimelineQuery) (string, []interface{}) {
 	baseSQL := `
-		SELECT
-			id, user_id, session_id, workspace_id,
-			timestamp, event_duration,
-			event_type, title, content, summary,
-			related_files, related_concepts, parent_event_id,
-			intent, keywords, entities, categories,
-			importance_score, relevance_score,
-			created_at, updated_at
+		SELECT` + eventColumns + `
 		FROM timeline_events
 		WHERE 1=1`
 
@@ -639,3 +675,145 @@ func (engine *TimescaleDBEngine) StoreEvent(ctx context.Context, event *Timeline
 	log.Printf("✅ 时间线事件存储成功 - ID: %s, 标题: %s", event.ID, event.Title)
 	return event.ID, nil
 }
+
+// DeleteEvent 删除指定ID的时间线事件，userID非空时仅删除该用户的事件
+func (engine *TimescaleDBEngine) DeleteEvent(ctx context.Context, eventID string, userID string) (int64, error) {
+	deleteSQL := `DELETE FROM timeline_events WHERE id = $1`
+	args := []interface{}{eventID}
+	if userID != "" {
+		deleteSQL += ` AND user_id = $2`
+		args = append(args, userID)
+	}
+
+	result, err := engine.db.ExecContext(ctx, deleteSQL, args...)
+	if err != nil {
+		return 0, fmt.Errorf("删除时间线事件失败: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取删除行数失败: %w", err)
+	}
+
+	log.Printf("🗑️ 时间线事件删除完成 - ID: %s, 删除数: %d", eventID, deleted)
+	return deleted, nil
+}
+
+// UpdateEventContent 更新指定ID的时间线事件内容和摘要，只更新该用户的事件，返回更新的事件数
+func (engine *TimescaleDBEngine) UpdateEventContent(ctx context.Context, eventID, userID, content, summary string) (int64, error) {
+	if userID == "" {
+		return 0, fmt.Errorf("用户ID不能为空")
+	}
+
+	updateSQL := `UPDATE timeline_events SET content = $1, summary = $2, updated_at = NOW() WHERE id = $3 AND user_id = $4`
+	result, err := engine.db.ExecContext(ctx, updateSQL, content, summary, eventID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("更新时间线事件失败: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取更新行数失败: %w", err)
+	}
+
+	log.Printf("✏️ 时间线事件更新完成 - ID: %s, 更新数: %d", eventID, updated)
+	return updated, nil
+}
+
+// DeleteUserEvents 删除用户的全部时间线事件，返回删除的事件数
+func (engine *TimescaleDBEngine) DeleteUserEvents(ctx context.Context, userID string) (int64, error) {
+	if userID == "" {
+		return 0, fmt.Errorf("用户ID不能为空")
+	}
+
+	result, err := engine.db.ExecContext(ctx, `DELETE FROM timeline_events WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("删除用户时间线事件失败: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取删除行数失败: %w", err)
+	}
+
+	log.Printf("🗑️ 用户时间线事件删除完成 - 用户: %s, 删除数: %d", userID, deleted)
+	return deleted, nil
+}
+
+// QueryTimeRange 按时间窗口查询用户的时间线事件，结果按时间正序排列
+// 使用query中的UserID、WorkspaceID、StartTime、EndTime、EventTypes和Limit，
+// 同时返回时间窗口内按事件类型统计的数量（不受Limit限制）
+func (engine *TimescaleDBEngine) QueryTimeRange(ctx context.Context, query *TimelineQuery) (*TimelineResult, error) {
+	if query.UserID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	if query.StartTime.IsZero() || query.EndTime.IsZero() || query.EndTime.Before(query.StartTime) {
+		return nil, fmt.Errorf("无效的时间范围: %v - %v", query.StartTime, query.EndTime)
+	}
+
+	whereClause, args := timeRangeConditions(query)
+
+	// 按事件类型统计
+	countSQL := "SELECT event_type, COUNT(*) FROM timeline_events WHERE " + whereClause + " GROUP BY event_type"
+	countRows, err := engine.db.QueryContext(ctx, countSQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("统计事件类型失败: %w", err)
+	}
+	defer countRows.Close()
+
+	eventTypeCounts := make(map[string]int)
+	total := 0
+	for countRows.Next() {
+		var eventType string
+		var count int
+		if err := countRows.Scan(&eventType, &count); err != nil {
+			return nil, fmt.Errorf("解析事件类型统计失败: %w", err)
+		}
+		eventTypeCounts[eventType] = count
+		total += count
+	}
+	if err := countRows.Err(); err != nil {
+		return nil, fmt.Errorf("事件类型统计遍历失败: %w", err)
+	}
+
+	// 查询事件明细
+	selectSQL := "SELECT" + eventColumns + " FROM timeline_events WHERE " + whereClause +
+		fmt.Sprintf(" ORDER BY timestamp ASC LIMIT $%d", len(args)+1)
+	rows, err := engine.db.QueryContext(ctx, selectSQL, append(args, query.Limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("执行时间范围查询失败: %w", err)
+	}
+	defer rows.Close()
+
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🕒 时间范围查询完成 - 用户: %s, 时间: %s ~ %s, 返回: %d, 总数: %d",
+		query.UserID, query.StartTime.Format("2006-01-02 15:04:05"), query.EndTime.Format("2006-01-02 15:04:05"),
+		len(events), total)
+
+	return &TimelineResult{
+		Events:          events,
+		Total:           total,
+		EventTypeCounts: eventTypeCounts,
+	}, nil
+}
+
+// timeRangeConditions 生成时间范围查询的WHERE条件和参数：用户和时间范围必选，工作空间和事件类型非空时过滤
+// 时间条件放在最前面，命中hypertable的时间分区和(user_id, timestamp)索引
+func timeRangeConditions(query *TimelineQuery) (string, []interface{}) {
+	conditions := []string{"user_id = $1", "timestamp >= $2", "timestamp <= $3"}
+	args := []interface{}{query.UserID, query.StartTime, query.EndTime}
+
+	if query.WorkspaceID != "" {
+		args = append(args, query.WorkspaceID)
+		conditions = append(conditions, fmt.Sprintf("workspace_id = $%d", len(args)))
+	}
+	if len(query.EventTypes) > 0 {
+		args = append(args, pq.Array(query.EventTypes))
+		conditions = append(conditions, fmt.Sprintf("event_type = ANY($%d)", len(args)))
+	}
+	return strings.Join(conditions, " AND "), args
+}
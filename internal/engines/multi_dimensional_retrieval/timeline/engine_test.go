@@ -0,0 +1,27 @@
+package timeline
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTimeRangeConditions 测试用户和时间范围条件必选，工作空间和事件类型只在非空时过滤，参数序号与条件一致
+func TestTimeRangeConditions(t *testing.T) {
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	where, args := timeRangeConditions(&TimelineQuery{UserID: "user_a", StartTime: from, EndTime: to})
+	if where != "user_id = $1 AND timestamp >= $2 AND timestamp <= $3" || len(args) != 3 {
+		t.Errorf("只有用户和时间范围时条件错误: %s, %v", where, args)
+	}
+
+	where, args = timeRangeConditions(&TimelineQuery{UserID: "user_a", StartTime: from, EndTime: to, EventTypes: []string{"code_edit", "decision"}})
+	if where != "user_id = $1 AND timestamp >= $2 AND timestamp <= $3 AND event_type = ANY($4)" || len(args) != 4 {
+		t.Errorf("事件类型过滤条件错误: %s, %v", where, args)
+	}
+
+	where, args = timeRangeConditions(&TimelineQuery{UserID: "user_a", WorkspaceID: "ws1", StartTime: from, EndTime: to, EventTypes: []string{"decision"}})
+	if where != "user_id = $1 AND timestamp >= $2 AND timestamp <= $3 AND workspace_id = $4 AND event_type = ANY($5)" || len(args) != 5 || args[3] != "ws1" {
+		t.Errorf("工作空间和事件类型过滤条件错误: %s, %v", where, args)
+	}
+}
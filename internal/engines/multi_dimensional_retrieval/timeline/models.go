@@ -92,7 +92,8 @@ type TimelineResult struct {
 	Total  int             `json:"total"`
 
 	// 聚合信息
-	Aggregation *TimelineAggregation `json:"aggregation,omitempty"`
+	Aggregation     *TimelineAggregation `json:"aggregation,omitempty"`
+	EventTypeCounts map[string]int       `json:"event_type_counts,omitempty"` // 按事件类型统计的数量
 }
 
 // TimelineAggregation 时间线聚合结果
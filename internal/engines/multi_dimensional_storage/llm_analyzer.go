@@ -40,7 +40,7 @@ func NewDeepSeekLLMAnalyzer(apiKey string, config *MultiDimensionalStorageConfig
 	}
 
 	analyzer := &DeepSeekLLMAnalyzer{
-		client:   client,
+		client:   llm.GetGlobalFactory().LimitConcurrency(client),
 		template: tmpl,
 		config:   config,
 	}
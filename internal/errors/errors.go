@@ -0,0 +1,113 @@
+// Package errors 定义带稳定错误码的业务错误
+// 错误信息保持本地化，错误码供MCP客户端区分配置错误、资源不存在和可重试的瞬时故障
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+)
+
+// Code 稳定的机器可读错误码，对外协议的一部分，已有取值不要修改
+type Code string
+
+const (
+	CodeVectorStoreUnconfigured Code = "VECTOR_STORE_UNCONFIGURED" // 向量服务未配置
+	CodeSessionNotFound         Code = "SESSION_NOT_FOUND"         // 会话不存在
+	CodeUserNotInitialized      Code = "USER_NOT_INITIALIZED"      // 会话未绑定用户，需先完成用户初始化
+	CodeTransientBackend        Code = "TRANSIENT_BACKEND"         // 后端瞬时故障（超时、5xx、429），可重试
+	CodeInvalidArgument         Code = "INVALID_ARGUMENT"          // 参数错误
+	CodeNotFound                Code = "NOT_FOUND"                 // 资源不存在
+	CodeRateLimited             Code = "RATE_LIMITED"              // 超出限流，可稍后重试
+	CodeRequestInProgress       Code = "REQUEST_IN_PROGRESS"       // 相同幂等键的请求仍在处理，可稍后重试
+	CodeInternal                Code = "INTERNAL"                  // 未分类的内部错误
+)
+
+// Error 带错误码的业务错误
+type Error struct {
+	Code      Code
+	Message   string // 本地化的错误描述
+	Retryable bool   // 客户端是否可以原样重试
+	Err       error  // 底层错误，可为nil
+}
+
+// 预定义的哨兵错误，通过Wrap/WithMessagef派生具体错误，errors.Is按错误码匹配
+var (
+	ErrVectorStoreUnconfigured = New(CodeVectorStoreUnconfigured, "向量服务未配置", false)
+	ErrSessionNotFound         = New(CodeSessionNotFound, "会话不存在", false)
+	ErrUserNotInitialized      = New(CodeUserNotInitialized, "用户未初始化，请先完成用户配置", false)
+	ErrTransientBackend        = New(CodeTransientBackend, "后端服务暂时不可用，请稍后重试", true)
+	ErrInvalidArgument         = New(CodeInvalidArgument, "参数错误", false)
+	ErrNotFound                = New(CodeNotFound, "资源不存在", false)
+	ErrRateLimited             = New(CodeRateLimited, "调用过于频繁", true)
+	ErrRequestInProgress       = New(CodeRequestInProgress, "相同幂等键的请求正在处理中，请稍后重试", true)
+)
+
+// New 创建业务错误
+func New(code Code, message string, retryable bool) *Error {
+	return &Error{Code: code, Message: message, Retryable: retryable}
+}
+
+// Error 实现error接口
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+// Unwrap 返回底层错误
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 按错误码比较，派生出的错误仍能与哨兵错误匹配
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Wrap 以当前错误为模板包装底层错误
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+// WithMessagef 以当前错误为模板替换错误描述
+func (e *Error) WithMessagef(format string, args ...interface{}) *Error {
+	derived := *e
+	derived.Message = fmt.Sprintf(format, args...)
+	return &derived
+}
+
+// As 从错误链中查找业务错误
+func As(err error) (*Error, bool) {
+	var appErr *Error
+	if stderrors.As(err, &appErr) {
+		return appErr, true
+	}
+	return nil, false
+}
+
+// CodeOf 获取错误链中的错误码，没有业务错误时返回CodeInternal
+func CodeOf(err error) Code {
+	if appErr, ok := As(err); ok {
+		return appErr.Code
+	}
+	return CodeInternal
+}
+
+// IsRetryable 错误链中是否有可重试的业务错误
+func IsRetryable(err error) bool {
+	appErr, ok := As(err)
+	return ok && appErr.Retryable
+}
+
+// Response 转换为返回给客户端的错误对象，message为完整的本地化错误信息
+func Response(err error) map[string]interface{} {
+	return map[string]interface{}{
+		"code":      string(CodeOf(err)),
+		"message":   err.Error(),
+		"retryable": IsRetryable(err),
+	}
+}
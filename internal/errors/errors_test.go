@@ -0,0 +1,47 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"testing"
+)
+
+// TestErrorCodeThroughWrapping 测试经过fmt.Errorf包装后仍能取得错误码和是否可重试
+func TestErrorCodeThroughWrapping(t *testing.T) {
+	base := ErrTransientBackend.Wrap(stderrors.New("HTTP 503"))
+	err := fmt.Errorf("存储记忆失败: %w", base)
+
+	if CodeOf(err) != CodeTransientBackend || !IsRetryable(err) {
+		t.Errorf("Expected retryable transient error, got code=%s retryable=%v", CodeOf(err), IsRetryable(err))
+	}
+	if !stderrors.Is(err, ErrTransientBackend) {
+		t.Error("Expected errors.Is to match sentinel by code")
+	}
+	if stderrors.Is(err, ErrSessionNotFound) {
+		t.Error("Expected errors.Is not to match a different code")
+	}
+	if want := "存储记忆失败: 后端服务暂时不可用，请稍后重试: HTTP 503"; err.Error() != want {
+		t.Errorf("Expected message %q, got %q", want, err.Error())
+	}
+
+	notFound := ErrSessionNotFound.WithMessagef("会话不存在: %s", "s1")
+	if !stderrors.Is(notFound, ErrSessionNotFound) || notFound.Error() != "会话不存在: s1" {
+		t.Errorf("Unexpected derived error: %v", notFound)
+	}
+	if ErrSessionNotFound.Message != "会话不存在" {
+		t.Error("Deriving must not modify the sentinel")
+	}
+}
+
+// TestResponse 测试错误对象包含稳定错误码，未分类错误归为INTERNAL
+func TestResponse(t *testing.T) {
+	response := Response(fmt.Errorf("检索失败: %w", ErrVectorStoreUnconfigured))
+	if response["code"] != "VECTOR_STORE_UNCONFIGURED" || response["retryable"] != false ||
+		response["message"] != "检索失败: 向量服务未配置" {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+
+	if response := Response(stderrors.New("boom")); response["code"] != "INTERNAL" {
+		t.Errorf("Expected INTERNAL for untyped error, got %+v", response)
+	}
+}
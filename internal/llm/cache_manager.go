@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"sync"
 	"time"
+
+	"github.com/contextkeeper/service/internal/metrics"
 )
 
 // =============================================================================
@@ -54,14 +56,17 @@ func (cm *CacheManager) Get(key string) interface{} {
 
 	item, exists := cm.cache[key]
 	if !exists {
+		metrics.ObserveCacheLookup("llm", false)
 		return nil
 	}
 
 	if time.Now().After(item.ExpiresAt) {
 		delete(cm.cache, key)
+		metrics.ObserveCacheLookup("llm", false)
 		return nil
 	}
 
+	metrics.ObserveCacheLookup("llm", true)
 	return item.Data
 }
 
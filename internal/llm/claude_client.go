@@ -170,6 +170,11 @@ func (cc *ClaudeClient) StreamComplete(ctx context.Context, req *LLMRequest) (<-
 	return ch, nil
 }
 
+// CompleteStream 增量流式完成（Claude暂未接入SSE，输出一个最终片段）
+func (cc *ClaudeClient) CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error) {
+	return completeAsSingleChunk(ctx, cc, req)
+}
+
 // HealthCheck 健康检查
 func (cc *ClaudeClient) HealthCheck(ctx context.Context) error {
 	req := &LLMRequest{
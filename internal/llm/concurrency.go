@@ -0,0 +1,226 @@
+package llm
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// =============================================================================
+// 并发控制 - 限制同时进行的LLM调用数量，避免触发提供商限流
+// =============================================================================
+
+// DefaultMaxConcurrency 默认的LLM最大并发调用数
+const DefaultMaxConcurrency = 8
+
+// ConcurrencyStats 并发控制统计
+type ConcurrencyStats struct {
+	MaxConcurrency int64 `json:"max_concurrency"` // <=0表示不限制
+	InFlight       int64 `json:"in_flight"`       // 正在进行的调用（按权重计）
+	Queued         int   `json:"queued"`          // 排队等待的调用数
+}
+
+// ConcurrencyLimiter 带FIFO等待队列的加权信号量，并发安全
+type ConcurrencyLimiter struct {
+	mu       sync.Mutex
+	capacity int64
+	inFlight int64
+	waiters  list.List
+}
+
+// limiterWaiter 排队中的获取请求
+type limiterWaiter struct {
+	weight int64
+	ready  chan struct{}
+}
+
+// NewConcurrencyLimiter 创建并发控制器，capacity<=0表示不限制
+func NewConcurrencyLimiter(capacity int64) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{capacity: capacity}
+}
+
+// Acquire 获取weight个并发额度，额度不足时排队等待；ctx取消时退出队列并返回ctx.Err()
+// weight超过总容量时按总容量计，保证单个请求最终能获取到额度
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, weight int64) error {
+	l.mu.Lock()
+	weight = l.normalizeWeight(weight)
+	if l.capacity <= 0 || (l.inFlight+weight <= l.capacity && l.waiters.Len() == 0) {
+		l.inFlight += weight
+		l.mu.Unlock()
+		return nil
+	}
+
+	waiter := &limiterWaiter{weight: weight, ready: make(chan struct{})}
+	element := l.waiters.PushBack(waiter)
+	l.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		select {
+		case <-waiter.ready:
+			// 取消的同时已获取到额度，归还后让后续请求继续
+			l.inFlight -= waiter.weight
+		default:
+			l.waiters.Remove(element)
+		}
+		l.notifyWaiters()
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Release 归还weight个并发额度，须与Acquire的weight一致
+func (l *ConcurrencyLimiter) Release(weight int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight -= l.normalizeWeight(weight)
+	if l.inFlight < 0 {
+		l.inFlight = 0
+	}
+	l.notifyWaiters()
+}
+
+// SetMaxConcurrency 调整最大并发数，<=0表示不限制；调大时立即唤醒排队的请求
+func (l *ConcurrencyLimiter) SetMaxConcurrency(capacity int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.capacity = capacity
+	l.notifyWaiters()
+}
+
+// Stats 获取当前并发统计
+func (l *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return ConcurrencyStats{
+		MaxConcurrency: l.capacity,
+		InFlight:       l.inFlight,
+		Queued:         l.waiters.Len(),
+	}
+}
+
+// normalizeWeight 将权重限制在[1, capacity]之间，调用方需持有锁
+func (l *ConcurrencyLimiter) normalizeWeight(weight int64) int64 {
+	if weight < 1 {
+		weight = 1
+	}
+	if l.capacity > 0 && weight > l.capacity {
+		weight = l.capacity
+	}
+	return weight
+}
+
+// notifyWaiters 按FIFO顺序唤醒额度足够的等待者，调用方需持有锁
+func (l *ConcurrencyLimiter) notifyWaiters() {
+	for {
+		front := l.waiters.Front()
+		if front == nil {
+			return
+		}
+
+		waiter := front.Value.(*limiterWaiter)
+		if l.capacity > 0 && l.inFlight+waiter.weight > l.capacity {
+			// 队首额度不足时不跳过，避免大权重请求饿死
+			return
+		}
+
+		l.inFlight += waiter.weight
+		l.waiters.Remove(front)
+		close(waiter.ready)
+	}
+}
+
+// =============================================================================
+// 并发受限的客户端包装
+// =============================================================================
+
+// concurrencyLimitedClient 在调用底层客户端前获取并发额度
+type concurrencyLimitedClient struct {
+	LLMClient
+	limiter *ConcurrencyLimiter
+}
+
+// WithConcurrencyLimit 包装客户端，所有请求共享limiter的并发额度
+func WithConcurrencyLimit(client LLMClient, limiter *ConcurrencyLimiter) LLMClient {
+	if client == nil || limiter == nil {
+		return client
+	}
+	if _, ok := client.(*concurrencyLimitedClient); ok {
+		return client
+	}
+	return &concurrencyLimitedClient{LLMClient: client, limiter: limiter}
+}
+
+// Complete 单次完成
+func (c *concurrencyLimitedClient) Complete(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	if err := c.limiter.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer c.limiter.Release(1)
+
+	return c.LLMClient.Complete(ctx, req)
+}
+
+// BatchComplete 批量完成（各提供商均为串行处理，占用一个额度）
+func (c *concurrencyLimitedClient) BatchComplete(ctx context.Context, reqs []*LLMRequest) ([]*LLMResponse, error) {
+	if err := c.limiter.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer c.limiter.Release(1)
+
+	return c.LLMClient.BatchComplete(ctx, reqs)
+}
+
+// StreamComplete 流式完成，额度在流结束后归还
+func (c *concurrencyLimitedClient) StreamComplete(ctx context.Context, req *LLMRequest) (<-chan *LLMStreamResponse, error) {
+	if err := c.limiter.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	source, err := c.LLMClient.StreamComplete(ctx, req)
+	if err != nil {
+		c.limiter.Release(1)
+		return nil, err
+	}
+	return forwardUntilClosed(ctx, source, func() { c.limiter.Release(1) }), nil
+}
+
+// CompleteStream 增量流式完成，额度在流结束后归还
+func (c *concurrencyLimitedClient) CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error) {
+	if err := c.limiter.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	source, err := c.LLMClient.CompleteStream(ctx, req)
+	if err != nil {
+		c.limiter.Release(1)
+		return nil, err
+	}
+	return forwardUntilClosed(ctx, source, func() { c.limiter.Release(1) }), nil
+}
+
+// forwardUntilClosed 转发流式结果，源通道关闭后执行done
+// ctx取消后调用方可能不再读取，此时丢弃剩余结果，避免额度无法归还
+func forwardUntilClosed[T any](ctx context.Context, source <-chan T, done func()) <-chan T {
+	out := make(chan T, cap(source))
+	go func() {
+		defer close(out)
+		defer done()
+		for item := range source {
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				for range source {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
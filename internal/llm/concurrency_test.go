@@ -0,0 +1,49 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestConcurrencyLimiter 测试额度不足时排队、ctx取消时退出队列以及归还额度后唤醒等待者
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1)
+	if err := limiter.Acquire(context.Background(), 1); err != nil {
+		t.Fatalf("首次获取额度失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.Acquire(ctx, 1); err == nil {
+		t.Fatal("额度不足且ctx超时时应返回错误")
+	}
+	if stats := limiter.Stats(); stats.InFlight != 1 || stats.Queued != 0 {
+		t.Errorf("ctx取消后应退出队列: %+v", stats)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- limiter.Acquire(context.Background(), 1)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for limiter.Stats().Queued != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待者未进入队列: %+v", limiter.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	limiter.Release(1)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("归还额度后获取失败: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("归还额度后等待者未被唤醒")
+	}
+	if stats := limiter.Stats(); stats.InFlight != 1 || stats.Queued != 0 {
+		t.Errorf("唤醒后统计错误: %+v", stats)
+	}
+}
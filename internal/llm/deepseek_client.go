@@ -29,6 +29,8 @@ type DeepSeekRequest struct {
 	MaxTokens   int               `json:"max_tokens,omitempty"`
 	Temperature float64           `json:"temperature,omitempty"`
 	Stream      bool              `json:"stream,omitempty"`
+
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
 }
 
 // DeepSeekMessage DeepSeek消息格式
@@ -216,6 +218,31 @@ func (dc *DeepSeekClient) StreamComplete(ctx context.Context, req *LLMRequest) (
 	return ch, nil
 }
 
+// CompleteStream 增量流式完成（SSE，与OpenAI协议一致）
+func (dc *DeepSeekClient) CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error) {
+	if err := dc.CheckRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	if err := dc.CheckCircuitBreaker(); err != nil {
+		return nil, err
+	}
+
+	deepseekReq := dc.convertToDeepSeekFormat(req)
+	deepseekReq.Stream = true
+	deepseekReq.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+
+	httpResp, err := dc.sendStreamRequest(ctx, deepseekReq)
+	if err != nil {
+		dc.RecordFailure()
+		return nil, err
+	}
+	dc.RecordSuccess()
+
+	ch := make(chan LLMChunk, 16)
+	go streamSSE(ctx, httpResp.Body, ProviderDeepSeek, parseOpenAIStreamData, ch)
+	return ch, nil
+}
+
 // HealthCheck 健康检查
 func (dc *DeepSeekClient) HealthCheck(ctx context.Context) error {
 	req := &LLMRequest{
@@ -339,3 +366,23 @@ func (dc *DeepSeekClient) sendRequest(ctx context.Context, req *DeepSeekRequest)
 
 	return &resp, nil
 }
+
+// sendStreamRequest 发送流式HTTP请求，建立连接的瞬时失败按MaxRetries重试
+func (dc *DeepSeekClient) sendStreamRequest(ctx context.Context, req *DeepSeekRequest) (*http.Response, error) {
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request failed: %w", err)
+	}
+
+	return dc.openStreamWithRetry(ctx, func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", dc.baseURL+"/chat/completions", bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, fmt.Errorf("create request failed: %w", err)
+		}
+
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Accept", "text/event-stream")
+		httpReq.Header.Set("Authorization", "Bearer "+dc.apiKey)
+		return httpReq, nil
+	})
+}
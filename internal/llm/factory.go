@@ -10,10 +10,12 @@ import (
 // =============================================================================
 
 // LLMFactory LLM客户端工厂
+// 工厂创建的所有客户端共享同一个并发控制器，限制同时进行的LLM调用数量
 type LLMFactory struct {
 	configs  map[LLMProvider]*LLMConfig
 	cache    map[LLMProvider]LLMClient
 	creators map[LLMProvider]ClientCreator
+	limiter  *ConcurrencyLimiter
 	mutex    sync.RWMutex
 }
 
@@ -26,6 +28,7 @@ func NewLLMFactory() *LLMFactory {
 		configs:  make(map[LLMProvider]*LLMConfig),
 		cache:    make(map[LLMProvider]LLMClient),
 		creators: make(map[LLMProvider]ClientCreator),
+		limiter:  NewConcurrencyLimiter(DefaultMaxConcurrency),
 	}
 
 	// 注册默认的客户端创建器
@@ -126,10 +129,26 @@ func (f *LLMFactory) CreateClient(provider LLMProvider) (LLMClient, error) {
 		}
 	}
 
+	client = WithConcurrencyLimit(WithMetrics(client), f.limiter)
 	f.cache[provider] = client
 	return client, nil
 }
 
+// SetMaxConcurrency 设置所有客户端共享的最大并发调用数，<=0表示不限制
+func (f *LLMFactory) SetMaxConcurrency(maxConcurrency int) {
+	f.limiter.SetMaxConcurrency(int64(maxConcurrency))
+}
+
+// ConcurrencyStats 获取当前进行中和排队中的LLM调用数
+func (f *LLMFactory) ConcurrencyStats() ConcurrencyStats {
+	return f.limiter.Stats()
+}
+
+// LimitConcurrency 让工厂外直接创建的客户端也共享工厂的并发额度
+func (f *LLMFactory) LimitConcurrency(client LLMClient) LLMClient {
+	return WithConcurrencyLimit(WithMetrics(client), f.limiter)
+}
+
 // GetClient 获取已创建的客户端
 func (f *LLMFactory) GetClient(provider LLMProvider) (LLMClient, bool) {
 	f.mutex.RLock()
@@ -212,3 +231,13 @@ func SetGlobalConfig(provider LLMProvider, config *LLMConfig) {
 func CreateGlobalClient(provider LLMProvider) (LLMClient, error) {
 	return GetGlobalFactory().CreateClient(provider)
 }
+
+// SetGlobalMaxConcurrency 设置全局LLM最大并发调用数
+func SetGlobalMaxConcurrency(maxConcurrency int) {
+	GetGlobalFactory().SetMaxConcurrency(maxConcurrency)
+}
+
+// GetGlobalConcurrencyStats 获取全局LLM并发统计
+func GetGlobalConcurrencyStats() ConcurrencyStats {
+	return GetGlobalFactory().ConcurrencyStats()
+}
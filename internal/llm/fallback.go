@@ -0,0 +1,183 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/contextkeeper/service/internal/metrics"
+)
+
+// =============================================================================
+// 多提供商降级链 - 主提供商出现瞬时故障时按顺序尝试备用提供商
+// =============================================================================
+
+// FallbackSpec 降级链中的一个提供商配置，Model为空时使用该提供商客户端的默认模型
+type FallbackSpec struct {
+	Provider LLMProvider
+	Model    string
+}
+
+// ParseFallbackProviders 解析备用提供商列表，格式为 provider[:model]，逗号分隔，如 "openai:gpt-4o-mini,qianwen"
+func ParseFallbackProviders(spec string) ([]FallbackSpec, error) {
+	var specs []FallbackSpec
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		provider, model, _ := strings.Cut(item, ":")
+		provider, model = strings.TrimSpace(provider), strings.TrimSpace(model)
+		if provider == "" {
+			return nil, fmt.Errorf("备用LLM提供商配置格式错误: %q", item)
+		}
+		specs = append(specs, FallbackSpec{Provider: LLMProvider(provider), Model: model})
+	}
+	return specs, nil
+}
+
+// FallbackTarget 降级链中已创建的客户端，Model为请求该提供商时使用的模型
+type FallbackTarget struct {
+	Client LLMClient
+	Model  string
+}
+
+// fallbackClient 依次尝试主提供商和备用提供商
+// 所有尝试共享调用方的ctx，请求截止时间到达后不再尝试下一个提供商，避免超时时间成倍增加
+type fallbackClient struct {
+	LLMClient
+	targets []FallbackTarget // 第一个为主提供商
+}
+
+// WithFallback 包装主客户端，主提供商瞬时故障时按顺序尝试fallbacks；没有备用提供商时原样返回
+// primaryModel为空表示保持请求中的模型不变
+func WithFallback(primary LLMClient, primaryModel string, fallbacks []FallbackTarget) LLMClient {
+	if primary == nil || len(fallbacks) == 0 {
+		return primary
+	}
+	targets := append([]FallbackTarget{{Client: primary, Model: primaryModel}}, fallbacks...)
+	return &fallbackClient{LLMClient: primary, targets: targets}
+}
+
+// Complete 单次完成
+func (c *fallbackClient) Complete(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	return callWithFallback(ctx, c.targets, "complete", func(client LLMClient, model string) (*LLMResponse, error) {
+		return client.Complete(ctx, withModel(req, model))
+	})
+}
+
+// BatchComplete 批量完成
+func (c *fallbackClient) BatchComplete(ctx context.Context, reqs []*LLMRequest) ([]*LLMResponse, error) {
+	return callWithFallback(ctx, c.targets, "batch_complete", func(client LLMClient, model string) ([]*LLMResponse, error) {
+		mapped := make([]*LLMRequest, len(reqs))
+		for i, req := range reqs {
+			mapped[i] = withModel(req, model)
+		}
+		return client.BatchComplete(ctx, mapped)
+	})
+}
+
+// StreamComplete 流式完成，只在建立流失败时降级
+func (c *fallbackClient) StreamComplete(ctx context.Context, req *LLMRequest) (<-chan *LLMStreamResponse, error) {
+	return callWithFallback(ctx, c.targets, "stream_complete", func(client LLMClient, model string) (<-chan *LLMStreamResponse, error) {
+		return client.StreamComplete(ctx, withModel(req, model))
+	})
+}
+
+// CompleteStream 增量流式完成，只在建立流失败时降级
+func (c *fallbackClient) CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error) {
+	return callWithFallback(ctx, c.targets, "complete_stream", func(client LLMClient, model string) (<-chan LLMChunk, error) {
+		return client.CompleteStream(ctx, withModel(req, model))
+	})
+}
+
+// callWithFallback 依次调用各提供商，遇到非瞬时错误或ctx结束时立即返回
+func callWithFallback[T any](ctx context.Context, targets []FallbackTarget, method string, call func(client LLMClient, model string) (T, error)) (T, error) {
+	var zero T
+	var errs []error
+	for i, target := range targets {
+		provider := target.Client.GetProvider()
+		result, err := call(target.Client, target.Model)
+		if err == nil {
+			if i > 0 {
+				log.Printf("🔀 [LLM降级] %s 由备用提供商 %s 完成（第%d个提供商）", method, provider, i+1)
+			}
+			return result, nil
+		}
+
+		recordProviderFailure(provider)
+		errs = append(errs, fmt.Errorf("%s: %w", provider, err))
+		if ctx.Err() != nil || !IsTransientLLMError(err) || i == len(targets)-1 {
+			break
+		}
+		log.Printf("⚠️ [LLM降级] 提供商 %s 调用失败，尝试下一个提供商 %s: %v", provider, targets[i+1].Client.GetProvider(), err)
+	}
+	return zero, errors.Join(errs...)
+}
+
+// withModel 返回使用指定模型的请求副本，model为空时使用该提供商客户端的默认模型
+func withModel(req *LLMRequest, model string) *LLMRequest {
+	if req == nil || req.Model == model {
+		return req
+	}
+	copied := *req
+	copied.Model = model
+	return &copied
+}
+
+// transientHTTPStatusPattern 无法解析错误体时客户端返回的"HTTP 状态码"形式的错误
+var transientHTTPStatusPattern = regexp.MustCompile(`HTTP (429|5\d\d)\b`)
+
+// IsTransientLLMError 判断LLM调用错误是否为瞬时故障（网络错误、超时、5xx/429），瞬时故障时可以换用备用提供商
+func IsTransientLLMError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var llmErr *LLMError
+	if errors.As(err, &llmErr) {
+		return llmErr.Retryable
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	return transientHTTPStatusPattern.MatchString(err.Error())
+}
+
+// providerFailures 各提供商在降级链中的累计失败次数
+var providerFailures = struct {
+	sync.Mutex
+	counts map[string]int64
+}{counts: make(map[string]int64)}
+
+// recordProviderFailure 记录一次提供商调用失败
+func recordProviderFailure(provider LLMProvider) {
+	providerFailures.Lock()
+	providerFailures.counts[string(provider)]++
+	providerFailures.Unlock()
+	metrics.LLMProviderFailures.Inc(string(provider))
+}
+
+// GetProviderFailureCounts 获取降级链中各提供商的累计失败次数，用于观察提供商是否频繁抖动
+func GetProviderFailureCounts() map[string]int64 {
+	providerFailures.Lock()
+	defer providerFailures.Unlock()
+	counts := make(map[string]int64, len(providerFailures.counts))
+	for provider, count := range providerFailures.counts {
+		counts[provider] = count
+	}
+	return counts
+}
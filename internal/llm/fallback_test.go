@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fallbackStubClient 返回固定错误并记录收到的模型
+type fallbackStubClient struct {
+	*MockLLMClient
+	err    error
+	models []string
+}
+
+func (c *fallbackStubClient) Complete(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	c.models = append(c.models, req.Model)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &LLMResponse{Content: "ok", Model: req.Model, Provider: c.provider}, nil
+}
+
+// TestFallbackClient 测试瞬时故障时改用备用提供商及其模型、非瞬时错误和请求已超时时不再降级
+func TestFallbackClient(t *testing.T) {
+	transient := &LLMError{Provider: ProviderDeepSeek, Code: "HTTP_503", Message: "unavailable", Retryable: true}
+	newChain := func(primaryErr error) (LLMClient, *fallbackStubClient, *fallbackStubClient) {
+		primary := &fallbackStubClient{MockLLMClient: NewMockLLMClient(ProviderDeepSeek), err: primaryErr}
+		backup := &fallbackStubClient{MockLLMClient: NewMockLLMClient(ProviderOpenAI)}
+		return WithFallback(primary, "deepseek-chat", []FallbackTarget{{Client: backup, Model: "gpt-4o-mini"}}), primary, backup
+	}
+	req := &LLMRequest{Prompt: "hi", Model: "deepseek-chat"}
+
+	client, _, backup := newChain(transient)
+	before := GetProviderFailureCounts()[string(ProviderDeepSeek)]
+	resp, err := client.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatalf("瞬时故障时应由备用提供商完成: %v", err)
+	}
+	if resp.Provider != ProviderOpenAI || resp.Model != "gpt-4o-mini" {
+		t.Errorf("应使用备用提供商及其模型: %+v", resp)
+	}
+	if req.Model != "deepseek-chat" {
+		t.Errorf("不应修改调用方的请求: %s", req.Model)
+	}
+	if got := GetProviderFailureCounts()[string(ProviderDeepSeek)]; got != before+1 {
+		t.Errorf("主提供商失败次数应加1: %d -> %d", before, got)
+	}
+
+	client, _, backup = newChain(errors.New("HTTP 401: invalid api key"))
+	if _, err := client.Complete(context.Background(), req); err == nil || len(backup.models) != 0 {
+		t.Errorf("非瞬时错误不应降级: err=%v, 备用调用=%v", err, backup.models)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client, _, backup = newChain(ctx.Err())
+	if _, err := client.Complete(ctx, req); err == nil || len(backup.models) != 0 {
+		t.Errorf("请求已结束时不应尝试备用提供商: err=%v, 备用调用=%v", err, backup.models)
+	}
+}
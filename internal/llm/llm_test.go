@@ -17,11 +17,20 @@ func TestLLMFactory(t *testing.T) {
 
 	// 测试注册提供商
 	providers := factory.ListProviders()
-	expectedProviders := []LLMProvider{ProviderOpenAI, ProviderClaude, ProviderQianwen, ProviderDeepSeek}
+	expectedProviders := []LLMProvider{ProviderOpenAI, ProviderClaude, ProviderQianwen, ProviderDeepSeek, ProviderOllamaLocal}
 
 	if len(providers) != len(expectedProviders) {
 		t.Errorf("Expected %d providers, got %d", len(expectedProviders), len(providers))
 	}
+	registered := make(map[LLMProvider]bool)
+	for _, provider := range providers {
+		registered[provider] = true
+	}
+	for _, provider := range expectedProviders {
+		if !registered[provider] {
+			t.Errorf("Expected provider %s to be registered", provider)
+		}
+	}
 
 	// 测试配置设置
 	config := &LLMConfig{
@@ -352,6 +361,10 @@ func (m *MockLLMClient) StreamComplete(ctx context.Context, req *LLMRequest) (<-
 	return ch, nil
 }
 
+func (m *MockLLMClient) CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error) {
+	return completeAsSingleChunk(ctx, m, req)
+}
+
 func (m *MockLLMClient) HealthCheck(ctx context.Context) error {
 	if m.shouldFail {
 		return &LLMError{Provider: m.provider, Code: "HEALTH_CHECK_FAILED", Message: "Health check failed"}
@@ -363,6 +376,10 @@ func (m *MockLLMClient) GetProvider() LLMProvider {
 	return m.provider
 }
 
+func (m *MockLLMClient) GetModel() string {
+	return "mock-model"
+}
+
 func (m *MockLLMClient) GetCapabilities() *LLMCapabilities {
 	return &LLMCapabilities{
 		MaxTokens:         4096,
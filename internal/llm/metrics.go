@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"time"
+
+	"github.com/contextkeeper/service/internal/metrics"
+)
+
+// =============================================================================
+// 指标采集的客户端包装 - 记录每个提供商的调用次数与耗时
+// =============================================================================
+
+// instrumentedClient 在调用底层客户端时记录调用指标
+type instrumentedClient struct {
+	LLMClient
+}
+
+// WithMetrics 包装客户端以记录调用指标，已包装（包括已受并发控制）的客户端原样返回
+func WithMetrics(client LLMClient) LLMClient {
+	switch client.(type) {
+	case nil, *instrumentedClient, *concurrencyLimitedClient:
+		return client
+	}
+	return &instrumentedClient{LLMClient: client}
+}
+
+// observe 记录一次调用
+func (c *instrumentedClient) observe(method string, start time.Time, err error) {
+	metrics.ObserveLLMCall(string(c.GetProvider()), method, err, time.Since(start))
+}
+
+// Complete 单次完成
+func (c *instrumentedClient) Complete(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	start := time.Now()
+	resp, err := c.LLMClient.Complete(ctx, req)
+	c.observe("complete", start, err)
+	return resp, err
+}
+
+// BatchComplete 批量完成
+func (c *instrumentedClient) BatchComplete(ctx context.Context, reqs []*LLMRequest) ([]*LLMResponse, error) {
+	start := time.Now()
+	resps, err := c.LLMClient.BatchComplete(ctx, reqs)
+	c.observe("batch_complete", start, err)
+	return resps, err
+}
+
+// StreamComplete 流式完成，只统计到建立流为止
+func (c *instrumentedClient) StreamComplete(ctx context.Context, req *LLMRequest) (<-chan *LLMStreamResponse, error) {
+	start := time.Now()
+	stream, err := c.LLMClient.StreamComplete(ctx, req)
+	c.observe("stream_complete", start, err)
+	return stream, err
+}
+
+// CompleteStream 增量流式完成，只统计到建立流为止
+func (c *instrumentedClient) CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error) {
+	start := time.Now()
+	stream, err := c.LLMClient.CompleteStream(ctx, req)
+	c.observe("complete_stream", start, err)
+	return stream, err
+}
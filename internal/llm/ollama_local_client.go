@@ -252,6 +252,11 @@ func (oc *OllamaLocalClient) StreamComplete(ctx context.Context, req *LLMRequest
 	return ch, nil
 }
 
+// CompleteStream 增量流式完成（本地模型输出一个最终片段）
+func (oc *OllamaLocalClient) CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error) {
+	return completeAsSingleChunk(ctx, oc, req)
+}
+
 // HealthCheck 健康检查
 func (oc *OllamaLocalClient) HealthCheck(ctx context.Context) error {
 	// 检查Ollama服务是否可用
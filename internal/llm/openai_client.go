@@ -29,6 +29,13 @@ type OpenAIRequest struct {
 	MaxTokens   int             `json:"max_tokens,omitempty"`
 	Temperature float64         `json:"temperature,omitempty"`
 	Stream      bool            `json:"stream,omitempty"`
+
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+// OpenAIStreamOptions OpenAI流式选项
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // OpenAIMessage OpenAI消息格式
@@ -175,6 +182,31 @@ func (oc *OpenAIClient) StreamComplete(ctx context.Context, req *LLMRequest) (<-
 	return ch, nil
 }
 
+// CompleteStream 增量流式完成（SSE）
+func (oc *OpenAIClient) CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error) {
+	if err := oc.CheckRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	if err := oc.CheckCircuitBreaker(); err != nil {
+		return nil, err
+	}
+
+	openaiReq := oc.convertToOpenAIFormat(req)
+	openaiReq.Stream = true
+	openaiReq.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+
+	httpResp, err := oc.sendStreamRequest(ctx, openaiReq)
+	if err != nil {
+		oc.RecordFailure()
+		return nil, err
+	}
+	oc.RecordSuccess()
+
+	ch := make(chan LLMChunk, 16)
+	go streamSSE(ctx, httpResp.Body, ProviderOpenAI, parseOpenAIStreamData, ch)
+	return ch, nil
+}
+
 // HealthCheck 健康检查
 func (oc *OpenAIClient) HealthCheck(ctx context.Context) error {
 	req := &LLMRequest{
@@ -237,8 +269,10 @@ func (oc *OpenAIClient) convertFromOpenAIFormat(resp *OpenAIResponse, duration t
 		Provider:   ProviderOpenAI,
 		Duration:   duration,
 		Metadata: map[string]interface{}{
-			"id":            resp.ID,
-			"finish_reason": resp.Choices[0].FinishReason,
+			"id":                resp.ID,
+			"finish_reason":     resp.Choices[0].FinishReason,
+			"prompt_tokens":     resp.Usage.PromptTokens,
+			"completion_tokens": resp.Usage.CompletionTokens,
 		},
 	}
 }
@@ -296,3 +330,23 @@ func (oc *OpenAIClient) sendRequest(ctx context.Context, req *OpenAIRequest) (*O
 
 	return &resp, nil
 }
+
+// sendStreamRequest 发送流式HTTP请求，建立连接的瞬时失败按MaxRetries重试
+func (oc *OpenAIClient) sendStreamRequest(ctx context.Context, req *OpenAIRequest) (*http.Response, error) {
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request failed: %w", err)
+	}
+
+	return oc.openStreamWithRetry(ctx, func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", oc.baseURL+"/chat/completions", bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, fmt.Errorf("create request failed: %w", err)
+		}
+
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Accept", "text/event-stream")
+		httpReq.Header.Set("Authorization", "Bearer "+oc.apiKey)
+		return httpReq, nil
+	})
+}
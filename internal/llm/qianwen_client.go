@@ -45,6 +45,8 @@ type QianwenParameters struct {
 	MaxTokens   int     `json:"max_tokens,omitempty"`
 	Temperature float64 `json:"temperature,omitempty"`
 	TopP        float64 `json:"top_p,omitempty"`
+
+	IncrementalOutput bool `json:"incremental_output,omitempty"` // 流式输出时只返回增量内容
 }
 
 // QianwenResponse 千问响应格式
@@ -175,6 +177,30 @@ func (qc *QianwenClient) StreamComplete(ctx context.Context, req *LLMRequest) (<
 	return ch, nil
 }
 
+// CompleteStream 增量流式完成（DashScope SSE）
+func (qc *QianwenClient) CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error) {
+	if err := qc.CheckRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	if err := qc.CheckCircuitBreaker(); err != nil {
+		return nil, err
+	}
+
+	qianwenReq := qc.convertToQianwenFormat(req)
+	qianwenReq.Parameters.IncrementalOutput = true
+
+	httpResp, err := qc.sendStreamRequest(ctx, qianwenReq)
+	if err != nil {
+		qc.RecordFailure()
+		return nil, err
+	}
+	qc.RecordSuccess()
+
+	ch := make(chan LLMChunk, 16)
+	go streamSSE(ctx, httpResp.Body, ProviderQianwen, parseQianwenStreamData, ch)
+	return ch, nil
+}
+
 // HealthCheck 健康检查
 func (qc *QianwenClient) HealthCheck(ctx context.Context) error {
 	req := &LLMRequest{
@@ -298,3 +324,33 @@ func (qc *QianwenClient) sendRequest(ctx context.Context, req *QianwenRequest) (
 
 	return &resp, nil
 }
+
+// sendStreamRequest 发送流式HTTP请求，建立连接的瞬时失败按MaxRetries重试
+func (qc *QianwenClient) sendStreamRequest(ctx context.Context, req *QianwenRequest) (*http.Response, error) {
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request failed: %w", err)
+	}
+
+	return qc.openStreamWithRetry(ctx, func() (*http.Request, error) {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", qc.baseURL+"/services/aigc/text-generation/generation", bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, fmt.Errorf("create request failed: %w", err)
+		}
+
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Accept", "text/event-stream")
+		httpReq.Header.Set("Authorization", "Bearer "+qc.apiKey)
+		httpReq.Header.Set("X-DashScope-SSE", "enable")
+		return httpReq, nil
+	})
+}
+
+// parseQianwenStreamData 解析千问SSE data负载
+func parseQianwenStreamData(data []byte) (string, int, error) {
+	var chunk QianwenResponse
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return "", 0, err
+	}
+	return chunk.Output.Text, chunk.Usage.TotalTokens, nil
+}
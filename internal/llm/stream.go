@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// 流式输出公共实现
+// =============================================================================
+
+// sseDataParser 解析单条SSE data负载，返回增量内容和token用量（未返回时为0）
+type sseDataParser func(data []byte) (delta string, tokensUsed int, err error)
+
+// streamSSE 读取SSE响应体并逐条输出增量片段，结束时输出一个带完整内容的Done片段
+// 增量片段只携带Delta，累计内容只在结束或出错时生成一次；上下文取消时尽力输出一个错误片段后关闭通道
+func streamSSE(ctx context.Context, body io.ReadCloser, provider LLMProvider, parse sseDataParser, ch chan<- LLMChunk) {
+	defer close(ch)
+	defer body.Close()
+
+	var content strings.Builder
+	tokensUsed := 0
+
+	send := func(chunk LLMChunk) bool {
+		select {
+		case ch <- chunk:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	fail := func(err error) {
+		select {
+		case ch <- LLMChunk{Content: content.String(), Provider: provider, Error: err}:
+		default:
+		}
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			break
+		}
+
+		delta, tokens, err := parse([]byte(data))
+		if err != nil {
+			fail(fmt.Errorf("parse stream chunk failed: %w", err))
+			return
+		}
+		if tokens > 0 {
+			tokensUsed = tokens
+		}
+		if delta == "" {
+			continue
+		}
+
+		content.WriteString(delta)
+		if !send(LLMChunk{Delta: delta, Provider: provider}) {
+			fail(ctx.Err())
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		fail(fmt.Errorf("read stream failed: %w", err))
+		return
+	}
+
+	send(LLMChunk{
+		Content:    content.String(),
+		Done:       true,
+		TokensUsed: tokensUsed,
+		Provider:   provider,
+	})
+}
+
+// 建立流式连接失败重试时的首次等待时间和等待上限
+const (
+	streamRetryBaseDelay = 500 * time.Millisecond
+	streamRetryMaxDelay  = 4 * time.Second
+)
+
+// openStreamWithRetry 建立流式连接，瞬时错误（网络错误、超时、429、5xx）按配置的MaxRetries指数退避重试
+// 只重试建立连接阶段：流开始输出后的中断不重试，避免重复输出已发送的增量片段；每次尝试由newRequest创建新请求
+func (ba *BaseAdapter) openStreamWithRetry(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	maxRetries := 0
+	if ba.config != nil && ba.config.MaxRetries > 0 {
+		maxRetries = ba.config.MaxRetries
+	}
+
+	delay := streamRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		httpReq, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		httpResp, err := openStream(ba.httpClient, httpReq)
+		if err == nil || attempt >= maxRetries || ctx.Err() != nil || !IsTransientLLMError(err) {
+			return httpResp, err
+		}
+
+		log.Printf("🔁 [LLM流式] %s 建立流式连接失败，%v后第%d/%d次重试: %v", ba.provider, delay, attempt+1, maxRetries, err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("等待重试时上下文已结束: %w", err)
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > streamRetryMaxDelay {
+			delay = streamRetryMaxDelay
+		}
+	}
+}
+
+// openStream 发送流式请求，状态码非200时读取错误内容并返回
+func openStream(httpClient *http.Client, httpReq *http.Request) (*http.Response, error) {
+	httpResp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request failed: %w", err)
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		defer httpResp.Body.Close()
+		respBody, _ := io.ReadAll(httpResp.Body)
+		return nil, fmt.Errorf("HTTP %d: %s", httpResp.StatusCode, string(respBody))
+	}
+
+	return httpResp, nil
+}
+
+// openAIStreamChunk OpenAI兼容协议的流式片段（OpenAI、DeepSeek共用）
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// parseOpenAIStreamData 解析OpenAI兼容协议的SSE data负载
+func parseOpenAIStreamData(data []byte) (string, int, error) {
+	var chunk openAIStreamChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return "", 0, err
+	}
+
+	delta := ""
+	if len(chunk.Choices) > 0 {
+		delta = chunk.Choices[0].Delta.Content
+	}
+	tokensUsed := 0
+	if chunk.Usage != nil {
+		tokensUsed = chunk.Usage.TotalTokens
+	}
+	return delta, tokensUsed, nil
+}
+
+// completeAsSingleChunk 不支持流式的提供商调用Complete后输出一个最终片段
+func completeAsSingleChunk(ctx context.Context, client LLMClient, req *LLMRequest) (<-chan LLMChunk, error) {
+	ch := make(chan LLMChunk, 1)
+
+	go func() {
+		defer close(ch)
+
+		resp, err := client.Complete(ctx, req)
+		if err != nil {
+			ch <- LLMChunk{Provider: client.GetProvider(), Error: err}
+			return
+		}
+
+		ch <- LLMChunk{
+			Delta:      resp.Content,
+			Content:    resp.Content,
+			Done:       true,
+			TokensUsed: resp.TokensUsed,
+			Provider:   client.GetProvider(),
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newStreamTestConfig(baseURL string) *LLMConfig {
+	return &LLMConfig{
+		APIKey:    "test-key",
+		BaseURL:   baseURL,
+		Timeout:   10 * time.Second,
+		RateLimit: 60,
+	}
+}
+
+func TestDeepSeekCompleteStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{`{\"a\":`, ` \"{b}\"`, `}`} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":\"%s\"}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"total_tokens\":42}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, err := NewDeepSeekClient(newStreamTestConfig(server.URL))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	chunks, err := client.CompleteStream(context.Background(), &LLMRequest{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("CompleteStream failed: %v", err)
+	}
+
+	var deltas int
+	var final LLMChunk
+	for chunk := range chunks {
+		if chunk.Error != nil {
+			t.Fatalf("Unexpected chunk error: %v", chunk.Error)
+		}
+		if chunk.Done {
+			final = chunk
+			continue
+		}
+		deltas++
+	}
+
+	if deltas != 3 {
+		t.Errorf("Expected 3 delta chunks, got %d", deltas)
+	}
+	if !final.Done || final.Content != `{"a": "{b}"}` {
+		t.Errorf("Unexpected final chunk: %+v", final)
+	}
+	if final.TokensUsed != 42 {
+		t.Errorf("Expected 42 tokens, got %d", final.TokensUsed)
+	}
+}
+
+func TestCompleteStreamContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"partial\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := NewOpenAIClient(newStreamTestConfig(server.URL))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks, err := client.CompleteStream(ctx, &LLMRequest{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("CompleteStream failed: %v", err)
+	}
+
+	first := <-chunks
+	if first.Delta != "partial" {
+		t.Fatalf("Unexpected first chunk: %+v", first)
+	}
+	cancel()
+
+	for chunk := range chunks {
+		if chunk.Done {
+			t.Errorf("Did not expect a final chunk after cancellation")
+		}
+	}
+}
+
+func TestQianwenStreamData(t *testing.T) {
+	delta, tokens, err := parseQianwenStreamData([]byte(`{"output":{"text":"你好","finish_reason":"null"},"usage":{"total_tokens":7}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if delta != "你好" || tokens != 7 {
+		t.Errorf("Unexpected parse result: %q, %d", delta, tokens)
+	}
+}
+
+func TestSingleChunkStream(t *testing.T) {
+	mock := NewMockLLMClient(ProviderClaude)
+	chunks, err := mock.CompleteStream(context.Background(), &LLMRequest{Prompt: "hello"})
+	if err != nil {
+		t.Fatalf("CompleteStream failed: %v", err)
+	}
+
+	var received []LLMChunk
+	for chunk := range chunks {
+		received = append(received, chunk)
+	}
+	if len(received) != 1 || !received[0].Done {
+		t.Errorf("Expected exactly one final chunk, got %+v", received)
+	}
+}
+
+func TestCompleteStreamRetriesSetup(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	config := newStreamTestConfig(server.URL)
+	config.MaxRetries = 1
+	client, err := NewOpenAIClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	chunks, err := client.CompleteStream(context.Background(), &LLMRequest{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("Expected stream setup to succeed after retry: %v", err)
+	}
+	var final LLMChunk
+	for chunk := range chunks {
+		final = chunk
+	}
+	if attempts != 2 || !final.Done || final.Content != "ok" {
+		t.Errorf("Unexpected result: attempts=%d, final=%+v", attempts, final)
+	}
+
+	// 未配置重试时建立连接失败直接返回
+	attempts = 0
+	client, _ = NewOpenAIClient(newStreamTestConfig(server.URL))
+	if _, err := client.CompleteStream(context.Background(), &LLMRequest{Prompt: "hi"}); err == nil || attempts != 1 {
+		t.Errorf("Expected immediate failure without retries: attempts=%d, err=%v", attempts, err)
+	}
+}
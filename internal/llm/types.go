@@ -50,6 +50,16 @@ type LLMStreamResponse struct {
 	Error    error       `json:"error,omitempty"`
 }
 
+// LLMChunk 增量流式输出片段
+type LLMChunk struct {
+	Delta      string      `json:"delta"`                 // 本次增量内容
+	Content    string      `json:"content"`               // 累计的完整内容，只在最终片段和错误片段上设置
+	Done       bool        `json:"done"`                  // 是否为最终片段
+	TokensUsed int         `json:"tokens_used,omitempty"` // 最终片段上的token用量（提供商返回时）
+	Provider   LLMProvider `json:"provider"`
+	Error      error       `json:"error,omitempty"`
+}
+
 // LLMCapabilities LLM能力描述
 type LLMCapabilities struct {
 	MaxTokens         int      `json:"max_tokens"`
@@ -104,6 +114,10 @@ type LLMClient interface {
 	// 流式完成
 	StreamComplete(ctx context.Context, req *LLMRequest) (<-chan *LLMStreamResponse, error)
 
+	// 增量流式完成（SSE），不支持流式的提供商只输出一个最终片段
+	// 只有建立连接阶段的瞬时失败按MaxRetries重试，流开始输出后的中断通过错误片段返回，不会自动重试
+	CompleteStream(ctx context.Context, req *LLMRequest) (<-chan LLMChunk, error)
+
 	// 健康检查
 	HealthCheck(ctx context.Context) error
 
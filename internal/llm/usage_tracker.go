@@ -0,0 +1,223 @@
+package llm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Token用量与费用统计
+// =============================================================================
+
+// TokenPrice 每1K token的价格
+type TokenPrice struct {
+	PromptPer1K     float64 `json:"prompt_per_1k"`
+	CompletionPer1K float64 `json:"completion_per_1k"`
+}
+
+// UsageStats 累计用量
+// 提供商未区分输入/输出时，TotalTokens中无法拆分的部分按输出价格估算
+type UsageStats struct {
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	EstimatedCost    float64 `json:"estimated_cost"`
+}
+
+// UsageSnapshot 用量快照
+type UsageSnapshot struct {
+	Since      time.Time             `json:"since"`
+	Total      UsageStats            `json:"total"`
+	ByProvider map[string]UsageStats `json:"by_provider"`
+	ByTask     map[string]UsageStats `json:"by_task"`
+	Pricing    map[string]TokenPrice `json:"pricing,omitempty"`
+	// 当前并发情况，由调用方在返回前填充
+	Concurrency *ConcurrencyStats `json:"concurrency,omitempty"`
+	// 降级链中各提供商的累计失败次数，由调用方在返回前填充
+	ProviderFailures map[string]int64 `json:"provider_failures,omitempty"`
+}
+
+// UsageTracker 按提供商和任务累计token用量，并发安全
+type UsageTracker struct {
+	mu         sync.Mutex
+	since      time.Time
+	total      UsageStats
+	byProvider map[string]*UsageStats
+	byTask     map[string]*UsageStats
+	pricing    map[LLMProvider]TokenPrice
+}
+
+// NewUsageTracker 创建用量统计器，pricing为空时只统计token不估算费用
+func NewUsageTracker(pricing map[LLMProvider]TokenPrice) *UsageTracker {
+	if pricing == nil {
+		pricing = make(map[LLMProvider]TokenPrice)
+	}
+	return &UsageTracker{
+		since:      time.Now(),
+		byProvider: make(map[string]*UsageStats),
+		byTask:     make(map[string]*UsageStats),
+		pricing:    pricing,
+	}
+}
+
+// Record 记录一次调用的用量，任务名取自req.Metadata["task"]
+func (t *UsageTracker) Record(req *LLMRequest, resp *LLMResponse) {
+	if t == nil || resp == nil {
+		return
+	}
+
+	promptTokens, completionTokens := splitUsageTokens(resp)
+	totalTokens := resp.TokensUsed
+	if sum := promptTokens + completionTokens; sum > totalTokens {
+		totalTokens = sum
+	}
+
+	price := t.pricing[resp.Provider]
+	unsplitTokens := totalTokens - promptTokens - completionTokens
+	cost := float64(promptTokens)/1000*price.PromptPer1K +
+		float64(completionTokens+unsplitTokens)/1000*price.CompletionPer1K
+
+	task := "unknown"
+	if req != nil && req.Metadata != nil {
+		if name, ok := req.Metadata["task"].(string); ok && name != "" {
+			task = name
+		}
+	}
+
+	provider := string(resp.Provider)
+	if provider == "" {
+		provider = "unknown"
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, stats := range []*UsageStats{&t.total, t.statsFor(t.byProvider, provider), t.statsFor(t.byTask, task)} {
+		stats.Calls++
+		stats.PromptTokens += int64(promptTokens)
+		stats.CompletionTokens += int64(completionTokens)
+		stats.TotalTokens += int64(totalTokens)
+		stats.EstimatedCost += cost
+	}
+}
+
+// Snapshot 获取当前用量快照
+func (t *UsageTracker) Snapshot() *UsageSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := &UsageSnapshot{
+		Since:      t.since,
+		Total:      t.total,
+		ByProvider: make(map[string]UsageStats, len(t.byProvider)),
+		ByTask:     make(map[string]UsageStats, len(t.byTask)),
+		Pricing:    make(map[string]TokenPrice, len(t.pricing)),
+	}
+	for provider, stats := range t.byProvider {
+		snapshot.ByProvider[provider] = *stats
+	}
+	for task, stats := range t.byTask {
+		snapshot.ByTask[task] = *stats
+	}
+	for provider, price := range t.pricing {
+		snapshot.Pricing[string(provider)] = price
+	}
+	return snapshot
+}
+
+// Reset 清空累计用量
+func (t *UsageTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.since = time.Now()
+	t.total = UsageStats{}
+	t.byProvider = make(map[string]*UsageStats)
+	t.byTask = make(map[string]*UsageStats)
+}
+
+// statsFor 获取或创建分组统计，调用方需持有锁
+func (t *UsageTracker) statsFor(group map[string]*UsageStats, key string) *UsageStats {
+	stats, ok := group[key]
+	if !ok {
+		stats = &UsageStats{}
+		group[key] = stats
+	}
+	return stats
+}
+
+// splitUsageTokens 从响应元数据中读取输入/输出token数，不同提供商字段名不同
+func splitUsageTokens(resp *LLMResponse) (int, int) {
+	if resp.Metadata == nil {
+		return 0, 0
+	}
+
+	keyPairs := [][2]string{
+		{"prompt_tokens", "completion_tokens"}, // OpenAI、DeepSeek
+		{"input_tokens", "output_tokens"},      // Claude、千问
+		{"prompt_eval_count", "eval_count"},    // Ollama
+	}
+	for _, keys := range keyPairs {
+		prompt, okPrompt := metadataInt(resp.Metadata, keys[0])
+		completion, okCompletion := metadataInt(resp.Metadata, keys[1])
+		if okPrompt || okCompletion {
+			return prompt, completion
+		}
+	}
+	return 0, 0
+}
+
+// metadataInt 读取元数据中的整数值
+func metadataInt(metadata map[string]interface{}, key string) (int, bool) {
+	switch v := metadata[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// ParseTokenPricing 解析价格配置
+// 格式: provider=输入价格/输出价格，多个提供商以逗号分隔，如 "deepseek=0.001/0.002,openai=0.0005/0.0015"
+// 只给出一个价格时输入输出使用同一价格
+func ParseTokenPricing(spec string) (map[LLMProvider]TokenPrice, error) {
+	pricing := make(map[LLMProvider]TokenPrice)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("无效的价格配置: %s", item)
+		}
+
+		prices := strings.SplitN(parts[1], "/", 2)
+		promptPrice, err := strconv.ParseFloat(strings.TrimSpace(prices[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("无效的输入价格 %s: %w", item, err)
+		}
+		completionPrice := promptPrice
+		if len(prices) == 2 {
+			completionPrice, err = strconv.ParseFloat(strings.TrimSpace(prices[1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("无效的输出价格 %s: %w", item, err)
+			}
+		}
+
+		pricing[LLMProvider(strings.TrimSpace(parts[0]))] = TokenPrice{
+			PromptPer1K:     promptPrice,
+			CompletionPer1K: completionPrice,
+		}
+	}
+	return pricing, nil
+}
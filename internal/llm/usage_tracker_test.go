@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUsageTrackerRecord(t *testing.T) {
+	tracker := NewUsageTracker(map[LLMProvider]TokenPrice{
+		ProviderDeepSeek: {PromptPer1K: 0.001, CompletionPer1K: 0.002},
+	})
+
+	req := &LLMRequest{Metadata: map[string]interface{}{"task": "multi_dimensional_storage_analysis"}}
+	tracker.Record(req, &LLMResponse{
+		TokensUsed: 3000,
+		Provider:   ProviderDeepSeek,
+		Metadata:   map[string]interface{}{"prompt_tokens": 2000, "completion_tokens": 1000},
+	})
+	// 流式调用只返回总量，按输出价格估算
+	tracker.Record(req, &LLMResponse{TokensUsed: 500, Provider: ProviderDeepSeek})
+	tracker.Record(&LLMRequest{}, &LLMResponse{
+		TokensUsed: 100,
+		Provider:   ProviderClaude,
+		Metadata:   map[string]interface{}{"input_tokens": 60, "output_tokens": 40},
+	})
+
+	snapshot := tracker.Snapshot()
+	if snapshot.Total.Calls != 3 || snapshot.Total.TotalTokens != 3600 {
+		t.Errorf("Unexpected totals: %+v", snapshot.Total)
+	}
+
+	deepseek := snapshot.ByProvider[string(ProviderDeepSeek)]
+	if deepseek.PromptTokens != 2000 || deepseek.CompletionTokens != 1000 || deepseek.TotalTokens != 3500 {
+		t.Errorf("Unexpected deepseek usage: %+v", deepseek)
+	}
+	if expected := 0.002 + 0.002 + 0.001; math.Abs(deepseek.EstimatedCost-expected) > 1e-9 {
+		t.Errorf("Expected cost %.6f, got %.6f", expected, deepseek.EstimatedCost)
+	}
+
+	if snapshot.ByProvider[string(ProviderClaude)].EstimatedCost != 0 {
+		t.Errorf("Provider without pricing should not be charged")
+	}
+	if snapshot.ByTask["multi_dimensional_storage_analysis"].Calls != 2 || snapshot.ByTask["unknown"].Calls != 1 {
+		t.Errorf("Unexpected task usage: %+v", snapshot.ByTask)
+	}
+
+	tracker.Reset()
+	if tracker.Snapshot().Total.Calls != 0 {
+		t.Errorf("Expected empty usage after reset")
+	}
+}
+
+func TestParseTokenPricing(t *testing.T) {
+	pricing, err := ParseTokenPricing("deepseek=0.001/0.002, openai=0.0005")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if pricing[ProviderDeepSeek] != (TokenPrice{PromptPer1K: 0.001, CompletionPer1K: 0.002}) {
+		t.Errorf("Unexpected deepseek price: %+v", pricing[ProviderDeepSeek])
+	}
+	if pricing[ProviderOpenAI] != (TokenPrice{PromptPer1K: 0.0005, CompletionPer1K: 0.0005}) {
+		t.Errorf("Unexpected openai price: %+v", pricing[ProviderOpenAI])
+	}
+
+	for _, spec := range []string{"deepseek", "deepseek=abc", "=0.1", "openai=0.1/x"} {
+		if _, err := ParseTokenPricing(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
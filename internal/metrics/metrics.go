@@ -0,0 +1,113 @@
+package metrics
+
+import "time"
+
+// =============================================================================
+// 服务指标定义 - 标签只使用工具名、提供商、操作类型等有限取值，不含会话/用户ID
+// =============================================================================
+
+// 状态标签取值
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// 缓存查询结果标签取值
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+var (
+	// ToolCalls MCP工具调用次数
+	ToolCalls = NewCounterVec("context_keeper_tool_calls_total",
+		"Total number of MCP tool calls.", "tool", "status")
+
+	// ToolCallDuration MCP工具调用耗时
+	ToolCallDuration = NewHistogramVec("context_keeper_tool_call_duration_seconds",
+		"MCP tool call latency in seconds.", nil, "tool")
+
+	// EmbeddingRequests 向量生成调用次数（不含缓存命中）
+	EmbeddingRequests = NewCounterVec("context_keeper_embedding_requests_total",
+		"Total number of embedding generation calls, excluding cache hits.", "status")
+
+	// EmbeddingDuration 向量生成耗时
+	EmbeddingDuration = NewHistogramVec("context_keeper_embedding_duration_seconds",
+		"Embedding generation latency in seconds, excluding cache hits.", nil)
+
+	// LLMRequests LLM调用次数
+	LLMRequests = NewCounterVec("context_keeper_llm_requests_total",
+		"Total number of LLM calls.", "provider", "method", "status")
+
+	// LLMDuration LLM调用耗时（流式调用只统计到建立流为止）
+	LLMDuration = NewHistogramVec("context_keeper_llm_request_duration_seconds",
+		"LLM call latency in seconds; streaming calls are measured until the stream is established.",
+		nil, "provider", "method")
+
+	// LLMProviderFailures LLM降级链中各提供商的调用失败次数，用于观察提供商抖动
+	LLMProviderFailures = NewCounterVec("context_keeper_llm_provider_failures_total",
+		"Total number of failed LLM calls per provider in the fallback chain.", "provider")
+
+	// VectorStoreOperations 向量存储操作次数
+	VectorStoreOperations = NewCounterVec("context_keeper_vector_store_operations_total",
+		"Total number of vector store operations.", "operation", "status")
+
+	// VectorStoreDuration 向量存储操作耗时
+	VectorStoreDuration = NewHistogramVec("context_keeper_vector_store_operation_duration_seconds",
+		"Vector store operation latency in seconds.", nil, "operation")
+
+	// ToolRateLimited 因超出限流被拒绝的MCP工具调用次数
+	ToolRateLimited = NewCounterVec("context_keeper_tool_rate_limited_total",
+		"Total number of MCP tool calls rejected by the rate limiter.", "tool", "scope")
+
+	// CacheRequests 缓存查询次数，hit/miss之比即命中率
+	CacheRequests = NewCounterVec("context_keeper_cache_requests_total",
+		"Total number of cache lookups by result.", "cache", "result")
+)
+
+// Status 根据错误返回状态标签取值
+func Status(err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return StatusSuccess
+}
+
+// ObserveToolCall 记录一次MCP工具调用
+func ObserveToolCall(tool string, err error, duration time.Duration) {
+	ToolCalls.Inc(tool, Status(err))
+	ToolCallDuration.ObserveDuration(duration, tool)
+}
+
+// ObserveEmbedding 记录一次向量生成调用
+func ObserveEmbedding(err error, duration time.Duration) {
+	EmbeddingRequests.Inc(Status(err))
+	EmbeddingDuration.ObserveDuration(duration)
+}
+
+// ObserveLLMCall 记录一次LLM调用
+func ObserveLLMCall(provider, method string, err error, duration time.Duration) {
+	LLMRequests.Inc(provider, method, Status(err))
+	LLMDuration.ObserveDuration(duration, provider, method)
+}
+
+// ObserveVectorStoreOperation 记录一次向量存储操作，便于以defer方式调用：
+//
+//	defer metrics.ObserveVectorStoreOperation("search", time.Now(), &err)
+func ObserveVectorStoreOperation(operation string, start time.Time, errp *error) {
+	var err error
+	if errp != nil {
+		err = *errp
+	}
+	VectorStoreOperations.Inc(operation, Status(err))
+	VectorStoreDuration.ObserveDuration(time.Since(start), operation)
+}
+
+// ObserveCacheLookup 记录一次缓存查询
+func ObserveCacheLookup(cache string, hit bool) {
+	result := CacheMiss
+	if hit {
+		result = CacheHit
+	}
+	CacheRequests.Inc(cache, result)
+}
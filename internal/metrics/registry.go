@@ -0,0 +1,384 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// 轻量指标注册表 - 以Prometheus文本格式（0.0.4）输出，不依赖第三方客户端库
+// =============================================================================
+
+// ContentType Prometheus文本格式的Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// maxSeriesPerMetric 单个指标允许的最大标签组合数，超出后归入"other"，避免基数失控
+const maxSeriesPerMetric = 256
+
+// overflowLabelValue 超出基数上限时使用的标签值
+const overflowLabelValue = "other"
+
+// DefaultDurationBuckets 耗时直方图的默认分桶（秒），覆盖毫秒级缓存命中到分钟级LLM调用
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// collector 可输出为Prometheus文本格式的指标
+type collector interface {
+	metricName() string
+	write(w *bufio.Writer)
+}
+
+// Registry 指标注册表，并发安全
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]collector
+}
+
+// NewRegistry 创建空的指标注册表
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// defaultRegistry 进程级默认注册表
+var defaultRegistry = NewRegistry()
+
+// Default 获取进程级默认注册表
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// register 注册指标，同名指标会被替换
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors[c.metricName()] = c
+}
+
+// WritePrometheus 按指标名排序输出所有指标
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// =============================================================================
+// 标签组合
+// =============================================================================
+
+// seriesSet 按标签值组合存储序列，限制组合数量
+type seriesSet[T any] struct {
+	labelNames []string
+	order      []string
+	labels     map[string][]string
+	values     map[string]T
+	newValue   func() T
+}
+
+// newSeriesSet 创建序列集合
+func newSeriesSet[T any](labelNames []string, newValue func() T) seriesSet[T] {
+	return seriesSet[T]{
+		labelNames: labelNames,
+		labels:     make(map[string][]string),
+		values:     make(map[string]T),
+		newValue:   newValue,
+	}
+}
+
+// get 获取标签值组合对应的序列，不存在时创建；调用方需持有锁
+func (s *seriesSet[T]) get(labelValues []string) T {
+	values := normalizeLabelValues(s.labelNames, labelValues)
+	key := strings.Join(values, "\xff")
+	if v, ok := s.values[key]; ok {
+		return v
+	}
+
+	if len(s.values) >= maxSeriesPerMetric {
+		for i := range values {
+			values[i] = overflowLabelValue
+		}
+		key = strings.Join(values, "\xff")
+		if v, ok := s.values[key]; ok {
+			return v
+		}
+	}
+
+	v := s.newValue()
+	s.values[key] = v
+	s.labels[key] = values
+	s.order = append(s.order, key)
+	return v
+}
+
+// sortedKeys 按标签值排序的序列键，保证输出稳定；调用方需持有锁
+func (s *seriesSet[T]) sortedKeys() []string {
+	keys := append([]string(nil), s.order...)
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeLabelValues 补齐或截断标签值，使其与标签名数量一致
+func normalizeLabelValues(labelNames, labelValues []string) []string {
+	values := make([]string, len(labelNames))
+	copy(values, labelValues)
+	for i := range values {
+		if values[i] == "" {
+			values[i] = "unknown"
+		}
+	}
+	return values
+}
+
+// formatLabels 格式化标签，extraName非空时追加一个额外标签（如直方图的le）
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(values[i]))
+		sb.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extraName)
+		sb.WriteString(`="`)
+		sb.WriteString(extraValue)
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// escapeLabelValue 转义标签值中的反斜杠、双引号和换行
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat 按Prometheus约定格式化数值
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeHeader 输出HELP和TYPE行
+func writeHeader(w *bufio.Writer, name, help, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.ReplaceAll(help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+// =============================================================================
+// Counter
+// =============================================================================
+
+// CounterVec 按标签区分的单调递增计数器
+type CounterVec struct {
+	name   string
+	help   string
+	mu     sync.Mutex
+	series seriesSet[*float64]
+}
+
+// NewCounterVec 创建计数器并注册到默认注册表
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return Default().NewCounterVec(name, help, labelNames...)
+}
+
+// NewCounterVec 创建计数器并注册到当前注册表
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		series: newSeriesSet(labelNames, func() *float64 { return new(float64) }),
+	}
+	r.register(c)
+	return c
+}
+
+// Inc 计数加1
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 计数增加v，负数会被忽略
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.series.get(labelValues) += v
+}
+
+// Value 获取标签组合的当前计数，主要用于测试
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := strings.Join(normalizeLabelValues(c.series.labelNames, labelValues), "\xff")
+	if v, ok := c.series.values[key]; ok {
+		return *v
+	}
+	return 0
+}
+
+func (c *CounterVec) metricName() string { return c.name }
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range c.series.sortedKeys() {
+		labels := formatLabels(c.series.labelNames, c.series.labels[key], "", "")
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatFloat(*c.series.values[key]))
+	}
+}
+
+// =============================================================================
+// Histogram
+// =============================================================================
+
+// histogramSeries 单个标签组合的直方图数据，counts[i]为落入第i个桶（非累计）的次数
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec 按标签区分的直方图
+type HistogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+	mu      sync.Mutex
+	series  seriesSet[*histogramSeries]
+}
+
+// NewHistogramVec 创建直方图并注册到默认注册表，buckets为空时使用DefaultDurationBuckets
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return Default().NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+// NewHistogramVec 创建直方图并注册到当前注册表
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		buckets: sorted,
+	}
+	h.series = newSeriesSet(labelNames, func() *histogramSeries {
+		return &histogramSeries{counts: make([]uint64, len(sorted))}
+	})
+	r.register(h)
+	return h
+}
+
+// Observe 记录一次观测值
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.series.get(labelValues)
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// ObserveDuration 以秒为单位记录一次耗时
+func (h *HistogramVec) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) metricName() string { return h.name }
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	names := h.series.labelNames
+	for _, key := range h.series.sortedKeys() {
+		values := h.series.labels[key]
+		s := h.series.values[key]
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, values, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(names, values, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(names, values, "", ""), s.count)
+	}
+}
+
+// =============================================================================
+// GaugeFunc
+// =============================================================================
+
+// gaugeFunc 抓取时才计算取值的无标签仪表
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// RegisterGaugeFunc 在默认注册表注册抓取时计算的仪表，同名仪表会被替换
+func RegisterGaugeFunc(name, help string, fn func() float64) {
+	Default().RegisterGaugeFunc(name, help, fn)
+}
+
+// RegisterGaugeFunc 在当前注册表注册抓取时计算的仪表，同名仪表会被替换
+func (r *Registry) RegisterGaugeFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{name: name, help: help, fn: fn})
+}
+
+func (g *gaugeFunc) metricName() string { return g.name }
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
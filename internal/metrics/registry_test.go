@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWritePrometheus 测试计数器、直方图和仪表的文本格式输出
+func TestWritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	calls := r.NewCounterVec("test_calls_total", "Test calls.", "tool", "status")
+	latency := r.NewHistogramVec("test_latency_seconds", "Test latency.", []float64{0.1, 1}, "tool")
+	r.RegisterGaugeFunc("test_ratio", "Test ratio.", func() float64 { return 0.5 })
+
+	calls.Inc("memorize_context", Status(nil))
+	calls.Inc("memorize_context", Status(errors.New("boom")))
+	calls.Add(2, "retrieve_context", StatusSuccess)
+	latency.ObserveDuration(50*time.Millisecond, "memorize_context")
+	latency.Observe(0.5, "memorize_context")
+	latency.Observe(3, "memorize_context")
+
+	var buf bytes.Buffer
+	if err := r.WritePrometheus(&buf); err != nil {
+		t.Fatalf("WritePrometheus failed: %v", err)
+	}
+	output := buf.String()
+
+	expected := []string{
+		"# TYPE test_calls_total counter",
+		`test_calls_total{tool="memorize_context",status="error"} 1`,
+		`test_calls_total{tool="memorize_context",status="success"} 1`,
+		`test_calls_total{tool="retrieve_context",status="success"} 2`,
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{tool="memorize_context",le="0.1"} 1`,
+		`test_latency_seconds_bucket{tool="memorize_context",le="1"} 2`,
+		`test_latency_seconds_bucket{tool="memorize_context",le="+Inf"} 3`,
+		`test_latency_seconds_sum{tool="memorize_context"} 3.55`,
+		`test_latency_seconds_count{tool="memorize_context"} 3`,
+		"# TYPE test_ratio gauge",
+		"test_ratio 0.5",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected line %q in output:\n%s", line, output)
+		}
+	}
+
+	if strings.Index(output, "test_calls_total") > strings.Index(output, "test_ratio") {
+		t.Errorf("Expected metrics sorted by name:\n%s", output)
+	}
+}
+
+// TestSeriesCardinalityLimit 测试标签组合超出上限后归入other
+func TestSeriesCardinalityLimit(t *testing.T) {
+	r := NewRegistry()
+	calls := r.NewCounterVec("test_limited_total", "Test limit.", "tool")
+
+	for i := 0; i < maxSeriesPerMetric+10; i++ {
+		calls.Inc(fmt.Sprintf("tool_%d", i))
+	}
+
+	if got := len(calls.series.values); got != maxSeriesPerMetric+1 {
+		t.Errorf("Expected %d series, got %d", maxSeriesPerMetric+1, got)
+	}
+	if got := calls.Value(overflowLabelValue); got != 10 {
+		t.Errorf("Expected 10 overflow calls, got %v", got)
+	}
+}
+
+// TestEscapeLabelValue 测试标签值转义
+func TestEscapeLabelValue(t *testing.T) {
+	got := escapeLabelValue("a\"b\\c\nd")
+	if want := `a\"b\\c\nd`; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -196,6 +196,16 @@ type LLMDrivenContextModel struct {
 	Metadata map[string]interface{} `json:"metadata"`
 }
 
+// ContextModelSchemaVersion 持久化语境模型的当前格式版本，格式变更时递增并在加载时迁移
+const ContextModelSchemaVersion = 1
+
+// PersistedContextModel 持久化到会话中的LLM驱动语境模型
+type PersistedContextModel struct {
+	SchemaVersion int                    `json:"schema_version"`
+	MessageCount  int                    `json:"message_count"` // 最近一次更新时已处理的会话消息数，新消息从这里开始增量处理
+	Model         *LLMDrivenContextModel `json:"model"`
+}
+
 // CoreContext 核心上下文
 type CoreContext struct {
 	ConversationThread string     `json:"conversation_thread"`
@@ -18,18 +18,52 @@ type StoreContextRequest struct {
 	// 添加bizType和userId字段，用于向量存储
 	BizType int    `json:"bizType,omitempty"`
 	UserID  string `json:"userId,omitempty"`
+	// Dedup 是否在写入前检查同会话/用户下的近似重复记忆，命中时返回已有记忆ID
+	Dedup bool `json:"dedup,omitempty"`
+	// Locale 内容语言(auto/zh/en)，用于待办检测和事件类型关键词匹配，默认auto
+	Locale string `json:"locale,omitempty"`
+	// ContentType 内容类型(text/image)，默认text；image时Content为可选的说明文字，用于生成检索向量
+	ContentType string `json:"contentType,omitempty"`
+	// ContentRef 图片的外部URI或路径，contentType为image时必填
+	ContentRef string `json:"contentRef,omitempty"`
+	// Collection 记忆所属的命名集合（如work/personal），为空时不归属任何集合
+	Collection string `json:"collection,omitempty"`
 }
 
 // RetrieveContextRequest 检索上下文请求
 type RetrieveContextRequest struct {
-	SessionID     string `json:"sessionId"`
-	Query         string `json:"query"`
-	Limit         int    `json:"limit,omitempty"`
-	Strategy      string `json:"strategy,omitempty"`      // balanced, recent, relevant
-	MemoryID      string `json:"memoryId,omitempty"`      // 新增：通过记忆ID精确检索
-	BatchID       string `json:"batchId,omitempty"`       // 新增：通过批次ID检索
-	SkipThreshold bool   `json:"skipThreshold,omitempty"` // 新增：是否跳过相似度阈值过滤
-	IsBruteSearch int    `json:"isBruteSearch,omitempty"` // 新增：是否启用暴力搜索（用于索引未训练的情况）
+	SessionID       string   `json:"sessionId"`
+	Query           string   `json:"query"`
+	Limit           int      `json:"limit,omitempty"`
+	Strategy        string   `json:"strategy,omitempty"`        // balanced, recent, relevant
+	MemoryID        string   `json:"memoryId,omitempty"`        // 新增：通过记忆ID精确检索
+	BatchID         string   `json:"batchId,omitempty"`         // 新增：通过批次ID检索
+	SkipThreshold   bool     `json:"skipThreshold,omitempty"`   // 新增：是否跳过相似度阈值过滤
+	Threshold       float64  `json:"threshold,omitempty"`       // 本次检索的相似度阈值，0表示使用配置值
+	IsBruteSearch   int      `json:"isBruteSearch,omitempty"`   // 新增：是否启用暴力搜索（用于索引未训练的情况）
+	Offset          int      `json:"offset,omitempty"`          // 分页偏移量（在相似度阈值过滤之后应用）
+	PageSize        int      `json:"pageSize,omitempty"`        // 每页返回的记忆条数，默认10
+	TopK            int      `json:"topK,omitempty"`            // 返回的相关记忆条数(1-100)，设置时作为每页条数，默认10
+	HybridSearch    bool     `json:"hybridSearch,omitempty"`    // 是否启用混合检索（向量相似度+关键词匹配）
+	HybridAlpha     *float64 `json:"hybridAlpha,omitempty"`     // 混合检索中向量得分的权重[0-1]，0表示只按关键词得分，未设置时使用配置值
+	Rerank          bool     `json:"rerank,omitempty"`          // 是否使用LLM对前20条结果按相关性重排序
+	StartTime       int64    `json:"startTime,omitempty"`       // 时间范围起点（unix秒，含），0表示不限制
+	EndTime         int64    `json:"endTime,omitempty"`         // 时间范围终点（unix秒，含），0表示不限制
+	SortBy          string   `json:"sortBy,omitempty"`          // 结果排序: 默认按相似度，time按时间倒序
+	AssembleChunks  bool     `json:"assembleChunks,omitempty"`  // 按memoryId检索时将分块记忆重组为完整内容
+	MultiVector     bool     `json:"multiVector,omitempty"`     // 同时检索核心意图/领域上下文/场景维度向量并按维度权重融合得分
+	Structured      bool     `json:"structured,omitempty"`      // 以结构化结果数组返回相关记忆，替代LongTermMemory中的拼接文本
+	GraphExpand     bool     `json:"graphExpand,omitempty"`     // 以向量命中的记忆为起点在知识图谱中扩展一跳，追加相关记忆（Neo4j未启用时不生效）
+	MaxTokens       int      `json:"maxTokens,omitempty"`       // 相关记忆的token预算，按优先级填充，超出的截断或丢弃，0表示不限制
+	Explain         bool     `json:"explain,omitempty"`         // 返回检索诊断信息：每个候选的原始得分、是否通过阈值、命中的过滤条件和排序变化
+	PriorityBoost   bool     `json:"priorityBoost,omitempty"`   // 按相似度与记忆优先级(P0>P1>P2>P3)的加权得分排序，相关性接近时重要记忆靠前
+	PriorityWeight  float64  `json:"priorityWeight,omitempty"`  // 优先级得分的权重(0-0.5]，0表示使用配置值
+	RecencyBoost    bool     `json:"recencyBoost,omitempty"`    // 按相似度与时间衰减的加权得分排序，相关性接近时新近存储的记忆靠前
+	RecencyWeight   float64  `json:"recencyWeight,omitempty"`   // 时间衰减得分的权重(0-0.5]，0表示使用配置值
+	RecencyHalfLife float64  `json:"recencyHalfLife,omitempty"` // 时间衰减的半衰期（小时），0表示使用配置值
+	IncludeArchived bool     `json:"includeArchived,omitempty"` // 同时返回已归档的记忆，默认排除
+	GroupBy         string   `json:"groupBy,omitempty"`         // 按batch(对话批次)或session(会话)聚合相关记忆，以groups返回
+	Collection      string   `json:"collection,omitempty"`      // 只检索该命名集合中的记忆，为空时不限制集合
 
 	// 🆕 工程感知相关字段
 	ProjectAnalysis string `json:"projectAnalysis,omitempty"` // 工程分析结果（供检索使用）
@@ -41,12 +75,192 @@ type ContextResponse struct {
 	ShortTermMemory   string `json:"short_term_memory"`
 	LongTermMemory    string `json:"long_term_memory"`
 	RelevantKnowledge string `json:"relevant_knowledge"`
+	HasMore           bool   `json:"hasMore"`    // 是否还有下一页
+	NextOffset        int    `json:"nextOffset"` // 下一页的偏移量
+
+	// 混合检索时每条记忆的得分明细，顺序与相关历史一致
+	ScoreBreakdown []HybridScore `json:"scoreBreakdown,omitempty"`
+	// LLM重排序得分，顺序与相关历史一致；重排序失败时为空
+	RerankScores []RerankScore `json:"rerankScores,omitempty"`
+	// 结构化的相关记忆，仅在请求structured=true时返回，此时LongTermMemory为空
+	Results []MemoryResult `json:"results,omitempty"`
+	// 按批次或会话聚合的相关记忆，仅在请求groupBy时返回，此时LongTermMemory和Results为空
+	Groups []MemoryGroup `json:"groups,omitempty"`
+	// token预算装配结果，仅在请求maxTokens>0时返回
+	TokenBudget *TokenBudgetReport `json:"tokenBudget,omitempty"`
+	// 检索诊断信息，仅在请求explain=true时返回
+	Explain *RetrievalExplain `json:"explain,omitempty"`
+	// 嵌入向量维度不一致提示，部分记忆需重建向量后才能被向量检索召回时返回
+	EmbeddingDrift *EmbeddingDriftNotice `json:"embeddingDrift,omitempty"`
+}
+
+// EmbeddingDriftNotice 嵌入模型更换后的维度不一致提示：与查询向量维度不同的记忆无法参与相似度比较
+type EmbeddingDriftNotice struct {
+	QueryDimension  int    `json:"queryDimension"`            // 当前嵌入模型生成的查询向量维度
+	StoreDimension  int    `json:"storeDimension,omitempty"`  // 向量存储的维度，0表示未知
+	EmbeddingModel  string `json:"embeddingModel,omitempty"`  // 当前使用的嵌入模型
+	SkippedCount    int    `json:"skippedCount"`              // 因维度不一致被跳过的记忆数
+	Message         string `json:"message"`                   // 面向用户的说明
+	ReindexEndpoint string `json:"reindexEndpoint,omitempty"` // 重建向量的接口
+}
+
+// RetrievalExplain 检索诊断信息，说明候选记忆如何被打分、过滤和排序；只包含当前用户的记录
+type RetrievalExplain struct {
+	Mode          string             `json:"mode"`                // 检索方式: vector, session, memory_id, batch_id
+	Filter        string             `json:"filter,omitempty"`    // 向量检索最终使用的过滤条件
+	Threshold     float64            `json:"threshold,omitempty"` // 本次指定的相似度阈值，0表示使用向量存储的配置值
+	SkipThreshold bool               `json:"skipThreshold"`       // 是否跳过了相似度阈值过滤
+	Reranked      bool               `json:"reranked"`            // 是否进行了LLM重排序
+	Candidates    []ExplainCandidate `json:"candidates"`
+}
+
+// ExplainCandidate 一条候选记忆的诊断信息，排名从1开始，0表示不在对应列表中
+type ExplainCandidate struct {
+	ID              string   `json:"id"`
+	Score           float64  `json:"score"`                   // 向量相似度（0-1，越大越相似）
+	Source          string   `json:"source"`                  // 候选来源: vector, keyword, graph, session, id
+	PassedThreshold bool     `json:"passedThreshold"`         // 是否通过相似度阈值，非向量候选恒为true
+	MatchedFilters  []string `json:"matchedFilters"`          // 命中的过滤条件: userId, session, workspace, timeRange
+	RankBefore      int      `json:"rankBefore"`              // 重排序前的排名
+	RankAfter       int      `json:"rankAfter"`               // 重排序和时间排序后的排名
+	FinalRank       int      `json:"finalRank"`               // 在本次返回结果中的位置，未返回（被过滤或不在本页）时为0
+	Priority        string   `json:"priority,omitempty"`      // 记忆优先级，启用priorityBoost时返回
+	AdjustedScore   float64  `json:"adjustedScore,omitempty"` // 相似度与优先级、时间衰减加权后的得分，启用priorityBoost或recencyBoost时返回
+	RecencyScore    float64  `json:"recencyScore,omitempty"`  // 时间衰减得分(0-1]，每经过一个半衰期减半，启用recencyBoost时返回
+}
+
+// 检索诊断中的检索方式和候选来源
+const (
+	ExplainModeVector   = "vector"
+	ExplainModeSession  = "session"
+	ExplainModeMemoryID = "memory_id"
+	ExplainModeBatchID  = "batch_id"
+
+	ExplainSourceKeyword = "keyword"
+	ExplainSourceSession = "session"
+	ExplainSourceID      = "id"
+)
+
+// TokenBudgetReport 按token预算装配上下文的结果，token数为估算值
+type TokenBudgetReport struct {
+	MaxTokens  int          `json:"maxTokens"`
+	UsedTokens int          `json:"usedTokens"`
+	Included   []BudgetItem `json:"included"`
+	Dropped    []BudgetItem `json:"dropped,omitempty"`
+}
+
+// BudgetItem 参与token预算分配的一条记忆
+type BudgetItem struct {
+	Kind      string `json:"kind"`                // short_term（最近对话）或long_term（相关历史）
+	ID        string `json:"id,omitempty"`        // 长期记忆的记录ID，短期记忆为空
+	Index     int    `json:"index"`               // 在原列表中的位置，从0开始
+	Tokens    int    `json:"tokens"`              // 估算的token数，截断时为截断后的数量
+	Truncated bool   `json:"truncated,omitempty"` // 是否被截断
+}
+
+// MemoryResult 结构化的检索结果
+type MemoryResult struct {
+	MemoryID    string                 `json:"memoryId"`
+	Content     string                 `json:"content"`
+	Score       float64                `json:"score"`                 // 向量相似度（0-1，越大越相似）
+	Type        string                 `json:"type"`                  // 记忆类型，取自metadata.type，缺失时为memory或message
+	Timestamp   int64                  `json:"timestamp"`             // unix秒，缺失时为0
+	Source      string                 `json:"source,omitempty"`      // 检索来源: vector或graph，仅图谱扩展检索时返回
+	ContentType string                 `json:"contentType,omitempty"` // 非文本记忆的内容类型（如image），文本记忆为空
+	ContentRef  string                 `json:"contentRef,omitempty"`  // 图片的外部URI或路径，此时Content为其说明文字
+	SessionID   string                 `json:"sessionId,omitempty"`   // 记忆所属的会话ID
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// 流式检索的SSE事件类型
+const (
+	RetrievalEventConnected = "connected" // 连接建立，携带可用于取消检索的requestId
+	RetrievalEventCandidate = "candidate" // 向量检索完成后立即发送的当前页候选，开启重排序时为重排序前的顺序
+	RetrievalEventResult    = "result"    // 图谱扩展、token预算等处理完成后的最终结果
+	RetrievalEventComplete  = "complete"  // 检索结束
+	RetrievalEventError     = "error"     // 检索失败
+)
+
+// RetrievalStreamItem 流式检索中的单条结果
+type RetrievalStreamItem struct {
+	Rank int `json:"rank"` // 在本页中的名次，从1开始
+	MemoryResult
+}
+
+// RetrievalStreamComplete 流式检索结束事件
+type RetrievalStreamComplete struct {
+	Total      int  `json:"total"` // 本页发送的result数
+	HasMore    bool `json:"hasMore"`
+	NextOffset int  `json:"nextOffset"`
+	Reranked   bool `json:"reranked"` // 最终顺序是否经过LLM重排序
+}
+
+// MemoryGroup 按批次或会话聚合的检索结果
+type MemoryGroup struct {
+	Key         string         `json:"key"`               // 批次ID或会话ID，无法归组的记忆为其记忆ID
+	BestScore   float64        `json:"bestScore"`         // 组内成员的最高得分
+	MemberCount int            `json:"memberCount"`       // 组内命中的成员总数（不含作为摘要的记忆）
+	Summary     string         `json:"summary,omitempty"` // 批次摘要或会话摘要，没有时为空
+	Members     []MemoryResult `json:"members"`           // 按时间正序的成员，最多返回5条
+}
+
+// 检索结果来源
+const (
+	RetrievalSourceVector = "vector" // 向量相似度命中
+	RetrievalSourceGraph  = "graph"  // 知识图谱扩展得到
+)
+
+// RerankScore LLM重排序得分
+type RerankScore struct {
+	ID           string  `json:"id"`
+	Score        float64 `json:"score"`        // LLM给出的相关性得分(0-1)
+	OriginalRank int     `json:"originalRank"` // 重排序前的位置，从1开始
+}
+
+// HybridScore 混合检索得分明细
+type HybridScore struct {
+	ID           string   `json:"id"`
+	VectorScore  float64  `json:"vectorScore"`  // 归一化的向量相似度(0-1)，仅由关键词命中时为0
+	KeywordScore float64  `json:"keywordScore"` // 归一化的BM25关键词得分(0-1)
+	HybridScore  float64  `json:"hybridScore"`  // alpha*VectorScore + (1-alpha)*KeywordScore
+	MatchedTerms []string `json:"matchedTerms,omitempty"`
+}
+
+// 后端探测状态
+const (
+	BackendStatusOK       = "ok"
+	BackendStatusError    = "error"
+	BackendStatusDisabled = "disabled"
+)
+
+// BackendStatus 后端依赖（向量库、Neo4j、TimescaleDB）的就绪探测结果
+type BackendStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"` // ok、error、disabled
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+// 存储引擎可用性状态
+const (
+	EngineStateUnknown     = "unknown"     // 尚未校验，存储时照常尝试
+	EngineStateAvailable   = "available"   // 配置完整且可连通
+	EngineStateUnavailable = "unavailable" // 已启用但配置不完整或无法连通，存储时跳过
+	EngineStateDisabled    = "disabled"    // 配置中未启用
+)
+
+// EngineAvailability 多维存储引擎（TimescaleDB、Neo4j）的可用性
+type EngineAvailability struct {
+	Name      string `json:"name"`
+	State     string `json:"state"`            // unknown、available、unavailable、disabled
+	Reason    string `json:"reason,omitempty"` // 不可用的原因
+	CheckedAt int64  `json:"checkedAt"`        // 最近一次校验时间（unix秒），0表示尚未校验
 }
 
 // SummarizeContextRequest 生成上下文摘要请求
 type SummarizeContextRequest struct {
 	SessionID string `json:"sessionId"`
-	Format    string `json:"format,omitempty"` // text, json
+	Format    string `json:"format,omitempty"` // text, bullet
 }
 
 // SummarizeToLongTermRequest 汇总内容到长期记忆请求
@@ -114,16 +328,180 @@ type StoreMessagesResponse struct {
 	Metadata   map[string]interface{} `json:"metadata,omitempty"` // LLM驱动的智能分析结果
 }
 
+// BatchStoreConversationRequest 批量存储对话请求（全部成功或全部回滚）
+type BatchStoreConversationRequest struct {
+	SessionID string              `json:"sessionId"`
+	UserID    string              `json:"userId,omitempty"`
+	Batches   []ConversationBatch `json:"batches"`
+}
+
+// ConversationBatch 单个对话批次
+type ConversationBatch struct {
+	BatchID  string                `json:"batchId,omitempty"` // 为空时自动生成
+	Messages []ConversationMessage `json:"messages"`
+}
+
+// ConversationMessage 批次中的单条对话消息
+type ConversationMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// BatchStoreConversationResponse 批量存储对话响应
+type BatchStoreConversationResponse struct {
+	Committed bool                `json:"committed"`
+	Batches   []*BatchStoreResult `json:"batches"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// BatchStoreResult 单个批次的存储结果
+type BatchStoreResult struct {
+	BatchID    string     `json:"batchId"`
+	Status     string     `json:"status"` // committed, rolled_back, failed, skipped
+	MessageIDs []string   `json:"messageIds,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Messages   []*Message `json:"-"` // 提交后用于推送本地指令
+}
+
 // StoreContextResponse 存储上下文响应（扩展版本）
 type StoreContextResponse struct {
 	MemoryID        string                 `json:"memoryId"`                  // 记忆ID（向后兼容）
 	Status          string                 `json:"status"`                    // 状态（向后兼容）
+	Priority        string                 `json:"priority,omitempty"`        // 实际使用的优先级，未指定时为推断结果
 	AnalysisResult  *SmartAnalysisResult   `json:"analysisResult,omitempty"`  // 🆕 完整的LLM分析结果
 	StorageStrategy string                 `json:"storageStrategy,omitempty"` // 🆕 存储策略
 	Confidence      float64                `json:"confidence,omitempty"`      // 🆕 置信度
+	Deduplicated    bool                   `json:"deduplicated,omitempty"`    // 命中近似重复记忆，未写入新记录
+	EngineResults   []StorageEngineResult  `json:"engineResults,omitempty"`   // 多维度存储时各存储引擎的写入结果
+	PartialFailure  bool                   `json:"partialFailure,omitempty"`  // 部分存储引擎写入失败，客户端可据此决定是否重试
+	Skipped         bool                   `json:"skipped,omitempty"`         // 内容过短，未写入长期记忆
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`        // 其他元数据
 }
 
+// 多维度存储引擎
+const (
+	StorageEngineTimeline       = "timeline"
+	StorageEngineKnowledgeGraph = "knowledge_graph"
+	StorageEngineVector         = "vector"
+)
+
+// StorageEngineResult 单个存储引擎的写入结果
+type StorageEngineResult struct {
+	Engine    string `json:"engine"` // timeline, knowledge_graph, vector
+	Success   bool   `json:"success"`
+	Cancelled bool   `json:"cancelled,omitempty"` // 请求取消或存储超时时未完成写入
+	Error     string `json:"error,omitempty"`
+}
+
+// StoreWebhookPayload 重要记忆存储完成后出站Webhook的请求体
+type StoreWebhookPayload struct {
+	Event      string  `json:"event"` // 固定为memory.stored
+	MemoryID   string  `json:"memoryId"`
+	EventType  string  `json:"eventType,omitempty"`
+	Title      string  `json:"title"`
+	Summary    string  `json:"summary"`
+	UserID     string  `json:"userId"`
+	SessionID  string  `json:"sessionId"`
+	Importance float64 `json:"importance"` // 智能分析的置信度，未分析时按优先级换算
+	Timestamp  int64   `json:"timestamp"`  // 存储完成时间（unix秒）
+}
+
+// FailedEngines 返回写入失败的存储引擎
+func (r *StoreContextResponse) FailedEngines() []string {
+	var failed []string
+	for _, result := range r.EngineResults {
+		if !result.Success {
+			failed = append(failed, result.Engine)
+		}
+	}
+	return failed
+}
+
+// 异步存储任务状态
+const (
+	StoreJobQueued     = "queued"
+	StoreJobProcessing = "processing"
+	StoreJobDone       = "done"
+	StoreJobFailed     = "failed"
+)
+
+// StoreJob 异步存储任务
+type StoreJob struct {
+	JobID           string                `json:"jobId"`
+	SessionID       string                `json:"sessionId"`
+	Status          string                `json:"status"` // queued, processing, done, failed
+	MemoryID        string                `json:"memoryId,omitempty"`
+	Deduplicated    bool                  `json:"deduplicated,omitempty"`
+	AnalysisResult  *SmartAnalysisResult  `json:"analysisResult,omitempty"`
+	StorageStrategy string                `json:"storageStrategy,omitempty"`
+	Confidence      float64               `json:"confidence,omitempty"`
+	EngineResults   []StorageEngineResult `json:"engineResults,omitempty"`
+	PartialFailure  bool                  `json:"partialFailure,omitempty"`
+	Error           string                `json:"error,omitempty"`
+	CreatedAt       time.Time             `json:"createdAt"`
+	StartedAt       *time.Time            `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time            `json:"finishedAt,omitempty"`
+}
+
+// 记忆重建向量任务状态
+const (
+	ReindexRunning     = "running"
+	ReindexCompleted   = "completed"
+	ReindexFailed      = "failed"
+	ReindexInterrupted = "interrupted"
+)
+
+// ReindexState 用户记忆重建向量的进度，按记录ID升序处理，Cursor为最后处理完成的记录ID
+type ReindexState struct {
+	UserID      string     `json:"userId"`
+	Status      string     `json:"status"` // running, completed, failed, interrupted
+	Cursor      string     `json:"cursor,omitempty"`
+	Total       int        `json:"total"`     // 本轮扫描到的记录数
+	Processed   int        `json:"processed"` // 已处理的记录数（含跳过和失败）
+	Reindexed   int        `json:"reindexed"`
+	Skipped     int        `json:"skipped"`
+	Failed      int        `json:"failed"`
+	FailedIDs   []string   `json:"failedIds,omitempty"` // 尚未成功重建的记录，可单独重试
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"startedAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	RetriedAt   *time.Time `json:"retriedAt,omitempty"` // 最近一次重试失败记录的时间
+}
+
+// 知识图谱重建的实体抽取方式
+const (
+	KnowledgeGraphRebuildRule = "rule" // 规则匹配记忆内容中的关键词，不调用LLM
+	KnowledgeGraphRebuildLLM  = "llm"  // 按存储链路的LLM分析抽取实体和关系
+)
+
+// KnowledgeGraphRebuildState 用户知识图谱重建的进度，按记录ID升序处理，Cursor为最后处理完成的记录ID
+// DryRun为true时只预览第一批记录的抽取结果，不写入Neo4j也不保存进度
+type KnowledgeGraphRebuildState struct {
+	UserID                 string     `json:"userId"`
+	Status                 string     `json:"status"` // running, completed, failed, interrupted
+	DryRun                 bool       `json:"dryRun,omitempty"`
+	Extraction             string     `json:"extraction"` // rule, llm
+	Cursor                 string     `json:"cursor,omitempty"`
+	Total                  int        `json:"total"`     // 本轮扫描到的记录数
+	Processed              int        `json:"processed"` // 已处理的记录数（含跳过和失败）
+	Rebuilt                int        `json:"rebuilt"`
+	Skipped                int        `json:"skipped"`
+	Failed                 int        `json:"failed"`
+	FailedIDs              []string   `json:"failedIds,omitempty"`
+	EntitiesExtracted      int        `json:"entitiesExtracted"`
+	RelationshipsExtracted int        `json:"relationshipsExtracted"`
+	ConceptsCreated        int        `json:"conceptsCreated"`
+	ConceptsMerged         int        `json:"conceptsMerged"`
+	RelationshipsCreated   int        `json:"relationshipsCreated"`
+	RelationshipsMerged    int        `json:"relationshipsMerged"`
+	RelationshipsSkipped   int        `json:"relationshipsSkipped"` // 端点概念不存在等原因未写入的关系
+	Error                  string     `json:"error,omitempty"`
+	StartedAt              time.Time  `json:"startedAt"`
+	UpdatedAt              time.Time  `json:"updatedAt"`
+	CompletedAt            *time.Time `json:"completedAt,omitempty"`
+}
+
 // RetrieveConversationRequest 检索对话请求
 type RetrieveConversationRequest struct {
 	SessionID     string `json:"sessionId"`
@@ -133,6 +511,8 @@ type RetrieveConversationRequest struct {
 	MessageID     string `json:"messageId,omitempty"`     // 新增：通过消息ID精确检索
 	BatchID       string `json:"batchId,omitempty"`       // 新增：通过批次ID检索
 	SkipThreshold bool   `json:"skipThreshold,omitempty"` // 新增：是否跳过相似度阈值过滤
+	// IncludeArchived 同时返回已归档的记录，默认排除
+	IncludeArchived bool `json:"includeArchived,omitempty"`
 }
 
 // ConversationResponse 对话响应
@@ -210,13 +590,16 @@ type Session struct {
 	CreatedAt  time.Time              `json:"created_at"`
 	LastActive time.Time              `json:"last_active"`
 	Summary    string                 `json:"summary,omitempty"`
-	Status     string                 `json:"status"` // active, archived
+	SummaryKey string                 `json:"summary_key,omitempty"` // 生成摘要时的历史指纹，用于判断是否需要重新摘要
+	Status     string                 `json:"status"`                // active, archived
 	Messages   []*Message             `json:"messages,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 	// 新增会话管理字段
 	ProjectInfo *ProjectInfo         `json:"project_info,omitempty"`
 	EditHistory []*EditAction        `json:"edit_history,omitempty"`
 	CodeContext map[string]*CodeFile `json:"code_context,omitempty"`
+	// LLM驱动的语境模型，重启后从这里恢复而不是从头重建
+	ContextModel *PersistedContextModel `json:"context_model,omitempty"`
 }
 
 // MCP协议支持 ------------------------------------
@@ -308,7 +691,7 @@ func NewSession(id string) *Session {
 // SearchResult 搜索结果
 type SearchResult struct {
 	ID     string                 `json:"id"`
-	Score  float64                `json:"score"`
+	Score  float64                `json:"score"` // 相似度检索的得分，各向量存储统一为0-1相似度（越大越相似）
 	Fields map[string]interface{} `json:"fields,omitempty"`
 }
 
@@ -321,6 +704,27 @@ const (
 	MetadataTypeCode        = "code"
 	MetadataTypeRequirement = "requirement"
 	MetadataTypeDecision    = "decision"
+
+	// MetadataArchivedKey 记忆已归档（软删除）的标记，归档的记忆默认不参与检索
+	MetadataArchivedKey = "archived"
+	// MetadataArchivedAtKey 记忆的归档时间（unix秒）
+	MetadataArchivedAtKey = "archivedAt"
+	// MetadataStorageEnginesKey 多维度存储时计划写入的存储引擎列表
+	MetadataStorageEnginesKey = "storageEngines"
+	// MetadataCollectionKey 记忆所属的命名集合，同一用户的记忆按集合划分逻辑分区
+	MetadataCollectionKey = "collection"
+)
+
+// 内容类型常量
+const (
+	ContentTypeText  = "text"
+	ContentTypeImage = "image" // 图片：记录只保存外部引用，Content为说明文字
+)
+
+// 非文本内容的类型和外部引用保存在metadata中，各向量存储都会持久化metadata
+const (
+	MetadataContentTypeKey = "contentType"
+	MetadataContentRefKey  = "contentRef"
 )
 
 // Priority 优先级常量
@@ -352,6 +756,18 @@ const (
 	SessionStatusArchived = "archived"
 )
 
+// SessionMetadataPinned 会话元数据中的置顶标记，置顶会话不会被不活跃清理归档
+const SessionMetadataPinned = "pinned"
+
+// SessionMetadataMergedInto 会话元数据中记录的合并目标会话ID，源会话合并后归档
+const SessionMetadataMergedInto = "mergedInto"
+
+// 会话元数据中的LLM覆盖配置，存储分析链路优先使用会话指定的提供商和模型
+const (
+	SessionMetadataLLMProvider = "llmProvider"
+	SessionMetadataLLMModel    = "llmModel"
+)
+
 // 新增决策与编辑关联相关的结构
 
 // EditDecisionLink 编辑与决策关联
@@ -476,6 +892,7 @@ type TodoItem struct {
 	CompletedAt int64                  `json:"completedAt,omitempty"`
 	UserID      string                 `json:"userId,omitempty"` // 非必须字段
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Score       *float64               `json:"score,omitempty"` // 按query检索时与查询的相似度（0-1），列表模式下为空
 }
 
 // RetrieveTodosRequest 检索待办事项请求
@@ -484,6 +901,9 @@ type RetrieveTodosRequest struct {
 	UserID    string `json:"userId,omitempty"` // 非必须参数
 	Status    string `json:"status,omitempty"` // all, pending, completed
 	Limit     int    `json:"limit,omitempty"`
+	Query     string `json:"query,omitempty"` // 非空时按与查询的相关度检索待办，可与status同时使用
+	// IncludeArchived 同时返回已归档的待办，默认排除
+	IncludeArchived bool `json:"includeArchived,omitempty"`
 }
 
 // RetrieveTodosResponse 检索待办事项响应
@@ -495,6 +915,480 @@ type RetrieveTodosResponse struct {
 	Description string      `json:"description,omitempty"`
 }
 
+// TimelineQueryResponse 时间线范围查询响应
+type TimelineQueryResponse struct {
+	From            time.Time           `json:"from"`
+	To              time.Time           `json:"to"`
+	Events          []TimelineEventItem `json:"events"`
+	Total           int                 `json:"total"`           // 时间窗口内的事件总数（不受limit限制）
+	EventTypeCounts map[string]int      `json:"eventTypeCounts"` // 按事件类型统计，用于活动图表
+}
+
+// TimelineEventItem 时间线事件摘要
+type TimelineEventItem struct {
+	ID              string    `json:"id"`
+	Timestamp       time.Time `json:"timestamp"`
+	EventType       string    `json:"eventType"`
+	Title           string    `json:"title"`
+	Summary         string    `json:"summary,omitempty"`
+	Keywords        []string  `json:"keywords,omitempty"`
+	ImportanceScore float64   `json:"importanceScore"`
+	SessionID       string    `json:"sessionId,omitempty"`
+	WorkspaceID     string    `json:"workspaceId,omitempty"`
+}
+
+// KnowledgeGraphResponse 知识图谱子图查询响应
+type KnowledgeGraphResponse struct {
+	EntityName    string                       `json:"entityName"`
+	MaxDepth      int                          `json:"maxDepth"`
+	Nodes         []KnowledgeGraphNode         `json:"nodes"`
+	Relationships []KnowledgeGraphRelationship `json:"relationships"`
+	Truncated     bool                         `json:"truncated"` // 节点数超过上限时为true
+}
+
+// KnowledgeGraphNode 知识图谱节点
+type KnowledgeGraphNode struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"` // Concept, Technology等
+	Category    string   `json:"category,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+}
+
+// KnowledgeGraphRelationship 知识图谱关系
+type KnowledgeGraphRelationship struct {
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	Type        string  `json:"type"`
+	Strength    float64 `json:"strength"`
+	Description string  `json:"description,omitempty"`
+}
+
+// 实体画像的数据来源
+const (
+	EntitySourceGraph  = "graph"  // 在知识图谱中找到实体
+	EntitySourceVector = "vector" // 知识图谱中没有该实体（或Neo4j未启用），按实体名向量检索
+)
+
+// GetEntityRequest 获取实体画像请求
+type GetEntityRequest struct {
+	SessionID   string `json:"sessionId"`
+	EntityName  string `json:"entityName"`
+	MemoryLimit int    `json:"memoryLimit,omitempty"` // 返回的来源记忆数上限，0表示使用默认值
+}
+
+// EntityProfile 实体画像：实体在知识图谱中的关系和关联的来源记忆
+type EntityProfile struct {
+	EntityName  string              `json:"entityName"`
+	Source      string              `json:"source"`           // graph或vector
+	Entity      *KnowledgeGraphNode `json:"entity,omitempty"` // 图谱中的实体节点，source=vector时为空
+	Relations   []EntityRelation    `json:"relations"`
+	Memories    []EntityMemory      `json:"memories"`
+	Description string              `json:"description,omitempty"`
+}
+
+// EntityRelation 实体与一个相邻实体的关系
+type EntityRelation struct {
+	Type        string  `json:"type"`
+	Direction   string  `json:"direction"` // outgoing: 实体指向相邻实体，incoming: 相邻实体指向实体
+	Entity      string  `json:"entity"`    // 相邻实体名称
+	Label       string  `json:"label,omitempty"`
+	Category    string  `json:"category,omitempty"`
+	Strength    float64 `json:"strength"`
+	Description string  `json:"description,omitempty"`
+}
+
+// EntityMemory 实体关联的来源记忆片段
+type EntityMemory struct {
+	MemoryID  string  `json:"memoryId"`
+	Snippet   string  `json:"snippet"`
+	Type      string  `json:"type,omitempty"`
+	Timestamp int64   `json:"timestamp,omitempty"`
+	Via       string  `json:"via,omitempty"`   // 通过哪个相邻实体关联，为空表示直接关联到实体
+	Score     float64 `json:"score,omitempty"` // 向量检索的相似度，source=vector时返回
+}
+
+// UpdateTodoRequest 更新待办事项请求
+type UpdateTodoRequest struct {
+	SessionID   string `json:"sessionId"`
+	UserID      string `json:"userId,omitempty"`
+	MemoryID    string `json:"memoryId"`
+	Status      string `json:"status"`                // pending, completed
+	Priority    string `json:"priority,omitempty"`    // 可选，P0-P3
+	CompletedAt int64  `json:"completedAt,omitempty"` // 可选，不传且状态为completed时使用当前时间
+}
+
+// SessionExportVersion 会话导出格式版本
+const SessionExportVersion = 1
+
+// SessionExport 会话导出数据，用于备份和跨设备迁移
+type SessionExport struct {
+	Version    int               `json:"version"`
+	ExportedAt int64             `json:"exportedAt"`
+	UserID     string            `json:"userId"` // 导出者用户ID
+	Session    *Session          `json:"session"`
+	MemoryIDs  []string          `json:"memoryIds"`
+	Memories   []*ExportedMemory `json:"memories,omitempty"` // 长期记忆内容，导入时用于重新生成向量
+}
+
+// ExportedMemory 导出的长期记忆
+type ExportedMemory struct {
+	ID        string                 `json:"id"`
+	Content   string                 `json:"content"`
+	Priority  string                 `json:"priority,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	BizType   int                    `json:"bizType,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ImportSessionRequest 导入会话请求
+type ImportSessionRequest struct {
+	UserID          string         `json:"userId"`                    // 导入者用户ID
+	Data            *SessionExport `json:"data"`                      // export_session导出的数据
+	TargetSessionID string         `json:"targetSessionId,omitempty"` // 可选，默认使用导出数据中的会话ID
+	Force           bool           `json:"force,omitempty"`           // 目标会话已存在时是否覆盖
+}
+
+// ImportSessionResponse 导入会话响应
+type ImportSessionResponse struct {
+	SessionID        string `json:"sessionId"`
+	UserID           string `json:"userId"`
+	Overwritten      bool   `json:"overwritten"`
+	MessageCount     int    `json:"messageCount"`
+	EditCount        int    `json:"editCount"`
+	CodeFileCount    int    `json:"codeFileCount"`
+	MemoriesRestored int    `json:"memoriesRestored"` // 重新生成向量并写入的记忆数
+	MemoriesSkipped  int    `json:"memoriesSkipped"`  // 向量存储中已存在的记忆数
+	MemoriesFailed   int    `json:"memoriesFailed"`
+}
+
+// MergeSessionsRequest 合并会话请求，源会话的内容并入目标会话后归档
+type MergeSessionsRequest struct {
+	UserID          string `json:"userId"`
+	TargetSessionID string `json:"targetSessionId"`
+	SourceSessionID string `json:"sourceSessionId"`
+}
+
+// MergeSessionsResponse 合并会话响应
+type MergeSessionsResponse struct {
+	TargetSessionID string   `json:"targetSessionId"`
+	SourceSessionID string   `json:"sourceSessionId"`
+	MergedMessages  int      `json:"mergedMessages"`
+	MergedMemories  int      `json:"mergedMemories"` // 改挂到目标会话的长期记忆数，不含消息向量
+	MergedEdits     int      `json:"mergedEdits"`
+	MergedCodeFiles int      `json:"mergedCodeFiles"`
+	SourceArchived  bool     `json:"sourceArchived"`
+	Session         *Session `json:"session"` // 合并后的目标会话
+}
+
+// SessionMetadataLinkedSessions 会话元数据中的关联会话列表，每项包含session_id、relationship、description、topics和timestamp
+const SessionMetadataLinkedSessions = "linked_sessions"
+
+// 会话关联类型，建立关联时在对方会话上记录相反方向的关系
+const (
+	SessionRelationContinues   = "continues"    // 本会话是对方会话的延续
+	SessionRelationContinuedBy = "continued-by" // 对方会话延续了本会话
+	SessionRelationRelated     = "related"
+	SessionRelationForkedFrom  = "forked-from" // 本会话从对方会话分出
+	SessionRelationForkedInto  = "forked-into" // 对方会话从本会话分出
+)
+
+// LinkSessionsRequest 关联两个会话的请求，关联双向记录在两个会话的元数据中
+type LinkSessionsRequest struct {
+	UserID          string   `json:"userId"`
+	SourceSessionID string   `json:"sourceSessionId"`
+	TargetSessionID string   `json:"targetSessionId"`
+	Relationship    string   `json:"relationship"` // 从源会话看目标会话的关系: continues, related, forked-from
+	Description     string   `json:"description,omitempty"`
+	Topics          []string `json:"topics,omitempty"`
+}
+
+// LinkSessionsResponse 关联会话响应
+type LinkSessionsResponse struct {
+	SourceSessionID string           `json:"sourceSessionId"`
+	TargetSessionID string           `json:"targetSessionId"`
+	SourceLink      SessionReference `json:"sourceLink"` // 记录在源会话上的关联
+	TargetLink      SessionReference `json:"targetLink"` // 记录在目标会话上的反向关联
+}
+
+// 会话清理审计动作
+const (
+	CleanupActionArchive        = "archive_session" // 归档不活跃会话
+	CleanupActionRetain         = "retain_session"  // 过期但按策略保留
+	CleanupActionRemoveMessages = "remove_messages" // 清理过期的短期记忆消息
+)
+
+// CleanupAuditEntry 单个会话的清理明细
+type CleanupAuditEntry struct {
+	SessionID    string `json:"sessionId"`
+	Action       string `json:"action"`
+	Reason       string `json:"reason"`
+	MessageCount int    `json:"messageCount"`         // 归档会话的消息数，或清理掉的过期消息数
+	LastActive   int64  `json:"lastActive,omitempty"` // 会话最后活跃时间（unix秒）
+}
+
+// CleanupAudit 一次会话清理任务的审计记录，演练模式下记录的是将被清理的数据
+type CleanupAudit struct {
+	StartedAt         time.Time           `json:"startedAt"`
+	FinishedAt        time.Time           `json:"finishedAt"`
+	DryRun            bool                `json:"dryRun"`
+	SessionTimeout    string              `json:"sessionTimeout"`
+	ShortMemoryMaxAge int                 `json:"shortMemoryMaxAge"` // 短期记忆保留天数
+	ArchivedSessions  int                 `json:"archivedSessions"`
+	RetainedSessions  int                 `json:"retainedSessions"`
+	RemovedMessages   int                 `json:"removedMessages"`
+	Entries           []CleanupAuditEntry `json:"entries"`
+}
+
+// DeleteMemoryRequest 删除记忆请求
+type DeleteMemoryRequest struct {
+	SessionID string `json:"sessionId"`
+	MemoryID  string `json:"memoryId,omitempty"` // 与batchId二选一
+	BatchID   string `json:"batchId,omitempty"`  // 与memoryId二选一
+}
+
+// DeleteMemoryResponse 删除记忆响应
+type DeleteMemoryResponse struct {
+	DeletedCount     int    `json:"deletedCount"`     // 向量存储中删除的记录数
+	TimelineDeleted  int    `json:"timelineDeleted"`  // TimescaleDB中删除的时间线事件数
+	ConceptsDeleted  int    `json:"conceptsDeleted"`  // Neo4j中删除的概念节点数
+	RelationsDeleted int    `json:"relationsDeleted"` // Neo4j中删除的关系数
+	MemoryID         string `json:"memoryId,omitempty"`
+	BatchID          string `json:"batchId,omitempty"`
+	Description      string `json:"description,omitempty"`
+}
+
+// DeleteMemoriesByFilterRequest 按条件批量删除记忆请求，只作用于sessionId所属用户的记录
+// 默认演练只返回匹配数量，confirm为true时才删除；过滤条件为空或匹配该用户全部记录时需设置allowAll
+type DeleteMemoriesByFilterRequest struct {
+	SessionID       string `json:"sessionId"`                 // 调用方会话，用于确定用户
+	FilterSessionID string `json:"filterSessionId,omitempty"` // 只删除该会话的记忆
+	Type            string `json:"type,omitempty"`            // 记忆类型，如long_term_memory、todo、message
+	Priority        string `json:"priority,omitempty"`        // P0-P3
+	StartTime       int64  `json:"startTime,omitempty"`       // 时间范围起点（unix秒，含）
+	EndTime         int64  `json:"endTime,omitempty"`         // 时间范围终点（unix秒，含）
+	Confirm         bool   `json:"confirm,omitempty"`         // 为true时执行删除，否则只预览
+	AllowAll        bool   `json:"allowAll,omitempty"`        // 允许删除该用户的全部记忆
+}
+
+// DeleteMemoriesByFilterResponse 按条件批量删除记忆响应
+type DeleteMemoriesByFilterResponse struct {
+	DryRun           bool     `json:"dryRun"`
+	Matched          int      `json:"matched"`          // 匹配的向量记录数
+	MatchesAll       bool     `json:"matchesAll"`       // 条件匹配了该用户的全部记录
+	SampleIDs        []string `json:"sampleIds"`        // 匹配记录的部分ID，便于核对
+	DeletedCount     int      `json:"deletedCount"`     // 向量存储中删除的记录数
+	TimelineDeleted  int      `json:"timelineDeleted"`  // TimescaleDB中删除的时间线事件数
+	ConceptsDeleted  int      `json:"conceptsDeleted"`  // Neo4j中删除的概念节点数，演练时为将删除的数量（共享的概念只移除归属，不计入）
+	RelationsDeleted int      `json:"relationsDeleted"` // Neo4j中删除的关系数，演练时为将删除的数量
+	Description      string   `json:"description,omitempty"`
+}
+
+// UpdateMemoryRequest 原地更新记忆请求，content和metadata至少提供一个
+type UpdateMemoryRequest struct {
+	SessionID string                 `json:"sessionId"`
+	MemoryID  string                 `json:"memoryId"`
+	Content   string                 `json:"content,omitempty"`  // 新内容，为空时保持原内容
+	Metadata  map[string]interface{} `json:"metadata,omitempty"` // 合并到原metadata，值为null的键会被删除
+}
+
+// UpdateMemoryResponse 原地更新记忆响应
+type UpdateMemoryResponse struct {
+	Memory          MemoryResult `json:"memory"`          // 更新后的记录
+	ContentChanged  bool         `json:"contentChanged"`  // 内容是否变化（变化时重新生成了向量）
+	TimelineUpdated int          `json:"timelineUpdated"` // TimescaleDB中更新的时间线事件数
+	ConceptsUpdated int          `json:"conceptsUpdated"` // Neo4j中标记更新的概念节点数
+}
+
+// ArchiveMemoryRequest 归档或恢复记忆请求
+type ArchiveMemoryRequest struct {
+	SessionID string `json:"sessionId"`
+	MemoryID  string `json:"memoryId"`
+}
+
+// ArchiveMemoryResponse 归档或恢复记忆响应
+type ArchiveMemoryResponse struct {
+	MemoryID   string       `json:"memoryId"`
+	Archived   bool         `json:"archived"`             // 操作后是否处于归档状态
+	ArchivedAt int64        `json:"archivedAt,omitempty"` // 归档时间（unix秒），恢复后为0
+	Memory     MemoryResult `json:"memory"`               // 操作后的记录
+}
+
+// ReanalyzeMemoryRequest 重新分析已存储记忆的请求
+type ReanalyzeMemoryRequest struct {
+	SessionID string `json:"sessionId"`
+	MemoryID  string `json:"memoryId"`
+}
+
+// ReanalyzeMemoryResponse 重新分析已存储记忆的响应
+type ReanalyzeMemoryResponse struct {
+	MemoryID          string                `json:"memoryId"`
+	OverallConfidence float64               `json:"overallConfidence"`       // 本次LLM分析的整体置信度
+	NewlyPopulated    []string              `json:"newlyPopulated"`          // 本次新写入成功的存储引擎
+	AlreadyPopulated  []string              `json:"alreadyPopulated"`        // 此前已写入、本次跳过的存储引擎
+	Skipped           map[string]string     `json:"skipped,omitempty"`       // 未写入的存储引擎及原因（分析未推荐、引擎不可用等）
+	EngineResults     []StorageEngineResult `json:"engineResults,omitempty"` // 本次尝试写入的各存储引擎结果
+}
+
+// QueryByMetadataRequest 按metadata键值查询记忆的请求，只返回sessionId所属用户的记录
+// metadata中的键值条件和exists中的键需全部满足，键可用点号访问嵌套字段
+type QueryByMetadataRequest struct {
+	SessionID       string                 `json:"sessionId"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`        // 键值相等条件，值为字符串、数字或bool；记录中的值为数组时包含该值即满足
+	Exists          []string               `json:"exists,omitempty"`          // 必须存在（且不为null）的键
+	Limit           int                    `json:"limit,omitempty"`           // 返回数量，默认20，最大100
+	IncludeArchived bool                   `json:"includeArchived,omitempty"` // 是否包含已归档的记忆
+}
+
+// QueryByMetadataResponse 按metadata键值查询记忆的响应
+type QueryByMetadataResponse struct {
+	Memories     []MemoryResult `json:"memories"`            // 按时间从新到旧排列
+	Total        int            `json:"total"`               // 匹配的记录数
+	Scanned      int            `json:"scanned"`             // 扫描的该用户记录数
+	ServerFilter string         `json:"serverFilter"`        // 由向量存储在服务端执行的过滤条件
+	PostFiltered []string       `json:"postFiltered"`        // 在服务层对扫描结果过滤的metadata键
+	Truncated    bool           `json:"truncated,omitempty"` // 找到limit条匹配后停止扫描更早的记录，total只统计已扫描部分
+}
+
+// 清除用户数据涉及的后端
+const (
+	PurgeBackendSessionStore   = "session_store"
+	PurgeBackendVector         = "vector"
+	PurgeBackendTimeline       = "timeline"
+	PurgeBackendKnowledgeGraph = "knowledge_graph"
+)
+
+// PurgeBackendReport 单个后端的用户数据清除结果
+type PurgeBackendReport struct {
+	Backend  string `json:"backend"`
+	Status   string `json:"status"`             // ok、error、disabled
+	Removed  int    `json:"removed"`            // 删除的记录数：会话存储为文件数，知识图谱为概念、关系和User节点之和
+	Detached int    `json:"detached,omitempty"` // 知识图谱中与其他用户共享、只移除了该用户归属的概念和关系数
+	Error    string `json:"error,omitempty"`
+}
+
+// PurgeUserReport 清除用户全部数据的结果
+type PurgeUserReport struct {
+	UserID   string               `json:"userId"`
+	Complete bool                 `json:"complete"` // 所有启用的后端均清除成功；为false时可重新执行
+	Backends []PurgeBackendReport `json:"backends"`
+	PurgedAt time.Time            `json:"purgedAt"`
+}
+
+// ReconcileReport 用户向量记录与会话存储的一致性检查结果
+type ReconcileReport struct {
+	UserID          string             `json:"userId"`
+	DryRun          bool               `json:"dryRun"`          // 演练模式只报告，不删除孤立向量
+	ScannedVectors  int                `json:"scannedVectors"`  // 扫描的向量记录数
+	ScannedSessions int                `json:"scannedSessions"` // 扫描的会话数
+	Truncated       bool               `json:"truncated"`       // 向量记录达到扫描上限，可能有未检查的记录
+	OrphanedVectors []OrphanedVector   `json:"orphanedVectors"` // 所属会话已不存在的向量记录
+	RemovedVectors  int                `json:"removedVectors"`  // 已删除的孤立向量数，演练模式为0
+	MissingMemories []MissingMemoryRef `json:"missingMemories"` // 会话中已写入向量存储、但向量记录已不存在的消息
+	CheckedAt       time.Time          `json:"checkedAt"`
+}
+
+// OrphanedVector 所属会话已不存在的向量记录
+type OrphanedVector struct {
+	ID        string `json:"id"`
+	MemoryID  string `json:"memoryId,omitempty"`
+	SessionID string `json:"sessionId"`
+	Type      string `json:"type,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+// MissingMemoryRef 会话中引用、但向量存储中已不存在的记忆
+type MissingMemoryRef struct {
+	SessionID string `json:"sessionId"`
+	MessageID string `json:"messageId"`
+	BatchID   string `json:"batchId,omitempty"`
+}
+
+// ListMemoriesRequest 列出会话记忆请求
+type ListMemoriesRequest struct {
+	SessionID string `json:"sessionId"`
+	Type      string `json:"type,omitempty"`     // long_term_memory, todo, conversation_summary，空表示全部
+	Priority  string `json:"priority,omitempty"` // P0-P3，空表示全部
+	SortBy    string `json:"sortBy,omitempty"`   // timestamp(默认，新的在前), priority(高的在前)
+	Limit     int    `json:"limit,omitempty"`
+	Offset    int    `json:"offset,omitempty"`
+	// IncludeArchived 同时列出已归档的记忆，默认排除
+	IncludeArchived bool `json:"includeArchived,omitempty"`
+}
+
+// ListMemoriesResponse 列出会话记忆响应
+type ListMemoriesResponse struct {
+	Items  []MemoryListItem `json:"items"`
+	Total  int              `json:"total"` // 过滤后的总数（不受分页影响）
+	Limit  int              `json:"limit"`
+	Offset int              `json:"offset"`
+}
+
+// MemoryListItem 记忆列表项
+type MemoryListItem struct {
+	MemoryID  string `json:"memoryId"`
+	Preview   string `json:"preview"` // 内容预览，超长时截断
+	Type      string `json:"type"`
+	Priority  string `json:"priority,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Archived  bool   `json:"archived,omitempty"`
+}
+
+// SessionStats 会话统计：记忆按类型/优先级/存储引擎的分布、token估算和最近活动
+type SessionStats struct {
+	SessionID       string         `json:"sessionId"`
+	TotalMemories   int            `json:"totalMemories"`           // 未归档的记忆数
+	ArchivedCount   int            `json:"archivedCount"`           // 已归档的记忆数，不计入各项分布
+	ByType          map[string]int `json:"byType"`                  // 按metadata.type统计
+	ByPriority      map[string]int `json:"byPriority"`              // 按优先级统计，缺失时计为P2
+	ByStorageEngine map[string]int `json:"byStorageEngine"`         // 按存储引擎(timeline/knowledge_graph/vector)统计
+	EstimatedTokens int            `json:"estimatedTokens"`         // 记忆内容的估算token数
+	MessageCount    int            `json:"messageCount"`            // 会话中的对话消息数
+	MessageTokens   int            `json:"messageTokens"`           // 对话消息的估算token数
+	FirstMemoryAt   int64          `json:"firstMemoryAt,omitempty"` // 最早记忆的时间（unix秒）
+	LastMemoryAt    int64          `json:"lastMemoryAt,omitempty"`  // 最新记忆的时间（unix秒）
+	LastActive      time.Time      `json:"lastActive"`              // 会话最后活跃时间
+	Status          string         `json:"status,omitempty"`        // 会话状态
+	Truncated       bool           `json:"truncated,omitempty"`     // 记忆数超过单次扫描上限，统计只覆盖扫描到的记录
+	GeneratedAt     int64          `json:"generatedAt"`             // 统计时间（unix秒）
+}
+
+// GetConversationRequest 获取完整对话记录请求
+type GetConversationRequest struct {
+	SessionID string `json:"sessionId"`
+	BatchID   string `json:"batchId,omitempty"` // 为空时返回整个会话的对话；拆分批次({batchId}-N)会合并返回
+	// IncludeArchived 从向量存储还原时同时返回已归档的批次，默认排除
+	IncludeArchived bool `json:"includeArchived,omitempty"`
+}
+
+// ConversationTranscript 按时间顺序还原的对话记录
+type ConversationTranscript struct {
+	SessionID string             `json:"sessionId"`
+	BatchID   string             `json:"batchId,omitempty"`
+	Batches   []string           `json:"batches,omitempty"` // 组成该对话的批次ID，按拆分序号排列
+	Source    string             `json:"source"`            // session(会话中保存的原始消息) 或 vector_store
+	Messages  []ConversationTurn `json:"messages"`
+}
+
+// ConversationTurn 对话记录中的一条消息
+type ConversationTurn struct {
+	ID        string `json:"id"`
+	BatchID   string `json:"batchId,omitempty"`
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// WorkspaceInfo 由用户会话归纳出的工作空间
+type WorkspaceInfo struct {
+	Name            string    `json:"name"`                      // 工作空间路径的最后一级目录名
+	Hash            string    `json:"hash"`                      // 与会话元数据workspaceHash一致的工作空间标识
+	Path            string    `json:"path,omitempty"`            // 工作空间根路径，旧会话可能未记录
+	LastActive      time.Time `json:"lastActive"`                // 该工作空间下会话的最近活跃时间
+	SessionCount    int       `json:"sessionCount"`              // 该工作空间下的会话数量
+	ActiveSessionID string    `json:"activeSessionId,omitempty"` // 最近活跃的活跃会话，无活跃会话时为空
+}
+
 // UserConfig 用户配置
 type UserConfig struct {
 	UserID string `json:"userId"` // 用户唯一标识
@@ -539,6 +1433,15 @@ type LocalInstruction struct {
 	Priority   string                `json:"priority,omitempty"` // 优先级 (low/normal/high)
 }
 
+// PendingInstruction 已推送但尚未收到客户端确认的本地指令
+type PendingInstruction struct {
+	Instruction   LocalInstruction `json:"instruction"`
+	SessionID     string           `json:"sessionId,omitempty"`
+	Attempts      int              `json:"attempts"` // 已推送到在线连接的次数
+	CreatedAt     time.Time        `json:"createdAt"`
+	LastAttemptAt *time.Time       `json:"lastAttemptAt,omitempty"`
+}
+
 // LocalCallbackRequest 本地操作回调请求
 type LocalCallbackRequest struct {
 	CallbackID string                 `json:"callbackId"`
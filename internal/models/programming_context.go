@@ -14,8 +14,30 @@ type ProgrammingContext struct {
 	ExtractedFeatures []string              `json:"extractedFeatures,omitempty"`
 	Statistics        ProgrammingStatistics `json:"statistics,omitempty"` // 新增：编程统计信息
 	Knowledge         KnowledgeGraph        `json:"knowledge,omitempty"`  // 新增：知识图谱
+	Timeline          []TimelineActivity    `json:"timeline,omitempty"`   // 合并的时间线事件（按时间倒序）
 }
 
+// ProgrammingContextRequest 获取编程上下文请求
+type ProgrammingContextRequest struct {
+	SessionID       string `json:"sessionId"`
+	Query           string `json:"query,omitempty"`
+	IncludeTimeline bool   `json:"includeTimeline,omitempty"` // 合并TimescaleDB中的时间线事件，配置开启时始终合并
+}
+
+// TimelineActivity 合并到编程上下文的时间线事件摘要
+type TimelineActivity struct {
+	ID           string   `json:"id"`
+	Timestamp    int64    `json:"timestamp"`
+	EventType    string   `json:"eventType"`
+	Title        string   `json:"title,omitempty"`
+	Summary      string   `json:"summary,omitempty"`
+	SessionID    string   `json:"sessionId,omitempty"`
+	RelatedFiles []string `json:"relatedFiles,omitempty"`
+}
+
+// ActivityTypeCodeEdit 会话内编辑历史在活动统计中的事件类型
+const ActivityTypeCodeEdit = "code_edit"
+
 // CodeFileInfo 代码文件信息
 type CodeFileInfo struct {
 	Path               string          `json:"path"`
@@ -104,15 +126,17 @@ type ContextReference struct {
 
 // ProgrammingStatistics 编程统计信息
 type ProgrammingStatistics struct {
-	TotalFiles          int                `json:"totalFiles"`
-	TotalEdits          int                `json:"totalEdits"`
-	LanguageUsage       map[string]int     `json:"languageUsage,omitempty"`       // 语言使用情况
-	EditsByFile         map[string]int     `json:"editsByFile,omitempty"`         // 按文件统计的编辑数
-	ActivityByDay       map[string]int     `json:"activityByDay,omitempty"`       // 按日期统计的活动数
-	DecisionsByCategory map[string]int     `json:"decisionsByCategory,omitempty"` // 按类别统计的决策数
-	EditPatterns        []EditPattern      `json:"editPatterns,omitempty"`        // 新增：编辑模式
-	CriticalPaths       []string           `json:"criticalPaths,omitempty"`       // 新增：关键路径文件
-	Complexity          map[string]float64 `json:"complexity,omitempty"`          // 新增：复杂度指标
+	TotalFiles          int                       `json:"totalFiles"`
+	TotalEdits          int                       `json:"totalEdits"`
+	LanguageUsage       map[string]int            `json:"languageUsage,omitempty"`       // 语言使用情况
+	EditsByFile         map[string]int            `json:"editsByFile,omitempty"`         // 按文件统计的编辑数
+	ActivityByDay       map[string]int            `json:"activityByDay,omitempty"`       // 按日期统计的活动数
+	ActivityByType      map[string]int            `json:"activityByType,omitempty"`      // 按事件类型统计的活动数
+	ActivityByDayType   map[string]map[string]int `json:"activityByDayType,omitempty"`   // 按日期和事件类型统计的活动数
+	DecisionsByCategory map[string]int            `json:"decisionsByCategory,omitempty"` // 按类别统计的决策数
+	EditPatterns        []EditPattern             `json:"editPatterns,omitempty"`        // 新增：编辑模式
+	CriticalPaths       []string                  `json:"criticalPaths,omitempty"`       // 新增：关键路径文件
+	Complexity          map[string]float64        `json:"complexity,omitempty"`          // 新增：复杂度指标
 }
 
 // EditPattern 编辑模式
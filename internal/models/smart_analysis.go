@@ -68,6 +68,9 @@ type VectorStorageRecommendation struct {
 
 // MultiVectorData 多向量数据
 type MultiVectorData struct {
+	// 向量维度（启动时探测到的嵌入维度），各维度向量长度均与其一致
+	Dimension int `json:"dimension,omitempty"`
+
 	// 四维度向量字段
 	CoreIntentVector    []float32 `json:"core_intent_vector,omitempty"`    // 核心意图向量
 	DomainContextVector []float32 `json:"domain_context_vector,omitempty"` // 领域上下文向量
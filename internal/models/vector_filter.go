@@ -0,0 +1,164 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FilterOp 向量检索过滤条件的类型
+type FilterOp string
+
+const (
+	FilterOpAnd   FilterOp = "and"
+	FilterOpOr    FilterOp = "or"
+	FilterOpEq    FilterOp = "eq"
+	FilterOpRange FilterOp = "range"
+)
+
+// 过滤条件中使用的逻辑字段名，各向量存储实现按需映射为自身的字段名（如Vearch的user_id）
+const (
+	FilterFieldUserID    = "userId"
+	FilterFieldSessionID = "session_id"
+	FilterFieldTimestamp = "timestamp"
+)
+
+// userIDPattern 合法用户ID的格式："user_"前缀加字母、数字或下划线
+var userIDPattern = regexp.MustCompile(`^user_[A-Za-z0-9_]{1,64}$`)
+
+// filterValueEscaper 转义过滤表达式字符串值中的反斜杠和双引号
+var filterValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// IsValidUserID 用户ID是否符合"user_"加字母数字的格式，不符合的用户ID不能用于拼接过滤条件
+func IsValidUserID(userID string) bool {
+	return userIDPattern.MatchString(userID)
+}
+
+// QuoteFilterValue 将字符串值转义并加双引号，用于拼接到过滤表达式中，
+// 值中的引号、空格和AND/OR等关键字不会改写表达式结构
+func QuoteFilterValue(value string) string {
+	return `"` + filterValueEscaper.Replace(value) + `"`
+}
+
+// Filter 向量检索的结构化过滤条件，由各VectorStore实现编译为自身的过滤语法
+// 值不经过字符串拼接传递，编译时按目标语法转义，避免未转义的用户ID等值改写过滤表达式
+type Filter struct {
+	Op       FilterOp    `json:"op"`
+	Field    string      `json:"field,omitempty"`
+	Value    interface{} `json:"value,omitempty"`    // eq的比较值：string、整数、浮点数或bool
+	Min      int64       `json:"min,omitempty"`      // range的下界（含），0表示不限制
+	Max      int64       `json:"max,omitempty"`      // range的上界（含），0表示不限制
+	Children []Filter    `json:"children,omitempty"` // and/or的子条件
+}
+
+// FilterEq 字段等于指定值
+func FilterEq(field string, value interface{}) Filter {
+	return Filter{Op: FilterOpEq, Field: field, Value: value}
+}
+
+// FilterRange 字段在[min, max]范围内，0表示该侧不限制；两侧都不限制时为空条件
+func FilterRange(field string, min, max int64) Filter {
+	if min <= 0 && max <= 0 {
+		return Filter{}
+	}
+	return Filter{Op: FilterOpRange, Field: field, Min: min, Max: max}
+}
+
+// FilterAnd 所有子条件同时满足，忽略空条件
+func FilterAnd(filters ...Filter) Filter {
+	return combineFilters(FilterOpAnd, filters)
+}
+
+// FilterOr 任一子条件满足，忽略空条件
+func FilterOr(filters ...Filter) Filter {
+	return combineFilters(FilterOpOr, filters)
+}
+
+// combineFilters 组合子条件，只剩一个子条件时直接返回该条件
+func combineFilters(op FilterOp, filters []Filter) Filter {
+	var children []Filter
+	for _, filter := range filters {
+		if !filter.IsEmpty() {
+			children = append(children, filter)
+		}
+	}
+	switch len(children) {
+	case 0:
+		return Filter{}
+	case 1:
+		return children[0]
+	default:
+		return Filter{Op: op, Children: children}
+	}
+}
+
+// IsEmpty 是否为空条件（不过滤）
+func (f Filter) IsEmpty() bool {
+	switch f.Op {
+	case "":
+		return true
+	case FilterOpAnd, FilterOpOr:
+		return len(f.Children) == 0
+	default:
+		return false
+	}
+}
+
+// EqValue 查找必须满足的字段等值条件（条件本身或顶层AND中的子条件），用于从过滤条件中获取用户ID等
+func (f Filter) EqValue(field string) (interface{}, bool) {
+	switch f.Op {
+	case FilterOpEq:
+		if f.Field == field {
+			return f.Value, true
+		}
+	case FilterOpAnd:
+		for _, child := range f.Children {
+			if value, ok := child.EqValue(field); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// String 过滤条件的通用文本形式，仅用于日志和诊断输出，各存储实际使用的语法以编译结果为准
+func (f Filter) String() string {
+	switch f.Op {
+	case FilterOpEq:
+		return fmt.Sprintf("%s=%s", f.Field, formatFilterValue(f.Value))
+	case FilterOpRange:
+		var clauses []string
+		if f.Min > 0 {
+			clauses = append(clauses, fmt.Sprintf("%s>=%d", f.Field, f.Min))
+		}
+		if f.Max > 0 {
+			clauses = append(clauses, fmt.Sprintf("%s<=%d", f.Field, f.Max))
+		}
+		return strings.Join(clauses, " AND ")
+	case FilterOpAnd, FilterOpOr:
+		separator := " AND "
+		if f.Op == FilterOpOr {
+			separator = " OR "
+		}
+		clauses := make([]string, 0, len(f.Children))
+		for _, child := range f.Children {
+			clause := child.String()
+			if len(child.Children) > 1 && child.Op != f.Op {
+				clause = "(" + clause + ")"
+			}
+			clauses = append(clauses, clause)
+		}
+		return strings.Join(clauses, separator)
+	default:
+		return ""
+	}
+}
+
+// formatFilterValue 日志中的值形式，字符串加引号并转义
+func formatFilterValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(value)
+}
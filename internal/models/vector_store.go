@@ -31,6 +31,20 @@ type EmbeddingProvider interface {
 	GetEmbeddingDimension() int
 }
 
+// ContextEmbeddingProvider 支持上下文的文本转向量接口（可选能力）
+// 实现后服务层超时时通过上下文取消进行中的请求，而不是只丢弃结果
+type ContextEmbeddingProvider interface {
+	// GenerateEmbeddingWithContext 将文本转换为向量表示，上下文取消时应尽快返回
+	GenerateEmbeddingWithContext(ctx context.Context, text string) ([]float32, error)
+}
+
+// BatchEmbeddingProvider 批量文本转向量接口（可选能力）
+// 支持在一次API请求中生成多条文本向量的嵌入服务才实现；服务层通过类型断言判断是否支持
+type BatchEmbeddingProvider interface {
+	// GenerateEmbeddings 批量生成向量，返回的向量与输入文本按下标一一对应
+	GenerateEmbeddings(texts []string) ([][]float32, error)
+}
+
 // MemoryStorage 记忆存储接口
 type MemoryStorage interface {
 	// StoreMemory 存储记忆到向量数据库
@@ -47,6 +61,9 @@ type MemoryStorage interface {
 
 	// StoreEnhancedMessage 存储增强的多维度消息（新增方法）
 	StoreEnhancedMessage(message *EnhancedMessage) error
+
+	// DeleteMemories 根据主键ID批量删除记忆
+	DeleteMemories(ctx context.Context, ids []string) error
 }
 
 // VectorSearcher 向量搜索接口
@@ -94,6 +111,37 @@ type UserDataStorage interface {
 	InitUserStorage() error
 }
 
+// 多维度向量字段名称，与MultiVectorData中的维度一一对应
+const (
+	VectorFieldCoreIntent    = "core_intent"
+	VectorFieldDomainContext = "domain_context"
+	VectorFieldScenario      = "scenario"
+)
+
+// MultiVectorSearcher 多维度向量搜索接口（可选能力）
+// 只有能为一条记录保存多个向量字段的存储才实现；服务层通过类型断言判断是否支持
+type MultiVectorSearcher interface {
+	// SupportsMultiVector 是否已启用多维度向量字段
+	SupportsMultiVector() bool
+
+	// SearchByVectorField 在指定维度向量字段上搜索，得分为相似度（越大越相似），结果Fields包含 <维度>_weight 形式的存储权重
+	SearchByVectorField(ctx context.Context, field string, vector []float32, options *SearchOptions) ([]SearchResult, error)
+
+	// DefaultSimilarityThreshold 未指定阈值时SearchByVector使用的相似度阈值
+	DefaultSimilarityThreshold() float64
+}
+
+// MetadataPayloadField 以结构化对象保存记录metadata的payload字段名，metadata_fields.<键> 可用于服务端过滤
+const MetadataPayloadField = "metadata_fields"
+
+// StructuredMetadataStore 以结构化payload保存metadata的向量存储（可选能力）
+// 实现的存储在MetadataPayloadField下保存metadata对象，服务层可将metadata等值条件编译为结构化过滤条件；
+// 该字段在此能力加入后写入，更早的记录需要重建（reindex）后才能被服务端过滤匹配
+type StructuredMetadataStore interface {
+	// SupportsStructuredMetadata 是否支持按 MetadataPayloadField.<键> 过滤
+	SupportsStructuredMetadata() bool
+}
+
 // SearchOptions 搜索选项配置
 type SearchOptions struct {
 	// Limit 结果数量限制
@@ -108,6 +156,9 @@ type SearchOptions struct {
 	// SkipThreshold 是否跳过相似度阈值过滤
 	SkipThreshold bool `json:"skipThreshold,omitempty"`
 
+	// Threshold 本次搜索的相似度阈值，大于0时覆盖全局配置（SkipThreshold优先）
+	Threshold float64 `json:"threshold,omitempty"`
+
 	// IsBruteSearch 是否启用暴力搜索（用于索引未训练的情况）
 	IsBruteSearch int `json:"isBruteSearch,omitempty"`
 
@@ -117,6 +168,13 @@ type SearchOptions struct {
 	// ExtraFilters 额外的过滤条件
 	ExtraFilters map[string]interface{} `json:"extraFilters,omitempty"`
 
+	// Filter 结构化过滤条件，由各存储实现编译为自身语法，与SessionID/UserID等条件同时生效
+	Filter *Filter `json:"filter,omitempty"`
+
+	// StartTime/EndTime 按timestamp字段过滤的时间范围（unix秒，含边界），0表示不限制
+	StartTime int64 `json:"startTime,omitempty"`
+	EndTime   int64 `json:"endTime,omitempty"`
+
 	// SortBy 排序字段
 	SortBy string `json:"sortBy,omitempty"`
 
@@ -218,6 +276,9 @@ const (
 	// VectorStoreTypeWeaviate Weaviate向量存储
 	VectorStoreTypeWeaviate VectorStoreType = "weaviate"
 
+	// VectorStoreTypeQdrant Qdrant向量存储（自托管或Qdrant Cloud）
+	VectorStoreTypeQdrant VectorStoreType = "qdrant"
+
 	// VectorStoreTypeLocal 本地向量存储
 	VectorStoreTypeLocal VectorStoreType = "local"
 )
@@ -231,7 +292,7 @@ func (vt VectorStoreType) String() string {
 func (vt VectorStoreType) IsValid() bool {
 	switch vt {
 	case VectorStoreTypeAliyun, VectorStoreTypeVearch, VectorStoreTypeTencent, VectorStoreTypeOpenAI,
-		VectorStoreTypePinecone, VectorStoreTypeWeaviate, VectorStoreTypeLocal:
+		VectorStoreTypePinecone, VectorStoreTypeWeaviate, VectorStoreTypeQdrant, VectorStoreTypeLocal:
 		return true
 	default:
 		return false
@@ -247,6 +308,7 @@ func GetSupportedVectorStoreTypes() []VectorStoreType {
 		VectorStoreTypeOpenAI,
 		VectorStoreTypePinecone,
 		VectorStoreTypeWeaviate,
+		VectorStoreTypeQdrant,
 		VectorStoreTypeLocal,
 	}
 }
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"fmt"
+	"log"
+)
+
+// =============================================================================
+// 分析prompt长度保护：调用LLM前估算prompt的token数，超过配置的上限时先改用更精简的prompt，
+// 仍超出时截断用户内容（保留开头和结尾），避免超大内容触发模型上下文长度错误
+// =============================================================================
+
+const (
+	minAnalysisContentTokens = 256                        // 截断后至少保留的用户内容token数
+	analysisTruncationMarker = "\n\n…[内容过长，中间省略%d字]…\n\n" // 截断用户内容时插入的省略标记
+)
+
+// analysisPromptMaxTokens 分析prompt的估算token上限，<=0表示不限制
+func (s *ContextService) analysisPromptMaxTokens() int {
+	if s.config == nil {
+		return 0
+	}
+	return s.config.AnalysisPromptMaxTokens
+}
+
+// guardAnalysisPrompt 按用户内容构建分析prompt，估算token数超过上限时收缩：
+// 提供了lean时先改用lean构建的精简prompt（保留完整内容），仍超出时截断用户内容，保留开头和结尾
+func (s *ContextService) guardAnalysisPrompt(label, content string, build, lean func(content string) string) string {
+	limit := s.analysisPromptMaxTokens()
+	prompt := build(content)
+	tokens := estimateTokens(prompt)
+	if limit <= 0 || tokens <= limit {
+		return prompt
+	}
+
+	if lean != nil {
+		if leanPrompt := lean(content); estimateTokens(leanPrompt) <= limit {
+			log.Printf("⚠️ [提示词限制] %s prompt估算%d个token，超过上限%d，改用不含知识图谱抽取的基础prompt", label, tokens, limit)
+			return leanPrompt
+		}
+	}
+
+	// 按模板自身的开销计算用户内容可用的token数，开销过大导致内容预算不足时改用精简prompt
+	budget := limit - estimateTokens(build(""))
+	if lean != nil && budget < minAnalysisContentTokens {
+		build = lean
+		budget = limit - estimateTokens(lean(""))
+	}
+	if budget < minAnalysisContentTokens {
+		budget = minAnalysisContentTokens
+	}
+
+	truncated := truncateHeadTail(content, budget)
+	prompt = build(truncated)
+	log.Printf("⚠️ [提示词限制] %s prompt估算%d个token，超过上限%d，用户内容从约%d个token截断为约%d个token（保留开头和结尾），截断后prompt约%d个token",
+		label, tokens, limit, estimateTokens(content), estimateTokens(truncated), estimateTokens(prompt))
+	return prompt
+}
+
+// truncateHeadTail 截断文本使估算token数不超过maxTokens：保留开头和结尾各约一半，中间替换为省略标记
+func truncateHeadTail(text string, maxTokens int) string {
+	if estimateTokens(text) <= maxTokens {
+		return text
+	}
+	runes := []rune(text)
+	// 按最长的省略字数预留标记的开销，实际省略字数更少时标记不会更长
+	available := maxTokens - estimateTokens(fmt.Sprintf(analysisTruncationMarker, len(runes)))
+	if available <= 0 {
+		return truncateToTokens(text, maxTokens)
+	}
+
+	head := tokenPrefixLen(runes, available/2)
+	tail := tokenSuffixLen(runes[head:], available-available/2)
+	return string(runes[:head]) + fmt.Sprintf(analysisTruncationMarker, len(runes)-head-tail) + string(runes[len(runes)-tail:])
+}
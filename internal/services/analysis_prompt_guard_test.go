@@ -0,0 +1,48 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestAnalysisPromptGuard 测试超长内容先改用基础prompt、仍超出时截断并保留开头和结尾，未超出或不限制时prompt不变
+func TestAnalysisPromptGuard(t *testing.T) {
+	contextData := &models.LLMDrivenContextModel{
+		SessionID: "session-1",
+		Core:      &models.CoreContext{CurrentFocus: "数据库迁移", IntentCategory: "technical", Complexity: "high"},
+	}
+	service := &ContextService{config: &config.Config{}}
+	enhanced := func(content string) string { return service.buildEnhancedSmartAnalysisPrompt(contextData, content) }
+	base := func(content string) string { return service.buildSmartAnalysisPrompt(contextData, content) }
+
+	content := "开头：迁移方案概述。" + strings.Repeat("执行迁移脚本并校验数据一致性。", 2000) + "结尾：迁移完成并回滚预案就绪。"
+	if got := service.guardAnalysisPrompt("增强分析", content, enhanced, base); got != enhanced(content) {
+		t.Error("不限制时prompt应保持不变")
+	}
+
+	// 基础prompt放得下完整内容时改用基础prompt，不截断
+	service.config.AnalysisPromptMaxTokens = estimateTokens(base(content))
+	if got := service.guardAnalysisPrompt("增强分析", content, enhanced, base); got != base(content) {
+		t.Error("增强prompt超出上限而基础prompt未超出时应改用基础prompt")
+	}
+
+	// 内容远超上限时截断，保留开头和结尾
+	service.config.AnalysisPromptMaxTokens = 4000
+	got := service.guardAnalysisPrompt("增强分析", content, enhanced, base)
+	if tokens := estimateTokens(got); tokens > 4000 {
+		t.Errorf("截断后prompt估算%d个token，超过上限4000", tokens)
+	}
+	if !strings.Contains(got, "开头：迁移方案概述。") || !strings.Contains(got, "结尾：迁移完成并回滚预案就绪。") || !strings.Contains(got, "中间省略") {
+		t.Error("截断后应保留内容的开头和结尾并标记省略")
+	}
+	if !strings.Contains(got, "知识图谱抽取补充") {
+		t.Error("模板开销不大时截断内容应保留增强prompt")
+	}
+
+	if truncated := truncateHeadTail("short", 10); truncated != "short" {
+		t.Errorf("未超出上限的内容不应截断: %q", truncated)
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"log"
+	"os"
+	"text/template"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 内置默认的分析prompt模板，未配置模板文件时使用
+//
+//go:embed prompts/*.tmpl
+var defaultPromptTemplates embed.FS
+
+// 内置模板文件名
+const (
+	smartAnalysisPromptFile = "smart_analysis.tmpl"
+	dedicatedKGPromptFile   = "dedicated_kg.tmpl"
+)
+
+// analysisPromptData 分析prompt模板的数据
+type analysisPromptData struct {
+	SessionID      string
+	CurrentFocus   string
+	IntentCategory string
+	Complexity     string
+	Content        string
+}
+
+// analysisPrompts 智能分析和知识图谱抽取使用的prompt模板
+type analysisPrompts struct {
+	smartAnalysis *template.Template
+	dedicatedKG   *template.Template
+}
+
+// defaultAnalysisPrompts 内置默认模板，编译进二进制，解析失败属于代码错误
+var defaultAnalysisPrompts = &analysisPrompts{
+	smartAnalysis: template.Must(template.ParseFS(defaultPromptTemplates, "prompts/"+smartAnalysisPromptFile)),
+	dedicatedKG:   template.Must(template.ParseFS(defaultPromptTemplates, "prompts/"+dedicatedKGPromptFile)),
+}
+
+// newAnalysisPrompts 按配置加载prompt模板，未配置的模板使用内置默认模板
+// 配置的模板文件不存在、解析失败或引用了不存在的字段时返回错误
+func newAnalysisPrompts(cfg *config.Config) (*analysisPrompts, error) {
+	prompts := &analysisPrompts{
+		smartAnalysis: defaultAnalysisPrompts.smartAnalysis,
+		dedicatedKG:   defaultAnalysisPrompts.dedicatedKG,
+	}
+	if cfg == nil {
+		return prompts, nil
+	}
+
+	var err error
+	if cfg.SmartAnalysisPromptTemplate != "" {
+		if prompts.smartAnalysis, err = loadPromptTemplate(cfg.SmartAnalysisPromptTemplate); err != nil {
+			return nil, fmt.Errorf("加载智能分析prompt模板失败(SMART_ANALYSIS_PROMPT_TEMPLATE): %w", err)
+		}
+	}
+	if cfg.KGPromptTemplate != "" {
+		if prompts.dedicatedKG, err = loadPromptTemplate(cfg.KGPromptTemplate); err != nil {
+			return nil, fmt.Errorf("加载知识图谱prompt模板失败(KG_PROMPT_TEMPLATE): %w", err)
+		}
+	}
+	return prompts, nil
+}
+
+// loadPromptTemplate 读取并解析模板文件，用空数据试渲染一次以提前发现引用了不存在字段的模板
+func loadPromptTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取模板文件失败: %w", err)
+	}
+	tmpl, err := template.New(path).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("解析模板失败: %w", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, analysisPromptData{}); err != nil {
+		return nil, fmt.Errorf("模板校验失败: %w", err)
+	}
+	log.Printf("📝 [Prompt模板] 已加载模板: %s", path)
+	return tmpl, nil
+}
+
+// LoadAnalysisPromptTemplates 按配置加载分析prompt模板，启动时调用，失败时保留当前模板并返回错误
+func (s *ContextService) LoadAnalysisPromptTemplates() error {
+	prompts, err := newAnalysisPrompts(s.config)
+	if err != nil {
+		return err
+	}
+	s.analysisPrompts = prompts
+	return nil
+}
+
+// prompts 获取当前使用的prompt模板，未加载时使用内置默认模板
+func (s *ContextService) prompts() *analysisPrompts {
+	if s.analysisPrompts != nil {
+		return s.analysisPrompts
+	}
+	return defaultAnalysisPrompts
+}
+
+// renderPrompt 渲染prompt模板，渲染失败时改用内置默认模板
+func renderPrompt(tmpl, fallback *template.Template, data analysisPromptData) string {
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if err == nil {
+		return buf.String()
+	}
+	log.Printf("⚠️ [Prompt模板] 渲染模板 %s 失败，使用内置默认模板: %v", tmpl.Name(), err)
+
+	buf.Reset()
+	if err := fallback.Execute(&buf, data); err != nil {
+		log.Printf("❌ [Prompt模板] 渲染内置模板 %s 失败: %v", fallback.Name(), err)
+	}
+	return buf.String()
+}
+
+// buildSmartAnalysisPrompt 构建智能分析的prompt（替换buildStorageAnalysisPrompt）
+func (s *ContextService) buildSmartAnalysisPrompt(contextData *models.LLMDrivenContextModel, content string) string {
+	return renderPrompt(s.prompts().smartAnalysis, defaultAnalysisPrompts.smartAnalysis, analysisPromptData{
+		SessionID:      contextData.SessionID,
+		CurrentFocus:   contextData.Core.CurrentFocus,
+		IntentCategory: string(contextData.Core.IntentCategory),
+		Complexity:     contextData.Core.Complexity,
+		Content:        content,
+	})
+}
+
+// buildDedicatedKGPrompt 构建专门的知识图谱抽取prompt（方案二：高质量专门化）
+func (s *ContextService) buildDedicatedKGPrompt(contextData *models.LLMDrivenContextModel, content string) string {
+	return renderPrompt(s.prompts().dedicatedKG, defaultAnalysisPrompts.dedicatedKG, analysisPromptData{
+		SessionID: contextData.SessionID,
+		Content:   content,
+	})
+}
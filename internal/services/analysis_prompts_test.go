@@ -0,0 +1,56 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestAnalysisPromptTemplates 测试默认模板、外部模板文件渲染以及模板文件缺失或无效时启动校验失败
+func TestAnalysisPromptTemplates(t *testing.T) {
+	contextData := &models.LLMDrivenContextModel{
+		SessionID: "session-1",
+		Core:      &models.CoreContext{CurrentFocus: "登录优化", IntentCategory: "technical", Complexity: "medium"},
+	}
+
+	service := &ContextService{config: &config.Config{}}
+	if err := service.LoadAnalysisPromptTemplates(); err != nil {
+		t.Fatalf("Expected default templates to load, got %v", err)
+	}
+	prompt := service.buildSmartAnalysisPrompt(contextData, "提升30%性能")
+	if !strings.Contains(prompt, "**会话焦点**: 登录优化") || !strings.Contains(prompt, "提升30%性能") || strings.Contains(prompt, "%!") {
+		t.Errorf("Unexpected default smart analysis prompt")
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	service.config.KGPromptTemplate = write("kg.tmpl", "会话{{.SessionID}}: {{.Content}}")
+	if err := service.LoadAnalysisPromptTemplates(); err != nil {
+		t.Fatalf("Expected custom template to load, got %v", err)
+	}
+	if prompt := service.buildDedicatedKGPrompt(contextData, "内容"); prompt != "会话session-1: 内容" {
+		t.Errorf("Unexpected custom KG prompt: %q", prompt)
+	}
+
+	for name, path := range map[string]string{
+		"missing":       filepath.Join(dir, "missing.tmpl"),
+		"parse error":   write("broken.tmpl", "{{.Content"),
+		"unknown field": write("unknown.tmpl", "{{.UserName}}"),
+	} {
+		service.config.SmartAnalysisPromptTemplate = path
+		if err := service.LoadAnalysisPromptTemplates(); err == nil || !strings.Contains(err.Error(), "SMART_ANALYSIS_PROMPT_TEMPLATE") {
+			t.Errorf("%s: expected clear startup error, got %v", name, err)
+		}
+	}
+}
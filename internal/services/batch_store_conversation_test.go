@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// failingMessageStore 写入指定内容的消息时失败的内存向量存储
+type failingMessageStore struct {
+	*vectorstore.InMemoryVectorStore
+	failContent string
+}
+
+func (f *failingMessageStore) StoreMessage(message *models.Message) error {
+	if message.Content == f.failContent {
+		return errors.New("写入失败")
+	}
+	return f.InMemoryVectorStore.StoreMessage(message)
+}
+
+// newBatchStoreTestService 创建使用内存向量存储和临时用户会话存储的服务，并预先写入批次ID为existing的记录
+func newBatchStoreTestService(t *testing.T, failContent string) (*ContextService, *vectorstore.InMemoryVectorStore) {
+	t.Helper()
+	memoryStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	existing := models.NewMessage("s1", models.RoleUser, "已有的对话", "text", "P2", map[string]interface{}{"batchId": "existing"})
+	existing.Vector, _ = memoryStore.GenerateEmbedding(existing.Content)
+	if err := memoryStore.StoreMessage(existing); err != nil {
+		t.Fatalf("写入已有记录失败: %v", err)
+	}
+
+	service := &ContextService{
+		config:             &config.Config{},
+		userSessionManager: store.NewUserSessionManager(t.TempDir()),
+	}
+	service.SetVectorStore(&failingMessageStore{InMemoryVectorStore: memoryStore, failContent: failContent})
+	return service, memoryStore
+}
+
+// conversationBatch 构造只含一条用户消息的批次
+func conversationBatch(batchID, content string) models.ConversationBatch {
+	return models.ConversationBatch{BatchID: batchID, Messages: []models.ConversationMessage{{Role: models.RoleUser, Content: content}}}
+}
+
+// TestBatchStoreConversationRollback 测试中间批次写入失败时回滚已写入的批次，已有记录不受影响
+func TestBatchStoreConversationRollback(t *testing.T) {
+	service, memoryStore := newBatchStoreTestService(t, "第二批")
+
+	response, err := service.BatchStoreConversation(context.Background(), models.BatchStoreConversationRequest{
+		SessionID: "s1",
+		UserID:    "user_a",
+		Batches:   []models.ConversationBatch{conversationBatch("b1", "第一批"), conversationBatch("b2", "第二批"), conversationBatch("b3", "第三批")},
+	})
+	if err != nil {
+		t.Fatalf("批量存储返回错误: %v", err)
+	}
+	if response.Committed || response.Error == "" {
+		t.Fatalf("中间批次失败时不应提交: %+v", response)
+	}
+	statuses := []string{response.Batches[0].Status, response.Batches[1].Status, response.Batches[2].Status}
+	if statuses[0] != "rolled_back" || statuses[1] != "failed" || statuses[2] != "skipped" {
+		t.Errorf("批次状态错误: %v", statuses)
+	}
+	if memoryStore.Len() != 1 {
+		t.Errorf("回滚后应只剩已有记录，实际%d条", memoryStore.Len())
+	}
+	if records, _ := memoryStore.SearchByID(context.Background(), "existing", nil); len(records) != 1 {
+		t.Error("回滚不应删除已有记录")
+	}
+
+	// 全部成功时提交
+	response, err = service.BatchStoreConversation(context.Background(), models.BatchStoreConversationRequest{
+		SessionID: "s1",
+		UserID:    "user_a",
+		Batches:   []models.ConversationBatch{conversationBatch("b1", "第一批"), conversationBatch("", "第三批")},
+	})
+	if err != nil || !response.Committed || memoryStore.Len() != 3 {
+		t.Errorf("全部成功时应提交: %+v, %v, 记录数%d", response, err, memoryStore.Len())
+	}
+}
+
+// TestBatchStoreConversationRejectsExistingBatchID 测试批次ID已被已有记录使用时拒绝整个请求，不覆盖也不删除已有记录
+func TestBatchStoreConversationRejectsExistingBatchID(t *testing.T) {
+	service, memoryStore := newBatchStoreTestService(t, "")
+
+	response, err := service.BatchStoreConversation(context.Background(), models.BatchStoreConversationRequest{
+		SessionID: "s1",
+		UserID:    "user_a",
+		Batches:   []models.ConversationBatch{conversationBatch("new", "新的对话"), conversationBatch("existing", "覆盖已有记录")},
+	})
+	if err != nil {
+		t.Fatalf("批量存储返回错误: %v", err)
+	}
+	if response.Committed || response.Batches[1].Status != "failed" || response.Batches[0].Status != "skipped" {
+		t.Errorf("已存在的批次ID应被拒绝: %+v", response.Batches)
+	}
+
+	records, _ := memoryStore.SearchByID(context.Background(), "existing", nil)
+	if memoryStore.Len() != 1 || len(records) != 1 || records[0].Fields["content"] != "已有的对话" {
+		t.Errorf("已有记录应保持不变: %v", records)
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// RunSessionCleanup 清理不活跃会话和过期的短期记忆，并把清理明细追加到审计日志
+// dryRun为true时只记录将被清理的会话和消息，不修改任何数据，便于上线前核对清理范围
+func (s *ContextService) RunSessionCleanup(ctx context.Context, timeout time.Duration, dryRun bool) *models.CleanupAudit {
+	now := s.now()
+	audit := &models.CleanupAudit{
+		StartedAt:         now,
+		DryRun:            dryRun,
+		SessionTimeout:    timeout.String(),
+		ShortMemoryMaxAge: s.config.ShortMemoryMaxAge,
+		Entries:           []models.CleanupAuditEntry{},
+	}
+
+	sessionResult := s.sessionStore.CleanupInactiveSessionsAt(now, timeout, s.retainSessionWithP0Memory(ctx), dryRun)
+	messageResult := s.sessionStore.CleanupShortTermMemoryAt(now, s.config.ShortMemoryMaxAge, dryRun)
+
+	audit.ArchivedSessions = sessionResult.Archived
+	audit.RetainedSessions = sessionResult.RetainedPinned + sessionResult.RetainedByPolicy
+	audit.RemovedMessages = messageResult.Removed
+	audit.Entries = append(audit.Entries, sessionResult.Entries...)
+	audit.Entries = append(audit.Entries, messageResult.Entries...)
+	audit.FinishedAt = s.now()
+
+	mode := "会话清理完成"
+	if dryRun {
+		mode = "会话清理演练完成（未删除数据）"
+	}
+	log.Printf("[上下文服务] %s: 归档%d个不活跃会话, 保留置顶会话%d个, 保留P0记忆会话%d个, 清理%d条过期消息",
+		mode, sessionResult.Archived, sessionResult.RetainedPinned, sessionResult.RetainedByPolicy, messageResult.Removed)
+
+	s.cleanupAuditMutex.Lock()
+	s.lastCleanupAudit = audit
+	s.cleanupAuditMutex.Unlock()
+
+	// 没有任何会话被处理时不写审计日志，避免日志随定时任务无限增长
+	if len(audit.Entries) > 0 {
+		if err := s.appendCleanupAudit(audit); err != nil {
+			log.Printf("⚠️ [上下文服务] 写入清理审计日志失败: %v", err)
+		}
+	}
+	return audit
+}
+
+// GetLastCleanupAudit 获取最近一次会话清理的审计记录
+// 进程重启后从审计日志读取最后一条；没有记录时返回nil
+func (s *ContextService) GetLastCleanupAudit() (*models.CleanupAudit, error) {
+	s.cleanupAuditMutex.Lock()
+	defer s.cleanupAuditMutex.Unlock()
+
+	if s.lastCleanupAudit != nil {
+		return s.lastCleanupAudit, nil
+	}
+
+	path := s.cleanupAuditPath()
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取清理审计日志失败: %w", err)
+	}
+
+	var lastLine []byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lastLine = append(lastLine[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取清理审计日志失败: %w", err)
+	}
+	if lastLine == nil {
+		return nil, nil
+	}
+
+	var audit models.CleanupAudit
+	if err := json.Unmarshal(lastLine, &audit); err != nil {
+		return nil, fmt.Errorf("解析清理审计记录失败: %w", err)
+	}
+	s.lastCleanupAudit = &audit
+	return &audit, nil
+}
+
+// appendCleanupAudit 以JSON Lines格式追加一条审计记录
+func (s *ContextService) appendCleanupAudit(audit *models.CleanupAudit) error {
+	path := s.cleanupAuditPath()
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建审计目录失败: %w", err)
+	}
+
+	data, err := json.Marshal(audit)
+	if err != nil {
+		return fmt.Errorf("序列化审计记录失败: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// cleanupAuditPath 清理审计日志路径，未配置存储路径时返回空
+func (s *ContextService) cleanupAuditPath() string {
+	if s.config == nil || s.config.StoragePath == "" {
+		return ""
+	}
+	return filepath.Join(s.config.StoragePath, "audit", "cleanup.jsonl")
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// TestRunSessionCleanupAudit 测试清理明细写入审计日志，进程重启后仍能读取最近一次记录
+func TestRunSessionCleanupAudit(t *testing.T) {
+	baseDir := t.TempDir()
+	sessionStore, err := store.NewSessionStore(baseDir)
+	if err != nil {
+		t.Fatalf("NewSessionStore failed: %v", err)
+	}
+	session := models.NewSession("stale")
+	session.LastActive = time.Now().Add(-2 * time.Hour)
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("SaveSession failed: %v", err)
+	}
+
+	cfg := &config.Config{StoragePath: baseDir, ShortMemoryMaxAge: 2}
+	service := &ContextService{sessionStore: sessionStore, config: cfg}
+
+	dryRun := service.RunSessionCleanup(context.Background(), time.Hour, true)
+	if !dryRun.DryRun || dryRun.ArchivedSessions != 1 || sessionStore.GetSessionCount() != 1 {
+		t.Fatalf("Expected dry run to report without archiving, got %+v", dryRun)
+	}
+
+	audit := service.RunSessionCleanup(context.Background(), time.Hour, false)
+	if audit.DryRun || audit.ArchivedSessions != 1 || sessionStore.GetSessionCount() != 0 {
+		t.Fatalf("Expected session archived, got %+v", audit)
+	}
+
+	restarted := &ContextService{sessionStore: sessionStore, config: cfg}
+	last, err := restarted.GetLastCleanupAudit()
+	if err != nil || last == nil {
+		t.Fatalf("GetLastCleanupAudit failed: %v, %v", last, err)
+	}
+	if last.DryRun || len(last.Entries) != 1 || last.Entries[0].SessionID != "stale" ||
+		last.Entries[0].Action != models.CleanupActionArchive {
+		t.Errorf("Unexpected audit read back: %+v", last)
+	}
+}
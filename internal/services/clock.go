@@ -0,0 +1,28 @@
+package services
+
+import "time"
+
+// Clock 时间源，相对时间解析和清理任务通过它获取当前时间，测试时可注入固定时间
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock 使用系统时间的默认时间源
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SetClock 设置时间源，传入nil时恢复为系统时间
+func (s *ContextService) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// now 获取时间源的当前时间，未设置时间源时使用系统时间
+func (s *ContextService) now() time.Time {
+	if s.clock == nil {
+		return systemClock{}.Now()
+	}
+	return s.clock.Now()
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// fixedClock 返回固定时间的时间源，测试中可手动推进
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+// TestRelativeTimeWithFixedClock 测试相对时间按注入的当前时间解析
+func TestRelativeTimeWithFixedClock(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 30, 0, 0, time.Local)
+	service := &ContextService{}
+	service.SetClock(&fixedClock{now: now})
+
+	cases := map[string]string{
+		"昨天":    "2025-02-28",
+		"前天":    "2025-02-27",
+		"today": "2025-03-01",
+		"上个月":   "2025-02-01",
+		"无法识别":  "2025-03-01",
+	}
+	for raw, want := range cases {
+		if got := service.standardizeTimeFormat(raw); got != want {
+			t.Errorf("%s应标准化为%s，实际%s", raw, want, got)
+		}
+	}
+
+	yesterday, err := parseTimeString("昨天", service.now())
+	if err != nil {
+		t.Fatalf("解析昨天失败: %v", err)
+	}
+	if !yesterday.Equal(now.AddDate(0, 0, -1)) {
+		t.Errorf("昨天应解析为%v，实际%v", now.AddDate(0, 0, -1), yesterday)
+	}
+
+	service.SetClock(nil)
+	if service.now().IsZero() {
+		t.Error("未设置时间源时应使用系统时间")
+	}
+}
+
+// TestSessionCleanupWithFixedClock 测试会话清理按注入的当前时间判断会话是否过期和消息是否超期
+func TestSessionCleanupWithFixedClock(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	lastActive := time.Date(2025, 3, 1, 11, 30, 0, 0, time.Local)
+	session := &models.Session{ID: "s1", CreatedAt: lastActive, LastActive: lastActive, Status: "active",
+		Metadata: map[string]interface{}{"userId": "user_a"},
+		Messages: []*models.Message{{ID: "old", SessionID: "s1", Role: "user", Content: "旧消息",
+			Timestamp: lastActive.AddDate(0, 0, -3).Unix()}}}
+	if _, err := sessionStore.ImportSession(session, false); err != nil {
+		t.Fatalf("导入会话失败: %v", err)
+	}
+
+	clock := &fixedClock{now: time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)}
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{ShortMemoryMaxAge: 2}, clock: clock}
+	service.SetVectorStore(vectorstore.NewInMemoryVectorStore(64, 0))
+
+	audit := service.RunSessionCleanup(context.Background(), time.Hour, true)
+	if audit.ArchivedSessions != 0 || audit.RemovedMessages != 1 || !audit.StartedAt.Equal(clock.now) {
+		t.Errorf("活跃30分钟内的会话不应归档，3天前的消息应清理: %+v", audit)
+	}
+
+	clock.now = clock.now.Add(time.Hour)
+	if audit := service.RunSessionCleanup(context.Background(), time.Hour, true); audit.ArchivedSessions != 1 {
+		t.Errorf("时间推进后会话超过1小时未活跃，应归档: %+v", audit)
+	}
+}
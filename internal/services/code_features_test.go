@@ -0,0 +1,116 @@
+package services
+
+import (
+	"testing"
+)
+
+// assertCodeFeatures 检查提取结果包含期望标识符且不包含注释和字符串中的内容
+func assertCodeFeatures(t *testing.T, features []string, want, unwanted []string) {
+	t.Helper()
+	found := make(map[string]bool)
+	for _, feature := range features {
+		found[feature] = true
+	}
+	for _, name := range want {
+		if !found[name] {
+			t.Errorf("Expected feature %q, got %v", name, features)
+		}
+	}
+	for _, name := range unwanted {
+		if found[name] {
+			t.Errorf("Unexpected feature %q from comment or string, got %v", name, features)
+		}
+	}
+}
+
+// TestExtractCodeFeaturesRust 测试Rust的函数、类型、impl和模块提取
+func TestExtractCodeFeaturesRust(t *testing.T) {
+	source := `
+mod storage;
+
+/// fn documented_only() 不应被提取
+pub struct MemoryStore<T> {
+    items: Vec<T>,
+}
+
+pub trait Retriever {
+    fn retrieve(&self, query: &str) -> Vec<String>;
+}
+
+impl<T> Retriever for MemoryStore<T> {
+    fn retrieve(&self, query: &str) -> Vec<String> {
+        let sql = "fn from_string() struct FakeType";
+        let raw = r#"impl Fake for RawType"#;
+        vec![]
+    }
+}
+
+/* struct BlockCommented {} */
+pub enum Priority { P0, P1 }
+async fn flush_all() {}
+`
+	features := extractCodeFeatures(source, "rust")
+	assertCodeFeatures(t, features,
+		[]string{"storage", "MemoryStore", "Retriever", "retrieve", "Priority", "flush_all"},
+		[]string{"documented_only", "from_string", "FakeType", "RawType", "BlockCommented"})
+}
+
+// TestExtractCodeFeaturesCSharp 测试C#的命名空间、类型和方法签名提取
+func TestExtractCodeFeaturesCSharp(t *testing.T) {
+	source := `
+namespace ContextKeeper.Services
+{
+    // public void CommentedMethod() {}
+    public interface IMemoryStore
+    {
+        Task<List<string>> SearchAsync(string query);
+    }
+
+    public sealed class MemoryStore : IMemoryStore
+    {
+        public MemoryStore(string path) { }
+
+        public async Task<List<string>> SearchAsync(string query)
+        {
+            var text = @"public void VerbatimMethod() ""quoted""";
+            var other = "class FakeClass";
+            return new List<string>();
+        }
+
+        private static Dictionary<string, int> BuildIndex<T>(T source) => null;
+    }
+
+    public record struct SearchHit(string Id, double Score);
+}
+`
+	features := extractCodeFeatures(source, "csharp")
+	assertCodeFeatures(t, features,
+		[]string{"ContextKeeper.Services", "IMemoryStore", "MemoryStore", "SearchAsync", "BuildIndex", "SearchHit"},
+		[]string{"CommentedMethod", "VerbatimMethod", "FakeClass", "List"})
+}
+
+// TestExtractCodeFeaturesKotlin 测试Kotlin的包、函数、类和object提取
+func TestExtractCodeFeaturesKotlin(t *testing.T) {
+	source := `
+package com.contextkeeper.client
+
+/* fun blockCommented() */
+data class Memory(val id: String, val content: String)
+
+sealed interface SearchResult
+
+object MemoryCache {
+    fun <T> getOrPut(key: String, loader: () -> T): T = loader()
+}
+
+fun String.toMemory(): Memory = Memory(this, this) // fun lineCommented()
+
+val template = """
+    fun templateFunction() {}
+"""
+`
+	features := extractCodeFeatures(source, "kotlin")
+	assertCodeFeatures(t, features,
+		[]string{"com.contextkeeper.client", "Memory", "SearchResult", "MemoryCache", "getOrPut", "toMemory"},
+		[]string{"blockCommented", "lineCommented", "templateFunction"})
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultCodeLanguageExtensions 文件扩展名到语言的默认映射，语言名与extractCodeFeatures的分支一致
+// 可通过CODE_LANGUAGE_EXTENSIONS追加或覆盖
+var DefaultCodeLanguageExtensions = map[string]string{
+	".go":    "go",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".cjs":   "javascript",
+	".jsx":   "jsx",
+	".ts":    "typescript",
+	".mts":   "typescript",
+	".tsx":   "tsx",
+	".py":    "python",
+	".pyi":   "python",
+	".rs":    "rust",
+	".cs":    "csharp",
+	".kt":    "kotlin",
+	".kts":   "kotlin",
+	".java":  "java",
+	".rb":    "ruby",
+	".php":   "php",
+	".swift": "swift",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".sh":    "shell",
+	".bash":  "shell",
+	".sql":   "sql",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".json":  "json",
+	".md":    "markdown",
+}
+
+// shebangLanguages shebang中的解释器到语言的映射
+var shebangLanguages = map[string]string{
+	"python":  "python",
+	"python3": "python",
+	"node":    "javascript",
+	"deno":    "typescript",
+	"ts-node": "typescript",
+	"bash":    "shell",
+	"sh":      "shell",
+	"zsh":     "shell",
+	"ruby":    "ruby",
+	"php":     "php",
+}
+
+// codeLanguageMarker 按内容推断语言的语法特征，按顺序匹配，特征越独特的语言越靠前
+type codeLanguageMarker struct {
+	language string
+	pattern  *regexp.Regexp
+}
+
+var codeLanguageMarkers = []codeLanguageMarker{
+	{"go", regexp.MustCompile(`(?m)^package\s+\w+\s*$[\s\S]*^func\s`)},
+	{"rust", regexp.MustCompile(`(?m)^\s*(pub\s+)?(fn|impl|mod|trait)\s+\w+|\blet\s+mut\s`)},
+	{"csharp", regexp.MustCompile(`(?m)^using\s+System[\w.]*;|^\s*namespace\s+[\w.]+\s*[{;]`)},
+	{"kotlin", regexp.MustCompile(`(?m)^\s*(fun|data class|object)\s+\w+|^\s*val\s+\w+\s*[:=]`)},
+	{"python", regexp.MustCompile(`(?m)^\s*(def|class)\s+\w+.*:\s*$|^(import\s+[\w.]+(\s+as\s+\w+)?\s*$|from\s+[\w.]+\s+import\s)`)},
+	{"typescript", regexp.MustCompile(`(?m)^\s*(export\s+)?(interface|type)\s+\w+\s*(=|\{|<)|:\s*(string|number|boolean)\b`)},
+	{"javascript", regexp.MustCompile(`(?m)\bfunction\s+\w+\s*\(|\brequire\(['"]|^\s*(export\s+)?(const|let)\s+\w+\s*=.*=>`)},
+}
+
+// shebangPattern 匹配内容首行的shebang，第一个捕获组为解释器名（兼容/usr/bin/env形式）
+var shebangPattern = regexp.MustCompile(`^#!\s*\S*/(?:env\s+(?:-\S+\s+)*)?([\w.-]+)`)
+
+// newCodeLanguageExtensions 合并默认映射和配置的扩展名映射，配置格式为 .ext=language，逗号分隔
+// 扩展名不区分大小写，可省略开头的点
+func newCodeLanguageExtensions(spec string) (map[string]string, error) {
+	extensions := make(map[string]string, len(DefaultCodeLanguageExtensions))
+	for ext, language := range DefaultCodeLanguageExtensions {
+		extensions[ext] = language
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("无效的扩展名映射: %s", item)
+		}
+		ext := strings.ToLower(strings.TrimSpace(parts[0]))
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions[ext] = strings.ToLower(strings.TrimSpace(parts[1]))
+	}
+	return extensions, nil
+}
+
+// InferCodeLanguage 推断代码文件的语言：先按扩展名，再按shebang和语法特征，都无法判断时返回空字符串
+func (s *ContextService) InferCodeLanguage(filePath, content string) string {
+	extensions := s.codeLanguageExtensions
+	if extensions == nil {
+		extensions = DefaultCodeLanguageExtensions
+	}
+	return inferCodeLanguage(filePath, content, extensions)
+}
+
+func inferCodeLanguage(filePath, content string, extensions map[string]string) string {
+	if language, ok := extensions[strings.ToLower(filepath.Ext(filePath))]; ok {
+		return language
+	}
+
+	if match := shebangPattern.FindStringSubmatch(content); match != nil {
+		interpreter := strings.ToLower(match[1])
+		if language, ok := shebangLanguages[interpreter]; ok {
+			return language
+		}
+		// python3.11、node18等带版本号的解释器
+		if language, ok := shebangLanguages[strings.TrimRight(interpreter, "0123456789.")]; ok {
+			return language
+		}
+	}
+
+	for _, marker := range codeLanguageMarkers {
+		if marker.pattern.MatchString(content) {
+			return marker.language
+		}
+	}
+	return ""
+}
+
+// resolveCodeLanguage 调用方未指定语言时推断语言并记录日志
+func (s *ContextService) resolveCodeLanguage(filePath, content, language string) string {
+	if language != "" {
+		return language
+	}
+	inferred := s.InferCodeLanguage(filePath, content)
+	if inferred != "" {
+		log.Printf("[上下文服务] 未指定语言，推断文件 %s 的语言为: %s", filePath, inferred)
+	}
+	return inferred
+}
@@ -0,0 +1,41 @@
+package services
+
+import "testing"
+
+// TestInferCodeLanguage 测试按扩展名、配置映射、shebang和语法特征推断语言
+func TestInferCodeLanguage(t *testing.T) {
+	extensions, err := newCodeLanguageExtensions("vue=javascript, .H=cpp")
+	if err != nil {
+		t.Fatalf("解析扩展名映射失败: %v", err)
+	}
+	s := &ContextService{codeLanguageExtensions: extensions}
+
+	cases := []struct {
+		path, content, want string
+	}{
+		{"internal/main.go", "", "go"},
+		{"src/App.TSX", "", "tsx"},
+		{"src/App.vue", "", "javascript"},
+		{"include/store.h", "", "cpp"},
+		{"scripts/deploy", "#!/usr/bin/env python3\nprint('ok')", "python"},
+		{"bin/run", "#!/bin/bash\necho ok", "shell"},
+		{"snippet", "package main\n\nimport \"fmt\"\n\nfunc main() {}", "go"},
+		{"snippet", "pub fn retrieve(query: &str) -> Vec<String> {\n    let mut out = Vec::new();\n}", "rust"},
+		{"snippet", "import os\n\ndef load(path):\n    return open(path)", "python"},
+		{"snippet", "import java.util.List;\n", ""},
+		{"snippet", "const add = (a, b) => a + b;", "javascript"},
+		{"README", "just some notes", ""},
+	}
+	for _, c := range cases {
+		if got := s.InferCodeLanguage(c.path, c.content); got != c.want {
+			t.Errorf("InferCodeLanguage(%q) = %q, want %q", c.path, got, c.want)
+		}
+	}
+
+	if _, err := newCodeLanguageExtensions("vue"); err == nil {
+		t.Error("缺少语言的映射应返回错误")
+	}
+	if got := (&ContextService{}).InferCodeLanguage("lib.rs", ""); got != "rust" {
+		t.Errorf("未配置映射时应使用默认映射，got %q", got)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// normalizeContentReference 校验存储请求的内容类型和外部引用
+// 图片记忆以说明文字作为Content生成检索向量，没有说明时使用图片文件名；类型和引用写入metadata随记录持久化
+func normalizeContentReference(req *models.StoreContextRequest) error {
+	switch req.ContentType {
+	case "", models.ContentTypeText:
+		if req.ContentRef != "" {
+			return apperrors.ErrInvalidArgument.WithMessagef("contentRef仅在contentType为%s时使用", models.ContentTypeImage)
+		}
+		return nil
+	case models.ContentTypeImage:
+	default:
+		return apperrors.ErrInvalidArgument.WithMessagef("不支持的contentType: %s，可选: %s, %s",
+			req.ContentType, models.ContentTypeText, models.ContentTypeImage)
+	}
+
+	caption, err := imageEmbeddingText(req.ContentRef, req.Content)
+	if err != nil {
+		return err
+	}
+	req.Content = caption
+	req.Metadata = withContentReference(req.Metadata, req.ContentType, strings.TrimSpace(req.ContentRef))
+	return nil
+}
+
+// imageEmbeddingText 返回图片记忆用于生成向量的文本：优先使用说明文字，否则使用图片文件名
+func imageEmbeddingText(contentRef, caption string) (string, error) {
+	contentRef = strings.TrimSpace(contentRef)
+	if contentRef == "" {
+		return "", apperrors.ErrInvalidArgument.WithMessagef("contentType为%s时contentRef不能为空", models.ContentTypeImage)
+	}
+	if caption = strings.TrimSpace(caption); caption != "" {
+		return caption, nil
+	}
+	return fmt.Sprintf("[图片] %s", path.Base(contentRef)), nil
+}
+
+// withContentReference 复制metadata并写入内容类型和外部引用，不修改调用方的map
+func withContentReference(metadata map[string]interface{}, contentType, contentRef string) map[string]interface{} {
+	copied := make(map[string]interface{}, len(metadata)+2)
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	copied[models.MetadataContentTypeKey] = contentType
+	copied[models.MetadataContentRefKey] = contentRef
+	return copied
+}
+
+// metadataContentReference 从记录的metadata中获取非文本内容类型和外部引用，文本记录返回空
+func metadataContentReference(metadata map[string]interface{}) (string, string) {
+	contentRef, _ := metadata[models.MetadataContentRefKey].(string)
+	if contentRef == "" {
+		return "", ""
+	}
+	contentType, _ := metadata[models.MetadataContentTypeKey].(string)
+	return contentType, contentRef
+}
+
+// formatContentReference 文本格式的检索结果中在说明文字前标注图片引用
+func formatContentReference(result models.SearchResult, content string) string {
+	contentType, contentRef := metadataContentReference(parseResultMetadata(result))
+	if contentType != models.ContentTypeImage {
+		return content
+	}
+	return fmt.Sprintf("[图片: %s] %s", contentRef, content)
+}
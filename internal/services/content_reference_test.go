@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestStoreImageContentReference 测试图片记忆以说明文字检索，检索结果保留图片引用，文本记忆不受影响
+func TestStoreImageContentReference(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	session := models.NewSession("s1")
+	session.Metadata = map[string]interface{}{"userId": "user_a"}
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	service.SetVectorStore(vectorstore.NewInMemoryVectorStore(64, 0))
+
+	ctx := context.Background()
+	imageRef := "https://example.com/diagrams/login-flow.png"
+	for _, req := range []models.StoreContextRequest{
+		{SessionID: "s1", UserID: "user_a", Content: "登录流程时序图", ContentType: models.ContentTypeImage, ContentRef: imageRef},
+		{SessionID: "s1", UserID: "user_a", Content: "登录流程的文字说明"},
+	} {
+		if _, err := service.StoreContextDetailed(ctx, req); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+	}
+
+	resp, err := service.RetrieveContext(ctx, models.RetrieveContextRequest{SessionID: "s1", Query: "登录流程", Structured: true, SkipThreshold: true})
+	if err != nil {
+		t.Fatalf("RetrieveContext failed: %v", err)
+	}
+	images := 0
+	for _, result := range resp.Results {
+		switch result.Content {
+		case "登录流程时序图":
+			images++
+			if result.ContentType != models.ContentTypeImage || result.ContentRef != imageRef {
+				t.Errorf("图片记忆缺少引用: %+v", result)
+			}
+		default:
+			if result.ContentType != "" || result.ContentRef != "" {
+				t.Errorf("文本记忆不应带引用: %+v", result)
+			}
+		}
+	}
+	if images != 1 {
+		t.Fatalf("期望检索到1条图片记忆，实际%d条", images)
+	}
+
+	text, err := service.RetrieveContext(ctx, models.RetrieveContextRequest{SessionID: "s1", Query: "登录流程", SkipThreshold: true})
+	if err != nil {
+		t.Fatalf("RetrieveContext failed: %v", err)
+	}
+	if !strings.Contains(text.LongTermMemory, "[图片: "+imageRef+"] 登录流程时序图") {
+		t.Errorf("文本结果缺少图片引用: %s", text.LongTermMemory)
+	}
+
+	for _, req := range []models.StoreContextRequest{
+		{SessionID: "s1", Content: "缺少引用", ContentType: models.ContentTypeImage},
+		{SessionID: "s1", Content: "文本带引用", ContentRef: imageRef},
+		{SessionID: "s1", Content: "未知类型", ContentType: "video"},
+	} {
+		if _, err := service.StoreContextDetailed(ctx, req); !errors.Is(err, apperrors.ErrInvalidArgument) {
+			t.Errorf("期望参数错误: %+v, got %v", req, err)
+		}
+	}
+
+	req := models.StoreContextRequest{ContentType: models.ContentTypeImage, ContentRef: "/tmp/screens/error.png"}
+	if err := normalizeContentReference(&req); err != nil || req.Content != "[图片] error.png" {
+		t.Errorf("无说明的图片应以文件名生成向量: %q, %v", req.Content, err)
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 语境模型持久化：会话中保存最近一次的LLM驱动语境模型，重启后增量更新而不是从头重建
+// =============================================================================
+
+// maxContextChangeHistory 语境模型保留的变更记录条数
+const maxContextChangeHistory = 20
+
+// loadPersistedContextModel 读取会话中保存的语境模型副本，必要时迁移到当前格式
+// 返回副本以免增量更新时修改其他请求正在使用的模型；没有保存的模型或格式无法识别时返回nil，由调用方重新构建
+func loadPersistedContextModel(session *models.Session) *models.PersistedContextModel {
+	if session.ContextModel == nil || session.ContextModel.Model == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(session.ContextModel)
+	if err != nil {
+		log.Printf("⚠️ [语境模型] 序列化会话 %s 的语境模型失败，重新构建: %v", session.ID, err)
+		return nil
+	}
+	var persisted models.PersistedContextModel
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		log.Printf("⚠️ [语境模型] 复制会话 %s 的语境模型失败，重新构建: %v", session.ID, err)
+		return nil
+	}
+
+	migrated, err := migrateContextModel(&persisted)
+	if err != nil {
+		log.Printf("⚠️ [语境模型] 会话 %s 的语境模型无法迁移，重新构建: %v", session.ID, err)
+		return nil
+	}
+	return migrated
+}
+
+// migrateContextModel 将旧格式的语境模型逐版本迁移到ContextModelSchemaVersion
+func migrateContextModel(persisted *models.PersistedContextModel) (*models.PersistedContextModel, error) {
+	if persisted.SchemaVersion > models.ContextModelSchemaVersion {
+		return nil, fmt.Errorf("不支持的语境模型版本: %d", persisted.SchemaVersion)
+	}
+
+	for persisted.SchemaVersion < models.ContextModelSchemaVersion {
+		switch persisted.SchemaVersion {
+		case 0:
+			// 0: 无版本号的早期格式，字段与版本1一致
+			if persisted.Model.Core == nil {
+				return nil, fmt.Errorf("语境模型缺少核心信息")
+			}
+		}
+		persisted.SchemaVersion++
+	}
+	return persisted, nil
+}
+
+// updateContextModelFromSession 只根据上次处理之后的新消息更新语境模型，保留已累积的维度引用
+func (s *ContextService) updateContextModelFromSession(contextModel *models.LLMDrivenContextModel, session *models.Session, processedCount int) *models.LLMDrivenContextModel {
+	if processedCount > len(session.Messages) {
+		// 消息被清理过，无法确定差异，保守地全部视为新消息
+		processedCount = 0
+	}
+	newMessages := session.Messages[processedCount:]
+	if len(newMessages) == 0 {
+		return contextModel
+	}
+
+	now := time.Now()
+	var changes []models.ContextChange
+
+	if focus := s.extractCurrentFocus(session); focus != contextModel.Core.CurrentFocus {
+		changes = append(changes, models.ContextChange{
+			Dimension: "core.current_focus",
+			OldValue:  contextModel.Core.CurrentFocus,
+			NewValue:  focus,
+		})
+		contextModel.Core.CurrentFocus = focus
+	}
+	if intent := s.extractIntentCategory(session); intent != contextModel.Core.IntentCategory {
+		changes = append(changes, models.ContextChange{
+			Dimension: "core.intent_category",
+			OldValue:  contextModel.Core.IntentCategory,
+			NewValue:  intent,
+		})
+		contextModel.Core.IntentCategory = intent
+	}
+
+	// 只补全缺失的维度引用，已有引用保持不变
+	if contextModel.Dimensions == nil {
+		contextModel.Dimensions = &models.ContextDimensions{}
+	}
+	if userID := s.extractUserIDFromSession(session); userID != "unknown_user" {
+		if userRef := fmt.Sprintf("user_%s", userID); contextModel.Dimensions.UserRef != userRef {
+			changes = append(changes, models.ContextChange{
+				Dimension: "dimensions.user_ref",
+				OldValue:  contextModel.Dimensions.UserRef,
+				NewValue:  userRef,
+			})
+			contextModel.Dimensions.UserRef = userRef
+		}
+	}
+
+	contextModel.UpdatedAt = now
+	if len(changes) == 0 {
+		return contextModel
+	}
+
+	contextModel.Version++
+	if contextModel.ChangeTracking == nil {
+		contextModel.ChangeTracking = &models.ContextChangeTracking{}
+	}
+	tracking := contextModel.ChangeTracking
+	tracking.LastChangeTimestamp = now
+	tracking.UpdateStrategy = "incremental"
+	tracking.ChangedDimensions = tracking.ChangedDimensions[:0]
+	for i := range changes {
+		changes[i].ChangeID = fmt.Sprintf("%s_v%d_%d", contextModel.SessionID, contextModel.Version, i)
+		changes[i].Timestamp = now
+		changes[i].ChangeType = "update"
+		changes[i].Reason = fmt.Sprintf("会话新增%d条消息", len(newMessages))
+		tracking.ChangedDimensions = append(tracking.ChangedDimensions, changes[i].Dimension)
+	}
+	tracking.ChangeHistory = append(tracking.ChangeHistory, changes...)
+	if len(tracking.ChangeHistory) > maxContextChangeHistory {
+		tracking.ChangeHistory = tracking.ChangeHistory[len(tracking.ChangeHistory)-maxContextChangeHistory:]
+	}
+
+	log.Printf("🔄 [语境模型] 会话 %s 增量更新到版本 %d，变更维度: %v", contextModel.SessionID, contextModel.Version, tracking.ChangedDimensions)
+	return contextModel
+}
+
+// saveContextModel 将语境模型保存到会话，失败只记录日志，不影响本次使用
+func (s *ContextService) saveContextModel(sessionID string, contextModel *models.LLMDrivenContextModel, messageCount int) {
+	persisted := &models.PersistedContextModel{
+		SchemaVersion: models.ContextModelSchemaVersion,
+		MessageCount:  messageCount,
+		Model:         contextModel,
+	}
+	if err := s.sessionStore.SaveContextModel(sessionID, persisted); err != nil {
+		log.Printf("⚠️ [语境模型] 保存会话 %s 的语境模型失败: %v", sessionID, err)
+	}
+}
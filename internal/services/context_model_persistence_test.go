@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestUpdateContextModelFromSession 测试只根据新消息更新焦点，保留已有维度引用并递增版本
+func TestUpdateContextModelFromSession(t *testing.T) {
+	s := &ContextService{}
+	session := &models.Session{
+		ID: "session-1",
+		Messages: []*models.Message{
+			{Content: "第一条消息"},
+			{Content: "如何优化向量检索"},
+		},
+	}
+	contextModel := &models.LLMDrivenContextModel{
+		SessionID:  session.ID,
+		Version:    1,
+		Core:       &models.CoreContext{CurrentFocus: "第一条消息", IntentCategory: models.IntentQuery},
+		Dimensions: &models.ContextDimensions{TechnicalRef: "tech_accumulated"},
+	}
+
+	unchanged := s.updateContextModelFromSession(contextModel, session, 2)
+	if unchanged.Version != 1 {
+		t.Fatalf("没有新消息时不应更新版本: %d", unchanged.Version)
+	}
+
+	updated := s.updateContextModelFromSession(contextModel, session, 1)
+	if updated.Core.CurrentFocus != "如何优化向量检索" {
+		t.Errorf("焦点未更新: %s", updated.Core.CurrentFocus)
+	}
+	if updated.Dimensions.TechnicalRef != "tech_accumulated" {
+		t.Errorf("已有维度引用不应被覆盖: %s", updated.Dimensions.TechnicalRef)
+	}
+	if updated.Version != 2 || updated.ChangeTracking == nil || len(updated.ChangeTracking.ChangeHistory) != 1 {
+		t.Errorf("变更追踪错误: version=%d, tracking=%+v", updated.Version, updated.ChangeTracking)
+	}
+}
+
+// TestLoadPersistedContextModel 测试旧格式迁移到当前版本，以及无法识别的新版本返回nil
+func TestLoadPersistedContextModel(t *testing.T) {
+	session := &models.Session{
+		ID: "session-1",
+		ContextModel: &models.PersistedContextModel{
+			SchemaVersion: 0,
+			Model:         &models.LLMDrivenContextModel{Core: &models.CoreContext{CurrentFocus: "focus"}},
+		},
+	}
+
+	loaded := loadPersistedContextModel(session)
+	if loaded == nil || loaded.SchemaVersion != models.ContextModelSchemaVersion {
+		t.Fatalf("旧格式应迁移到当前版本: %+v", loaded)
+	}
+	if loaded.Model == session.ContextModel.Model {
+		t.Error("应返回副本而不是会话中的模型")
+	}
+
+	session.ContextModel.SchemaVersion = models.ContextModelSchemaVersion + 1
+	if loadPersistedContextModel(session) != nil {
+		t.Error("无法识别的版本应返回nil")
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 低置信度实体保留：置信度低于仅上下文阈值的内容只记录上下文，但其中明确的技术实体仍有图谱价值，
+// 开启后以规则匹配抽取高置信度实体写入Neo4j，跳过不确定的关系推断
+// =============================================================================
+
+// contextOnlyEntities 规则匹配抽取仅记录上下文的内容中置信度不低于下限的实体，未启用时返回nil
+func (s *ContextService) contextOnlyEntities(analysisResult *models.SmartAnalysisResult, req models.StoreContextRequest, memoryID string) []*KnowledgeEntity {
+	if s.config == nil || !s.config.ContextOnlyEntityExtraction || analysisResult.IntentAnalysis == nil {
+		return nil
+	}
+
+	var entities []*KnowledgeEntity
+	for _, entity := range s.extractEntitiesWithRuleMatching(analysisResult, req, memoryID) {
+		if entity.ConfidenceLevel >= s.config.ContextOnlyEntityMinConfidence {
+			entities = append(entities, entity)
+		}
+	}
+	return entities
+}
+
+// storeContextOnlyEntities 将保留的实体合并写入Neo4j，只写入概念不写入关系
+func (s *ContextService) storeContextOnlyEntities(ctx context.Context, entities []*KnowledgeEntity, req models.StoreContextRequest, memoryID string) error {
+	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		return fmt.Errorf("Neo4j配置加载失败或未启用")
+	}
+	knowledgeEngine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
+	if err != nil {
+		return err
+	}
+
+	// 概念按用户记录归属，供知识图谱查询时隔离
+	if req.UserID == "" {
+		if userID, err := s.GetUserIDFromSessionID(req.SessionID); err == nil {
+			req.UserID = userID
+		}
+	}
+
+	stats, err := mergeKnowledgeGraph(ctx, knowledgeEngine, s.convertEntitiesToConcepts(entities, req, memoryID), nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ [上下文记录] 低置信度内容保留实体已写入知识图谱 - 概念: 新建%d/合并%d, MemoryID: %s",
+		stats.ConceptsCreated, stats.ConceptsMerged, memoryID)
+	return nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestContextOnlyEntities 测试开启后低置信度内容按置信度下限保留规则匹配的实体，未启用时不抽取，试运行时计入知识图谱引擎
+func TestContextOnlyEntities(t *testing.T) {
+	service := &ContextService{config: &config.Config{EnableMultiDimensionalStorage: true, ContextOnlyEntityMinConfidence: 0.85}}
+	analysisResult := &models.SmartAnalysisResult{
+		IntentAnalysis: &models.IntentAnalysisResult{
+			CoreIntentText:    "可能要调整一下",
+			DomainContextText: "Neo4j 知识图谱",
+		},
+	}
+	req := models.StoreContextRequest{SessionID: "s1", UserID: "user_a"}
+
+	if entities := service.contextOnlyEntities(analysisResult, req, "m1"); entities != nil {
+		t.Errorf("未启用时不应抽取实体: %d", len(entities))
+	}
+	if engines := service.plannedStorageEngines(analysisResult, "context_only"); len(engines) != 1 || engines[0] != models.StorageEngineVector {
+		t.Errorf("未启用时仅上下文记录只写入向量: %v", engines)
+	}
+
+	service.config.ContextOnlyEntityExtraction = true
+	entities := service.contextOnlyEntities(analysisResult, req, "m1")
+	if len(entities) == 0 {
+		t.Fatal("开启后应保留规则匹配的实体")
+	}
+	for _, entity := range entities {
+		if entity.ConfidenceLevel < 0.85 || entity.MemoryID != "m1" {
+			t.Errorf("保留的实体不应低于置信度下限且应关联记忆: %s %.2f %s", entity.Name, entity.ConfidenceLevel, entity.MemoryID)
+		}
+	}
+	if engines := service.plannedStorageEngines(analysisResult, "context_only"); len(engines) != 2 || engines[0] != models.StorageEngineKnowledgeGraph {
+		t.Errorf("保留实体时试运行应计入知识图谱: %v", engines)
+	}
+
+	service.config.ContextOnlyEntityMinConfidence = 1.1
+	if entities := service.contextOnlyEntities(analysisResult, req, "m1"); len(entities) != 0 {
+		t.Errorf("低于置信度下限的实体不应保留: %d", len(entities))
+	}
+}
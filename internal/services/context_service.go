@@ -2,13 +2,17 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,11 +20,14 @@ import (
 	"github.com/contextkeeper/service/internal/config"
 	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
 	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/timeline"
+	apperrors "github.com/contextkeeper/service/internal/errors"
 	"github.com/contextkeeper/service/internal/llm"
+	"github.com/contextkeeper/service/internal/metrics"
 	"github.com/contextkeeper/service/internal/models"
 	"github.com/contextkeeper/service/internal/store"
 	"github.com/contextkeeper/service/internal/utils"
 	"github.com/contextkeeper/service/pkg/aliyun"
+	"github.com/contextkeeper/service/pkg/vectorstore"
 	"github.com/google/uuid"
 )
 
@@ -33,8 +40,72 @@ type ContextService struct {
 	config             *config.Config
 	llmDrivenConfig    *config.LLMDrivenConfigManager // 🆕 LLM驱动配置管理器
 
-	// 🔥 新增：TimescaleDB时间线存储引擎
-	timelineEngine *timeline.TimescaleDBEngine
+	// TimescaleDB时间线和Neo4j知识图谱存储引擎，首次使用时创建并复用连接池，服务关闭时释放
+	timelineEngine  cachedEngine[*timeline.TimescaleDBEngine]
+	knowledgeEngine cachedEngine[*knowledge.Neo4jEngine]
+	// 存储引擎的可用性，智能存储跳过不可用的引擎
+	engines engineAvailability
+
+	// 向量缓存，按内容哈希复用embedding结果，为nil时表示禁用
+	embeddingCache *embeddingCache
+
+	// 外部嵌入服务，设置后优先于向量存储自带的嵌入能力
+	embeddingProvider models.EmbeddingProvider
+
+	// 启动时探测到的嵌入向量维度，0表示未探测
+	embeddingDimension      int
+	embeddingDimensionMutex sync.RWMutex
+
+	// LLM调用的token用量与费用统计
+	llmUsage *llm.UsageTracker
+
+	// 异步存储任务队列，为nil时表示未启用异步存储
+	storeJobs *storeJobQueue
+
+	// MCP工具调用限流器，为nil时表示未启用限流
+	toolRateLimiter *toolRateLimiter
+
+	// 写入请求的幂等记录，为nil时表示未启用幂等键
+	idempotency *idempotencyStore
+
+	// 分析prompt模板，未加载时使用内置默认模板
+	analysisPrompts *analysisPrompts
+
+	// 文件扩展名到代码语言的映射，为nil时使用默认映射
+	codeLanguageExtensions map[string]string
+
+	// 各记忆类型的保留期限，未列出的类型永久保留
+	retentionPolicies map[string]time.Duration
+
+	// priorityRules 存储优先级推断的事件类型规则(event_type -> 优先级)
+	priorityRules map[string]string
+
+	// 正在进行记忆重建的用户
+	reindexRunning map[string]bool
+	reindexMutex   sync.Mutex
+
+	// 正在进行知识图谱重建的用户
+	kgRebuildRunning map[string]bool
+	kgRebuildMutex   sync.Mutex
+
+	// 正在归档超限消息的会话
+	archiveRunning map[string]bool
+	archiveMutex   sync.Mutex
+
+	// 正在重新分析的记忆
+	reanalyzeRunning map[string]bool
+	reanalyzeMutex   sync.Mutex
+
+	// 自动汇总是否正在进行，上一轮未完成时跳过新一轮
+	autoSummaryRunning bool
+	autoSummaryMutex   sync.Mutex
+
+	// 时间源，为nil时使用系统时间
+	clock Clock
+
+	// 最近一次会话清理的审计记录
+	lastCleanupAudit  *models.CleanupAudit
+	cleanupAuditMutex sync.Mutex
 
 	// 🔧 临时解决方案：存储最后一次分析结果
 	lastAnalysisResult  *models.SmartAnalysisResult
@@ -56,15 +127,83 @@ func NewContextService(vectorSvc *aliyun.VectorService, sessionStore *store.Sess
 	} else {
 		log.Printf("✅ [配置加载] LLM驱动配置加载成功")
 	}
+	if cfg != nil && cfg.LLMDrivenConfigReloadInterval > 0 {
+		llmDrivenConfig.StartAutoReload(cfg.LLMDrivenConfigReloadInterval)
+	}
+
+	// 初始化向量缓存
+	var cache *embeddingCache
+	if cfg != nil {
+		cache = newEmbeddingCache(cfg.EmbeddingCacheSize, cfg.EmbeddingCacheTTL)
+		if cache != nil {
+			log.Printf("✅ [向量缓存] 已启用，最大条目数: %d，过期时间: %v", cfg.EmbeddingCacheSize, cfg.EmbeddingCacheTTL)
+		}
+	}
+
+	// 初始化LLM用量统计
+	var pricing map[llm.LLMProvider]llm.TokenPrice
+	if cfg != nil && cfg.LLMTokenPricing != "" {
+		parsed, err := llm.ParseTokenPricing(cfg.LLMTokenPricing)
+		if err != nil {
+			log.Printf("⚠️ [LLM用量] 价格配置解析失败，只统计token不估算费用: %v", err)
+		} else {
+			pricing = parsed
+		}
+	}
+	if cfg != nil {
+		llm.SetGlobalMaxConcurrency(cfg.LLMMaxConcurrency)
+	}
 
-	return &ContextService{
+	service := &ContextService{
 		vectorService:      vectorSvc,
 		vectorStore:        nil, // 初始为nil，表示使用传统vectorService
 		sessionStore:       sessionStore,
 		userSessionManager: userSessionManager,
 		config:             cfg,
 		llmDrivenConfig:    llmDrivenConfig, // 🆕 LLM驱动配置
+		embeddingCache:     cache,
+		llmUsage:           llm.NewUsageTracker(pricing),
+		toolRateLimiter:    newToolRateLimiter(cfg),
+		idempotency:        newIdempotencyStore(cfg),
+	}
+
+	if service.toolRateLimiter != nil {
+		log.Printf("✅ [限流] 已启用，用户每分钟额度: %d，突发上限: %d", cfg.RateLimitUserPerMinute, cfg.RateLimitBurst)
+	}
+
+	if cfg != nil && cfg.CodeLanguageExtensions != "" {
+		extensions, err := newCodeLanguageExtensions(cfg.CodeLanguageExtensions)
+		if err != nil {
+			log.Printf("⚠️ [代码语言] 扩展名映射配置解析失败，使用默认映射: %v", err)
+		} else {
+			service.codeLanguageExtensions = extensions
+		}
+	}
+
+	if cfg != nil && cfg.MemoryRetentionPolicies != "" {
+		policies, err := parseMemoryRetentionPolicies(cfg.MemoryRetentionPolicies)
+		if err != nil {
+			log.Printf("⚠️ [记忆保留] 保留策略配置解析失败，不清理任何记忆: %v", err)
+		} else {
+			service.retentionPolicies = policies
+		}
 	}
+
+	if cfg != nil && cfg.PriorityInferenceRules != "" {
+		rules, err := parsePriorityInferenceRules(cfg.PriorityInferenceRules)
+		if err != nil {
+			log.Printf("⚠️ [优先级推断] 事件类型规则解析失败，只按置信度推断: %v", err)
+		} else {
+			service.priorityRules = rules
+		}
+	}
+
+	if cfg != nil && cfg.StoreJobWorkers > 0 {
+		service.storeJobs = newStoreJobQueue(cfg.StoreJobWorkers, cfg.StoreJobQueueSize, cfg.StoreJobResultTTL, service.StoreContextDetailed)
+		log.Printf("✅ [异步存储] 已启动 %d 个worker，队列上限 %d，结果保留 %v", cfg.StoreJobWorkers, cfg.StoreJobQueueSize, cfg.StoreJobResultTTL)
+	}
+
+	return service
 }
 
 // SetVectorStore 设置新的向量存储接口
@@ -72,6 +211,10 @@ func NewContextService(vectorSvc *aliyun.VectorService, sessionStore *store.Sess
 func (s *ContextService) SetVectorStore(vectorStore models.VectorStore) {
 	log.Printf("[上下文服务] 切换到新的向量存储接口")
 	s.vectorStore = vectorStore
+	// 不同存储可能使用不同的embedding模型，切换后清空缓存
+	if s.embeddingCache != nil {
+		s.embeddingCache.clear()
+	}
 	log.Printf("[上下文服务] 向量存储接口切换完成，现在使用抽象接口")
 }
 
@@ -89,28 +232,108 @@ func (s *ContextService) GetCurrentVectorService() interface{} {
 	return s.vectorService
 }
 
+// SetEmbeddingProvider 设置外部嵌入服务（由EMBEDDING_PROVIDER选择）
+func (s *ContextService) SetEmbeddingProvider(provider models.EmbeddingProvider) {
+	s.embeddingProvider = provider
+	if s.embeddingCache != nil {
+		s.embeddingCache.clear()
+	}
+}
+
+// GetEmbeddingCacheStats 获取向量缓存的命中统计
+func (s *ContextService) GetEmbeddingCacheStats() EmbeddingCacheStats {
+	if s.embeddingCache == nil {
+		return EmbeddingCacheStats{Enabled: false}
+	}
+	return s.embeddingCache.stats()
+}
+
+// GetLLMUsage 获取LLM调用的累计token用量和估算费用
+func (s *ContextService) GetLLMUsage() *llm.UsageSnapshot {
+	snapshot := s.llmUsage.Snapshot()
+	concurrency := llm.GetGlobalConcurrencyStats()
+	snapshot.Concurrency = &concurrency
+	snapshot.ProviderFailures = llm.GetProviderFailureCounts()
+	return snapshot
+}
+
+// recordLLMUsage 记录一次LLM调用的用量
+func (s *ContextService) recordLLMUsage(req *llm.LLMRequest, resp *llm.LLMResponse) {
+	s.llmUsage.Record(req, resp)
+}
+
 // generateEmbedding 统一的向量生成接口
-// 自动选择使用新接口或传统接口生成向量
+// 相同内容优先从缓存读取，未命中时调用底层服务生成并写入缓存
 func (s *ContextService) generateEmbedding(content string) ([]float32, error) {
-	if s.vectorStore != nil {
+	if s.embeddingCache == nil {
+		return s.generateEmbeddingUncached(content)
+	}
+
+	key := embeddingCacheKey(content)
+	vector, ok := s.embeddingCache.get(key)
+	metrics.ObserveCacheLookup("embedding", ok)
+	if ok {
+		log.Printf("♻️ [向量缓存] 命中缓存，内容长度: %d", len(content))
+		return vector, nil
+	}
+
+	vector, err := s.generateEmbeddingUncached(content)
+	if err != nil {
+		return nil, err
+	}
+	s.embeddingCache.put(key, vector)
+	return vector, nil
+}
+
+// generateEmbeddingUncached 调用底层服务生成向量
+// 优先使用外部嵌入服务，其次自动选择使用新接口或传统接口生成向量；单次请求受EMBEDDING_TIMEOUT限制
+// 开启EMBEDDING_NORMALIZE时返回L2归一化后的向量
+func (s *ContextService) generateEmbeddingUncached(content string) (vector []float32, err error) {
+	defer func(start time.Time) {
+		metrics.ObserveEmbedding(err, time.Since(start))
+		if isTransientStoreError(err) {
+			err = apperrors.ErrTransientBackend.Wrap(err)
+		}
+		if err == nil {
+			vector = s.normalizeEmbedding(vector)
+		}
+	}(time.Now())
+
+	// 先取出当前的服务实例再交给后台goroutine，避免与替换服务实例的写操作竞争
+	timeout := s.embeddingTimeout()
+	if provider := s.embeddingProvider; provider != nil {
+		return callWithEmbeddingTimeout(timeout, func(ctx context.Context) ([]float32, error) {
+			return generateEmbeddingWithContext(ctx, provider, content)
+		})
+	}
+
+	if vectorStore := s.vectorStore; vectorStore != nil {
 		log.Printf("[上下文服务] 使用新向量存储接口生成向量")
 		// 新接口返回[]float32，直接返回
-		return s.vectorStore.GenerateEmbedding(content)
+		return callWithEmbeddingTimeout(timeout, func(ctx context.Context) ([]float32, error) {
+			return generateEmbeddingWithContext(ctx, vectorStore, content)
+		})
 	}
 
-	if s.vectorService != nil {
+	if vectorService := s.vectorService; vectorService != nil {
 		log.Printf("[上下文服务] 使用传统向量服务生成向量")
 		// 传统接口也返回[]float32
-		return s.vectorService.GenerateEmbedding(content)
+		return callWithEmbeddingTimeout(timeout, func(ctx context.Context) ([]float32, error) {
+			return generateEmbeddingWithContext(ctx, vectorService, content)
+		})
 	}
 
 	log.Printf("⚠️ [上下文服务] 向量服务未配置，跳过向量生成")
-	return nil, fmt.Errorf("向量服务未配置")
+	return nil, apperrors.ErrVectorStoreUnconfigured
 }
 
 // storeMemory 统一的记忆存储接口
 // 自动选择使用新接口或传统接口存储记忆
-func (s *ContextService) storeMemory(memory *models.Memory) error {
+func (s *ContextService) storeMemory(memory *models.Memory) (err error) {
+	defer metrics.ObserveVectorStoreOperation("store_memory", time.Now(), &err)
+	memory.Vector = s.normalizeEmbedding(memory.Vector)
+	memory.Metadata = s.tagEmbedding(memory.Metadata, memory.Vector)
+
 	if s.vectorStore != nil {
 		log.Printf("[上下文服务] 使用新向量存储接口存储记忆")
 		return s.vectorStore.StoreMemory(memory)
@@ -122,11 +345,33 @@ func (s *ContextService) storeMemory(memory *models.Memory) error {
 	}
 
 	log.Printf("⚠️ [上下文服务] 向量服务未配置，跳过向量存储")
-	return fmt.Errorf("向量服务未配置")
+	return apperrors.ErrVectorStoreUnconfigured
+}
+
+// storeMessage 统一的消息存储接口
+func (s *ContextService) storeMessage(message *models.Message) (err error) {
+	defer metrics.ObserveVectorStoreOperation("store_message", time.Now(), &err)
+	message.Vector = s.normalizeEmbedding(message.Vector)
+	message.Metadata = s.tagEmbedding(message.Metadata, message.Vector)
+
+	if s.vectorStore != nil {
+		log.Printf("[上下文服务] 使用新向量存储接口存储消息")
+		return s.vectorStore.StoreMessage(message)
+	}
+
+	if s.vectorService != nil {
+		log.Printf("[上下文服务] 使用传统向量服务存储消息")
+		return s.vectorService.StoreMessage(message)
+	}
+
+	log.Printf("⚠️ [上下文服务] 向量服务未配置，跳过消息存储")
+	return apperrors.ErrVectorStoreUnconfigured
 }
 
 // searchByID 统一的ID搜索接口
-func (s *ContextService) searchByID(ctx context.Context, id string, idType string) ([]models.SearchResult, error) {
+func (s *ContextService) searchByID(ctx context.Context, id string, idType string) (results []models.SearchResult, err error) {
+	defer metrics.ObserveVectorStoreOperation("search_by_id", time.Now(), &err)
+
 	if s.vectorStore != nil {
 		log.Printf("[上下文服务] 使用新向量存储接口按ID搜索")
 		searchOptions := &models.SearchOptions{
@@ -140,7 +385,9 @@ func (s *ContextService) searchByID(ctx context.Context, id string, idType strin
 }
 
 // searchByText 统一的文本搜索接口
-func (s *ContextService) searchByText(ctx context.Context, query string, sessionID string, options map[string]interface{}) ([]models.SearchResult, error) {
+func (s *ContextService) searchByText(ctx context.Context, query string, sessionID string, options map[string]interface{}) (results []models.SearchResult, err error) {
+	defer metrics.ObserveVectorStoreOperation("search_by_text", time.Now(), &err)
+
 	if s.vectorStore != nil {
 		log.Printf("[上下文服务] 使用新向量存储接口文本搜索")
 
@@ -156,12 +403,14 @@ func (s *ContextService) searchByText(ctx context.Context, query string, session
 			if skipThreshold, ok := options["skip_threshold_filter"].(bool); ok {
 				searchOptions.SkipThreshold = skipThreshold
 			}
-			if userFilter, ok := options["filter"].(string); ok && strings.Contains(userFilter, "userId=") {
-				// 从过滤器中提取用户ID
-				re := regexp.MustCompile(`userId="([^"]+)"`)
-				if matches := re.FindStringSubmatch(userFilter); len(matches) > 1 {
-					searchOptions.UserID = matches[1]
-				}
+			if threshold, ok := options["similarity_threshold"].(float64); ok && threshold > 0 {
+				searchOptions.Threshold = threshold
+			}
+			if limitVal, ok := options["limit"].(int); ok && limitVal > 0 {
+				searchOptions.Limit = limitVal
+			}
+			if filter, ok := options["filter"].(models.Filter); ok && !filter.IsEmpty() {
+				applySearchFilter(searchOptions, filter)
 			}
 			// 处理暴力搜索参数（仅对 Vearch 有效）
 			if bruteSearch, ok := options["is_brute_search"].(int); ok {
@@ -175,6 +424,14 @@ func (s *ContextService) searchByText(ctx context.Context, query string, session
 			}
 		}
 
+		// 开启归一化时由服务生成并归一化查询向量，与存储的向量保持同一尺度
+		if s.embeddingNormalizeEnabled() {
+			queryVector, err := s.generateEmbedding(query)
+			if err != nil {
+				return nil, fmt.Errorf("生成查询向量失败: %w", err)
+			}
+			return s.vectorStore.SearchByVector(ctx, queryVector, searchOptions)
+		}
 		return s.vectorStore.SearchByText(ctx, query, searchOptions)
 	}
 
@@ -182,7 +439,7 @@ func (s *ContextService) searchByText(ctx context.Context, query string, session
 	log.Printf("[上下文服务] 使用传统向量服务文本搜索")
 
 	// 生成查询向量
-	queryVector, err := s.vectorService.GenerateEmbedding(query)
+	queryVector, err := s.generateEmbedding(query)
 	if err != nil {
 		return nil, fmt.Errorf("生成查询向量失败: %w", err)
 	}
@@ -193,14 +450,24 @@ func (s *ContextService) searchByText(ctx context.Context, query string, session
 		limit = limitVal
 	}
 
-	return s.vectorService.SearchVectorsAdvanced(queryVector, sessionID, limit, options)
+	legacyOptions, err := legacySearchOptions(options, s.vectorService.GetMetric())
+	if err != nil {
+		return nil, err
+	}
+	results, err = s.vectorService.SearchVectorsAdvanced(queryVector, sessionID, limit, legacyOptions)
+	if err != nil {
+		return nil, err
+	}
+	return s.normalizeLegacyScores(results), nil
 }
 
 // searchBySessionID 统一的会话ID搜索接口
-func (s *ContextService) searchBySessionID(ctx context.Context, sessionID string, limit int) ([]models.SearchResult, error) {
+func (s *ContextService) searchBySessionID(ctx context.Context, sessionID string, limit int) (results []models.SearchResult, err error) {
+	defer metrics.ObserveVectorStoreOperation("search_by_session", time.Now(), &err)
+
 	if s.vectorStore != nil {
 		log.Printf("[上下文服务] 使用新向量存储接口按会话ID搜索")
-		filter := fmt.Sprintf(`session_id="%s"`, sessionID)
+		filter := "session_id=" + models.QuoteFilterValue(sessionID)
 		searchOptions := &models.SearchOptions{
 			Limit:         limit,
 			SkipThreshold: true,
@@ -217,7 +484,9 @@ func (s *ContextService) searchBySessionID(ctx context.Context, sessionID string
 }
 
 // countMemories 统一的记忆计数接口
-func (s *ContextService) countMemories(sessionID string) (int, error) {
+func (s *ContextService) countMemories(sessionID string) (count int, err error) {
+	defer metrics.ObserveVectorStoreOperation("count", time.Now(), &err)
+
 	if s.vectorStore != nil {
 		log.Printf("[上下文服务] 使用新向量存储接口计数记忆")
 		return s.vectorStore.CountMemories(sessionID)
@@ -232,6 +501,23 @@ func (s *ContextService) countMemories(sessionID string) (int, error) {
 	return 0, nil
 }
 
+// deleteMemories 统一的记忆删除接口
+func (s *ContextService) deleteMemories(ctx context.Context, ids []string) (err error) {
+	defer metrics.ObserveVectorStoreOperation("delete", time.Now(), &err)
+
+	if s.vectorStore != nil {
+		log.Printf("[上下文服务] 使用新向量存储接口删除记忆")
+		return s.vectorStore.DeleteMemories(ctx, ids)
+	}
+
+	if s.vectorService != nil {
+		log.Printf("[上下文服务] 使用传统向量服务删除记忆")
+		return s.vectorService.DeleteVectors(ids)
+	}
+
+	return apperrors.ErrVectorStoreUnconfigured
+}
+
 // SessionStore 返回会话存储实例
 func (s *ContextService) SessionStore() *store.SessionStore {
 	return s.sessionStore
@@ -266,18 +552,70 @@ func (s *ContextService) CountSessionMemories(ctx context.Context, sessionID str
 
 // StoreContext 存储上下文内容（向后兼容版本）
 func (s *ContextService) StoreContext(ctx context.Context, req models.StoreContextRequest) (string, error) {
+	response, err := s.StoreContextDetailed(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return response.MemoryID, nil
+}
+
+// StoreContextDetailed 存储上下文内容，返回记忆ID、是否命中去重以及LLM驱动存储的分析结果
+func (s *ContextService) StoreContextDetailed(ctx context.Context, req models.StoreContextRequest) (*models.StoreContextResponse, error) {
 	// 记录请求信息
 	log.Printf("[上下文服务] 接收存储请求: 会话ID=%s, 内容长度=%d字节",
 		req.SessionID, len(req.Content))
+	if err := normalizeContentReference(&req); err != nil {
+		return nil, err
+	}
+	if err := normalizeStoreCollection(&req); err != nil {
+		return nil, err
+	}
+	if response, skipped := s.skipTrivialStore(req); skipped {
+		return response, nil
+	}
 
 	// 🔥 开关控制：互斥的两套逻辑
-	if s.config.EnableMultiDimensionalStorage {
+	var outcome storeOutcome
+	var err error
+	if s.shouldChunkContent(req.Content) {
+		log.Printf("✂️ 内容超过分块阈值(%d字符)，使用分块向量存储", s.storeChunkMaxChars())
+		req.Priority = s.resolveStorePriority(req, nil)
+		outcome, err = s.storeChunkedContext(ctx, req)
+	} else if s.config.EnableMultiDimensionalStorage {
 		log.Printf("🚀 启用LLM驱动的多维度存储逻辑")
-		return s.executeLLMDrivenStorage(ctx, req)
+		outcome, err = s.executeLLMDrivenStorage(ctx, req)
 	} else {
 		log.Printf("📋 使用原有的向量存储逻辑")
-		return s.executeOriginalStorage(ctx, req)
+		req.Priority = s.resolveStorePriority(req, nil)
+		outcome, err = s.executeOriginalStorage(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if outcome.priority != "" {
+		req.Priority = outcome.priority
+	}
+
+	response := &models.StoreContextResponse{
+		MemoryID:     outcome.memoryID,
+		Status:       "success",
+		Priority:     req.Priority,
+		Deduplicated: outcome.deduplicated,
+	}
+	outcome.applyEngineResults(response)
+	if outcome.analysisResult != nil {
+		response.AnalysisResult = outcome.analysisResult
+		response.Confidence = outcome.analysisResult.ConfidenceAssessment.OverallConfidence
+		response.StorageStrategy = s.resolveStorageStrategy(response.Confidence)
 	}
+	if outcome.chunkCount > 0 {
+		response.Metadata = map[string]interface{}{
+			"chunked":    true,
+			"chunkCount": outcome.chunkCount,
+		}
+	}
+	s.notifyStoredMemory(req, response)
+	return response, nil
 }
 
 // StoreContextWithAnalysis 存储上下文内容并返回完整分析结果（扩展版本）
@@ -285,56 +623,66 @@ func (s *ContextService) StoreContextWithAnalysis(ctx context.Context, req model
 	// 记录请求信息
 	log.Printf("[上下文服务] 接收存储请求（扩展版本）: 会话ID=%s, 内容长度=%d字节",
 		req.SessionID, len(req.Content))
+	if err := normalizeContentReference(&req); err != nil {
+		return nil, err
+	}
+	if err := normalizeStoreCollection(&req); err != nil {
+		return nil, err
+	}
+	if response, skipped := s.skipTrivialStore(req); skipped {
+		return response, nil
+	}
 
 	// 🔥 开关控制：互斥的两套逻辑
 	if s.llmDrivenConfig.GetConfig().Enabled {
 		log.Printf("🧠 [上下文服务] 使用LLM驱动的多维度存储逻辑（扩展版本）")
 
 		// 执行LLM驱动存储并获取分析结果
-		memoryID, err := s.executeLLMDrivenStorage(ctx, req)
+		outcome, err := s.executeLLMDrivenStorage(ctx, req)
 		if err != nil {
 			return nil, err
 		}
+		req.Priority = outcome.priority
 
 		// 获取最后一次分析结果
 		analysisResult := s.GetLastAnalysisResult()
 
 		response := &models.StoreContextResponse{
-			MemoryID: memoryID,
-			Status:   "success",
+			MemoryID:     outcome.memoryID,
+			Status:       "success",
+			Priority:     req.Priority,
+			Deduplicated: outcome.deduplicated,
 		}
+		outcome.applyEngineResults(response)
 
 		if analysisResult != nil {
 			response.AnalysisResult = analysisResult
 			response.Confidence = analysisResult.ConfidenceAssessment.OverallConfidence
-
-			// 根据置信度确定存储策略
-			contextOnlyThreshold := s.llmDrivenConfig.GetContextOnlyThreshold()
-			if response.Confidence < contextOnlyThreshold {
-				response.StorageStrategy = "context_only"
-			} else if response.Confidence < 0.8 {
-				response.StorageStrategy = "selective_storage"
-			} else {
-				response.StorageStrategy = "full_storage"
-			}
+			response.StorageStrategy = s.resolveStorageStrategy(response.Confidence)
 		}
 
+		s.notifyStoredMemory(req, response)
 		return response, nil
 	} else {
 		log.Printf("📦 [上下文服务] 使用原有的向量存储逻辑（扩展版本）")
-		memoryID, err := s.executeOriginalStorage(ctx, req)
+		req.Priority = s.resolveStorePriority(req, nil)
+		outcome, err := s.executeOriginalStorage(ctx, req)
 		if err != nil {
 			return nil, err
 		}
-		return &models.StoreContextResponse{
-			MemoryID: memoryID,
-			Status:   "success",
-		}, nil
+		response := &models.StoreContextResponse{
+			MemoryID:     outcome.memoryID,
+			Status:       "success",
+			Priority:     req.Priority,
+			Deduplicated: outcome.deduplicated,
+		}
+		s.notifyStoredMemory(req, response)
+		return response, nil
 	}
 }
 
 // executeOriginalStorage 执行原有的向量存储逻辑
-func (s *ContextService) executeOriginalStorage(ctx context.Context, req models.StoreContextRequest) (string, error) {
+func (s *ContextService) executeOriginalStorage(ctx context.Context, req models.StoreContextRequest) (storeOutcome, error) {
 	// 创建记忆对象
 	memory := models.NewMemory(req.SessionID, req.Content, req.Priority, req.Metadata)
 
@@ -355,17 +703,24 @@ func (s *ContextService) executeOriginalStorage(ctx context.Context, req models.
 	vector, err := s.generateEmbedding(req.Content)
 	if err != nil {
 		log.Printf("生成嵌入向量失败: %v", err)
-		return "", fmt.Errorf("生成嵌入向量失败: %w", err)
+		return storeOutcome{}, fmt.Errorf("生成嵌入向量失败: %w", err)
 	}
 	log.Printf("[上下文服务] 向量生成耗时: %v", time.Since(startTime))
 
+	// 开启去重时，已有近似重复记忆则直接返回其ID
+	if req.Dedup {
+		if existingID, found := s.findDuplicateMemory(ctx, req, vector); found {
+			return storeOutcome{memoryID: existingID, deduplicated: true}, nil
+		}
+	}
+
 	// 设置向量
 	memory.Vector = vector
 
-	// 使用统一接口存储到向量数据库
+	// 使用统一接口存储到向量数据库（瞬时错误自动重试）
 	startTime = time.Now()
-	if err := s.storeMemory(memory); err != nil {
-		return "", fmt.Errorf("存储向量失败: %w", err)
+	if err := s.storeMemoryWithRetry(ctx, memory); err != nil {
+		return storeOutcome{}, fmt.Errorf("存储向量失败: %w", err)
 	}
 	log.Printf("[上下文服务] 向量存储耗时: %v", time.Since(startTime))
 
@@ -377,11 +732,125 @@ func (s *ContextService) executeOriginalStorage(ctx context.Context, req models.
 
 	log.Printf("[上下文服务] 成功存储记忆 ID: %s, 会话: %s", memory.ID, memory.SessionID)
 	log.Printf("==================================================== 存储上下文完成 ====================================================")
-	return memory.ID, nil
+	return storeOutcome{memoryID: memory.ID}, nil
+}
+
+// DryRunStoreContext 试运行存储：执行智能分析并返回分析结果、存储策略和将写入的引擎，不写入任何存储
+func (s *ContextService) DryRunStoreContext(ctx context.Context, req models.StoreContextRequest) (*models.StoreContextResponse, error) {
+	log.Printf("🧪 [试运行存储] 会话ID=%s, 内容长度=%d字节", req.SessionID, len(req.Content))
+	if err := normalizeContentReference(&req); err != nil {
+		return nil, err
+	}
+	if err := normalizeStoreCollection(&req); err != nil {
+		return nil, err
+	}
+
+	contextData, err := s.getExistingContextData(ctx, req.SessionID)
+	if err != nil {
+		log.Printf("⚠️ [试运行存储] 获取上下文失败: %v", err)
+		contextData = s.getBasicContextData(req.SessionID)
+	}
+
+	analysisResult, err := s.analyzeContentWithSmartLLM(contextData, req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("智能分析失败: %w", err)
+	}
+
+	confidence := analysisResult.ConfidenceAssessment.OverallConfidence
+	strategy := s.resolveStorageStrategy(confidence)
+	engines := s.plannedStorageEngines(analysisResult, strategy)
+	log.Printf("🧪 [试运行存储] 置信度: %.2f, 策略: %s, 目标引擎: %v", confidence, strategy, engines)
+
+	return &models.StoreContextResponse{
+		Status:          "dry_run",
+		Priority:        s.resolveStorePriority(req, analysisResult),
+		AnalysisResult:  analysisResult,
+		StorageStrategy: strategy,
+		Confidence:      confidence,
+		Metadata: map[string]interface{}{
+			"dryRun":                         true,
+			"targetEngines":                  engines,
+			"contextOnlyThreshold":           s.getContextOnlyThreshold(),
+			"multiDimensionalStorageEnabled": s.config != nil && s.config.EnableMultiDimensionalStorage,
+		},
+	}, nil
+}
+
+// resolveStorageStrategy 根据置信度确定存储策略
+func (s *ContextService) resolveStorageStrategy(confidence float64) string {
+	if confidence < s.getContextOnlyThreshold() {
+		return "context_only"
+	}
+	if confidence < 0.8 {
+		return "selective_storage"
+	}
+	return "full_storage"
+}
+
+// plannedStorageEngines 列出存储时将写入的存储引擎，选择性存储与executeSmartStorage共用planSmartStorage
+func (s *ContextService) plannedStorageEngines(analysisResult *models.SmartAnalysisResult, strategy string) []string {
+	if s.config == nil || !s.config.EnableMultiDimensionalStorage {
+		// 未启用多维度存储时只走原有的向量存储
+		return []string{models.StorageEngineVector}
+	}
+	if strategy == "context_only" {
+		if len(s.contextOnlyEntities(analysisResult, models.StoreContextRequest{}, "")) > 0 && s.storageEngineUsable(engineNameNeo4j) {
+			return []string{models.StorageEngineKnowledgeGraph, models.StorageEngineVector}
+		}
+		return []string{models.StorageEngineVector}
+	}
+
+	return s.planSmartStorage(analysisResult).engines()
+}
+
+// smartStoragePlan 选择性存储时并行写入的存储引擎
+type smartStoragePlan struct {
+	timeline  bool
+	knowledge bool
+	vector    bool
+}
+
+// planSmartStorage 按存储推荐确定写入的存储引擎，跳过未启用或不可用的引擎（不可用的原因已在状态变化时记录）
+func (s *ContextService) planSmartStorage(analysisResult *models.SmartAnalysisResult) smartStoragePlan {
+	var plan smartStoragePlan
+	recommendations := analysisResult.StorageRecommendations
+	if recommendations == nil {
+		return plan
+	}
+	if timeline := recommendations.TimelineStorage; timeline != nil {
+		plan.timeline = timeline.ShouldStore || timeline.TimelineTime == "now"
+	}
+	plan.knowledge = recommendations.KnowledgeGraphStorage != nil && recommendations.KnowledgeGraphStorage.ShouldStore
+	plan.vector = recommendations.VectorStorage != nil && recommendations.VectorStorage.ShouldStore
+
+	if plan.timeline && !s.storageEngineUsable(engineNameTimescaleDB) {
+		log.Printf("⏰ [智能存储] 跳过时间线存储: TimescaleDB %s", s.engines.get(engineNameTimescaleDB).State)
+		plan.timeline = false
+	}
+	if plan.knowledge && !s.storageEngineUsable(engineNameNeo4j) {
+		log.Printf("🕸️ [智能存储] 跳过知识图谱存储: Neo4j %s", s.engines.get(engineNameNeo4j).State)
+		plan.knowledge = false
+	}
+	return plan
+}
+
+// engines 按固定顺序列出计划写入的存储引擎
+func (p smartStoragePlan) engines() []string {
+	engines := []string{}
+	if p.timeline {
+		engines = append(engines, models.StorageEngineTimeline)
+	}
+	if p.knowledge {
+		engines = append(engines, models.StorageEngineKnowledgeGraph)
+	}
+	if p.vector {
+		engines = append(engines, models.StorageEngineVector)
+	}
+	return engines
 }
 
 // executeLLMDrivenStorage 执行LLM驱动的多维度存储逻辑
-func (s *ContextService) executeLLMDrivenStorage(ctx context.Context, req models.StoreContextRequest) (string, error) {
+func (s *ContextService) executeLLMDrivenStorage(ctx context.Context, req models.StoreContextRequest) (storeOutcome, error) {
 	log.Printf("🔥 [LLM驱动存储] 开始执行多维度存储流程")
 
 	// 1. 直接获取已有的上下文（由查询链路维护）
@@ -396,11 +865,26 @@ func (s *ContextService) executeLLMDrivenStorage(ctx context.Context, req models
 	analysisResult, err := s.analyzeContentWithSmartLLM(contextData, req.Content)
 	if err != nil {
 		log.Printf("❌ [LLM驱动存储] 智能分析失败，降级到原有逻辑: %v", err)
-		return s.executeOriginalStorage(ctx, req)
+		req.Priority = s.resolveStorePriority(req, nil)
+		outcome, err := s.executeOriginalStorage(ctx, req)
+		outcome.priority = req.Priority
+		return outcome, err
 	}
 
+	// 🔧 保存分析结果供LLM驱动服务使用（仅真实存储时保存，试运行不覆盖）
+	s.setLastAnalysisResult(analysisResult)
+
+	// 按分析结果推断未指定的优先级
+	req.Priority = s.resolveStorePriority(req, analysisResult)
+
 	// 3. 执行智能存储策略
-	return s.executeSmartStorage(ctx, analysisResult, req)
+	outcome, err := s.executeSmartStorage(ctx, analysisResult, req)
+	if err != nil {
+		return storeOutcome{}, err
+	}
+	outcome.analysisResult = analysisResult
+	outcome.priority = req.Priority
+	return outcome, nil
 }
 
 // getExistingContextData 获取已有的上下文数据（由查询链路维护）
@@ -415,12 +899,26 @@ func (s *ContextService) getExistingContextData(ctx context.Context, sessionID s
 		return nil, fmt.Errorf("获取会话失败: %w", err)
 	}
 
-	// 2. 从会话历史中分析上下文模式
-	contextModel, err := s.buildContextFromSession(session)
-	if err != nil {
-		log.Printf("❌ [上下文获取] 从会话构建上下文失败: %v", err)
-		return nil, fmt.Errorf("构建上下文失败: %w", err)
+	// 2. 优先加载已保存的语境模型，只根据新消息增量更新；没有时从会话历史构建
+	messageCount := len(session.Messages)
+	var contextModel *models.LLMDrivenContextModel
+	if persisted := loadPersistedContextModel(session); persisted != nil {
+		log.Printf("📦 [上下文获取] 加载已保存的语境模型，版本: %d，已处理消息: %d/%d",
+			persisted.Model.Version, persisted.MessageCount, messageCount)
+		if persisted.MessageCount == messageCount {
+			persisted.Model.LastAccessed = time.Now()
+			return persisted.Model, nil
+		}
+		contextModel = s.updateContextModelFromSession(persisted.Model, session, persisted.MessageCount)
+	} else {
+		contextModel, err = s.buildContextFromSession(session)
+		if err != nil {
+			log.Printf("❌ [上下文获取] 从会话构建上下文失败: %v", err)
+			return nil, fmt.Errorf("构建上下文失败: %w", err)
+		}
 	}
+	contextModel.LastAccessed = time.Now()
+	s.saveContextModel(sessionID, contextModel, messageCount)
 
 	log.Printf("✅ [上下文获取] 成功获取会话上下文，焦点: %s", contextModel.Core.CurrentFocus)
 	return contextModel, nil
@@ -539,15 +1037,34 @@ func (s *ContextService) analyzeContentWithSmartLLM(contextData *models.LLMDrive
 	}
 }
 
-// getKnowledgeGraphExtractionMode 获取知识图谱抽取模式
+// getKnowledgeGraphExtractionMode 获取知识图谱抽取模式（来自LLM驱动配置，支持热重载）
 func (s *ContextService) getKnowledgeGraphExtractionMode() string {
-	mode := os.Getenv("KNOWLEDGE_GRAPH_EXTRACTION_MODE")
-	if mode == "" {
-		mode = "disabled" // 默认关闭
+	if s.llmDrivenConfig == nil {
+		return config.KGExtractionModeDisabled // 默认关闭
 	}
+	mode, _ := s.llmDrivenConfig.GetKnowledgeGraphExtractionMode()
 	return mode
 }
 
+// GetLLMDrivenConfigSummary 获取LLM驱动配置摘要
+func (s *ContextService) GetLLMDrivenConfigSummary() map[string]interface{} {
+	if s.llmDrivenConfig == nil {
+		return map[string]interface{}{"status": "not_loaded"}
+	}
+	return s.llmDrivenConfig.GetConfigSummary()
+}
+
+// ReloadLLMDrivenConfig 重新加载LLM驱动配置，失败时保留原有配置
+func (s *ContextService) ReloadLLMDrivenConfig() (map[string]interface{}, error) {
+	if s.llmDrivenConfig == nil {
+		return nil, fmt.Errorf("LLM驱动配置未初始化")
+	}
+	if _, err := s.llmDrivenConfig.ReloadConfig(); err != nil {
+		return nil, fmt.Errorf("重新加载LLM驱动配置失败: %w", err)
+	}
+	return s.llmDrivenConfig.GetConfigSummary(), nil
+}
+
 // executeOriginalAnalysis 执行原有的分析逻辑
 func (s *ContextService) executeOriginalAnalysis(contextData *models.LLMDrivenContextModel, content string) (*models.SmartAnalysisResult, error) {
 	funcStart := time.Now()
@@ -555,13 +1072,14 @@ func (s *ContextService) executeOriginalAnalysis(contextData *models.LLMDrivenCo
 
 	// 构建智能分析prompt
 	promptStart := time.Now()
-	prompt := s.buildSmartAnalysisPrompt(contextData, content)
+	prompt := s.guardAnalysisPrompt("原有分析", content, func(content string) string {
+		return s.buildSmartAnalysisPrompt(contextData, content)
+	}, nil)
 	promptDuration := time.Since(promptStart)
 	log.Printf("📝 [原有分析] 构建prompt完成: %s, 耗时: %v, 长度: %d", time.Now().Format("15:04:05.000"), promptDuration, len(prompt))
 
 	// 🔥 参考查询链路的LLM调用模式，使用LLM工厂和标准接口
-	llmProvider := s.config.MultiDimLLMProvider
-	llmModel := s.config.MultiDimLLMModel
+	llmProvider, llmModel := s.sessionLLMConfig(contextData.SessionID)
 	if llmProvider == "" {
 		return nil, fmt.Errorf("LLM提供商未配置")
 	}
@@ -605,7 +1123,7 @@ func (s *ContextService) executeOriginalAnalysis(contextData *models.LLMDrivenCo
 	log.Printf("🚀 [原有分析] 开始调用LLM API: %s, 提供商: %s，模型: %s", apiCallStart.Format("15:04:05.000"), llmProvider, llmModel)
 	log.Printf("🔍 [原有分析] 限流检查开始: %s", time.Now().Format("15:04:05.000"))
 
-	llmResponse, err := llmClient.Complete(ctx, llmRequest)
+	llmResponse, err := s.completeWithStreamProgress(ctx, llmClient, llmRequest)
 
 	apiCallEnd := time.Now()
 	apiCallDuration := apiCallEnd.Sub(apiCallStart)
@@ -613,6 +1131,7 @@ func (s *ContextService) executeOriginalAnalysis(contextData *models.LLMDrivenCo
 		log.Printf("❌ [原有分析] LLM API调用失败: %s, 耗时: %v, 错误: %v", apiCallEnd.Format("15:04:05.000"), apiCallDuration, err)
 		return s.getBasicSmartAnalysisResult(content), nil
 	}
+	s.recordLLMUsage(llmRequest, llmResponse)
 
 	// 🔥 打印LLM出参
 	log.Printf("✅ [原有分析] LLM API调用完成: %s, 耗时: %v, Token使用: %d", apiCallEnd.Format("15:04:05.000"), apiCallDuration, llmResponse.TokensUsed)
@@ -630,23 +1149,73 @@ func (s *ContextService) executeOriginalAnalysis(contextData *models.LLMDrivenCo
 
 	log.Printf("✅ [智能分析] 多维度分析完成，整体置信度: %.2f", analysisResult.ConfidenceAssessment.OverallConfidence)
 
-	// 🔧 保存分析结果供LLM驱动服务使用
-	s.setLastAnalysisResult(analysisResult)
-
 	return analysisResult, nil
 }
 
+// completeWithStreamProgress 通过流式接口调用LLM，记录增量进度并在上下文取消时提前退出
+func (s *ContextService) completeWithStreamProgress(ctx context.Context, llmClient llm.LLMClient, llmRequest *llm.LLMRequest) (*llm.LLMResponse, error) {
+	const progressLogInterval = 5 * time.Second
+
+	startTime := time.Now()
+	chunks, err := llmClient.CompleteStream(ctx, llmRequest)
+	if err != nil {
+		return nil, fmt.Errorf("启动流式调用失败: %w", err)
+	}
+
+	lastLog := startTime
+	chunkCount, received := 0, 0
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("⏹️ [流式分析] 上下文已取消，提前结束，已接收 %d 个片段", chunkCount)
+			return nil, ctx.Err()
+		case chunk, ok := <-chunks:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, fmt.Errorf("流式响应意外结束，已接收 %d 个片段", chunkCount)
+			}
+			if chunk.Error != nil {
+				return nil, chunk.Error
+			}
+			if chunk.Done {
+				log.Printf("📶 [流式分析] 流式响应完成，片段数: %d，内容长度: %d 字符，耗时: %v",
+					chunkCount, len(chunk.Content), time.Since(startTime))
+				return &llm.LLMResponse{
+					Content:    chunk.Content,
+					TokensUsed: chunk.TokensUsed,
+					Model:      llmClient.GetModel(),
+					Provider:   chunk.Provider,
+					Duration:   time.Since(startTime),
+				}, nil
+			}
+
+			chunkCount++
+			received += len(chunk.Delta)
+			if time.Since(lastLog) >= progressLogInterval {
+				lastLog = time.Now()
+				log.Printf("📶 [流式分析] 已接收 %d 个片段，累计 %d 字符，耗时: %v",
+					chunkCount, received, time.Since(startTime))
+			}
+		}
+	}
+}
+
 // executeEnhancedPromptAnalysis 执行方案一：增强prompt分析
 func (s *ContextService) executeEnhancedPromptAnalysis(contextData *models.LLMDrivenContextModel, content string) (*models.SmartAnalysisResult, error) {
 	log.Printf("🔥 [方案一] 执行增强prompt分析")
 
 	// 构建增强的智能分析prompt（包含KG维度）
-	prompt := s.buildEnhancedSmartAnalysisPrompt(contextData, content)
+	prompt := s.guardAnalysisPrompt("增强分析", content, func(content string) string {
+		return s.buildEnhancedSmartAnalysisPrompt(contextData, content)
+	}, func(content string) string {
+		return s.buildSmartAnalysisPrompt(contextData, content)
+	})
 	log.Printf("📝 [增强分析] 构建的增强prompt长度: %d", len(prompt))
 
 	// 🔥 使用现有的LLM调用逻辑
-	llmProvider := s.config.MultiDimLLMProvider
-	llmModel := s.config.MultiDimLLMModel
+	llmProvider, llmModel := s.sessionLLMConfig(contextData.SessionID)
 	if llmProvider == "" {
 		return nil, fmt.Errorf("LLM提供商未配置")
 	}
@@ -682,6 +1251,7 @@ func (s *ContextService) executeEnhancedPromptAnalysis(contextData *models.LLMDr
 		log.Printf("❌ [增强分析] LLM API调用失败: %v，降级到基础分析", err)
 		return s.getBasicSmartAnalysisResult(content), nil
 	}
+	s.recordLLMUsage(llmRequest, llmResponse)
 
 	log.Printf("✅ [增强分析] LLM调用完成，Token使用: %d", llmResponse.TokensUsed)
 	log.Printf("📄 [增强分析] LLM响应长度: %d 字符", len(llmResponse.Content))
@@ -703,259 +1273,6 @@ func (s *ContextService) executeEnhancedPromptAnalysis(contextData *models.LLMDr
 	return analysisResult, nil
 }
 
-// buildSmartAnalysisPrompt 构建智能分析的prompt（替换buildStorageAnalysisPrompt）
-func (s *ContextService) buildSmartAnalysisPrompt(contextData *models.LLMDrivenContextModel, content string) string {
-	prompt := fmt.Sprintf(`你是一个专业的语义意图识别专家，专门负责从用户查询中进行意图拆分和语义关键词提取。
-
-## 🎯 核心任务
-1. **意图拆分**: 识别用户查询中的多个语义意图（可能包含多个步骤、动作或关注点）
-2. **语义关键词提取**: 保留核心关键词，剔除干扰词、停用词，进行降噪处理
-3. **置信度评估**: 客观评判语义是否清晰、信息是否充足、识别结果是否可靠
-
-## 🧠 意图拆分原则
-用户的query/command可能包含多个语义层次：
-- **复合意图**: "先制定计划，再实现功能" → 拆分为"制定计划" + "功能实现"
-- **层次意图**: "学习React Hook，重点关注useState" → 拆分为"React Hook学习" + "useState重点关注"
-- **条件意图**: "如果性能有问题，就优化数据库查询" → 拆分为"性能问题诊断" + "数据库查询优化"
-
-## 📊 四维度语义提取
-
-### 1. Core Intent Vector (核心意图维度)
-**目的**: 提取用户的核心意图关键词，支持多意图拆分
-**处理原则**:
-- 保留具体的技术词汇、功能名称、概念名称
-- 剔除"我想"、"请帮我"、"了解一下"等干扰词
-- 支持多个意图的并列表达
-
-### 2. Domain Context Vector (领域上下文维度)
-**目的**: 识别技术栈和业务领域的具体上下文
-**处理原则**: 从具体到抽象，保留最具区分度的领域信息
-
-### 3. Scenario Vector (场景维度)
-**目的**: 识别具体的使用场景和问题背景
-**处理原则**: 基于上下文推断最可能的使用场景
-
-### 4. Completeness Vector (完整度维度)
-**目的**: 评估信息完整度，识别缺失要素
-**关键评估**: 语义是否清晰、信息是否充足、识别结果是否可靠
-
-## 🎯 置信度评估标准（重要！）
-请基于以下具体维度和指标进行客观评估：
-
-1. **语义清晰度** (semantic_clarity):
-   评估用户表达的明确程度，重点关注：
-   - **用户痛点识别**: 能否明确识别用户遇到的具体问题或需求？
-   - **场景上下文**: 能否判断用户所处的业务场景、工作环境或项目背景？
-   - **诉求明确性**: 用户想要什么？期望得到什么帮助？
-
-   评分标准：
-   - 0.9+: 痛点明确、场景清晰、诉求具体（如"生产环境MySQL查询慢，需要优化方案"）
-   - 0.7-0.9: 痛点相对明确、有基本场景信息（如"React项目中useState更新异步问题"）
-   - 0.5-0.7: 痛点模糊但可推断、缺乏场景信息（如"代码有bug需要修复"）
-   - 0.3-0.5: 痛点不明确、场景缺失（如"API有问题"、"系统出错了"）
-   - <0.3: 无法识别痛点和场景（如"不行"、"有问题"、纯感叹词）
-
-2. **信息完整度** (information_completeness):
-   评估信息的充分程度：
-   - **关键要素**: 是否包含时间、地点、对象、事件等关键要素？
-   - **技术细节**: 对于技术问题，是否包含技术栈、环境、错误信息等？
-   - **业务背景**: 对于业务问题，是否包含业务场景、流程、目标等？
-
-   评分标准：
-   - 0.9+: 包含完整的关键要素和背景信息
-   - 0.7-0.9: 包含主要要素，少量细节缺失
-   - 0.5-0.7: 包含基本要素，但缺乏重要背景
-   - 0.3-0.5: 要素不完整，信息严重缺失
-   - <0.3: 几乎无有效信息
-
-3. **意图识别可信度** (intent_confidence):
-   评估意图识别的准确性：
-   - **意图明确性**: 用户的真实意图是否清晰？
-   - **歧义程度**: 是否存在多种可能的解释？
-   - **可操作性**: 基于当前信息是否能提供有效帮助？
-
-   评分标准：
-   - 0.9+: 意图非常明确，无歧义，可直接操作
-   - 0.7-0.9: 意图相对明确，轻微歧义，基本可操作
-   - 0.5-0.7: 意图模糊，存在歧义，需要澄清
-   - 0.3-0.5: 意图不明确，多种解释，难以操作
-   - <0.3: 无法识别有效意图
-
-## 🚨 低质量内容识别标准
-以下情况应给予极低置信度（overall_confidence < 0.4）：
-
-**无效表达类**:
-- 纯感叹词: "啊"、"哦"、"嗯"、"呃"
-- 简单否定: "不行"、"不对"、"失败了"
-- 模糊问题: "有问题"、"出错了"、"坏了"
-
-**信息缺失类**:
-- 仅有技术词汇无具体问题: "API"、"数据库"、"前端"
-- 无上下文的求助: "帮忙"、"求助"、"怎么办"
-- 过于简短无意义: 少于3个有效字符
-
-## 🌟 高质量内容识别标准
-以下情况应给予高置信度（overall_confidence > 0.7）：
-
-**场景明确类**:
-- 包含时间信息: "昨天的项目进度"、"上周完成的功能"
-- 包含环境信息: "生产环境"、"测试环境"、"开发阶段"
-- 包含业务背景: "电商系统"、"用户管理模块"、"支付流程"
-
-**问题具体类**:
-- 技术问题有细节: "MySQL查询响应时间从50ms增加到500ms"
-- 功能需求明确: "需要实现用户登录的JWT认证"
-- 错误信息完整: "React Hook useState更新后立即读取仍是旧值"
-
-## ⏰ 时间线存储智能识别规则（重要！）
-
-**🔥 应该存储到时间线的场景**：
-1. **明确时间信息**: "昨天"、"上周"、"2024年8月"、"今天完成"等
-2. **总结性内容**: "我们成功实现了..."、"项目已完成..."、"最终结论是..."
-3. **里程碑事件**: "架构设计完成"、"功能上线"、"问题解决"、"重要决策"
-4. **结论性表述**: "总结一下"、"综上所述"、"最终确定"、"得出结论"
-5. **完成状态**: "已实现"、"已修复"、"已优化"、"已部署"
-
-**时间标识规则**：
-- **有明确时间**: 提取具体时间（如"2024-08-10"、"昨天"、"上周"）
-- **无明确时间但是总结/结论/里程碑**: 使用"now"表示当前时间
-- **普通讨论/询问**: 不存储到时间线
-
-**示例判断**：
-- ✅ "我们成功实现了LLM驱动的智能存储架构" → should_store: true, timeline_time: "now"
-- ✅ "昨天完成了数据库优化" → should_store: true, timeline_time: "昨天"
-- ✅ "项目第一阶段已完成，包括..." → should_store: true, timeline_time: "now"
-- ❌ "如何实现用户登录功能？" → should_store: false
-- ❌ "API调用出现错误" → should_store: false
-
-## 已有上下文信息
-**会话ID**: %s
-**会话焦点**: %s
-**意图类别**: %s
-**复杂度**: %s
-
-## 用户内容
-%s
-
-## 📋 输出格式
-
-请严格按照以下JSON格式输出：
-
-{
-  "intent_analysis": {
-    "core_intent_text": "核心意图关键词（支持多意图）",
-    "domain_context_text": "具体技术栈和领域",
-    "scenario_text": "具体使用场景",
-    "intent_count": 1,
-    "multi_intent_breakdown": ["意图1", "意图2"],
-    "summary": "100-200字符的结构化摘要，突出关键信息和结果"
-  },
-
-  "confidence_assessment": {
-    "semantic_clarity": <根据语义清晰度评估的0-1数值>,
-    "information_completeness": <根据信息完整度评估的0-1数值>,
-    "intent_confidence": <根据意图识别可信度评估的0-1数值>,
-    "overall_confidence": <根据综合评估的0-1数值>,
-    "missing_elements": ["缺失的关键要素"],// 例如：["技术栈", "环境信息"]
-    "clarity_issues": ["识别出的清晰度问题"] //例如：["需求过于抽象", "缺少具体参数"]
-  },
-
-  "storage_recommendations": {
-    "timeline_storage": {
-      "should_store": <true/false，基于时间信息判断>,
-      "reason": "<存储或不存储的具体原因>",
-      "confidence_threshold": 0.7,
-      "timeline_time": "<时间标识规则详见下方说明>",
-      "event_type": "<根据内容特征判断的事件类型，详见下方说明>"
-    },
-    "knowledge_graph_storage": {
-      "should_store": <true/false，基于是否包含技术概念和关系>,
-      "reason": "<存储或不存储的具体原因>",
-      "confidence_threshold": 0.6
-    },
-    "vector_storage": {
-      "should_store": <true/false，基于意图清晰度>,
-      "reason": "<存储或不存储的具体原因>",
-      "confidence_threshold": 0.5,
-      "enabled_dimensions": [<根据内容质量确定的维度列表>]
-    }
-  }
-}
-
-## 📝 summary字段生成规则（重要！）
-请生成100-200字符的结构化摘要：
-
-**生成原则**：
-- **结构化表达**: 采用"通过X技术解决Y问题，达到Z效果"的格式
-- **关键信息**: 技术栈、问题描述、解决方案、具体效果
-- **量化优先**: 包含性能数据、时间节约、错误减少等具体数字
-- **行动导向**: 突出已完成/正在做/计划做的具体行动
-
-**生成示例**：
-输入："团队讨论了Redis缓存策略，决定使用分布式缓存解决数据一致性问题，预计可以提升30%查询性能"
-→ summary: "采用Redis分布式缓存策略解决数据一致性问题，预计提升查询性能30%，优化系统响应效率"
-
-## 🔥 timeline_time字段规则
-- **有明确时间**: 转换为标准格式（"昨天"→"2025-08-09", "上周"→"2025-08-03", 保持"2024-08-10"格式）
-- **无明确时间但包含结论性内容**: 使用"now"（总结、已完成、成功实现、里程碑、决定等）
-- **普通讨论/询问**: 不存储时间线
-## 🏷️ event_type字段规则（重要！）
-请根据内容特征判断最合适的事件类型：
-
-**🔧 code_edit**: 包含具体代码修改、文件编辑、代码实现
-- 关键词: "修改了"、"实现了"、"代码"、"文件"、"函数"、"实现"
-- 示例: "修改了user.go文件的登录逻辑"
-
-**💬 discussion**: 技术讨论、方案对比、团队交流
-- 关键词: "讨论"、"交流"、"分析"、"对比"、"评估"
-- 示例: "团队讨论了微服务架构的优缺点"
-
-**🎨 design**: 架构设计、系统设计、方案设计
-- 关键词: "设计"、"架构"、"方案"、"设计评审"、"确定采用"
-- 示例: "完成了系统架构设计，采用微服务模式"
-
-**🔧 problem_solve**: 问题解决、故障处理、bug修复
-- 关键词: "解决"、"修复"、"故障"、"问题"、"bug"、"异常"
-- 示例: "解决了数据库连接池耗尽的问题"
-
-**📚 knowledge_share**: 知识分享、最佳实践、经验总结
-- 关键词: "分享"、"最佳实践"、"经验"、"总结"、"技巧"
-- 示例: "分享LLM系统设计的最佳实践"
-
-**⚖️ decision**: 重要决策、技术选型、方案确定
-- 关键词: "决定"、"选择"、"确定"、"采用"、"决策"
-- 示例: "决定采用Redis作为缓存方案"
-
-**📝 review**: 代码审查、方案评审、技术评估
-- 关键词: "审查"、"评审"、"review"、"评估"、"检查"
-- 示例: "完成了代码review，发现3个优化点"
-
-**🧪 test**: 测试相关、验证、实验
-- 关键词: "测试"、"验证"、"实验"、"test"、"验证"
-- 示例: "完成了API接口的集成测试"
-
-**🚀 deployment**: 部署、发布、上线
-- 关键词: "部署"、"发布"、"上线"、"deploy"、"上线"
-- 示例: "完成了生产环境的部署"
-
-**📅 meeting**: 会议记录、团队会议、评审会议
-- 关键词: "会议"、"meeting"、"评审会"、"讨论会"
-- 示例: "参加了项目进度评审会议"
-
-**🎯 intent_based**: 复杂业务场景、无法明确归类的内容
-- 用途: 兜底分类，当无法明确归类到上述类型时使用
-- 示例: 复杂的业务流程描述、多维度技术分析
-
-现在请分析以上用户查询。`,
-		contextData.SessionID,
-		contextData.Core.CurrentFocus,
-		string(contextData.Core.IntentCategory),
-		contextData.Core.Complexity,
-		content)
-
-	return prompt
-}
-
 // buildEnhancedSmartAnalysisPrompt 构建增强的智能分析prompt（方案一：包含KG维度）
 func (s *ContextService) buildEnhancedSmartAnalysisPrompt(contextData *models.LLMDrivenContextModel, content string) string {
 	basePrompt := s.buildSmartAnalysisPrompt(contextData, content)
@@ -1091,14 +1408,15 @@ func (s *ContextService) executeDedicatedKGAnalysis(contextData *models.LLMDrive
 
 	// 构建专门的知识图谱抽取prompt
 	promptStart := time.Now()
-	prompt := s.buildDedicatedKGPrompt(contextData, content)
+	prompt := s.guardAnalysisPrompt("知识图谱分析", content, func(content string) string {
+		return s.buildDedicatedKGPrompt(contextData, content)
+	}, nil)
 	promptDuration := time.Since(promptStart)
 	log.Printf("📝 [专门KG] 构建prompt完成: %s, 耗时: %v, 长度: %d", time.Now().Format("15:04:05.000"), promptDuration, len(prompt))
 
 	// 创建LLM客户端
 	clientStart := time.Now()
-	llmProvider := s.config.MultiDimLLMProvider
-	llmModel := s.config.MultiDimLLMModel
+	llmProvider, llmModel := s.sessionLLMConfig(contextData.SessionID)
 	if llmProvider == "" {
 		return nil, fmt.Errorf("LLM提供商未配置")
 	}
@@ -1145,6 +1463,7 @@ func (s *ContextService) executeDedicatedKGAnalysis(contextData *models.LLMDrive
 		log.Printf("❌ [专门KG] LLM API调用失败: %s, 耗时: %v, 错误: %v", apiCallEnd.Format("15:04:05.000"), apiCallDuration, err)
 		return nil, fmt.Errorf("专门化LLM API调用失败: %w", err)
 	}
+	s.recordLLMUsage(llmRequest, llmResponse)
 
 	log.Printf("✅ [专门KG] LLM API调用完成: %s, 耗时: %v, Token使用: %d", apiCallEnd.Format("15:04:05.000"), apiCallDuration, llmResponse.TokensUsed)
 	log.Printf("📄 [专门KG] LLM响应长度: %d 字符", len(llmResponse.Content))
@@ -1168,106 +1487,6 @@ func (s *ContextService) executeDedicatedKGAnalysis(contextData *models.LLMDrive
 	return kgExtraction, nil
 }
 
-// buildDedicatedKGPrompt 构建专门的知识图谱抽取prompt（方案二：高质量专门化）
-func (s *ContextService) buildDedicatedKGPrompt(contextData *models.LLMDrivenContextModel, content string) string {
-	return fmt.Sprintf(`你是专业的知识图谱构建专家，专门从技术文档和对话中抽取实体和关系。
-
-## 🎯 核心任务
-从用户内容中构建高质量的知识图谱，提取实体和关系信息。
-
-## 📊 实体抽取标准（6种通用类型）
-
-### 1. Technical（技术实体）
-- 编程语言: Go, Python, Java, JavaScript, C++
-- 框架工具: Spring Boot, React, Vue, Docker, Kubernetes
-- 数据库: MySQL, Redis, PostgreSQL, Neo4j, MongoDB
-- 技术产品: Context-Keeper, 微服务系统, API网关
-
-### 2. Project（项目工作）
-- 项目: 电商系统开发, 性能优化项目, 架构重构
-- 功能: 订单支付模块, 用户管理功能, 数据分析
-- 任务: 数据库优化, 接口开发, 性能调优
-
-### 3. Concept（技术概念）
-- 架构概念: 微服务架构, 分层设计, 事件驱动
-- 技术概念: 并发处理, 缓存策略, 负载均衡
-- 设计模式: 单例模式, 工厂模式, 观察者模式
-
-### 4. Issue（事件问题）
-- 技术问题: 性能瓶颈, 内存泄漏, 并发问题
-- 系统事件: 服务故障, 数据丢失, 网络中断
-- 优化事件: 性能优化, 架构升级, 代码重构
-
-### 5. Data（数据资源）
-- 性能数据: 72秒, 1000TPS, 15%%失败率, 99.9%%可用性
-- 配置参数: 超时时间, 连接池大小, 缓存大小
-- 版本信息: v1.0.0, 2025-08-20, 第一阶段
-
-### 6. Process（操作流程）
-- 技术操作: 数据库查询, API调用, 缓存更新
-- 部署操作: 服务部署, 配置更新, 环境切换
-- 开发流程: 代码审查, 测试执行, 持续集成
-
-## 🔗 关系抽取标准（5种核心关系）
-
-### 1. USES（使用关系）
-- 技术栈: Context-Keeper USES Neo4j
-- 工具链: 项目 USES Spring Boot
-
-### 2. SOLVES（解决关系）
-- 问题解决: 性能优化 SOLVES 响应慢
-- 技术解决: 缓存策略 SOLVES 并发问题
-
-### 3. BELONGS_TO（归属关系）
-- 模块归属: 支付模块 BELONGS_TO 电商系统
-- 功能归属: 用户登录 BELONGS_TO 用户管理
-
-### 4. CAUSES（因果关系）
-- 问题原因: 高并发 CAUSES 性能下降
-- 技术因果: 内存泄漏 CAUSES 系统崩溃
-
-### 5. RELATED_TO（相关关系）
-- 概念相关: 微服务 RELATED_TO 分布式架构
-- 技术相关: Docker RELATED_TO Kubernetes
-
-## 📝 分析内容
-**会话ID**: %s
-**用户内容**: %s
-
-## 📋 输出格式
-请严格按照以下JSON格式输出：
-
-{
-  "entities": [
-    {
-      "title": "Context-Keeper",
-      "type": "Technical",
-      "description": "LLM驱动的上下文管理系统",
-      "confidence": 0.95,
-      "keywords": ["上下文", "管理", "LLM"]
-    }
-  ],
-  "relationships": [
-    {
-      "source": "性能优化",
-      "target": "客户端超时",
-      "relation_type": "SOLVES",
-      "description": "性能优化解决了客户端超时问题",
-      "strength": 9,
-      "confidence": 0.9,
-      "evidence": "接口耗时从72秒降到22秒，客户端超时问题完全消除"
-    }
-  ],
-  "extraction_meta": {
-    "entity_count": 0,
-    "relationship_count": 0,
-    "overall_quality": 0.85
-  }
-}`,
-		contextData.SessionID,
-		content)
-}
-
 // parseEnhancedSmartAnalysisResponse 解析增强的智能分析响应（方案一）
 func (s *ContextService) parseEnhancedSmartAnalysisResponse(response string) (*models.SmartAnalysisResult, error) {
 	// 首先使用原有的解析逻辑
@@ -1623,7 +1842,38 @@ func (s *ContextService) getBasicAnalysisResult(content string) map[string]inter
 }
 
 // createStandardLLMClient 创建标准LLM客户端（参考查询链路的实现）
+// 配置了LLM_FALLBACK_PROVIDERS时，主提供商瞬时故障会按顺序改用备用提供商
 func (s *ContextService) createStandardLLMClient(provider, model string) (llm.LLMClient, error) {
+	client, err := s.createProviderLLMClient(provider, model)
+	if err != nil {
+		return nil, err
+	}
+	if s.config == nil || strings.TrimSpace(s.config.LLMFallbackProviders) == "" {
+		return client, nil
+	}
+
+	specs, err := llm.ParseFallbackProviders(s.config.LLMFallbackProviders)
+	if err != nil {
+		log.Printf("⚠️ [LLM客户端] 备用提供商配置无效，不启用降级: %v", err)
+		return client, nil
+	}
+	var fallbacks []llm.FallbackTarget
+	for _, spec := range specs {
+		if string(spec.Provider) == provider {
+			continue
+		}
+		fallbackClient, err := s.createProviderLLMClient(string(spec.Provider), spec.Model)
+		if err != nil {
+			log.Printf("⚠️ [LLM客户端] 跳过备用提供商 %s: %v", spec.Provider, err)
+			continue
+		}
+		fallbacks = append(fallbacks, llm.FallbackTarget{Client: fallbackClient, Model: spec.Model})
+	}
+	return llm.WithFallback(client, model, fallbacks), nil
+}
+
+// createProviderLLMClient 创建单个提供商的LLM客户端
+func (s *ContextService) createProviderLLMClient(provider, model string) (llm.LLMClient, error) {
 	log.Printf("🔧 [LLM客户端] 创建标准LLM客户端，提供商: %s，模型: %s", provider, model)
 
 	// 获取对应的API Key
@@ -1708,6 +1958,11 @@ func (s *ContextService) parseSmartAnalysisResponse(response string) (*models.Sm
 
 	// 🔥 清理markdown代码块标记（处理DeepSeek等LLM返回的格式）
 	cleanedResponse := s.cleanLLMResponse(response)
+
+	// 🔥 提取第一个完整的顶层JSON对象，避免JSON后附带的解释文字导致解析失败
+	if jsonObject, ok := extractFirstJSONObject(cleanedResponse); ok {
+		cleanedResponse = jsonObject
+	}
 	log.Printf("🧹 [智能分析解析] 清理后响应长度: %d", len(cleanedResponse))
 
 	var rawResult map[string]interface{}
@@ -1878,6 +2133,47 @@ func (s *ContextService) cleanLLMResponse(response string) string {
 	return response
 }
 
+// extractFirstJSONObject 扫描匹配的花括号，提取第一个完整的顶层JSON对象
+// 字符串内的花括号和转义字符不参与匹配；未找到完整对象时返回false
+func extractFirstJSONObject(text string) (string, bool) {
+	start := strings.Index(text, "{")
+	if start < 0 {
+		return "", false
+	}
+
+	depth := 0
+	inString := false
+	escaped := false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return text[start : i+1], true
+			}
+		}
+	}
+
+	return "", false
+}
+
 // 辅助函数：从map中获取整数值
 func getIntFromMap(m map[string]interface{}, key string) int {
 	if val, exists := m[key]; exists {
@@ -1945,19 +2241,8 @@ func (s *ContextService) extractWorkspaceName(sessionID string) string {
 		return ""
 	}
 
-	// 🔥 从完整路径中提取最后一级目录名作为工程名
-	if strings.Contains(workspacePath, "/") {
-		parts := strings.Split(workspacePath, "/")
-		workspaceName := parts[len(parts)-1]
-		if workspaceName != "" {
-			log.Printf("🔧 [工程名提取] 从路径 %s 提取工程名: %s", workspacePath, workspaceName)
-			return workspaceName
-		}
-	}
-
-	// 如果路径不包含/，直接返回原路径
-	log.Printf("🔧 [工程名提取] 路径不包含分隔符，直接使用: %s", workspacePath)
-	return workspacePath
+	// 与工作空间列表使用同一规则，规范化路径后取最后一级目录名作为工程名
+	return utils.ExtractWorkspaceNameFromPath(workspacePath)
 }
 
 // getTimelineStorageThreshold 获取时间线存储的置信度阈值
@@ -2043,7 +2328,7 @@ func (s *ContextService) getBasicSmartAnalysisResult(content string) *models.Sma
 }
 
 // executeSmartStorage 执行智能存储策略（替换storeToMultiDimensionalEngines）
-func (s *ContextService) executeSmartStorage(ctx context.Context, analysisResult *models.SmartAnalysisResult, req models.StoreContextRequest) (string, error) {
+func (s *ContextService) executeSmartStorage(ctx context.Context, analysisResult *models.SmartAnalysisResult, req models.StoreContextRequest) (storeOutcome, error) {
 	log.Printf("🧠 [智能存储] 开始执行智能存储决策")
 
 	overallConfidence := analysisResult.ConfidenceAssessment.OverallConfidence
@@ -2057,28 +2342,58 @@ func (s *ContextService) executeSmartStorage(ctx context.Context, analysisResult
 	if overallConfidence < contextOnlyThreshold {
 		log.Printf("⚠️ [智能存储] 置信度过低(%.2f < %.2f)，仅记录上下文",
 			overallConfidence, contextOnlyThreshold)
-		return s.storeContextOnly(analysisResult, req, memoryID)
+		return s.storeContextOnly(ctx, analysisResult, req, memoryID)
 	}
 
 	// 中高置信度：根据推荐结果选择性存储 - 🔥 并行执行
 	log.Printf("✅ [智能存储] 置信度满足要求，执行并行选择性存储")
 
-	var storageErrors []error
+	// 各引擎使用带超时的上下文，请求取消或超时时中止写入，避免后端挂起导致请求一直阻塞
+	storeCtx, cancel := s.smartStorageContext(ctx)
+	defer cancel()
+
+	var engineResults []models.StorageEngineResult
 	var mutex sync.Mutex
 	var wg sync.WaitGroup
+	pending := make(map[string]bool)
+	finished := false
+
+	// startEngine 登记将要执行的存储引擎
+	startEngine := func(engine string) {
+		pending[engine] = true
+		wg.Add(1)
+	}
+
+	// recordEngineResult 记录单个存储引擎的写入结果，取消后才完成的引擎结果不再记录
+	recordEngineResult := func(engine string, err error) {
+		result := models.StorageEngineResult{Engine: engine, Success: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+			result.Cancelled = storeCtx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		if finished {
+			return
+		}
+		delete(pending, engine)
+		engineResults = append(engineResults, result)
+	}
 
 	// 检查存储条件
 	timelineStorage := analysisResult.StorageRecommendations.TimelineStorage
-	shouldStoreTimeline := timelineStorage.ShouldStore || timelineStorage.TimelineTime == "now"
-	shouldStoreKnowledge := analysisResult.StorageRecommendations.KnowledgeGraphStorage.ShouldStore
-	shouldStoreVector := analysisResult.StorageRecommendations.VectorStorage.ShouldStore
+	plan := s.planSmartStorage(analysisResult)
+	shouldStoreTimeline, shouldStoreKnowledge, shouldStoreVector := plan.timeline, plan.knowledge, plan.vector
 
 	log.Printf("📊 [智能存储] 并行存储计划 - 时间线:%v, 知识图谱:%v, 向量:%v",
 		shouldStoreTimeline, shouldStoreKnowledge, shouldStoreVector)
 
+	// 在向量记录中记录计划写入的存储引擎，供会话统计使用；须在并行写入开始前设置
+	req.Metadata = withStorageEngines(req.Metadata, shouldStoreTimeline, shouldStoreKnowledge, shouldStoreVector)
+
 	// 1. 时间线存储 (并行)
 	if shouldStoreTimeline {
-		wg.Add(1)
+		startEngine(models.StorageEngineTimeline)
 		go func() {
 			defer wg.Done()
 			startTime := time.Now()
@@ -2089,14 +2404,13 @@ func (s *ContextService) executeSmartStorage(ctx context.Context, analysisResult
 				log.Printf("⏰ [并行-时间线] 执行时间线存储 (明确时间信息)")
 			}
 
-			if err := s.storeTimelineDataToTimescaleDB(ctx, analysisResult, req, memoryID); err != nil {
+			err := s.storeTimelineDataToTimescaleDB(storeCtx, analysisResult, req, memoryID)
+			if err != nil {
 				log.Printf("❌ [并行-时间线] 时间线存储失败: %v, 耗时: %v", err, time.Since(startTime))
-				mutex.Lock()
-				storageErrors = append(storageErrors, fmt.Errorf("时间线存储失败: %w", err))
-				mutex.Unlock()
 			} else {
 				log.Printf("✅ [并行-时间线] 时间线存储成功, 耗时: %v", time.Since(startTime))
 			}
+			recordEngineResult(models.StorageEngineTimeline, err)
 		}()
 	} else {
 		log.Printf("⏰ [智能存储] 跳过时间线存储: %s", timelineStorage.Reason)
@@ -2104,20 +2418,19 @@ func (s *ContextService) executeSmartStorage(ctx context.Context, analysisResult
 
 	// 2. 知识图谱存储 (并行)
 	if shouldStoreKnowledge {
-		wg.Add(1)
+		startEngine(models.StorageEngineKnowledgeGraph)
 		go func() {
 			defer wg.Done()
 			startTime := time.Now()
 
 			log.Printf("🕸️ [并行-知识图谱] 执行知识图谱存储")
-			if err := s.storeKnowledgeDataToNeo4j(ctx, analysisResult, req, memoryID); err != nil {
+			err := s.storeKnowledgeDataToNeo4j(storeCtx, analysisResult, req, memoryID)
+			if err != nil {
 				log.Printf("❌ [并行-知识图谱] 知识图谱存储失败: %v, 耗时: %v", err, time.Since(startTime))
-				mutex.Lock()
-				storageErrors = append(storageErrors, fmt.Errorf("知识图谱存储失败: %w", err))
-				mutex.Unlock()
 			} else {
 				log.Printf("✅ [并行-知识图谱] 知识图谱存储成功, 耗时: %v", time.Since(startTime))
 			}
+			recordEngineResult(models.StorageEngineKnowledgeGraph, err)
 		}()
 	} else {
 		log.Printf("🕸️ [智能存储] 跳过知识图谱存储: %s", analysisResult.StorageRecommendations.KnowledgeGraphStorage.Reason)
@@ -2125,20 +2438,19 @@ func (s *ContextService) executeSmartStorage(ctx context.Context, analysisResult
 
 	// 3. 多向量存储 (并行)
 	if shouldStoreVector {
-		wg.Add(1)
+		startEngine(models.StorageEngineVector)
 		go func() {
 			defer wg.Done()
 			startTime := time.Now()
 
 			log.Printf("🔍 [并行-向量] 执行多向量存储")
-			if err := s.storeMultiVectorData(analysisResult, req, memoryID); err != nil {
+			err := s.storeMultiVectorData(storeCtx, analysisResult, req, memoryID)
+			if err != nil {
 				log.Printf("❌ [并行-向量] 多向量存储失败: %v, 耗时: %v", err, time.Since(startTime))
-				mutex.Lock()
-				storageErrors = append(storageErrors, fmt.Errorf("多向量存储失败: %w", err))
-				mutex.Unlock()
 			} else {
 				log.Printf("✅ [并行-向量] 多向量存储成功, 耗时: %v", time.Since(startTime))
 			}
+			recordEngineResult(models.StorageEngineVector, err)
 		}()
 	} else {
 		log.Printf("🔍 [智能存储] 跳过多向量存储: %s", analysisResult.StorageRecommendations.VectorStorage.Reason)
@@ -2146,20 +2458,78 @@ func (s *ContextService) executeSmartStorage(ctx context.Context, analysisResult
 
 	// 等待所有并行存储完成
 	log.Printf("⏳ [智能存储] 等待所有并行存储完成...")
-	wg.Wait()
-	log.Printf("🏁 [智能存储] 所有并行存储已完成")
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Printf("🏁 [智能存储] 所有并行存储已完成")
+	case <-storeCtx.Done():
+		// 已完成的引擎保留原结果，未完成的记为已取消，后台写入结束后结果不再记录
+		mutex.Lock()
+		finished = true
+		for engine := range pending {
+			engineResults = append(engineResults, models.StorageEngineResult{
+				Engine:    engine,
+				Cancelled: true,
+				Error:     fmt.Sprintf("存储已取消: %v", storeCtx.Err()),
+			})
+		}
+		mutex.Unlock()
+		log.Printf("⚠️ [智能存储] 请求取消或存储超时，未完成的存储引擎记为已取消: %v", storeCtx.Err())
+	}
 
-	// 如果所有存储都失败，返回错误
-	if len(storageErrors) > 0 && len(storageErrors) == 3 {
-		return "", fmt.Errorf("所有存储引擎都失败: %v", storageErrors)
+	// 按固定顺序输出各引擎结果，不受并行完成顺序影响
+	sort.Slice(engineResults, func(i, j int) bool {
+		return storageEngineOrder(engineResults[i].Engine) < storageEngineOrder(engineResults[j].Engine)
+	})
+
+	// 执行的存储引擎全部失败时返回错误，部分失败时返回各引擎结果
+	var storageErrors []string
+	for _, result := range engineResults {
+		if !result.Success {
+			storageErrors = append(storageErrors, fmt.Sprintf("%s: %s", result.Engine, result.Error))
+		}
+	}
+	if len(engineResults) > 0 && len(storageErrors) == len(engineResults) {
+		if ctxErr := storeCtx.Err(); ctxErr != nil {
+			return storeOutcome{}, fmt.Errorf("所有存储引擎都失败: %v: %w", storageErrors, ctxErr)
+		}
+		return storeOutcome{}, fmt.Errorf("所有存储引擎都失败: %v", storageErrors)
+	}
+	if len(storageErrors) > 0 {
+		log.Printf("⚠️ [智能存储] 部分存储引擎失败，记忆ID: %s, 失败: %v", memoryID, storageErrors)
+		return storeOutcome{memoryID: memoryID, engineResults: engineResults}, nil
 	}
 
 	log.Printf("🎉 [智能存储] 智能存储完成，记忆ID: %s", memoryID)
-	return memoryID, nil
+	return storeOutcome{memoryID: memoryID, engineResults: engineResults}, nil
+}
+
+// smartStorageContext 为并行存储创建带超时的上下文，未配置超时时只继承请求上下文的取消
+func (s *ContextService) smartStorageContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.config != nil && s.config.SmartStorageTimeout > 0 {
+		return context.WithTimeout(ctx, s.config.SmartStorageTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// storageEngineOrder 存储引擎在结果中的排列顺序
+func storageEngineOrder(engine string) int {
+	switch engine {
+	case models.StorageEngineTimeline:
+		return 0
+	case models.StorageEngineKnowledgeGraph:
+		return 1
+	default:
+		return 2
+	}
 }
 
 // storeContextOnly 仅记录上下文（低置信度时使用）
-func (s *ContextService) storeContextOnly(analysisResult *models.SmartAnalysisResult, req models.StoreContextRequest, memoryID string) (string, error) {
+func (s *ContextService) storeContextOnly(ctx context.Context, analysisResult *models.SmartAnalysisResult, req models.StoreContextRequest, memoryID string) (storeOutcome, error) {
 	log.Printf("📝 [上下文记录] 开始记录上下文信息，置信度过低")
 
 	// 创建基础记忆对象，仅用于上下文记录
@@ -2184,31 +2554,63 @@ func (s *ContextService) storeContextOnly(analysisResult *models.SmartAnalysisRe
 	memory.Metadata["clarity_issues"] = analysisResult.ConfidenceAssessment.ClarityIssues
 	memory.Metadata["storage_reason"] = "置信度过低，仅记录上下文"
 
+	// 开启低置信度实体保留时，规则匹配抽取的高置信度实体随记录写入知识图谱
+	entities := s.contextOnlyEntities(analysisResult, req, memoryID)
+	if len(entities) > 0 {
+		memory.Metadata["salvaged_entities"] = len(entities)
+	}
+
 	// 🔥 修复：低置信度内容也需要生成基础向量才能存储
 	log.Printf("🔧 [上下文记录] 为低置信度内容生成基础向量")
 	vector, err := s.generateEmbedding(req.Content)
 	if err != nil {
 		log.Printf("❌ [上下文记录] 基础向量生成失败: %v", err)
-		return "", fmt.Errorf("基础向量生成失败: %w", err)
+		return storeOutcome{}, fmt.Errorf("基础向量生成失败: %w", err)
+	}
+
+	// 开启去重时，已有近似重复记忆则直接返回其ID
+	if req.Dedup {
+		if existingID, found := s.findDuplicateMemory(ctx, req, vector); found {
+			return storeOutcome{memoryID: existingID, deduplicated: true}, nil
+		}
 	}
 	memory.Vector = vector
 
 	// 存储到向量数据库
-	if err := s.storeMemory(memory); err != nil {
+	if err := s.storeMemoryWithRetry(ctx, memory); err != nil {
 		log.Printf("❌ [上下文记录] 上下文记录失败: %v", err)
-		return "", fmt.Errorf("上下文记录失败: %w", err)
+		return storeOutcome{}, fmt.Errorf("上下文记录失败: %w", err)
 	}
 
 	log.Printf("✅ [上下文记录] 上下文记录成功，等待后续完善: %s", memoryID)
-	return memoryID, nil
+	outcome := storeOutcome{memoryID: memoryID}
+	if len(entities) == 0 {
+		return outcome, nil
+	}
+	if !s.storageEngineUsable(engineNameNeo4j) {
+		log.Printf("🕸️ [上下文记录] 跳过保留实体写入: Neo4j %s", s.engines.get(engineNameNeo4j).State)
+		return outcome, nil
+	}
+
+	// 只写入实体，跳过不确定的关系推断；写入失败不影响已记录的上下文
+	storeCtx, cancel := s.smartStorageContext(ctx)
+	defer cancel()
+	err = s.storeContextOnlyEntities(storeCtx, entities, req, memoryID)
+	result := models.StorageEngineResult{Engine: models.StorageEngineKnowledgeGraph, Success: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+		log.Printf("❌ [上下文记录] 保留实体写入知识图谱失败: %v", err)
+	} else {
+		log.Printf("🕸️ [上下文记录] 低置信度内容保留实体 %d 个", len(entities))
+	}
+	outcome.engineResults = []models.StorageEngineResult{result}
+	return outcome, nil
 }
 
 // storeMultiVectorData 存储多向量数据（一条记录，多个向量字段）
-func (s *ContextService) storeMultiVectorData(analysisResult *models.SmartAnalysisResult, req models.StoreContextRequest, memoryID string) error {
+func (s *ContextService) storeMultiVectorData(ctx context.Context, analysisResult *models.SmartAnalysisResult, req models.StoreContextRequest, memoryID string) error {
 	log.Printf("🔍 [多向量存储] 开始处理多向量数据")
 
-	intentAnalysis := analysisResult.IntentAnalysis
-
 	// 创建基础记忆对象
 	memory := models.NewMemory(req.SessionID, req.Content, req.Priority, req.Metadata)
 	memory.ID = memoryID
@@ -2221,8 +2623,28 @@ func (s *ContextService) storeMultiVectorData(analysisResult *models.SmartAnalys
 		memory.UserID = req.UserID
 	}
 
+	vectorCount, err := s.attachMultiVectorData(memory, analysisResult)
+	if err != nil {
+		return err
+	}
+
+	// 存储到向量数据库（一条记录，多个向量字段）
+	if err := s.storeMemoryWithRetry(ctx, memory); err != nil {
+		return fmt.Errorf("多向量记忆存储失败: %w", err)
+	}
+
+	log.Printf("🎉 [多向量存储] 多向量数据存储完成，总计 %d 个维度", vectorCount)
+	return nil
+}
+
+// attachMultiVectorData 按分析结果启用的维度生成多向量数据写入记忆对象，主向量使用核心意图向量（不存在时依次使用领域上下文、场景向量）
+// 返回生成的维度数，一个维度都没有生成时返回错误
+func (s *ContextService) attachMultiVectorData(memory *models.Memory, analysisResult *models.SmartAnalysisResult) (int, error) {
+	intentAnalysis := analysisResult.IntentAnalysis
+
 	// 创建多向量数据对象
 	multiVectorData := &models.MultiVectorData{
+		Dimension:    s.EmbeddingDimension(),
 		QualityScore: analysisResult.ConfidenceAssessment,
 		CreatedAt:    time.Now(),
 		Metadata:     make(map[string]interface{}),
@@ -2239,6 +2661,9 @@ func (s *ContextService) storeMultiVectorData(analysisResult *models.SmartAnalys
 			if intentAnalysis.CoreIntentText != "" {
 				log.Printf("🔍 [多向量存储] 生成核心意图向量: %s", intentAnalysis.CoreIntentText)
 				vector, err := s.generateEmbedding(intentAnalysis.CoreIntentText)
+				if err == nil && !s.acceptsEmbeddingDimension(vector) {
+					err = fmt.Errorf("%w: 期望%d, 实际%d", ErrEmbeddingDimensionMismatch, multiVectorData.Dimension, len(vector))
+				}
 				if err == nil {
 					multiVectorData.CoreIntentVector = vector
 					multiVectorData.CoreIntentText = intentAnalysis.CoreIntentText
@@ -2253,6 +2678,9 @@ func (s *ContextService) storeMultiVectorData(analysisResult *models.SmartAnalys
 			if intentAnalysis.DomainContextText != "" {
 				log.Printf("🔍 [多向量存储] 生成领域上下文向量: %s", intentAnalysis.DomainContextText)
 				vector, err := s.generateEmbedding(intentAnalysis.DomainContextText)
+				if err == nil && !s.acceptsEmbeddingDimension(vector) {
+					err = fmt.Errorf("%w: 期望%d, 实际%d", ErrEmbeddingDimensionMismatch, multiVectorData.Dimension, len(vector))
+				}
 				if err == nil {
 					multiVectorData.DomainContextVector = vector
 					multiVectorData.DomainContextText = intentAnalysis.DomainContextText
@@ -2267,6 +2695,9 @@ func (s *ContextService) storeMultiVectorData(analysisResult *models.SmartAnalys
 			if intentAnalysis.ScenarioText != "" {
 				log.Printf("🔍 [多向量存储] 生成场景向量: %s", intentAnalysis.ScenarioText)
 				vector, err := s.generateEmbedding(intentAnalysis.ScenarioText)
+				if err == nil && !s.acceptsEmbeddingDimension(vector) {
+					err = fmt.Errorf("%w: 期望%d, 实际%d", ErrEmbeddingDimensionMismatch, multiVectorData.Dimension, len(vector))
+				}
 				if err == nil {
 					multiVectorData.ScenarioVector = vector
 					multiVectorData.ScenarioText = intentAnalysis.ScenarioText
@@ -2281,7 +2712,7 @@ func (s *ContextService) storeMultiVectorData(analysisResult *models.SmartAnalys
 	}
 
 	if vectorCount == 0 {
-		return fmt.Errorf("没有生成任何维度的向量")
+		return 0, fmt.Errorf("没有生成任何维度的向量")
 	}
 
 	// 设置多向量数据到记忆对象
@@ -2304,14 +2735,7 @@ func (s *ContextService) storeMultiVectorData(analysisResult *models.SmartAnalys
 	memory.Metadata["vector_count"] = vectorCount
 	memory.Metadata["enabled_dimensions"] = enabledDimensions
 	memory.Metadata["overall_confidence"] = analysisResult.ConfidenceAssessment.OverallConfidence
-
-	// 存储到向量数据库（一条记录，多个向量字段）
-	if err := s.storeMemory(memory); err != nil {
-		return fmt.Errorf("多向量记忆存储失败: %w", err)
-	}
-
-	log.Printf("🎉 [多向量存储] 多向量数据存储完成，总计 %d 个维度", vectorCount)
-	return nil
+	return vectorCount, nil
 }
 
 // storeTimelineDataToTimescaleDB 存储时间线数据到TimescaleDB
@@ -2324,16 +2748,16 @@ func (s *ContextService) storeTimelineDataToTimescaleDB(ctx context.Context, ana
 
 	if timelineTime == "now" || timelineTime == "" {
 		// 当前时间
-		eventTime = time.Now()
+		eventTime = s.now()
 		log.Printf("⏰ [时间处理] 使用当前时间: %s", eventTime.Format("2006-01-02 15:04:05"))
 	} else {
 		// 尝试解析具体时间（这里可以扩展更多时间格式的解析）
-		if parsedTime, err := parseTimeString(timelineTime); err == nil {
+		if parsedTime, err := parseTimeString(timelineTime, s.now()); err == nil {
 			eventTime = parsedTime
 			log.Printf("⏰ [时间处理] 解析时间成功: %s -> %s", timelineTime, eventTime.Format("2006-01-02 15:04:05"))
 		} else {
 			// 解析失败，使用当前时间
-			eventTime = time.Now()
+			eventTime = s.now()
 			log.Printf("⚠️ [时间处理] 时间解析失败，使用当前时间: %s", eventTime.Format("2006-01-02 15:04:05"))
 		}
 	}
@@ -2374,7 +2798,7 @@ func (s *ContextService) standardizeTimeFormat(rawTime string) string {
 		return "" // 空值保持原样
 	}
 
-	now := time.Now()
+	now := s.now()
 
 	// 🔥 处理相对时间表述，全部转换为具体日期格式
 	switch rawTime {
@@ -2410,8 +2834,8 @@ func (s *ContextService) standardizeTimeFormat(rawTime string) string {
 	}
 }
 
-// parseTimeString 解析时间字符串
-func parseTimeString(timeStr string) (time.Time, error) {
+// parseTimeString 解析时间字符串，相对时间词汇基于now计算
+func parseTimeString(timeStr string, now time.Time) (time.Time, error) {
 	// 支持的时间格式
 	formats := []string{
 		"2006-01-02 15:04:05",
@@ -2423,7 +2847,6 @@ func parseTimeString(timeStr string) (time.Time, error) {
 	}
 
 	// 处理相对时间词汇
-	now := time.Now()
 	switch timeStr {
 	case "昨天", "yesterday":
 		return now.AddDate(0, 0, -1), nil
@@ -2465,13 +2888,12 @@ func (s *ContextService) storeToRealTimescaleDB(ctx context.Context, timelineDat
 		return fmt.Errorf("❌ [真实TimescaleDB] TimescaleDB配置加载失败或未启用")
 	}
 
-	// 创建TimescaleDB引擎
-	timelineEngine, err := s.createTimescaleDBEngine(timescaleConfig)
+	// 获取复用的TimescaleDB引擎
+	timelineEngine, err := s.getTimelineEngine(ctx, timescaleConfig)
 	if err != nil {
-		log.Printf("❌ [真实TimescaleDB] 创建TimescaleDB引擎失败: %v", err)
-		return fmt.Errorf("创建TimescaleDB引擎失败: %w", err)
+		log.Printf("❌ [真实TimescaleDB] %v", err)
+		return err
 	}
-	defer timelineEngine.Close()
 
 	// 转换LLM分析结果为TimescaleDB事件
 	event, err := s.convertToTimelineEvent(timelineData, req, memoryID)
@@ -2491,30 +2913,34 @@ func (s *ContextService) storeToRealTimescaleDB(ctx context.Context, timelineDat
 	return nil
 }
 
-// getTimescaleDBConfig 获取TimescaleDB配置
+// getTimescaleDBConfig 获取TimescaleDB配置，未启用或配置不完整时返回nil，并记录引擎可用性（状态变化时才输出日志）
+// 只加载TimescaleDB自身的配置，Neo4j配置不完整不影响时间线存储
 func (s *ContextService) getTimescaleDBConfig() *timeline.TimescaleDBConfig {
-	// 使用统一配置管理器加载配置
-	dbConfig, err := config.LoadDatabaseConfig()
+	dbConfig, err := config.LoadTimescaleDBConfig()
 	if err != nil {
-		log.Printf("❌ 加载数据库配置失败: %v", err)
+		s.engines.set(engineNameTimescaleDB, models.EngineStateUnavailable, fmt.Sprintf("加载配置失败: %v", err), s.now())
 		return nil // 不提供降级方案，强制报错
 	}
 
-	if !dbConfig.TimescaleDB.Enabled {
-		log.Printf("⚠️ TimescaleDB未启用")
+	if !dbConfig.Enabled {
+		s.engines.set(engineNameTimescaleDB, models.EngineStateDisabled, "", s.now())
 		return nil
 	}
 
-	// 转换配置格式
+	return timescaleDBEngineConfig(dbConfig)
+}
+
+// timescaleDBEngineConfig 转换为TimescaleDB引擎的配置格式
+func timescaleDBEngineConfig(dbConfig *config.TimescaleDBConfig) *timeline.TimescaleDBConfig {
 	return &timeline.TimescaleDBConfig{
-		Host:        dbConfig.TimescaleDB.Host,
-		Port:        dbConfig.TimescaleDB.Port,
-		Database:    dbConfig.TimescaleDB.Database,
-		Username:    dbConfig.TimescaleDB.Username,
-		Password:    dbConfig.TimescaleDB.Password,
-		SSLMode:     dbConfig.TimescaleDB.SSLMode,
-		MaxConns:    dbConfig.TimescaleDB.MaxConns,
-		MaxIdleTime: dbConfig.TimescaleDB.MaxIdleTime,
+		Host:        dbConfig.Host,
+		Port:        dbConfig.Port,
+		Database:    dbConfig.Database,
+		Username:    dbConfig.Username,
+		Password:    dbConfig.Password,
+		SSLMode:     dbConfig.SSLMode,
+		MaxConns:    dbConfig.MaxConns,
+		MaxIdleTime: dbConfig.MaxIdleTime,
 	}
 }
 
@@ -2535,7 +2961,7 @@ func (s *ContextService) convertToTimelineEvent(timelineData map[string]interfac
 	title, summary := s.extractTitleSummary(req.Content, analysisResult)
 
 	// 🔥 确定事件类型 - 优先使用LLM判断的类型
-	eventType := "intent_based" // 默认类型
+	eventType := ""
 	if analysisResult != nil && analysisResult.StorageRecommendations != nil &&
 		analysisResult.StorageRecommendations.TimelineStorage != nil {
 		// 🔥 使用LLM分析的事件类型
@@ -2543,7 +2969,14 @@ func (s *ContextService) convertToTimelineEvent(timelineData map[string]interfac
 		if llmEventType != "" {
 			eventType = llmEventType
 			log.Printf("🏷️ [事件类型] 使用LLM判断的事件类型: %s", eventType)
+		}
+	}
+	if eventType == "" {
+		// LLM未返回事件类型时按内容语言的关键词规则判断，都未命中时使用默认类型
+		if eventType = ClassifyEventType(req.Content, req.Locale); eventType != "" {
+			log.Printf("🏷️ [事件类型] LLM未返回事件类型，按关键词判断: %s", eventType)
 		} else {
+			eventType = "intent_based"
 			log.Printf("⚠️ [事件类型] LLM未返回事件类型，使用默认: %s", eventType)
 		}
 	}
@@ -2662,6 +3095,13 @@ func (s *ContextService) simpleTitle(content string) string {
 func (s *ContextService) storeKnowledgeDataToNeo4j(ctx context.Context, analysisResult *models.SmartAnalysisResult, req models.StoreContextRequest, memoryID string) error {
 	log.Printf("🕸️ [Neo4j存储] 开始存储知识图谱数据")
 
+	// 概念和关系按用户记录归属，供知识图谱查询时隔离
+	if req.UserID == "" {
+		if userID, err := s.GetUserIDFromSessionID(req.SessionID); err == nil {
+			req.UserID = userID
+		}
+	}
+
 	// 构建知识图谱数据
 	knowledgeData := map[string]interface{}{
 		"session_id":    req.SessionID,
@@ -2684,14 +3124,16 @@ func (s *ContextService) storeToRealNeo4j(ctx context.Context, knowledgeData map
 
 	// 获取Neo4j配置
 	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		return fmt.Errorf("❌ [真实Neo4j] Neo4j配置加载失败或未启用")
+	}
 
-	// 创建Neo4j引擎
-	knowledgeEngine, err := s.createNeo4jEngine(neo4jConfig)
+	// 获取复用的Neo4j引擎
+	knowledgeEngine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
 	if err != nil {
-		log.Printf("❌ [真实Neo4j] 创建Neo4j引擎失败: %v", err)
-		return fmt.Errorf("创建Neo4j引擎失败: %w", err)
+		log.Printf("❌ [真实Neo4j] %v", err)
+		return err
 	}
-	defer knowledgeEngine.Close(ctx)
 
 	// 转换LLM分析结果为Neo4j概念和关系
 	concepts, relationships, err := s.convertToKnowledgeGraph(knowledgeData, req, memoryID)
@@ -2700,50 +3142,45 @@ func (s *ContextService) storeToRealNeo4j(ctx context.Context, knowledgeData map
 		return fmt.Errorf("转换知识图谱失败: %w", err)
 	}
 
-	// 存储概念到Neo4j
-	for _, concept := range concepts {
-		if err := knowledgeEngine.CreateConcept(ctx, concept); err != nil {
-			log.Printf("❌ [真实Neo4j] 存储概念失败: %v", err)
-			return fmt.Errorf("存储概念失败: %w", err)
-		}
-	}
-
-	// 存储关系到Neo4j
-	for _, relationship := range relationships {
-		if err := knowledgeEngine.CreateRelationship(ctx, relationship); err != nil {
-			log.Printf("❌ [真实Neo4j] 存储关系失败: %v", err)
-			return fmt.Errorf("存储关系失败: %w", err)
-		}
+	stats, err := mergeKnowledgeGraph(ctx, knowledgeEngine, concepts, relationships)
+	if err != nil {
+		log.Printf("❌ [真实Neo4j] %v", err)
+		return err
 	}
 
-	log.Printf("✅ [真实Neo4j] 知识图谱存储成功 - 概念: %d, 关系: %d, MemoryID: %s",
-		len(concepts), len(relationships), memoryID)
+	log.Printf("✅ [真实Neo4j] 知识图谱存储成功 - 概念: 新建%d/合并%d, 关系: 新建%d/合并%d/跳过%d, MemoryID: %s",
+		stats.ConceptsCreated, stats.ConceptsMerged,
+		stats.RelationshipsCreated, stats.RelationshipsMerged, stats.RelationshipsSkipped, memoryID)
 	return nil
 }
 
-// getNeo4jConfig 获取Neo4j配置
+// getNeo4jConfig 获取Neo4j配置，未启用或配置不完整时返回nil，并记录引擎可用性（状态变化时才输出日志）
+// 只加载Neo4j自身的配置，TimescaleDB配置不完整不影响知识图谱存储
 func (s *ContextService) getNeo4jConfig() *knowledge.Neo4jConfig {
-	// 使用统一配置管理器加载配置
-	dbConfig, err := config.LoadDatabaseConfig()
+	dbConfig, err := config.LoadNeo4jConfig()
 	if err != nil {
-		log.Printf("❌ 加载数据库配置失败: %v", err)
+		s.engines.set(engineNameNeo4j, models.EngineStateUnavailable, fmt.Sprintf("加载配置失败: %v", err), s.now())
 		return nil // 不提供降级方案，强制报错
 	}
 
-	if !dbConfig.Neo4j.Enabled {
-		log.Printf("⚠️ Neo4j未启用")
+	if !dbConfig.Enabled {
+		s.engines.set(engineNameNeo4j, models.EngineStateDisabled, "", s.now())
 		return nil
 	}
 
-	// 转换配置格式
+	return neo4jEngineConfig(dbConfig)
+}
+
+// neo4jEngineConfig 转换为Neo4j引擎的配置格式
+func neo4jEngineConfig(dbConfig *config.Neo4jConfig) *knowledge.Neo4jConfig {
 	return &knowledge.Neo4jConfig{
-		URI:                     dbConfig.Neo4j.URI,
-		Username:                dbConfig.Neo4j.Username,
-		Password:                dbConfig.Neo4j.Password,
-		Database:                dbConfig.Neo4j.Database,
-		MaxConnectionPoolSize:   dbConfig.Neo4j.MaxConnectionPoolSize,
-		ConnectionTimeout:       dbConfig.Neo4j.ConnectionTimeout,
-		MaxTransactionRetryTime: dbConfig.Neo4j.MaxTransactionRetryTime,
+		URI:                     dbConfig.URI,
+		Username:                dbConfig.Username,
+		Password:                dbConfig.Password,
+		Database:                dbConfig.Database,
+		MaxConnectionPoolSize:   dbConfig.MaxConnectionPoolSize,
+		ConnectionTimeout:       dbConfig.ConnectionTimeout,
+		MaxTransactionRetryTime: dbConfig.MaxTransactionRetryTime,
 	}
 }
 
@@ -3270,7 +3707,8 @@ func (s *ContextService) extractEntitiesFromText(text, dimension string, req mod
 	prompt := s.buildEntityExtractionPrompt(text, dimension, req.Content)
 
 	// 调用LLM进行实体抽取
-	llmClient, err := s.createStandardLLMClient(s.config.MultiDimLLMProvider, s.config.MultiDimLLMModel)
+	llmProvider, llmModel := s.sessionLLMConfig(req.SessionID)
+	llmClient, err := s.createStandardLLMClient(llmProvider, llmModel)
 	if err != nil {
 		return nil, fmt.Errorf("创建LLM客户端失败: %w", err)
 	}
@@ -3280,6 +3718,10 @@ func (s *ContextService) extractEntitiesFromText(text, dimension string, req mod
 		MaxTokens:   2000,
 		Temperature: 0.1, // 低温度确保结果稳定
 		Format:      "json",
+		Model:       llmModel,
+		Metadata: map[string]interface{}{
+			"task": "knowledge_entity_extraction",
+		},
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
@@ -3289,6 +3731,7 @@ func (s *ContextService) extractEntitiesFromText(text, dimension string, req mod
 	if err != nil {
 		return nil, fmt.Errorf("LLM实体抽取失败: %w", err)
 	}
+	s.recordLLMUsage(llmRequest, llmResponse)
 
 	// 解析LLM响应
 	entities, err := s.parseEntityExtractionResponse(llmResponse.Content, dimension, req, memoryID)
@@ -3507,7 +3950,8 @@ func (s *ContextService) buildKnowledgeRelationships(entities []*KnowledgeEntity
 	prompt := s.buildRelationshipExtractionPrompt(entities, analysisResult, req.Content)
 
 	// 调用LLM进行关系抽取
-	llmClient, err := s.createStandardLLMClient(s.config.MultiDimLLMProvider, s.config.MultiDimLLMModel)
+	llmProvider, llmModel := s.sessionLLMConfig(req.SessionID)
+	llmClient, err := s.createStandardLLMClient(llmProvider, llmModel)
 	if err != nil {
 		return nil, fmt.Errorf("创建LLM客户端失败: %w", err)
 	}
@@ -3517,6 +3961,10 @@ func (s *ContextService) buildKnowledgeRelationships(entities []*KnowledgeEntity
 		MaxTokens:   3000,
 		Temperature: 0.1,
 		Format:      "json",
+		Model:       llmModel,
+		Metadata: map[string]interface{}{
+			"task": "knowledge_relationship_extraction",
+		},
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
@@ -3526,6 +3974,7 @@ func (s *ContextService) buildKnowledgeRelationships(entities []*KnowledgeEntity
 	if err != nil {
 		return nil, fmt.Errorf("LLM关系抽取失败: %w", err)
 	}
+	s.recordLLMUsage(llmRequest, llmResponse)
 
 	// 解析关系响应
 	relationships, err := s.parseRelationshipExtractionResponse(llmResponse.Content, entities, req, memoryID)
@@ -3808,9 +4257,14 @@ func (s *ContextService) convertEntitiesToConcepts(entities []*KnowledgeEntity,
 			Category:    string(entity.Type),
 			Keywords:    entity.Keywords,
 			Importance:  entity.ConfidenceLevel,
+			UserID:      req.UserID,
+			MemoryID:    entity.MemoryID,
 			CreatedAt:   entity.CreatedAt,
 			UpdatedAt:   entity.CreatedAt,
 		}
+		if concept.MemoryID == "" {
+			concept.MemoryID = memoryID
+		}
 
 		// 将扩展信息编码到Description中 (因为Concept模型没有Properties字段)
 		concept.Description = fmt.Sprintf("%s实体，来源: %s维度，置信度: %.2f，记忆ID: %s",
@@ -3835,9 +4289,14 @@ func (s *ContextService) convertToNeo4jRelationships(relationships []*KnowledgeR
 			Type:        string(rel.RelationType),
 			Strength:    rel.Strength,
 			Description: fmt.Sprintf("关系: %s, 证据: %s", rel.RelationType, rel.EvidenceText[:min(100, len(rel.EvidenceText))]),
+			UserID:      req.UserID,
+			MemoryID:    rel.MemoryID,
 			CreatedAt:   rel.CreatedAt,
 			UpdatedAt:   rel.CreatedAt,
 		}
+		if neo4jRel.MemoryID == "" {
+			neo4jRel.MemoryID = memoryID
+		}
 
 		// 将扩展信息编码到Description中 (因为Relationship模型没有Properties字段)
 		evidenceText := rel.EvidenceText
@@ -4143,6 +4602,82 @@ func (s *ContextService) RetrieveContext(ctx context.Context, req models.Retriev
 		req.Limit = 2000 // 默认长度限制
 	}
 
+	// 时间范围与排序参数
+	if err := validateRetrieveTimeRange(req); err != nil {
+		return models.ContextResponse{}, err
+	}
+	if err := validateRetrieveGroupBy(req.GroupBy); err != nil {
+		return models.ContextResponse{}, err
+	}
+	collection, err := normalizeCollectionName(req.Collection)
+	if err != nil {
+		return models.ContextResponse{}, err
+	}
+	req.Collection = collection
+	// 分组基于结构化结果聚合
+	structured := req.Structured || req.GroupBy != ""
+
+	// 返回条数：topK优先于pageSize，超出上限时截断，保护向量存储
+	pageSize, err := resolveRetrievePageSize(req)
+	if err != nil {
+		return models.ContextResponse{}, err
+	}
+	req.PageSize = pageSize
+	if err := validateMaxTokens(req.MaxTokens); err != nil {
+		return models.ContextResponse{}, err
+	}
+
+	// 分页参数：多取一条用于判断是否还有下一页，偏移量在阈值过滤之后应用
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+	fetchLimit := req.Offset + req.PageSize + 1
+	// 按集合检索时多取候选，集合过滤在检索之后进行
+	if req.Collection != "" {
+		fetchLimit *= collectionFetchMultiplier
+	}
+	paginate := false
+
+	// 混合检索参数：向量得分权重
+	var hybridAlpha float64
+	var hybridScores map[string]models.HybridScore
+	if req.HybridSearch {
+		alpha, err := s.hybridAlpha(req)
+		if err != nil {
+			return models.ContextResponse{}, err
+		}
+		hybridAlpha = alpha
+		log.Printf("[上下文服务] 启用混合检索: alpha=%.2f", hybridAlpha)
+	}
+
+	// 优先级加权参数：优先级得分的权重
+	var priorityWeight float64
+	if req.PriorityBoost {
+		weight, err := s.priorityBoostWeight(req)
+		if err != nil {
+			return models.ContextResponse{}, err
+		}
+		priorityWeight = weight
+		log.Printf("[上下文服务] 启用优先级加权排序: weight=%.2f", priorityWeight)
+	}
+
+	// 时间衰减加权参数：时间衰减得分的权重和半衰期
+	var recencyWeight float64
+	var recencyHalfLife time.Duration
+	if req.RecencyBoost {
+		weight, err := s.recencyBoostWeight(req)
+		if err != nil {
+			return models.ContextResponse{}, err
+		}
+		halfLife, err := s.recencyHalfLife(req)
+		if err != nil {
+			return models.ContextResponse{}, err
+		}
+		recencyWeight, recencyHalfLife = weight, halfLife
+		log.Printf("[上下文服务] 启用时间衰减加权排序: weight=%.2f, halfLife=%s", recencyWeight, recencyHalfLife)
+	}
+	priorityWeight, recencyWeight = capBoostWeights(priorityWeight, recencyWeight)
+
 	// 获取会话状态
 	sessionState, err := s.sessionStore.GetSessionState(req.SessionID)
 	if err != nil {
@@ -4159,10 +4694,17 @@ func (s *ContextService) RetrieveContext(ctx context.Context, req models.Retriev
 
 	var searchResults []models.SearchResult
 	var relevantMemories []string
+	// 向量检索确定的用户ID，图谱扩展只在向量检索成功时进行
+	var graphUserID string
+	// 检索诊断信息，未开启explain时为nil
+	explainer := s.newRetrievalExplainer(req)
+	// 嵌入维度不一致提示，只在向量检索时检测
+	var embeddingDrift *models.EmbeddingDriftNotice
 
 	// 根据请求类型选择不同的检索方式
 	if req.MemoryID != "" {
 		// 使用记忆ID精确检索
+		explainer.setMode(models.ExplainModeMemoryID)
 		startTime := time.Now()
 		searchResults, err = s.searchByID(ctx, req.MemoryID, "id")
 		if err != nil {
@@ -4170,6 +4712,15 @@ func (s *ContextService) RetrieveContext(ctx context.Context, req models.Retriev
 		}
 		log.Printf("[上下文服务] 记忆ID检索耗时: %v", time.Since(startTime))
 
+		// 分块存储的父ID本身没有记录，未找到时或请求重组时尝试按分块重组
+		if req.AssembleChunks || len(searchResults) == 0 {
+			if assembled, err := s.AssembleChunkedMemory(ctx, req.MemoryID); err == nil {
+				searchResults = []models.SearchResult{*assembled}
+			} else if req.AssembleChunks {
+				log.Printf("⚠️ [上下文服务] 分块重组失败，返回原始检索结果: %v", err)
+			}
+		}
+
 		// 从搜索结果中提取会话ID
 		if len(searchResults) > 0 {
 			if sessionID, ok := searchResults[0].Fields["session_id"].(string); ok && sessionID != "" {
@@ -4195,6 +4746,7 @@ func (s *ContextService) RetrieveContext(ctx context.Context, req models.Retriev
 		}
 	} else if req.BatchID != "" {
 		// 使用批次ID检索 - 直接使用ID检索方式而不是filter
+		explainer.setMode(models.ExplainModeBatchID)
 		startTime := time.Now()
 		// 使用专门用于批次ID检索的方法
 		searchResults, err = s.searchByID(ctx, req.BatchID, "id")
@@ -4239,11 +4791,16 @@ func (s *ContextService) RetrieveContext(ctx context.Context, req models.Retriev
 		if err != nil {
 			log.Printf("⚠️ [上下文服务] 生成查询向量失败: %v，降级到会话ID检索", err)
 			// 降级到会话ID检索
-			searchResults, err = s.searchBySessionID(ctx, req.SessionID, req.Limit)
+			searchResults, err = s.searchBySessionID(ctx, req.SessionID, fetchLimit)
 			if err != nil {
 				return models.ContextResponse{}, fmt.Errorf("降级检索失败: %w", err)
 			}
 			log.Printf("[上下文服务] 降级检索耗时: %v", time.Since(startTime))
+			// 混合检索时降级结果仍按关键词得分排序
+			if req.HybridSearch {
+				searchResults, hybridScores = s.rankHybridResults(req.Query, nil, searchResults, hybridAlpha)
+			}
+			paginate = true
 		} else {
 			log.Printf("[上下文服务] 查询向量生成耗时: %v", time.Since(startTime))
 
@@ -4259,96 +4816,473 @@ func (s *ContextService) RetrieveContext(ctx context.Context, req models.Retriev
 			if req.IsBruteSearch > 0 {
 				options["is_brute_search"] = req.IsBruteSearch
 			}
+			options["limit"] = fetchLimit
+			// 混合检索需要更多向量候选用于重排序
+			if req.HybridSearch && fetchLimit < hybridVectorCandidateLimit {
+				options["limit"] = hybridVectorCandidateLimit
+			}
+			// 单次调用的相似度阈值，SkipThreshold为true时不生效
+			if req.SkipThreshold {
+				log.Printf("[上下文服务] 已跳过相似度阈值过滤")
+			} else if req.Threshold > 0 {
+				options["similarity_threshold"] = req.Threshold
+				log.Printf("[上下文服务] 使用本次调用指定的相似度阈值: %.4f", req.Threshold)
+			} else {
+				log.Printf("[上下文服务] 使用配置的相似度阈值")
+			}
 
-			//options["filter"] = "" // 覆盖默认的会话ID过滤器
 			// 🔥 修复：从会话ID获取用户ID，实现真正的多用户隔离
-			var filterConditions []string
-
-			// 从会话ID获取用户ID
 			userID, err := s.GetUserIDFromSessionID(req.SessionID)
 			if err != nil {
 				log.Printf("[上下文服务] 从会话获取用户ID失败: %v，为保护数据安全，拒绝执行搜索", err)
 				return models.ContextResponse{}, fmt.Errorf("安全错误: 从会话获取用户ID失败: %w", err)
 			}
-
-			if userID != "" {
-				filterConditions = append(filterConditions, fmt.Sprintf(`userId="%s"`, userID))
-				log.Printf("[上下文服务] 🔥 从会话%s获取用户ID: %s，添加过滤条件", req.SessionID, userID)
-			} else {
+			if userID == "" {
 				log.Printf("[上下文服务] 严重安全错误: 会话%s中未找到用户ID，为保护数据安全，拒绝执行搜索", req.SessionID)
-				return models.ContextResponse{}, fmt.Errorf("安全错误: 会话中未找到用户ID，拒绝执行搜索以防止数据泄露")
+				return models.ContextResponse{}, apperrors.ErrUserNotInitialized.WithMessagef("安全错误: 会话中未找到用户ID，拒绝执行搜索以防止数据泄露")
 			}
+			log.Printf("[上下文服务] 🔥 从会话%s获取用户ID: %s，添加过滤条件", req.SessionID, userID)
+
+			// 基于用户隔离数据的过滤条件，由向量存储编译为各自的过滤语法
+			filter := models.FilterEq(models.FilterFieldUserID, userID)
+			options["filter"] = filter
+			log.Printf("[上下文服务] 使用过滤条件: %s", filter)
+			explainer.setMode(models.ExplainModeVector)
+			explainer.setFilter(filter.String())
 
-			// 构建最终过滤器
-			if len(filterConditions) > 0 {
-				//基于用户隔离数据的开关
-				options["filter"] = strings.Join(filterConditions, " AND ")
-				log.Printf("[上下文服务] 使用过滤条件: %s", options["filter"])
+			// 时间范围过滤（unix秒），与用户过滤条件同时生效
+			if req.StartTime > 0 {
+				options["start_time"] = req.StartTime
+			}
+			if req.EndTime > 0 {
+				options["end_time"] = req.EndTime
 			}
 
-			searchResults, err = s.searchByVector(ctx, queryVector, "", options)
+			// 多维度向量检索只在存储支持多向量字段时生效，否则退回主向量检索
+			var multiVectorSearcher models.MultiVectorSearcher
+			if req.MultiVector {
+				if multiVectorSearcher = s.multiVectorSearcher(); multiVectorSearcher == nil {
+					log.Printf("⚠️ [上下文服务] 当前向量存储未启用多维度向量，multiVector参数不生效，使用主向量检索")
+				}
+			}
+			// 更换嵌入模型后查询向量与向量存储维度不一致时跳过向量检索，并提示重建向量
+			embeddingDrift = s.detectEmbeddingDrift(ctx, userID, len(queryVector))
+			skippedByDimension := 0
+			vectorSearch := func(options map[string]interface{}) ([]models.SearchResult, error) {
+				if embeddingDrift != nil {
+					return []models.SearchResult{}, nil
+				}
+				var results []models.SearchResult
+				var err error
+				if multiVectorSearcher != nil {
+					results, err = s.searchByMultiVector(ctx, multiVectorSearcher, queryVector, options)
+				} else {
+					results, err = s.searchByVector(ctx, queryVector, "", options)
+				}
+				if err != nil {
+					return nil, err
+				}
+				// 只与维度一致的向量比较相似度
+				results, skippedByDimension = filterByEmbeddingDimension(results, len(queryVector))
+				return results, nil
+			}
+			searchResults, err = vectorSearch(options)
 			if err != nil {
 				return models.ContextResponse{}, fmt.Errorf("向量搜索失败: %w", err)
 			}
+			if skippedByDimension > 0 {
+				log.Printf("⚠️ [上下文服务] 跳过%d条向量维度与查询向量(%d)不一致的记忆", skippedByDimension, len(queryVector))
+				embeddingDrift = s.newEmbeddingDriftNotice(len(queryVector), skippedByDimension)
+			}
 			log.Printf("[上下文服务] 向量搜索耗时: %v", time.Since(startTime))
+
+			// 检索诊断：再跳过阈值检索一次，区分未通过阈值的候选
+			if explainer != nil {
+				if req.SkipThreshold {
+					explainer.recordVectorCandidates(searchResults, nil)
+				} else {
+					unfiltered := make(map[string]interface{}, len(options)+1)
+					for key, value := range options {
+						unfiltered[key] = value
+					}
+					unfiltered["skip_threshold_filter"] = true
+					if allCandidates, err := vectorSearch(unfiltered); err != nil {
+						log.Printf("⚠️ [检索诊断] 跳过阈值的候选检索失败，只记录通过阈值的候选: %v", err)
+						explainer.recordVectorCandidates(searchResults, nil)
+					} else {
+						explainer.recordVectorCandidates(allCandidates, searchResults)
+					}
+				}
+			}
+
+			// 混合检索：在用户记录中按关键词匹配，与向量结果合并重排序
+			// 关键词候选使用与向量检索相同的用户和时间范围过滤条件
+			if req.HybridSearch {
+				keywordCandidates, err := s.searchKeywordCandidates(ctx, userID, req)
+				if err != nil {
+					log.Printf("⚠️ [上下文服务] 关键词候选检索失败，仅使用向量得分: %v", err)
+				}
+				vectorCount := len(searchResults)
+				searchResults, hybridScores = s.rankHybridResults(req.Query, searchResults, keywordCandidates, hybridAlpha)
+				log.Printf("[上下文服务] 混合检索完成: 向量候选=%d, 关键词候选=%d, 合并后=%d",
+					vectorCount, len(keywordCandidates), len(searchResults))
+			}
+			graphUserID = userID
+			paginate = true
 		}
 	} else {
 		// 如果既没有ID也没有查询关键词，则按会话ID检索
 		startTime := time.Now()
-		searchResults, err = s.searchBySessionID(ctx, req.SessionID, 10)
+		searchResults, err = s.searchBySessionID(ctx, req.SessionID, fetchLimit)
 		if err != nil {
 			return models.ContextResponse{}, fmt.Errorf("通过会话ID检索失败: %w", err)
 		}
 		log.Printf("[上下文服务] 会话ID检索耗时: %v", time.Since(startTime))
+		paginate = true
 	}
 
-	// 组装相关记忆内容 - 按相似度排序（余弦距离：越小越相似）
-	//TODO  这个排序逻辑 放到存储引擎层，放到不同的实现中，每个实现的逻辑不一样
-	/*sort.Slice(searchResults, func(i, j int) bool {
-		return searchResults[i].Score < searchResults[j].Score
-	})*/
-
-	for _, result := range searchResults {
-		if content, ok := result.Fields["content"].(string); ok {
-			// 添加相似度分数
-			formattedContent := fmt.Sprintf("[相似度:%.4f] %s", result.Score, content)
-			relevantMemories = append(relevantMemories, formattedContent)
+	// 已归档的记忆默认不参与检索（包括ID精确检索），请求includeArchived时保留
+	if !req.IncludeArchived {
+		var archivedCount int
+		if searchResults, archivedCount = excludeArchivedResults(searchResults); archivedCount > 0 {
+			log.Printf("[上下文服务] 排除%d条已归档的记忆", archivedCount)
 		}
 	}
 
-	// 构建响应
-	response := models.ContextResponse{
-		SessionState:      sessionState,
-		ShortTermMemory:   formatMemories(recentHistory, "最近对话"),
-		LongTermMemory:    formatMemories(relevantMemories, "相关历史"),
-		RelevantKnowledge: "", // V1版本暂不实现
+	// 指定集合时只保留该集合的记忆（包括ID精确检索）
+	if req.Collection != "" {
+		before := len(searchResults)
+		searchResults = filterResultsByCollection(searchResults, req.Collection)
+		log.Printf("[上下文服务] 集合过滤: collection=%s, %d -> %d 条", req.Collection, before, len(searchResults))
 	}
 
-	log.Printf("[上下文服务] 成功检索上下文，会话: %s, 短期记忆数: %d, 长期记忆数: %d",
-		req.SessionID, len(recentHistory), len(relevantMemories))
-	log.Printf("==================================================== 检索上下文完成 ====================================================")
-	return response, nil
-}
-
-// SummarizeContext 生成会话摘要
-func (s *ContextService) SummarizeContext(ctx context.Context, req models.SummarizeContextRequest) (string, error) {
-	// 获取会话历史
-	history, err := s.sessionStore.GetRecentHistory(req.SessionID, 20) // 获取更多历史用于摘要
-	if err != nil {
-		return "", fmt.Errorf("获取会话历史失败: %w", err)
+	// 时间范围过滤与按时间排序（ID精确检索不过滤）
+	if paginate && (req.StartTime > 0 || req.EndTime > 0) {
+		before := len(searchResults)
+		searchResults = filterResultsByTimeRange(searchResults, req.StartTime, req.EndTime)
+		log.Printf("[上下文服务] 时间范围过滤: [%d, %d], %d -> %d 条", req.StartTime, req.EndTime, before, len(searchResults))
 	}
 
-	if len(history) == 0 {
-		return "会话尚无内容", nil
+	// 优先级与时间衰减加权：相关性接近时P0/P1记忆和新近存储的记忆排在前面
+	if (req.PriorityBoost || req.RecencyBoost) && paginate && req.Query != "" {
+		boost := retrievalBoost{priorityWeight: priorityWeight, recencyWeight: recencyWeight, halfLife: recencyHalfLife, now: s.now()}
+		var adjustedScores, recencyScores map[string]float64
+		searchResults, adjustedScores, recencyScores = s.rankByBoost(searchResults, hybridScores, boost)
+		explainer.recordBoost(searchResults, boost, adjustedScores, recencyScores)
 	}
 
-	// V1版本简单实现: 直接返回历史记录数量和前几条内容的简单摘要
-	summary := fmt.Sprintf("会话包含%d条记录。", len(history))
+	explainer.recordRanking(searchResults, true)
 
-	// 添加最新几条记录的简单表示
-	maxPreview := 3
-	if len(history) < maxPreview {
-		maxPreview = len(history)
+	// LLM重排序：在分页前对前N条候选重新排序，失败时保持原顺序
+	var rerankScores map[string]models.RerankScore
+	rerank := req.Rerank && paginate && req.Query != ""
+	if rerank {
+		// 调用方已取消（如流式检索的客户端断开）时不再调用LLM
+		if err := ctx.Err(); err != nil {
+			return models.ContextResponse{}, err
+		}
+		notifyRetrievalCandidates(ctx, searchResults, req.Offset, req.PageSize)
+		reranked, scores, err := s.rerankSearchResults(ctx, req.Query, searchResults)
+		if err != nil {
+			log.Printf("⚠️ [上下文服务] LLM重排序失败，保持原顺序: %v", err)
+		} else {
+			searchResults, rerankScores = reranked, scores
+		}
+	}
+
+	// 默认按相似度排序，sortBy=time时按时间倒序
+	if paginate && req.SortBy == retrieveSortByTime {
+		sortResultsByTime(searchResults)
+	}
+	explainer.recordRanking(searchResults, false)
+	// 不重排序时此处已是最终顺序，流式检索不必等待图谱扩展和token预算即可发送候选
+	if paginate && !rerank {
+		notifyRetrievalCandidates(ctx, searchResults, req.Offset, req.PageSize)
+	}
+
+	// 应用分页（ID精确检索不分页）
+	hasMore := false
+	nextOffset := 0
+	if paginate {
+		searchResults, hasMore, nextOffset = paginateSearchResults(searchResults, req.Offset, req.PageSize)
+		log.Printf("[上下文服务] 分页: offset=%d, pageSize=%d, 本页=%d, hasMore=%v",
+			req.Offset, req.PageSize, len(searchResults), hasMore)
+	}
+
+	// 图谱扩展：以本页向量结果为起点追加知识图谱中的相关记忆，追加的记忆不计入分页
+	if req.GraphExpand && graphUserID != "" {
+		searchResults = s.expandResultsByGraph(ctx, graphUserID, searchResults, s.graphRelatedMemoryIDs)
+		if !req.IncludeArchived {
+			searchResults, _ = excludeArchivedResults(searchResults)
+		}
+		searchResults = filterResultsByCollection(searchResults, req.Collection)
+	}
+	explainer.recordFinal(searchResults, rerankScores != nil)
+
+	// 组装相关记忆内容 - 各向量存储已将得分统一为0-1相似度（越大越相似）并按相似度降序返回
+
+	var scoreBreakdown []models.HybridScore
+	var rerankBreakdown []models.RerankScore
+	var structuredResults []models.MemoryResult
+	var relevantIDs []string
+	for _, result := range searchResults {
+		if content, ok := result.Fields["content"].(string); ok {
+			relevantIDs = append(relevantIDs, result.ID)
+			// 结构化返回时得分放在结果对象中，不再拼接到内容前
+			if structured {
+				structuredResults = append(structuredResults, buildMemoryResult(result, content))
+			}
+
+			// 添加相似度分数
+			scoreLabel := fmt.Sprintf("相似度:%.4f", result.Score)
+			// 混合检索附带得分明细，便于排查排序
+			if score, ok := hybridScores[result.ID]; ok {
+				scoreLabel = fmt.Sprintf("混合:%.4f 向量:%.4f 关键词:%.4f",
+					score.HybridScore, score.VectorScore, score.KeywordScore)
+				scoreBreakdown = append(scoreBreakdown, score)
+			}
+			if score, ok := rerankScores[result.ID]; ok {
+				scoreLabel = fmt.Sprintf("重排:%.2f %s", score.Score, scoreLabel)
+				rerankBreakdown = append(rerankBreakdown, score)
+			}
+
+			if resultRetrievalSource(result) == models.RetrievalSourceGraph {
+				scoreLabel = "图谱扩展"
+			}
+
+			formattedContent := fmt.Sprintf("[%s] %s", scoreLabel, formatContentReference(result, content))
+			relevantMemories = append(relevantMemories, formattedContent)
+		}
+	}
+
+	// token预算：优先保留最新的短期记忆，再按排序保留相关历史，超出预算的截断或丢弃
+	var tokenBudget *models.TokenBudgetReport
+	if req.MaxTokens > 0 {
+		// 结构化返回时按结果content计算，文本返回时按带得分标签的拼接文本计算
+		longTerm := relevantMemories
+		if structured {
+			longTerm = make([]string, len(structuredResults))
+			for i, result := range structuredResults {
+				longTerm[i] = result.Content
+			}
+		}
+		var keptLong []string
+		var keptIndexes []int
+		recentHistory, keptLong, keptIndexes, tokenBudget = applyTokenBudget(req.MaxTokens, recentHistory, longTerm, relevantIDs)
+		if structured {
+			budgeted := make([]models.MemoryResult, 0, len(keptIndexes))
+			for i, index := range keptIndexes {
+				result := structuredResults[index]
+				result.Content = keptLong[i]
+				budgeted = append(budgeted, result)
+			}
+			structuredResults = budgeted
+		} else {
+			relevantMemories = keptLong
+		}
+		scoreBreakdown, rerankBreakdown = filterBudgetScores(tokenBudget, scoreBreakdown, rerankBreakdown)
+		log.Printf("[上下文服务] token预算: %d, 估算使用: %d, 保留=%d, 丢弃=%d",
+			req.MaxTokens, tokenBudget.UsedTokens, len(tokenBudget.Included), len(tokenBudget.Dropped))
+	}
+
+	// 构建响应
+	response := models.ContextResponse{
+		SessionState:      sessionState,
+		ShortTermMemory:   formatMemories(recentHistory, "最近对话"),
+		LongTermMemory:    formatMemories(relevantMemories, "相关历史"),
+		RelevantKnowledge: "", // V1版本暂不实现
+		HasMore:           hasMore,
+		NextOffset:        nextOffset,
+		ScoreBreakdown:    scoreBreakdown,
+		RerankScores:      rerankBreakdown,
+		TokenBudget:       tokenBudget,
+		Explain:           explainer.build(),
+		EmbeddingDrift:    embeddingDrift,
+	}
+	if req.GroupBy != "" {
+		response.LongTermMemory = ""
+		response.Groups = groupMemoryResults(structuredResults, req.GroupBy, s.sessionGroupSummary)
+		log.Printf("[上下文服务] 按%s分组: %d条记忆 -> %d组", req.GroupBy, len(structuredResults), len(response.Groups))
+	} else if req.Structured {
+		response.LongTermMemory = ""
+		response.Results = structuredResults
+	}
+
+	log.Printf("[上下文服务] 成功检索上下文，会话: %s, 短期记忆数: %d, 长期记忆数: %d",
+		req.SessionID, len(recentHistory), len(relevantMemories))
+	log.Printf("==================================================== 检索上下文完成 ====================================================")
+	return response, nil
+}
+
+// SummarizeContext 生成会话摘要
+// 优先使用摘要LLM生成自然语言摘要，未配置或调用失败时降级为启发式摘要；
+// 会话历史未变化时直接复用上次生成的摘要
+func (s *ContextService) SummarizeContext(ctx context.Context, req models.SummarizeContextRequest) (string, error) {
+	return s.summarizeContext(ctx, req, s.generateLLMSummary)
+}
+
+// summaryGenerator 根据会话历史按指定格式生成摘要
+type summaryGenerator func(ctx context.Context, sessionID string, history []string, format string) (string, error)
+
+// summarizeContext 使用generate生成会话摘要，失败时降级为启发式摘要
+func (s *ContextService) summarizeContext(ctx context.Context, req models.SummarizeContextRequest, generate summaryGenerator) (string, error) {
+	// 获取会话历史
+	history, err := s.sessionStore.GetRecentHistory(req.SessionID, 20) // 获取更多历史用于摘要
+	if err != nil {
+		return "", fmt.Errorf("获取会话历史失败: %w", err)
+	}
+
+	// 合并最近的对话消息，store_conversation写入的是消息而非历史记录
+	messages, _ := s.sessionStore.GetMessages(req.SessionID, 20)
+	for _, msg := range messages {
+		history = append(history, fmt.Sprintf("[%s] %s", msg.Role, msg.Content))
+	}
+
+	if len(history) == 0 {
+		return "会话尚无内容", nil
+	}
+
+	format := req.Format
+	if format != "bullet" {
+		format = "text"
+	}
+
+	// 历史未变化时复用缓存的摘要
+	summaryKey := buildSummaryKey(history, format)
+	if session, err := s.sessionStore.GetSession(req.SessionID); err == nil &&
+		session.Summary != "" && session.SummaryKey == summaryKey {
+		log.Printf("♻️ [会话摘要] 会话历史未变化，复用缓存摘要: %s", req.SessionID)
+		return session.Summary, nil
+	}
+
+	summary, err := generate(ctx, req.SessionID, history, format)
+	if err != nil {
+		log.Printf("⚠️ [会话摘要] LLM摘要失败，降级为启发式摘要: %v", err)
+		summary = s.GenerateEnhancedSummary(messages)
+		if summary == "" {
+			summary = buildNaiveSummary(history)
+		}
+		// 降级摘要不记录指纹，下次仍尝试使用LLM生成
+		summaryKey = ""
+	}
+
+	// 更新会话摘要
+	if err := s.sessionStore.UpdateSessionSummaryWithKey(req.SessionID, summary, summaryKey); err != nil {
+		log.Printf("[上下文服务] 警告: 更新会话摘要失败: %v", err)
+		// 继续执行，不返回错误
+	}
+
+	return summary, nil
+}
+
+// generateLLMSummary 调用摘要LLM生成会话摘要，客户端按提供商缓存在LLM工厂中
+func (s *ContextService) generateLLMSummary(ctx context.Context, sessionID string, history []string, format string) (string, error) {
+	llmProvider := s.config.SummaryLLMProvider
+	llmModel := s.config.SummaryLLMModel
+	if llmProvider == "" {
+		return "", fmt.Errorf("摘要LLM提供商未配置")
+	}
+
+	llmClient, err := s.createStandardLLMClient(llmProvider, llmModel)
+	if err != nil {
+		return "", fmt.Errorf("创建LLM客户端失败: %w", err)
+	}
+
+	formatInstruction := "用一段连贯的自然语言（不超过300字）概括"
+	if format == "bullet" {
+		formatInstruction = "用3-8条简洁的要点（每条以\"- \"开头）概括"
+	}
+
+	var historyText strings.Builder
+	for i, item := range history {
+		historyText.WriteString(fmt.Sprintf("%d. %s\n", i+1, item))
+	}
+
+	prompt := fmt.Sprintf(`以下是一个编程会话的历史记录（按时间顺序）：
+
+%s
+请%s该会话的主要内容，包括讨论的主题、做出的决策、已完成的工作和待解决的问题。
+只输出摘要本身，不要添加额外说明。`, historyText.String(), formatInstruction)
+
+	llmRequest := &llm.LLMRequest{
+		Prompt:      prompt,
+		MaxTokens:   800,
+		Temperature: 0.3,
+		Format:      "text",
+		Model:       llmModel,
+		Metadata: map[string]interface{}{
+			"task":       "session_summary",
+			"session_id": sessionID,
+		},
+	}
+
+	llmCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	log.Printf("🚀 [会话摘要] 调用LLM生成摘要，提供商: %s，模型: %s，历史条数: %d", llmProvider, llmModel, len(history))
+	llmResponse, err := llmClient.Complete(llmCtx, llmRequest)
+	if err != nil {
+		return "", fmt.Errorf("LLM API调用失败: %w", err)
+	}
+	s.recordLLMUsage(llmRequest, llmResponse)
+
+	summary := strings.TrimSpace(llmResponse.Content)
+	if summary == "" {
+		return "", fmt.Errorf("LLM返回空摘要")
+	}
+
+	log.Printf("✅ [会话摘要] LLM摘要生成完成，长度: %d，Token使用: %d", len(summary), llmResponse.TokensUsed)
+	return summary, nil
+}
+
+// 自动汇总时每条消息发送给摘要LLM的最大字符数
+const maxSummaryMessageRunes = 500
+
+// summarizeMessages 为自动汇总生成消息摘要，摘要LLM未配置或调用失败时使用启发式摘要
+func (s *ContextService) summarizeMessages(ctx context.Context, sessionID string, messages []*models.Message) string {
+	if len(messages) == 0 {
+		return ""
+	}
+	if s.config == nil || s.config.SummaryLLMProvider == "" {
+		return s.GenerateEnhancedSummary(messages)
+	}
+
+	history := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		content := []rune(msg.Content)
+		if len(content) > maxSummaryMessageRunes {
+			content = append(content[:maxSummaryMessageRunes], []rune("...")...)
+		}
+		history = append(history, fmt.Sprintf("[%s] %s", msg.Role, string(content)))
+	}
+
+	summary, err := s.generateLLMSummary(ctx, sessionID, history, "text")
+	if err != nil {
+		log.Printf("⚠️ [自动汇总] 会话 %s 的LLM摘要失败，降级为启发式摘要: %v", sessionID, err)
+		return s.GenerateEnhancedSummary(messages)
+	}
+	return summary
+}
+
+// buildSummaryKey 根据历史内容和摘要格式计算指纹
+func buildSummaryKey(history []string, format string) string {
+	hash := sha256.New()
+	hash.Write([]byte(format))
+	for _, item := range history {
+		hash.Write([]byte{0})
+		hash.Write([]byte(item))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// buildNaiveSummary 生成简单摘要：历史记录数量和最近几条内容
+func buildNaiveSummary(history []string) string {
+	summary := fmt.Sprintf("会话包含%d条记录。", len(history))
+
+	// 添加最新几条记录的简单表示
+	maxPreview := 3
+	if len(history) < maxPreview {
+		maxPreview = len(history)
 	}
 
 	recentItems := history[len(history)-maxPreview:]
@@ -4360,13 +5294,53 @@ func (s *ContextService) SummarizeContext(ctx context.Context, req models.Summar
 		summary += fmt.Sprintf("\n最近记录%d: %s", i+1, item)
 	}
 
-	// 更新会话摘要
-	if err := s.sessionStore.UpdateSessionSummary(req.SessionID, summary); err != nil {
-		log.Printf("[上下文服务] 警告: 更新会话摘要失败: %v", err)
-		// 继续执行，不返回错误
+	return summary
+}
+
+// 检索上下文默认和最多每页返回的记忆条数
+const (
+	defaultRetrievePageSize = 10
+	maxRetrievePageSize     = 100
+)
+
+// resolveRetrievePageSize 确定本次检索每页返回的记忆条数
+// topK和pageSize都表示返回条数，同时指定时必须一致；未指定时使用默认值，超过上限时截断
+func resolveRetrievePageSize(req models.RetrieveContextRequest) (int, error) {
+	if req.TopK < 0 {
+		return 0, apperrors.ErrInvalidArgument.WithMessagef("topK必须在1-%d之间: %d", maxRetrievePageSize, req.TopK)
+	}
+	if req.TopK > 0 && req.PageSize > 0 && req.TopK != req.PageSize {
+		return 0, apperrors.ErrInvalidArgument.WithMessagef("topK(%d)与pageSize(%d)不一致，只需指定其中一个", req.TopK, req.PageSize)
 	}
 
-	return summary, nil
+	pageSize := req.PageSize
+	if req.TopK > 0 {
+		pageSize = req.TopK
+	}
+	if pageSize <= 0 {
+		return defaultRetrievePageSize, nil
+	}
+	if pageSize > maxRetrievePageSize {
+		log.Printf("⚠️ [上下文服务] 返回条数%d超过上限，截断为%d", pageSize, maxRetrievePageSize)
+		return maxRetrievePageSize, nil
+	}
+	return pageSize, nil
+}
+
+// paginateSearchResults 对已完成阈值过滤的结果应用offset/pageSize分页
+// 调用方需多取一条结果（offset+pageSize+1），以便判断是否还有下一页
+func paginateSearchResults(results []models.SearchResult, offset, pageSize int) ([]models.SearchResult, bool, int) {
+	if offset >= len(results) {
+		return []models.SearchResult{}, false, offset
+	}
+
+	end := offset + pageSize
+	hasMore := len(results) > end
+	if end > len(results) {
+		end = len(results)
+	}
+
+	return results[offset:end], hasMore, end
 }
 
 // 格式化记忆列表为易读字符串
@@ -4400,6 +5374,8 @@ func (s *ContextService) StoreMessages(ctx context.Context, req models.StoreMess
 
 	start := time.Now()
 
+	messages := make([]*models.Message, 0, len(req.Messages))
+	contents := make([]string, 0, len(req.Messages))
 	for _, msgReq := range req.Messages {
 		// 创建新消息
 		message := models.NewMessage(
@@ -4410,16 +5386,31 @@ func (s *ContextService) StoreMessages(ctx context.Context, req models.StoreMess
 			msgReq.Priority,
 			msgReq.Metadata,
 		)
-
-		// 生成向量表示
-		vector, err := s.generateEmbedding(message.Content)
-		if err != nil {
-			return nil, fmt.Errorf("生成向量失败: %w", err)
+		// 图片消息的引用放在metadata.contentRef中，以说明文字生成向量
+		if message.ContentType == models.ContentTypeImage {
+			contentRef, _ := msgReq.Metadata[models.MetadataContentRefKey].(string)
+			caption, err := imageEmbeddingText(contentRef, msgReq.Content)
+			if err != nil {
+				return nil, err
+			}
+			message.Content = caption
+			message.Metadata = withContentReference(msgReq.Metadata, models.ContentTypeImage, strings.TrimSpace(contentRef))
 		}
-		message.Vector = vector
+		messages = append(messages, message)
+		contents = append(contents, message.Content)
+	}
+
+	// 生成向量表示，嵌入服务支持时合并为批量请求
+	vectors, err := s.generateEmbeddings(contents)
+	if err != nil {
+		return nil, fmt.Errorf("生成向量失败: %w", err)
+	}
+
+	for i, message := range messages {
+		message.Vector = vectors[i]
 
 		// 存储消息
-		if err := s.vectorService.StoreMessage(message); err != nil {
+		if err := s.storeMessage(message); err != nil {
 			return nil, fmt.Errorf("存储消息失败: %w", err)
 		}
 
@@ -4519,29 +5510,21 @@ func (s *ContextService) RetrieveConversation(ctx context.Context, req models.Re
 		searchStart := time.Now()
 
 		// 🔥 修复：从会话ID获取用户ID，实现真正的多用户隔离
-		var filterConditions []string
-
-		// 从会话ID获取用户ID
 		userID, err := s.GetUserIDFromSessionID(req.SessionID)
 		if err != nil {
 			log.Printf("[上下文服务] 从会话获取用户ID失败: %v，为保护数据安全，拒绝执行搜索", err)
 			return nil, fmt.Errorf("安全错误: 从会话获取用户ID失败: %w", err)
 		}
-
-		if userID != "" {
-			filterConditions = append(filterConditions, fmt.Sprintf(`userId="%s"`, userID))
-			log.Printf("[上下文服务] 🔥 从会话%s获取用户ID: %s，添加过滤条件", req.SessionID, userID)
-		} else {
+		if userID == "" {
 			log.Printf("[上下文服务] 严重安全错误: 会话%s中未找到用户ID，为保护数据安全，拒绝执行搜索", req.SessionID)
-			return nil, fmt.Errorf("安全错误: 会话中未找到用户ID，拒绝执行搜索以防止数据泄露")
+			return nil, apperrors.ErrUserNotInitialized.WithMessagef("安全错误: 会话中未找到用户ID，拒绝执行搜索以防止数据泄露")
 		}
+		log.Printf("[上下文服务] 🔥 从会话%s获取用户ID: %s，添加过滤条件", req.SessionID, userID)
 
-		// 构建最终过滤器
-		if len(filterConditions) > 0 {
-			//基于用户隔离数据的开关
-			options["filter"] = strings.Join(filterConditions, " AND ")
-			log.Printf("[上下文服务] 使用过滤条件: %s", options["filter"])
-		}
+		// 基于用户隔离数据的过滤条件，由向量存储编译为各自的过滤语法
+		filter := models.FilterEq(models.FilterFieldUserID, userID)
+		options["filter"] = filter
+		log.Printf("[上下文服务] 使用过滤条件: %s", filter)
 
 		results, err := s.searchByVector(ctx, vector, req.SessionID, options)
 		if err != nil {
@@ -4564,6 +5547,11 @@ func (s *ContextService) RetrieveConversation(ctx context.Context, req models.Re
 		}
 	}
 
+	// 已归档的记录默认不返回
+	if !req.IncludeArchived {
+		searchResults, _ = excludeArchivedResults(searchResults)
+	}
+
 	// 构造消息对象
 	for _, result := range searchResults {
 		message := resultToMessage(result)
@@ -4745,6 +5733,15 @@ func (s *ContextService) StoreSessionMessages(ctx context.Context, req models.St
 		return nil, fmt.Errorf("存储消息失败: %w", err)
 	}
 
+	// 会话消息数超过上限时异步归档最旧的消息，不阻塞本次写入
+	if s.config != nil && s.config.SessionMaxMessages > 0 {
+		go func() {
+			if _, err := s.archiveSessionOverflow(context.WithoutCancel(ctx), userSessionStore, req.SessionID, s.config.SessionMaxMessages); err != nil {
+				log.Printf("⚠️ [消息归档] 会话 %s 归档超限消息失败: %v", req.SessionID, err)
+			}
+		}()
+	}
+
 	// 收集消息ID
 	messageIDs := make([]string, len(messages))
 	for i, msg := range messages {
@@ -4821,6 +5818,204 @@ func (s *ContextService) StoreSessionMessages(ctx context.Context, req models.St
 	return response, nil
 }
 
+// BatchStoreConversation 批量存储多个对话批次
+// 先构建全部消息并生成向量，再逐批写入；任一批次失败时回滚已写入的向量，保证全部成功或全部不生效
+// 批次ID已被已有记录使用时拒绝整个请求，回滚只会删除本次写入的记录
+func (s *ContextService) BatchStoreConversation(ctx context.Context, req models.BatchStoreConversationRequest) (*models.BatchStoreConversationResponse, error) {
+	log.Printf("[批量存储对话] 开始: 会话ID=%s, 批次数=%d", req.SessionID, len(req.Batches))
+
+	if len(req.Batches) == 0 {
+		return nil, fmt.Errorf("batches不能为空")
+	}
+
+	response := &models.BatchStoreConversationResponse{
+		Batches: make([]*models.BatchStoreResult, 0, len(req.Batches)),
+	}
+
+	// 第一阶段：构建全部消息对象，校验批次ID唯一
+	seenBatchIDs := make(map[string]bool)
+	baseBatchID := models.GenerateMemoryID("")
+	for i, batch := range req.Batches {
+		batchID := batch.BatchID
+		if batchID == "" {
+			// 同一秒内生成的ID相同，按 {memoryID}-{index} 格式区分
+			batchID = fmt.Sprintf("%s-%d", baseBatchID, i+1)
+		}
+
+		result := &models.BatchStoreResult{BatchID: batchID, Status: "pending"}
+		response.Batches = append(response.Batches, result)
+
+		if seenBatchIDs[batchID] {
+			result.Status = "failed"
+			result.Error = "批次ID重复"
+			response.Error = fmt.Sprintf("批次ID重复: %s", batchID)
+			continue
+		}
+		seenBatchIDs[batchID] = true
+
+		// 阿里云以batchId作为主键，沿用已存在的批次ID会覆盖已有记录，回滚时还会将其删除
+		inUse, err := s.batchIDInUse(ctx, batchID)
+		if err != nil || inUse {
+			result.Status = "failed"
+			result.Error = "批次ID已存在"
+			if err != nil {
+				result.Error = fmt.Sprintf("检查批次ID失败: %v", err)
+			}
+			response.Error = fmt.Sprintf("批次%s: %s", batchID, result.Error)
+			continue
+		}
+
+		for _, msg := range batch.Messages {
+			if msg.Role == "" || msg.Content == "" {
+				continue
+			}
+
+			metadata := map[string]interface{}{
+				"batchId":   batchID,
+				"timestamp": time.Now().Unix(),
+				"type":      "conversation_message",
+			}
+			result.Messages = append(result.Messages, models.NewMessage(req.SessionID, msg.Role, msg.Content, "text", "P2", metadata))
+		}
+
+		if len(result.Messages) == 0 {
+			result.Status = "failed"
+			result.Error = "没有有效的消息可存储"
+			response.Error = fmt.Sprintf("批次%s没有有效的消息", batchID)
+		}
+	}
+
+	if response.Error != "" {
+		markBatchesSkipped(response.Batches)
+		return response, nil
+	}
+
+	// 第二阶段：生成全部向量，此时尚未写入任何数据
+	for _, result := range response.Batches {
+		contents := make([]string, len(result.Messages))
+		for i, message := range result.Messages {
+			contents[i] = message.Content
+		}
+		vectors, err := s.generateEmbeddings(contents)
+		if err != nil {
+			result.Status = "failed"
+			result.Error = fmt.Sprintf("生成向量失败: %v", err)
+			response.Error = result.Error
+			markBatchesSkipped(response.Batches)
+			return response, nil
+		}
+		for i, message := range result.Messages {
+			message.Vector = vectors[i]
+		}
+	}
+
+	// 第三阶段：逐批写入向量存储，记录已写入的ID用于回滚
+	var storedIDs []string
+	storedSet := make(map[string]bool)
+	var failed *models.BatchStoreResult
+	for _, result := range response.Batches {
+		for _, message := range result.Messages {
+			if err := s.storeMessage(message); err != nil {
+				result.Status = "failed"
+				result.Error = fmt.Sprintf("存储消息失败: %v", err)
+				failed = result
+				break
+			}
+			// 阿里云以batchId作为主键，Vearch以消息ID作为主键，回滚时两者都删除
+			for _, id := range []string{message.ID, result.BatchID} {
+				if !storedSet[id] {
+					storedSet[id] = true
+					storedIDs = append(storedIDs, id)
+				}
+			}
+			result.MessageIDs = append(result.MessageIDs, message.ID)
+		}
+		if failed != nil {
+			break
+		}
+		result.Status = "stored"
+	}
+
+	// 第四阶段：写入用户会话存储（短期记忆）
+	if failed == nil {
+		userSessionStore, err := s.GetUserSessionStore(req.UserID)
+		if err != nil {
+			failed = response.Batches[len(response.Batches)-1]
+			failed.Error = fmt.Sprintf("获取用户会话存储失败: %v", err)
+		} else {
+			var allMessages []*models.Message
+			for _, result := range response.Batches {
+				allMessages = append(allMessages, result.Messages...)
+			}
+			if err := userSessionStore.StoreMessages(req.SessionID, allMessages); err != nil {
+				failed = response.Batches[len(response.Batches)-1]
+				failed.Error = fmt.Sprintf("存储会话消息失败: %v", err)
+			}
+		}
+	}
+
+	if failed != nil {
+		response.Error = fmt.Sprintf("批次%s存储失败: %s", failed.BatchID, failed.Error)
+		log.Printf("❌ [批量存储对话] %s，开始回滚 %d 条向量记录", response.Error, len(storedIDs))
+
+		rollbackStatus := "rolled_back"
+		if len(storedIDs) > 0 {
+			if err := s.deleteMemories(ctx, storedIDs); err != nil {
+				log.Printf("❌ [批量存储对话] 回滚失败: %v", err)
+				rollbackStatus = "rollback_failed"
+				response.Error += fmt.Sprintf("; 回滚失败: %v", err)
+			}
+		}
+
+		for _, result := range response.Batches {
+			switch {
+			case result == failed:
+				result.Status = "failed"
+			case result.Status == "stored":
+				result.Status = rollbackStatus
+			default:
+				result.Status = "skipped"
+			}
+			result.MessageIDs = nil
+		}
+		return response, nil
+	}
+
+	for _, result := range response.Batches {
+		result.Status = "committed"
+	}
+	response.Committed = true
+
+	log.Printf("✅ [批量存储对话] 提交成功: 会话ID=%s, 批次数=%d", req.SessionID, len(response.Batches))
+	return response, nil
+}
+
+// batchIDInUse 批次ID是否已被向量存储中的记录使用（作为主键或记录的batchId）
+func (s *ContextService) batchIDInUse(ctx context.Context, batchID string) (bool, error) {
+	if s.vectorStore == nil && s.vectorService == nil {
+		return false, nil
+	}
+	results, err := s.searchByID(ctx, batchID, "id")
+	if err != nil {
+		return false, err
+	}
+	for _, result := range results {
+		if result.ID == batchID || parseResultMetadata(result)["batchId"] == batchID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// markBatchesSkipped 将尚未处理的批次标记为跳过
+func markBatchesSkipped(results []*models.BatchStoreResult) {
+	for _, result := range results {
+		if result.Status == "pending" {
+			result.Status = "skipped"
+		}
+	}
+}
+
 // GenerateMessagesSummary 生成消息摘要
 func (s *ContextService) GenerateMessagesSummary(messages []*models.Message) string {
 	// 简单实现：连接所有消息内容
@@ -4849,6 +6044,9 @@ func (s *ContextService) GenerateMessagesSummary(messages []*models.Message) str
 
 // AssociateCodeFile 关联代码文件到会话
 func (s *ContextService) AssociateCodeFile(ctx context.Context, req models.MCPCodeAssociationRequest) error {
+	// 未指定语言时按扩展名和内容推断，推断结果写入会话代码上下文并用于特征提取
+	req.Language = s.resolveCodeLanguage(req.FilePath, req.Content, req.Language)
+
 	log.Printf("[上下文服务] 关联代码文件: 会话ID=%s, 文件路径=%s, 语言=%s",
 		req.SessionID, req.FilePath, req.Language)
 
@@ -4933,7 +6131,7 @@ func (s *ContextService) establishCodeContextLinks(ctx context.Context, sessionI
 	}
 
 	if userID != "" {
-		options["filter"] = fmt.Sprintf(`userId="%s"`, userID)
+		options["filter"] = models.FilterEq(models.FilterFieldUserID, userID)
 		log.Printf("[上下文服务] 🔥 从会话%s获取用户ID: %s，添加过滤条件", sessionID, userID)
 	}
 
@@ -4946,7 +6144,7 @@ func (s *ContextService) establishCodeContextLinks(ctx context.Context, sessionI
 	// 4. 处理搜索结果，建立双向引用
 	var relatedDiscussions []models.DiscussionRef
 	for _, result := range searchResults {
-		if result.Score > 0.7 { // 过滤掉相关性较低的结果
+		if result.Score < 0.3 { // 过滤掉相关性较低的结果
 			continue
 		}
 
@@ -4976,7 +6174,7 @@ func (s *ContextService) establishCodeContextLinks(ctx context.Context, sessionI
 			Type:      resultType,
 			Summary:   content,
 			Timestamp: time.Now().Unix(),
-			Relevance: 1.0 - result.Score, // 转换相似度为相关度
+			Relevance: result.Score,
 		}
 
 		relatedDiscussions = append(relatedDiscussions, discussion)
@@ -5078,6 +6276,15 @@ func extractCodeFeatures(codeContent string, language string) []string {
 			}
 		}
 
+	case "rust", "rs":
+		features = appendCodeFeatureMatches(features, cleanCode, rustFeaturePatterns)
+
+	case "csharp", "c#", "cs":
+		features = appendCodeFeatureMatches(features, cleanCode, csharpFeaturePatterns)
+
+	case "kotlin", "kt", "kts":
+		features = appendCodeFeatureMatches(features, cleanCode, kotlinFeaturePatterns)
+
 	default:
 		// 通用提取标识符的策略
 		// 提取可能的函数名（大驼峰命名的标识符）
@@ -5097,18 +6304,71 @@ func extractCodeFeatures(codeContent string, language string) []string {
 	return uniqueStrings(features)
 }
 
+// Rust、C#、Kotlin的标识符提取规则，标识符位于第一个捕获组
+var (
+	rustFeaturePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\bfn\s+(\w+)`),
+		regexp.MustCompile(`\b(?:struct|enum|union|trait|type)\s+(\w+)`),
+		regexp.MustCompile(`\bimpl(?:\s*<[^>{]*>)?\s+(?:\w+::)*(\w+)`), // impl Type 或 impl Trait for Type 中的Trait
+		regexp.MustCompile(`\bimpl\b[^{;]*?\bfor\s+(?:\w+::)*(\w+)`),   // impl Trait for Type 中的Type
+		regexp.MustCompile(`\bmod\s+(\w+)`),
+	}
+	csharpFeaturePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\bnamespace\s+([\w.]+)`),
+		regexp.MustCompile(`\b(?:class|interface|struct|enum|record(?:\s+(?:class|struct))?)\s+(\w+)`),
+		// 带访问或声明修饰符的方法和构造函数
+		regexp.MustCompile(`(?m)^\s*(?:(?:public|private|protected|internal|static|virtual|override|abstract|async|sealed|extern|unsafe|partial|new)\s+)+(?:[\w<>\[\].?]+(?:,\s*[\w<>\[\].?]+)*\s+)?(\w+)\s*(?:<[^>()]*>)?\s*\(`),
+	}
+	kotlinFeaturePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\bpackage\s+([\w.]+)`),
+		regexp.MustCompile(`\bfun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?(\w+)\s*\(`), // 含泛型函数和扩展函数
+		regexp.MustCompile(`\b(?:class|interface|object|typealias)\s+(\w+)`),
+	}
+)
+
+// appendCodeFeatureMatches 按规则提取第一个捕获组中的标识符
+func appendCodeFeatureMatches(features []string, code string, patterns []*regexp.Regexp) []string {
+	for _, pattern := range patterns {
+		for _, match := range pattern.FindAllStringSubmatch(code, -1) {
+			if len(match) > 1 && match[1] != "" {
+				features = append(features, match[1])
+			}
+		}
+	}
+	return features
+}
+
+// 各语言特有的字符串字面量：Rust原始字符串、C#逐字字符串和原始字符串、Kotlin三引号字符串
+var languageStringLiterals = map[string]*regexp.Regexp{
+	"rust":   regexp.MustCompile(`\br#*"[\s\S]*?"#*`),
+	"csharp": regexp.MustCompile(`"""[\s\S]*?"""|@"(?:[^"]|"")*"`),
+	"kotlin": regexp.MustCompile(`"""[\s\S]*?"""`),
+}
+
+// 语言别名，与extractCodeFeatures中的分支保持一致
+var languageStringLiteralAliases = map[string]string{
+	"rs": "rust", "c#": "csharp", "cs": "csharp", "kt": "kotlin", "kts": "kotlin",
+}
+
 // removeCommentsAndStrings 移除代码中的注释和字符串常量
+// 先替换字符串，避免字符串中的//或/*被当作注释
 func removeCommentsAndStrings(code string, language string) string {
-	// 简化实现
 	// 去除单行注释
-	singleLineComment := regexp.MustCompile(`//.*$`)
+	singleLineComment := regexp.MustCompile(`(?m)//.*$`)
 	multiLineComment := regexp.MustCompile(`/\*[\s\S]*?\*/`)
-	stringLiteral := regexp.MustCompile(`"[^"]*"`)
+	stringLiteral := regexp.MustCompile(`"(?:[^"\\\n]|\\.)*"`)
 
 	result := code
-	result = singleLineComment.ReplaceAllString(result, "")
-	result = multiLineComment.ReplaceAllString(result, "")
+	language = strings.ToLower(language)
+	if alias, ok := languageStringLiteralAliases[language]; ok {
+		language = alias
+	}
+	if literal, ok := languageStringLiterals[language]; ok {
+		result = literal.ReplaceAllString(result, `""`)
+	}
 	result = stringLiteral.ReplaceAllString(result, `""`)
+	result = multiLineComment.ReplaceAllString(result, "")
+	result = singleLineComment.ReplaceAllString(result, "")
 
 	return result
 }
@@ -5202,9 +6462,82 @@ func (s *ContextService) GetShortTermMemory(ctx context.Context, sessionID strin
 	return result.String(), nil
 }
 
+// SetSessionPinned 设置会话置顶状态，置顶会话不会被不活跃清理归档
+// 会话可能同时存在于用户存储和全局存储，清理任务作用于全局存储，因此两处都更新
+func (s *ContextService) SetSessionPinned(userID, sessionID string, pinned bool) error {
+	if userID == "" {
+		return fmt.Errorf("用户ID不能为空")
+	}
+	if sessionID == "" {
+		return fmt.Errorf("会话ID不能为空")
+	}
+
+	userSessionStore, err := s.GetUserSessionStore(userID)
+	if err != nil {
+		return fmt.Errorf("获取用户会话存储失败: %w", err)
+	}
+
+	updated := false
+	for _, sessionStore := range []*store.SessionStore{userSessionStore, s.sessionStore} {
+		if sessionStore == nil {
+			continue
+		}
+		session, err := sessionStore.GetSessionSnapshot(sessionID)
+		if err != nil {
+			continue
+		}
+		if ownerID, _ := session.Metadata["userId"].(string); ownerID != "" && ownerID != userID {
+			return fmt.Errorf("无权修改其他用户的会话: %s", sessionID)
+		}
+		if err := sessionStore.SetSessionPinned(sessionID, pinned); err != nil {
+			return err
+		}
+		updated = true
+	}
+
+	if !updated {
+		return apperrors.ErrSessionNotFound.WithMessagef("会话不存在: %s", sessionID)
+	}
+	log.Printf("[上下文服务] 会话置顶状态已更新: sessionID=%s, userID=%s, pinned=%v", sessionID, userID, pinned)
+	return nil
+}
+
+// retainSessionWithP0Memory 会话最新一条记忆为P0时保留会话，供不活跃会话清理使用
+func (s *ContextService) retainSessionWithP0Memory(ctx context.Context) store.SessionRetainFunc {
+	return func(sessionID string) string {
+		results, err := s.searchBySessionID(ctx, sessionID, 100)
+		if err != nil {
+			// 查询失败时保守处理，保留会话等待下次清理
+			return fmt.Sprintf("查询会话记忆失败，暂不清理: %v", err)
+		}
+
+		var latest *models.SearchResult
+		var latestTimestamp float64
+		for i := range results {
+			// 跳过对话消息，只看记忆
+			if _, isMessage := results[i].Fields["role"]; isMessage {
+				continue
+			}
+			timestamp, _ := results[i].Fields["timestamp"].(float64)
+			if latest == nil || timestamp > latestTimestamp {
+				latest = &results[i]
+				latestTimestamp = timestamp
+			}
+		}
+
+		if latest == nil {
+			return ""
+		}
+		if priority, _ := latest.Fields["priority"].(string); priority == models.PriorityP0 {
+			return fmt.Sprintf("最新记忆 %s 优先级为P0", latest.ID)
+		}
+		return ""
+	}
+}
+
 // StartSessionCleanupTask 启动会话清理定时任务
 func (s *ContextService) StartSessionCleanupTask(ctx context.Context, timeout time.Duration, interval time.Duration) {
-	log.Printf("[上下文服务] 启动会话清理任务: 超时=%v, 间隔=%v", timeout, interval)
+	log.Printf("[上下文服务] 启动会话清理任务: 超时=%v, 间隔=%v, 演练模式=%v", timeout, interval, s.config.CleanupDryRun)
 
 	// 启动一个定时器，定期执行清理和汇总任务
 	ticker := time.NewTicker(interval)
@@ -5216,25 +6549,38 @@ func (s *ContextService) StartSessionCleanupTask(ctx context.Context, timeout ti
 
 	log.Printf("[上下文服务] 自动汇总任务已启动，间隔=%v", summaryInterval)
 
+	// 配置了保留策略时按更长的间隔清理过期记忆，未配置时retentionC为nil，不会触发
+	var retentionTicker *time.Ticker
+	var retentionC <-chan time.Time
+	if len(s.retentionPolicies) > 0 && s.config.MemoryRetentionInterval > 0 {
+		retentionTicker = time.NewTicker(s.config.MemoryRetentionInterval)
+		retentionC = retentionTicker.C
+		log.Printf("[上下文服务] 记忆保留清理任务已启动，间隔=%v, 策略=%v", s.config.MemoryRetentionInterval, s.retentionPolicies)
+	}
+
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
-				// 1. 清理不活跃会话
-				count := s.sessionStore.CleanupInactiveSessions(timeout)
-				log.Printf("[上下文服务] 会话清理完成: 清理了%d个不活跃会话", count)
-
-				// 2. 清理短期记忆 (使用配置中的保留天数)
-				msgCount := s.sessionStore.CleanupShortTermMemory(s.config.ShortMemoryMaxAge)
-				log.Printf("[上下文服务] 短期记忆清理完成: 清理了%d条过期消息", msgCount)
+				// 1. 清理不活跃会话和短期记忆，并写入审计记录
+				s.RunSessionCleanup(ctx, timeout, s.config.CleanupDryRun)
 
 			case <-summaryTicker.C:
-				// 3. 定期执行自动汇总长期记忆
+				// 2. 定期执行自动汇总长期记忆
 				go s.AutoSummarizeToLongTermMemoryWithThreshold(ctx)
 
+			case <-retentionC:
+				// 3. 按保留策略清理过期记忆
+				if _, err := s.RunMemoryRetention(ctx, s.config.CleanupDryRun); err != nil {
+					log.Printf("❌ [记忆保留] 清理过期记忆失败: %v", err)
+				}
+
 			case <-ctx.Done():
 				ticker.Stop()
 				summaryTicker.Stop()
+				if retentionTicker != nil {
+					retentionTicker.Stop()
+				}
 				log.Printf("[上下文服务] 会话清理和汇总任务已停止")
 				return
 			}
@@ -5243,152 +6589,271 @@ func (s *ContextService) StartSessionCleanupTask(ctx context.Context, timeout ti
 }
 
 // AutoSummarizeToLongTermMemoryWithThreshold 带阈值的自动汇总到长期记忆
-// 只有满足特定条件的会话才会被汇总，避免无谓的资源消耗
+// 只有满足特定条件的会话才会被汇总，避免无谓的资源消耗；各会话由有界的worker并发处理，上一轮未完成时跳过本轮
 func (s *ContextService) AutoSummarizeToLongTermMemoryWithThreshold(ctx context.Context) {
-	log.Printf("[上下文服务] 开始基于阈值的自动汇总")
+	if !s.acquireAutoSummary() {
+		log.Printf("[上下文服务] 上一轮自动汇总尚未完成，跳过本轮")
+		return
+	}
+	defer s.releaseAutoSummary()
 
 	// 获取所有会话（包括活跃和即将过期的会话）
 	sessions := s.sessionStore.GetSessionList()
+	workers := s.autoSummaryWorkers(len(sessions))
+	log.Printf("[上下文服务] 开始基于阈值的自动汇总，会话数: %d，并发数: %d", len(sessions), workers)
+
+	now := time.Now()
+	sessionTimeout := time.Duration(s.config.SessionTimeout) * time.Minute
+
+	// 每个会话只由一个worker处理，会话元数据通过sessionStore加锁修改；LLM调用另受全局LLM并发上限约束
+	startTime := time.Now()
+	results := make([]autoSummaryResult, len(sessions))
+	forEachConcurrently(ctx, len(sessions), workers, func(i int) {
+		sessionStart := time.Now()
+		results[i] = s.autoSummarizeSession(ctx, sessions[i].ID, now, sessionTimeout)
+		results[i].duration = time.Since(sessionStart)
+	})
 
 	var summarizedCount int
 	var skippedCount int
 	var expiredProcessedCount int
+	var sessionDuration, longestDuration time.Duration
+	for _, result := range results {
+		switch {
+		case result.summarized:
+			summarizedCount++
+			if result.expired {
+				expiredProcessedCount++
+			}
+		case result.skipped:
+			skippedCount++
+		}
+		sessionDuration += result.duration
+		if result.duration > longestDuration {
+			longestDuration = result.duration
+		}
+	}
 
-	now := time.Now()
-	sessionTimeout := time.Duration(s.config.SessionTimeout) * time.Minute
+	log.Printf("[上下文服务] 自动汇总完成: 总共汇总 %d 个会话, 跳过 %d 个会话, 处理过期会话 %d 个, 并发数 %d, 总耗时 %v, 各会话耗时合计 %v, 单个会话最长 %v",
+		summarizedCount, skippedCount, expiredProcessedCount, workers, time.Since(startTime), sessionDuration, longestDuration)
+}
 
-	for _, session := range sessions {
-		// 🔥 修复：处理活跃会话和即将过期的会话
-		isActive := session.Status == "active"
-		isAboutToExpire := isActive && now.Sub(session.LastActive) > sessionTimeout*80/100                         // 超过80%会话超时时间
-		isRecentlyExpired := session.Status == "archived" && now.Sub(session.LastActive) <= sessionTimeout*120/100 // 过期后20%时间内
+// autoSummaryResult 单个会话的自动汇总结果，summarized和skipped都为false表示未处理或汇总失败
+type autoSummaryResult struct {
+	summarized bool
+	skipped    bool
+	expired    bool // 汇总的是刚过期的会话
+	duration   time.Duration
+}
 
-		if !isActive && !isRecentlyExpired {
-			continue // 跳过太久的过期会话
-		}
+// autoSummarizeSession 检查单个会话的汇总条件，满足时生成摘要存储为长期记忆，并更新会话的汇总游标
+func (s *ContextService) autoSummarizeSession(ctx context.Context, sessionID string, now time.Time, sessionTimeout time.Duration) autoSummaryResult {
+	startTime := time.Now()
 
-		// 🔥 修复：基于游标获取未汇总的消息
-		lastSummaryCursor := int64(0)
-		if session.Metadata != nil {
-			if cursorVal, ok := session.Metadata["last_summary_cursor"].(float64); ok {
-				lastSummaryCursor = int64(cursorVal)
-			}
-		}
+	// 读取会话快照，避免与其他请求并发修改元数据时读到中间状态
+	session, err := s.sessionStore.GetSessionSnapshot(sessionID)
+	if err != nil {
+		return autoSummaryResult{}
+	}
 
-		// 获取未汇总的消息（从游标位置开始）
-		var messages []*models.Message
-		var err error
+	// 🔥 修复：处理活跃会话和即将过期的会话
+	isActive := session.Status == "active"
+	isAboutToExpire := isActive && now.Sub(session.LastActive) > sessionTimeout*80/100                         // 超过80%会话超时时间
+	isRecentlyExpired := session.Status == "archived" && now.Sub(session.LastActive) <= sessionTimeout*120/100 // 过期后20%时间内
 
-		if lastSummaryCursor > 0 {
-			// 获取游标之后的消息
-			messages, err = s.getMessagesAfterCursor(session.ID, lastSummaryCursor)
-		} else {
-			// 首次汇总，获取所有消息
-			messages, err = s.sessionStore.GetMessages(session.ID, s.config.MaxMessageCount)
-		}
+	if !isActive && !isRecentlyExpired {
+		return autoSummaryResult{} // 跳过太久的过期会话
+	}
 
-		if err != nil || len(messages) < s.config.MinMessageCount {
-			// 消息太少，不值得汇总
-			skippedCount++
-			continue
+	// 🔥 修复：基于游标获取未汇总的消息
+	lastSummaryCursor := int64(0)
+	if session.Metadata != nil {
+		if cursorVal, ok := session.Metadata["last_summary_cursor"].(float64); ok {
+			lastSummaryCursor = int64(cursorVal)
 		}
+	}
 
-		// 检查汇总条件
-		lastSumTime := int64(0)
-		if session.Metadata != nil {
-			if lastSumTimeVal, ok := session.Metadata["last_summary_time"].(float64); ok {
-				lastSumTime = int64(lastSumTimeVal)
-			}
-		}
+	// 获取未汇总的消息（从游标位置开始）
+	var messages []*models.Message
 
-		currentTime := time.Now().Unix()
-		hoursSinceLastSum := (currentTime - lastSumTime) / 3600
+	if lastSummaryCursor > 0 {
+		// 获取游标之后的消息
+		messages, err = s.getMessagesAfterCursor(session.ID, lastSummaryCursor)
+	} else {
+		// 首次汇总，获取所有消息
+		messages, err = s.sessionStore.GetMessages(session.ID, s.config.MaxMessageCount)
+	}
 
-		// 判断是否满足汇总条件:
-		// 1. 从未汇总过，或者距离上次汇总超过指定小时数
-		// 2. 消息数量达到或超过触发阈值
-		// 3. 会话即将过期且有未汇总内容（🔥 新增）
-		needSummary := lastSumTime == 0 || hoursSinceLastSum >= int64(s.config.MinTimeSinceLastSummary)
-		messageTrigger := len(messages) >= s.config.MaxMessageCount
-		urgentSummary := isAboutToExpire || isRecentlyExpired // 🔥 紧急汇总
+	if err != nil || len(messages) == 0 {
+		return autoSummaryResult{skipped: true}
+	}
 
-		if needSummary || messageTrigger || urgentSummary {
-			// 生成摘要
-			summary := s.GenerateEnhancedSummary(messages)
-			if summary == "" {
-				continue
-			}
+	// 少量长消息也可能承载大量内容，累计token数达到阈值时不受最小消息数限制
+	tokenCount, tokenTrigger := s.summaryTokenTrigger(messages)
+	if len(messages) < s.config.MinMessageCount && !tokenTrigger {
+		// 消息太少，不值得汇总
+		return autoSummaryResult{skipped: true}
+	}
 
-			// 确定触发类型
-			var triggerType string
-			var triggerReasons []string
+	// 检查汇总条件
+	lastSumTime := int64(0)
+	if session.Metadata != nil {
+		if lastSumTimeVal, ok := session.Metadata["last_summary_time"].(float64); ok {
+			lastSumTime = int64(lastSumTimeVal)
+		}
+	}
 
-			if needSummary {
-				triggerReasons = append(triggerReasons, "time")
-			}
-			if messageTrigger {
-				triggerReasons = append(triggerReasons, "message_count")
-			}
-			if urgentSummary {
-				if isAboutToExpire {
-					triggerReasons = append(triggerReasons, "about_to_expire")
-				}
-				if isRecentlyExpired {
-					triggerReasons = append(triggerReasons, "recently_expired")
-				}
-			}
+	currentTime := time.Now().Unix()
+	hoursSinceLastSum := (currentTime - lastSumTime) / 3600
 
-			triggerType = strings.Join(triggerReasons, "+")
+	// 判断是否满足汇总条件:
+	// 1. 从未汇总过，或者距离上次汇总超过指定小时数
+	// 2. 消息数量达到或超过触发阈值
+	// 3. 未汇总内容的累计token数达到触发阈值
+	// 4. 会话即将过期且有未汇总内容（🔥 新增）
+	needSummary := lastSumTime == 0 || hoursSinceLastSum >= int64(s.config.MinTimeSinceLastSummary)
+	messageTrigger := len(messages) >= s.config.MaxMessageCount
+	urgentSummary := isAboutToExpire || isRecentlyExpired // 🔥 紧急汇总
 
-			// 存储到长期记忆
-			req := models.StoreContextRequest{
-				SessionID: session.ID,
-				Content:   summary,
-				Priority:  "P1", // 汇总内容优先级高
-				Metadata: map[string]interface{}{
-					"type":           "auto_summary",
-					"timestamp":      currentTime,
-					"message_count":  len(messages),
-					"trigger_type":   triggerType,
-					"cursor_start":   lastSummaryCursor,
-					"cursor_end":     s.getLastMessageTimestamp(messages),
-					"session_status": session.Status,
-				},
-			}
+	if needSummary || messageTrigger || tokenTrigger || urgentSummary {
+		// 生成摘要
+		summary := s.summarizeMessages(ctx, session.ID, messages)
+		if summary == "" {
+			return autoSummaryResult{}
+		}
+
+		// 确定触发类型
+		triggerType := summaryTriggerType(needSummary, messageTrigger, tokenTrigger, isAboutToExpire, isRecentlyExpired)
+
+		// 存储到长期记忆
+		req := models.StoreContextRequest{
+			SessionID: session.ID,
+			Content:   summary,
+			Priority:  "P1", // 汇总内容优先级高
+			Metadata: map[string]interface{}{
+				"type":           "auto_summary",
+				"timestamp":      currentTime,
+				"message_count":  len(messages),
+				"token_count":    tokenCount,
+				"trigger_type":   triggerType,
+				"cursor_start":   lastSummaryCursor,
+				"cursor_end":     s.getLastMessageTimestamp(messages),
+				"session_status": session.Status,
+			},
+		}
 
-			memoryID, err := s.StoreContext(ctx, req)
-			if err != nil {
-				log.Printf("[上下文服务] 警告: 自动汇总存储失败: %v", err)
-				continue
-			}
+		memoryID, err := s.StoreContext(ctx, req)
+		if err != nil {
+			log.Printf("[上下文服务] 警告: 自动汇总存储失败: %v", err)
+			return autoSummaryResult{}
+		}
 
-			// 🔥 更新会话元数据，记录汇总游标和时间
+		// 🔥 更新会话元数据，记录汇总游标和时间
+		summaryCursor := s.getLastMessageTimestamp(messages) // 🔥 记录游标
+		err = s.sessionStore.ModifySession(session.ID, func(session *models.Session) error {
 			if session.Metadata == nil {
 				session.Metadata = make(map[string]interface{})
 			}
 			session.Metadata["last_summary_time"] = currentTime
 			session.Metadata["last_summary_id"] = memoryID
-			session.Metadata["last_summary_cursor"] = s.getLastMessageTimestamp(messages) // 🔥 记录游标
+			session.Metadata["last_summary_cursor"] = summaryCursor
+			return nil
+		})
+		if err != nil {
+			log.Printf("[上下文服务] 警告: 更新会话元数据失败: %v", err)
+		}
 
-			// 保存更新后的会话
-			if err := s.sessionStore.SaveSession(session); err != nil {
-				log.Printf("[上下文服务] 警告: 更新会话元数据失败: %v", err)
-			}
+		log.Printf("[上下文服务] 会话 %s 自动汇总完成, 消息数: %d, 估算token数: %d, 距上次汇总: %d小时, 触发类型: %s, 生成长期记忆 ID: %s, 耗时: %v",
+			session.ID, len(messages), tokenCount, hoursSinceLastSum, triggerType, memoryID, time.Since(startTime))
 
-			log.Printf("[上下文服务] 会话 %s 自动汇总完成, 消息数: %d, 距上次汇总: %d小时, 触发类型: %s, 生成长期记忆 ID: %s",
-				session.ID, len(messages), hoursSinceLastSum, triggerType, memoryID)
+		return autoSummaryResult{summarized: true, expired: isRecentlyExpired}
+	}
+	return autoSummaryResult{skipped: true}
+}
 
-			if isRecentlyExpired {
-				expiredProcessedCount++
+// autoSummaryWorkers 自动汇总并发处理的会话数：不超过配置值、全局LLM并发上限和会话数，未配置时逐个处理
+func (s *ContextService) autoSummaryWorkers(sessions int) int {
+	workers := s.config.SummaryConcurrency
+	if s.config.LLMMaxConcurrency > 0 {
+		workers = min(workers, s.config.LLMMaxConcurrency)
+	}
+	return max(min(workers, sessions), 1)
+}
+
+// forEachConcurrently 以最多workers个goroutine处理下标[0, n)，全部完成后返回；ctx取消后不再分派新的下标
+func forEachConcurrently(ctx context.Context, n, workers int, fn func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
 			}
-			summarizedCount++
-		} else {
-			skippedCount++
+		}()
+	}
+
+dispatch:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break dispatch
 		}
 	}
+	close(indexes)
+	wg.Wait()
+}
+
+// acquireAutoSummary 标记自动汇总开始，上一轮仍在进行时返回false
+func (s *ContextService) acquireAutoSummary() bool {
+	s.autoSummaryMutex.Lock()
+	defer s.autoSummaryMutex.Unlock()
+	if s.autoSummaryRunning {
+		return false
+	}
+	s.autoSummaryRunning = true
+	return true
+}
+
+// releaseAutoSummary 清除自动汇总进行中的标记
+func (s *ContextService) releaseAutoSummary() {
+	s.autoSummaryMutex.Lock()
+	defer s.autoSummaryMutex.Unlock()
+	s.autoSummaryRunning = false
+}
 
-	log.Printf("[上下文服务] 自动汇总完成: 总共汇总 %d 个会话, 跳过 %d 个会话, 处理过期会话 %d 个",
-		summarizedCount, skippedCount, expiredProcessedCount)
+// summaryTokenTrigger 估算未汇总消息的累计token数，并判断是否达到SUMMARY_TOKEN_THRESHOLD
+func (s *ContextService) summaryTokenTrigger(messages []*models.Message) (int, bool) {
+	tokenCount := 0
+	for _, msg := range messages {
+		if msg != nil {
+			tokenCount += estimateTokens(msg.Content)
+		}
+	}
+	return tokenCount, s.config.SummaryTokenThreshold > 0 && tokenCount >= s.config.SummaryTokenThreshold
+}
+
+// summaryTriggerType 将触发自动汇总的条件按固定顺序以+连接，记录到汇总元数据的trigger_type
+func summaryTriggerType(timeTrigger, messageTrigger, tokenTrigger, aboutToExpire, recentlyExpired bool) string {
+	var triggerReasons []string
+	if timeTrigger {
+		triggerReasons = append(triggerReasons, "time")
+	}
+	if messageTrigger {
+		triggerReasons = append(triggerReasons, "message_count")
+	}
+	if tokenTrigger {
+		triggerReasons = append(triggerReasons, "token_count")
+	}
+	if aboutToExpire {
+		triggerReasons = append(triggerReasons, "about_to_expire")
+	}
+	if recentlyExpired {
+		triggerReasons = append(triggerReasons, "recently_expired")
+	}
+	return strings.Join(triggerReasons, "+")
 }
 
 // 🔥 新增：获取游标之后的消息
@@ -5678,15 +7143,27 @@ func (s *ContextService) RetrieveTodos(ctx context.Context, request models.Retri
 
 	// 如果有用户ID，添加到查询条件
 	if request.UserID != "" {
-		filter += fmt.Sprintf(" AND userId=\"%s\"", request.UserID)
+		filter += " AND userId=" + models.QuoteFilterValue(request.UserID)
+	}
+
+	// 提供了查询时按相关度检索待办，否则列出所有待办事项
+	if query := strings.TrimSpace(request.Query); query != "" {
+		return s.searchTodos(ctx, request, query, limit)
 	}
 
 	// 查询所有待办事项
 	log.Printf("执行待办事项查询: filter=%s, limit=%d", filter, limit)
-	results, err := s.vectorService.SearchByFilter(filter, limit)
+	var results []models.SearchResult
+	var err error
+	if s.vectorService == nil && s.vectorStore != nil {
+		// 仅配置了新向量存储（如Qdrant）时通过新接口查询
+		results, err = s.vectorStore.SearchByFilter(ctx, filter, &models.SearchOptions{Limit: limit, SkipThreshold: true})
+	} else {
+		results, err = s.vectorService.SearchByFilter(filter, limit)
+	}
 	if err != nil {
 		log.Printf("查询待办事项失败: %v", err)
-		return nil, fmt.Errorf("查询待办事项失败: %v", err)
+		return nil, fmt.Errorf("查询待办事项失败: %w", err)
 	}
 
 	log.Printf("成功检索到 %d 个待办事项", len(results))
@@ -5705,6 +7182,9 @@ func (s *ContextService) RetrieveTodos(ctx context.Context, request models.Retri
 		if request.Status != "all" && todoItem.Status != request.Status {
 			continue
 		}
+		if !request.IncludeArchived && isArchivedResult(result) {
+			continue
+		}
 
 		todoItems = append(todoItems, todoItem)
 	}
@@ -5726,97 +7206,920 @@ func (s *ContextService) RetrieveTodos(ctx context.Context, request models.Retri
 	return response, nil
 }
 
-// extractTodoItem 从搜索结果中提取待办事项
-func extractTodoItem(result models.SearchResult) (*models.TodoItem, error) {
-	// 记录详细的日志，帮助调试
-	fieldsJSON, _ := json.Marshal(result.Fields)
-	log.Printf("提取待办事项字段: %s", string(fieldsJSON))
-
-	// 从Fields中提取内容
-	content, ok := result.Fields["content"].(string)
-	if !ok || content == "" {
-		return nil, fmt.Errorf("缺少内容字段")
-	}
+// todoQueryOverfetch 按状态过滤的相关度检索多取的候选倍数
+const todoQueryOverfetch = 3
 
-	// 创建待办事项
-	todoItem := &models.TodoItem{
-		ID:      result.ID,
-		Content: content,
-		Status:  "pending", // 默认状态
+// searchTodos 按与查询的相关度检索待办事项，向量检索限定bizType为待办并按用户过滤，结果按相似度降序
+// 状态过滤在检索后进行，指定状态时多取候选以免过滤后不足limit条
+func (s *ContextService) searchTodos(ctx context.Context, request models.RetrieveTodosRequest, query string, limit int) (*models.RetrieveTodosResponse, error) {
+	filter := models.FilterEq("bizType", models.BizTypeTodo)
+	if request.UserID != "" {
+		filter = models.FilterAnd(filter, models.FilterEq(models.FilterFieldUserID, request.UserID))
 	}
 
-	// 直接从结果字段中获取userId，不再从metadata中获取
-	if userId, ok := result.Fields["userId"].(string); ok {
-		todoItem.UserID = userId
+	searchLimit := limit
+	if request.Status != "all" {
+		searchLimit = limit * todoQueryOverfetch
 	}
+	log.Printf("执行待办事项相关度检索: query=%s, userID=%s, status=%s, limit=%d", query, request.UserID, request.Status, searchLimit)
 
-	// 获取元数据
-	var metadata map[string]interface{}
-	if metadataRaw, ok := result.Fields["metadata"]; ok {
-		metadata, _ = metadataRaw.(map[string]interface{})
+	results, err := s.searchByText(ctx, query, "", map[string]interface{}{
+		"limit":                 searchLimit,
+		"skip_threshold_filter": true,
+		"filter":                filter,
+	})
+	if err != nil {
+		log.Printf("检索待办事项失败: %v", err)
+		return nil, fmt.Errorf("检索待办事项失败: %w", err)
 	}
 
-	// 从metadata中提取其他信息
-	if metadata != nil {
-		// 优先级
-		if priority, ok := metadata["priority"].(string); ok {
-			todoItem.Priority = priority
-		} else {
-			todoItem.Priority = "P2" // 默认优先级
+	var todoItems []*models.TodoItem
+	for _, result := range results {
+		// 过滤条件编译失败的存储可能返回非待办记录，这里再按bizType和用户校验一次
+		if getResultBizType(result) != models.BizTypeTodo {
+			continue
 		}
-
-		// 状态
-		if status, ok := metadata["status"].(string); ok {
-			todoItem.Status = status
+		if request.UserID != "" && getResultUserID(result) != request.UserID {
+			continue
 		}
-
-		// 创建时间
-		if createdAt, ok := metadata["timestamp"].(float64); ok {
-			todoItem.CreatedAt = int64(createdAt)
-		} else {
-			todoItem.CreatedAt = time.Now().Unix() // 默认为当前时间
+		if !request.IncludeArchived && isArchivedResult(result) {
+			continue
 		}
-
-		// 完成时间
-		if completedAt, ok := metadata["completedAt"].(float64); ok {
-			todoItem.CompletedAt = int64(completedAt)
+		todoItem, err := extractTodoItem(result)
+		if err != nil {
+			log.Printf("警告: 跳过无效的待办事项记录: %v", err)
+			continue
+		}
+		if request.Status != "all" && todoItem.Status != request.Status {
+			continue
 		}
+		score := result.Score
+		todoItem.Score = &score
+		todoItems = append(todoItems, todoItem)
+	}
 
-		// 保存原始元数据
-		todoItem.Metadata = metadata
+	sort.SliceStable(todoItems, func(i, j int) bool {
+		return *todoItems[i].Score > *todoItems[j].Score
+	})
+	if len(todoItems) > limit {
+		todoItems = todoItems[:limit]
 	}
 
-	return todoItem, nil
+	log.Printf("完成待办事项相关度检索，返回 %d 个结果", len(todoItems))
+	return &models.RetrieveTodosResponse{
+		Items:  todoItems,
+		Total:  len(todoItems),
+		Status: "success",
+		UserID: request.UserID,
+	}, nil
 }
 
-// GetProgrammingContext 获取编程上下文
-func (s *ContextService) GetProgrammingContext(ctx context.Context, sessionID string, query string) (*models.ProgrammingContext, error) {
-	log.Printf("[上下文服务] 获取编程上下文: 会话ID=%s, 查询=%s", sessionID, query)
+// DeleteMemory 删除指定的记忆，并级联清理同一memoryID下的知识图谱和时间线数据
+// 未找到匹配记录时不报错，返回deletedCount为0的结果
+func (s *ContextService) DeleteMemory(ctx context.Context, req models.DeleteMemoryRequest) (*models.DeleteMemoryResponse, error) {
+	return s.deleteMemory(ctx, req, s.neo4jDetachMemories)
+}
 
-	// 创建响应
-	result := &models.ProgrammingContext{
-		SessionID: sessionID,
+// deleteMemory 删除指定的记忆，知识图谱数据通过detach移除
+func (s *ContextService) deleteMemory(ctx context.Context, req models.DeleteMemoryRequest, detach memoryGraphDetacher) (*models.DeleteMemoryResponse, error) {
+	log.Printf("🗑️ [删除记忆] 开始删除: sessionID=%s, memoryID=%s, batchID=%s",
+		req.SessionID, req.MemoryID, req.BatchID)
+
+	targetID := req.MemoryID
+	if targetID == "" {
+		targetID = req.BatchID
+	}
+	if targetID == "" {
+		return nil, fmt.Errorf("memoryId和batchId至少需要提供一个")
 	}
 
-	// 获取会话
-	session, err := s.sessionStore.GetSession(sessionID)
+	userID, err := s.GetUserIDFromSessionID(req.SessionID)
 	if err != nil {
-		return nil, fmt.Errorf("获取会话失败: %w", err)
+		return nil, fmt.Errorf("获取用户ID失败: %w", err)
 	}
 
-	// 1. 获取关联文件信息
-	if session.CodeContext != nil {
-		for path, file := range session.CodeContext {
-			// 转换为CodeFileInfo
-			fileInfo := models.CodeFileInfo{
-				Path:     file.Path,
-				Language: file.Language,
-				LastEdit: file.LastEdit,
-				Summary:  file.Summary,
-			}
+	response := &models.DeleteMemoryResponse{
+		MemoryID: req.MemoryID,
+		BatchID:  req.BatchID,
+	}
 
-			// 获取文件关联的讨论
-			discussions, err := s.sessionStore.GetCodeFileRelations(sessionID, path)
+	// 查找待删除的向量记录（ID检索可能返回相近记录，只保留主键或memory_id完全匹配的）
+	results, err := s.searchByID(ctx, targetID, "id")
+	if err != nil {
+		return nil, fmt.Errorf("查询待删除记忆失败: %w", err)
+	}
+
+	var vectorIDs []string
+	var cascadeIDs []string
+	for _, result := range results {
+		memoryID, _ := result.Fields["memory_id"].(string)
+		if result.ID != targetID && memoryID != targetID {
+			continue
+		}
+
+		// 校验记录归属，防止跨用户删除
+		ownerID := getResultUserID(result)
+		if ownerID != userID {
+			log.Printf("❌ [删除记忆] 用户不匹配: 记录=%s, 记录用户=%s, 请求用户=%s", result.ID, ownerID, userID)
+			return nil, fmt.Errorf("无权删除其他用户的记忆: %s", result.ID)
+		}
+
+		vectorIDs = append(vectorIDs, result.ID)
+		if memoryID != "" {
+			cascadeIDs = append(cascadeIDs, memoryID)
+		} else {
+			cascadeIDs = append(cascadeIDs, result.ID)
+		}
+	}
+
+	if len(vectorIDs) > 0 {
+		if err := s.deleteMemories(ctx, vectorIDs); err != nil {
+			return nil, fmt.Errorf("删除向量记录失败: %w", err)
+		}
+		response.DeletedCount = len(vectorIDs)
+	}
+
+	// 时间线事件按user_id过滤，即使向量记录已不存在也可以安全清理
+	timelineIDs := cascadeIDs
+	if req.MemoryID != "" {
+		found := false
+		for _, id := range timelineIDs {
+			if id == req.MemoryID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			timelineIDs = append(timelineIDs, req.MemoryID)
+		}
+	}
+	response.TimelineDeleted = s.deleteLinkedTimelineEvents(ctx, userID, timelineIDs)
+
+	// 只清理已通过归属校验的memoryID，与其他记忆或用户共享的概念和关系只移除该记忆的归属
+	response.ConceptsDeleted, response.RelationsDeleted = deleteLinkedKnowledgeGraph(ctx, userID, cascadeIDs, false, detach)
+
+	if response.DeletedCount == 0 && response.TimelineDeleted == 0 && response.ConceptsDeleted == 0 {
+		response.Description = "未找到匹配的记忆，未删除任何数据"
+	} else {
+		response.Description = fmt.Sprintf("已删除向量记录%d条，时间线事件%d条，概念%d个，关系%d条",
+			response.DeletedCount, response.TimelineDeleted, response.ConceptsDeleted, response.RelationsDeleted)
+	}
+
+	log.Printf("✅ [删除记忆] %s", response.Description)
+	return response, nil
+}
+
+// deleteLinkedTimelineEvents 删除memoryID关联的时间线事件，返回删除数；时间线未启用或删除失败时跳过
+// 时间线事件按user_id过滤，即使向量记录已不存在也可以安全清理
+func (s *ContextService) deleteLinkedTimelineEvents(ctx context.Context, userID string, memoryIDs []string) int {
+	if len(memoryIDs) == 0 {
+		return 0
+	}
+	timescaleConfig := s.getTimescaleDBConfig()
+	if timescaleConfig == nil {
+		return 0
+	}
+	timelineEngine, err := s.getTimelineEngine(ctx, timescaleConfig)
+	if err != nil {
+		log.Printf("⚠️ [删除记忆] %v，跳过时间线清理", err)
+		return 0
+	}
+
+	total := 0
+	for _, id := range memoryIDs {
+		deleted, err := timelineEngine.DeleteEvent(ctx, id, userID)
+		if err != nil {
+			log.Printf("⚠️ [删除记忆] 删除时间线事件失败: %v", err)
+			continue
+		}
+		total += int(deleted)
+	}
+	return total
+}
+
+// memoryGraphDetacher 从知识图谱中移除用户的记忆，dryRun为true时只统计不修改
+type memoryGraphDetacher func(ctx context.Context, userID string, memoryIDs []string, dryRun bool) (knowledge.MemoryDetachCounts, error)
+
+// neo4jDetachMemories 通过Neo4j移除用户的记忆，Neo4j未启用时不做任何修改
+func (s *ContextService) neo4jDetachMemories(ctx context.Context, userID string, memoryIDs []string, dryRun bool) (knowledge.MemoryDetachCounts, error) {
+	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		return knowledge.MemoryDetachCounts{}, nil
+	}
+	knowledgeEngine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
+	if err != nil {
+		return knowledge.MemoryDetachCounts{}, err
+	}
+	return knowledgeEngine.DetachMemories(ctx, userID, memoryIDs, dryRun)
+}
+
+// deleteLinkedKnowledgeGraph 从知识图谱中移除用户已删除的记忆，返回删除的概念和关系数；调用方需已校验memoryID归属
+// 概念和关系由多个记忆和用户共享，只有移除后不再属于任何记忆和用户的才会删除；dryRun为true时只统计不修改
+func deleteLinkedKnowledgeGraph(ctx context.Context, userID string, memoryIDs []string, dryRun bool, detach memoryGraphDetacher) (int, int) {
+	if len(memoryIDs) == 0 {
+		return 0, 0
+	}
+	counts, err := detach(ctx, userID, memoryIDs, dryRun)
+	if err != nil {
+		log.Printf("⚠️ [删除记忆] 删除知识图谱数据失败，跳过知识图谱清理: %v", err)
+		return 0, 0
+	}
+	return counts.Concepts, counts.Relations
+}
+
+// extractTodoItem 从搜索结果中提取待办事项
+func extractTodoItem(result models.SearchResult) (*models.TodoItem, error) {
+	// 记录详细的日志，帮助调试
+	fieldsJSON, _ := json.Marshal(result.Fields)
+	log.Printf("提取待办事项字段: %s", string(fieldsJSON))
+
+	// 从Fields中提取内容
+	content, ok := result.Fields["content"].(string)
+	if !ok || content == "" {
+		return nil, fmt.Errorf("缺少内容字段")
+	}
+
+	// 创建待办事项
+	todoItem := &models.TodoItem{
+		ID:      result.ID,
+		Content: content,
+		Status:  "pending", // 默认状态
+	}
+
+	// 直接从结果字段中获取userId，不再从metadata中获取
+	todoItem.UserID = getResultUserID(result)
+
+	// 获取元数据（向量存储中可能是JSON字符串）
+	metadata := parseResultMetadata(result)
+
+	// 从metadata中提取其他信息
+	if metadata != nil {
+		// 优先级
+		if priority, ok := metadata["priority"].(string); ok {
+			todoItem.Priority = priority
+		} else {
+			todoItem.Priority = "P2" // 默认优先级
+		}
+
+		// 状态
+		if status, ok := metadata["status"].(string); ok {
+			todoItem.Status = status
+		}
+
+		// 创建时间
+		if createdAt, ok := metadata["timestamp"].(float64); ok {
+			todoItem.CreatedAt = int64(createdAt)
+		} else {
+			todoItem.CreatedAt = time.Now().Unix() // 默认为当前时间
+		}
+
+		// 完成时间
+		if completedAt, ok := metadata["completedAt"].(float64); ok {
+			todoItem.CompletedAt = int64(completedAt)
+		}
+
+		// 保存原始元数据
+		todoItem.Metadata = metadata
+	}
+
+	return todoItem, nil
+}
+
+// parseResultMetadata 解析搜索结果中的metadata字段，兼容JSON字符串和对象两种存储形式
+func parseResultMetadata(result models.SearchResult) map[string]interface{} {
+	switch raw := result.Fields["metadata"].(type) {
+	case map[string]interface{}:
+		return raw
+	case string:
+		var metadata map[string]interface{}
+		if raw != "" && json.Unmarshal([]byte(raw), &metadata) == nil {
+			return metadata
+		}
+	}
+	return nil
+}
+
+// getResultUserID 获取搜索结果的用户ID（阿里云为userId，Vearch为user_id）
+func getResultUserID(result models.SearchResult) string {
+	if userID, ok := result.Fields["userId"].(string); ok && userID != "" {
+		return userID
+	}
+	userID, _ := result.Fields["user_id"].(string)
+	return userID
+}
+
+// getResultBizType 获取搜索结果的业务类型（阿里云为bizType数字，Vearch为biz_type字符串）
+func getResultBizType(result models.SearchResult) int {
+	for _, key := range []string{"bizType", "biz_type"} {
+		switch v := result.Fields[key].(type) {
+		case float64:
+			return int(v)
+		case int:
+			return v
+		case string:
+			if bizType, err := strconv.Atoi(v); err == nil {
+				return bizType
+			}
+		}
+	}
+	return 0
+}
+
+// 时间线查询默认值和上限
+const (
+	defaultTimelineQueryLimit = 50
+	maxTimelineQueryLimit     = 500
+	defaultTimelineQueryRange = 7 * 24 * time.Hour
+)
+
+// timelineRangeQuery 查询用户在时间范围内的时间线事件和事件类型统计
+type timelineRangeQuery func(ctx context.Context, query *timeline.TimelineQuery) (*timeline.TimelineResult, error)
+
+// timescaleQueryTimeRange 通过TimescaleDB时间线引擎查询时间范围内的事件
+func (s *ContextService) timescaleQueryTimeRange(ctx context.Context, query *timeline.TimelineQuery) (*timeline.TimelineResult, error) {
+	timescaleConfig := s.getTimescaleDBConfig()
+	if timescaleConfig == nil {
+		return nil, fmt.Errorf("TimescaleDB未启用")
+	}
+
+	timelineEngine, err := s.getTimelineEngine(ctx, timescaleConfig)
+	if err != nil {
+		return nil, err
+	}
+	return timelineEngine.QueryTimeRange(ctx, query)
+}
+
+// QueryTimeline 查询用户在时间窗口内的时间线事件，按时间正序返回并附带事件类型统计
+// from/to为零值时默认查询最近7天，eventTypes为空时不过滤事件类型
+func (s *ContextService) QueryTimeline(ctx context.Context, userID, workspaceID string, from, to time.Time, eventTypes []string, limit int) (*models.TimelineQueryResponse, error) {
+	return s.queryTimeline(ctx, userID, workspaceID, from, to, eventTypes, limit, s.timescaleQueryTimeRange)
+}
+
+// queryTimeline 补全默认时间窗口、校验范围并限制返回条数后查询时间线
+func (s *ContextService) queryTimeline(ctx context.Context, userID, workspaceID string, from, to time.Time, eventTypes []string, limit int, query timelineRangeQuery) (*models.TimelineQueryResponse, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	if to.IsZero() {
+		to = s.now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultTimelineQueryRange)
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("结束时间不能早于开始时间")
+	}
+	if limit <= 0 {
+		limit = defaultTimelineQueryLimit
+	}
+	if limit > maxTimelineQueryLimit {
+		limit = maxTimelineQueryLimit
+	}
+
+	result, err := query(ctx, &timeline.TimelineQuery{
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		StartTime:   from,
+		EndTime:     to,
+		EventTypes:  eventTypes,
+		Limit:       limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询时间线失败: %w", err)
+	}
+
+	response := &models.TimelineQueryResponse{
+		From:            from,
+		To:              to,
+		Events:          make([]models.TimelineEventItem, 0, len(result.Events)),
+		Total:           result.Total,
+		EventTypeCounts: result.EventTypeCounts,
+	}
+	for _, event := range result.Events {
+		item := models.TimelineEventItem{
+			ID:              event.ID,
+			Timestamp:       event.Timestamp,
+			EventType:       event.EventType,
+			Title:           event.Title,
+			Keywords:        event.Keywords,
+			ImportanceScore: event.ImportanceScore,
+			SessionID:       event.SessionID,
+			WorkspaceID:     event.WorkspaceID,
+		}
+		if event.Summary != nil {
+			item.Summary = *event.Summary
+		}
+		response.Events = append(response.Events, item)
+	}
+
+	log.Printf("✅ [时间线查询] 用户=%s, 工作空间=%s, 返回=%d, 总数=%d, 类型统计=%v",
+		userID, workspaceID, len(response.Events), response.Total, response.EventTypeCounts)
+	return response, nil
+}
+
+// ParseTimelineQueryTime 解析时间线查询的时间参数
+// 支持RFC3339、Unix秒级时间戳以及parseTimeString支持的格式，空字符串返回零值
+func ParseTimelineQueryTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return parseTimeString(value, time.Now())
+}
+
+// 知识图谱查询限制，防止无界遍历
+const (
+	defaultKnowledgeGraphDepth = 2
+	maxKnowledgeGraphDepth     = 3
+	maxKnowledgeGraphNodes     = 200
+)
+
+// knowledgeSubgraphQuery 从实体出发查询maxDepth跳以内属于该用户的子图，节点数达到maxNodes时截断
+type knowledgeSubgraphQuery func(ctx context.Context, userID, entityName string, maxDepth, maxNodes int) (*knowledge.KnowledgeResult, error)
+
+// neo4jQuerySubgraph 通过Neo4j知识引擎查询子图
+func (s *ContextService) neo4jQuerySubgraph(ctx context.Context, userID, entityName string, maxDepth, maxNodes int) (*knowledge.KnowledgeResult, error) {
+	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		return nil, fmt.Errorf("Neo4j未启用")
+	}
+
+	knowledgeEngine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
+	if err != nil {
+		return nil, err
+	}
+	return knowledgeEngine.QuerySubgraph(ctx, userID, entityName, maxDepth, maxNodes)
+}
+
+// QueryKnowledgeGraph 从指定实体出发查询该用户的知识图谱子图
+func (s *ContextService) QueryKnowledgeGraph(ctx context.Context, userID, entityName string, maxDepth int) (*models.KnowledgeGraphResponse, error) {
+	return s.queryKnowledgeGraph(ctx, userID, entityName, maxDepth, s.neo4jQuerySubgraph)
+}
+
+// queryKnowledgeGraph 校验并限制查询深度和节点数后查询子图，转换为按实体名表示的节点和关系
+func (s *ContextService) queryKnowledgeGraph(ctx context.Context, userID, entityName string, maxDepth int, query knowledgeSubgraphQuery) (*models.KnowledgeGraphResponse, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	if entityName == "" {
+		return nil, fmt.Errorf("实体名称不能为空")
+	}
+	if maxDepth <= 0 {
+		maxDepth = defaultKnowledgeGraphDepth
+	}
+	if maxDepth > maxKnowledgeGraphDepth {
+		log.Printf("⚠️ [知识图谱查询] 深度%d超过上限，截断为%d", maxDepth, maxKnowledgeGraphDepth)
+		maxDepth = maxKnowledgeGraphDepth
+	}
+
+	result, err := query(ctx, userID, entityName, maxDepth, maxKnowledgeGraphNodes)
+	if err != nil {
+		return nil, fmt.Errorf("查询知识图谱失败: %w", err)
+	}
+
+	response := &models.KnowledgeGraphResponse{
+		EntityName:    entityName,
+		MaxDepth:      maxDepth,
+		Nodes:         make([]models.KnowledgeGraphNode, 0, len(result.Nodes)),
+		Relationships: make([]models.KnowledgeGraphRelationship, 0, len(result.Relationships)),
+		Truncated:     result.Truncated,
+	}
+
+	nodeNames := make(map[string]string, len(result.Nodes))
+	for _, node := range result.Nodes {
+		nodeNames[node.ID] = node.Name
+		label := ""
+		if len(node.Labels) > 0 {
+			label = node.Labels[0]
+		}
+		response.Nodes = append(response.Nodes, models.KnowledgeGraphNode{
+			Name:        node.Name,
+			Label:       label,
+			Category:    node.Category,
+			Description: node.Description,
+			Keywords:    node.Keywords,
+		})
+	}
+
+	for _, rel := range result.Relationships {
+		response.Relationships = append(response.Relationships, models.KnowledgeGraphRelationship{
+			From:        nodeNames[rel.StartNodeID],
+			To:          nodeNames[rel.EndNodeID],
+			Type:        rel.Type,
+			Strength:    rel.Strength,
+			Description: rel.Description,
+		})
+	}
+
+	log.Printf("✅ [知识图谱查询] 实体=%s, 用户=%s, 深度=%d, 节点=%d, 关系=%d, 截断=%v",
+		entityName, userID, maxDepth, len(response.Nodes), len(response.Relationships), response.Truncated)
+	return response, nil
+}
+
+// UpdateTodo 更新待办事项的状态、优先级和完成时间
+// 向量存储不支持局部更新，这里先删除原记录再以相同ID重新写入，避免产生重复的待办记录
+func (s *ContextService) UpdateTodo(ctx context.Context, req models.UpdateTodoRequest) (*models.TodoItem, error) {
+	log.Printf("开始更新待办事项: sessionID=%s, memoryID=%s, status=%s, priority=%s",
+		req.SessionID, req.MemoryID, req.Status, req.Priority)
+
+	if req.MemoryID == "" {
+		return nil, fmt.Errorf("memoryId不能为空")
+	}
+	if req.Status != "pending" && req.Status != "completed" {
+		return nil, fmt.Errorf("无效的状态: %s，可选值: pending, completed", req.Status)
+	}
+
+	// 查找待办事项记录
+	results, err := s.searchByID(ctx, req.MemoryID, "id")
+	if err != nil {
+		return nil, fmt.Errorf("查询待办事项失败: %w", err)
+	}
+
+	var record *models.SearchResult
+	for i := range results {
+		if results[i].ID == req.MemoryID {
+			record = &results[i]
+			break
+		}
+	}
+	if record == nil {
+		return nil, fmt.Errorf("未找到待办事项: %s", req.MemoryID)
+	}
+	if getResultBizType(*record) != models.BizTypeTodo {
+		return nil, fmt.Errorf("记录%s不是待办事项", req.MemoryID)
+	}
+
+	userID := req.UserID
+	if userID == "" {
+		userID, err = s.GetUserIDFromSessionID(req.SessionID)
+		if err != nil {
+			return nil, fmt.Errorf("获取用户ID失败: %w", err)
+		}
+	}
+	ownerID := getResultUserID(*record)
+	if ownerID != userID {
+		return nil, fmt.Errorf("无权更新其他用户的待办事项: %s", req.MemoryID)
+	}
+
+	content, _ := record.Fields["content"].(string)
+	if content == "" {
+		return nil, fmt.Errorf("待办事项内容为空: %s", req.MemoryID)
+	}
+
+	// 更新元数据
+	metadata := parseResultMetadata(*record)
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["status"] = req.Status
+	if req.Status == "completed" {
+		completedAt := req.CompletedAt
+		if completedAt <= 0 {
+			completedAt = time.Now().Unix()
+		}
+		metadata["completedAt"] = completedAt
+	} else {
+		delete(metadata, "completedAt")
+	}
+
+	priority, _ := record.Fields["priority"].(string)
+	if req.Priority != "" {
+		priority = req.Priority
+		metadata["priority"] = req.Priority
+	}
+
+	// 以原记录ID重建记忆（batchId存储的记录保留原始memory_id）
+	sessionID, _ := record.Fields["session_id"].(string)
+	memory := models.NewMemory(sessionID, content, priority, metadata)
+	memory.ID = record.ID
+	if memoryID, ok := record.Fields["memory_id"].(string); ok && memoryID != "" {
+		memory.ID = memoryID
+	}
+	if timestamp, ok := record.Fields["timestamp"].(float64); ok && timestamp > 0 {
+		memory.Timestamp = int64(timestamp)
+	}
+	memory.BizType = models.BizTypeTodo
+	memory.UserID = ownerID
+
+	vector, err := s.generateEmbedding(content)
+	if err != nil {
+		return nil, fmt.Errorf("生成向量失败: %w", err)
+	}
+	memory.Vector = vector
+
+	if err := s.rewriteMemoryRecord(ctx, *record, memory); err != nil {
+		return nil, fmt.Errorf("重新写入待办事项失败: %w", err)
+	}
+
+	log.Printf("待办事项更新成功: memoryID=%s, status=%s", req.MemoryID, req.Status)
+
+	// 按存储格式序列化元数据，复用检索时的解析逻辑
+	metadataJSON, _ := json.Marshal(metadata)
+	return extractTodoItem(models.SearchResult{
+		ID: record.ID,
+		Fields: map[string]interface{}{
+			"content":  content,
+			"userId":   ownerID,
+			"metadata": string(metadataJSON),
+		},
+	})
+}
+
+// 会话导出时读取的长期记忆上限
+const maxSessionExportMemories = 1000
+
+// ExportSession 导出会话的元数据、消息、代码上下文、编辑历史及关联的长期记忆
+func (s *ContextService) ExportSession(ctx context.Context, userID, sessionID string) (*models.SessionExport, error) {
+	log.Printf("开始导出会话: sessionID=%s, userID=%s", sessionID, userID)
+
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	if sessionID == "" {
+		return nil, fmt.Errorf("会话ID不能为空")
+	}
+
+	userSessionStore, err := s.GetUserSessionStore(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户会话存储失败: %w", err)
+	}
+
+	session, err := userSessionStore.GetSessionSnapshot(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID, _ := session.Metadata["userId"].(string); ownerID != "" && ownerID != userID {
+		return nil, fmt.Errorf("无权导出其他用户的会话: %s", sessionID)
+	}
+
+	export := &models.SessionExport{
+		Version:    models.SessionExportVersion,
+		ExportedAt: time.Now().Unix(),
+		UserID:     userID,
+		Session:    session,
+		MemoryIDs:  []string{},
+	}
+
+	results, err := s.searchBySessionID(ctx, sessionID, maxSessionExportMemories)
+	if err != nil {
+		return nil, fmt.Errorf("查询会话长期记忆失败: %w", err)
+	}
+
+	for _, result := range results {
+		// 消息记录已包含在session.Messages中
+		if role, _ := result.Fields["role"].(string); role != "" {
+			continue
+		}
+		if ownerID := getResultUserID(result); ownerID != "" && ownerID != userID {
+			continue
+		}
+
+		content, _ := result.Fields["content"].(string)
+		if content == "" {
+			continue
+		}
+
+		memory := &models.ExportedMemory{
+			ID:       result.ID,
+			Content:  content,
+			BizType:  getResultBizType(result),
+			Metadata: parseResultMetadata(result),
+		}
+		memory.Priority, _ = result.Fields["priority"].(string)
+		if timestamp, ok := result.Fields["timestamp"].(float64); ok {
+			memory.Timestamp = int64(timestamp)
+		}
+
+		export.MemoryIDs = append(export.MemoryIDs, result.ID)
+		export.Memories = append(export.Memories, memory)
+	}
+
+	log.Printf("会话导出完成: sessionID=%s, 消息数=%d, 编辑数=%d, 长期记忆数=%d",
+		sessionID, len(session.Messages), len(session.EditHistory), len(export.Memories))
+	return export, nil
+}
+
+// ImportSession 将导出的会话恢复到当前用户名下
+// 所有userId字段重映射为导入者；向量存储中不存在的长期记忆会重新生成向量后写入
+func (s *ContextService) ImportSession(ctx context.Context, req models.ImportSessionRequest) (*models.ImportSessionResponse, error) {
+	if req.UserID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	if req.Data == nil || req.Data.Session == nil {
+		return nil, fmt.Errorf("导入数据缺少会话信息")
+	}
+	if req.Data.Version != models.SessionExportVersion {
+		return nil, fmt.Errorf("不支持的导出格式版本: %d", req.Data.Version)
+	}
+
+	session := req.Data.Session
+	if req.TargetSessionID != "" {
+		session.ID = req.TargetSessionID
+	}
+	if session.ID == "" {
+		return nil, fmt.Errorf("导入数据缺少会话ID")
+	}
+
+	log.Printf("开始导入会话: sessionID=%s, 导出者=%s, 导入者=%s, force=%v",
+		session.ID, req.Data.UserID, req.UserID, req.Force)
+
+	userSessionStore, err := s.GetUserSessionStore(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户会话存储失败: %w", err)
+	}
+
+	// 目标存储中的同名会话必须属于导入者，即使force也不允许覆盖他人会话
+	if existing, err := userSessionStore.GetSessionSnapshot(session.ID); err == nil {
+		if ownerID, _ := existing.Metadata["userId"].(string); ownerID != "" && ownerID != req.UserID {
+			return nil, fmt.Errorf("无权覆盖其他用户的会话: %s", session.ID)
+		}
+	}
+
+	// 重映射用户ID和会话ID
+	if session.Metadata == nil {
+		session.Metadata = make(map[string]interface{})
+	}
+	session.Metadata["userId"] = req.UserID
+	for _, message := range session.Messages {
+		message.SessionID = session.ID
+		remapUserIDFields(message.Metadata, req.UserID)
+	}
+	for _, edit := range session.EditHistory {
+		remapUserIDFields(edit.Metadata, req.UserID)
+	}
+
+	overwritten, err := userSessionStore.ImportSession(session, req.Force)
+	if err != nil {
+		if errors.Is(err, store.ErrSessionExists) {
+			return nil, fmt.Errorf("%w，如需覆盖请设置force=true", err)
+		}
+		return nil, fmt.Errorf("写入会话失败: %w", err)
+	}
+
+	response := &models.ImportSessionResponse{
+		SessionID:     session.ID,
+		UserID:        req.UserID,
+		Overwritten:   overwritten,
+		MessageCount:  len(session.Messages),
+		EditCount:     len(session.EditHistory),
+		CodeFileCount: len(session.CodeContext),
+	}
+
+	for _, exported := range req.Data.Memories {
+		restored, err := s.restoreExportedMemory(ctx, exported, session.ID, req.UserID)
+		switch {
+		case err != nil:
+			log.Printf("⚠️ 恢复长期记忆失败: memoryID=%s, 错误: %v", exported.ID, err)
+			response.MemoriesFailed++
+		case restored:
+			response.MemoriesRestored++
+		default:
+			response.MemoriesSkipped++
+		}
+	}
+
+	log.Printf("会话导入完成: sessionID=%s, 消息数=%d, 恢复记忆=%d, 跳过记忆=%d, 失败记忆=%d",
+		session.ID, response.MessageCount, response.MemoriesRestored, response.MemoriesSkipped, response.MemoriesFailed)
+	return response, nil
+}
+
+// restoreExportedMemory 恢复单条长期记忆，向量存储中已存在且属于导入者时跳过
+// 同ID记录属于其他用户时以新ID写入，避免覆盖他人数据
+func (s *ContextService) restoreExportedMemory(ctx context.Context, exported *models.ExportedMemory, sessionID, userID string) (bool, error) {
+	if exported == nil || exported.Content == "" {
+		return false, fmt.Errorf("记忆内容为空")
+	}
+
+	memoryID := exported.ID
+	if memoryID != "" {
+		results, err := s.searchByID(ctx, memoryID, "id")
+		if err != nil {
+			return false, fmt.Errorf("查询记忆失败: %w", err)
+		}
+		for _, result := range results {
+			if result.ID != memoryID {
+				continue
+			}
+			if ownerID := getResultUserID(result); ownerID == "" || ownerID == userID {
+				return false, nil
+			}
+			memoryID = ""
+			break
+		}
+	}
+
+	metadata := exported.Metadata
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	remapUserIDFields(metadata, userID)
+	if memoryID == "" {
+		// 以新ID写入时不能沿用原batchId作为存储主键
+		delete(metadata, "batchId")
+	}
+
+	memory := models.NewMemory(sessionID, exported.Content, exported.Priority, metadata)
+	if memoryID != "" {
+		memory.ID = memoryID
+	}
+	if exported.Timestamp > 0 {
+		memory.Timestamp = exported.Timestamp
+	}
+	memory.BizType = exported.BizType
+	memory.UserID = userID
+
+	vector, err := s.generateEmbedding(exported.Content)
+	if err != nil {
+		return false, fmt.Errorf("生成向量失败: %w", err)
+	}
+	memory.Vector = vector
+
+	if err := s.storeMemory(memory); err != nil {
+		return false, fmt.Errorf("存储记忆失败: %w", err)
+	}
+	return true, nil
+}
+
+// ParseSessionExport 解析export_session导出的数据，支持JSON字符串或已解码的对象
+func ParseSessionExport(raw interface{}) (*models.SessionExport, error) {
+	var data []byte
+	switch v := raw.(type) {
+	case string:
+		data = []byte(v)
+	case nil:
+		return nil, fmt.Errorf("导入数据为空")
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("序列化导入数据失败: %w", err)
+		}
+		data = encoded
+	}
+
+	var export models.SessionExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("解析导入数据失败: %w", err)
+	}
+	return &export, nil
+}
+
+// remapUserIDFields 将元数据中的用户ID字段替换为指定用户
+func remapUserIDFields(metadata map[string]interface{}, userID string) {
+	if metadata == nil {
+		return
+	}
+	for _, key := range []string{"userId", "user_id"} {
+		if _, ok := metadata[key]; ok {
+			metadata[key] = userID
+		}
+	}
+}
+
+// GetProgrammingContext 获取编程上下文，配置开启PROGRAMMING_CONTEXT_TIMELINE时合并时间线事件
+func (s *ContextService) GetProgrammingContext(ctx context.Context, sessionID string, query string) (*models.ProgrammingContext, error) {
+	return s.GetProgrammingContextWithOptions(ctx, models.ProgrammingContextRequest{SessionID: sessionID, Query: query})
+}
+
+// buildProgrammingContext 根据会话内的代码文件和编辑历史构建编程上下文
+func (s *ContextService) buildProgrammingContext(ctx context.Context, sessionID string, query string) (*models.ProgrammingContext, error) {
+	log.Printf("[上下文服务] 获取编程上下文: 会话ID=%s, 查询=%s", sessionID, query)
+
+	// 创建响应
+	result := &models.ProgrammingContext{
+		SessionID: sessionID,
+	}
+
+	// 获取会话
+	session, err := s.sessionStore.GetSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取会话失败: %w", err)
+	}
+
+	// 1. 获取关联文件信息
+	if session.CodeContext != nil {
+		for path, file := range session.CodeContext {
+			// 转换为CodeFileInfo
+			fileInfo := models.CodeFileInfo{
+				Path:     file.Path,
+				Language: file.Language,
+				LastEdit: file.LastEdit,
+				Summary:  file.Summary,
+			}
+
+			// 获取文件关联的讨论
+			discussions, err := s.sessionStore.GetCodeFileRelations(sessionID, path)
 			if err == nil && len(discussions) > 0 {
 				fileInfo.RelatedDiscussions = discussions
 				fileInfo.Importance = float64(len(discussions)) * 0.2
@@ -5889,13 +8192,10 @@ func (s *ContextService) GetProgrammingContext(ctx context.Context, sessionID st
 	}
 	stats.EditsByFile = editsByFile
 
-	// 按日期统计活动数
-	activityByDay := make(map[string]int)
+	// 按日期和事件类型统计活动数
 	for _, edit := range result.RecentEdits {
-		day := time.Unix(edit.Timestamp, 0).Format("2006-01-02")
-		activityByDay[day]++
+		addActivity(&stats, edit.Timestamp, models.ActivityTypeCodeEdit)
 	}
-	stats.ActivityByDay = activityByDay
 
 	// 4. 如果有特定查询，尝试查找相关代码片段
 	if query != "" {
@@ -5915,7 +8215,7 @@ func (s *ContextService) GetProgrammingContext(ctx context.Context, sessionID st
 			searchResults, err := s.searchByVector(ctx, queryVector, "", options)
 			if err == nil && len(searchResults) > 0 {
 				for _, searchResult := range searchResults {
-					if searchResult.Score > 0.8 { // 过滤相关性很低的结果
+					if searchResult.Score < 0.2 { // 过滤相关性很低的结果
 						continue
 					}
 
@@ -5941,7 +8241,7 @@ func (s *ContextService) GetProgrammingContext(ctx context.Context, sessionID st
 						Content:  content,
 						FilePath: filePath,
 						Score:    searchResult.Score,
-						Context:  fmt.Sprintf("相关度:%.2f", 1.0-searchResult.Score),
+						Context:  fmt.Sprintf("相关度:%.2f", searchResult.Score),
 					}
 
 					result.RelevantSnippets = append(result.RelevantSnippets, snippet)
@@ -5985,7 +8285,7 @@ func (s *ContextService) GetProgrammingContext(ctx context.Context, sessionID st
 
 	// 6. 查找关联会话
 	if session.Metadata != nil {
-		if linkedSessions, ok := session.Metadata["linked_sessions"].([]interface{}); ok {
+		if linkedSessions, ok := session.Metadata[models.SessionMetadataLinkedSessions].([]interface{}); ok {
 			for _, linkData := range linkedSessions {
 				if linkMap, ok := linkData.(map[string]interface{}); ok {
 					link := models.SessionReference{
@@ -6045,46 +8345,13 @@ func getInt64FromMap(m map[string]interface{}, key string, defaultValue int64) i
 }
 
 // searchByVector 统一的向量搜索接口
-func (s *ContextService) searchByVector(ctx context.Context, queryVector []float32, sessionID string, options map[string]interface{}) ([]models.SearchResult, error) {
+func (s *ContextService) searchByVector(ctx context.Context, queryVector []float32, sessionID string, options map[string]interface{}) (results []models.SearchResult, err error) {
+	defer metrics.ObserveVectorStoreOperation("search_by_vector", time.Now(), &err)
+
 	if s.vectorStore != nil {
 		log.Printf("[上下文服务] 使用新向量存储接口向量搜索")
 
-		// 转换选项格式
-		searchOptions := &models.SearchOptions{
-			Limit:         10,
-			SessionID:     sessionID,
-			SkipThreshold: false,
-			// IsBruteSearch: 不在此处设置，根据传入参数决定
-		}
-
-		if options != nil {
-			if skipThreshold, ok := options["skip_threshold_filter"].(bool); ok {
-				searchOptions.SkipThreshold = skipThreshold
-			}
-			if userFilter, ok := options["filter"].(string); ok && strings.Contains(userFilter, "userId=") {
-				log.Printf("[上下文服务] 🔍 检测到用户过滤器: %s", userFilter)
-				// 从过滤器中提取用户ID
-				re := regexp.MustCompile(`userId="([^"]+)"`)
-				if matches := re.FindStringSubmatch(userFilter); len(matches) > 1 {
-					searchOptions.UserID = matches[1]
-					log.Printf("[上下文服务] ✅ 成功提取用户ID: %s", searchOptions.UserID)
-				} else {
-					log.Printf("[上下文服务] ⚠️  无法从过滤器中提取用户ID: %s", userFilter)
-				}
-			} else {
-				log.Printf("[上下文服务] ⚠️  未检测到用户过滤器，options: %+v", options)
-			}
-			// 处理暴力搜索参数（仅对 Vearch 有效）
-			if bruteSearch, ok := options["is_brute_search"].(int); ok {
-				// 只有 Vearch 类型的向量存储才支持暴力搜索
-				if s.vectorStore.GetProvider() == models.VectorStoreTypeVearch {
-					searchOptions.IsBruteSearch = bruteSearch
-					log.Printf("[上下文服务] 检测到 Vearch 存储，启用暴力搜索参数: %d", bruteSearch)
-				} else {
-					log.Printf("[上下文服务] 检测到 %s 存储，忽略暴力搜索参数", s.vectorStore.GetProvider())
-				}
-			}
-		}
+		searchOptions := s.toSearchOptions(sessionID, options)
 
 		// 🔥 详细日志：打印最终搜索选项
 		log.Printf("[上下文服务] 🚀 调用向量存储搜索: UserID=%s, SessionID=%s, Limit=%d, IsBruteSearch=%d",
@@ -6103,7 +8370,100 @@ func (s *ContextService) searchByVector(ctx context.Context, queryVector []float
 		limit = limitVal
 	}
 
-	return s.vectorService.SearchVectorsAdvanced(queryVector, sessionID, limit, options)
+	legacyOptions, err := legacySearchOptions(options, s.vectorService.GetMetric())
+	if err != nil {
+		return nil, err
+	}
+	results, err = s.vectorService.SearchVectorsAdvanced(queryVector, sessionID, limit, legacyOptions)
+	if err != nil {
+		return nil, err
+	}
+	return s.normalizeLegacyScores(results), nil
+}
+
+// applySearchFilter 将结构化过滤条件设置到搜索选项，其中的用户ID等值条件同时设置UserID，供按UserID隔离数据的存储使用
+func applySearchFilter(searchOptions *models.SearchOptions, filter models.Filter) {
+	searchOptions.Filter = &filter
+	if userID, ok := filter.EqValue(models.FilterFieldUserID); ok {
+		if userID, ok := userID.(string); ok {
+			searchOptions.UserID = userID
+		}
+	}
+}
+
+// legacySearchOptions 传统向量服务只接受DashVector过滤字符串和距离阈值，将结构化过滤条件编译后替换、
+// 相似度阈值按度量转换为距离阈值，不修改调用方的options
+func legacySearchOptions(options map[string]interface{}, metric string) (map[string]interface{}, error) {
+	legacyOptions := make(map[string]interface{}, len(options))
+	for key, value := range options {
+		legacyOptions[key] = value
+	}
+	if threshold, ok := options["similarity_threshold"].(float64); ok && threshold > 0 {
+		legacyOptions["similarity_threshold"] = vectorstore.DistanceThreshold(metric, threshold)
+	}
+
+	filter, ok := options["filter"].(models.Filter)
+	if !ok {
+		return legacyOptions, nil
+	}
+	compiled, err := vectorstore.CompileAliyunFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("编译过滤条件失败: %w", err)
+	}
+	log.Printf("[上下文服务] 传统向量服务过滤条件: %s", compiled)
+
+	if compiled == "" {
+		delete(legacyOptions, "filter")
+	} else {
+		legacyOptions["filter"] = compiled
+	}
+	return legacyOptions, nil
+}
+
+// toSearchOptions 将检索选项转换为向量存储的搜索选项
+func (s *ContextService) toSearchOptions(sessionID string, options map[string]interface{}) *models.SearchOptions {
+	// 转换选项格式
+	searchOptions := &models.SearchOptions{
+		Limit:         10,
+		SessionID:     sessionID,
+		SkipThreshold: false,
+		// IsBruteSearch: 不在此处设置，根据传入参数决定
+	}
+
+	if options != nil {
+		if skipThreshold, ok := options["skip_threshold_filter"].(bool); ok {
+			searchOptions.SkipThreshold = skipThreshold
+		}
+		if threshold, ok := options["similarity_threshold"].(float64); ok && threshold > 0 {
+			searchOptions.Threshold = threshold
+		}
+		if limitVal, ok := options["limit"].(int); ok && limitVal > 0 {
+			searchOptions.Limit = limitVal
+		}
+		if startTime, ok := options["start_time"].(int64); ok {
+			searchOptions.StartTime = startTime
+		}
+		if endTime, ok := options["end_time"].(int64); ok {
+			searchOptions.EndTime = endTime
+		}
+		if filter, ok := options["filter"].(models.Filter); ok && !filter.IsEmpty() {
+			log.Printf("[上下文服务] 🔍 检测到过滤条件: %s", filter)
+			applySearchFilter(searchOptions, filter)
+		} else {
+			log.Printf("[上下文服务] ⚠️  未检测到用户过滤器，options: %+v", options)
+		}
+		// 处理暴力搜索参数（仅对 Vearch 有效）
+		if bruteSearch, ok := options["is_brute_search"].(int); ok {
+			// 只有 Vearch 类型的向量存储才支持暴力搜索
+			if s.vectorStore.GetProvider() == models.VectorStoreTypeVearch {
+				searchOptions.IsBruteSearch = bruteSearch
+				log.Printf("[上下文服务] 检测到 Vearch 存储，启用暴力搜索参数: %d", bruteSearch)
+			} else {
+				log.Printf("[上下文服务] 检测到 %s 存储，忽略暴力搜索参数", s.vectorStore.GetProvider())
+			}
+		}
+	}
+	return searchOptions
 }
 
 // GetUserIDFromSessionID 从会话ID获取用户ID - 简化版本
@@ -6120,18 +8480,22 @@ func (s *ContextService) GetUserIDFromSessionID(sessionID string) (string, error
 	}
 
 	if session == nil {
-		return "", fmt.Errorf("会话不存在: %s", sessionID)
+		return "", apperrors.ErrSessionNotFound.WithMessagef("会话不存在: %s", sessionID)
 	}
 
 	// 从metadata中获取userId
 	if session.Metadata != nil {
 		if userID, ok := session.Metadata["userId"].(string); ok && userID != "" {
+			// 用户ID会拼接到向量检索的过滤条件中，格式非法时尽早拒绝
+			if !models.IsValidUserID(userID) {
+				return "", apperrors.ErrInvalidArgument.WithMessagef("会话%s中的用户ID格式非法: %q", sessionID, userID)
+			}
 			log.Printf("[会话用户ID获取] 成功从会话%s获取用户ID: %s", sessionID, userID)
 			return userID, nil
 		}
 	}
 
-	return "", fmt.Errorf("会话%s中未找到用户ID", sessionID)
+	return "", apperrors.ErrUserNotInitialized.WithMessagef("会话%s中未找到用户ID", sessionID)
 }
 
 // buildConceptRelatedRelations 构建概念相关关系
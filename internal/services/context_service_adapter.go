@@ -194,7 +194,7 @@ func (s *ContextServiceV2) RetrieveContext(ctx context.Context, req models.Retri
 	} else {
 		// 按会话ID检索
 		startTime := time.Now()
-		filter := fmt.Sprintf(`session_id="%s"`, req.SessionID)
+		filter := "session_id=" + models.QuoteFilterValue(req.SessionID)
 		searchOptions.Limit = 10
 		searchResults, err = s.vectorStore.SearchByFilter(ctx, filter, searchOptions)
 		if err != nil {
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// maxConversationSplits 拆分批次 {batchId}-N 的最大序号
+const maxConversationSplits = 100
+
+// 对话记录的来源
+const (
+	conversationSourceSession     = "session"
+	conversationSourceVectorStore = "vector_store"
+)
+
+// GetConversation 按时间顺序还原会话或批次的完整对话记录
+// 优先使用会话中保存的原始消息；会话中已没有该批次时（例如已被清理），从向量存储按batchId及拆分批次({batchId}-N)读取
+func (s *ContextService) GetConversation(ctx context.Context, req models.GetConversationRequest) (*models.ConversationTranscript, error) {
+	if req.SessionID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("sessionId不能为空")
+	}
+
+	userID, err := s.GetUserIDFromSessionID(req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	sessionStore, err := s.GetUserSessionStore(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户会话存储失败: %w", err)
+	}
+
+	transcript := &models.ConversationTranscript{
+		SessionID: req.SessionID,
+		BatchID:   req.BatchID,
+		Messages:  []models.ConversationTurn{},
+	}
+
+	// 批次可能属于同一用户的其他会话，以向量存储记录中的会话ID为准
+	var records []models.SearchResult
+	if req.BatchID != "" {
+		records, err = s.searchConversationBatch(ctx, req.BatchID)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			if sessionID, _ := record.Fields["session_id"].(string); sessionID != "" && sessionID != req.SessionID {
+				if _, err := sessionStore.GetSessionSnapshot(sessionID); err == nil {
+					transcript.SessionID = sessionID
+				}
+				break
+			}
+		}
+	}
+
+	if snapshot, err := sessionStore.GetSessionSnapshot(transcript.SessionID); err == nil {
+		for _, message := range snapshot.Messages {
+			batchID, _ := message.Metadata["batchId"].(string)
+			if req.BatchID != "" && !isConversationBatch(batchID, req.BatchID) {
+				continue
+			}
+			transcript.Messages = append(transcript.Messages, models.ConversationTurn{
+				ID:        message.ID,
+				BatchID:   batchID,
+				Role:      message.Role,
+				Content:   message.Content,
+				Timestamp: message.Timestamp,
+			})
+		}
+	}
+	transcript.Source = conversationSourceSession
+
+	if len(transcript.Messages) == 0 && len(records) > 0 {
+		transcript.Source = conversationSourceVectorStore
+		for _, record := range records {
+			// 只返回当前用户会话存储中的会话的记录，避免通过batchId读取他人的对话
+			if sessionID, _ := record.Fields["session_id"].(string); sessionID != transcript.SessionID {
+				continue
+			}
+			if !req.IncludeArchived && isArchivedResult(record) {
+				continue
+			}
+			message := resultToMessage(record)
+			batchID, _ := message.Metadata["batchId"].(string)
+			if batchID == "" {
+				batchID = record.ID
+			}
+			transcript.Messages = append(transcript.Messages, models.ConversationTurn{
+				ID:        message.ID,
+				BatchID:   batchID,
+				Role:      message.Role,
+				Content:   message.Content,
+				Timestamp: message.Timestamp,
+			})
+		}
+	}
+
+	if req.BatchID != "" && len(transcript.Messages) == 0 {
+		return nil, apperrors.ErrNotFound.WithMessagef("未找到批次%s的对话记录", req.BatchID)
+	}
+
+	sortConversationTurns(transcript.Messages, req.BatchID)
+	seen := make(map[string]bool)
+	for _, turn := range transcript.Messages {
+		if turn.BatchID != "" && !seen[turn.BatchID] {
+			seen[turn.BatchID] = true
+			transcript.Batches = append(transcript.Batches, turn.BatchID)
+		}
+	}
+
+	log.Printf("[对话记录] 会话=%s, 批次=%s, 来源=%s, 消息数=%d, 批次数=%d",
+		transcript.SessionID, req.BatchID, transcript.Source, len(transcript.Messages), len(transcript.Batches))
+	return transcript, nil
+}
+
+// searchConversationBatch 从向量存储读取批次及其拆分批次 {batchId}-1、{batchId}-2... 的记录，遇到第一个不存在的序号停止
+func (s *ContextService) searchConversationBatch(ctx context.Context, batchID string) ([]models.SearchResult, error) {
+	if s.vectorStore == nil && s.vectorService == nil {
+		return nil, nil
+	}
+
+	records, err := s.searchByID(ctx, batchID, "id")
+	if err != nil {
+		return nil, fmt.Errorf("按批次ID检索失败: %w", err)
+	}
+	for i := 1; i <= maxConversationSplits; i++ {
+		results, err := s.searchByID(ctx, fmt.Sprintf("%s-%d", batchID, i), "id")
+		if err != nil {
+			return nil, fmt.Errorf("按拆分批次ID检索失败: %w", err)
+		}
+		if len(results) == 0 {
+			break
+		}
+		records = append(records, results...)
+	}
+	return records, nil
+}
+
+// conversationSplitIndex 批次ID相对于请求批次的拆分序号：相同为0，{batchId}-N为N，不属于该批次时返回false
+func conversationSplitIndex(batchID, requested string) (int, bool) {
+	if batchID == requested {
+		return 0, true
+	}
+	suffix, ok := strings.CutPrefix(batchID, requested+"-")
+	if !ok {
+		return 0, false
+	}
+	index, err := strconv.Atoi(suffix)
+	if err != nil || index < 1 || index > maxConversationSplits || strconv.Itoa(index) != suffix {
+		return 0, false
+	}
+	return index, true
+}
+
+// isConversationBatch 批次ID是否为请求的批次或其拆分批次
+func isConversationBatch(batchID, requested string) bool {
+	_, ok := conversationSplitIndex(batchID, requested)
+	return ok
+}
+
+// sortConversationTurns 按拆分序号、时间排序，同一时间的消息保持写入顺序
+func sortConversationTurns(turns []models.ConversationTurn, requested string) {
+	sort.SliceStable(turns, func(i, j int) bool {
+		if requested != "" {
+			left, _ := conversationSplitIndex(turns[i].BatchID, requested)
+			right, _ := conversationSplitIndex(turns[j].BatchID, requested)
+			if left != right {
+				return left < right
+			}
+		}
+		return turns[i].Timestamp < turns[j].Timestamp
+	})
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestGetConversation 测试拆分批次合并为按序排列的对话记录，会话中没有该批次时从向量存储还原，且不返回其他会话的记录
+func TestGetConversation(t *testing.T) {
+	baseDir := t.TempDir()
+	sessionStore, err := store.NewSessionStore(baseDir)
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	manager := store.NewUserSessionManager(baseDir)
+	for sessionID, userID := range map[string]string{"s1": "user_a", "s2": "user_b"} {
+		session := models.NewSession(sessionID)
+		session.Metadata = map[string]interface{}{"userId": userID}
+		if err := sessionStore.SaveSession(session); err != nil {
+			t.Fatalf("保存会话失败: %v", err)
+		}
+	}
+
+	newMessage := func(sessionID, batchID, role, content string, timestamp int64) *models.Message {
+		message := models.NewMessage(sessionID, role, content, "text", "P2", map[string]interface{}{"batchId": batchID})
+		message.ID = batchID + "-" + role
+		message.Timestamp = timestamp
+		return message
+	}
+	userStore, err := manager.GetUserSessionStore("user_a")
+	if err != nil {
+		t.Fatalf("获取用户会话存储失败: %v", err)
+	}
+	if err := userStore.StoreMessages("s1", []*models.Message{
+		newMessage("s1", "b1-2", "user", "第二段提问", 100),
+		newMessage("s1", "b1-1", "user", "第一段提问", 100),
+		newMessage("s1", "b1-1", "assistant", "第一段回答", 100),
+		newMessage("s1", "b2", "user", "其他批次", 50),
+	}); err != nil {
+		t.Fatalf("存储消息失败: %v", err)
+	}
+
+	service := &ContextService{sessionStore: sessionStore, userSessionManager: manager, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+	for _, message := range []*models.Message{
+		newMessage("s1", "b3-1", "user", "已清理的提问", 10),
+		newMessage("s1", "b3-2", "assistant", "已清理的回答", 20),
+		newMessage("s2", "b4", "user", "其他用户的对话", 10),
+	} {
+		message.Vector, _ = vectorStore.GenerateEmbedding(message.Content)
+		if err := vectorStore.StoreMessage(message); err != nil {
+			t.Fatalf("StoreMessage failed: %v", err)
+		}
+	}
+
+	transcript, err := service.GetConversation(context.Background(), models.GetConversationRequest{SessionID: "s1", BatchID: "b1"})
+	if err != nil {
+		t.Fatalf("GetConversation failed: %v", err)
+	}
+	var contents []string
+	for _, turn := range transcript.Messages {
+		contents = append(contents, turn.Content)
+	}
+	if transcript.Source != "session" || len(contents) != 3 || contents[0] != "第一段提问" || contents[1] != "第一段回答" || contents[2] != "第二段提问" {
+		t.Errorf("拆分批次应按序号合并为一份记录: source=%s, %v", transcript.Source, contents)
+	}
+	if len(transcript.Batches) != 2 || transcript.Batches[0] != "b1-1" {
+		t.Errorf("批次列表错误: %v", transcript.Batches)
+	}
+
+	transcript, err = service.GetConversation(context.Background(), models.GetConversationRequest{SessionID: "s1", BatchID: "b3"})
+	if err != nil {
+		t.Fatalf("GetConversation failed: %v", err)
+	}
+	if transcript.Source != "vector_store" || len(transcript.Messages) != 2 || transcript.Messages[0].Role != "user" || transcript.Messages[1].Content != "已清理的回答" {
+		t.Errorf("应从向量存储还原批次: %+v", transcript)
+	}
+
+	if _, err := service.GetConversation(context.Background(), models.GetConversationRequest{SessionID: "s1", BatchID: "b4"}); err == nil {
+		t.Error("不应返回其他用户会话的对话记录")
+	}
+}
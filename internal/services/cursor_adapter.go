@@ -58,6 +58,11 @@ func NewCursorAdapter(contextService *ContextService, decisionService *DecisionS
 // AssociateCodeFile 关联代码文件到会话
 // 除了基本的文件关联外，还会提取代码特性并存储
 func (c *CursorAdapter) AssociateCodeFile(ctx context.Context, req models.MCPCodeAssociationRequest) error {
+	// 未指定语言时先推断，基础关联和特性提取使用同一语言
+	if req.Language == "" {
+		req.Language = c.contextService.InferCodeLanguage(req.FilePath, req.Content)
+	}
+
 	// 1. 调用基础的文件关联功能
 	if err := c.contextService.AssociateCodeFile(ctx, req); err != nil {
 		return fmt.Errorf("基础文件关联失败: %w", err)
@@ -477,6 +482,7 @@ func getLanguageFromExtension(ext string) string {
 		".rb":    "ruby",
 		".swift": "swift",
 		".kt":    "kotlin",
+		".rs":    "rust",
 	}
 
 	if lang, ok := langMap[strings.ToLower(ext)]; ok {
@@ -843,7 +849,8 @@ func (c *CursorAdapter) ExtractProgrammingContext(ctx context.Context, sessionID
 		}
 
 		// 使用文本搜索功能
-		results, err := c.contextService.vectorService.SearchWithTextAndFilters(ctx, query, 5, filters, false)
+		results, err := c.contextService.vectorService.SearchWithTextAndFilters(ctx, query, 5, filters, false, 0)
+		results = c.contextService.normalizeLegacyScores(results)
 
 		if err == nil && len(results) > 0 {
 			for _, result := range results {
@@ -869,7 +876,8 @@ func (c *CursorAdapter) ExtractProgrammingContext(ctx context.Context, sessionID
 			"sessionId":   sessionID,
 			"contentType": "text",
 		}
-		contextResults, err := c.contextService.vectorService.SearchWithTextAndFilters(ctx, query, 3, contextFilters, false)
+		contextResults, err := c.contextService.vectorService.SearchWithTextAndFilters(ctx, query, 3, contextFilters, false, 0)
+		contextResults = c.contextService.normalizeLegacyScores(contextResults)
 		if err == nil && len(contextResults) > 0 {
 			for _, result := range contextResults {
 				if content, ok := result.Fields["content"].(string); ok {
@@ -1127,7 +1135,7 @@ func (c *CursorAdapter) FormatProgrammingContext(ctx *models.ProgrammingContext)
 			if snippet.FilePath != "" {
 				filename = " (" + filepath.Base(snippet.FilePath) + ")"
 			}
-			sb.WriteString(fmt.Sprintf("%d. 相关度: %.4f%s\n", i+1, 1.0-snippet.Score, filename))
+			sb.WriteString(fmt.Sprintf("%d. 相关度: %.4f%s\n", i+1, snippet.Score, filename))
 			if snippet.Context != "" {
 				sb.WriteString("   " + snippet.Context + "\n")
 			}
@@ -1141,7 +1149,7 @@ func (c *CursorAdapter) FormatProgrammingContext(ctx *models.ProgrammingContext)
 		for i, ref := range ctx.RelatedContexts {
 			timeStr := time.Unix(ref.Timestamp, 0).Format("2006-01-02 15:04:05")
 			sb.WriteString(fmt.Sprintf("%d. [%s] %s类型 (相关度: %.4f)\n",
-				i+1, timeStr, getContextTypeName(ref.Type), 1.0-ref.RelevanceScore))
+				i+1, timeStr, getContextTypeName(ref.Type), ref.RelevanceScore))
 			sb.WriteString("   " + ref.Content + "\n\n")
 		}
 	}
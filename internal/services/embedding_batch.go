@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/contextkeeper/service/internal/metrics"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// batchEmbeddingProvider 获取支持批量生成向量的嵌入服务，与generateEmbeddingUncached的选择顺序一致
+// 未开启批量（EMBEDDING_BATCH_SIZE<=1）或当前嵌入服务不支持批量时返回nil
+func (s *ContextService) batchEmbeddingProvider() (models.BatchEmbeddingProvider, int) {
+	if s.config == nil || s.config.EmbeddingBatchSize <= 1 {
+		return nil, 0
+	}
+
+	var provider interface{}
+	switch {
+	case s.embeddingProvider != nil:
+		provider = s.embeddingProvider
+	case s.vectorStore != nil:
+		provider = s.vectorStore
+	case s.vectorService != nil:
+		provider = s.vectorService
+	}
+	batchProvider, ok := provider.(models.BatchEmbeddingProvider)
+	if !ok {
+		return nil, 0
+	}
+	return batchProvider, s.config.EmbeddingBatchSize
+}
+
+// generateEmbeddings 为多条内容生成向量，返回的向量与输入内容按下标一一对应
+// 嵌入服务支持批量时，缓存未命中的内容按EMBEDDING_BATCH_SIZE分组，每组一次请求；
+// 不支持批量时逐条生成，某组批量请求失败时该组降级为逐条生成
+func (s *ContextService) generateEmbeddings(contents []string) ([][]float32, error) {
+	vectors := make([][]float32, len(contents))
+
+	provider, batchSize := s.batchEmbeddingProvider()
+	if provider == nil {
+		for i, content := range contents {
+			vector, err := s.generateEmbedding(content)
+			if err != nil {
+				return nil, err
+			}
+			vectors[i] = vector
+		}
+		return vectors, nil
+	}
+
+	// 先查缓存，只为未命中的内容请求嵌入服务
+	pending := make([]int, 0, len(contents))
+	for i, content := range contents {
+		if s.embeddingCache != nil {
+			vector, ok := s.embeddingCache.get(embeddingCacheKey(content))
+			metrics.ObserveCacheLookup("embedding", ok)
+			if ok {
+				vectors[i] = vector
+				continue
+			}
+		}
+		pending = append(pending, i)
+	}
+
+	for start := 0; start < len(pending); start += batchSize {
+		group := pending[start:min(start+batchSize, len(pending))]
+		if err := s.generateEmbeddingGroup(provider, contents, group, vectors); err != nil {
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
+
+// generateEmbeddingGroup 为一组内容生成向量并写入vectors的对应下标，批量请求失败时逐条生成
+func (s *ContextService) generateEmbeddingGroup(provider models.BatchEmbeddingProvider, contents []string, group []int, vectors [][]float32) error {
+	texts := make([]string, len(group))
+	for i, index := range group {
+		texts[i] = contents[index]
+	}
+
+	start := time.Now()
+	batch, err := callWithEmbeddingTimeout(s.embeddingTimeout(), func(context.Context) ([][]float32, error) {
+		return provider.GenerateEmbeddings(texts)
+	})
+	if err == nil && len(batch) != len(texts) {
+		err = fmt.Errorf("返回的向量数%d与文本数%d不一致", len(batch), len(texts))
+	}
+	metrics.ObserveEmbedding(err, time.Since(start))
+
+	if err != nil {
+		log.Printf("⚠️ [批量向量] 批量生成%d条向量失败，降级为逐条生成: %v", len(texts), err)
+		batch = make([][]float32, len(texts))
+		for i, text := range texts {
+			vector, err := s.generateEmbeddingUncached(text)
+			if err != nil {
+				return err
+			}
+			batch[i] = vector
+		}
+	} else {
+		log.Printf("[批量向量] 一次请求生成%d条向量，耗时: %v", len(texts), time.Since(start))
+	}
+
+	for i, index := range group {
+		batch[i] = s.normalizeEmbedding(batch[i])
+		vectors[index] = batch[i]
+		if s.embeddingCache != nil {
+			s.embeddingCache.put(embeddingCacheKey(texts[i]), batch[i])
+		}
+	}
+	return nil
+}
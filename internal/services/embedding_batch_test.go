@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+)
+
+// batchTestEmbeddingProvider 以文本长度作为向量的测试嵌入服务，记录批量请求的大小
+type batchTestEmbeddingProvider struct {
+	batches  []int
+	single   int
+	batchErr error
+}
+
+func (p *batchTestEmbeddingProvider) GenerateEmbedding(text string) ([]float32, error) {
+	p.single++
+	return []float32{float32(len(text))}, nil
+}
+
+func (p *batchTestEmbeddingProvider) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	p.batches = append(p.batches, len(texts))
+	if p.batchErr != nil {
+		return nil, p.batchErr
+	}
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = []float32{float32(len(text))}
+	}
+	return vectors, nil
+}
+
+func (p *batchTestEmbeddingProvider) GetEmbeddingDimension() int { return 1 }
+
+// TestGenerateEmbeddingsBatching 测试按批量大小分组请求、向量按下标对应，批量失败时降级为逐条生成
+func TestGenerateEmbeddingsBatching(t *testing.T) {
+	contents := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	assertVectors := func(vectors [][]float32) {
+		t.Helper()
+		for i, vector := range vectors {
+			if len(vector) != 1 || int(vector[0]) != len(contents[i]) {
+				t.Errorf("第%d条向量与内容不对应: %v", i, vector)
+			}
+		}
+	}
+
+	provider := &batchTestEmbeddingProvider{}
+	s := &ContextService{
+		config:            &config.Config{EmbeddingBatchSize: 2},
+		embeddingProvider: provider,
+		embeddingCache:    newEmbeddingCache(100, 0),
+	}
+	vectors, err := s.generateEmbeddings(contents)
+	if err != nil {
+		t.Fatalf("批量生成向量失败: %v", err)
+	}
+	assertVectors(vectors)
+	if len(provider.batches) != 3 || provider.batches[0] != 2 || provider.batches[2] != 1 || provider.single != 0 {
+		t.Errorf("批量请求分组错误: batches=%v, single=%d", provider.batches, provider.single)
+	}
+
+	// 已缓存的内容不再请求
+	provider.batches = nil
+	if _, err := s.generateEmbeddings(append(contents, "ffffff")); err != nil {
+		t.Fatalf("批量生成向量失败: %v", err)
+	}
+	if len(provider.batches) != 1 || provider.batches[0] != 1 {
+		t.Errorf("缓存命中的内容不应再请求: batches=%v", provider.batches)
+	}
+
+	// 批量失败时逐条生成
+	failing := &batchTestEmbeddingProvider{batchErr: errors.New("batch unsupported")}
+	s = &ContextService{config: &config.Config{EmbeddingBatchSize: 10}, embeddingProvider: failing}
+	vectors, err = s.generateEmbeddings(contents)
+	if err != nil {
+		t.Fatalf("降级逐条生成失败: %v", err)
+	}
+	assertVectors(vectors)
+	if failing.single != len(contents) {
+		t.Errorf("批量失败后应逐条生成%d次，实际%d次", len(contents), failing.single)
+	}
+
+	// 未开启批量时逐条生成
+	serial := &batchTestEmbeddingProvider{}
+	s = &ContextService{config: &config.Config{EmbeddingBatchSize: 1}, embeddingProvider: serial}
+	if _, err := s.generateEmbeddings(contents); err != nil {
+		t.Fatalf("逐条生成失败: %v", err)
+	}
+	if len(serial.batches) != 0 || serial.single != len(contents) {
+		t.Errorf("未开启批量时不应发送批量请求: batches=%v, single=%d", serial.batches, serial.single)
+	}
+}
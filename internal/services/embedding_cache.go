@@ -0,0 +1,142 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// EmbeddingCacheStats 向量缓存统计信息
+type EmbeddingCacheStats struct {
+	Enabled bool    `json:"enabled"`
+	Size    int     `json:"size"`
+	MaxSize int     `json:"maxSize"`
+	TTL     string  `json:"ttl"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+}
+
+// embeddingCacheEntry 缓存条目
+type embeddingCacheEntry struct {
+	key       string
+	vector    []float32
+	expiresAt time.Time
+}
+
+// embeddingCache 按内容SHA-256缓存向量的LRU缓存，并发安全
+type embeddingCache struct {
+	mu      sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	order   *list.List               // 队首为最近使用
+	entries map[string]*list.Element // key -> order中的元素
+	hits    int64
+	misses  int64
+}
+
+// newEmbeddingCache 创建向量缓存，maxSize<=0时返回nil表示禁用；ttl<=0表示不过期
+func newEmbeddingCache(maxSize int, ttl time.Duration) *embeddingCache {
+	if maxSize <= 0 {
+		return nil
+	}
+	return &embeddingCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// embeddingCacheKey 计算内容的缓存键
+func embeddingCacheKey(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// get 读取缓存，命中时返回向量副本
+func (c *embeddingCache) get(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := element.Value.(*embeddingCacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		c.misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits++
+
+	vector := make([]float32, len(entry.vector))
+	copy(vector, entry.vector)
+	return vector, true
+}
+
+// put 写入缓存，超过容量时淘汰最久未使用的条目
+func (c *embeddingCache) put(key string, vector []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stored := make([]float32, len(vector))
+	copy(stored, vector)
+	expiresAt := time.Now().Add(c.ttl)
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*embeddingCacheEntry)
+		entry.vector = stored
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&embeddingCacheEntry{
+		key:       key,
+		vector:    stored,
+		expiresAt: expiresAt,
+	})
+
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*embeddingCacheEntry).key)
+	}
+}
+
+// clear 清空缓存条目，保留命中统计
+func (c *embeddingCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// stats 获取缓存统计信息
+func (c *embeddingCache) stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := EmbeddingCacheStats{
+		Enabled: true,
+		Size:    c.order.Len(),
+		MaxSize: c.maxSize,
+		TTL:     c.ttl.String(),
+		Hits:    c.hits,
+		Misses:  c.misses,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+)
+
+// countingEmbeddingProvider 记录调用次数的嵌入服务
+type countingEmbeddingProvider struct {
+	calls int
+}
+
+func (p *countingEmbeddingProvider) GenerateEmbedding(text string) ([]float32, error) {
+	p.calls++
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func (p *countingEmbeddingProvider) GetEmbeddingDimension() int { return 2 }
+
+// TestEmbeddingCacheEviction 测试超过容量时淘汰最久未使用的条目，读取会刷新使用顺序
+func TestEmbeddingCacheEviction(t *testing.T) {
+	cache := newEmbeddingCache(2, 0)
+	cache.put("a", []float32{1})
+	cache.put("b", []float32{2})
+
+	// 读取a后b成为最久未使用的条目
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("a应命中缓存")
+	}
+	cache.put("c", []float32{3})
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("b应被淘汰")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("%s应保留在缓存中", key)
+		}
+	}
+
+	stats := cache.stats()
+	if stats.Size != 2 || stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("统计错误: %+v", stats)
+	}
+	if newEmbeddingCache(0, time.Minute) != nil {
+		t.Error("maxSize<=0时应禁用缓存")
+	}
+}
+
+// TestEmbeddingCacheTTLAndCopy 测试过期条目按未命中处理，返回的向量与缓存互不影响
+func TestEmbeddingCacheTTLAndCopy(t *testing.T) {
+	cache := newEmbeddingCache(4, time.Minute)
+	vector := []float32{1, 2}
+	cache.put("k", vector)
+	vector[0] = 9
+
+	got, ok := cache.get("k")
+	if !ok || got[0] != 1 {
+		t.Fatalf("写入后修改原向量不应影响缓存: %v, %v", got, ok)
+	}
+	got[1] = 9
+	if again, _ := cache.get("k"); again[1] != 2 {
+		t.Errorf("修改返回的向量不应影响缓存: %v", again)
+	}
+
+	cache.entries["k"].Value.(*embeddingCacheEntry).expiresAt = time.Now().Add(-time.Second)
+	if _, ok := cache.get("k"); ok {
+		t.Error("过期条目不应命中")
+	}
+	if stats := cache.stats(); stats.Size != 0 || stats.Misses != 1 {
+		t.Errorf("过期条目应被移除并计为未命中: %+v", stats)
+	}
+}
+
+// TestGenerateEmbeddingUsesCache 测试相同内容只调用一次嵌入服务，命中统计通过GetEmbeddingCacheStats暴露
+func TestGenerateEmbeddingUsesCache(t *testing.T) {
+	provider := &countingEmbeddingProvider{}
+	s := &ContextService{
+		config:            &config.Config{},
+		embeddingProvider: provider,
+		embeddingCache:    newEmbeddingCache(8, time.Minute),
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.generateEmbedding("相同的内容"); err != nil {
+			t.Fatalf("生成向量失败: %v", err)
+		}
+	}
+	if _, err := s.generateEmbedding("另一段内容"); err != nil {
+		t.Fatalf("生成向量失败: %v", err)
+	}
+
+	if provider.calls != 2 {
+		t.Errorf("期望调用嵌入服务2次，实际%d次", provider.calls)
+	}
+	stats := s.GetEmbeddingCacheStats()
+	if !stats.Enabled || stats.Hits != 2 || stats.Misses != 2 || stats.HitRate != 0.5 {
+		t.Errorf("缓存统计错误: %+v", stats)
+	}
+
+	disabled := &ContextService{config: &config.Config{}, embeddingProvider: provider}
+	if stats := disabled.GetEmbeddingCacheStats(); stats.Enabled {
+		t.Errorf("未启用缓存时统计应标记为禁用: %+v", stats)
+	}
+}
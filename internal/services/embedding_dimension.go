@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// =============================================================================
+// 向量维度探测：启动时生成一次探测向量，校验与VECTOR_DB_DIMENSION是否一致
+// =============================================================================
+
+// embeddingDimensionProbeText 探测向量使用的固定文本
+const embeddingDimensionProbeText = "context-keeper embedding dimension probe"
+
+// ErrEmbeddingDimensionMismatch 嵌入模型输出维度与配置的向量库维度不一致
+var ErrEmbeddingDimensionMismatch = errors.New("嵌入向量维度与VECTOR_DB_DIMENSION不一致")
+
+// DetectEmbeddingDimension 生成探测向量并校验维度，成功后缓存探测到的维度
+// configured<=0时只探测不校验；维度不一致时返回ErrEmbeddingDimensionMismatch，缓存保持不变
+// 同时检查探测向量的模长，未开启归一化但向量明显未归一化时输出警告
+func (s *ContextService) DetectEmbeddingDimension(configured int) (int, error) {
+	vector, err := s.generateEmbeddingUncached(embeddingDimensionProbeText)
+	if err != nil {
+		return 0, fmt.Errorf("生成探测向量失败: %w", err)
+	}
+
+	detected := len(vector)
+	if detected == 0 {
+		return 0, fmt.Errorf("探测向量为空")
+	}
+	if configured > 0 && detected != configured {
+		return detected, fmt.Errorf("%w: 配置维度=%d, 嵌入模型实际维度=%d", ErrEmbeddingDimensionMismatch, configured, detected)
+	}
+
+	s.embeddingDimensionMutex.Lock()
+	s.embeddingDimension = detected
+	s.embeddingDimensionMutex.Unlock()
+
+	norm := s.warnIfEmbeddingUnnormalized(vector)
+	log.Printf("✅ [向量维度] 探测到嵌入向量维度: %d, 模长: %.4f", detected, norm)
+	return detected, nil
+}
+
+// EmbeddingDimension 获取向量维度：优先使用启动时探测到的维度，未探测时使用配置值
+func (s *ContextService) EmbeddingDimension() int {
+	if detected := s.detectedEmbeddingDimension(); detected > 0 {
+		return detected
+	}
+	if s.config != nil {
+		return s.config.VectorDBDimension
+	}
+	return 0
+}
+
+// detectedEmbeddingDimension 获取启动时探测到的维度，未探测时返回0
+func (s *ContextService) detectedEmbeddingDimension() int {
+	s.embeddingDimensionMutex.RLock()
+	defer s.embeddingDimensionMutex.RUnlock()
+	return s.embeddingDimension
+}
+
+// acceptsEmbeddingDimension 检查向量长度是否与探测到的维度一致，未探测时不做限制
+func (s *ContextService) acceptsEmbeddingDimension(vector []float32) bool {
+	dimension := s.detectedEmbeddingDimension()
+	return dimension <= 0 || len(vector) == dimension
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+)
+
+// fixedDimensionEmbeddingProvider 返回固定维度向量的嵌入服务
+type fixedDimensionEmbeddingProvider struct {
+	dimension int
+}
+
+func (p *fixedDimensionEmbeddingProvider) GenerateEmbedding(text string) ([]float32, error) {
+	return make([]float32, p.dimension), nil
+}
+
+func (p *fixedDimensionEmbeddingProvider) GetEmbeddingDimension() int {
+	return p.dimension
+}
+
+// TestDetectEmbeddingDimensionMismatch 测试嵌入维度与配置不一致时返回ErrEmbeddingDimensionMismatch且不缓存
+func TestDetectEmbeddingDimensionMismatch(t *testing.T) {
+	s := &ContextService{
+		config:            &config.Config{VectorDBDimension: 1536},
+		embeddingProvider: &fixedDimensionEmbeddingProvider{dimension: 1024},
+	}
+
+	detected, err := s.DetectEmbeddingDimension(1536)
+	if !errors.Is(err, ErrEmbeddingDimensionMismatch) {
+		t.Fatalf("期望维度不一致错误，实际: %v", err)
+	}
+	if detected != 1024 {
+		t.Errorf("期望探测到1024维，实际%d", detected)
+	}
+	if s.EmbeddingDimension() != 1536 {
+		t.Errorf("校验失败时不应缓存探测结果，实际维度%d", s.EmbeddingDimension())
+	}
+}
+
+// TestDetectEmbeddingDimension 测试维度一致时缓存探测结果并用于校验向量长度
+func TestDetectEmbeddingDimension(t *testing.T) {
+	s := &ContextService{embeddingProvider: &fixedDimensionEmbeddingProvider{dimension: 1024}}
+
+	if _, err := s.DetectEmbeddingDimension(1024); err != nil {
+		t.Fatalf("探测失败: %v", err)
+	}
+	if s.EmbeddingDimension() != 1024 {
+		t.Errorf("期望缓存1024维，实际%d", s.EmbeddingDimension())
+	}
+	if s.acceptsEmbeddingDimension(make([]float32, 768)) {
+		t.Error("长度不一致的向量不应通过校验")
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 嵌入维度漂移：更换嵌入模型后，旧记忆的向量维度与查询向量不一致，无法参与相似度比较
+// =============================================================================
+
+// 记录生成向量所用嵌入模型和维度的元数据键
+const (
+	embeddingDimMetadataKey   = "embedding_dim"
+	embeddingModelMetadataKey = "embedding_model"
+)
+
+// reindexEndpoint 重建用户记忆向量的管理接口
+const reindexEndpoint = "POST /management/users/{userId}/reindex?confirm=true"
+
+// embeddingModelName 当前使用的嵌入模型，格式为"提供商/模型"，未配置模型名时只返回提供商
+func (s *ContextService) embeddingModelName() string {
+	if s.config == nil {
+		return ""
+	}
+	provider := strings.ToLower(strings.TrimSpace(s.config.EmbeddingProvider))
+	switch provider {
+	case "openai":
+		return provider + "/" + s.config.OpenAIEmbeddingModel
+	case "":
+		return "aliyun"
+	default:
+		return provider
+	}
+}
+
+// tagEmbedding 在元数据中记录向量维度和嵌入模型，重建向量时覆盖旧值；向量为空时不记录
+func (s *ContextService) tagEmbedding(metadata map[string]interface{}, vector []float32) map[string]interface{} {
+	if len(vector) == 0 {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata[embeddingDimMetadataKey] = len(vector)
+	if model := s.embeddingModelName(); model != "" {
+		metadata[embeddingModelMetadataKey] = model
+	}
+	return metadata
+}
+
+// vectorStoreDimension 向量存储的维度，未配置向量存储时返回0
+func (s *ContextService) vectorStoreDimension() int {
+	if s.vectorStore != nil {
+		return s.vectorStore.GetEmbeddingDimension()
+	}
+	if s.vectorService != nil {
+		return s.vectorService.GetDimension()
+	}
+	return 0
+}
+
+// recordEmbeddingDimension 记录写入时的向量维度，未记录（早期写入的数据）时返回false
+func recordEmbeddingDimension(result models.SearchResult) (int, bool) {
+	switch dim := parseResultMetadata(result)[embeddingDimMetadataKey].(type) {
+	case float64:
+		return int(dim), dim > 0
+	case int:
+		return dim, dim > 0
+	}
+	return 0, false
+}
+
+// filterByEmbeddingDimension 去掉记录维度与查询向量不一致的结果，返回保留的结果和跳过的数量
+func filterByEmbeddingDimension(results []models.SearchResult, queryDimension int) ([]models.SearchResult, int) {
+	filtered := results[:0:0]
+	skipped := 0
+	for _, result := range results {
+		if dim, ok := recordEmbeddingDimension(result); ok && dim != queryDimension {
+			skipped++
+			continue
+		}
+		filtered = append(filtered, result)
+	}
+	return filtered, skipped
+}
+
+// detectEmbeddingDrift 查询向量维度与向量存储维度不一致时，统计用户无法被向量检索召回的记忆数
+// 未记录维度的早期记录按向量存储的维度计算；维度一致时返回nil，不扫描用户记录
+func (s *ContextService) detectEmbeddingDrift(ctx context.Context, userID string, queryDimension int) *models.EmbeddingDriftNotice {
+	storeDimension := s.vectorStoreDimension()
+	if storeDimension <= 0 || storeDimension == queryDimension {
+		return nil
+	}
+
+	notice := s.newEmbeddingDriftNotice(queryDimension, 0)
+	notice.StoreDimension = storeDimension
+	records, err := s.searchByUserID(ctx, userID, maxReindexScan)
+	if err != nil {
+		log.Printf("⚠️ [向量维度] 统计维度不一致的记忆失败: %v", err)
+		return notice
+	}
+	for _, record := range records {
+		dim, ok := recordEmbeddingDimension(record)
+		if !ok {
+			dim = storeDimension
+		}
+		if dim != queryDimension {
+			notice.SkippedCount++
+		}
+	}
+	notice.Message = embeddingDriftMessage(notice)
+	log.Printf("⚠️ [向量维度] 查询向量维度%d与向量存储维度%d不一致，用户%s有%d条记忆无法参与向量检索，需重建向量",
+		queryDimension, storeDimension, userID, notice.SkippedCount)
+	return notice
+}
+
+// newEmbeddingDriftNotice 创建维度不一致提示
+func (s *ContextService) newEmbeddingDriftNotice(queryDimension, skipped int) *models.EmbeddingDriftNotice {
+	notice := &models.EmbeddingDriftNotice{
+		QueryDimension:  queryDimension,
+		EmbeddingModel:  s.embeddingModelName(),
+		SkippedCount:    skipped,
+		ReindexEndpoint: reindexEndpoint,
+	}
+	notice.Message = embeddingDriftMessage(notice)
+	return notice
+}
+
+// embeddingDriftMessage 提示的说明文字
+func embeddingDriftMessage(notice *models.EmbeddingDriftNotice) string {
+	return fmt.Sprintf("有%d条记忆由其他维度的嵌入模型生成（当前查询向量维度%d），在重建向量前无法被检索到，请调用 %s 重建",
+		notice.SkippedCount, notice.QueryDimension, notice.ReindexEndpoint)
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestEmbeddingDrift 测试写入时记录向量维度，查询向量维度不一致时统计无法检索的记忆并跳过维度不一致的结果
+func TestEmbeddingDrift(t *testing.T) {
+	service := &ContextService{config: &config.Config{EmbeddingProvider: "openai", OpenAIEmbeddingModel: "text-embedding-3-small"}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+
+	for i, content := range []string{"修复登录超时", "升级数据库驱动"} {
+		memory := models.NewMemory("s1", content, "P1", nil)
+		memory.ID = []string{"m1", "m2"}[i]
+		memory.UserID = "user_a"
+		memory.Vector, _ = vectorStore.GenerateEmbedding(content)
+		if err := service.storeMemory(memory); err != nil {
+			t.Fatalf("存储记忆失败: %v", err)
+		}
+	}
+	records, err := service.searchByID(context.Background(), "m1", "id")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("读取记忆失败: %v, %v", records, err)
+	}
+	if dim, ok := recordEmbeddingDimension(records[0]); !ok || dim != 64 {
+		t.Errorf("应记录向量维度64，实际%d", dim)
+	}
+	if model := parseResultMetadata(records[0])[embeddingModelMetadataKey]; model != "openai/text-embedding-3-small" {
+		t.Errorf("应记录嵌入模型，实际%v", model)
+	}
+
+	if notice := service.detectEmbeddingDrift(context.Background(), "user_a", 64); notice != nil {
+		t.Errorf("维度一致时不应返回提示: %+v", notice)
+	}
+	notice := service.detectEmbeddingDrift(context.Background(), "user_a", 1024)
+	if notice == nil || notice.SkippedCount != 2 || notice.StoreDimension != 64 || notice.ReindexEndpoint == "" {
+		t.Fatalf("更换模型后应提示2条记忆需要重建: %+v", notice)
+	}
+
+	mixed := []models.SearchResult{
+		{ID: "old", Fields: map[string]interface{}{"metadata": `{"embedding_dim":64}`}},
+		{ID: "new", Fields: map[string]interface{}{"metadata": `{"embedding_dim":1024}`}},
+		{ID: "untagged", Fields: map[string]interface{}{"metadata": "{}"}},
+	}
+	kept, skipped := filterByEmbeddingDimension(mixed, 1024)
+	if skipped != 1 || len(kept) != 2 || kept[0].ID != "new" || kept[1].ID != "untagged" {
+		t.Errorf("应只跳过维度不一致的记录: kept=%+v, skipped=%d", kept, skipped)
+	}
+}
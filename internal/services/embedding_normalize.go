@@ -0,0 +1,54 @@
+package services
+
+import (
+	"log"
+	"math"
+)
+
+// unnormalizedNormTolerance 探测向量的模长与1相差超过该值时视为嵌入服务未归一化
+const unnormalizedNormTolerance = 0.05
+
+// vectorNorm 计算向量的L2模长
+func vectorNorm(vector []float32) float64 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum)
+}
+
+// normalizeVector 返回L2归一化后的新向量，零向量原样返回
+func normalizeVector(vector []float32) []float32 {
+	norm := vectorNorm(vector)
+	if norm == 0 || math.Abs(norm-1) < 1e-6 {
+		return vector
+	}
+	normalized := make([]float32, len(vector))
+	for i, v := range vector {
+		normalized[i] = float32(float64(v) / norm)
+	}
+	return normalized
+}
+
+// embeddingNormalizeEnabled 是否开启向量归一化
+func (s *ContextService) embeddingNormalizeEnabled() bool {
+	return s.config != nil && s.config.EmbeddingNormalize
+}
+
+// normalizeEmbedding 开启EMBEDDING_NORMALIZE时对向量做L2归一化，未开启时原样返回
+// 存储向量和查询向量都经过这里，保证相似度比较在同一尺度上
+func (s *ContextService) normalizeEmbedding(vector []float32) []float32 {
+	if !s.embeddingNormalizeEnabled() || len(vector) == 0 {
+		return vector
+	}
+	return normalizeVector(vector)
+}
+
+// warnIfEmbeddingUnnormalized 未开启归一化但探测向量的模长明显偏离1时提示，返回探测向量的模长
+func (s *ContextService) warnIfEmbeddingUnnormalized(vector []float32) float64 {
+	norm := vectorNorm(vector)
+	if !s.embeddingNormalizeEnabled() && math.Abs(norm-1) > unnormalizedNormTolerance {
+		log.Printf("⚠️ [向量归一化] 嵌入服务返回的向量未归一化(模长=%.4f)，向量库不做归一化时余弦相似度会失真，建议开启EMBEDDING_NORMALIZE", norm)
+	}
+	return norm
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+)
+
+// scaledEmbeddingProvider 按文本返回预设的未归一化向量
+type scaledEmbeddingProvider struct {
+	vectors map[string][]float32
+}
+
+func (p *scaledEmbeddingProvider) GenerateEmbedding(text string) ([]float32, error) {
+	return append([]float32(nil), p.vectors[text]...), nil
+}
+
+func (p *scaledEmbeddingProvider) GetEmbeddingDimension() int {
+	return 2
+}
+
+// dotProduct 计算两个向量的点积，向量归一化后即为余弦相似度
+func dotProduct(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// TestNormalizeEmbeddingCosineScores 测试开启归一化后存储和查询向量为单位向量，点积等于原向量的余弦相似度；未开启时原样返回
+func TestNormalizeEmbeddingCosineScores(t *testing.T) {
+	provider := &scaledEmbeddingProvider{vectors: map[string][]float32{
+		"query":      {3, 4},
+		"same":       {6, 8},
+		"orthogonal": {40, -30},
+		"diagonal":   {0, 5},
+	}}
+	s := &ContextService{config: &config.Config{EmbeddingNormalize: true}, embeddingProvider: provider}
+
+	query, err := s.generateEmbedding("query")
+	if err != nil {
+		t.Fatalf("生成向量失败: %v", err)
+	}
+	if norm := vectorNorm(query); math.Abs(norm-1) > 1e-6 {
+		t.Fatalf("归一化后的模长应为1，实际%f", norm)
+	}
+
+	expected := map[string]float64{"same": 1, "orthogonal": 0, "diagonal": 0.8}
+	for text, want := range expected {
+		stored, err := s.generateEmbedding(text)
+		if err != nil {
+			t.Fatalf("生成向量失败: %v", err)
+		}
+		if got := dotProduct(query, stored); math.Abs(got-want) > 1e-6 {
+			t.Errorf("%s的余弦相似度应为%.4f，实际%.4f", text, want, got)
+		}
+	}
+
+	if zero := normalizeVector([]float32{0, 0}); zero[0] != 0 || zero[1] != 0 {
+		t.Errorf("零向量应原样返回: %v", zero)
+	}
+
+	s.config.EmbeddingNormalize = false
+	if raw := s.normalizeEmbedding([]float32{3, 4}); raw[0] != 3 || raw[1] != 4 {
+		t.Errorf("未开启归一化时应原样返回: %v", raw)
+	}
+	if norm := s.warnIfEmbeddingUnnormalized([]float32{3, 4}); norm != 5 {
+		t.Errorf("应返回探测向量的模长5，实际%f", norm)
+	}
+}
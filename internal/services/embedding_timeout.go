@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// embeddingTimeout 获取单次嵌入请求的超时时间，<=0表示不限制
+func (s *ContextService) embeddingTimeout() time.Duration {
+	if s.config == nil {
+		return 0
+	}
+	return s.config.EmbeddingTimeout
+}
+
+// embeddingResult 嵌入请求在后台goroutine中的执行结果
+type embeddingResult[T any] struct {
+	value T
+	err   error
+}
+
+// embeddingGenerator 单条文本转向量的最小接口，嵌入服务、向量存储和传统向量服务均满足
+type embeddingGenerator interface {
+	GenerateEmbedding(text string) ([]float32, error)
+}
+
+// generateEmbeddingWithContext 服务支持上下文时传入上下文，否则调用不带上下文的接口
+func generateEmbeddingWithContext(ctx context.Context, generator embeddingGenerator, text string) ([]float32, error) {
+	if provider, ok := generator.(models.ContextEmbeddingProvider); ok {
+		return provider.GenerateEmbeddingWithContext(ctx, text)
+	}
+	return generator.GenerateEmbedding(text)
+}
+
+// callWithEmbeddingTimeout 在超时限制内执行一次嵌入请求
+// 超时后取消传给call的上下文并直接返回包装了context.DeadlineExceeded的错误；不接收上下文的嵌入服务
+// 在后台完成请求后结果被丢弃。调用方可据此降级（如检索时改为按会话ID检索）
+func callWithEmbeddingTimeout[T any](timeout time.Duration, call func(ctx context.Context) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return call(context.Background())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan embeddingResult[T], 1)
+	go func() {
+		value, err := call(ctx)
+		done <- embeddingResult[T]{value: value, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.value, result.err
+	case <-ctx.Done():
+		var zero T
+		return zero, fmt.Errorf("生成向量超时(%v)，嵌入服务响应过慢: %w", timeout, ctx.Err())
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// slowEmbeddingProvider 模拟响应缓慢的嵌入服务
+type slowEmbeddingProvider struct {
+	delay time.Duration
+}
+
+func (p *slowEmbeddingProvider) GenerateEmbedding(text string) ([]float32, error) {
+	time.Sleep(p.delay)
+	return []float32{1}, nil
+}
+
+func (p *slowEmbeddingProvider) GetEmbeddingDimension() int { return 1 }
+
+// cancellableEmbeddingProvider 支持上下文的嵌入服务，记录请求是否因上下文取消而提前返回
+type cancellableEmbeddingProvider struct {
+	slowEmbeddingProvider
+	cancelled chan struct{}
+}
+
+func (p *cancellableEmbeddingProvider) GenerateEmbeddingWithContext(ctx context.Context, text string) ([]float32, error) {
+	select {
+	case <-time.After(p.delay):
+		return []float32{1}, nil
+	case <-ctx.Done():
+		close(p.cancelled)
+		return nil, ctx.Err()
+	}
+}
+
+// newEmbeddingTimeoutService 创建使用指定嵌入服务、超时20ms的服务
+func newEmbeddingTimeoutService(provider models.EmbeddingProvider) *ContextService {
+	return &ContextService{
+		config:            &config.Config{EmbeddingTimeout: 20 * time.Millisecond},
+		embeddingProvider: provider,
+	}
+}
+
+// TestGenerateEmbeddingTimeout 测试嵌入服务响应过慢时按EMBEDDING_TIMEOUT返回可重试的超时错误，未超时时正常返回
+func TestGenerateEmbeddingTimeout(t *testing.T) {
+	s := newEmbeddingTimeoutService(&slowEmbeddingProvider{delay: time.Second})
+
+	start := time.Now()
+	_, err := s.generateEmbedding("慢请求")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("超时未生效，耗时: %v", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || !apperrors.IsRetryable(err) {
+		t.Fatalf("期望可重试的超时错误，得到: %v", err)
+	}
+
+	fast := newEmbeddingTimeoutService(&slowEmbeddingProvider{delay: time.Millisecond})
+	if vector, err := fast.generateEmbedding("快请求"); err != nil || len(vector) != 1 {
+		t.Errorf("未超时的请求应正常返回: %v, %v", vector, err)
+	}
+}
+
+// TestGenerateEmbeddingTimeoutCancelsContext 测试支持上下文的嵌入服务在超时后收到取消信号
+func TestGenerateEmbeddingTimeoutCancelsContext(t *testing.T) {
+	provider := &cancellableEmbeddingProvider{
+		slowEmbeddingProvider: slowEmbeddingProvider{delay: time.Second},
+		cancelled:             make(chan struct{}),
+	}
+	s := newEmbeddingTimeoutService(provider)
+
+	if _, err := s.generateEmbedding("慢请求"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望超时错误，得到: %v", err)
+	}
+	select {
+	case <-provider.cancelled:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("超时后应取消传给嵌入服务的上下文")
+	}
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/timeline"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 存储引擎可用性：启动时校验已启用的TimescaleDB和Neo4j的配置与连通性，
+// 智能存储跳过不可用的引擎；状态变化时才输出日志，避免每次存储重复告警
+// =============================================================================
+
+// 多维存储引擎名称，与就绪探测中的后端名称一致
+const (
+	engineNameTimescaleDB = "timescaledb"
+	engineNameNeo4j       = "neo4j"
+)
+
+// engineRecheckInterval 不可用的引擎距上次校验超过该间隔后在后台重新校验，恢复后自动重新参与存储
+const engineRecheckInterval = time.Minute
+
+// storageEngineNames 多维存储引擎，按健康检查输出顺序排列
+var storageEngineNames = []string{engineNameTimescaleDB, engineNameNeo4j}
+
+// engineAvailability 各存储引擎的可用性，零值可用
+type engineAvailability struct {
+	mu       sync.Mutex
+	states   map[string]models.EngineAvailability
+	checking map[string]bool
+}
+
+// get 获取引擎的可用性，尚未校验时为unknown
+func (a *engineAvailability) get(name string) models.EngineAvailability {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if status, ok := a.states[name]; ok {
+		return status
+	}
+	return models.EngineAvailability{Name: name, State: models.EngineStateUnknown}
+}
+
+// set 记录引擎的可用性，状态或原因变化时输出日志
+func (a *engineAvailability) set(name, state, reason string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.states == nil {
+		a.states = make(map[string]models.EngineAvailability)
+	}
+	previous, known := a.states[name]
+	a.states[name] = models.EngineAvailability{Name: name, State: state, Reason: reason, CheckedAt: now.Unix()}
+	if known && previous.State == state && previous.Reason == reason {
+		return
+	}
+
+	switch state {
+	case models.EngineStateUnavailable:
+		log.Printf("⚠️ [存储引擎] %s不可用，智能存储将跳过该引擎: %s", name, reason)
+	case models.EngineStateAvailable:
+		log.Printf("✅ [存储引擎] %s可用", name)
+	case models.EngineStateDisabled:
+		log.Printf("⏸️ [存储引擎] %s未启用", name)
+	}
+}
+
+// beginRecheck 引擎不可用且距上次校验超过间隔、当前没有进行中的校验时返回true，调用方负责校验后调用endRecheck
+func (a *engineAvailability) beginRecheck(name string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status, ok := a.states[name]
+	if !ok || status.State != models.EngineStateUnavailable || a.checking[name] {
+		return false
+	}
+	if now.Sub(time.Unix(status.CheckedAt, 0)) < engineRecheckInterval {
+		return false
+	}
+	if a.checking == nil {
+		a.checking = make(map[string]bool)
+	}
+	a.checking[name] = true
+	return true
+}
+
+// endRecheck 结束后台重新校验
+func (a *engineAvailability) endRecheck(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.checking, name)
+}
+
+// ValidateStorageEngines 校验TimescaleDB和Neo4j各自的配置与连通性并记录可用性，服务启动时调用
+// 两个引擎的配置分别加载，一个引擎配置不完整不影响另一个
+func (s *ContextService) ValidateStorageEngines(ctx context.Context) []models.EngineAvailability {
+	var wg sync.WaitGroup
+	for _, name := range storageEngineNames {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			s.validateStorageEngine(ctx, name)
+		}(name)
+	}
+	wg.Wait()
+	return s.StorageEngineAvailability()
+}
+
+// StorageEngineAvailability 返回各存储引擎当前的可用性
+func (s *ContextService) StorageEngineAvailability() []models.EngineAvailability {
+	statuses := make([]models.EngineAvailability, 0, len(storageEngineNames))
+	for _, name := range storageEngineNames {
+		statuses = append(statuses, s.engines.get(name))
+	}
+	return statuses
+}
+
+// validateStorageEngine 校验单个引擎的配置与连通性
+func (s *ContextService) validateStorageEngine(ctx context.Context, name string) {
+	probe, enabled := storageEngineProbe(name)
+	if !enabled {
+		s.engines.set(name, models.EngineStateDisabled, "", s.now())
+		return
+	}
+	status := runReadinessProbe(ctx, name, probe)
+	if status.Status != models.BackendStatusOK {
+		s.engines.set(name, models.EngineStateUnavailable, status.Error, s.now())
+		return
+	}
+	s.engines.set(name, models.EngineStateAvailable, "", s.now())
+}
+
+// storageEngineUsable 智能存储是否写入该引擎：可用或尚未校验时写入，未启用或不可用时跳过
+// 不可用的引擎按间隔在后台重新校验，不阻塞本次存储
+func (s *ContextService) storageEngineUsable(name string) bool {
+	switch s.engines.get(name).State {
+	case models.EngineStateAvailable, models.EngineStateUnknown:
+		return true
+	case models.EngineStateDisabled:
+		return false
+	}
+	if s.engines.beginRecheck(name, s.now()) {
+		go func() {
+			defer s.engines.endRecheck(name)
+			s.validateStorageEngine(context.Background(), name)
+		}()
+	}
+	return false
+}
+
+// storageEngineProbe 按引擎自身的配置生成连通性探测，配置加载失败时探测直接返回该错误；引擎未启用时enabled为false
+func storageEngineProbe(name string) (probe func(context.Context) error, enabled bool) {
+	var err error
+	switch name {
+	case engineNameTimescaleDB:
+		var dbConfig *config.TimescaleDBConfig
+		if dbConfig, err = config.LoadTimescaleDBConfig(); err == nil {
+			if !dbConfig.Enabled {
+				return nil, false
+			}
+			engineConfig := timescaleDBEngineConfig(dbConfig)
+			return func(ctx context.Context) error { return timeline.Probe(ctx, engineConfig) }, true
+		}
+	case engineNameNeo4j:
+		var dbConfig *config.Neo4jConfig
+		if dbConfig, err = config.LoadNeo4jConfig(); err == nil {
+			if !dbConfig.Enabled {
+				return nil, false
+			}
+			engineConfig := neo4jEngineConfig(dbConfig)
+			return func(ctx context.Context) error { return knowledge.Probe(ctx, engineConfig) }, true
+		}
+	default:
+		err = fmt.Errorf("未知的存储引擎: %s", name)
+	}
+
+	configErr := fmt.Errorf("加载配置失败: %w", err)
+	return func(context.Context) error { return configErr }, true
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestStorageEngineAvailability 测试未校验的引擎照常写入、不可用和未启用的引擎被跳过，不可用的引擎按间隔只触发一次重新校验
+func TestStorageEngineAvailability(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+	service := &ContextService{}
+	service.SetClock(clock)
+
+	if state := service.engines.get(engineNameNeo4j).State; state != models.EngineStateUnknown || !service.storageEngineUsable(engineNameNeo4j) {
+		t.Fatalf("尚未校验的引擎应照常写入: %s", state)
+	}
+
+	service.engines.set(engineNameNeo4j, models.EngineStateUnavailable, "connection refused", service.now())
+	service.engines.set(engineNameTimescaleDB, models.EngineStateDisabled, "", service.now())
+	if service.storageEngineUsable(engineNameNeo4j) || service.storageEngineUsable(engineNameTimescaleDB) {
+		t.Error("不可用或未启用的引擎应被跳过")
+	}
+
+	availability := service.StorageEngineAvailability()
+	if len(availability) != 2 || availability[0].Name != engineNameTimescaleDB || availability[1].Reason != "connection refused" {
+		t.Errorf("可用性列表错误: %+v", availability)
+	}
+
+	if service.engines.beginRecheck(engineNameNeo4j, clock.now.Add(engineRecheckInterval/2)) {
+		t.Error("未超过重新校验间隔时不应重新校验")
+	}
+	later := clock.now.Add(engineRecheckInterval)
+	if !service.engines.beginRecheck(engineNameNeo4j, later) {
+		t.Fatal("超过间隔后应重新校验")
+	}
+	if service.engines.beginRecheck(engineNameNeo4j, later) {
+		t.Error("已有进行中的校验时不应重复校验")
+	}
+	service.engines.endRecheck(engineNameNeo4j)
+	if service.engines.beginRecheck(engineNameTimescaleDB, later) {
+		t.Error("未启用的引擎不应重新校验")
+	}
+
+	service.engines.set(engineNameNeo4j, models.EngineStateAvailable, "", later)
+	if !service.storageEngineUsable(engineNameNeo4j) {
+		t.Error("恢复可用后应重新参与存储")
+	}
+}
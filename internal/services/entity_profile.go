@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 实体画像的规模限制
+const (
+	defaultEntityMemoryLimit = 10  // 默认返回的来源记忆数
+	maxEntityMemoryLimit     = 50  // 来源记忆数上限
+	maxEntityNeighbors       = 100 // 查询的相邻实体数上限
+	entitySnippetRunes       = 200 // 记忆片段的最大字符数
+)
+
+// entitySubgraphLookup 查询实体及其一跳邻居，实体不在图谱中时返回空结果
+type entitySubgraphLookup func(ctx context.Context, userID, entityName string) (*knowledge.KnowledgeResult, error)
+
+// graphEntitySubgraph 通过Neo4j查询属于该用户的实体一跳子图，Neo4j未启用时返回空
+func (s *ContextService) graphEntitySubgraph(ctx context.Context, userID, entityName string) (*knowledge.KnowledgeResult, error) {
+	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		return nil, nil
+	}
+	engine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
+	if err != nil {
+		return nil, err
+	}
+	return engine.QuerySubgraph(ctx, userID, entityName, 1, maxEntityNeighbors)
+}
+
+// GetEntityProfile 汇总调用方用户对某个实体的全部认知：图谱中的关系，以及实体和相邻实体关联的来源记忆片段
+// 实体不在该用户的知识图谱中、Neo4j未启用或查询失败时，退化为按实体名向量检索相关记忆
+func (s *ContextService) GetEntityProfile(ctx context.Context, req models.GetEntityRequest) (*models.EntityProfile, error) {
+	if req.SessionID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("会话ID不能为空")
+	}
+	entityName := strings.TrimSpace(req.EntityName)
+	if entityName == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("实体名称不能为空")
+	}
+	if req.MemoryLimit < 0 || req.MemoryLimit > maxEntityMemoryLimit {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("memoryLimit必须在0-%d之间: %d", maxEntityMemoryLimit, req.MemoryLimit)
+	}
+	limit := req.MemoryLimit
+	if limit == 0 {
+		limit = defaultEntityMemoryLimit
+	}
+
+	userID, err := s.GetUserIDFromSessionID(req.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户ID失败: %w", err)
+	}
+	return s.entityProfile(ctx, userID, entityName, limit, s.graphEntitySubgraph)
+}
+
+// entityProfile 按图谱子图构建实体画像，实体不在图谱中时按实体名向量检索
+func (s *ContextService) entityProfile(ctx context.Context, userID, entityName string, limit int, lookup entitySubgraphLookup) (*models.EntityProfile, error) {
+	subgraph, err := lookup(ctx, userID, entityName)
+	if err != nil {
+		log.Printf("⚠️ [实体画像] 查询知识图谱失败，改为向量检索: %v", err)
+	}
+
+	var start *knowledge.KnowledgeNode
+	if subgraph != nil {
+		for i := range subgraph.Nodes {
+			if subgraph.Nodes[i].Name == entityName {
+				start = &subgraph.Nodes[i]
+				break
+			}
+		}
+	}
+	if start == nil {
+		return s.entityProfileFromVector(ctx, userID, entityName, limit)
+	}
+
+	profile := &models.EntityProfile{
+		EntityName: entityName,
+		Source:     models.EntitySourceGraph,
+		Entity:     knowledgeGraphNode(*start),
+		Relations:  []models.EntityRelation{},
+		Memories:   []models.EntityMemory{},
+	}
+
+	// 收集直接关系，相邻实体按关系强度排序，其关联记忆排在实体自身的记忆之后
+	nodes := make(map[string]knowledge.KnowledgeNode, len(subgraph.Nodes))
+	for _, node := range subgraph.Nodes {
+		nodes[node.ID] = node
+	}
+	neighbors := make(map[string]knowledge.KnowledgeNode)
+	for _, rel := range subgraph.Relationships {
+		direction, otherID := "outgoing", rel.EndNodeID
+		if rel.EndNodeID == start.ID {
+			direction, otherID = "incoming", rel.StartNodeID
+		} else if rel.StartNodeID != start.ID {
+			continue
+		}
+		other, ok := nodes[otherID]
+		if !ok {
+			continue
+		}
+		relation := models.EntityRelation{
+			Type:        rel.Type,
+			Direction:   direction,
+			Entity:      other.Name,
+			Category:    other.Category,
+			Strength:    rel.Strength,
+			Description: rel.Description,
+		}
+		if len(other.Labels) > 0 {
+			relation.Label = other.Labels[0]
+		}
+		neighbors[other.Name] = other
+		profile.Relations = append(profile.Relations, relation)
+	}
+	sort.SliceStable(profile.Relations, func(i, j int) bool {
+		return profile.Relations[i].Strength > profile.Relations[j].Strength
+	})
+
+	type memoryRef struct{ memoryID, via string }
+	var refs []memoryRef
+	for _, memoryID := range nodeMemoryIDs(*start) {
+		refs = append(refs, memoryRef{memoryID: memoryID})
+	}
+	for _, relation := range profile.Relations {
+		node, ok := neighbors[relation.Entity]
+		if !ok {
+			continue
+		}
+		delete(neighbors, relation.Entity)
+		for _, memoryID := range nodeMemoryIDs(node) {
+			refs = append(refs, memoryRef{memoryID: memoryID, via: node.Name})
+		}
+	}
+
+	// 图谱中的memory_ids可能来自其他用户合并写入的同名概念，逐条校验记录归属
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		if len(profile.Memories) >= limit {
+			break
+		}
+		if seen[ref.memoryID] {
+			continue
+		}
+		seen[ref.memoryID] = true
+
+		record, err := s.ownedMemoryRecord(ctx, userID, ref.memoryID)
+		if err != nil {
+			log.Printf("⚠️ [实体画像] 获取记忆 %s 失败: %v", ref.memoryID, err)
+			continue
+		}
+		if record == nil {
+			continue
+		}
+		memory := entityMemory(*record)
+		memory.MemoryID = ref.memoryID
+		memory.Via = ref.via
+		profile.Memories = append(profile.Memories, memory)
+	}
+
+	profile.Description = fmt.Sprintf("知识图谱中实体%s有%d个直接关系，关联记忆%d条", entityName, len(profile.Relations), len(profile.Memories))
+	log.Printf("✅ [实体画像] 用户=%s, 实体=%s, 关系=%d, 图谱记忆ID=%d, 返回记忆=%d",
+		userID, entityName, len(profile.Relations), len(refs), len(profile.Memories))
+	return profile, nil
+}
+
+// entityProfileFromVector 实体不在知识图谱中时，按实体名向量检索该用户的相关记忆
+func (s *ContextService) entityProfileFromVector(ctx context.Context, userID, entityName string, limit int) (*models.EntityProfile, error) {
+	vector, err := s.generateEmbedding(entityName)
+	if err != nil {
+		return nil, fmt.Errorf("生成实体名向量失败: %w", err)
+	}
+	results, err := s.searchByVector(ctx, vector, "", map[string]interface{}{
+		"limit":  limit * 2,
+		"filter": models.FilterEq(models.FilterFieldUserID, userID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("按实体名检索记忆失败: %w", err)
+	}
+
+	profile := &models.EntityProfile{
+		EntityName: entityName,
+		Source:     models.EntitySourceVector,
+		Relations:  []models.EntityRelation{},
+		Memories:   []models.EntityMemory{},
+	}
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if len(profile.Memories) >= limit {
+			break
+		}
+		// 部分向量存储不支持按用户过滤，这里再次校验用户
+		memoryID := resultMemoryID(result)
+		if getResultUserID(result) != userID || isArchivedResult(result) || seen[memoryID] {
+			continue
+		}
+		seen[memoryID] = true
+		memory := entityMemory(result)
+		memory.MemoryID = memoryID
+		memory.Score = result.Score
+		profile.Memories = append(profile.Memories, memory)
+	}
+
+	profile.Description = fmt.Sprintf("知识图谱中没有实体%s，按实体名检索到相关记忆%d条", entityName, len(profile.Memories))
+	log.Printf("🔍 [实体画像] 用户=%s, 实体=%s不在知识图谱中，向量检索返回记忆=%d", userID, entityName, len(profile.Memories))
+	return profile, nil
+}
+
+// ownedMemoryRecord 按记忆ID获取属于该用户且未归档的记录，分块记忆取第一个分块，不存在时返回nil
+func (s *ContextService) ownedMemoryRecord(ctx context.Context, userID, memoryID string) (*models.SearchResult, error) {
+	records, err := s.searchByID(ctx, memoryID, "id")
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if getResultUserID(records[i]) == userID && !isArchivedResult(records[i]) {
+			return &records[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// knowledgeGraphNode 转换为对外返回的图谱节点
+func knowledgeGraphNode(node knowledge.KnowledgeNode) *models.KnowledgeGraphNode {
+	label := ""
+	if len(node.Labels) > 0 {
+		label = node.Labels[0]
+	}
+	return &models.KnowledgeGraphNode{
+		Name:        node.Name,
+		Label:       label,
+		Category:    node.Category,
+		Description: node.Description,
+		Keywords:    node.Keywords,
+	}
+}
+
+// nodeMemoryIDs 图谱节点关联的记忆ID
+func nodeMemoryIDs(node knowledge.KnowledgeNode) []string {
+	var ids []string
+	switch values := node.Properties["memory_ids"].(type) {
+	case []string:
+		ids = append(ids, values...)
+	case []interface{}:
+		for _, value := range values {
+			if id, ok := value.(string); ok && id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// entityMemory 从检索记录提取记忆片段，内容过长时截断
+func entityMemory(record models.SearchResult) models.EntityMemory {
+	content, _ := record.Fields["content"].(string)
+	if runes := []rune(content); len(runes) > entitySnippetRunes {
+		content = string(runes[:entitySnippetRunes]) + "..."
+	}
+	return models.EntityMemory{
+		Snippet:   content,
+		Type:      getResultMemoryType(record),
+		Timestamp: getResultTimestamp(record),
+	}
+}
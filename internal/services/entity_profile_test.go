@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestEntityProfile 测试实体画像汇总直接关系和来源记忆、只返回该用户的记忆，实体不在图谱中时按实体名向量检索
+func TestEntityProfile(t *testing.T) {
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service := &ContextService{}
+	service.SetVectorStore(vectorStore)
+	memories := map[string]string{
+		"m1":    "订单服务的指标数据迁移到TimescaleDB",
+		"m2":    "TimescaleDB的压缩策略解决了磁盘占用过高的问题",
+		"m3":    "订单服务使用Go编写",
+		"other": "其他用户关于TimescaleDB的记忆",
+	}
+	for id, content := range memories {
+		memory := models.NewMemory("s1", content, "P1", nil)
+		memory.ID = id
+		memory.UserID = "user_a"
+		if id == "other" {
+			memory.UserID = "user_b"
+		}
+		memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+
+	node := func(id, name string, memoryIDs ...interface{}) knowledge.KnowledgeNode {
+		return knowledge.KnowledgeNode{ID: id, Name: name, Labels: []string{"Concept"}, Properties: map[string]interface{}{"memory_ids": memoryIDs}}
+	}
+	lookup := func(ctx context.Context, userID, entityName string) (*knowledge.KnowledgeResult, error) {
+		if entityName != "TimescaleDB" {
+			return &knowledge.KnowledgeResult{}, nil
+		}
+		return &knowledge.KnowledgeResult{
+			Nodes: []knowledge.KnowledgeNode{
+				node("n1", "TimescaleDB", "m1", "other"),
+				node("n2", "订单服务", "m1", "m3"),
+				node("n3", "磁盘占用", "m2"),
+			},
+			Relationships: []knowledge.KnowledgeRelationship{
+				{Type: "USES", StartNodeID: "n2", EndNodeID: "n1", Strength: 0.6},
+				{Type: "SOLVES", StartNodeID: "n1", EndNodeID: "n3", Strength: 0.9},
+			},
+		}, nil
+	}
+
+	profile, err := service.entityProfile(context.Background(), "user_a", "TimescaleDB", 10, lookup)
+	if err != nil {
+		t.Fatalf("entityProfile failed: %v", err)
+	}
+	if profile.Source != models.EntitySourceGraph || profile.Entity == nil || profile.Entity.Name != "TimescaleDB" {
+		t.Fatalf("应从知识图谱构建实体画像: %+v", profile)
+	}
+	if len(profile.Relations) != 2 || profile.Relations[0].Entity != "磁盘占用" || profile.Relations[0].Direction != "outgoing" ||
+		profile.Relations[1].Entity != "订单服务" || profile.Relations[1].Direction != "incoming" {
+		t.Errorf("关系应按强度排序并标明方向: %+v", profile.Relations)
+	}
+	var ids, vias []string
+	for _, memory := range profile.Memories {
+		ids = append(ids, memory.MemoryID)
+		vias = append(vias, memory.Via)
+	}
+	if len(ids) != 3 || ids[0] != "m1" || ids[1] != "m2" || ids[2] != "m3" {
+		t.Fatalf("应返回实体及相邻实体的记忆且排除其他用户的记忆，实际: %v", ids)
+	}
+	if vias[0] != "" || vias[1] != "磁盘占用" || vias[2] != "订单服务" || profile.Memories[0].Snippet != memories["m1"] {
+		t.Errorf("记忆来源或片段错误: %v, %+v", vias, profile.Memories[0])
+	}
+
+	// 实体不在图谱中时按实体名向量检索，同样只返回该用户的记忆
+	fallback, err := service.entityProfile(context.Background(), "user_a", "Go", 10, lookup)
+	if err != nil {
+		t.Fatalf("entityProfile fallback failed: %v", err)
+	}
+	if fallback.Source != models.EntitySourceVector || fallback.Entity != nil || len(fallback.Relations) != 0 {
+		t.Errorf("应退化为向量检索: %+v", fallback)
+	}
+	for _, memory := range fallback.Memories {
+		if memory.MemoryID == "other" {
+			t.Error("向量检索不应返回其他用户的记忆")
+		}
+	}
+}
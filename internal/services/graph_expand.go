@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 图谱扩展检索的规模限制，避免一次检索拉入整个知识图谱
+const (
+	graphExpandSeedLimit    = 5  // 作为起点的向量命中记忆数
+	graphExpandConceptLimit = 20 // 起点概念数量上限（一跳邻居数量同样受此限制）
+	graphExpandMemoryLimit  = 10 // 最多追加的图谱扩展记忆数
+)
+
+// retrievalSourceField 搜索结果中记录检索来源的字段名
+const retrievalSourceField = "retrieval_source"
+
+// relatedMemoryLookup 查找与给定记忆在知识图谱中相关的记忆ID
+type relatedMemoryLookup func(ctx context.Context, userID string, memoryIDs []string) ([]string, error)
+
+// graphRelatedMemoryIDs 通过Neo4j查找与给定记忆一跳相关的记忆ID，Neo4j未启用时返回空
+func (s *ContextService) graphRelatedMemoryIDs(ctx context.Context, userID string, memoryIDs []string) ([]string, error) {
+	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		return nil, nil
+	}
+	engine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
+	if err != nil {
+		return nil, err
+	}
+	return engine.RelatedMemoryIDs(ctx, userID, memoryIDs, graphExpandConceptLimit, graphExpandMemoryLimit)
+}
+
+// expandResultsByGraph 以向量命中的记忆为起点，在知识图谱中扩展一跳，将相关记忆追加到结果之后
+// 向量结果标记为vector，扩展结果标记为graph；已在结果中的记忆和不属于该用户的记忆不会追加，图谱查询失败时返回原结果
+func (s *ContextService) expandResultsByGraph(ctx context.Context, userID string, results []models.SearchResult, lookup relatedMemoryLookup) []models.SearchResult {
+	seen := make(map[string]bool)
+	seedSet := make(map[string]bool)
+	var seeds []string
+	for i := range results {
+		if results[i].Fields == nil {
+			results[i].Fields = make(map[string]interface{})
+		}
+		results[i].Fields[retrievalSourceField] = models.RetrievalSourceVector
+
+		memoryID := resultMemoryID(results[i])
+		seen[results[i].ID], seen[memoryID] = true, true
+		if len(seeds) < graphExpandSeedLimit && !seedSet[memoryID] {
+			seedSet[memoryID] = true
+			seeds = append(seeds, memoryID)
+		}
+	}
+	if len(seeds) == 0 {
+		return results
+	}
+
+	related, err := lookup(ctx, userID, seeds)
+	if err != nil {
+		log.Printf("⚠️ [图谱扩展] 查询知识图谱失败，仅返回向量结果: %v", err)
+		return results
+	}
+
+	added := 0
+	for _, memoryID := range related {
+		if added >= graphExpandMemoryLimit {
+			break
+		}
+		if seen[memoryID] {
+			continue
+		}
+
+		records, err := s.searchByID(ctx, memoryID, "id")
+		if err != nil {
+			log.Printf("⚠️ [图谱扩展] 获取记忆 %s 失败: %v", memoryID, err)
+			continue
+		}
+		for _, record := range records {
+			if getResultUserID(record) != userID || seen[record.ID] {
+				continue
+			}
+			if record.Fields == nil {
+				record.Fields = make(map[string]interface{})
+			}
+			record.Fields[retrievalSourceField] = models.RetrievalSourceGraph
+			seen[record.ID], seen[memoryID] = true, true
+			results = append(results, record)
+			added++
+			break
+		}
+	}
+
+	log.Printf("🕸️ [图谱扩展] 起点记忆=%d, 图谱相关记忆=%d, 追加=%d", len(seeds), len(related), added)
+	return results
+}
+
+// resultMemoryID 获取搜索结果所属的记忆ID，分块记忆取memory_id字段
+func resultMemoryID(result models.SearchResult) string {
+	if id, ok := result.Fields["memory_id"].(string); ok && id != "" {
+		return id
+	}
+	return result.ID
+}
+
+// resultRetrievalSource 获取搜索结果的检索来源，未标记时为空
+func resultRetrievalSource(result models.SearchResult) string {
+	source, _ := result.Fields[retrievalSourceField].(string)
+	return source
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestExpandResultsByGraph 测试图谱扩展的去重、用户隔离和来源标记，图谱查询失败时返回原结果
+func TestExpandResultsByGraph(t *testing.T) {
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service := &ContextService{}
+	service.SetVectorStore(vectorStore)
+	for id, userID := range map[string]string{"m1": "user_a", "m2": "user_a", "m3": "user_a", "other": "user_b"} {
+		memory := models.NewMemory("s1", "记忆 "+id, "P1", nil)
+		memory.ID = id
+		memory.UserID = userID
+		memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+	hits, err := service.searchByID(context.Background(), "m1", "id")
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("searchByID failed: %v, %d results", err, len(hits))
+	}
+
+	var seeds []string
+	lookup := func(ctx context.Context, userID string, memoryIDs []string) ([]string, error) {
+		seeds = memoryIDs
+		return []string{"m1", "m2", "other", "missing", "m3", "m2"}, nil
+	}
+	results := service.expandResultsByGraph(context.Background(), "user_a", hits, lookup)
+
+	if len(seeds) != 1 || seeds[0] != "m1" {
+		t.Errorf("Expected seed m1, got %v", seeds)
+	}
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	if len(results) != 3 || ids[0] != "m1" || ids[1] != "m2" || ids[2] != "m3" {
+		t.Fatalf("Expected [m1 m2 m3], got %v", ids)
+	}
+	if resultRetrievalSource(results[0]) != models.RetrievalSourceVector || resultRetrievalSource(results[1]) != models.RetrievalSourceGraph {
+		t.Errorf("Unexpected sources: %v, %v", results[0].Fields[retrievalSourceField], results[1].Fields[retrievalSourceField])
+	}
+	if buildMemoryResult(results[2], "").Source != models.RetrievalSourceGraph {
+		t.Errorf("Expected structured result source graph")
+	}
+
+	failing := func(ctx context.Context, userID string, memoryIDs []string) ([]string, error) {
+		return nil, errors.New("neo4j unavailable")
+	}
+	if got := service.expandResultsByGraph(context.Background(), "user_a", hits, failing); len(got) != 1 {
+		t.Errorf("Expected vector results only on lookup failure, got %d", len(got))
+	}
+}
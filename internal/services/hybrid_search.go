@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// =============================================================================
+// 混合检索：向量相似度 + 关键词(BM25)匹配
+// =============================================================================
+
+const (
+	// hybridVectorCandidateLimit 混合检索时向量检索的最少候选数，为重排序留出空间
+	hybridVectorCandidateLimit = 50
+	// hybridKeywordCandidateLimit 关键词检索扫描的最大记录数
+	hybridKeywordCandidateLimit = 200
+	// hybridExactMatchBoost 文档中出现与查询词大小写完全一致的词时的加权
+	hybridExactMatchBoost = 1.5
+
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// hybridAlpha 获取本次检索的向量得分权重，请求未指定时使用配置值；请求指定0时只按关键词得分排序
+func (s *ContextService) hybridAlpha(req models.RetrieveContextRequest) (float64, error) {
+	if alpha := req.HybridAlpha; alpha != nil {
+		if *alpha < 0 || *alpha > 1 {
+			return 0, fmt.Errorf("hybridAlpha必须在0-1之间: %.4f", *alpha)
+		}
+		return *alpha, nil
+	}
+	if s.config != nil && s.config.HybridSearchAlpha > 0 && s.config.HybridSearchAlpha <= 1 {
+		return s.config.HybridSearchAlpha, nil
+	}
+	return 0.7, nil
+}
+
+// searchByUserID 按用户ID扫描记录，作为关键词检索的候选集
+func (s *ContextService) searchByUserID(ctx context.Context, userID string, limit int) ([]models.SearchResult, error) {
+	return s.searchByUserIDFilter(ctx, userID, models.Filter{}, limit)
+}
+
+// searchByUserIDFilter 按用户ID扫描同时满足附加过滤条件的记录，附加条件为空时不过滤
+func (s *ContextService) searchByUserIDFilter(ctx context.Context, userID string, extra models.Filter, limit int) ([]models.SearchResult, error) {
+	filter := "userId=" + models.QuoteFilterValue(userID)
+
+	if s.vectorStore != nil {
+		searchOptions := &models.SearchOptions{
+			Limit:         limit,
+			UserID:        userID,
+			SkipThreshold: true,
+		}
+		if !extra.IsEmpty() {
+			searchOptions.Filter = &extra
+		}
+		// Vearch使用JSON过滤条件，用户ID通过SearchOptions传递
+		if s.vectorStore.GetProvider() == models.VectorStoreTypeVearch {
+			filter = "{}"
+		}
+		return s.vectorStore.SearchByFilter(ctx, filter, searchOptions)
+	}
+	if s.vectorService != nil {
+		if !extra.IsEmpty() {
+			compiled, err := vectorstore.CompileAliyunFilter(extra)
+			if err != nil {
+				return nil, fmt.Errorf("编译过滤条件失败: %w", err)
+			}
+			filter += " AND " + compiled
+		}
+		return s.vectorService.SearchByFilter(filter, limit)
+	}
+
+	return []models.SearchResult{}, nil
+}
+
+// searchKeywordCandidates 按与向量检索相同的范围（用户、时间范围、集合）扫描关键词候选
+// 部分存储不支持按用户过滤，这里再次校验用户；集合只能在服务层过滤
+func (s *ContextService) searchKeywordCandidates(ctx context.Context, userID string, req models.RetrieveContextRequest) ([]models.SearchResult, error) {
+	timeRange := models.FilterRange(models.FilterFieldTimestamp, req.StartTime, req.EndTime)
+	records, err := s.searchByUserIDFilter(ctx, userID, timeRange, hybridKeywordCandidateLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]models.SearchResult, 0, len(records))
+	for _, record := range records {
+		if getResultUserID(record) == userID {
+			candidates = append(candidates, record)
+		}
+	}
+	candidates = filterResultsByTimeRange(candidates, req.StartTime, req.EndTime)
+	return filterResultsByCollection(candidates, req.Collection), nil
+}
+
+// normalizeLegacyScores 传统向量服务直接返回阿里云的距离得分，转换为与VectorStore一致的0-1相似度（越大越相似）
+func (s *ContextService) normalizeLegacyScores(results []models.SearchResult) []models.SearchResult {
+	for i := range results {
+		results[i].Score = vectorstore.SimilarityFromDistance(s.vectorService.GetMetric(), results[i].Score)
+	}
+	return results
+}
+
+// rankHybridResults 合并向量结果和关键词候选并按混合得分排序
+// 向量结果全部保留；关键词候选只保留至少命中一个查询词的记录
+func (s *ContextService) rankHybridResults(query string, vectorResults, keywordCandidates []models.SearchResult, alpha float64) ([]models.SearchResult, map[string]models.HybridScore) {
+	var pool []models.SearchResult
+	vectorScores := make(map[string]float64)
+	seen := make(map[string]bool)
+
+	for _, result := range vectorResults {
+		if seen[result.ID] {
+			continue
+		}
+		seen[result.ID] = true
+		vectorScores[result.ID] = result.Score
+		pool = append(pool, result)
+	}
+	for _, result := range keywordCandidates {
+		if seen[result.ID] {
+			continue
+		}
+		seen[result.ID] = true
+		pool = append(pool, result)
+	}
+
+	keywordScores, matchedTerms := scoreKeywordBM25(tokenizeQuery(query), pool)
+
+	var ranked []models.SearchResult
+	scores := make(map[string]models.HybridScore, len(pool))
+	for _, result := range pool {
+		vectorScore, fromVector := vectorScores[result.ID]
+		keywordScore := keywordScores[result.ID]
+		if !fromVector && keywordScore == 0 {
+			continue
+		}
+
+		scores[result.ID] = models.HybridScore{
+			ID:           result.ID,
+			VectorScore:  vectorScore,
+			KeywordScore: keywordScore,
+			HybridScore:  alpha*vectorScore + (1-alpha)*keywordScore,
+			MatchedTerms: matchedTerms[result.ID],
+		}
+		ranked = append(ranked, result)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].ID].HybridScore > scores[ranked[j].ID].HybridScore
+	})
+	return ranked, scores
+}
+
+// scoreKeywordBM25 计算候选集中每条记录content字段的BM25得分，并按最高分归一化到0-1
+func scoreKeywordBM25(queryTerms []string, pool []models.SearchResult) (map[string]float64, map[string][]string) {
+	scores := make(map[string]float64)
+	matched := make(map[string][]string)
+	if len(queryTerms) == 0 || len(pool) == 0 {
+		return scores, matched
+	}
+
+	type document struct {
+		id         string
+		termCounts map[string]int  // 小写词频
+		exactTerms map[string]bool // 原样出现的词
+		length     int
+	}
+
+	docs := make([]document, 0, len(pool))
+	docFreq := make(map[string]int)
+	totalLength := 0
+	for _, result := range pool {
+		content, _ := result.Fields["content"].(string)
+		terms := splitTerms(content)
+		doc := document{
+			id:         result.ID,
+			termCounts: make(map[string]int),
+			exactTerms: make(map[string]bool),
+			length:     len(terms),
+		}
+		for _, term := range terms {
+			doc.termCounts[strings.ToLower(term)]++
+			doc.exactTerms[term] = true
+		}
+		for _, term := range queryTerms {
+			if doc.termCounts[strings.ToLower(term)] > 0 {
+				docFreq[strings.ToLower(term)]++
+			}
+		}
+		totalLength += doc.length
+		docs = append(docs, doc)
+	}
+
+	avgLength := float64(totalLength) / float64(len(docs))
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	maxScore := 0.0
+	for _, doc := range docs {
+		score := 0.0
+		for _, term := range queryTerms {
+			lower := strings.ToLower(term)
+			tf := float64(doc.termCounts[lower])
+			if tf == 0 {
+				continue
+			}
+
+			df := float64(docFreq[lower])
+			idf := math.Log(1 + (float64(len(docs))-df+0.5)/(df+0.5))
+			termScore := idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(doc.length)/avgLength))
+			if doc.exactTerms[term] {
+				termScore *= hybridExactMatchBoost
+			}
+
+			score += termScore
+			matched[doc.id] = append(matched[doc.id], term)
+		}
+		if score > 0 {
+			scores[doc.id] = score
+			maxScore = math.Max(maxScore, score)
+		}
+	}
+
+	for id := range scores {
+		scores[id] /= maxScore
+	}
+	return scores, matched
+}
+
+// tokenizeQuery 切分查询词并忽略大小写去重，保留原始大小写用于精确匹配加权
+func tokenizeQuery(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, term := range splitTerms(query) {
+		lower := strings.ToLower(term)
+		if seen[lower] {
+			continue
+		}
+		seen[lower] = true
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// splitTerms 切分文本：字母、数字、下划线的连续串作为一个词（保持标识符完整），
+// 中文等无空格分隔的文字按二元组切分，单字串保留为一个词
+func splitTerms(text string) []string {
+	var terms []string
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			terms = append(terms, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			terms = append(terms, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+
+	return terms
+}
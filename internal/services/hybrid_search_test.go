@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestSplitTerms 测试标识符保持完整、中文按二元组切分
+func TestSplitTerms(t *testing.T) {
+	got := splitTerms("修复 parseSmartAnalysisResponse(ctx) 的解析")
+	want := []string{"修复", "parseSmartAnalysisResponse", "ctx", "的解", "解析"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("切分结果错误: %v", got)
+	}
+}
+
+// TestRankHybridResults 测试精确标识符命中的关键词结果排在语义相近的向量结果之前
+func TestRankHybridResults(t *testing.T) {
+	s := &ContextService{}
+	vectorResults := []models.SearchResult{
+		{ID: "similar", Score: 0.9, Fields: map[string]interface{}{"content": "解析智能分析响应的辅助函数 parseResponse"}},
+		{ID: "exact", Score: 0.6, Fields: map[string]interface{}{"content": "parseSmartAnalysisResponse 会先提取第一个JSON对象"}},
+	}
+	keywordCandidates := []models.SearchResult{
+		{ID: "keyword-only", Fields: map[string]interface{}{"content": "调用 parseSmartAnalysisResponse 处理LLM输出"}},
+		{ID: "unrelated", Fields: map[string]interface{}{"content": "会话清理任务"}},
+		{ID: "exact", Fields: map[string]interface{}{"content": "parseSmartAnalysisResponse 会先提取第一个JSON对象"}},
+	}
+
+	ranked, scores := s.rankHybridResults("parseSmartAnalysisResponse", vectorResults, keywordCandidates, 0.5)
+
+	if len(ranked) != 3 {
+		t.Fatalf("期望3条结果（未命中关键词的候选应被过滤），实际%d条", len(ranked))
+	}
+	if ranked[0].ID != "exact" {
+		t.Errorf("精确命中的结果应排第一，实际: %s", ranked[0].ID)
+	}
+
+	exact := scores["exact"]
+	if exact.VectorScore != 0.6 || exact.KeywordScore <= 0 || len(exact.MatchedTerms) != 1 {
+		t.Errorf("得分明细错误: %+v", exact)
+	}
+	if keywordOnly := scores["keyword-only"]; keywordOnly.VectorScore != 0 || keywordOnly.KeywordScore <= 0 {
+		t.Errorf("关键词结果得分明细错误: %+v", keywordOnly)
+	}
+	if scores["similar"].KeywordScore != 0 {
+		t.Errorf("未命中关键词的向量结果关键词得分应为0: %+v", scores["similar"])
+	}
+}
+
+// TestHybridAlpha 测试显式传入0时只按关键词得分，不传时使用配置值
+func TestHybridAlpha(t *testing.T) {
+	s := &ContextService{config: &config.Config{HybridSearchAlpha: 0.4}}
+	zero, one, invalid := 0.0, 1.0, 1.5
+
+	cases := []struct {
+		alpha *float64
+		want  float64
+	}{
+		{nil, 0.4},
+		{&zero, 0},
+		{&one, 1},
+	}
+	for _, c := range cases {
+		got, err := s.hybridAlpha(models.RetrieveContextRequest{HybridAlpha: c.alpha})
+		if err != nil || got != c.want {
+			t.Errorf("hybridAlpha=%v 期望%.1f，实际%.1f (err=%v)", c.alpha, c.want, got, err)
+		}
+	}
+	if _, err := s.hybridAlpha(models.RetrieveContextRequest{HybridAlpha: &invalid}); err == nil {
+		t.Error("超出0-1范围的hybridAlpha应返回错误")
+	}
+}
+
+// keywordCandidateTestStore 返回固定记录并记录扫描时的过滤条件，模拟不支持用户过滤的存储
+type keywordCandidateTestStore struct {
+	models.VectorStore
+	records []models.SearchResult
+	options *models.SearchOptions
+}
+
+func (f *keywordCandidateTestStore) GetProvider() models.VectorStoreType {
+	return models.VectorStoreTypeQdrant
+}
+
+func (f *keywordCandidateTestStore) SearchByFilter(ctx context.Context, filter string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	f.options = options
+	return append([]models.SearchResult(nil), f.records...), nil
+}
+
+// TestSearchKeywordCandidatesScope 测试关键词候选与向量检索使用相同的用户、时间范围和集合范围
+func TestSearchKeywordCandidatesScope(t *testing.T) {
+	store := &keywordCandidateTestStore{records: []models.SearchResult{
+		{ID: "in-range", Fields: map[string]interface{}{"userId": "user_a", "timestamp": float64(150), "metadata": `{"collection":"docs"}`}},
+		{ID: "other-user", Fields: map[string]interface{}{"userId": "user_b", "timestamp": float64(150), "metadata": `{"collection":"docs"}`}},
+		{ID: "too-old", Fields: map[string]interface{}{"userId": "user_a", "timestamp": float64(50), "metadata": `{"collection":"docs"}`}},
+		{ID: "other-collection", Fields: map[string]interface{}{"userId": "user_a", "timestamp": float64(150), "metadata": `{"collection":"notes"}`}},
+	}}
+	s := &ContextService{vectorStore: store}
+
+	req := models.RetrieveContextRequest{StartTime: 100, EndTime: 200, Collection: "docs"}
+	candidates, err := s.searchKeywordCandidates(context.Background(), "user_a", req)
+	if err != nil {
+		t.Fatalf("扫描关键词候选失败: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].ID != "in-range" {
+		t.Errorf("期望只保留in-range，实际: %v", candidates)
+	}
+
+	wantFilter := models.FilterRange(models.FilterFieldTimestamp, 100, 200)
+	if store.options == nil || store.options.UserID != "user_a" || store.options.Filter == nil ||
+		!reflect.DeepEqual(*store.options.Filter, wantFilter) {
+		t.Errorf("扫描应携带用户和时间范围过滤条件: %+v", store.options)
+	}
+}
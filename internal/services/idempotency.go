@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	apperrors "github.com/contextkeeper/service/internal/errors"
+)
+
+// 幂等键的长度上限，以及内存中最多保留的记录数（超出时淘汰最早的记录）
+const (
+	maxIdempotencyKeyLength = 256
+	maxIdempotencyEntries   = 10000
+)
+
+// idempotencyRecord 幂等记录，按行追加到持久化文件
+type idempotencyRecord struct {
+	Key       string          `json:"key"`
+	Response  json.RawMessage `json:"response"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// idempotencyStore 按工具和用户记录已处理的幂等键及首次结果，并发安全
+// 记录以JSON Lines追加到文件，启动时加载未过期的记录，进程重启后重复请求仍返回首次结果
+type idempotencyStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	path     string // 为空时只保存在内存中
+	records  map[string]*idempotencyRecord
+	inflight map[string]bool
+	appended int // 上次压缩后追加的行数
+	now      func() time.Time
+}
+
+// newIdempotencyStore 根据配置创建幂等记录存储，未启用时返回nil
+func newIdempotencyStore(cfg *config.Config) *idempotencyStore {
+	if cfg == nil || cfg.IdempotencyKeyTTL <= 0 {
+		return nil
+	}
+
+	store := &idempotencyStore{
+		ttl:      cfg.IdempotencyKeyTTL,
+		records:  make(map[string]*idempotencyRecord),
+		inflight: make(map[string]bool),
+		now:      time.Now,
+	}
+	if cfg.StoragePath != "" {
+		store.path = filepath.Join(cfg.StoragePath, "idempotency", "keys.jsonl")
+		if err := store.load(); err != nil {
+			log.Printf("⚠️ [幂等] 加载幂等记录失败，仅在本进程内去重: %v", err)
+		}
+	}
+	return store
+}
+
+// BeginIdempotentRequest 登记带幂等键的写入请求
+// 窗口内已完成的请求返回首次结果（附带idempotentReplay=true）；相同键的请求仍在处理时返回可重试的错误；
+// 否则占用该键，调用方须在成功后调用CompleteIdempotentRequest，失败时调用AbortIdempotentRequest
+// scope为幂等键的隔离范围（用户ID），不同用户的相同键互不影响
+func (s *ContextService) BeginIdempotentRequest(tool, scope, key string) (map[string]interface{}, error) {
+	if s.idempotency == nil || key == "" {
+		return nil, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("idempotencyKey长度不能超过%d", maxIdempotencyKeyLength)
+	}
+	return s.idempotency.begin(idempotencyRecordKey(tool, scope, key))
+}
+
+// CompleteIdempotentRequest 记录请求的首次结果并释放幂等键
+func (s *ContextService) CompleteIdempotentRequest(tool, scope, key string, response interface{}) {
+	if s.idempotency == nil || key == "" {
+		return
+	}
+	if err := s.idempotency.complete(idempotencyRecordKey(tool, scope, key), response); err != nil {
+		log.Printf("⚠️ [幂等] 记录幂等结果失败: tool=%s, key=%s, %v", tool, key, err)
+	}
+}
+
+// AbortIdempotentRequest 请求失败时释放幂等键，客户端可使用相同的键重试
+func (s *ContextService) AbortIdempotentRequest(tool, scope, key string) {
+	if s.idempotency == nil || key == "" {
+		return
+	}
+	s.idempotency.abort(idempotencyRecordKey(tool, scope, key))
+}
+
+// idempotencyRecordKey 组合工具、隔离范围和幂等键
+func idempotencyRecordKey(tool, scope, key string) string {
+	return tool + "\x00" + scope + "\x00" + key
+}
+
+func (st *idempotencyStore) begin(recordKey string) (map[string]interface{}, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if record, ok := st.records[recordKey]; ok {
+		if st.now().Sub(record.CreatedAt) < st.ttl {
+			var replay map[string]interface{}
+			if err := json.Unmarshal(record.Response, &replay); err != nil {
+				return nil, fmt.Errorf("解析幂等结果失败: %w", err)
+			}
+			replay["idempotentReplay"] = true
+			return replay, nil
+		}
+		delete(st.records, recordKey)
+	}
+	if st.inflight[recordKey] {
+		return nil, apperrors.ErrRequestInProgress
+	}
+	st.inflight[recordKey] = true
+	return nil, nil
+}
+
+func (st *idempotencyStore) complete(recordKey string, response interface{}) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		st.abort(recordKey)
+		return fmt.Errorf("序列化结果失败: %w", err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	delete(st.inflight, recordKey)
+	record := &idempotencyRecord{Key: recordKey, Response: data, CreatedAt: st.now()}
+	st.records[recordKey] = record
+	st.pruneLocked()
+
+	if st.path == "" {
+		return nil
+	}
+	if st.appended >= maxIdempotencyEntries {
+		return st.compactLocked()
+	}
+	return st.appendLocked(record)
+}
+
+func (st *idempotencyStore) abort(recordKey string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.inflight, recordKey)
+}
+
+// pruneLocked 清理过期记录，记录数超过上限时淘汰最早的记录，调用方需持有锁
+func (st *idempotencyStore) pruneLocked() {
+	now := st.now()
+	for key, record := range st.records {
+		if now.Sub(record.CreatedAt) >= st.ttl {
+			delete(st.records, key)
+		}
+	}
+	if len(st.records) <= maxIdempotencyEntries {
+		return
+	}
+
+	ordered := st.sortedRecordsLocked()
+	for _, record := range ordered[:len(ordered)-maxIdempotencyEntries] {
+		delete(st.records, record.Key)
+	}
+}
+
+// sortedRecordsLocked 按创建时间升序返回记录，调用方需持有锁
+func (st *idempotencyStore) sortedRecordsLocked() []*idempotencyRecord {
+	ordered := make([]*idempotencyRecord, 0, len(st.records))
+	for _, record := range st.records {
+		ordered = append(ordered, record)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].CreatedAt.Before(ordered[j].CreatedAt)
+	})
+	return ordered
+}
+
+// appendLocked 追加一条记录到持久化文件，调用方需持有锁
+func (st *idempotencyStore) appendLocked(record *idempotencyRecord) error {
+	if err := os.MkdirAll(filepath.Dir(st.path), 0755); err != nil {
+		return fmt.Errorf("创建幂等记录目录失败: %w", err)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("序列化幂等记录失败: %w", err)
+	}
+
+	file, err := os.OpenFile(st.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开幂等记录文件失败: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入幂等记录失败: %w", err)
+	}
+	st.appended++
+	return nil
+}
+
+// compactLocked 只保留未过期的记录重写持久化文件，调用方需持有锁
+func (st *idempotencyStore) compactLocked() error {
+	if err := os.MkdirAll(filepath.Dir(st.path), 0755); err != nil {
+		return fmt.Errorf("创建幂等记录目录失败: %w", err)
+	}
+
+	tmpPath := st.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("创建幂等记录文件失败: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range st.sortedRecordsLocked() {
+		if err := encoder.Encode(record); err != nil {
+			file.Close()
+			return fmt.Errorf("写入幂等记录失败: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("写入幂等记录失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("写入幂等记录失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, st.path); err != nil {
+		return fmt.Errorf("替换幂等记录文件失败: %w", err)
+	}
+
+	st.appended = len(st.records)
+	return nil
+}
+
+// load 加载持久化文件中未过期的记录，并压缩掉过期的行
+func (st *idempotencyStore) load() error {
+	file, err := os.Open(st.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("打开幂等记录文件失败: %w", err)
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record idempotencyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Key == "" {
+			continue // 跳过写入中断留下的不完整行
+		}
+		st.records[record.Key] = &record
+	}
+	scanErr := scanner.Err()
+	file.Close()
+	if scanErr != nil {
+		return fmt.Errorf("读取幂等记录文件失败: %w", scanErr)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.pruneLocked()
+	log.Printf("[幂等] 已加载 %d 条有效幂等记录", len(st.records))
+	return st.compactLocked()
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	apperrors "github.com/contextkeeper/service/internal/errors"
+)
+
+// TestIdempotentRequestReplay 测试重复的幂等键返回首次结果、按用户隔离，且重启后仍然有效
+func TestIdempotentRequestReplay(t *testing.T) {
+	cfg := &config.Config{StoragePath: t.TempDir(), IdempotencyKeyTTL: time.Hour}
+	service := &ContextService{idempotency: newIdempotencyStore(cfg)}
+
+	if replay, err := service.BeginIdempotentRequest("memorize_context", "user_a", "key-1"); replay != nil || err != nil {
+		t.Fatalf("Expected first request to proceed, got %v, %v", replay, err)
+	}
+	if _, err := service.BeginIdempotentRequest("memorize_context", "user_a", "key-1"); !errors.Is(err, apperrors.ErrRequestInProgress) {
+		t.Errorf("Expected in-progress error for concurrent retry, got %v", err)
+	}
+	service.CompleteIdempotentRequest("memorize_context", "user_a", "key-1", map[string]interface{}{"memoryId": "mem-1"})
+
+	replay, err := service.BeginIdempotentRequest("memorize_context", "user_a", "key-1")
+	if err != nil || replay["memoryId"] != "mem-1" || replay["idempotentReplay"] != true {
+		t.Errorf("Expected replay of first result, got %v, %v", replay, err)
+	}
+	if replay, _ := service.BeginIdempotentRequest("memorize_context", "user_b", "key-1"); replay != nil {
+		t.Error("Keys must be scoped per user")
+	}
+
+	// 失败的请求释放幂等键，可以用相同的键重试
+	service.AbortIdempotentRequest("memorize_context", "user_b", "key-1")
+	if replay, err := service.BeginIdempotentRequest("memorize_context", "user_b", "key-1"); replay != nil || err != nil {
+		t.Errorf("Expected aborted key to be reusable, got %v, %v", replay, err)
+	}
+
+	restarted := &ContextService{idempotency: newIdempotencyStore(cfg)}
+	if replay, _ := restarted.BeginIdempotentRequest("memorize_context", "user_a", "key-1"); replay == nil || replay["memoryId"] != "mem-1" {
+		t.Errorf("Expected persisted result after restart, got %v", replay)
+	}
+
+	restarted.idempotency.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if replay, _ := restarted.BeginIdempotentRequest("memorize_context", "user_a", "key-1"); replay != nil {
+		t.Error("Expected expired key to be processed again")
+	}
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
+)
+
+// =============================================================================
+// 知识图谱合并写入与关系清理：避免每次存储都产生重复的节点和关系
+// =============================================================================
+
+// knowledgeGraphWriteStats 单次存储的知识图谱写入统计
+type knowledgeGraphWriteStats struct {
+	ConceptsCreated      int
+	ConceptsMerged       int
+	RelationshipsCreated int
+	RelationshipsMerged  int
+	RelationshipsSkipped int
+}
+
+// recordConcept 记录概念写入结果
+func (s *knowledgeGraphWriteStats) recordConcept(result knowledge.MergeResult) {
+	switch result {
+	case knowledge.MergeResultCreated:
+		s.ConceptsCreated++
+	case knowledge.MergeResultMerged:
+		s.ConceptsMerged++
+	}
+}
+
+// recordRelationship 记录关系写入结果
+func (s *knowledgeGraphWriteStats) recordRelationship(result knowledge.MergeResult) {
+	switch result {
+	case knowledge.MergeResultCreated:
+		s.RelationshipsCreated++
+	case knowledge.MergeResultMerged:
+		s.RelationshipsMerged++
+	default:
+		s.RelationshipsSkipped++
+	}
+}
+
+// mergeKnowledgeGraph 以合并语义写入概念和关系：同名同类概念、同端点同类型关系只累加计数，不重复创建
+func mergeKnowledgeGraph(ctx context.Context, engine *knowledge.Neo4jEngine, concepts []*knowledge.Concept, relationships []*knowledge.Relationship) (knowledgeGraphWriteStats, error) {
+	concepts, relationships = prepareKnowledgeGraphMerge(concepts, relationships)
+	var stats knowledgeGraphWriteStats
+
+	for _, concept := range concepts {
+		result, err := engine.MergeConcept(ctx, concept)
+		if err != nil {
+			return stats, fmt.Errorf("存储概念失败: %w", err)
+		}
+		stats.recordConcept(result)
+	}
+
+	for _, relationship := range relationships {
+		result, err := engine.MergeRelationship(ctx, relationship)
+		if err != nil {
+			return stats, fmt.Errorf("存储关系失败: %w", err)
+		}
+		stats.recordRelationship(result)
+	}
+	return stats, nil
+}
+
+// prepareKnowledgeGraphMerge 合并同一批次中的重复概念和关系，并为关系补充端点分类
+// 批内重复只写入一次（保留较高的重要性/强度），避免单次存储就累加出现次数
+func prepareKnowledgeGraphMerge(concepts []*knowledge.Concept, relationships []*knowledge.Relationship) ([]*knowledge.Concept, []*knowledge.Relationship) {
+	uniqueConcepts := make([]*knowledge.Concept, 0, len(concepts))
+	conceptIndex := make(map[[2]string]*knowledge.Concept, len(concepts))
+	categoryByName := make(map[string]string, len(concepts))
+	for _, concept := range concepts {
+		key := [2]string{concept.Name, concept.Category}
+		if existing, exists := conceptIndex[key]; exists {
+			if concept.Importance > existing.Importance {
+				existing.Importance = concept.Importance
+			}
+			continue
+		}
+		conceptIndex[key] = concept
+		uniqueConcepts = append(uniqueConcepts, concept)
+		if _, exists := categoryByName[concept.Name]; !exists {
+			categoryByName[concept.Name] = concept.Category
+		}
+	}
+
+	uniqueRelationships := make([]*knowledge.Relationship, 0, len(relationships))
+	relationshipIndex := make(map[[3]string]*knowledge.Relationship, len(relationships))
+	for _, rel := range relationships {
+		if rel.FromCategory == "" {
+			rel.FromCategory = categoryByName[rel.FromName]
+		}
+		if rel.ToCategory == "" {
+			rel.ToCategory = categoryByName[rel.ToName]
+		}
+
+		key := [3]string{rel.FromName, rel.ToName, rel.Type}
+		if existing, exists := relationshipIndex[key]; exists {
+			if rel.Strength > existing.Strength {
+				existing.Strength = rel.Strength
+			}
+			continue
+		}
+		relationshipIndex[key] = rel
+		uniqueRelationships = append(uniqueRelationships, rel)
+	}
+
+	return uniqueConcepts, uniqueRelationships
+}
+
+// StartKnowledgeGraphPruneTask 启动知识图谱关系清理定时任务，KnowledgeGraphPruneInterval<=0时不启动
+func (s *ContextService) StartKnowledgeGraphPruneTask(ctx context.Context) {
+	if s.config == nil || s.config.KnowledgeGraphPruneInterval <= 0 {
+		return
+	}
+	if !s.config.EnableMultiDimensionalStorage || !s.config.MultiDimKnowledgeEnabled {
+		log.Printf("ℹ️ [知识图谱清理] 知识图谱存储未启用，跳过关系清理任务")
+		return
+	}
+
+	interval := s.config.KnowledgeGraphPruneInterval
+	log.Printf("[上下文服务] 启动知识图谱关系清理任务: 间隔=%v, 强度阈值=%.2f, 写入次数阈值=%d, 保留期=%v",
+		interval, s.config.KnowledgeGraphPruneMinStrength, s.config.KnowledgeGraphPruneMinWeight, s.config.KnowledgeGraphPruneMinAge)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.PruneKnowledgeGraph(ctx); err != nil {
+					log.Printf("❌ [知识图谱清理] 清理失败: %v", err)
+				}
+			case <-ctx.Done():
+				log.Printf("[上下文服务] 知识图谱关系清理任务已停止")
+				return
+			}
+		}
+	}()
+}
+
+// PruneKnowledgeGraph 按配置的阈值清理一次低质量关系，返回删除的关系数
+func (s *ContextService) PruneKnowledgeGraph(ctx context.Context) (int, error) {
+	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		return 0, nil
+	}
+
+	knowledgeEngine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
+	if err != nil {
+		return 0, err
+	}
+
+	return knowledgeEngine.PruneRelationships(ctx,
+		s.config.KnowledgeGraphPruneMinStrength,
+		s.config.KnowledgeGraphPruneMinWeight,
+		s.config.KnowledgeGraphPruneMinAge)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
+)
+
+// TestPrepareKnowledgeGraphMerge 测试批内重复概念和关系只保留一份，并为关系补充端点分类
+func TestPrepareKnowledgeGraphMerge(t *testing.T) {
+	concepts := []*knowledge.Concept{
+		{Name: "Go", Category: "technical", Importance: 0.7},
+		{Name: "Go", Category: "technical", Importance: 0.9},
+		{Name: "Go", Category: "concept", Importance: 0.5},
+		{Name: "Neo4j", Category: "technical", Importance: 0.8},
+	}
+	relationships := []*knowledge.Relationship{
+		{FromName: "Go", ToName: "Neo4j", Type: "USES", Strength: 0.6},
+		{FromName: "Go", ToName: "Neo4j", Type: "USES", Strength: 0.8},
+		{FromName: "Go", ToName: "Neo4j", Type: "RELATED_TO", Strength: 0.5},
+	}
+
+	concepts, relationships = prepareKnowledgeGraphMerge(concepts, relationships)
+
+	if len(concepts) != 3 {
+		t.Fatalf("期望3个概念（同名不同类保留），实际%d个", len(concepts))
+	}
+	if concepts[0].Importance != 0.9 {
+		t.Errorf("重复概念应保留较高的重要性，实际%.2f", concepts[0].Importance)
+	}
+
+	if len(relationships) != 2 {
+		t.Fatalf("期望2条关系，实际%d条", len(relationships))
+	}
+	uses := relationships[0]
+	if uses.Strength != 0.8 {
+		t.Errorf("重复关系应保留较高的强度，实际%.2f", uses.Strength)
+	}
+	if uses.FromCategory != "technical" || uses.ToCategory != "technical" {
+		t.Errorf("关系端点分类错误: from=%s, to=%s", uses.FromCategory, uses.ToCategory)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
+)
+
+// TestQueryKnowledgeGraphLimits 测试深度默认值和上限、节点上限传给子图查询，且只按调用方用户查询
+func TestQueryKnowledgeGraphLimits(t *testing.T) {
+	service := &ContextService{}
+
+	var gotUserID string
+	var gotDepth, gotMaxNodes int
+	query := func(ctx context.Context, userID, entityName string, maxDepth, maxNodes int) (*knowledge.KnowledgeResult, error) {
+		gotUserID, gotDepth, gotMaxNodes = userID, maxDepth, maxNodes
+		return &knowledge.KnowledgeResult{}, nil
+	}
+
+	for requested, want := range map[int]int{0: defaultKnowledgeGraphDepth, -1: defaultKnowledgeGraphDepth, 1: 1, 3: 3, 10: maxKnowledgeGraphDepth} {
+		response, err := service.queryKnowledgeGraph(context.Background(), "user_a", "Redis", requested, query)
+		if err != nil {
+			t.Fatalf("queryKnowledgeGraph failed: %v", err)
+		}
+		if gotDepth != want || response.MaxDepth != want {
+			t.Errorf("请求深度%d: 期望查询深度%d，实际查询%d、返回%d", requested, want, gotDepth, response.MaxDepth)
+		}
+		if gotUserID != "user_a" || gotMaxNodes != maxKnowledgeGraphNodes {
+			t.Errorf("应按调用方用户和节点上限查询: 用户=%s, 节点上限=%d", gotUserID, gotMaxNodes)
+		}
+	}
+
+	called := false
+	guarded := func(ctx context.Context, userID, entityName string, maxDepth, maxNodes int) (*knowledge.KnowledgeResult, error) {
+		called = true
+		return &knowledge.KnowledgeResult{}, nil
+	}
+	if _, err := service.queryKnowledgeGraph(context.Background(), "", "Redis", 1, guarded); err == nil || called {
+		t.Errorf("用户ID为空时应直接报错且不查询图谱: err=%v, called=%v", err, called)
+	}
+	if _, err := service.queryKnowledgeGraph(context.Background(), "user_a", "", 1, guarded); err == nil || called {
+		t.Errorf("实体名称为空时应直接报错且不查询图谱: err=%v, called=%v", err, called)
+	}
+}
+
+// TestQueryKnowledgeGraphResponse 测试节点和关系按实体名返回，节点截断标记透传
+func TestQueryKnowledgeGraphResponse(t *testing.T) {
+	service := &ContextService{}
+	query := func(ctx context.Context, userID, entityName string, maxDepth, maxNodes int) (*knowledge.KnowledgeResult, error) {
+		return &knowledge.KnowledgeResult{
+			Nodes: []knowledge.KnowledgeNode{
+				{ID: "n1", Name: "Redis", Labels: []string{"Technology"}},
+				{ID: "n2", Name: "缓存穿透", Labels: []string{"Problem"}, Category: "performance"},
+			},
+			Relationships: []knowledge.KnowledgeRelationship{
+				{ID: "r1", Type: "SOLVES", StartNodeID: "n1", EndNodeID: "n2", Strength: 0.8},
+			},
+			Truncated: true,
+		}, nil
+	}
+
+	response, err := service.queryKnowledgeGraph(context.Background(), "user_a", "Redis", 2, query)
+	if err != nil {
+		t.Fatalf("queryKnowledgeGraph failed: %v", err)
+	}
+	if len(response.Nodes) != 2 || response.Nodes[0].Label != "Technology" || response.Nodes[1].Category != "performance" {
+		t.Errorf("节点转换错误: %+v", response.Nodes)
+	}
+	if len(response.Relationships) != 1 || response.Relationships[0].From != "Redis" || response.Relationships[0].To != "缓存穿透" {
+		t.Errorf("关系应按实体名表示: %+v", response.Relationships)
+	}
+	if !response.Truncated {
+		t.Error("节点数超过上限时应标记truncated")
+	}
+}
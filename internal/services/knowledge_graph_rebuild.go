@@ -0,0 +1,407 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// ErrKnowledgeGraphRebuildRunning 该用户已有知识图谱重建任务在进行
+var ErrKnowledgeGraphRebuildRunning = errors.New("该用户的知识图谱重建任务正在进行")
+
+// ErrKnowledgeGraphDisabled Neo4j未启用，无法写入知识图谱
+var ErrKnowledgeGraphDisabled = errors.New("Neo4j未启用，无法重建知识图谱")
+
+// StartRebuildKnowledgeGraph 在后台从用户已存储的记忆重建知识图谱，已有任务在进行时返回ErrKnowledgeGraphRebuildRunning
+func (s *ContextService) StartRebuildKnowledgeGraph(userID string) error {
+	if userID == "" {
+		return fmt.Errorf("用户ID不能为空")
+	}
+	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		return ErrKnowledgeGraphDisabled
+	}
+	if !s.acquireKnowledgeGraphRebuild(userID) {
+		return ErrKnowledgeGraphRebuildRunning
+	}
+
+	go func() {
+		defer s.releaseKnowledgeGraphRebuild(userID)
+		if _, err := s.rebuildKnowledgeGraph(context.Background(), userID, neo4jConfig); err != nil {
+			log.Printf("❌ [知识图谱重建] 用户 %s 重建失败: %v", userID, err)
+		}
+	}()
+	return nil
+}
+
+// RebuildKnowledgeGraph 对用户的全部记忆重新抽取实体和关系，以合并语义写入Neo4j
+// 按记录ID升序分批处理，每批完成后保存进度；上次未完成时从保存的游标继续
+func (s *ContextService) RebuildKnowledgeGraph(ctx context.Context, userID string) (*models.KnowledgeGraphRebuildState, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		return nil, ErrKnowledgeGraphDisabled
+	}
+	if !s.acquireKnowledgeGraphRebuild(userID) {
+		return nil, ErrKnowledgeGraphRebuildRunning
+	}
+	defer s.releaseKnowledgeGraphRebuild(userID)
+
+	return s.rebuildKnowledgeGraph(ctx, userID, neo4jConfig)
+}
+
+// PreviewKnowledgeGraphRebuild 预览重建：从当前游标起抽取一批记录的实体和关系并统计，不写入Neo4j也不保存进度
+func (s *ContextService) PreviewKnowledgeGraphRebuild(ctx context.Context, userID string) (*models.KnowledgeGraphRebuildState, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+
+	cursor := ""
+	if saved, err := s.loadKnowledgeGraphRebuildState(userID); err == nil && saved != nil && saved.Status != models.ReindexCompleted {
+		cursor = saved.Cursor
+	}
+	state := &models.KnowledgeGraphRebuildState{
+		UserID:     userID,
+		Status:     models.ReindexCompleted,
+		DryRun:     true,
+		Extraction: s.knowledgeGraphRebuildExtraction(),
+		Cursor:     cursor,
+		StartedAt:  time.Now(),
+	}
+
+	records, start, err := s.knowledgeGraphRebuildRecords(ctx, userID, cursor)
+	if err != nil {
+		return nil, err
+	}
+	state.Total = len(records)
+	state.Processed = start
+
+	end := min(start+s.reindexBatchSize(), len(records))
+	for _, record := range records[start:end] {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		concepts, relationships, err := s.extractRecordKnowledgeGraph(userID, record, state.Extraction)
+		s.recordKnowledgeGraphRebuildResult(state, record.ID, concepts, relationships, err)
+	}
+
+	now := time.Now()
+	state.UpdatedAt = now
+	state.CompletedAt = &now
+	log.Printf("🔍 [知识图谱重建] 用户 %s 预览 %d 条记录，实体 %d，关系 %d",
+		userID, end-start, state.EntitiesExtracted, state.RelationshipsExtracted)
+	return state, nil
+}
+
+// GetKnowledgeGraphRebuildState 获取用户最近一次知识图谱重建的进度，没有记录时返回nil
+func (s *ContextService) GetKnowledgeGraphRebuildState(userID string) (*models.KnowledgeGraphRebuildState, error) {
+	state, err := s.loadKnowledgeGraphRebuildState(userID)
+	if err != nil || state == nil {
+		return state, err
+	}
+
+	// 进程重启后遗留的running状态实际已中断
+	if state.Status == models.ReindexRunning && !s.isKnowledgeGraphRebuildRunning(userID) {
+		state.Status = models.ReindexInterrupted
+	}
+	return state, nil
+}
+
+// ResetKnowledgeGraphRebuildState 清除用户的知识图谱重建进度，下次从头开始
+func (s *ContextService) ResetKnowledgeGraphRebuildState(userID string) error {
+	if s.isKnowledgeGraphRebuildRunning(userID) {
+		return ErrKnowledgeGraphRebuildRunning
+	}
+
+	path := s.knowledgeGraphRebuildStatePath(userID)
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除知识图谱重建进度失败: %w", err)
+	}
+	return nil
+}
+
+// rebuildKnowledgeGraph 执行重建，调用方需已持有该用户的任务标记
+func (s *ContextService) rebuildKnowledgeGraph(ctx context.Context, userID string, neo4jConfig *knowledge.Neo4jConfig) (*models.KnowledgeGraphRebuildState, error) {
+	state, err := s.loadKnowledgeGraphRebuildState(userID)
+	if err != nil {
+		log.Printf("⚠️ [知识图谱重建] 读取用户 %s 的进度失败，从头开始: %v", userID, err)
+		state = nil
+	}
+	if state == nil || state.Status == models.ReindexCompleted {
+		state = &models.KnowledgeGraphRebuildState{UserID: userID, StartedAt: time.Now()}
+	} else {
+		log.Printf("🔄 [知识图谱重建] 用户 %s 从游标 %s 继续，已处理 %d 条", userID, state.Cursor, state.Processed)
+	}
+	state.Status = models.ReindexRunning
+	state.Extraction = s.knowledgeGraphRebuildExtraction()
+	state.Error = ""
+	s.saveKnowledgeGraphRebuildState(state)
+
+	engine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
+	if err != nil {
+		return s.failKnowledgeGraphRebuild(state, err)
+	}
+
+	records, start, err := s.knowledgeGraphRebuildRecords(ctx, userID, state.Cursor)
+	if err != nil {
+		return s.failKnowledgeGraphRebuild(state, err)
+	}
+	state.Total = len(records)
+	state.Processed = start
+
+	batchSize := s.reindexBatchSize()
+	log.Printf("🚀 [知识图谱重建] 开始重建用户 %s 的知识图谱，共 %d 条，待处理 %d 条，批大小 %d，抽取方式 %s",
+		userID, state.Total, state.Total-start, batchSize, state.Extraction)
+
+	for batchStart := start; batchStart < len(records); batchStart += batchSize {
+		for _, record := range records[batchStart:min(batchStart+batchSize, len(records))] {
+			if err := ctx.Err(); err != nil {
+				state.Status = models.ReindexInterrupted
+				state.Error = err.Error()
+				state.UpdatedAt = time.Now()
+				s.saveKnowledgeGraphRebuildState(state)
+				return state, err
+			}
+
+			concepts, relationships, err := s.extractRecordKnowledgeGraph(userID, record, state.Extraction)
+			if err == nil && len(concepts) > 0 {
+				var stats knowledgeGraphWriteStats
+				stats, err = mergeKnowledgeGraph(ctx, engine, concepts, relationships)
+				state.ConceptsCreated += stats.ConceptsCreated
+				state.ConceptsMerged += stats.ConceptsMerged
+				state.RelationshipsCreated += stats.RelationshipsCreated
+				state.RelationshipsMerged += stats.RelationshipsMerged
+				state.RelationshipsSkipped += stats.RelationshipsSkipped
+			}
+			s.recordKnowledgeGraphRebuildResult(state, record.ID, concepts, relationships, err)
+			state.Cursor = record.ID
+		}
+
+		state.UpdatedAt = time.Now()
+		s.saveKnowledgeGraphRebuildState(state)
+		log.Printf("📈 [知识图谱重建] 用户 %s 进度 %d/%d，成功 %d，跳过 %d，失败 %d",
+			userID, state.Processed, state.Total, state.Rebuilt, state.Skipped, state.Failed)
+	}
+
+	now := time.Now()
+	state.Status = models.ReindexCompleted
+	state.UpdatedAt = now
+	state.CompletedAt = &now
+	s.saveKnowledgeGraphRebuildState(state)
+
+	log.Printf("✅ [知识图谱重建] 用户 %s 重建完成，概念 新建%d/合并%d，关系 新建%d/合并%d/跳过%d，失败 %d",
+		userID, state.ConceptsCreated, state.ConceptsMerged,
+		state.RelationshipsCreated, state.RelationshipsMerged, state.RelationshipsSkipped, state.Failed)
+	return state, nil
+}
+
+// knowledgeGraphRebuildRecords 扫描用户的记录并按ID升序排列，返回游标之后第一条记录的下标
+func (s *ContextService) knowledgeGraphRebuildRecords(ctx context.Context, userID, cursor string) ([]models.SearchResult, int, error) {
+	records, err := s.searchByUserID(ctx, userID, maxReindexScan)
+	if err != nil {
+		return nil, 0, fmt.Errorf("扫描用户记忆失败: %w", err)
+	}
+	if len(records) >= maxReindexScan {
+		log.Printf("⚠️ [知识图谱重建] 用户 %s 的记录数达到扫描上限 %d，超出部分需再次执行", userID, maxReindexScan)
+	}
+
+	// 部分向量存储不支持按用户过滤，这里再次校验用户
+	owned := records[:0]
+	for _, record := range records {
+		if getResultUserID(record) == userID {
+			owned = append(owned, record)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i].ID < owned[j].ID })
+	start := sort.Search(len(owned), func(i int) bool { return owned[i].ID > cursor })
+	return owned, start, nil
+}
+
+// recordKnowledgeGraphRebuildResult 累计单条记录的抽取结果
+func (s *ContextService) recordKnowledgeGraphRebuildResult(state *models.KnowledgeGraphRebuildState, recordID string,
+	concepts []*knowledge.Concept, relationships []*knowledge.Relationship, err error) {
+	switch {
+	case err != nil:
+		log.Printf("⚠️ [知识图谱重建] 记录 %s 处理失败: %v", recordID, err)
+		state.Failed++
+		state.FailedIDs = append(state.FailedIDs, recordID)
+	case len(concepts) == 0:
+		state.Skipped++
+	default:
+		state.Rebuilt++
+		state.EntitiesExtracted += len(concepts)
+		state.RelationshipsExtracted += len(relationships)
+	}
+	state.Processed++
+}
+
+// extractRecordKnowledgeGraph 从单条记忆抽取概念和关系，消息记录和空内容记录返回空结果
+// rule方式把记忆内容作为核心意图文本做规则匹配；llm方式走存储链路的LLM分析，分析失败时降级为规则匹配
+func (s *ContextService) extractRecordKnowledgeGraph(userID string, record models.SearchResult, extraction string) ([]*knowledge.Concept, []*knowledge.Relationship, error) {
+	if role, _ := record.Fields["role"].(string); role != "" {
+		return nil, nil, nil
+	}
+	content, _ := record.Fields["content"].(string)
+	if content == "" {
+		return nil, nil, nil
+	}
+
+	memoryID := record.ID
+	if id, ok := record.Fields["memory_id"].(string); ok && id != "" {
+		memoryID = id
+	}
+	sessionID, _ := record.Fields["session_id"].(string)
+	priority, _ := record.Fields["priority"].(string)
+	req := models.StoreContextRequest{
+		SessionID: sessionID,
+		UserID:    userID,
+		Content:   content,
+		Priority:  priority,
+		Metadata:  parseResultMetadata(record),
+	}
+
+	var analysisResult *models.SmartAnalysisResult
+	if extraction == models.KnowledgeGraphRebuildLLM {
+		result, err := s.analyzeContentWithSmartLLM(s.getBasicContextData(sessionID), content)
+		if err != nil {
+			log.Printf("⚠️ [知识图谱重建] 记录 %s 的LLM分析失败，降级为规则匹配: %v", record.ID, err)
+		} else if result != nil && result.IntentAnalysis != nil {
+			analysisResult = result
+		}
+	}
+	if analysisResult == nil {
+		analysisResult = &models.SmartAnalysisResult{
+			IntentAnalysis: &models.IntentAnalysisResult{CoreIntentText: content},
+		}
+	}
+
+	knowledgeData := map[string]interface{}{
+		"session_id":    sessionID,
+		"user_id":       userID,
+		"memory_id":     memoryID,
+		"content":       content,
+		"priority":      priority,
+		"metadata":      req.Metadata,
+		"analysis_data": analysisResult,
+		"created_at":    time.Now(),
+	}
+	return s.convertToKnowledgeGraph(knowledgeData, req, memoryID)
+}
+
+// knowledgeGraphRebuildExtraction 知识图谱重建使用的抽取方式，未配置或无法识别时使用规则匹配
+func (s *ContextService) knowledgeGraphRebuildExtraction() string {
+	if s.config != nil && s.config.KGRebuildExtraction == models.KnowledgeGraphRebuildLLM {
+		return models.KnowledgeGraphRebuildLLM
+	}
+	return models.KnowledgeGraphRebuildRule
+}
+
+// failKnowledgeGraphRebuild 标记重建失败并保存进度
+func (s *ContextService) failKnowledgeGraphRebuild(state *models.KnowledgeGraphRebuildState, err error) (*models.KnowledgeGraphRebuildState, error) {
+	state.Status = models.ReindexFailed
+	state.Error = err.Error()
+	state.UpdatedAt = time.Now()
+	s.saveKnowledgeGraphRebuildState(state)
+	return state, err
+}
+
+// acquireKnowledgeGraphRebuild 标记用户的知识图谱重建任务开始，已在进行时返回false
+func (s *ContextService) acquireKnowledgeGraphRebuild(userID string) bool {
+	s.kgRebuildMutex.Lock()
+	defer s.kgRebuildMutex.Unlock()
+
+	if s.kgRebuildRunning == nil {
+		s.kgRebuildRunning = make(map[string]bool)
+	}
+	if s.kgRebuildRunning[userID] {
+		return false
+	}
+	s.kgRebuildRunning[userID] = true
+	return true
+}
+
+// releaseKnowledgeGraphRebuild 清除用户的知识图谱重建任务标记
+func (s *ContextService) releaseKnowledgeGraphRebuild(userID string) {
+	s.kgRebuildMutex.Lock()
+	defer s.kgRebuildMutex.Unlock()
+	delete(s.kgRebuildRunning, userID)
+}
+
+// isKnowledgeGraphRebuildRunning 用户的知识图谱重建任务是否在进行
+func (s *ContextService) isKnowledgeGraphRebuildRunning(userID string) bool {
+	s.kgRebuildMutex.Lock()
+	defer s.kgRebuildMutex.Unlock()
+	return s.kgRebuildRunning[userID]
+}
+
+// knowledgeGraphRebuildStatePath 用户知识图谱重建进度文件路径，未配置存储路径时返回空
+func (s *ContextService) knowledgeGraphRebuildStatePath(userID string) string {
+	if s.config == nil || s.config.StoragePath == "" {
+		return ""
+	}
+	fileName := reindexFileNamePattern.ReplaceAllString(userID, "_") + ".json"
+	return filepath.Join(s.config.StoragePath, "kg_rebuild", fileName)
+}
+
+// loadKnowledgeGraphRebuildState 读取用户的知识图谱重建进度，没有记录时返回nil
+func (s *ContextService) loadKnowledgeGraphRebuildState(userID string) (*models.KnowledgeGraphRebuildState, error) {
+	path := s.knowledgeGraphRebuildStatePath(userID)
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取知识图谱重建进度失败: %w", err)
+	}
+
+	var state models.KnowledgeGraphRebuildState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("解析知识图谱重建进度失败: %w", err)
+	}
+	return &state, nil
+}
+
+// saveKnowledgeGraphRebuildState 保存知识图谱重建进度，先写临时文件再重命名
+func (s *ContextService) saveKnowledgeGraphRebuildState(state *models.KnowledgeGraphRebuildState) {
+	path := s.knowledgeGraphRebuildStatePath(state.UserID)
+	if path == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Printf("⚠️ [知识图谱重建] 序列化进度失败: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("⚠️ [知识图谱重建] 创建进度目录失败: %v", err)
+		return
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		log.Printf("⚠️ [知识图谱重建] 保存进度失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Printf("⚠️ [知识图谱重建] 保存进度失败: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestPreviewKnowledgeGraphRebuild 测试演练按规则从用户记忆抽取实体，跳过无实体的记录，不统计其他用户的记录也不保存进度
+func TestPreviewKnowledgeGraphRebuild(t *testing.T) {
+	storagePath := t.TempDir()
+	service := &ContextService{config: &config.Config{StoragePath: storagePath, KGRebuildExtraction: "unknown"}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+	storeMemory := func(id, userID, content string) {
+		memory := models.NewMemory("s1", content, "P2", nil)
+		memory.ID = id
+		memory.UserID = userID
+		memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+	}
+	storeMemory("m1", "user_a", "使用Go和Redis实现缓存服务")
+	storeMemory("m2", "user_a", "今天天气不错")
+	storeMemory("m3", "user_b", "使用Neo4j存储知识图谱")
+
+	state, err := service.PreviewKnowledgeGraphRebuild(context.Background(), "user_a")
+	if err != nil {
+		t.Fatalf("预览知识图谱重建失败: %v", err)
+	}
+	if !state.DryRun || state.Extraction != models.KnowledgeGraphRebuildRule {
+		t.Errorf("应为演练且无法识别的抽取方式降级为规则匹配: %+v", state)
+	}
+	if state.Total != 2 || state.Processed != 2 || state.Rebuilt != 1 || state.Skipped != 1 || state.Failed != 0 {
+		t.Fatalf("应只处理user_a的2条记录: %+v", state)
+	}
+	if state.EntitiesExtracted < 2 || state.ConceptsCreated != 0 {
+		t.Errorf("应抽取Go和Redis实体且演练不写入: %+v", state)
+	}
+
+	if saved, err := service.GetKnowledgeGraphRebuildState("user_a"); err != nil || saved != nil {
+		t.Errorf("演练不应保存进度: %+v, %v", saved, err)
+	}
+	if _, err := service.RebuildKnowledgeGraph(context.Background(), "user_a"); err != ErrKnowledgeGraphDisabled {
+		t.Errorf("Neo4j未启用时应拒绝重建: %v", err)
+	}
+}
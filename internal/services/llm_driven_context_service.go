@@ -560,6 +560,12 @@ func (lds *LLMDrivenContextService) RetrieveContext(ctx context.Context, req mod
 		return lds.contextService.RetrieveContext(ctx, req)
 	}
 
+	// 混合检索、重排序、结构化结果、分组、指定返回条数、图谱扩展、token预算和检索诊断由基础ContextService实现，需要逐条结果时不走LLM驱动流程
+	if req.HybridSearch || req.Rerank || req.Structured || req.GroupBy != "" || req.TopK > 0 || req.GraphExpand || req.MaxTokens > 0 || req.Explain {
+		log.Printf("🔄 [LLM驱动服务] 请求启用混合检索、重排序、结构化结果、分组、指定topK、图谱扩展、token预算或检索诊断，使用基础ContextService")
+		return lds.contextService.RetrieveContext(ctx, req)
+	}
+
 	log.Printf("🚀 [LLM驱动服务] 启用LLM驱动智能化流程，查询: %s", req.Query)
 	lds.metrics.LLMDrivenRequests++
 
@@ -661,6 +667,76 @@ func (lds *LLMDrivenContextService) StoreContext(ctx context.Context, req models
 	return lds.contextService.StoreContext(ctx, req)
 }
 
+// StoreContextDetailed 代理到基础ContextService
+func (lds *LLMDrivenContextService) StoreContextDetailed(ctx context.Context, req models.StoreContextRequest) (*models.StoreContextResponse, error) {
+	return lds.contextService.StoreContextDetailed(ctx, req)
+}
+
+// EnqueueStoreContext 代理到基础ContextService
+func (lds *LLMDrivenContextService) EnqueueStoreContext(req models.StoreContextRequest) (*models.StoreJob, error) {
+	return lds.contextService.EnqueueStoreContext(req)
+}
+
+// GetStoreJob 代理到基础ContextService
+func (lds *LLMDrivenContextService) GetStoreJob(sessionID, jobID string) (*models.StoreJob, error) {
+	return lds.contextService.GetStoreJob(sessionID, jobID)
+}
+
+// StartReindexAllMemories 代理到基础ContextService
+func (lds *LLMDrivenContextService) StartReindexAllMemories(userID string) error {
+	return lds.contextService.StartReindexAllMemories(userID)
+}
+
+// StartRetryFailedReindex 代理到基础ContextService
+func (lds *LLMDrivenContextService) StartRetryFailedReindex(userID string) error {
+	return lds.contextService.StartRetryFailedReindex(userID)
+}
+
+// PurgeUser 代理到基础ContextService
+func (lds *LLMDrivenContextService) PurgeUser(ctx context.Context, userID string) (*models.PurgeUserReport, error) {
+	return lds.contextService.PurgeUser(ctx, userID)
+}
+
+// ReconcileStorage 代理到基础ContextService
+func (lds *LLMDrivenContextService) ReconcileStorage(ctx context.Context, userID string, dryRun bool) (*models.ReconcileReport, error) {
+	return lds.contextService.ReconcileStorage(ctx, userID, dryRun)
+}
+
+// GetReindexState 代理到基础ContextService
+func (lds *LLMDrivenContextService) GetReindexState(userID string) (*models.ReindexState, error) {
+	return lds.contextService.GetReindexState(userID)
+}
+
+// ResetReindexState 代理到基础ContextService
+func (lds *LLMDrivenContextService) ResetReindexState(userID string) error {
+	return lds.contextService.ResetReindexState(userID)
+}
+
+// StartRebuildKnowledgeGraph 代理到基础ContextService
+func (lds *LLMDrivenContextService) StartRebuildKnowledgeGraph(userID string) error {
+	return lds.contextService.StartRebuildKnowledgeGraph(userID)
+}
+
+// PreviewKnowledgeGraphRebuild 代理到基础ContextService
+func (lds *LLMDrivenContextService) PreviewKnowledgeGraphRebuild(ctx context.Context, userID string) (*models.KnowledgeGraphRebuildState, error) {
+	return lds.contextService.PreviewKnowledgeGraphRebuild(ctx, userID)
+}
+
+// GetKnowledgeGraphRebuildState 代理到基础ContextService
+func (lds *LLMDrivenContextService) GetKnowledgeGraphRebuildState(userID string) (*models.KnowledgeGraphRebuildState, error) {
+	return lds.contextService.GetKnowledgeGraphRebuildState(userID)
+}
+
+// ResetKnowledgeGraphRebuildState 代理到基础ContextService
+func (lds *LLMDrivenContextService) ResetKnowledgeGraphRebuildState(userID string) error {
+	return lds.contextService.ResetKnowledgeGraphRebuildState(userID)
+}
+
+// CheckToolRateLimit 代理到基础ContextService
+func (lds *LLMDrivenContextService) CheckToolRateLimit(tool string, params map[string]interface{}, defaultUserID string) error {
+	return lds.contextService.CheckToolRateLimit(tool, params, defaultUserID)
+}
+
 // RetrieveConversation 代理到基础ContextService
 func (lds *LLMDrivenContextService) RetrieveConversation(ctx context.Context, req models.RetrieveConversationRequest) (*models.ConversationResponse, error) {
 	return lds.contextService.RetrieveConversation(ctx, req)
@@ -671,6 +747,11 @@ func (lds *LLMDrivenContextService) GetProgrammingContext(ctx context.Context, s
 	return lds.contextService.GetProgrammingContext(ctx, sessionID, query)
 }
 
+// GetProgrammingContextWithOptions 代理到基础ContextService
+func (lds *LLMDrivenContextService) GetProgrammingContextWithOptions(ctx context.Context, req models.ProgrammingContextRequest) (*models.ProgrammingContext, error) {
+	return lds.contextService.GetProgrammingContextWithOptions(ctx, req)
+}
+
 // GetContextService 获取基础ContextService（用于MCP工具等需要直接访问基础服务的场景）
 func (lds *LLMDrivenContextService) GetContextService() *ContextService {
 	return lds.contextService
@@ -728,6 +809,7 @@ func (lds *LLMDrivenContextService) StoreSessionMessages(ctx context.Context, re
 			"storageStrategy": result.StorageStrategy,
 			"intentAnalysis":  result.IntentAnalysis,
 			"qualityScore":    result.QualityScore,
+			"engineResults":   result.EngineResults,
 		})
 	}
 
@@ -777,6 +859,7 @@ func (lds *LLMDrivenContextService) executeSmartStorage(ctx context.Context, ses
 		IntentAnalysis:  content,
 		QualityScore:    response.Confidence,
 		AnalysisResult:  response.AnalysisResult, // 包含完整的分析结果
+		EngineResults:   response.EngineResults,
 	}
 
 	log.Printf("✅ [智能存储决策] 完成，记忆ID: %s, 置信度: %.2f", response.MemoryID, result.Confidence)
@@ -785,12 +868,13 @@ func (lds *LLMDrivenContextService) executeSmartStorage(ctx context.Context, ses
 
 // SmartStorageResult 智能存储结果
 type SmartStorageResult struct {
-	MessageIDs      []string                    `json:"messageIds"`
-	Confidence      float64                     `json:"confidence"`
-	StorageStrategy string                      `json:"storageStrategy"`
-	IntentAnalysis  string                      `json:"intentAnalysis"`
-	QualityScore    float64                     `json:"qualityScore"`
-	AnalysisResult  *models.SmartAnalysisResult `json:"analysisResult,omitempty"` // 完整的分析结果
+	MessageIDs      []string                     `json:"messageIds"`
+	Confidence      float64                      `json:"confidence"`
+	StorageStrategy string                       `json:"storageStrategy"`
+	IntentAnalysis  string                       `json:"intentAnalysis"`
+	QualityScore    float64                      `json:"qualityScore"`
+	AnalysisResult  *models.SmartAnalysisResult  `json:"analysisResult,omitempty"` // 完整的分析结果
+	EngineResults   []models.StorageEngineResult `json:"engineResults,omitempty"`  // 各存储引擎的写入结果
 }
 
 // GetSessionState 获取会话状态
@@ -1663,7 +1747,7 @@ func buildProjectContextFilter(userID, query string) string {
 
 	// 用户过滤（必须）
 	if userID != "" {
-		filterParts = append(filterParts, fmt.Sprintf(`userId="%s"`, userID))
+		filterParts = append(filterParts, "userId="+models.QuoteFilterValue(userID))
 	}
 
 	// 项目上下文过滤（如果查询涉及特定项目）
@@ -1731,11 +1815,196 @@ func (lds *LLMDrivenContextService) RetrieveTodos(ctx context.Context, req model
 	return lds.contextService.RetrieveTodos(ctx, req)
 }
 
+// BatchStoreConversation 批量存储对话（代理到底层ContextService）
+func (lds *LLMDrivenContextService) BatchStoreConversation(ctx context.Context, req models.BatchStoreConversationRequest) (*models.BatchStoreConversationResponse, error) {
+	return lds.contextService.BatchStoreConversation(ctx, req)
+}
+
+// DeleteMemory 删除记忆（代理到底层ContextService）
+func (lds *LLMDrivenContextService) DeleteMemory(ctx context.Context, req models.DeleteMemoryRequest) (*models.DeleteMemoryResponse, error) {
+	return lds.contextService.DeleteMemory(ctx, req)
+}
+
+// GetEntityProfile 获取实体画像（代理到底层ContextService）
+func (lds *LLMDrivenContextService) GetEntityProfile(ctx context.Context, req models.GetEntityRequest) (*models.EntityProfile, error) {
+	return lds.contextService.GetEntityProfile(ctx, req)
+}
+
+// DeleteMemoriesByFilter 按条件批量删除记忆（代理到底层ContextService）
+func (lds *LLMDrivenContextService) DeleteMemoriesByFilter(ctx context.Context, req models.DeleteMemoriesByFilterRequest) (*models.DeleteMemoriesByFilterResponse, error) {
+	return lds.contextService.DeleteMemoriesByFilter(ctx, req)
+}
+
+// UpdateMemory 原地更新记忆（代理到底层ContextService）
+func (lds *LLMDrivenContextService) UpdateMemory(ctx context.Context, req models.UpdateMemoryRequest) (*models.UpdateMemoryResponse, error) {
+	return lds.contextService.UpdateMemory(ctx, req)
+}
+
+// ReanalyzeMemory 重新分析已存储的记忆（代理到底层ContextService）
+func (lds *LLMDrivenContextService) ReanalyzeMemory(ctx context.Context, req models.ReanalyzeMemoryRequest) (*models.ReanalyzeMemoryResponse, error) {
+	return lds.contextService.ReanalyzeMemory(ctx, req)
+}
+
+// QueryByMetadata 按metadata键值查询记忆（代理到底层ContextService）
+func (lds *LLMDrivenContextService) QueryByMetadata(ctx context.Context, req models.QueryByMetadataRequest) (*models.QueryByMetadataResponse, error) {
+	return lds.contextService.QueryByMetadata(ctx, req)
+}
+
+// GetEmbeddingCacheStats 获取向量缓存统计（代理到底层ContextService）
+func (lds *LLMDrivenContextService) GetEmbeddingCacheStats() EmbeddingCacheStats {
+	return lds.contextService.GetEmbeddingCacheStats()
+}
+
+// ExportSession 导出会话（代理到底层ContextService）
+func (lds *LLMDrivenContextService) ExportSession(ctx context.Context, userID, sessionID string) (*models.SessionExport, error) {
+	return lds.contextService.ExportSession(ctx, userID, sessionID)
+}
+
+// ImportSession 导入会话（代理到底层ContextService）
+func (lds *LLMDrivenContextService) ImportSession(ctx context.Context, req models.ImportSessionRequest) (*models.ImportSessionResponse, error) {
+	return lds.contextService.ImportSession(ctx, req)
+}
+
+// LinkSessions 关联两个会话（代理到底层ContextService）
+func (lds *LLMDrivenContextService) LinkSessions(req models.LinkSessionsRequest) (*models.LinkSessionsResponse, error) {
+	return lds.contextService.LinkSessions(req)
+}
+
+// MergeSessions 合并会话（代理到底层ContextService）
+func (lds *LLMDrivenContextService) MergeSessions(ctx context.Context, req models.MergeSessionsRequest) (*models.MergeSessionsResponse, error) {
+	return lds.contextService.MergeSessions(ctx, req)
+}
+
+// UpdateSessionMetadata 合并更新会话元数据（代理到底层ContextService）
+func (lds *LLMDrivenContextService) UpdateSessionMetadata(userID, sessionID string, metadata map[string]interface{}) (map[string]interface{}, error) {
+	return lds.contextService.UpdateSessionMetadata(userID, sessionID, metadata)
+}
+
+// SetSessionPinned 设置会话置顶状态（代理到底层ContextService）
+func (lds *LLMDrivenContextService) SetSessionPinned(userID, sessionID string, pinned bool) error {
+	return lds.contextService.SetSessionPinned(userID, sessionID, pinned)
+}
+
+// StorageEngineAvailability 返回各存储引擎的可用性（代理到底层ContextService）
+func (lds *LLMDrivenContextService) StorageEngineAvailability() []models.EngineAvailability {
+	return lds.contextService.StorageEngineAvailability()
+}
+
+// CheckReadiness 探测所有后端依赖是否可用（代理到底层ContextService）
+func (lds *LLMDrivenContextService) CheckReadiness(ctx context.Context) []models.BackendStatus {
+	return lds.contextService.CheckReadiness(ctx)
+}
+
+// DryRunStoreContext 试运行存储，只返回分析结果不写入（代理到底层ContextService）
+func (lds *LLMDrivenContextService) DryRunStoreContext(ctx context.Context, req models.StoreContextRequest) (*models.StoreContextResponse, error) {
+	return lds.contextService.DryRunStoreContext(ctx, req)
+}
+
+// StreamRetrieveContext 流式检索上下文（代理到底层ContextService）
+func (lds *LLMDrivenContextService) StreamRetrieveContext(ctx context.Context, req models.RetrieveContextRequest, emit RetrievalStreamEmitter) error {
+	return lds.contextService.StreamRetrieveContext(ctx, req, emit)
+}
+
+// GetSessionStats 获取会话统计（代理到底层ContextService）
+func (lds *LLMDrivenContextService) GetSessionStats(ctx context.Context, sessionID string) (*models.SessionStats, error) {
+	return lds.contextService.GetSessionStats(ctx, sessionID)
+}
+
+// ListMemories 列出会话中已存储的记忆（代理到底层ContextService）
+func (lds *LLMDrivenContextService) ListMemories(ctx context.Context, req models.ListMemoriesRequest) (*models.ListMemoriesResponse, error) {
+	return lds.contextService.ListMemories(ctx, req)
+}
+
+// ArchiveMemory 归档记忆（代理到底层ContextService）
+func (lds *LLMDrivenContextService) ArchiveMemory(ctx context.Context, req models.ArchiveMemoryRequest) (*models.ArchiveMemoryResponse, error) {
+	return lds.contextService.ArchiveMemory(ctx, req)
+}
+
+// RestoreMemory 恢复已归档的记忆（代理到底层ContextService）
+func (lds *LLMDrivenContextService) RestoreMemory(ctx context.Context, req models.ArchiveMemoryRequest) (*models.ArchiveMemoryResponse, error) {
+	return lds.contextService.RestoreMemory(ctx, req)
+}
+
+// GetConversation 还原会话或批次的完整对话记录（代理到底层ContextService）
+func (lds *LLMDrivenContextService) GetConversation(ctx context.Context, req models.GetConversationRequest) (*models.ConversationTranscript, error) {
+	return lds.contextService.GetConversation(ctx, req)
+}
+
+// ListWorkspaces 列出用户会话涉及的工作空间（代理到底层ContextService）
+func (lds *LLMDrivenContextService) ListWorkspaces(userID string) ([]models.WorkspaceInfo, error) {
+	return lds.contextService.ListWorkspaces(userID)
+}
+
+// SwitchWorkspace 切换到工作空间最近活跃的会话（代理到底层ContextService）
+func (lds *LLMDrivenContextService) SwitchWorkspace(userID, workspace string) (*models.Session, error) {
+	return lds.contextService.SwitchWorkspace(userID, workspace)
+}
+
+// GetLLMDrivenConfigSummary 获取LLM驱动配置摘要（代理到底层ContextService）
+func (lds *LLMDrivenContextService) GetLLMDrivenConfigSummary() map[string]interface{} {
+	return lds.contextService.GetLLMDrivenConfigSummary()
+}
+
+// ReloadLLMDrivenConfig 重新加载LLM驱动配置（代理到底层ContextService）
+func (lds *LLMDrivenContextService) ReloadLLMDrivenConfig() (map[string]interface{}, error) {
+	return lds.contextService.ReloadLLMDrivenConfig()
+}
+
+// GetLLMUsage 获取LLM用量统计（代理到底层ContextService）
+func (lds *LLMDrivenContextService) GetLLMUsage() *llm.UsageSnapshot {
+	return lds.contextService.GetLLMUsage()
+}
+
+// QueryTimeline 查询时间线事件（代理到底层ContextService）
+func (lds *LLMDrivenContextService) QueryTimeline(ctx context.Context, userID, workspaceID string, from, to time.Time, eventTypes []string, limit int) (*models.TimelineQueryResponse, error) {
+	return lds.contextService.QueryTimeline(ctx, userID, workspaceID, from, to, eventTypes, limit)
+}
+
+// QueryKnowledgeGraph 查询知识图谱子图（代理到底层ContextService）
+func (lds *LLMDrivenContextService) QueryKnowledgeGraph(ctx context.Context, userID, entityName string, maxDepth int) (*models.KnowledgeGraphResponse, error) {
+	return lds.contextService.QueryKnowledgeGraph(ctx, userID, entityName, maxDepth)
+}
+
+// UpdateTodo 更新待办事项（代理到底层ContextService）
+func (lds *LLMDrivenContextService) UpdateTodo(ctx context.Context, req models.UpdateTodoRequest) (*models.TodoItem, error) {
+	return lds.contextService.UpdateTodo(ctx, req)
+}
+
 // StartSessionCleanupTask 启动会话清理任务（代理到底层ContextService）
 func (lds *LLMDrivenContextService) StartSessionCleanupTask(ctx context.Context, timeout time.Duration, interval time.Duration) {
 	lds.contextService.StartSessionCleanupTask(ctx, timeout, interval)
 }
 
+// BeginIdempotentRequest 登记带幂等键的写入请求（代理到底层ContextService）
+func (lds *LLMDrivenContextService) BeginIdempotentRequest(tool, scope, key string) (map[string]interface{}, error) {
+	return lds.contextService.BeginIdempotentRequest(tool, scope, key)
+}
+
+// CompleteIdempotentRequest 记录幂等请求的首次结果（代理到底层ContextService）
+func (lds *LLMDrivenContextService) CompleteIdempotentRequest(tool, scope, key string, response interface{}) {
+	lds.contextService.CompleteIdempotentRequest(tool, scope, key, response)
+}
+
+// AbortIdempotentRequest 释放失败请求的幂等键（代理到底层ContextService）
+func (lds *LLMDrivenContextService) AbortIdempotentRequest(tool, scope, key string) {
+	lds.contextService.AbortIdempotentRequest(tool, scope, key)
+}
+
+// RunSessionCleanup 执行一次会话清理（代理到底层ContextService）
+func (lds *LLMDrivenContextService) RunSessionCleanup(ctx context.Context, timeout time.Duration, dryRun bool) *models.CleanupAudit {
+	return lds.contextService.RunSessionCleanup(ctx, timeout, dryRun)
+}
+
+// GetLastCleanupAudit 获取最近一次会话清理的审计记录（代理到底层ContextService）
+func (lds *LLMDrivenContextService) GetLastCleanupAudit() (*models.CleanupAudit, error) {
+	return lds.contextService.GetLastCleanupAudit()
+}
+
+// StartKnowledgeGraphPruneTask 启动知识图谱关系清理任务（代理到底层ContextService）
+func (lds *LLMDrivenContextService) StartKnowledgeGraphPruneTask(ctx context.Context) {
+	lds.contextService.StartKnowledgeGraphPruneTask(ctx)
+}
+
 // 运行时控制接口
 func (lds *LLMDrivenContextService) EnableLLMDriven(enabled bool) {
 	lds.enabled = enabled
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"unicode"
+)
+
+// 内容语言，auto表示按内容中的文字自动判断
+const (
+	LocaleAuto = "auto"
+	LocaleZh   = "zh"
+	LocaleEn   = "en"
+)
+
+// eventTypeRule 事件类型关键词规则，按顺序匹配，越具体的类型越靠前
+type eventTypeRule struct {
+	eventType string
+	pattern   *regexp.Regexp
+}
+
+// localeKeywords 某一语言的待办检测和事件类型关键词
+type localeKeywords struct {
+	todoPrefix   *regexp.Regexp // 内容开头的待办标记
+	todoKeywords *regexp.Regexp // 内容中的待办关键词
+	eventTypes   []eventTypeRule
+}
+
+var localeKeywordSets = map[string]*localeKeywords{
+	LocaleZh: {
+		todoPrefix:   regexp.MustCompile(`(?i)^(- \[ \]|TODO:|待办:|提醒:|task:)`),
+		todoKeywords: regexp.MustCompile(`(?i)(待办事项|todo item|task list|待完成|to-do|to do)`),
+		eventTypes: []eventTypeRule{
+			{"deployment", regexp.MustCompile(`部署|发布|上线`)},
+			{"test", regexp.MustCompile(`测试|验证|实验`)},
+			{"meeting", regexp.MustCompile(`会议|评审会|讨论会`)},
+			{"review", regexp.MustCompile(`审查|评审`)},
+			{"decision", regexp.MustCompile(`决定|决策|选择|确定|采用`)},
+			{"problem_solve", regexp.MustCompile(`(?i)解决|修复|故障|异常|bug`)},
+			{"design", regexp.MustCompile(`设计|架构|方案`)},
+			{"code_edit", regexp.MustCompile(`修改了|实现了|代码|文件|函数`)},
+			{"knowledge_share", regexp.MustCompile(`分享|最佳实践|经验|总结|技巧`)},
+			{"discussion", regexp.MustCompile(`讨论|交流|分析|对比|评估`)},
+		},
+	},
+	LocaleEn: {
+		todoPrefix:   regexp.MustCompile(`(?i)^\s*(- \[ \]|\* \[ \]|TODO\b|FIXME\b|action items?:|reminder:|task:)`),
+		todoKeywords: regexp.MustCompile(`(?i)\b(todo|to-do|to do list|need to|needs to|have to|remember to|don't forget to|follow up on|action items?|next steps?)\b`),
+		eventTypes: []eventTypeRule{
+			{"deployment", regexp.MustCompile(`(?i)\b(deploy(ed|ing|ment)?|released|shipped|went live|rolled out)\b`)},
+			{"test", regexp.MustCompile(`(?i)\b(tests?|tested|testing|verified|experiment(ed)?)\b`)},
+			{"meeting", regexp.MustCompile(`(?i)\b(meeting|stand-?up|retro(spective)?|sync-?up)\b`)},
+			{"review", regexp.MustCompile(`(?i)\b(review(ed|ing)?|audit(ed)?)\b`)},
+			{"decision", regexp.MustCompile(`(?i)\b(decided|decision|chose|opted for|settled on|went with|adopted)\b`)},
+			{"problem_solve", regexp.MustCompile(`(?i)\b(fix(ed|es)?|bugs?|resolved|solved|incident|outage|crash(ed)?|exception)\b`)},
+			{"design", regexp.MustCompile(`(?i)\b(design(ed)?|architecture|architected)\b`)},
+			{"code_edit", regexp.MustCompile(`(?i)\b(implemented|refactor(ed)?|modified|edited|code|function|file)\b`)},
+			{"knowledge_share", regexp.MustCompile(`(?i)\b(shared|best practices?|lessons? learned|tips?)\b`)},
+			{"discussion", regexp.MustCompile(`(?i)\b(discuss(ed|ion)?|talked about|compared|analy[sz]ed|evaluated)\b`)},
+		},
+	},
+}
+
+// ValidateLocale 校验locale参数，空值视为auto
+func ValidateLocale(locale string) error {
+	switch locale {
+	case "", LocaleAuto, LocaleZh, LocaleEn:
+		return nil
+	}
+	return fmt.Errorf("不支持的locale: %s，可选: auto, zh, en", locale)
+}
+
+// DetectLocale 按内容中汉字和拉丁字母的比例判断语言，汉字信息密度更高，按1:3折算
+func DetectLocale(content string) string {
+	han, latin := 0, 0
+	for _, r := range content {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			latin++
+		}
+	}
+	if latin > 0 && han*3 < latin {
+		return LocaleEn
+	}
+	return LocaleZh
+}
+
+// keywordSetsFor 返回按优先级排列的关键词集合
+// 指定语言时只使用该语言的规则；auto时先用检测出的主语言，再用另一种语言，中英混合内容两套规则都生效
+func keywordSetsFor(content, locale string) []*localeKeywords {
+	switch locale {
+	case LocaleZh, LocaleEn:
+		return []*localeKeywords{localeKeywordSets[locale]}
+	}
+	if DetectLocale(content) == LocaleEn {
+		return []*localeKeywords{localeKeywordSets[LocaleEn], localeKeywordSets[LocaleZh]}
+	}
+	return []*localeKeywords{localeKeywordSets[LocaleZh], localeKeywordSets[LocaleEn]}
+}
+
+// IsTodoContent 判断内容是否为待办事项
+func IsTodoContent(content, locale string) bool {
+	for _, keywords := range keywordSetsFor(content, locale) {
+		if keywords.todoPrefix.MatchString(content) || keywords.todoKeywords.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifyEventType 按关键词判断时间线事件类型，未命中任何规则时返回空字符串
+func ClassifyEventType(content, locale string) string {
+	for _, keywords := range keywordSetsFor(content, locale) {
+		for _, rule := range keywords.eventTypes {
+			if rule.pattern.MatchString(content) {
+				return rule.eventType
+			}
+		}
+	}
+	return ""
+}
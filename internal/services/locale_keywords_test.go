@@ -0,0 +1,66 @@
+package services
+
+import "testing"
+
+// TestIsTodoContent 测试中文、英文和中英混合内容的待办检测
+func TestIsTodoContent(t *testing.T) {
+	tests := []struct {
+		content string
+		locale  string
+		want    bool
+	}{
+		// 中文规则保持不变
+		{"待办: 修复登录超时", LocaleAuto, true},
+		{"整理待办事项清单", LocaleAuto, true},
+		{"- [ ] 更新文档", LocaleAuto, true},
+		{"今天讨论了缓存方案", LocaleAuto, false},
+		// 英文
+		{"TODO: migrate the user table", LocaleAuto, true},
+		{"We need to rotate the API keys before Friday", LocaleAuto, true},
+		{"Remember to bump the version", LocaleEn, true},
+		{"The cache layer uses Redis", LocaleAuto, false},
+		// 中英混合
+		{"need to 修复登录超时", LocaleAuto, true},
+		{"登录模块 TODO: add rate limiting", LocaleAuto, true},
+		{"review了 login 模块的代码", LocaleAuto, false},
+		// 指定语言时只使用该语言的规则
+		{"We need to rotate the API keys", LocaleZh, false},
+		{"待完成的任务", LocaleEn, false},
+	}
+	for _, tt := range tests {
+		if got := IsTodoContent(tt.content, tt.locale); got != tt.want {
+			t.Errorf("IsTodoContent(%q, %q) = %v, want %v", tt.content, tt.locale, got, tt.want)
+		}
+	}
+}
+
+// TestClassifyEventType 测试中文、英文和中英混合内容的事件类型判断
+func TestClassifyEventType(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"解决了数据库连接池耗尽的问题", "problem_solve"},
+		{"决定采用Redis作为缓存方案", "decision"},
+		{"完成了生产环境的部署", "deployment"},
+		{"We fixed the bug in the login flow", "problem_solve"},
+		{"The team decided to use Postgres", "decision"},
+		{"Deployed v2.1 to production", "deployment"},
+		{"Shared some tips on writing Go benchmarks", "knowledge_share"},
+		{"修复了 login timeout bug", "problem_solve"},
+		{"We decided to 采用 gRPC for internal calls", "decision"},
+		{"hello world", ""},
+	}
+	for _, tt := range tests {
+		if got := ClassifyEventType(tt.content, LocaleAuto); got != tt.want {
+			t.Errorf("ClassifyEventType(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+
+	if locale := DetectLocale("Fixed the flaky test in CI"); locale != LocaleEn {
+		t.Errorf("Expected en, got %s", locale)
+	}
+	if locale := DetectLocale("修复了 CI 中不稳定的 test"); locale != LocaleZh {
+		t.Errorf("Expected zh, got %s", locale)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 记忆归档（软删除）：在metadata中标记archived，记录保留在向量存储中，可随时恢复
+// metadata在多数向量存储中以JSON字符串保存，无法在存储侧按archived过滤，
+// 各检索路径在拿到结果后统一排除归档记录，请求includeArchived时保留
+// =============================================================================
+
+// archivedRetentionPolicy 保留策略中针对已归档记忆的策略名，期限从归档时间起算
+const archivedRetentionPolicy = "archived"
+
+// ArchiveMemory 归档记忆，归档后默认不参与检索；只能归档自己的记忆
+func (s *ContextService) ArchiveMemory(ctx context.Context, req models.ArchiveMemoryRequest) (*models.ArchiveMemoryResponse, error) {
+	return s.setMemoryArchived(ctx, req, true)
+}
+
+// RestoreMemory 恢复已归档的记忆
+func (s *ContextService) RestoreMemory(ctx context.Context, req models.ArchiveMemoryRequest) (*models.ArchiveMemoryResponse, error) {
+	return s.setMemoryArchived(ctx, req, false)
+}
+
+// setMemoryArchived 通过原地更新metadata设置或清除归档标记，记忆ID、内容和关联数据保持不变
+func (s *ContextService) setMemoryArchived(ctx context.Context, req models.ArchiveMemoryRequest, archived bool) (*models.ArchiveMemoryResponse, error) {
+	metadata := map[string]interface{}{
+		models.MetadataArchivedKey:   nil,
+		models.MetadataArchivedAtKey: nil,
+	}
+	var archivedAt int64
+	if archived {
+		archivedAt = time.Now().Unix()
+		metadata[models.MetadataArchivedKey] = true
+		metadata[models.MetadataArchivedAtKey] = archivedAt
+	}
+
+	updated, err := s.UpdateMemory(ctx, models.UpdateMemoryRequest{
+		SessionID: req.SessionID,
+		MemoryID:  req.MemoryID,
+		Metadata:  metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("🗄️ [记忆归档] 记忆 %s 归档状态已更新: archived=%v", req.MemoryID, archived)
+	return &models.ArchiveMemoryResponse{
+		MemoryID:   req.MemoryID,
+		Archived:   archived,
+		ArchivedAt: archivedAt,
+		Memory:     updated.Memory,
+	}, nil
+}
+
+// isArchivedResult 记录是否已归档
+func isArchivedResult(result models.SearchResult) bool {
+	metadata := parseResultMetadata(result)
+	return metadata != nil && metadata[models.MetadataArchivedKey] == true
+}
+
+// excludeArchivedResults 排除已归档的记录，返回保留的记录和排除的数量
+func excludeArchivedResults(results []models.SearchResult) ([]models.SearchResult, int) {
+	kept := make([]models.SearchResult, 0, len(results))
+	for _, result := range results {
+		if !isArchivedResult(result) {
+			kept = append(kept, result)
+		}
+	}
+	return kept, len(results) - len(kept)
+}
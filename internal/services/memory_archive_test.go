@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestArchiveAndRestoreMemory 测试归档的记忆默认不参与检索和列表、includeArchived时返回，恢复后重新可见，并可按archived策略过期
+func TestArchiveAndRestoreMemory(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	session := models.NewSession("s1")
+	session.Metadata = map[string]interface{}{"userId": "user_a"}
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+	memory := models.NewMemory("s1", "登录超时需要调大数据库连接池", "P1", map[string]interface{}{"type": "long_term_memory"})
+	memory.ID = "m1"
+	memory.UserID = "user_a"
+	memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+	if err := vectorStore.StoreMemory(memory); err != nil {
+		t.Fatalf("存储失败: %v", err)
+	}
+
+	ctx := context.Background()
+	archived, err := service.ArchiveMemory(ctx, models.ArchiveMemoryRequest{SessionID: "s1", MemoryID: "m1"})
+	if err != nil || !archived.Archived || archived.ArchivedAt == 0 {
+		t.Fatalf("归档失败: %+v, %v", archived, err)
+	}
+
+	visible := func(includeArchived bool) (int, int) {
+		retrieved, err := service.RetrieveContext(ctx, models.RetrieveContextRequest{
+			SessionID: "s1", Query: "数据库连接池", Structured: true, IncludeArchived: includeArchived,
+		})
+		if err != nil {
+			t.Fatalf("检索失败: %v", err)
+		}
+		listed, err := service.ListMemories(ctx, models.ListMemoriesRequest{SessionID: "s1", IncludeArchived: includeArchived})
+		if err != nil {
+			t.Fatalf("列出记忆失败: %v", err)
+		}
+		return len(retrieved.Results), len(listed.Items)
+	}
+	if retrieved, listed := visible(false); retrieved != 0 || listed != 0 {
+		t.Errorf("归档的记忆默认不应返回: retrieve=%d, list=%d", retrieved, listed)
+	}
+	if retrieved, listed := visible(true); retrieved != 1 || listed != 1 {
+		t.Errorf("includeArchived时应返回归档的记忆: retrieve=%d, list=%d", retrieved, listed)
+	}
+
+	results, err := service.searchSessionMemories(ctx, "s1", "user_a", 10)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("读取记录失败: %d, %v", len(results), err)
+	}
+	policies := map[string]time.Duration{archivedRetentionPolicy: 24 * time.Hour}
+	if memoryType, expired := memoryRetentionExpired(results[0], policies, time.Now().Add(25*time.Hour)); !expired || memoryType != archivedRetentionPolicy {
+		t.Errorf("超过archived期限的归档记忆应过期: %s, %v", memoryType, expired)
+	}
+	if _, expired := memoryRetentionExpired(results[0], policies, time.Now()); expired {
+		t.Error("未超过archived期限的归档记忆不应过期")
+	}
+
+	if _, err := service.RestoreMemory(ctx, models.ArchiveMemoryRequest{SessionID: "s1", MemoryID: "m1"}); err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	if retrieved, listed := visible(false); retrieved != 1 || listed != 1 {
+		t.Errorf("恢复后应重新参与检索: retrieve=%d, list=%d", retrieved, listed)
+	}
+}
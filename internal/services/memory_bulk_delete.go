@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 按条件批量删除时每轮扫描的记录数、最多扫描轮数和预览返回的ID数
+const (
+	bulkDeleteScanLimit   = 1000
+	bulkDeleteScanRounds  = 20
+	bulkDeleteSampleLimit = 20
+)
+
+// DeleteMemoriesByFilter 按会话、类型、优先级和时间范围批量删除调用方用户的记忆，并级联清理时间线和知识图谱数据
+// 默认演练只统计匹配数量；confirm为true时才删除。过滤条件为空或匹配该用户全部记录时，需设置allowAll才会删除
+func (s *ContextService) DeleteMemoriesByFilter(ctx context.Context, req models.DeleteMemoriesByFilterRequest) (*models.DeleteMemoriesByFilterResponse, error) {
+	return s.deleteMemoriesByFilter(ctx, req, s.neo4jDetachMemories)
+}
+
+// deleteMemoriesByFilter 按条件批量删除记忆，知识图谱数据通过detach移除或在演练时统计
+func (s *ContextService) deleteMemoriesByFilter(ctx context.Context, req models.DeleteMemoriesByFilterRequest, detach memoryGraphDetacher) (*models.DeleteMemoriesByFilterResponse, error) {
+	if req.SessionID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("会话ID不能为空")
+	}
+	if err := validateBulkDeleteFilter(&req); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.GetUserIDFromSessionID(req.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户ID失败: %w", err)
+	}
+
+	records, err := s.searchByUserID(ctx, userID, bulkDeleteScanLimit)
+	if err != nil {
+		return nil, fmt.Errorf("扫描用户记忆失败: %w", err)
+	}
+	owned, matched := 0, []models.SearchResult{}
+	for _, record := range records {
+		// 部分向量存储不支持按用户过滤，这里再次校验用户
+		if getResultUserID(record) != userID {
+			continue
+		}
+		owned++
+		if matchesBulkDeleteFilter(record, req) {
+			matched = append(matched, record)
+		}
+	}
+
+	response := &models.DeleteMemoriesByFilterResponse{
+		DryRun:     !req.Confirm,
+		Matched:    len(matched),
+		MatchesAll: owned > 0 && len(matched) == owned,
+		SampleIDs:  []string{},
+	}
+	for _, record := range matched[:min(len(matched), bulkDeleteSampleLimit)] {
+		response.SampleIDs = append(response.SampleIDs, record.ID)
+	}
+
+	if !req.Confirm {
+		// 演练时统计知识图谱中实际会删除的概念和关系，共享的概念和关系只会移除归属、不计入
+		response.ConceptsDeleted, response.RelationsDeleted = deleteLinkedKnowledgeGraph(ctx, userID, cascadeMemoryIDs(matched), true, detach)
+		response.Description = fmt.Sprintf("演练: 匹配%d条记忆，将删除知识图谱概念%d个、关系%d条，设置confirm=true后删除",
+			response.Matched, response.ConceptsDeleted, response.RelationsDeleted)
+		if len(records) >= bulkDeleteScanLimit {
+			response.Description += fmt.Sprintf("（只扫描了前%d条记录，实际匹配数可能更多）", bulkDeleteScanLimit)
+		}
+		log.Printf("🧪 [批量删除] 用户=%s, %s", userID, response.Description)
+		return response, nil
+	}
+	if response.MatchesAll && !req.AllowAll {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("过滤条件匹配了该用户的全部%d条记忆，如确需全部删除请设置allowAll=true", owned)
+	}
+
+	// 与记忆重建和用户清除共用任务标记，避免删除过程中重建任务重新写入向量
+	if !s.acquireReindex(userID) {
+		return nil, ErrPurgeUserConflict
+	}
+	defer s.releaseReindex(userID)
+
+	vectorIDs, cascadeIDs, err := s.deleteMatchedMemories(ctx, userID, req, matched)
+	response.DeletedCount = len(vectorIDs)
+	if err != nil {
+		return nil, err
+	}
+	response.TimelineDeleted = s.deleteLinkedTimelineEvents(ctx, userID, cascadeIDs)
+	response.ConceptsDeleted, response.RelationsDeleted = deleteLinkedKnowledgeGraph(ctx, userID, cascadeIDs, false, detach)
+
+	response.Description = fmt.Sprintf("已删除向量记录%d条，时间线事件%d条，概念%d个，关系%d条",
+		response.DeletedCount, response.TimelineDeleted, response.ConceptsDeleted, response.RelationsDeleted)
+	log.Printf("✅ [批量删除] 用户=%s, %s", userID, response.Description)
+	return response, nil
+}
+
+// deleteMatchedMemories 删除首轮扫描匹配的记录，再分轮扫描删除超出扫描上限的匹配记录
+// 返回已删除的向量记录ID和需要级联清理的memoryID
+func (s *ContextService) deleteMatchedMemories(ctx context.Context, userID string, req models.DeleteMemoriesByFilterRequest,
+	matched []models.SearchResult) ([]string, []string, error) {
+	deleted := make(map[string]bool)
+	cascaded := make(map[string]bool)
+	var vectorIDs, cascadeIDs []string
+
+	for round := 0; round < bulkDeleteScanRounds; round++ {
+		if round > 0 {
+			records, err := s.searchByUserID(ctx, userID, bulkDeleteScanLimit)
+			if err != nil {
+				return vectorIDs, cascadeIDs, fmt.Errorf("扫描用户记忆失败: %w", err)
+			}
+			matched = matched[:0]
+			for _, record := range records {
+				if getResultUserID(record) == userID && !deleted[record.ID] && matchesBulkDeleteFilter(record, req) {
+					matched = append(matched, record)
+				}
+			}
+		}
+		if len(matched) == 0 {
+			return vectorIDs, cascadeIDs, nil
+		}
+
+		ids := make([]string, 0, len(matched))
+		for _, record := range matched {
+			ids = append(ids, record.ID)
+		}
+		if err := s.deleteMemories(ctx, ids); err != nil {
+			return vectorIDs, cascadeIDs, fmt.Errorf("删除向量记录失败: %w", err)
+		}
+
+		for _, record := range matched {
+			deleted[record.ID] = true
+			vectorIDs = append(vectorIDs, record.ID)
+			if cascadeID := cascadeMemoryID(record); !cascaded[cascadeID] {
+				cascaded[cascadeID] = true
+				cascadeIDs = append(cascadeIDs, cascadeID)
+			}
+		}
+	}
+	return vectorIDs, cascadeIDs, fmt.Errorf("扫描%d轮后仍有未删除的匹配记录，已删除%d条", bulkDeleteScanRounds, len(vectorIDs))
+}
+
+// cascadeMemoryID 记录级联清理时间线和知识图谱使用的记忆ID：分块记录取所属的memory_id，否则为记录ID
+func cascadeMemoryID(record models.SearchResult) string {
+	if memoryID, _ := record.Fields["memory_id"].(string); memoryID != "" {
+		return memoryID
+	}
+	return record.ID
+}
+
+// cascadeMemoryIDs 去重后的级联清理记忆ID
+func cascadeMemoryIDs(records []models.SearchResult) []string {
+	seen := make(map[string]bool, len(records))
+	var ids []string
+	for _, record := range records {
+		if id := cascadeMemoryID(record); !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// validateBulkDeleteFilter 校验并规范化批量删除的过滤条件，条件为空时必须设置allowAll
+func validateBulkDeleteFilter(req *models.DeleteMemoriesByFilterRequest) error {
+	req.FilterSessionID = strings.TrimSpace(req.FilterSessionID)
+	req.Type = strings.TrimSpace(req.Type)
+	req.Priority = strings.ToUpper(strings.TrimSpace(req.Priority))
+
+	switch req.Priority {
+	case "", models.PriorityP0, models.PriorityP1, models.PriorityP2, models.PriorityP3:
+	default:
+		return apperrors.ErrInvalidArgument.WithMessagef("无效的priority: %s，可选: P0, P1, P2, P3", req.Priority)
+	}
+	if req.StartTime < 0 || req.EndTime < 0 {
+		return apperrors.ErrInvalidArgument.WithMessagef("startTime和endTime必须是非负的unix秒")
+	}
+	if req.StartTime > 0 && req.EndTime > 0 && req.StartTime > req.EndTime {
+		return apperrors.ErrInvalidArgument.WithMessagef("startTime(%d)不能晚于endTime(%d)", req.StartTime, req.EndTime)
+	}
+
+	empty := req.FilterSessionID == "" && req.Type == "" && req.Priority == "" && req.StartTime == 0 && req.EndTime == 0
+	if empty && !req.AllowAll {
+		return apperrors.ErrInvalidArgument.WithMessagef("过滤条件为空会匹配该用户的全部记忆，请指定filterSessionId、type、priority或时间范围，或设置allowAll=true")
+	}
+	return nil
+}
+
+// matchesBulkDeleteFilter 记录是否满足批量删除的全部过滤条件
+func matchesBulkDeleteFilter(record models.SearchResult, req models.DeleteMemoriesByFilterRequest) bool {
+	if req.FilterSessionID != "" {
+		if sessionID, _ := record.Fields["session_id"].(string); sessionID != req.FilterSessionID {
+			return false
+		}
+	}
+	if req.Type != "" && getResultMemoryType(record) != req.Type {
+		return false
+	}
+	if req.Priority != "" {
+		if priority, _ := record.Fields["priority"].(string); priority != req.Priority {
+			return false
+		}
+	}
+	timestamp := getResultTimestamp(record)
+	if req.StartTime > 0 && timestamp < req.StartTime {
+		return false
+	}
+	if req.EndTime > 0 && timestamp > req.EndTime {
+		return false
+	}
+	return true
+}
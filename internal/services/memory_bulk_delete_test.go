@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// newDeleteTestService 创建会话s1属于user_a、使用内存向量存储的服务，storeMemory写入指定用户的记忆
+func newDeleteTestService(t *testing.T) (*ContextService, func(id, sessionID, userID, priority string)) {
+	t.Helper()
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	session := models.NewSession("s1")
+	session.Metadata = map[string]interface{}{"userId": "user_a"}
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+	storeMemory := func(id, sessionID, userID, priority string) {
+		memory := models.NewMemory(sessionID, "导入的测试数据 "+id, priority, nil)
+		memory.ID = id
+		memory.UserID = userID
+		memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+	}
+	return service, storeMemory
+}
+
+// graphDetachCall 记录一次知识图谱移除调用
+type graphDetachCall struct {
+	userID    string
+	memoryIDs []string
+	dryRun    bool
+}
+
+// recordingGraphDetacher 记录调用参数并返回固定计数的知识图谱移除函数
+func recordingGraphDetacher(calls *[]graphDetachCall, counts knowledge.MemoryDetachCounts) memoryGraphDetacher {
+	return func(ctx context.Context, userID string, memoryIDs []string, dryRun bool) (knowledge.MemoryDetachCounts, error) {
+		*calls = append(*calls, graphDetachCall{userID: userID, memoryIDs: append([]string(nil), memoryIDs...), dryRun: dryRun})
+		return counts, nil
+	}
+}
+
+// TestDeleteMemoriesByFilter 测试默认只预览匹配数量，confirm后只删除当前用户匹配的记录，空条件和匹配全部记忆时需要allowAll
+func TestDeleteMemoriesByFilter(t *testing.T) {
+	service, storeMemory := newDeleteTestService(t)
+	storeMemory("keep", "s1", "user_a", "P1")
+	storeMemory("import1", "import", "user_a", "P3")
+	storeMemory("import2", "import", "user_a", "P3")
+	storeMemory("other", "import", "user_b", "P3")
+
+	ctx := context.Background()
+	if _, err := service.DeleteMemoriesByFilter(ctx, models.DeleteMemoriesByFilterRequest{SessionID: "s1", Confirm: true}); err == nil {
+		t.Error("空过滤条件未设置allowAll时应拒绝")
+	}
+
+	filter := models.DeleteMemoriesByFilterRequest{SessionID: "s1", FilterSessionID: "import", Priority: "p3"}
+	preview, err := service.DeleteMemoriesByFilter(ctx, filter)
+	if err != nil {
+		t.Fatalf("预览失败: %v", err)
+	}
+	if !preview.DryRun || preview.Matched != 2 || preview.MatchesAll || preview.DeletedCount != 0 {
+		t.Errorf("预览应匹配user_a的2条导入记录且不删除: %+v", preview)
+	}
+
+	filter.Confirm = true
+	deleted, err := service.DeleteMemoriesByFilter(ctx, filter)
+	if err != nil {
+		t.Fatalf("批量删除失败: %v", err)
+	}
+	if deleted.DryRun || deleted.DeletedCount != 2 {
+		t.Errorf("应删除2条记录: %+v", deleted)
+	}
+	remaining, _ := service.searchByUserID(ctx, "user_b", 10)
+	if len(remaining) != 1 {
+		t.Errorf("不应删除其他用户的记录: %d", len(remaining))
+	}
+
+	all := models.DeleteMemoriesByFilterRequest{SessionID: "s1", Priority: "P1", Confirm: true}
+	if _, err := service.DeleteMemoriesByFilter(ctx, all); err == nil {
+		t.Error("条件匹配全部记忆且未设置allowAll时应拒绝")
+	}
+	all.AllowAll = true
+	if result, err := service.DeleteMemoriesByFilter(ctx, all); err != nil || result.DeletedCount != 1 {
+		t.Errorf("设置allowAll后应删除剩余记忆: %+v, %v", result, err)
+	}
+}
+
+// TestDeleteMemoriesByFilterDryRunGraphCounts 测试演练只统计知识图谱中实际会删除的概念和关系，不修改任何数据；
+// confirm后以相同的记忆ID真正移除
+func TestDeleteMemoriesByFilterDryRunGraphCounts(t *testing.T) {
+	service, storeMemory := newDeleteTestService(t)
+	storeMemory("keep", "s1", "user_a", "P1")
+	storeMemory("import1", "import", "user_a", "P3")
+	storeMemory("import2", "import", "user_a", "P3")
+
+	var calls []graphDetachCall
+	detach := recordingGraphDetacher(&calls, knowledge.MemoryDetachCounts{Concepts: 2, Relations: 1, DetachedConcepts: 3})
+	ctx := context.Background()
+	filter := models.DeleteMemoriesByFilterRequest{SessionID: "s1", FilterSessionID: "import"}
+
+	preview, err := service.deleteMemoriesByFilter(ctx, filter, detach)
+	if err != nil {
+		t.Fatalf("预览失败: %v", err)
+	}
+	if !preview.DryRun || preview.DeletedCount != 0 || preview.ConceptsDeleted != 2 || preview.RelationsDeleted != 1 {
+		t.Errorf("演练应报告实际会删除的概念和关系数（不含只移除归属的）: %+v", preview)
+	}
+	if len(calls) != 1 || !calls[0].dryRun || calls[0].userID != "user_a" {
+		t.Fatalf("演练应以dryRun调用一次知识图谱移除: %+v", calls)
+	}
+	sort.Strings(calls[0].memoryIDs)
+	if !reflect.DeepEqual(calls[0].memoryIDs, []string{"import1", "import2"}) {
+		t.Errorf("演练应统计匹配的记忆: %v", calls[0].memoryIDs)
+	}
+	if remaining, _ := service.searchByUserID(ctx, "user_a", 10); len(remaining) != 3 {
+		t.Errorf("演练不应删除向量记录，剩余%d条", len(remaining))
+	}
+
+	filter.Confirm = true
+	deleted, err := service.deleteMemoriesByFilter(ctx, filter, detach)
+	if err != nil {
+		t.Fatalf("批量删除失败: %v", err)
+	}
+	if len(calls) != 2 || calls[1].dryRun {
+		t.Fatalf("confirm后应真正移除知识图谱数据: %+v", calls)
+	}
+	sort.Strings(calls[1].memoryIDs)
+	if !reflect.DeepEqual(calls[1].memoryIDs, calls[0].memoryIDs) || deleted.ConceptsDeleted != 2 || deleted.RelationsDeleted != 1 {
+		t.Errorf("实际删除应与演练统计一致: %v, %+v", calls[1].memoryIDs, deleted)
+	}
+}
+
+// TestDeleteMemoryDetachesKnowledgeGraph 测试删除记忆时只从知识图谱移除通过归属校验的memoryID，
+// 删除其他用户的记忆时拒绝且不修改知识图谱，图谱移除失败时仍完成向量删除
+func TestDeleteMemoryDetachesKnowledgeGraph(t *testing.T) {
+	service, storeMemory := newDeleteTestService(t)
+	storeMemory("m1", "s1", "user_a", "P1")
+	storeMemory("m2", "s1", "user_a", "P1")
+	storeMemory("other", "s1", "user_b", "P1")
+
+	var calls []graphDetachCall
+	detach := recordingGraphDetacher(&calls, knowledge.MemoryDetachCounts{Concepts: 1, DetachedConcepts: 2, DetachedRelations: 1})
+	ctx := context.Background()
+
+	if _, err := service.deleteMemory(ctx, models.DeleteMemoryRequest{SessionID: "s1", MemoryID: "other"}, detach); err == nil {
+		t.Error("删除其他用户的记忆应被拒绝")
+	}
+	if len(calls) != 0 {
+		t.Fatalf("拒绝删除时不应修改知识图谱: %+v", calls)
+	}
+
+	response, err := service.deleteMemory(ctx, models.DeleteMemoryRequest{SessionID: "s1", MemoryID: "m1"}, detach)
+	if err != nil {
+		t.Fatalf("删除记忆失败: %v", err)
+	}
+	if response.DeletedCount != 1 || response.ConceptsDeleted != 1 || response.RelationsDeleted != 0 {
+		t.Errorf("删除结果错误: %+v", response)
+	}
+	want := []graphDetachCall{{userID: "user_a", memoryIDs: []string{"m1"}, dryRun: false}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("应只从知识图谱移除m1:\n期望 %+v\n实际 %+v", want, calls)
+	}
+	if remaining, _ := service.searchByUserID(ctx, "user_a", 10); len(remaining) != 1 || remaining[0].ID != "m2" {
+		t.Errorf("应只删除m1的向量记录: %v", remaining)
+	}
+
+	failing := func(ctx context.Context, userID string, memoryIDs []string, dryRun bool) (knowledge.MemoryDetachCounts, error) {
+		return knowledge.MemoryDetachCounts{}, errors.New("neo4j不可用")
+	}
+	response, err = service.deleteMemory(ctx, models.DeleteMemoryRequest{SessionID: "s1", MemoryID: "m2"}, failing)
+	if err != nil || response.DeletedCount != 1 || response.ConceptsDeleted != 0 {
+		t.Errorf("知识图谱移除失败时应仍删除向量记录: %+v, %v", response, err)
+	}
+}
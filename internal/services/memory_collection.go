@@ -0,0 +1,77 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 命名集合：同一用户的记忆按collection划分逻辑分区（如work/personal）
+// 集合名写入记录的metadata，各向量存储都会持久化metadata但无法在存储侧按其过滤，
+// 检索时多取候选后统一按集合过滤；未指定集合时保持原有的单一集合行为
+// =============================================================================
+
+// collectionFetchMultiplier 按集合检索时候选数量的放大倍数，弥补过滤掉的其他集合记录
+const collectionFetchMultiplier = 4
+
+// collectionNamePattern 集合名只允许字母、数字、下划线、连字符和点，最长64个字符
+var collectionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// normalizeCollectionName 去除首尾空白并校验集合名，空名表示不指定集合
+func normalizeCollectionName(collection string) (string, error) {
+	collection = strings.TrimSpace(collection)
+	if collection == "" {
+		return "", nil
+	}
+	if !collectionNamePattern.MatchString(collection) {
+		return "", apperrors.ErrInvalidArgument.WithMessagef("无效的collection: %s，只允许字母、数字、下划线、连字符和点，最长64个字符", collection)
+	}
+	return collection, nil
+}
+
+// normalizeStoreCollection 校验存储请求的集合名并写入metadata随记录持久化，不修改调用方的map
+func normalizeStoreCollection(req *models.StoreContextRequest) error {
+	collection, err := normalizeCollectionName(req.Collection)
+	if err != nil {
+		return err
+	}
+	req.Collection = collection
+	if collection == "" {
+		return nil
+	}
+
+	copied := make(map[string]interface{}, len(req.Metadata)+1)
+	for key, value := range req.Metadata {
+		copied[key] = value
+	}
+	copied[models.MetadataCollectionKey] = collection
+	req.Metadata = copied
+	return nil
+}
+
+// resultCollection 记录所属的集合，未指定集合的记录返回空
+func resultCollection(result models.SearchResult) string {
+	metadata := parseResultMetadata(result)
+	if metadata == nil {
+		return ""
+	}
+	collection, _ := metadata[models.MetadataCollectionKey].(string)
+	return collection
+}
+
+// filterResultsByCollection 只保留属于指定集合的记录，collection为空时原样返回
+func filterResultsByCollection(results []models.SearchResult, collection string) []models.SearchResult {
+	if collection == "" {
+		return results
+	}
+	kept := make([]models.SearchResult, 0, len(results))
+	for _, result := range results {
+		if resultCollection(result) == collection {
+			kept = append(kept, result)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestMemoryCollection 测试存储请求的集合名写入metadata且不修改调用方的map，检索时只保留指定集合的记录
+func TestMemoryCollection(t *testing.T) {
+	original := map[string]interface{}{"type": "decision"}
+	req := models.StoreContextRequest{Content: "部署流程", Metadata: original, Collection: " work "}
+	if err := normalizeStoreCollection(&req); err != nil {
+		t.Fatalf("校验集合名失败: %v", err)
+	}
+	if req.Collection != "work" || req.Metadata[models.MetadataCollectionKey] != "work" || req.Metadata["type"] != "decision" {
+		t.Errorf("集合名应去除空白并写入metadata: %+v", req)
+	}
+	if _, ok := original[models.MetadataCollectionKey]; ok {
+		t.Error("不应修改调用方的metadata")
+	}
+
+	for _, invalid := range []string{"工作", "a b", "x/y"} {
+		if _, err := normalizeCollectionName(invalid); err == nil {
+			t.Errorf("集合名%q应被拒绝", invalid)
+		}
+	}
+
+	results := []models.SearchResult{
+		{ID: "work", Fields: map[string]interface{}{"metadata": `{"collection":"work"}`}},
+		{ID: "personal", Fields: map[string]interface{}{"metadata": map[string]interface{}{"collection": "personal"}}},
+		{ID: "none", Fields: map[string]interface{}{}},
+	}
+	if all := filterResultsByCollection(results, ""); len(all) != 3 {
+		t.Errorf("未指定集合时应返回全部记录: %d", len(all))
+	}
+	if kept := filterResultsByCollection(results, "work"); len(kept) != 1 || kept[0].ID != "work" {
+		t.Errorf("应只保留work集合的记录: %+v", kept)
+	}
+}
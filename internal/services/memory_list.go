@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 记忆列表分页默认值和上限
+const (
+	defaultListMemoriesLimit = 20
+	maxListMemoriesLimit     = 100
+	// maxListMemoriesScan 单次扫描的最大记录数，过滤、排序和分页都在这个范围内进行
+	maxListMemoriesScan = 1000
+	// memoryPreviewLength 内容预览的最大字符数
+	memoryPreviewLength = 200
+)
+
+// ListMemories 按类型、优先级过滤并排序列出会话中已存储的记忆
+// 用户ID从会话中解析，只返回该用户自己的记录
+func (s *ContextService) ListMemories(ctx context.Context, req models.ListMemoriesRequest) (*models.ListMemoriesResponse, error) {
+	if req.SessionID == "" {
+		return nil, fmt.Errorf("会话ID不能为空")
+	}
+	switch req.SortBy {
+	case "", "timestamp", "priority":
+	default:
+		return nil, fmt.Errorf("不支持的排序字段: %s", req.SortBy)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListMemoriesLimit
+	}
+	if limit > maxListMemoriesLimit {
+		limit = maxListMemoriesLimit
+	}
+	offset := req.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	userID, err := s.GetUserIDFromSessionID(req.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户ID失败: %w", err)
+	}
+
+	results, err := s.searchSessionMemories(ctx, req.SessionID, userID, maxListMemoriesScan)
+	if err != nil {
+		return nil, fmt.Errorf("查询会话记忆失败: %w", err)
+	}
+
+	items := make([]models.MemoryListItem, 0, len(results))
+	for _, result := range results {
+		// 部分向量存储不支持按会话过滤，这里再次校验会话和用户
+		if sessionID, _ := result.Fields["session_id"].(string); sessionID != "" && sessionID != req.SessionID {
+			continue
+		}
+		if getResultUserID(result) != userID {
+			continue
+		}
+
+		item := models.MemoryListItem{
+			MemoryID: result.ID,
+			Type:     getResultMemoryType(result),
+			Archived: isArchivedResult(result),
+		}
+		if item.Archived && !req.IncludeArchived {
+			continue
+		}
+		item.Priority, _ = result.Fields["priority"].(string)
+		if req.Type != "" && item.Type != req.Type {
+			continue
+		}
+		if req.Priority != "" && item.Priority != req.Priority {
+			continue
+		}
+
+		content, _ := result.Fields["content"].(string)
+		item.Preview = previewContent(content, memoryPreviewLength)
+		if timestamp, ok := result.Fields["timestamp"].(float64); ok {
+			item.Timestamp = int64(timestamp)
+		}
+		items = append(items, item)
+	}
+
+	sortMemoryListItems(items, req.SortBy)
+
+	response := &models.ListMemoriesResponse{
+		Items:  []models.MemoryListItem{},
+		Total:  len(items),
+		Limit:  limit,
+		Offset: offset,
+	}
+	if offset < len(items) {
+		end := offset + limit
+		if end > len(items) {
+			end = len(items)
+		}
+		response.Items = items[offset:end]
+	}
+
+	log.Printf("📋 [记忆列表] 会话=%s, 类型=%s, 优先级=%s, 排序=%s, 匹配%d条, 返回%d条",
+		req.SessionID, req.Type, req.Priority, req.SortBy, response.Total, len(response.Items))
+	return response, nil
+}
+
+// searchSessionMemories 扫描指定会话和用户的全部记录
+func (s *ContextService) searchSessionMemories(ctx context.Context, sessionID, userID string, limit int) ([]models.SearchResult, error) {
+	filter := "session_id=" + models.QuoteFilterValue(sessionID) + " AND userId=" + models.QuoteFilterValue(userID)
+
+	if s.vectorStore != nil {
+		searchOptions := &models.SearchOptions{
+			Limit:         limit,
+			SessionID:     sessionID,
+			UserID:        userID,
+			SkipThreshold: true,
+		}
+		// Vearch使用JSON过滤条件，会话和用户ID通过SearchOptions传递
+		if s.vectorStore.GetProvider() == models.VectorStoreTypeVearch {
+			filter = "{}"
+		}
+		return s.vectorStore.SearchByFilter(ctx, filter, searchOptions)
+	}
+	if s.vectorService != nil {
+		return s.vectorService.SearchByFilter(filter, limit)
+	}
+
+	return []models.SearchResult{}, nil
+}
+
+// getResultMemoryType 获取记录的记忆类型：优先使用metadata中的type，其次按业务类型和消息角色推断
+func getResultMemoryType(result models.SearchResult) string {
+	if metadata := parseResultMetadata(result); metadata != nil {
+		if memoryType, ok := metadata["type"].(string); ok && memoryType != "" {
+			return memoryType
+		}
+	}
+	if getResultBizType(result) == models.BizTypeTodo {
+		return "todo"
+	}
+	if role, _ := result.Fields["role"].(string); role != "" {
+		return "message"
+	}
+	return "long_term_memory"
+}
+
+// sortMemoryListItems 按时间（新的在前）或优先级（P0在前，同优先级按时间）排序
+func sortMemoryListItems(items []models.MemoryListItem, sortBy string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if sortBy == "priority" && items[i].Priority != items[j].Priority {
+			return priorityRank(items[i].Priority) < priorityRank(items[j].Priority)
+		}
+		return items[i].Timestamp > items[j].Timestamp
+	})
+}
+
+// priorityRank 优先级排序值，未设置的优先级排在最后
+func priorityRank(priority string) int {
+	switch priority {
+	case "P0":
+		return 0
+	case "P1":
+		return 1
+	case "P2":
+		return 2
+	case "P3":
+		return 3
+	default:
+		return 4
+	}
+}
+
+// previewContent 按字符截断内容，避免截断多字节字符
+func previewContent(content string, maxRunes int) string {
+	runes := []rune(content)
+	if len(runes) <= maxRunes {
+		return content
+	}
+	return string(runes[:maxRunes]) + "..."
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestSortMemoryListItems 测试按时间和按优先级排序
+func TestSortMemoryListItems(t *testing.T) {
+	items := []models.MemoryListItem{
+		{MemoryID: "a", Priority: "P2", Timestamp: 300},
+		{MemoryID: "b", Priority: "P1", Timestamp: 100},
+		{MemoryID: "c", Priority: "", Timestamp: 400},
+		{MemoryID: "d", Priority: "P1", Timestamp: 200},
+	}
+
+	sortMemoryListItems(items, "timestamp")
+	if got := memoryListIDs(items); got != "cadb" {
+		t.Errorf("按时间排序错误: %s", got)
+	}
+
+	sortMemoryListItems(items, "priority")
+	if got := memoryListIDs(items); got != "dbac" {
+		t.Errorf("按优先级排序错误: %s", got)
+	}
+}
+
+// TestPreviewContent 测试预览按字符截断，不破坏多字节字符
+func TestPreviewContent(t *testing.T) {
+	if got := previewContent("上下文记忆", 3); got != "上下文..." {
+		t.Errorf("截断结果错误: %s", got)
+	}
+	if got := previewContent("short", 10); got != "short" {
+		t.Errorf("未超长内容不应截断: %s", got)
+	}
+}
+
+func memoryListIDs(items []models.MemoryListItem) string {
+	ids := ""
+	for _, item := range items {
+		ids += item.MemoryID
+	}
+	return ids
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 按metadata键值查询记忆：用户范围编译为向量存储的过滤条件在服务端执行，metadata条件在服务层过滤扫描结果
+//
+// 各后端对metadata过滤的支持：
+//   - 阿里云DashVector、Vearch：metadata以JSON字符串字段存储，服务端只能按userId等顶层字段过滤，
+//     metadata内的键全部后过滤
+//   - Qdrant、内存存储：另以结构化payload（metadata_fields）保存metadata，简单键名上的字符串/bool等值条件
+//     编译为 metadata_fields.<key> 的等值过滤在服务端执行；其余条件（嵌套键、数字、存在性）仍后过滤
+//
+// 单次扫描有上限，记录较多时按timestamp分段从新到旧扫描，找到limit条匹配后停止扫描更早的时间段
+// =============================================================================
+
+// 按metadata查询的返回数量和单次扫描上限
+const (
+	defaultMetadataQueryLimit = 20
+	maxMetadataQueryLimit     = 100
+	metadataQueryScanLimit    = 1000
+)
+
+// metadataFilterKeyPattern 可编译为结构化过滤条件的metadata键
+var metadataFilterKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// QueryByMetadata 按metadata键值和键存在性查询调用方用户的记忆，多个条件同时满足(AND)
+func (s *ContextService) QueryByMetadata(ctx context.Context, req models.QueryByMetadataRequest) (*models.QueryByMetadataResponse, error) {
+	if req.SessionID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("会话ID不能为空")
+	}
+	if err := validateMetadataQuery(req); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.GetUserIDFromSessionID(req.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户ID失败: %w", err)
+	}
+	if userID == "" {
+		return nil, apperrors.ErrUserNotInitialized.WithMessagef("会话中未找到用户ID，拒绝执行查询")
+	}
+	return s.queryByMetadata(ctx, userID, req)
+}
+
+// queryByMetadata 扫描指定用户的记录，返回满足全部metadata条件的记录
+// 找到limit条匹配后不再扫描更早的时间段，此时total只统计已扫描部分并标记truncated
+func (s *ContextService) queryByMetadata(ctx context.Context, userID string, req models.QueryByMetadataRequest) (*models.QueryByMetadataResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultMetadataQueryLimit
+	}
+	if limit > maxMetadataQueryLimit {
+		limit = maxMetadataQueryLimit
+	}
+
+	metadataFilter, compiledKeys := s.compileMetadataFilter(req)
+	response := &models.QueryByMetadataResponse{
+		Memories:     []models.MemoryResult{},
+		ServerFilter: models.FilterAnd(models.FilterEq(models.FilterFieldUserID, userID), metadataFilter).String(),
+		PostFiltered: []string{},
+	}
+	for _, key := range metadataQueryKeys(req) {
+		if !compiledKeys[key] {
+			response.PostFiltered = append(response.PostFiltered, key)
+		}
+	}
+
+	// 先不限时间范围扫描；达到扫描上限时改为按[1, now]的timestamp分段扫描，新的时间段先扫描
+	windows := [][2]int64{{0, 0}}
+	for len(windows) > 0 && len(response.Memories) < limit {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		window := windows[len(windows)-1]
+		windows = windows[:len(windows)-1]
+
+		records, err := s.searchByUserIDFilter(ctx, userID,
+			models.FilterAnd(models.FilterRange(models.FilterFieldTimestamp, window[0], window[1]), metadataFilter), metadataQueryScanLimit)
+		if err != nil {
+			return nil, fmt.Errorf("扫描用户记忆失败: %w", err)
+		}
+		if len(records) >= metadataQueryScanLimit {
+			if window[1] == 0 {
+				windows = append(windows, [2]int64{1, s.now().Unix()})
+				continue
+			}
+			if window[0] < window[1] {
+				mid := window[0] + (window[1]-window[0])/2
+				windows = append(windows, [2]int64{window[0], mid}, [2]int64{mid + 1, window[1]})
+				continue
+			}
+			log.Printf("⚠️ [metadata查询] 用户 %s 在时间戳 %d 上的记录超过%d条，只匹配已扫描到的记录",
+				userID, window[0], metadataQueryScanLimit)
+		}
+
+		response.Scanned += len(records)
+		for _, record := range records {
+			// 部分向量存储不支持按用户过滤，这里再次校验用户
+			if getResultUserID(record) != userID {
+				continue
+			}
+			if isArchivedResult(record) && !req.IncludeArchived {
+				continue
+			}
+			if !matchesMetadataQuery(parseResultMetadata(record), req) {
+				continue
+			}
+			content, _ := record.Fields["content"].(string)
+			response.Memories = append(response.Memories, buildMemoryResult(record, content))
+		}
+	}
+	response.Truncated = len(windows) > 0
+
+	sort.SliceStable(response.Memories, func(i, j int) bool {
+		return response.Memories[i].Timestamp > response.Memories[j].Timestamp
+	})
+	response.Total = len(response.Memories)
+	if len(response.Memories) > limit {
+		response.Memories = response.Memories[:limit]
+	}
+
+	log.Printf("🏷️ [metadata查询] 用户=%s, 条件=%v, 存在=%v, 扫描%d条, 匹配%d条, 返回%d条",
+		userID, req.Metadata, req.Exists, response.Scanned, response.Total, len(response.Memories))
+	return response, nil
+}
+
+// compileMetadataFilter 将metadata等值条件编译为结构化过滤条件，返回过滤条件和已编译的键
+// 只有以结构化payload保存metadata的存储支持；键为简单标识符且值为字符串或bool的条件才编译，
+// 含点号的键可能是完整键名也可能是嵌套访问，数字在各后端的类型不一致，这些条件只做后过滤
+func (s *ContextService) compileMetadataFilter(req models.QueryByMetadataRequest) (models.Filter, map[string]bool) {
+	compiled := make(map[string]bool)
+	structured, ok := s.vectorStore.(models.StructuredMetadataStore)
+	if !ok || !structured.SupportsStructuredMetadata() {
+		return models.Filter{}, compiled
+	}
+
+	var filters []models.Filter
+	for _, key := range metadataQueryKeys(req) {
+		value, ok := req.Metadata[key]
+		if !ok || !metadataFilterKeyPattern.MatchString(key) {
+			continue
+		}
+		switch value.(type) {
+		case string, bool:
+			filters = append(filters, models.FilterEq(models.MetadataPayloadField+"."+key, value))
+			compiled[key] = true
+		}
+	}
+	return models.FilterAnd(filters...), compiled
+}
+
+// validateMetadataQuery 校验查询条件：至少一个条件，键的每一级不能为空，比较值只能是字符串、数字或bool
+func validateMetadataQuery(req models.QueryByMetadataRequest) error {
+	if len(req.Metadata) == 0 && len(req.Exists) == 0 {
+		return apperrors.ErrInvalidArgument.WithMessagef("metadata和exists至少提供一个条件")
+	}
+	for _, key := range metadataQueryKeys(req) {
+		for _, part := range strings.Split(key, ".") {
+			if strings.TrimSpace(part) == "" {
+				return apperrors.ErrInvalidArgument.WithMessagef("无效的metadata键: %q", key)
+			}
+		}
+	}
+	for key, value := range req.Metadata {
+		switch value.(type) {
+		case string, bool, float64, float32, int, int64:
+		default:
+			return apperrors.ErrInvalidArgument.WithMessagef("metadata键%s的值只能是字符串、数字或bool", key)
+		}
+	}
+	return nil
+}
+
+// metadataQueryKeys 查询条件涉及的全部键，按字母顺序排列
+func metadataQueryKeys(req models.QueryByMetadataRequest) []string {
+	keys := make([]string, 0, len(req.Metadata)+len(req.Exists))
+	for key := range req.Metadata {
+		keys = append(keys, key)
+	}
+	keys = append(keys, req.Exists...)
+	sort.Strings(keys)
+	return keys
+}
+
+// matchesMetadataQuery 记录的metadata是否满足全部键值和存在性条件
+func matchesMetadataQuery(metadata map[string]interface{}, req models.QueryByMetadataRequest) bool {
+	for key, expected := range req.Metadata {
+		actual, ok := lookupMetadataValue(metadata, key)
+		if !ok || !metadataValueMatches(actual, expected) {
+			return false
+		}
+	}
+	for _, key := range req.Exists {
+		if value, ok := lookupMetadataValue(metadata, key); !ok || value == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupMetadataValue 查找metadata中的键：优先匹配完整键名，否则按点号逐级访问嵌套字段
+// 以JSON字符串存储的嵌套对象先解析再访问
+func lookupMetadataValue(metadata map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := metadata[key]; ok {
+		return value, true
+	}
+	head, rest, found := strings.Cut(key, ".")
+	if !found {
+		return nil, false
+	}
+	nested, ok := decodeNestedMetadata(metadata[head]).(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookupMetadataValue(nested, rest)
+}
+
+// decodeNestedMetadata 解析以JSON字符串存储的对象或数组，其他值原样返回
+func decodeNestedMetadata(value interface{}) interface{} {
+	text, ok := value.(string)
+	if !ok {
+		return value
+	}
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return value
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+		return value
+	}
+	return decoded
+}
+
+// metadataValueMatches 记录中的值是否等于期望值，值为数组（含JSON字符串形式的数组）时包含期望值即满足
+func metadataValueMatches(actual, expected interface{}) bool {
+	if items, ok := decodeNestedMetadata(actual).([]interface{}); ok {
+		for _, item := range items {
+			if metadataScalarEqual(item, expected) {
+				return true
+			}
+		}
+		return false
+	}
+	return metadataScalarEqual(actual, expected)
+}
+
+// metadataScalarEqual 按JSON编码比较两个值，整数和浮点数形式的相同数值视为相等
+func metadataScalarEqual(a, b interface{}) bool {
+	left, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	right, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(left) == string(right)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// jsonMetadataStore metadata只以JSON字符串保存的向量存储（如阿里云DashVector），全部条件在服务层后过滤
+type jsonMetadataStore struct {
+	*vectorstore.InMemoryVectorStore
+}
+
+func (s *jsonMetadataStore) SupportsStructuredMetadata() bool { return false }
+
+// TestQueryByMetadata 测试多个键值条件同时满足、存在性检查、数组包含、JSON字符串形式的嵌套字段，以及只返回本用户的记录
+func TestQueryByMetadata(t *testing.T) {
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service := &ContextService{}
+	service.SetVectorStore(&jsonMetadataStore{InMemoryVectorStore: vectorStore})
+
+	store := func(id, userID string, timestamp int64, metadata map[string]interface{}) {
+		memory := models.NewMemory("s1", "记忆"+id, "P2", metadata)
+		memory.ID = id
+		memory.UserID = userID
+		memory.Timestamp = timestamp
+		memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+	store("a", "user_a", 100, map[string]interface{}{"team": "infra", "tags": []string{"db", "migration"}, "ticket": 42})
+	store("b", "user_a", 200, map[string]interface{}{"team": "infra", "source": `{"tool":"jira","project":{"key":"OPS"}}`})
+	store("c", "user_a", 300, map[string]interface{}{"team": "web", "tags": `["db"]`})
+	store("d", "user_b", 400, map[string]interface{}{"team": "infra"})
+
+	query := func(req models.QueryByMetadataRequest) []string {
+		t.Helper()
+		response, err := service.queryByMetadata(context.Background(), "user_a", req)
+		if err != nil {
+			t.Fatalf("queryByMetadata failed: %v", err)
+		}
+		var ids []string
+		for _, memory := range response.Memories {
+			ids = append(ids, memory.MemoryID)
+		}
+		return ids
+	}
+	assertIDs := func(name string, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: 期望%v，实际%v", name, want, got)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: 期望%v，实际%v", name, want, got)
+				return
+			}
+		}
+	}
+
+	assertIDs("单个键值，只返回本用户并按时间倒序", query(models.QueryByMetadataRequest{Metadata: map[string]interface{}{"team": "infra"}}), "b", "a")
+	assertIDs("多个键值同时满足", query(models.QueryByMetadataRequest{Metadata: map[string]interface{}{"team": "infra", "ticket": float64(42)}}), "a")
+	assertIDs("数组包含", query(models.QueryByMetadataRequest{Metadata: map[string]interface{}{"tags": "db"}}), "c", "a")
+	assertIDs("JSON字符串中的嵌套字段", query(models.QueryByMetadataRequest{Metadata: map[string]interface{}{"source.project.key": "OPS"}}), "b")
+	assertIDs("存在性检查", query(models.QueryByMetadataRequest{Exists: []string{"tags"}, Metadata: map[string]interface{}{"team": "web"}}), "c")
+	assertIDs("不存在的嵌套键", query(models.QueryByMetadataRequest{Exists: []string{"source.owner"}}))
+
+	response, _ := service.queryByMetadata(context.Background(), "user_a", models.QueryByMetadataRequest{Exists: []string{"team"}, Limit: 1})
+	if response.Total != 3 || len(response.Memories) != 1 || len(response.PostFiltered) != 1 || response.ServerFilter == "" {
+		t.Errorf("应返回匹配总数并按limit截取: %+v", response)
+	}
+
+	if err := validateMetadataQuery(models.QueryByMetadataRequest{}); err == nil {
+		t.Error("没有条件时应报错")
+	}
+	if err := validateMetadataQuery(models.QueryByMetadataRequest{Metadata: map[string]interface{}{"a..b": "x"}}); err == nil {
+		t.Error("键中有空的层级时应报错")
+	}
+	if err := validateMetadataQuery(models.QueryByMetadataRequest{Metadata: map[string]interface{}{"tags": []interface{}{"db"}}}); err == nil {
+		t.Error("比较值不是标量时应报错")
+	}
+}
+
+// TestQueryByMetadataStructuredFilter 测试支持结构化metadata的存储上字符串/bool等值条件在服务端执行，其余条件后过滤
+func TestQueryByMetadataStructuredFilter(t *testing.T) {
+	vectorStore := vectorstore.NewInMemoryVectorStore(8, 0)
+	service := &ContextService{}
+	service.SetVectorStore(vectorStore)
+
+	for i, metadata := range []map[string]interface{}{
+		{"team": "infra", "reviewed": true, "ticket": 42},
+		{"team": "infra", "reviewed": false},
+		{"team": "web", "reviewed": true},
+	} {
+		memory := models.NewMemory("s1", fmt.Sprintf("记忆%d", i), "P2", metadata)
+		memory.ID = fmt.Sprintf("m%d", i)
+		memory.UserID = "user_a"
+		memory.Timestamp = int64(100 + i)
+		memory.Vector = []float32{1, 0, 0, 0, 0, 0, 0, 0}
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+
+	response, err := service.queryByMetadata(context.Background(), "user_a", models.QueryByMetadataRequest{
+		Metadata: map[string]interface{}{"team": "infra", "reviewed": true, "ticket": float64(42)},
+	})
+	if err != nil {
+		t.Fatalf("queryByMetadata failed: %v", err)
+	}
+	if len(response.Memories) != 1 || response.Memories[0].MemoryID != "m0" {
+		t.Errorf("期望只匹配m0: %+v", response.Memories)
+	}
+	if response.Scanned != 1 {
+		t.Errorf("字符串和bool条件应在服务端过滤，实际扫描%d条", response.Scanned)
+	}
+	if !strings.Contains(response.ServerFilter, "metadata_fields.team") || !strings.Contains(response.ServerFilter, "metadata_fields.reviewed") {
+		t.Errorf("服务端过滤条件应包含metadata等值条件: %s", response.ServerFilter)
+	}
+	if len(response.PostFiltered) != 1 || response.PostFiltered[0] != "ticket" {
+		t.Errorf("只有数字条件需要后过滤: %v", response.PostFiltered)
+	}
+}
+
+// TestQueryByMetadataPagesBeyondScanLimit 测试用户记录超过单次扫描上限时按时间分段扫描，
+// 排在扫描上限之后的匹配记录也能找到，找到limit条后停止扫描更早的时间段
+func TestQueryByMetadataPagesBeyondScanLimit(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	vectorStore := vectorstore.NewInMemoryVectorStore(8, 0)
+	service := &ContextService{}
+	service.SetVectorStore(vectorStore)
+	service.SetClock(&fixedClock{now: now})
+
+	add := func(id string, timestamp int64, metadata map[string]interface{}) {
+		memory := models.NewMemory("s1", id, "P2", metadata)
+		memory.ID = id
+		memory.UserID = "user_a"
+		memory.Timestamp = timestamp
+		memory.Vector = []float32{1, 0, 0, 0, 0, 0, 0, 0}
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+	// 数字条件只能后过滤，服务端无法缩小扫描范围
+	for i := 0; i < metadataQueryScanLimit+50; i++ {
+		add(fmt.Sprintf("other-%d", i), now.Add(-time.Duration(i)*time.Minute).Unix(), map[string]interface{}{"ticket": 1})
+	}
+	for i := 0; i < 3; i++ {
+		add(fmt.Sprintf("match-%d", i), now.Add(-time.Duration(10+i)*24*time.Hour).Unix(), map[string]interface{}{"ticket": 42})
+	}
+
+	query := func(limit int) *models.QueryByMetadataResponse {
+		t.Helper()
+		response, err := service.queryByMetadata(context.Background(), "user_a", models.QueryByMetadataRequest{
+			Metadata: map[string]interface{}{"ticket": float64(42)},
+			Limit:    limit,
+		})
+		if err != nil {
+			t.Fatalf("queryByMetadata failed: %v", err)
+		}
+		return response
+	}
+
+	response := query(10)
+	if len(response.Memories) != 3 || response.Total != 3 || response.Truncated {
+		t.Errorf("应找到全部3条匹配记录: %+v", response)
+	}
+	if response.Scanned != metadataQueryScanLimit+53 {
+		t.Errorf("分段扫描应覆盖全部记录，实际扫描%d条", response.Scanned)
+	}
+
+	response = query(1)
+	if len(response.Memories) != 1 || response.Memories[0].MemoryID != "match-0" {
+		t.Errorf("应返回最新的匹配记录: %+v", response.Memories)
+	}
+	if !response.Truncated {
+		t.Errorf("找到limit条后应停止扫描更早的时间段并标记truncated: %+v", response)
+	}
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// memoryReanalyzedAtKey 记忆最近一次重新分析的时间（unix秒），写入metadata
+const memoryReanalyzedAtKey = "reanalyzedAt"
+
+// reanalysisEngines 重新分析时补充写入的存储引擎，按结果输出顺序排列
+var reanalysisEngines = []string{models.StorageEngineTimeline, models.StorageEngineKnowledgeGraph, models.StorageEngineVector}
+
+// contentAnalyzer 对会话中的记忆内容执行存储链路的LLM分析
+type contentAnalyzer func(sessionID, content string) (*models.SmartAnalysisResult, error)
+
+// ReanalyzeMemory 对已存储的记忆重新执行存储链路的LLM分析，把时间线、知识图谱和多向量数据补充写入同一memoryID，不新建记录
+// 已写入过的存储引擎记录在metadata中，重复执行时跳过，不会重复累加知识图谱的概念和关系；只能重新分析自己的记忆
+func (s *ContextService) ReanalyzeMemory(ctx context.Context, req models.ReanalyzeMemoryRequest) (*models.ReanalyzeMemoryResponse, error) {
+	log.Printf("🔁 [重新分析] 开始重新分析: sessionID=%s, memoryID=%s", req.SessionID, req.MemoryID)
+
+	if req.SessionID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("会话ID不能为空")
+	}
+	if req.MemoryID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("memoryId不能为空")
+	}
+
+	userID, err := s.GetUserIDFromSessionID(req.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户ID失败: %w", err)
+	}
+
+	if !s.acquireReanalyze(req.MemoryID) {
+		return nil, apperrors.ErrRequestInProgress.WithMessagef("记忆 %s 正在重新分析，请稍后重试", req.MemoryID)
+	}
+	defer s.releaseReanalyze(req.MemoryID)
+
+	return s.reanalyzeMemory(ctx, userID, req.MemoryID, func(sessionID, content string) (*models.SmartAnalysisResult, error) {
+		return s.analyzeContentWithSmartLLM(s.getBasicContextData(sessionID), content)
+	})
+}
+
+// reanalyzeMemory 分析记忆内容并补充写入尚未写入的存储引擎，最后以原记录ID写回基础记录，记录已写入的存储引擎
+func (s *ContextService) reanalyzeMemory(ctx context.Context, userID, memoryID string, analyze contentAnalyzer) (*models.ReanalyzeMemoryResponse, error) {
+	// 查找原记录（ID检索可能返回相近记录，只保留主键或memory_id完全匹配的）
+	results, err := s.searchByID(ctx, memoryID, "id")
+	if err != nil {
+		return nil, fmt.Errorf("查询待重新分析的记忆失败: %w", err)
+	}
+	var record *models.SearchResult
+	for i := range results {
+		if results[i].ID == memoryID || resultMemoryID(results[i]) == memoryID {
+			record = &results[i]
+			break
+		}
+	}
+	if record == nil {
+		return nil, apperrors.ErrNotFound.WithMessagef("未找到记忆: %s", memoryID)
+	}
+	if ownerID := getResultUserID(*record); ownerID != userID {
+		log.Printf("❌ [重新分析] 用户不匹配: 记录=%s, 记录用户=%s, 请求用户=%s", record.ID, ownerID, userID)
+		return nil, fmt.Errorf("无权重新分析其他用户的记忆: %s", memoryID)
+	}
+
+	metadata := parseResultMetadata(*record)
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	if _, chunked := metadata[chunkMetaIndex]; chunked {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("分块存储的记忆不支持重新分析: %s", memoryID)
+	}
+	if role, _ := record.Fields["role"].(string); role != "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("消息记录不支持重新分析: %s", memoryID)
+	}
+	content, _ := record.Fields["content"].(string)
+	if strings.TrimSpace(content) == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("记忆内容为空: %s", memoryID)
+	}
+
+	sessionID, _ := record.Fields["session_id"].(string)
+	priority, _ := record.Fields["priority"].(string)
+	memoryID = resultMemoryID(*record)
+
+	analysisResult, err := analyze(sessionID, content)
+	if err != nil {
+		return nil, fmt.Errorf("LLM分析失败: %w", err)
+	}
+	if analysisResult == nil || analysisResult.ConfidenceAssessment == nil || analysisResult.StorageRecommendations == nil {
+		return nil, fmt.Errorf("LLM分析结果不完整")
+	}
+
+	populated := reanalyzedStorageEngines(metadata)
+	response := &models.ReanalyzeMemoryResponse{
+		MemoryID:          memoryID,
+		OverallConfidence: analysisResult.ConfidenceAssessment.OverallConfidence,
+		NewlyPopulated:    []string{},
+		AlreadyPopulated:  []string{},
+		Skipped:           make(map[string]string),
+	}
+
+	// 按与智能存储相同的决策确定需要补充的存储引擎，已写入过的引擎不再写入
+	pending := make(map[string]bool)
+	for _, engine := range reanalysisEngines {
+		if populated[engine] {
+			response.AlreadyPopulated = append(response.AlreadyPopulated, engine)
+			continue
+		}
+		if reason := s.reanalysisSkipReason(engine, analysisResult); reason != "" {
+			response.Skipped[engine] = reason
+			continue
+		}
+		pending[engine] = true
+	}
+	if len(pending) == 0 {
+		log.Printf("⏭️ [重新分析] 记忆 %s 没有需要补充的存储引擎，已写入: %v, 跳过: %v",
+			memoryID, response.AlreadyPopulated, response.Skipped)
+		return response, nil
+	}
+
+	storeCtx, cancel := s.smartStorageContext(ctx)
+	defer cancel()
+
+	storeReq := models.StoreContextRequest{
+		SessionID: sessionID,
+		UserID:    userID,
+		Content:   content,
+		Priority:  priority,
+		Metadata:  metadata,
+		BizType:   getResultBizType(*record),
+	}
+	recordResult := func(engine string, err error) {
+		result := models.StorageEngineResult{Engine: engine, Success: err == nil}
+		if err != nil {
+			log.Printf("❌ [重新分析] 记忆 %s 写入%s失败: %v", memoryID, engine, err)
+			result.Error = err.Error()
+		} else {
+			response.NewlyPopulated = append(response.NewlyPopulated, engine)
+		}
+		response.EngineResults = append(response.EngineResults, result)
+	}
+
+	if pending[models.StorageEngineTimeline] {
+		recordResult(models.StorageEngineTimeline, s.storeTimelineDataToTimescaleDB(storeCtx, analysisResult, storeReq, memoryID))
+	}
+	if pending[models.StorageEngineKnowledgeGraph] {
+		recordResult(models.StorageEngineKnowledgeGraph, s.storeKnowledgeDataToNeo4j(storeCtx, analysisResult, storeReq, memoryID))
+	}
+
+	// 多向量数据随基础记录一起写回；此前已有多向量数据的记录写回时同样需要重新生成，否则会丢失
+	memory := reanalyzedMemory(*record, storeReq)
+	vectorAttached := false
+	if pending[models.StorageEngineVector] || populated[models.StorageEngineVector] {
+		_, vectorErr := s.attachMultiVectorData(memory, analysisResult)
+		vectorAttached = vectorErr == nil
+		if pending[models.StorageEngineVector] {
+			recordResult(models.StorageEngineVector, vectorErr)
+		}
+	}
+
+	// 以原记录ID写回基础记录，记录已写入的存储引擎，重复执行时跳过
+	if len(response.NewlyPopulated) > 0 {
+		if !vectorAttached {
+			// 搜索结果不包含向量，没有多向量数据时按内容重新生成主向量
+			for _, key := range []string{"multi_vector", "vector_count", "enabled_dimensions"} {
+				delete(memory.Metadata, key)
+			}
+			if memory.Vector, err = s.generateEmbedding(content); err != nil {
+				return nil, fmt.Errorf("生成向量失败: %w", err)
+			}
+		}
+
+		var engines []string
+		for _, engine := range reanalysisEngines {
+			if populated[engine] && engine != models.StorageEngineVector {
+				engines = append(engines, engine)
+			}
+		}
+		engines = append(engines, response.NewlyPopulated...)
+		if populated[models.StorageEngineVector] && vectorAttached {
+			engines = append(engines, models.StorageEngineVector)
+		}
+		memory.Metadata[models.MetadataStorageEnginesKey] = engines
+		memory.Metadata[memoryReanalyzedAtKey] = s.now().Unix()
+
+		if err := s.rewriteMemoryRecord(storeCtx, *record, memory); err != nil {
+			return nil, fmt.Errorf("写回记忆失败，本次已写入的%v在重新执行时会再次写入: %w", response.NewlyPopulated, err)
+		}
+	}
+
+	// 尝试写入的存储引擎全部失败时返回错误
+	if len(response.NewlyPopulated) == 0 {
+		var storageErrors []string
+		for _, result := range response.EngineResults {
+			storageErrors = append(storageErrors, fmt.Sprintf("%s: %s", result.Engine, result.Error))
+		}
+		return nil, fmt.Errorf("所有存储引擎都失败: %v", storageErrors)
+	}
+
+	log.Printf("✅ [重新分析] 记忆 %s 重新分析完成，新写入: %v, 已写入: %v, 跳过: %v",
+		memoryID, response.NewlyPopulated, response.AlreadyPopulated, response.Skipped)
+	return response, nil
+}
+
+// reanalysisSkipReason 存储引擎本次不写入的原因，需要写入时返回空
+func (s *ContextService) reanalysisSkipReason(engine string, analysisResult *models.SmartAnalysisResult) string {
+	confidence := analysisResult.ConfidenceAssessment.OverallConfidence
+	if threshold := s.getContextOnlyThreshold(); confidence < threshold {
+		return fmt.Sprintf("整体置信度%.2f低于%.2f，仅记录上下文", confidence, threshold)
+	}
+
+	recommendations := analysisResult.StorageRecommendations
+	switch engine {
+	case models.StorageEngineTimeline:
+		timelineStorage := recommendations.TimelineStorage
+		if timelineStorage == nil || !(timelineStorage.ShouldStore || timelineStorage.TimelineTime == "now") {
+			return storageRecommendationReason(timelineStorage)
+		}
+		if !s.storageEngineUsable(engineNameTimescaleDB) {
+			return fmt.Sprintf("TimescaleDB %s", s.engines.get(engineNameTimescaleDB).State)
+		}
+	case models.StorageEngineKnowledgeGraph:
+		if recommendations.KnowledgeGraphStorage == nil || !recommendations.KnowledgeGraphStorage.ShouldStore {
+			return storageRecommendationReason(recommendations.KnowledgeGraphStorage)
+		}
+		if !s.storageEngineUsable(engineNameNeo4j) {
+			return fmt.Sprintf("Neo4j %s", s.engines.get(engineNameNeo4j).State)
+		}
+	case models.StorageEngineVector:
+		if recommendations.VectorStorage == nil || recommendations.VectorStorage.StorageRecommendation == nil {
+			return storageRecommendationReason(nil)
+		}
+		if !recommendations.VectorStorage.ShouldStore {
+			return storageRecommendationReason(recommendations.VectorStorage.StorageRecommendation)
+		}
+	}
+	return ""
+}
+
+// storageRecommendationReason 分析未推荐写入时的原因
+func storageRecommendationReason(recommendation *models.StorageRecommendation) string {
+	if recommendation == nil || recommendation.Reason == "" {
+		return "分析结果未推荐写入"
+	}
+	return recommendation.Reason
+}
+
+// reanalyzedMemory 以原记录的ID、时间戳、业务类型和用户重建记忆对象，向量由调用方设置
+func reanalyzedMemory(record models.SearchResult, req models.StoreContextRequest) *models.Memory {
+	memory := models.NewMemory(req.SessionID, req.Content, req.Priority, req.Metadata)
+	memory.ID = resultMemoryID(record)
+	if timestamp, ok := record.Fields["timestamp"].(float64); ok && timestamp > 0 {
+		memory.Timestamp = int64(timestamp)
+	}
+	memory.BizType = req.BizType
+	memory.UserID = req.UserID
+	return memory
+}
+
+// reanalyzedStorageEngines 记录中已写入补充数据的存储引擎：时间线和知识图谱以metadata中记录的存储引擎为准，
+// 向量以是否带有多向量数据为准（未记录存储引擎的旧记录只有基础向量）
+func reanalyzedStorageEngines(metadata map[string]interface{}) map[string]bool {
+	populated := make(map[string]bool)
+	switch raw := metadata[models.MetadataStorageEnginesKey].(type) {
+	case []string:
+		for _, engine := range raw {
+			populated[engine] = true
+		}
+	case []interface{}:
+		for _, item := range raw {
+			if engine, ok := item.(string); ok {
+				populated[engine] = true
+			}
+		}
+	}
+	multiVector, _ := metadata["multi_vector"].(bool)
+	populated[models.StorageEngineVector] = multiVector
+	return populated
+}
+
+// acquireReanalyze 标记记忆的重新分析开始，已在进行时返回false
+func (s *ContextService) acquireReanalyze(memoryID string) bool {
+	s.reanalyzeMutex.Lock()
+	defer s.reanalyzeMutex.Unlock()
+
+	if s.reanalyzeRunning == nil {
+		s.reanalyzeRunning = make(map[string]bool)
+	}
+	if s.reanalyzeRunning[memoryID] {
+		return false
+	}
+	s.reanalyzeRunning[memoryID] = true
+	return true
+}
+
+// releaseReanalyze 清除记忆的重新分析标记
+func (s *ContextService) releaseReanalyze(memoryID string) {
+	s.reanalyzeMutex.Lock()
+	defer s.reanalyzeMutex.Unlock()
+	delete(s.reanalyzeRunning, memoryID)
+}
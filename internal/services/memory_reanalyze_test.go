@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestReanalyzeMemory 测试重新分析把多向量数据写回原记录而不新建记录，重复执行不再写入，已写入的引擎和其他用户的记忆被跳过
+func TestReanalyzeMemory(t *testing.T) {
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0).EnableMultiVector()
+	service := &ContextService{}
+	service.SetVectorStore(vectorStore)
+	service.SetClock(&fixedClock{now: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)})
+	service.engines.set(engineNameTimescaleDB, models.EngineStateDisabled, "", service.now())
+	service.engines.set(engineNameNeo4j, models.EngineStateAvailable, "", service.now())
+
+	store := func(id, userID string, metadata map[string]interface{}) {
+		memory := models.NewMemory("s1", "订单服务迁移到TimescaleDB后查询延迟下降", "P2", metadata)
+		memory.ID = id
+		memory.UserID = userID
+		memory.Timestamp = 1700000000
+		memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+	store("legacy", "user_a", map[string]interface{}{"context_only": true})
+	store("graphed", "user_a", map[string]interface{}{models.MetadataStorageEnginesKey: []string{models.StorageEngineKnowledgeGraph}})
+	store("other", "user_b", nil)
+
+	analyses := 0
+	analyze := func(sessionID, content string) (*models.SmartAnalysisResult, error) {
+		analyses++
+		return &models.SmartAnalysisResult{
+			IntentAnalysis:       &models.IntentAnalysisResult{CoreIntentText: "数据库迁移", DomainContextText: "时序数据库"},
+			ConfidenceAssessment: &models.ConfidenceAssessment{OverallConfidence: 0.9},
+			StorageRecommendations: &models.StorageRecommendations{
+				TimelineStorage:       &models.StorageRecommendation{ShouldStore: true},
+				KnowledgeGraphStorage: &models.StorageRecommendation{ShouldStore: true},
+				VectorStorage: &models.VectorStorageRecommendation{
+					StorageRecommendation: &models.StorageRecommendation{ShouldStore: true},
+					EnabledDimensions:     []string{"core_intent", "domain_context"},
+				},
+			},
+		}, nil
+	}
+
+	// 知识图谱已写入，时间线引擎未启用，只补充多向量数据
+	response, err := service.reanalyzeMemory(context.Background(), "user_a", "graphed", analyze)
+	if err != nil {
+		t.Fatalf("reanalyzeMemory failed: %v", err)
+	}
+	if len(response.NewlyPopulated) != 1 || response.NewlyPopulated[0] != models.StorageEngineVector {
+		t.Errorf("应只新写入多向量数据: %+v", response)
+	}
+	if len(response.AlreadyPopulated) != 1 || response.AlreadyPopulated[0] != models.StorageEngineKnowledgeGraph || len(response.EngineResults) != 1 {
+		t.Errorf("已写入的知识图谱不应再次写入: %+v", response)
+	}
+	if response.Skipped[models.StorageEngineTimeline] == "" {
+		t.Errorf("未启用的时间线引擎应记录跳过原因: %+v", response.Skipped)
+	}
+
+	if vectorStore.Len() != 3 {
+		t.Fatalf("不应新建记录，实际记录数: %d", vectorStore.Len())
+	}
+	records, _ := vectorStore.SearchByID(context.Background(), "graphed", nil)
+	metadata := parseResultMetadata(records[0])
+	engines := resultStorageEngines(records[0])
+	if len(engines) != 2 || engines[0] != models.StorageEngineKnowledgeGraph || engines[1] != models.StorageEngineVector || metadata["multi_vector"] != true {
+		t.Errorf("应记录已写入的存储引擎和多向量标记: %v, %v", engines, metadata)
+	}
+	if timestamp, _ := records[0].Fields["timestamp"].(float64); int64(timestamp) != 1700000000 {
+		t.Errorf("应保留原记录的时间戳: %v", records[0].Fields["timestamp"])
+	}
+
+	// 重复执行时已写入的引擎全部跳过
+	response, err = service.reanalyzeMemory(context.Background(), "user_a", "graphed", analyze)
+	if err != nil || len(response.NewlyPopulated) != 0 || len(response.AlreadyPopulated) != 2 || len(response.EngineResults) != 0 {
+		t.Errorf("重复执行不应再写入: %+v, %v", response, err)
+	}
+
+	// 旧记录没有记录存储引擎，补充写入多向量数据并保留原有metadata
+	service.engines.set(engineNameNeo4j, models.EngineStateDisabled, "", service.now())
+	response, err = service.reanalyzeMemory(context.Background(), "user_a", "legacy", analyze)
+	if err != nil || len(response.NewlyPopulated) != 1 || len(response.AlreadyPopulated) != 0 {
+		t.Fatalf("旧记录应补充多向量数据: %+v, %v", response, err)
+	}
+	records, _ = vectorStore.SearchByID(context.Background(), "legacy", nil)
+	if metadata := parseResultMetadata(records[0]); metadata["context_only"] != true || metadata[memoryReanalyzedAtKey] == nil {
+		t.Errorf("应保留原有metadata并记录重新分析时间: %v", metadata)
+	}
+
+	if _, err := service.reanalyzeMemory(context.Background(), "user_a", "other", analyze); err == nil {
+		t.Error("不应允许重新分析其他用户的记忆")
+	}
+	if analyses != 3 {
+		t.Errorf("无权访问的记忆不应调用LLM分析，实际调用%d次", analyses)
+	}
+}
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 记忆重建向量的扫描上限和默认批大小
+const (
+	maxReindexScan          = 10000
+	defaultReindexBatchSize = 50
+)
+
+// ErrReindexRunning 该用户已有重建任务在进行
+var ErrReindexRunning = errors.New("该用户的记忆重建任务正在进行")
+
+// ErrNoReindexFailures 该用户没有可重试的失败记录
+var ErrNoReindexFailures = errors.New("该用户没有需要重试的重建失败记录")
+
+// reindexFileNamePattern 进度文件名中不允许出现的字符
+var reindexFileNamePattern = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// StartReindexAllMemories 在后台为用户的全部记忆重新生成向量，已有任务在进行时返回ErrReindexRunning
+func (s *ContextService) StartReindexAllMemories(userID string) error {
+	if userID == "" {
+		return fmt.Errorf("用户ID不能为空")
+	}
+	if !s.acquireReindex(userID) {
+		return ErrReindexRunning
+	}
+
+	go func() {
+		defer s.releaseReindex(userID)
+		if _, err := s.reindexAllMemories(context.Background(), userID); err != nil {
+			log.Printf("❌ [记忆重建] 用户 %s 重建失败: %v", userID, err)
+		}
+	}()
+	return nil
+}
+
+// ReindexAllMemories 用当前embedding模型为用户的全部记忆重新生成向量并写回向量存储
+// 按记录ID升序分批处理，每批完成后保存进度；上次未完成时从保存的游标继续
+func (s *ContextService) ReindexAllMemories(ctx context.Context, userID string) (*models.ReindexState, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	if !s.acquireReindex(userID) {
+		return nil, ErrReindexRunning
+	}
+	defer s.releaseReindex(userID)
+
+	return s.reindexAllMemories(ctx, userID)
+}
+
+// StartRetryFailedReindex 在后台只重试上次重建中失败的记录，不影响游标；没有失败记录时返回ErrNoReindexFailures
+func (s *ContextService) StartRetryFailedReindex(userID string) error {
+	if userID == "" {
+		return fmt.Errorf("用户ID不能为空")
+	}
+	if !s.acquireReindex(userID) {
+		return ErrReindexRunning
+	}
+
+	state, err := s.loadReindexState(userID)
+	if err == nil && (state == nil || len(state.FailedIDs) == 0) {
+		err = ErrNoReindexFailures
+	}
+	if err != nil {
+		s.releaseReindex(userID)
+		return err
+	}
+
+	go func() {
+		defer s.releaseReindex(userID)
+		if _, err := s.retryFailedReindex(context.Background(), state); err != nil {
+			log.Printf("❌ [记忆重建] 用户 %s 重试失败记录出错: %v", userID, err)
+		}
+	}()
+	return nil
+}
+
+// RetryFailedReindex 只重试上次重建中失败的记录，成功的记录从失败列表移除
+func (s *ContextService) RetryFailedReindex(ctx context.Context, userID string) (*models.ReindexState, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	if !s.acquireReindex(userID) {
+		return nil, ErrReindexRunning
+	}
+	defer s.releaseReindex(userID)
+
+	state, err := s.loadReindexState(userID)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil || len(state.FailedIDs) == 0 {
+		return state, ErrNoReindexFailures
+	}
+	return s.retryFailedReindex(ctx, state)
+}
+
+// GetReindexState 获取用户最近一次重建任务的进度，没有记录时返回nil
+func (s *ContextService) GetReindexState(userID string) (*models.ReindexState, error) {
+	state, err := s.loadReindexState(userID)
+	if err != nil || state == nil {
+		return state, err
+	}
+
+	// 进程重启后遗留的running状态实际已中断
+	if state.Status == models.ReindexRunning && !s.isReindexRunning(userID) {
+		state.Status = models.ReindexInterrupted
+	}
+	return state, nil
+}
+
+// ResetReindexState 清除用户的重建进度，下次从头开始
+func (s *ContextService) ResetReindexState(userID string) error {
+	if s.isReindexRunning(userID) {
+		return ErrReindexRunning
+	}
+
+	path := s.reindexStatePath(userID)
+	if path == "" {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除重建进度失败: %w", err)
+	}
+	return nil
+}
+
+// reindexAllMemories 执行重建，调用方需已持有该用户的任务标记
+func (s *ContextService) reindexAllMemories(ctx context.Context, userID string) (*models.ReindexState, error) {
+	state, err := s.loadReindexState(userID)
+	if err != nil {
+		log.Printf("⚠️ [记忆重建] 读取用户 %s 的进度失败，从头开始: %v", userID, err)
+		state = nil
+	}
+	if state == nil || state.Status == models.ReindexCompleted {
+		state = &models.ReindexState{UserID: userID, StartedAt: time.Now()}
+	} else {
+		log.Printf("🔄 [记忆重建] 用户 %s 从游标 %s 继续，已处理 %d 条", userID, state.Cursor, state.Processed)
+	}
+	state.Status = models.ReindexRunning
+	state.Error = ""
+	s.saveReindexState(state)
+
+	records, err := s.searchByUserID(ctx, userID, maxReindexScan)
+	if err != nil {
+		return s.failReindex(state, fmt.Errorf("扫描用户记忆失败: %w", err))
+	}
+
+	// 部分向量存储不支持按用户过滤，这里再次校验用户
+	owned := records[:0]
+	for _, record := range records {
+		if getResultUserID(record) == userID {
+			owned = append(owned, record)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i].ID < owned[j].ID })
+	if len(records) >= maxReindexScan {
+		log.Printf("⚠️ [记忆重建] 用户 %s 的记录数达到扫描上限 %d，超出部分需再次执行", userID, maxReindexScan)
+	}
+
+	// 游标之前的记录已在上次处理
+	start := sort.Search(len(owned), func(i int) bool { return owned[i].ID > state.Cursor })
+	state.Total = len(owned)
+	state.Processed = start
+
+	batchSize := s.reindexBatchSize()
+
+	log.Printf("🚀 [记忆重建] 开始重建用户 %s 的记忆向量，共 %d 条，待处理 %d 条，批大小 %d",
+		userID, state.Total, state.Total-start, batchSize)
+
+	for batchStart := start; batchStart < len(owned); batchStart += batchSize {
+		batchEnd := batchStart + batchSize
+		if batchEnd > len(owned) {
+			batchEnd = len(owned)
+		}
+
+		for _, record := range owned[batchStart:batchEnd] {
+			if err := ctx.Err(); err != nil {
+				state.Status = models.ReindexInterrupted
+				state.Error = err.Error()
+				state.UpdatedAt = time.Now()
+				s.saveReindexState(state)
+				return state, err
+			}
+
+			reindexed, err := s.reindexRecord(ctx, userID, record)
+			switch {
+			case err != nil:
+				log.Printf("⚠️ [记忆重建] 记录 %s 重建失败: %v", record.ID, err)
+				state.Failed++
+				state.FailedIDs = append(state.FailedIDs, record.ID)
+			case reindexed:
+				state.Reindexed++
+			default:
+				state.Skipped++
+			}
+			state.Processed++
+			state.Cursor = record.ID
+		}
+
+		state.UpdatedAt = time.Now()
+		s.saveReindexState(state)
+		log.Printf("📈 [记忆重建] 用户 %s 进度 %d/%d，成功 %d，跳过 %d，失败 %d",
+			userID, state.Processed, state.Total, state.Reindexed, state.Skipped, state.Failed)
+	}
+
+	now := time.Now()
+	state.Status = models.ReindexCompleted
+	state.UpdatedAt = now
+	state.CompletedAt = &now
+	s.saveReindexState(state)
+
+	log.Printf("✅ [记忆重建] 用户 %s 重建完成，成功 %d，跳过 %d，失败 %d",
+		userID, state.Reindexed, state.Skipped, state.Failed)
+	return state, nil
+}
+
+// retryFailedReindex 按失败列表重建记录，调用方需已持有该用户的任务标记
+// 重试期间状态为running，结束后恢复原状态，游标不变，未完成的全量重建仍可从断点继续
+func (s *ContextService) retryFailedReindex(ctx context.Context, state *models.ReindexState) (*models.ReindexState, error) {
+	userID := state.UserID
+	previousStatus := state.Status
+	if previousStatus == models.ReindexRunning {
+		// 持有任务标记时读到的running状态是进程重启前遗留的
+		previousStatus = models.ReindexInterrupted
+	}
+	pending := state.FailedIDs
+
+	state.Status = models.ReindexRunning
+	state.Error = ""
+	s.saveReindexState(state)
+
+	records, err := s.searchByUserID(ctx, userID, maxReindexScan)
+	if err != nil {
+		return s.failReindex(state, fmt.Errorf("扫描用户记忆失败: %w", err))
+	}
+	byID := make(map[string]models.SearchResult, len(pending))
+	for _, record := range records {
+		if getResultUserID(record) == userID {
+			byID[record.ID] = record
+		}
+	}
+
+	batchSize := s.reindexBatchSize()
+	log.Printf("🔁 [记忆重建] 开始重试用户 %s 的 %d 条失败记录", userID, len(pending))
+
+	stillFailed := make([]string, 0, len(pending))
+	for i, id := range pending {
+		if err := ctx.Err(); err != nil {
+			state.FailedIDs = append(stillFailed, pending[i:]...)
+			state.Status = models.ReindexInterrupted
+			state.Error = err.Error()
+			state.UpdatedAt = time.Now()
+			s.saveReindexState(state)
+			return state, err
+		}
+
+		record, ok := byID[id]
+		if !ok {
+			// 记录已被删除，无需再重建
+			log.Printf("ℹ️ [记忆重建] 失败记录 %s 已不存在，跳过", id)
+			state.Failed--
+			state.Skipped++
+		} else if reindexed, err := s.reindexRecord(ctx, userID, record); err != nil {
+			log.Printf("⚠️ [记忆重建] 记录 %s 重试失败: %v", id, err)
+			stillFailed = append(stillFailed, id)
+		} else {
+			state.Failed--
+			if reindexed {
+				state.Reindexed++
+			} else {
+				state.Skipped++
+			}
+		}
+
+		if (i+1)%batchSize == 0 {
+			state.FailedIDs = append(append([]string(nil), stillFailed...), pending[i+1:]...)
+			state.UpdatedAt = time.Now()
+			s.saveReindexState(state)
+		}
+	}
+
+	now := time.Now()
+	state.FailedIDs = stillFailed
+	state.Status = previousStatus
+	state.UpdatedAt = now
+	state.RetriedAt = &now
+	s.saveReindexState(state)
+
+	log.Printf("✅ [记忆重建] 用户 %s 失败记录重试完成，成功 %d 条，仍失败 %d 条",
+		userID, len(pending)-len(stillFailed), len(stillFailed))
+	return state, nil
+}
+
+// reindexBatchSize 每批处理的记录数，每批完成后保存进度
+func (s *ContextService) reindexBatchSize() int {
+	if s.config != nil && s.config.ReindexBatchSize > 0 {
+		return s.config.ReindexBatchSize
+	}
+	return defaultReindexBatchSize
+}
+
+// failReindex 标记重建失败并保存进度
+func (s *ContextService) failReindex(state *models.ReindexState, err error) (*models.ReindexState, error) {
+	state.Status = models.ReindexFailed
+	state.Error = err.Error()
+	state.UpdatedAt = time.Now()
+	s.saveReindexState(state)
+	return state, err
+}
+
+// reindexRecord 为单条记忆重新生成向量并写回，消息记录和空内容记录跳过
+func (s *ContextService) reindexRecord(ctx context.Context, userID string, record models.SearchResult) (bool, error) {
+	if role, _ := record.Fields["role"].(string); role != "" {
+		return false, nil
+	}
+	content, _ := record.Fields["content"].(string)
+	if content == "" {
+		return false, nil
+	}
+
+	metadata := parseResultMetadata(record)
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	priority, _ := record.Fields["priority"].(string)
+
+	// 以原记录ID重建记忆（batchId存储的记录保留原始memory_id）
+	sessionID, _ := record.Fields["session_id"].(string)
+	memory := models.NewMemory(sessionID, content, priority, metadata)
+	memory.ID = record.ID
+	if memoryID, ok := record.Fields["memory_id"].(string); ok && memoryID != "" {
+		memory.ID = memoryID
+	}
+	if timestamp, ok := record.Fields["timestamp"].(float64); ok && timestamp > 0 {
+		memory.Timestamp = int64(timestamp)
+	}
+	memory.BizType = getResultBizType(record)
+	memory.UserID = userID
+
+	// 跳过缓存，确保使用当前模型生成
+	vector, err := s.generateEmbeddingUncached(content)
+	if err != nil {
+		return false, fmt.Errorf("生成向量失败: %w", err)
+	}
+	memory.Vector = vector
+
+	if err := s.rewriteMemoryRecord(ctx, record, memory); err != nil {
+		return false, fmt.Errorf("写回记录失败: %w", err)
+	}
+	return true, nil
+}
+
+// vectorStoreUpserts 当前向量存储写入同ID记录时是否直接覆盖（Qdrant、Vearch和本地内存存储为upsert，阿里云为insert）
+func (s *ContextService) vectorStoreUpserts() bool {
+	if s.vectorStore == nil {
+		return false
+	}
+	switch s.vectorStore.GetProvider() {
+	case models.VectorStoreTypeQdrant, models.VectorStoreTypeVearch, models.VectorStoreTypeLocal:
+		return true
+	}
+	return false
+}
+
+// acquireReindex 标记用户的重建任务开始，已在进行时返回false
+func (s *ContextService) acquireReindex(userID string) bool {
+	s.reindexMutex.Lock()
+	defer s.reindexMutex.Unlock()
+
+	if s.reindexRunning == nil {
+		s.reindexRunning = make(map[string]bool)
+	}
+	if s.reindexRunning[userID] {
+		return false
+	}
+	s.reindexRunning[userID] = true
+	return true
+}
+
+// releaseReindex 清除用户的重建任务标记
+func (s *ContextService) releaseReindex(userID string) {
+	s.reindexMutex.Lock()
+	defer s.reindexMutex.Unlock()
+	delete(s.reindexRunning, userID)
+}
+
+// isReindexRunning 用户的重建任务是否在进行
+func (s *ContextService) isReindexRunning(userID string) bool {
+	s.reindexMutex.Lock()
+	defer s.reindexMutex.Unlock()
+	return s.reindexRunning[userID]
+}
+
+// reindexStatePath 用户重建进度文件路径，未配置存储路径时返回空
+func (s *ContextService) reindexStatePath(userID string) string {
+	if s.config == nil || s.config.StoragePath == "" {
+		return ""
+	}
+	fileName := reindexFileNamePattern.ReplaceAllString(userID, "_") + ".json"
+	return filepath.Join(s.config.StoragePath, "reindex", fileName)
+}
+
+// loadReindexState 读取用户的重建进度，没有记录时返回nil
+func (s *ContextService) loadReindexState(userID string) (*models.ReindexState, error) {
+	path := s.reindexStatePath(userID)
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取重建进度失败: %w", err)
+	}
+
+	var state models.ReindexState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("解析重建进度失败: %w", err)
+	}
+	return &state, nil
+}
+
+// saveReindexState 保存重建进度，先写临时文件再重命名，避免中断时留下不完整的文件
+func (s *ContextService) saveReindexState(state *models.ReindexState) {
+	path := s.reindexStatePath(state.UserID)
+	if path == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Printf("⚠️ [记忆重建] 序列化进度失败: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("⚠️ [记忆重建] 创建进度目录失败: %v", err)
+		return
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		log.Printf("⚠️ [记忆重建] 保存进度失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Printf("⚠️ [记忆重建] 保存进度失败: %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// reindexTestStore 记录写回操作的向量存储，未覆盖的方法不会被调用
+type reindexTestStore struct {
+	models.VectorStore
+	records  []models.SearchResult
+	stored   []*models.Memory
+	failOnID string
+}
+
+func (f *reindexTestStore) GetProvider() models.VectorStoreType { return models.VectorStoreTypeQdrant }
+
+func (f *reindexTestStore) GenerateEmbedding(text string) ([]float32, error) {
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func (f *reindexTestStore) SearchByFilter(ctx context.Context, filter string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	return append([]models.SearchResult(nil), f.records...), nil
+}
+
+func (f *reindexTestStore) StoreMemory(memory *models.Memory) error {
+	if memory.ID == f.failOnID {
+		return errors.New("写入失败")
+	}
+	f.stored = append(f.stored, memory)
+	return nil
+}
+
+// TestReindexAllMemoriesResumesFromCursor 测试分批重建、跳过他人和消息记录，并从保存的游标继续
+func TestReindexAllMemoriesResumesFromCursor(t *testing.T) {
+	store := &reindexTestStore{}
+	for i := 5; i >= 1; i-- {
+		store.records = append(store.records, models.SearchResult{
+			ID: fmt.Sprintf("mem-%d", i),
+			Fields: map[string]interface{}{
+				"content":    fmt.Sprintf("记忆内容%d", i),
+				"userId":     "user_a",
+				"session_id": "session_1",
+				"priority":   "P1",
+				"timestamp":  float64(1700000000 + i),
+				"metadata":   `{"type":"long_term_memory"}`,
+			},
+		})
+	}
+	store.records = append(store.records,
+		models.SearchResult{ID: "mem-0", Fields: map[string]interface{}{"content": "他人的记忆", "userId": "user_b"}},
+		models.SearchResult{ID: "msg-1", Fields: map[string]interface{}{"content": "消息", "userId": "user_a", "role": "user"}},
+	)
+
+	service := &ContextService{
+		vectorStore: store,
+		config:      &config.Config{StoragePath: t.TempDir(), ReindexBatchSize: 2, StoreRetryMaxAttempts: 1},
+	}
+
+	// 模拟上次处理到mem-2时中断
+	service.saveReindexState(&models.ReindexState{
+		UserID:    "user_a",
+		Status:    models.ReindexRunning,
+		Cursor:    "mem-2",
+		Processed: 2,
+		Reindexed: 2,
+	})
+	if state, _ := service.GetReindexState("user_a"); state.Status != models.ReindexInterrupted {
+		t.Errorf("Expected stale running state reported as interrupted, got %s", state.Status)
+	}
+
+	store.failOnID = "mem-4"
+	state, err := service.ReindexAllMemories(context.Background(), "user_a")
+	if err != nil {
+		t.Fatalf("ReindexAllMemories failed: %v", err)
+	}
+
+	if state.Status != models.ReindexCompleted || state.Total != 6 || state.Processed != 6 {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+	if state.Reindexed != 4 || state.Skipped != 1 || state.Failed != 1 || state.FailedIDs[0] != "mem-4" {
+		t.Errorf("Unexpected counters: %+v", state)
+	}
+	if len(store.stored) != 2 || store.stored[0].ID != "mem-3" || store.stored[1].ID != "mem-5" {
+		t.Fatalf("Expected mem-3 and mem-5 to be rewritten, got %+v", store.stored)
+	}
+
+	memory := store.stored[0]
+	if memory.UserID != "user_a" || memory.SessionID != "session_1" || memory.Priority != "P1" ||
+		memory.Timestamp != 1700000003 || memory.Metadata["type"] != "long_term_memory" || len(memory.Vector) != 2 {
+		t.Errorf("Memory fields not preserved: %+v", memory)
+	}
+
+	saved, err := service.GetReindexState("user_a")
+	if err != nil || saved.Status != models.ReindexCompleted || saved.Cursor != "msg-1" {
+		t.Errorf("Expected completed state to be persisted, got %+v, %v", saved, err)
+	}
+
+	// 已完成后再次执行从头开始
+	store.stored = nil
+	store.failOnID = ""
+	if state, err = service.ReindexAllMemories(context.Background(), "user_a"); err != nil || state.Reindexed != 5 {
+		t.Errorf("Expected full rerun to reindex 5 records, got %+v, %v", state, err)
+	}
+}
+
+// TestReindexRejectsConcurrentRun 测试同一用户不能同时运行两个重建任务
+func TestReindexRejectsConcurrentRun(t *testing.T) {
+	service := &ContextService{}
+	if !service.acquireReindex("user_a") {
+		t.Fatal("Expected first acquire to succeed")
+	}
+	if _, err := service.ReindexAllMemories(context.Background(), "user_a"); !errors.Is(err, ErrReindexRunning) {
+		t.Errorf("Expected ErrReindexRunning, got %v", err)
+	}
+	if err := service.ResetReindexState("user_a"); !errors.Is(err, ErrReindexRunning) {
+		t.Errorf("Expected ErrReindexRunning on reset, got %v", err)
+	}
+	service.releaseReindex("user_a")
+	if !service.acquireReindex("user_a") {
+		t.Error("Expected acquire to succeed after release")
+	}
+}
+
+// TestRetryFailedReindex 测试只重试失败列表中的记录，成功的移出列表，已删除的记为跳过，游标和状态保持不变
+func TestRetryFailedReindex(t *testing.T) {
+	store := &reindexTestStore{failOnID: "mem-2"}
+	for i := 1; i <= 3; i++ {
+		store.records = append(store.records, models.SearchResult{
+			ID:     fmt.Sprintf("mem-%d", i),
+			Fields: map[string]interface{}{"content": fmt.Sprintf("记忆内容%d", i), "userId": "user_a"},
+		})
+	}
+	service := &ContextService{
+		vectorStore: store,
+		config:      &config.Config{StoragePath: t.TempDir(), ReindexBatchSize: 1, StoreRetryMaxAttempts: 1},
+	}
+
+	if _, err := service.RetryFailedReindex(context.Background(), "user_a"); !errors.Is(err, ErrNoReindexFailures) {
+		t.Errorf("Expected ErrNoReindexFailures without previous run, got %v", err)
+	}
+
+	service.saveReindexState(&models.ReindexState{
+		UserID:    "user_a",
+		Status:    models.ReindexCompleted,
+		Cursor:    "mem-3",
+		Total:     4,
+		Processed: 4,
+		Reindexed: 1,
+		Failed:    3,
+		FailedIDs: []string{"mem-1", "mem-2", "mem-gone"},
+	})
+
+	state, err := service.RetryFailedReindex(context.Background(), "user_a")
+	if err != nil {
+		t.Fatalf("RetryFailedReindex failed: %v", err)
+	}
+	if len(store.stored) != 1 || store.stored[0].ID != "mem-1" {
+		t.Fatalf("Expected only mem-1 to be rewritten, got %+v", store.stored)
+	}
+	if state.Status != models.ReindexCompleted || state.Cursor != "mem-3" || state.RetriedAt == nil {
+		t.Errorf("Expected status and cursor preserved, got %+v", state)
+	}
+	if state.Reindexed != 2 || state.Skipped != 1 || state.Failed != 1 || len(state.FailedIDs) != 1 || state.FailedIDs[0] != "mem-2" {
+		t.Errorf("Unexpected counters after retry: %+v", state)
+	}
+
+	store.failOnID = ""
+	if state, err = service.RetryFailedReindex(context.Background(), "user_a"); err != nil || state.Failed != 0 || len(state.FailedIDs) != 0 {
+		t.Errorf("Expected second retry to clear failures, got %+v, %v", state, err)
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 按保留策略清理时每个时间段扫描的记录数上限，达到上限的时间段拆分后重新扫描
+const retentionScanLimit = 1000
+
+// parseMemoryRetentionPolicies 解析记忆保留策略，格式 type=期限，逗号分隔
+// 期限支持天数(90d)或Go时长(720h)；infinite或0表示永久保留，不加入策略
+func parseMemoryRetentionPolicies(spec string) (map[string]time.Duration, error) {
+	policies := make(map[string]time.Duration)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("无效的保留策略: %s", item)
+		}
+		memoryType := strings.TrimSpace(parts[0])
+		value := strings.ToLower(strings.TrimSpace(parts[1]))
+		if value == "infinite" {
+			continue
+		}
+
+		var ttl time.Duration
+		if days, ok := strings.CutSuffix(value, "d"); ok {
+			n, err := strconv.Atoi(days)
+			if err != nil {
+				return nil, fmt.Errorf("无效的保留期限: %s", item)
+			}
+			ttl = time.Duration(n) * 24 * time.Hour
+		} else {
+			var err error
+			if ttl, err = time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("无效的保留期限: %s", item)
+			}
+		}
+		if ttl < 0 {
+			return nil, fmt.Errorf("保留期限不能为负数: %s", item)
+		}
+		if ttl > 0 {
+			policies[memoryType] = ttl
+		}
+	}
+	return policies, nil
+}
+
+// memoryRetentionExpired 判断记录是否超过所属类型的保留期限，返回记忆类型
+// 待办只在完成后按completedAt计算，未完成的待办不会过期；没有时间戳的记录不清理
+// 配置了archived策略时，已归档的记忆从archivedAt起算，超期即删除，返回的类型为archived
+func memoryRetentionExpired(result models.SearchResult, policies map[string]time.Duration, now time.Time) (string, bool) {
+	if ttl, ok := policies[archivedRetentionPolicy]; ok && isArchivedResult(result) {
+		archivedAt := metadataInt64(parseResultMetadata(result)[models.MetadataArchivedAtKey])
+		if archivedAt > 0 && now.Sub(time.Unix(archivedAt, 0)) >= ttl {
+			return archivedRetentionPolicy, true
+		}
+	}
+
+	memoryType := getResultMemoryType(result)
+	ttl, ok := policies[memoryType]
+	if !ok {
+		return memoryType, false
+	}
+
+	timestamp := getResultTimestamp(result)
+	if memoryType == "todo" {
+		metadata := parseResultMetadata(result)
+		if metadata == nil || metadata["status"] != "completed" {
+			return memoryType, false
+		}
+		timestamp = metadataInt64(metadata["completedAt"])
+	}
+	if timestamp <= 0 {
+		return memoryType, false
+	}
+	return memoryType, now.Sub(time.Unix(timestamp, 0)) >= ttl
+}
+
+// metadataInt64 读取metadata中的整数值，JSON解析后的数字为float64
+func metadataInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// RunMemoryRetention 按保留策略清理一次所有用户的过期记忆，返回各类型的删除数（演练模式下为将被删除的数量）
+// 向量存储不支持按metadata中的type过滤，按用户扫描候选记录后在本地判断类型和期限
+func (s *ContextService) RunMemoryRetention(ctx context.Context, dryRun bool) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(s.retentionPolicies) == 0 || s.userSessionManager == nil {
+		return counts, nil
+	}
+	if s.vectorStore == nil && s.vectorService == nil {
+		return counts, nil
+	}
+
+	userIDs, err := s.userSessionManager.ListUserIDs()
+	if err != nil {
+		return counts, err
+	}
+
+	now := time.Now()
+	var failed []string
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return counts, ctx.Err()
+		}
+		if err := s.runUserMemoryRetention(ctx, userID, now, dryRun, counts); err != nil {
+			log.Printf("❌ [记忆保留] 清理用户 %s 的过期记忆失败: %v", userID, err)
+			failed = append(failed, userID)
+		}
+	}
+
+	mode := "清理完成"
+	if dryRun {
+		mode = "清理演练完成（未删除数据）"
+	}
+	log.Printf("🗑️ [记忆保留] %s，扫描%d个用户: %s", mode, len(userIDs), formatRetentionCounts(counts))
+	if len(failed) > 0 {
+		return counts, fmt.Errorf("%d个用户的过期记忆清理失败: %v", len(failed), failed)
+	}
+	return counts, nil
+}
+
+// runUserMemoryRetention 按timestamp分段扫描并删除单个用户的过期记忆
+// 只有早于最短保留期限的记录才可能过期（待办的completedAt和归档的archivedAt都不早于timestamp），
+// 扫描到的记录数达到上限时把时间段一分为二分别扫描，确保每段都被完整扫描，不依赖存储返回记录的顺序
+func (s *ContextService) runUserMemoryRetention(ctx context.Context, userID string, now time.Time, dryRun bool, counts map[string]int) error {
+	cutoff := now.Add(-minRetentionTTL(s.retentionPolicies)).Unix()
+	if cutoff <= 0 {
+		return nil
+	}
+
+	windows := [][2]int64{{1, cutoff}}
+	for len(windows) > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		window := windows[len(windows)-1]
+		windows = windows[:len(windows)-1]
+
+		records, err := s.searchByUserIDFilter(ctx, userID,
+			models.FilterRange(models.FilterFieldTimestamp, window[0], window[1]), retentionScanLimit)
+		if err != nil {
+			return fmt.Errorf("扫描向量记录失败: %w", err)
+		}
+		if len(records) >= retentionScanLimit {
+			if window[0] < window[1] {
+				mid := window[0] + (window[1]-window[0])/2
+				windows = append(windows, [2]int64{mid + 1, window[1]}, [2]int64{window[0], mid})
+				continue
+			}
+			log.Printf("⚠️ [记忆保留] 用户 %s 在时间戳 %d 上的记录超过%d条，本次只处理已扫描到的记录",
+				userID, window[0], retentionScanLimit)
+		}
+
+		var ids []string
+		expiredTypes := make(map[string]int)
+		for _, record := range records {
+			if getResultUserID(record) != userID {
+				continue
+			}
+			if memoryType, expired := memoryRetentionExpired(record, s.retentionPolicies, now); expired {
+				ids = append(ids, record.ID)
+				expiredTypes[memoryType]++
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		if !dryRun {
+			if err := s.deleteMemories(ctx, ids); err != nil {
+				return fmt.Errorf("删除过期记忆失败: %w", err)
+			}
+		}
+		for memoryType, n := range expiredTypes {
+			counts[memoryType] += n
+		}
+	}
+	return nil
+}
+
+// minRetentionTTL 所有保留策略中最短的期限
+func minRetentionTTL(policies map[string]time.Duration) time.Duration {
+	var shortest time.Duration
+	for _, ttl := range policies {
+		if shortest == 0 || ttl < shortest {
+			shortest = ttl
+		}
+	}
+	return shortest
+}
+
+// formatRetentionCounts 按类型名排序输出各类型的删除数
+func formatRetentionCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "没有过期记忆"
+	}
+	types := make([]string, 0, len(counts))
+	for memoryType := range counts {
+		types = append(types, memoryType)
+	}
+	sort.Strings(types)
+
+	parts := make([]string, 0, len(types))
+	for _, memoryType := range types {
+		parts = append(parts, fmt.Sprintf("%s=%d", memoryType, counts[memoryType]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+func retentionTestRecord(id, memoryType string, timestamp int64, extra map[string]interface{}) models.SearchResult {
+	metadata := map[string]interface{}{"type": memoryType}
+	for k, v := range extra {
+		metadata[k] = v
+	}
+	data, _ := json.Marshal(metadata)
+	return models.SearchResult{ID: id, Fields: map[string]interface{}{
+		"userId":    "user_a",
+		"timestamp": float64(timestamp),
+		"metadata":  string(data),
+	}}
+}
+
+// TestParseMemoryRetentionPolicies 测试保留策略解析，infinite和0表示永久保留
+func TestParseMemoryRetentionPolicies(t *testing.T) {
+	policies, err := parseMemoryRetentionPolicies("conversation_summary=90d, auto_summary=4320h, long_term_memory=infinite, todo=0")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(policies) != 2 || policies["conversation_summary"] != 90*24*time.Hour || policies["auto_summary"] != 180*24*time.Hour {
+		t.Errorf("Unexpected policies: %v", policies)
+	}
+	for _, spec := range []string{"todo", "todo=abc", "todo=-1d"} {
+		if _, err := parseMemoryRetentionPolicies(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+// TestRunMemoryRetention 测试只删除已启用类型中过期的记忆，待办按完成时间计算，演练模式不删除
+func TestRunMemoryRetention(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-100 * 24 * time.Hour).Unix()
+	recent := now.Add(-time.Hour).Unix()
+	vectorStore := &purgeTestStore{records: []models.SearchResult{
+		retentionTestRecord("summary-old", "conversation_summary", old, nil),
+		retentionTestRecord("summary-new", "conversation_summary", recent, nil),
+		retentionTestRecord("memory-old", "long_term_memory", old, nil),
+		retentionTestRecord("todo-done", "todo", old, map[string]interface{}{"status": "completed", "completedAt": old}),
+		retentionTestRecord("todo-recent", "todo", old, map[string]interface{}{"status": "completed", "completedAt": recent}),
+		retentionTestRecord("todo-open", "todo", old, map[string]interface{}{"status": "pending"}),
+	}}
+	manager := store.NewUserSessionManager(t.TempDir())
+	if _, err := manager.GetUserSessionStore("user_a"); err != nil {
+		t.Fatalf("创建用户会话存储失败: %v", err)
+	}
+	service := &ContextService{
+		vectorStore:        vectorStore,
+		userSessionManager: manager,
+		retentionPolicies:  map[string]time.Duration{"conversation_summary": 90 * 24 * time.Hour, "todo": 30 * 24 * time.Hour},
+	}
+
+	counts, err := service.RunMemoryRetention(context.Background(), true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if counts["conversation_summary"] != 1 || counts["todo"] != 1 || len(vectorStore.deleted) != 0 {
+		t.Errorf("Unexpected dry run result: %v, deleted %v", counts, vectorStore.deleted)
+	}
+
+	counts, err = service.RunMemoryRetention(context.Background(), false)
+	if err != nil {
+		t.Fatalf("retention failed: %v", err)
+	}
+	if counts["conversation_summary"] != 1 || counts["todo"] != 1 || len(vectorStore.records) != 4 {
+		t.Errorf("Unexpected result: %v, remaining %+v", counts, vectorStore.records)
+	}
+	for _, id := range vectorStore.deleted {
+		if id != "summary-old" && id != "todo-done" {
+			t.Errorf("Unexpected deletion: %s", id)
+		}
+	}
+}
+
+// TestRunMemoryRetentionPagesBeyondScanLimit 测试候选记录超过单次扫描上限时分段扫描，排在扫描上限之后的过期记忆也会被清理
+func TestRunMemoryRetentionPagesBeyondScanLimit(t *testing.T) {
+	now := time.Now()
+	vectorStore := vectorstore.NewInMemoryVectorStore(8, 0)
+	add := func(id, memoryType string, timestamp int64) {
+		memory := models.NewMemory("s1", id, "P1", map[string]interface{}{"type": memoryType})
+		memory.ID = id
+		memory.UserID = "user_a"
+		memory.Timestamp = timestamp
+		memory.Vector = make([]float32, 8)
+		memory.Vector[0] = 1
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+	// 先写入超过扫描上限的未启用策略的旧记忆，过期记忆排在其后
+	for i := 0; i < retentionScanLimit+50; i++ {
+		add(fmt.Sprintf("memory-%d", i), "long_term_memory", now.Add(-time.Duration(100+i%50)*24*time.Hour).Unix())
+	}
+	for i := 0; i < 5; i++ {
+		add(fmt.Sprintf("summary-%d", i), "conversation_summary", now.Add(-time.Duration(120+i)*24*time.Hour).Unix())
+	}
+
+	manager := store.NewUserSessionManager(t.TempDir())
+	if _, err := manager.GetUserSessionStore("user_a"); err != nil {
+		t.Fatalf("创建用户会话存储失败: %v", err)
+	}
+	service := &ContextService{
+		vectorStore:        vectorStore,
+		userSessionManager: manager,
+		retentionPolicies:  map[string]time.Duration{"conversation_summary": 90 * 24 * time.Hour},
+	}
+
+	counts, err := service.RunMemoryRetention(context.Background(), true)
+	if err != nil || counts["conversation_summary"] != 5 || vectorStore.Len() != retentionScanLimit+55 {
+		t.Fatalf("演练应统计全部5条过期记忆且不删除: %v, %v, 记录数=%d", counts, err, vectorStore.Len())
+	}
+
+	counts, err = service.RunMemoryRetention(context.Background(), false)
+	if err != nil || counts["conversation_summary"] != 5 || vectorStore.Len() != retentionScanLimit+50 {
+		t.Errorf("应删除全部5条过期记忆: %v, %v, 记录数=%d", counts, err, vectorStore.Len())
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// memoryUpdatedAtKey 记忆最近一次原地更新的时间（unix秒），写入metadata
+const memoryUpdatedAtKey = "updatedAt"
+
+// UpdateMemory 原地更新记忆的内容和metadata，保留原记忆ID
+// 内容变化时重新生成向量，并同步更新同一memoryID下的时间线事件和知识图谱概念；只能更新自己的记忆
+func (s *ContextService) UpdateMemory(ctx context.Context, req models.UpdateMemoryRequest) (*models.UpdateMemoryResponse, error) {
+	log.Printf("✏️ [更新记忆] 开始更新: sessionID=%s, memoryID=%s, 内容长度=%d, metadata字段=%d",
+		req.SessionID, req.MemoryID, len(req.Content), len(req.Metadata))
+
+	if req.MemoryID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("memoryId不能为空")
+	}
+	if req.Content == "" && len(req.Metadata) == 0 {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("content和metadata至少需要提供一个")
+	}
+	if _, ok := req.Metadata[models.MetadataTypeKey]; ok {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("不能修改记忆类型(metadata.%s)", models.MetadataTypeKey)
+	}
+
+	userID, err := s.GetUserIDFromSessionID(req.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户ID失败: %w", err)
+	}
+
+	// 查找原记录（ID检索可能返回相近记录，只保留主键或memory_id完全匹配的）
+	results, err := s.searchByID(ctx, req.MemoryID, "id")
+	if err != nil {
+		return nil, fmt.Errorf("查询待更新记忆失败: %w", err)
+	}
+	var record *models.SearchResult
+	for i := range results {
+		if results[i].ID == req.MemoryID || resultMemoryID(results[i]) == req.MemoryID {
+			record = &results[i]
+			break
+		}
+	}
+	if record == nil {
+		return nil, apperrors.ErrNotFound.WithMessagef("未找到记忆: %s", req.MemoryID)
+	}
+
+	ownerID := getResultUserID(*record)
+	if ownerID != userID {
+		log.Printf("❌ [更新记忆] 用户不匹配: 记录=%s, 记录用户=%s, 请求用户=%s", record.ID, ownerID, userID)
+		return nil, fmt.Errorf("无权更新其他用户的记忆: %s", req.MemoryID)
+	}
+
+	metadata := parseResultMetadata(*record)
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	oldContent, _ := record.Fields["content"].(string)
+	content := oldContent
+	contentChanged := req.Content != "" && req.Content != oldContent
+	if contentChanged {
+		if _, chunked := metadata[chunkMetaIndex]; chunked {
+			return nil, apperrors.ErrInvalidArgument.WithMessagef("分块存储的记忆不支持原地更新内容: %s", req.MemoryID)
+		}
+		content = req.Content
+	}
+
+	for key, value := range req.Metadata {
+		if value == nil {
+			delete(metadata, key)
+		} else {
+			metadata[key] = value
+		}
+	}
+	metadata[memoryUpdatedAtKey] = time.Now().Unix()
+
+	// 以原记录ID重建记忆（batchId存储的记录保留原始memory_id）
+	priority, _ := record.Fields["priority"].(string)
+	sessionID, _ := record.Fields["session_id"].(string)
+	memory := models.NewMemory(sessionID, content, priority, metadata)
+	memory.ID = resultMemoryID(*record)
+	if timestamp, ok := record.Fields["timestamp"].(float64); ok && timestamp > 0 {
+		memory.Timestamp = int64(timestamp)
+	}
+	memory.BizType = getResultBizType(*record)
+	memory.UserID = ownerID
+
+	// 搜索结果不包含向量，即使只更新metadata也需要重新生成向量才能写回
+	vector, err := s.generateEmbedding(content)
+	if err != nil {
+		return nil, fmt.Errorf("生成向量失败: %w", err)
+	}
+	memory.Vector = vector
+
+	if err := s.rewriteMemoryRecord(ctx, *record, memory); err != nil {
+		return nil, fmt.Errorf("写回记忆失败: %w", err)
+	}
+
+	response := &models.UpdateMemoryResponse{ContentChanged: contentChanged}
+	if contentChanged {
+		response.TimelineUpdated, response.ConceptsUpdated = s.updateLinkedMemoryData(ctx, memory.ID, userID, content)
+	}
+
+	updated := *record
+	updated.Fields = make(map[string]interface{}, len(record.Fields))
+	for key, value := range record.Fields {
+		updated.Fields[key] = value
+	}
+	updated.Fields["content"] = content
+	updated.Fields["metadata"] = metadata
+	response.Memory = buildMemoryResult(updated, content)
+
+	log.Printf("✅ [更新记忆] 更新完成: memoryID=%s, 内容变化=%v, 时间线=%d, 概念=%d",
+		req.MemoryID, contentChanged, response.TimelineUpdated, response.ConceptsUpdated)
+	return response, nil
+}
+
+// updateLinkedMemoryData 同步更新同一memoryID下的时间线事件内容，并标记知识图谱中由该记忆产生的概念
+// 时间线和知识图谱只是辅助数据，更新失败只记录日志，不影响向量记录的更新结果
+func (s *ContextService) updateLinkedMemoryData(ctx context.Context, memoryID, userID, content string) (int, int) {
+	timelineUpdated, conceptsUpdated := 0, 0
+
+	if timescaleConfig := s.getTimescaleDBConfig(); timescaleConfig != nil {
+		timelineEngine, err := s.getTimelineEngine(ctx, timescaleConfig)
+		if err != nil {
+			log.Printf("⚠️ [更新记忆] %v，跳过时间线更新", err)
+		} else if updated, err := timelineEngine.UpdateEventContent(ctx, memoryID, userID, content, content); err != nil {
+			log.Printf("⚠️ [更新记忆] 更新时间线事件失败: %v", err)
+		} else {
+			timelineUpdated = int(updated)
+		}
+	}
+
+	if neo4jConfig := s.getNeo4jConfig(); neo4jConfig != nil {
+		knowledgeEngine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
+		if err != nil {
+			log.Printf("⚠️ [更新记忆] %v，跳过知识图谱更新", err)
+		} else if updated, err := knowledgeEngine.MarkMemoryUpdated(ctx, memoryID, userID); err != nil {
+			log.Printf("⚠️ [更新记忆] 更新知识图谱概念失败: %v", err)
+		} else {
+			conceptsUpdated = updated
+		}
+	}
+
+	return timelineUpdated, conceptsUpdated
+}
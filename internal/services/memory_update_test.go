@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestUpdateMemory 测试原地更新内容和metadata后保留原ID、检索立即反映新内容，且不能更新其他用户的记忆
+func TestUpdateMemory(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	for sessionID, userID := range map[string]string{"s1": "user_a", "s2": "user_b"} {
+		session := models.NewSession(sessionID)
+		session.Metadata = map[string]interface{}{"userId": userID}
+		if err := sessionStore.SaveSession(session); err != nil {
+			t.Fatalf("保存会话失败: %v", err)
+		}
+	}
+
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+	memory := models.NewMemory("s1", "登陆超时需要调大连接池", "P1", map[string]interface{}{"type": "long_term_memory", "source": "chat"})
+	memory.ID = "m1"
+	memory.UserID = "user_a"
+	memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+	if err := vectorStore.StoreMemory(memory); err != nil {
+		t.Fatalf("StoreMemory failed: %v", err)
+	}
+
+	resp, err := service.UpdateMemory(context.Background(), models.UpdateMemoryRequest{
+		SessionID: "s1",
+		MemoryID:  "m1",
+		Content:   "登录超时需要调大数据库连接池",
+		Metadata:  map[string]interface{}{"source": nil, "reviewed": true},
+	})
+	if err != nil {
+		t.Fatalf("UpdateMemory failed: %v", err)
+	}
+	if !resp.ContentChanged || resp.Memory.MemoryID != "m1" || resp.Memory.Type != "long_term_memory" {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	if _, ok := resp.Memory.Metadata["source"]; ok || resp.Memory.Metadata["reviewed"] != true {
+		t.Errorf("Expected metadata merged, got %v", resp.Memory.Metadata)
+	}
+
+	if vectorStore.Len() != 1 {
+		t.Errorf("Expected record updated in place, got %d records", vectorStore.Len())
+	}
+	results, err := service.RetrieveContext(context.Background(), models.RetrieveContextRequest{
+		SessionID: "s1", Query: "数据库连接池", Structured: true,
+	})
+	if err != nil {
+		t.Fatalf("RetrieveContext failed: %v", err)
+	}
+	if len(results.Results) != 1 || results.Results[0].Content != "登录超时需要调大数据库连接池" {
+		t.Errorf("Expected search to return updated content, got %+v", results.Results)
+	}
+
+	if _, err := service.UpdateMemory(context.Background(), models.UpdateMemoryRequest{SessionID: "s2", MemoryID: "m1", Content: "篡改"}); err == nil {
+		t.Errorf("Expected error when updating another user's memory")
+	}
+	if _, err := service.UpdateMemory(context.Background(), models.UpdateMemoryRequest{SessionID: "s1", MemoryID: "m1", Metadata: map[string]interface{}{"type": "todo"}}); err == nil {
+		t.Errorf("Expected error when changing memory type")
+	}
+	if _, err := service.UpdateMemory(context.Background(), models.UpdateMemoryRequest{SessionID: "s1", MemoryID: "missing", Content: "x"}); err == nil {
+		t.Errorf("Expected error for missing memory")
+	}
+}
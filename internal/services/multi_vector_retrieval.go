@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 多维度向量检索：主向量 + 核心意图/领域上下文/场景向量融合排序
+// =============================================================================
+
+// multiVectorFields 参与融合的维度及未保存权重时的默认权重，与storeMultiVectorData写入的权重一致
+var multiVectorFields = []struct {
+	name   string
+	weight float64
+}{
+	{models.VectorFieldCoreIntent, 0.5},
+	{models.VectorFieldDomainContext, 0.3},
+	{models.VectorFieldScenario, 0.15},
+}
+
+// multiVectorSearcher 获取已启用多维度向量的存储，不支持时返回nil
+func (s *ContextService) multiVectorSearcher() models.MultiVectorSearcher {
+	if s.vectorStore == nil {
+		return nil
+	}
+	searcher, ok := s.vectorStore.(models.MultiVectorSearcher)
+	if !ok || !searcher.SupportsMultiVector() {
+		return nil
+	}
+	return searcher
+}
+
+// searchByMultiVector 用同一查询向量分别检索主向量和各维度向量，按维度权重融合得分
+// 各路检索均跳过相似度阈值，阈值只作用于融合后的得分，避免某个维度得分偏低的记录在融合前就被淘汰
+func (s *ContextService) searchByMultiVector(ctx context.Context, searcher models.MultiVectorSearcher, queryVector []float32, options map[string]interface{}) ([]models.SearchResult, error) {
+	searchOptions := s.toSearchOptions("", options)
+
+	threshold := 0.0
+	if !searchOptions.SkipThreshold {
+		threshold = searchOptions.Threshold
+		if threshold <= 0 {
+			threshold = searcher.DefaultSimilarityThreshold()
+		}
+	}
+	searchOptions.SkipThreshold = true
+
+	primary, err := s.vectorStore.SearchByVector(ctx, queryVector, searchOptions)
+	if err != nil {
+		return nil, fmt.Errorf("主向量检索失败: %w", err)
+	}
+
+	dimensionResults := make(map[string][]models.SearchResult, len(multiVectorFields))
+	for _, field := range multiVectorFields {
+		results, err := searcher.SearchByVectorField(ctx, field.name, queryVector, searchOptions)
+		if err != nil {
+			log.Printf("⚠️ [多向量检索] 维度 %s 检索失败，跳过该维度: %v", field.name, err)
+			continue
+		}
+		dimensionResults[field.name] = results
+	}
+
+	fused := fuseMultiVectorScores(primary, dimensionResults, threshold)
+	log.Printf("[多向量检索] 融合完成: 主向量候选=%d, 阈值=%.4f, 融合后=%d", len(primary), threshold, len(fused))
+
+	if len(fused) > searchOptions.Limit {
+		fused = fused[:searchOptions.Limit]
+	}
+	return fused, nil
+}
+
+// fuseMultiVectorScores 融合主向量和各维度的检索结果，按融合得分降序排列并过滤阈值
+// 融合得分 = Σ(维度权重×维度得分) / Σ(记录保存的维度权重)，记录保存了但未被某维度召回时该维度按0分计；
+// 未被任何维度召回的记录（如未存储维度向量的普通记忆）保留主向量得分
+func fuseMultiVectorScores(primary []models.SearchResult, dimensionResults map[string][]models.SearchResult, threshold float64) []models.SearchResult {
+	records := make(map[string]models.SearchResult)
+	var order []string
+	for _, result := range primary {
+		if _, exists := records[result.ID]; !exists {
+			records[result.ID] = result
+			order = append(order, result.ID)
+		}
+	}
+
+	dimensionScores := make(map[string]map[string]float64)
+	dimensionFields := make(map[string]map[string]interface{})
+	for _, field := range multiVectorFields {
+		for _, result := range dimensionResults[field.name] {
+			if dimensionScores[result.ID] == nil {
+				dimensionScores[result.ID] = make(map[string]float64)
+				dimensionFields[result.ID] = result.Fields
+			}
+			dimensionScores[result.ID][field.name] = result.Score
+			if _, exists := records[result.ID]; !exists {
+				records[result.ID] = result
+				order = append(order, result.ID)
+			}
+		}
+	}
+
+	fused := make([]models.SearchResult, 0, len(order))
+	for _, id := range order {
+		record := records[id]
+		if scores, ok := dimensionScores[id]; ok {
+			record.Score = weightedDimensionScore(scores, dimensionFields[id])
+		}
+		if threshold > 0 && record.Score < threshold {
+			continue
+		}
+		fused = append(fused, record)
+	}
+
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Score > fused[j].Score
+	})
+	return fused
+}
+
+// weightedDimensionScore 按记录保存的维度计算加权平均得分，fields中有 <维度>_weight 字段表示记录保存了该维度
+func weightedDimensionScore(scores map[string]float64, fields map[string]interface{}) float64 {
+	var weighted, totalWeight float64
+	for _, field := range multiVectorFields {
+		value, stored := fields[field.name+"_weight"]
+		_, matched := scores[field.name]
+		if !stored && !matched {
+			continue
+		}
+
+		weight := field.weight
+		if storedWeight, ok := value.(float64); ok && storedWeight > 0 {
+			weight = storedWeight
+		}
+		weighted += weight * scores[field.name]
+		totalWeight += weight
+	}
+	if totalWeight == 0 {
+		return 0
+	}
+	return weighted / totalWeight
+}
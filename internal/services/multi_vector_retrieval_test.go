@@ -0,0 +1,42 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestFuseMultiVectorScores 测试按记录保存的维度权重融合得分，阈值作用于融合后的得分
+func TestFuseMultiVectorScores(t *testing.T) {
+	weights := map[string]interface{}{"core_intent_weight": 0.5, "domain_context_weight": 0.3, "scenario_weight": 0.15}
+	primary := []models.SearchResult{
+		{ID: "multi", Score: 0.9, Fields: map[string]interface{}{"content": "多向量记忆"}},
+		{ID: "plain", Score: 0.6, Fields: map[string]interface{}{"content": "普通记忆"}},
+	}
+	dimensionResults := map[string][]models.SearchResult{
+		models.VectorFieldCoreIntent: {
+			{ID: "multi", Score: 0.9, Fields: weights},
+			{ID: "intent-only", Score: 0.8, Fields: map[string]interface{}{"content": "仅核心意图", "core_intent_weight": 0.5}},
+		},
+		models.VectorFieldDomainContext: {{ID: "multi", Score: 0.5, Fields: weights}},
+		// multi保存了场景向量但未被场景维度召回，按0分计
+	}
+
+	fused := fuseMultiVectorScores(primary, dimensionResults, 0.5)
+	if len(fused) != 3 || fused[0].ID != "intent-only" || fused[1].ID != "multi" || fused[2].ID != "plain" {
+		t.Fatalf("Unexpected fused order: %+v", fused)
+	}
+
+	wantMulti := (0.5*0.9 + 0.3*0.5) / 0.95
+	if math.Abs(fused[1].Score-wantMulti) > 1e-9 || fused[1].Fields["content"] != "多向量记忆" {
+		t.Errorf("Expected fused score %.4f with primary fields, got %+v", wantMulti, fused[1])
+	}
+	if fused[2].Score != 0.6 {
+		t.Errorf("Records without dimension vectors keep the primary score, got %.4f", fused[2].Score)
+	}
+
+	if fused := fuseMultiVectorScores(primary, dimensionResults, 0.7); len(fused) != 1 || fused[0].ID != "intent-only" {
+		t.Errorf("Expected threshold applied to fused scores, got %+v", fused)
+	}
+}
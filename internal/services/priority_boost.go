@@ -0,0 +1,84 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+const (
+	// defaultPriorityBoostWeight 未配置时优先级得分在混合得分中的权重
+	defaultPriorityBoostWeight = 0.2
+	// maxPriorityBoostWeight 优先级权重上限，保证相似度始终占多数，不会被优先级完全覆盖
+	maxPriorityBoostWeight = 0.5
+)
+
+// priorityImportance 各优先级的重要性得分(0-1)，未知优先级按P2处理
+var priorityImportance = map[string]float64{
+	models.PriorityP0: 1,
+	models.PriorityP1: 2.0 / 3,
+	models.PriorityP2: 1.0 / 3,
+	models.PriorityP3: 0,
+}
+
+// priorityBoostWeight 获取本次检索的优先级权重，请求未指定时使用配置值
+func (s *ContextService) priorityBoostWeight(req models.RetrieveContextRequest) (float64, error) {
+	if req.PriorityWeight < 0 || req.PriorityWeight > maxPriorityBoostWeight {
+		return 0, apperrors.ErrInvalidArgument.WithMessagef("priorityWeight必须在0-%.1f之间: %.4f", maxPriorityBoostWeight, req.PriorityWeight)
+	}
+	if req.PriorityWeight > 0 {
+		return req.PriorityWeight, nil
+	}
+	if s.config != nil && s.config.PriorityBoostWeight > 0 && s.config.PriorityBoostWeight <= maxPriorityBoostWeight {
+		return s.config.PriorityBoostWeight, nil
+	}
+	return defaultPriorityBoostWeight, nil
+}
+
+// resultImportance 记录优先级对应的重要性得分
+func resultImportance(result models.SearchResult) float64 {
+	priority, _ := result.Fields["priority"].(string)
+	if importance, ok := priorityImportance[priority]; ok {
+		return importance
+	}
+	return priorityImportance[models.PriorityP2]
+}
+
+// retrievalBoost 本次检索的加权参数，权重为0表示不启用对应加权，相似度权重为1减去各加权权重之和
+type retrievalBoost struct {
+	priorityWeight float64
+	recencyWeight  float64
+	halfLife       time.Duration // 时间衰减的半衰期，recencyWeight>0时有效
+	now            time.Time     // 计算记忆年龄的当前时间
+}
+
+// rankByBoost 按相似度与优先级、时间衰减的加权得分重新排序，返回每条记录调整后的得分和时间衰减得分
+// 相似度为混合检索得分（启用混合检索时）或归一化的向量得分；加权权重之和不超过0.5，相关性差距较大时仍以相似度为准
+func (s *ContextService) rankByBoost(results []models.SearchResult, hybridScores map[string]models.HybridScore, boost retrievalBoost) ([]models.SearchResult, map[string]float64, map[string]float64) {
+	adjusted := make(map[string]float64, len(results))
+	recency := make(map[string]float64, len(results))
+	for _, result := range results {
+		similarity := result.Score
+		if score, ok := hybridScores[result.ID]; ok {
+			similarity = score.HybridScore
+		}
+		score := (1 - boost.priorityWeight - boost.recencyWeight) * similarity
+		if boost.priorityWeight > 0 {
+			score += boost.priorityWeight * resultImportance(result)
+		}
+		if boost.recencyWeight > 0 {
+			recency[result.ID] = resultRecency(result, boost.now, boost.halfLife)
+			score += boost.recencyWeight * recency[result.ID]
+		}
+		adjusted[result.ID] = score
+	}
+
+	ranked := make([]models.SearchResult, len(results))
+	copy(ranked, results)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return adjusted[ranked[i].ID] > adjusted[ranked[j].ID]
+	})
+	return ranked, adjusted, recency
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestRankByPriority 测试相似度接近时高优先级记忆排在前面，相似度差距较大时仍以相似度为准
+func TestRankByPriority(t *testing.T) {
+	service := &ContextService{config: &config.Config{PriorityBoostWeight: 0.2}}
+	service.SetVectorStore(vectorstore.NewInMemoryVectorStore(64, 0))
+
+	result := func(id, priority string, score float64) models.SearchResult {
+		return models.SearchResult{ID: id, Score: score, Fields: map[string]interface{}{"priority": priority}}
+	}
+	results := []models.SearchResult{
+		result("chatty", models.PriorityP3, 0.82),
+		result("decision", models.PriorityP0, 0.80),
+		result("exact", models.PriorityP3, 0.98),
+		result("unrelated", models.PriorityP0, 0.40),
+	}
+
+	weight, err := service.priorityBoostWeight(models.RetrieveContextRequest{PriorityBoost: true})
+	if err != nil || weight != 0.2 {
+		t.Fatalf("应使用配置的权重0.2: %v, %v", weight, err)
+	}
+	ranked, adjusted, _ := service.rankByBoost(results, nil, retrievalBoost{priorityWeight: weight})
+	var order []string
+	for _, r := range ranked {
+		order = append(order, r.ID)
+	}
+	if order[0] != "decision" || order[1] != "exact" || order[2] != "chatty" || order[3] != "unrelated" {
+		t.Errorf("排序错误: %v, 加权得分: %v", order, adjusted)
+	}
+	if results[0].ID != "chatty" {
+		t.Error("不应修改传入的结果顺序")
+	}
+
+	// 启用混合检索时以混合得分作为相似度
+	hybrid := map[string]models.HybridScore{"chatty": {HybridScore: 0.5}, "decision": {HybridScore: 0.9}}
+	if _, adjusted, _ := service.rankByBoost(results[:2], hybrid, retrievalBoost{priorityWeight: weight}); adjusted["decision"] <= adjusted["chatty"] || adjusted["chatty"] != 0.4 {
+		t.Errorf("应以混合得分计算加权得分: %v", adjusted)
+	}
+
+	if _, err := service.priorityBoostWeight(models.RetrieveContextRequest{PriorityWeight: 0.6}); err == nil {
+		t.Error("权重超过0.5时应返回错误，避免优先级覆盖相似度")
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 存储优先级推断：memorize_context未指定priority时，按智能分析的事件类型和置信度推断优先级
+// 显式传入的priority始终优先；未启用智能分析时按关键词判断事件类型
+// =============================================================================
+
+// priorityLevels 优先级从高到低排列，置信度调整时按相邻级别升降
+var priorityLevels = []string{models.PriorityP0, models.PriorityP1, models.PriorityP2, models.PriorityP3}
+
+// parsePriorityInferenceRules 解析事件类型到优先级的映射，格式为"decision=P1,problem_solve=P1"
+func parsePriorityInferenceRules(spec string) (map[string]string, error) {
+	rules := make(map[string]string)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eventType, priority, found := strings.Cut(item, "=")
+		eventType = strings.ToLower(strings.TrimSpace(eventType))
+		priority = strings.ToUpper(strings.TrimSpace(priority))
+		if !found || eventType == "" {
+			return nil, fmt.Errorf("规则格式错误(应为event_type=优先级): %q", item)
+		}
+		if priorityLevel(priority) < 0 {
+			return nil, fmt.Errorf("事件类型 %s 的优先级无效: %q", eventType, priority)
+		}
+		rules[eventType] = priority
+	}
+	return rules, nil
+}
+
+// priorityLevel 优先级在priorityLevels中的位置，无效优先级返回-1
+func priorityLevel(priority string) int {
+	for i, level := range priorityLevels {
+		if level == priority {
+			return i
+		}
+	}
+	return -1
+}
+
+// shiftPriority 将优先级升高(delta<0)或降低(delta>0)若干级，不超过P0-P3范围
+func shiftPriority(priority string, delta int) string {
+	level := priorityLevel(priority) + delta
+	if level < 0 {
+		level = 0
+	} else if level >= len(priorityLevels) {
+		level = len(priorityLevels) - 1
+	}
+	return priorityLevels[level]
+}
+
+// defaultMemoryPriority 未指定且未推断出优先级时使用的默认优先级
+func (s *ContextService) defaultMemoryPriority() string {
+	if s.config != nil && priorityLevel(s.config.DefaultMemoryPriority) >= 0 {
+		return s.config.DefaultMemoryPriority
+	}
+	return models.PriorityP2
+}
+
+// storeEventType 存储内容的事件类型，优先使用LLM判断的类型，否则按关键词判断
+func storeEventType(req models.StoreContextRequest, analysisResult *models.SmartAnalysisResult) string {
+	if analysisResult != nil && analysisResult.StorageRecommendations != nil &&
+		analysisResult.StorageRecommendations.TimelineStorage != nil {
+		if eventType := analysisResult.StorageRecommendations.TimelineStorage.EventType; eventType != "" {
+			return eventType
+		}
+	}
+	return ClassifyEventType(req.Content, req.Locale)
+}
+
+// inferStorePriority 推断存储优先级并返回推断依据
+// 顺序：显式priority > 事件类型规则 > 置信度达到高阈值时比默认高一级、低于低阈值时比默认低一级 > 默认优先级
+func (s *ContextService) inferStorePriority(req models.StoreContextRequest, analysisResult *models.SmartAnalysisResult) (string, string) {
+	if req.Priority != "" {
+		return req.Priority, "explicit"
+	}
+
+	if eventType := storeEventType(req, analysisResult); eventType != "" {
+		if priority, ok := s.priorityRules[strings.ToLower(eventType)]; ok {
+			return priority, "event_type=" + eventType
+		}
+	}
+
+	defaultPriority := s.defaultMemoryPriority()
+	if analysisResult != nil && analysisResult.ConfidenceAssessment != nil && s.config != nil {
+		confidence := analysisResult.ConfidenceAssessment.OverallConfidence
+		if high := s.config.PriorityHighConfidence; high > 0 && confidence >= high {
+			return shiftPriority(defaultPriority, -1), fmt.Sprintf("confidence=%.2f>=%.2f", confidence, high)
+		}
+		if low := s.config.PriorityLowConfidence; low > 0 && confidence < low {
+			return shiftPriority(defaultPriority, 1), fmt.Sprintf("confidence=%.2f<%.2f", confidence, low)
+		}
+	}
+	return defaultPriority, "default"
+}
+
+// resolveStorePriority 确定本次存储使用的优先级并记录推断依据
+func (s *ContextService) resolveStorePriority(req models.StoreContextRequest, analysisResult *models.SmartAnalysisResult) string {
+	priority, reason := s.inferStorePriority(req, analysisResult)
+	if reason != "explicit" {
+		log.Printf("🏷️ [优先级推断] 会话=%s, 推断优先级=%s, 依据=%s", req.SessionID, priority, reason)
+	}
+	return priority
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestInferStorePriority 测试显式优先级优先，其次按事件类型规则和置信度相对默认优先级升降
+func TestInferStorePriority(t *testing.T) {
+	rules, err := parsePriorityInferenceRules("decision=P1, Problem_Solve=p0")
+	if err != nil {
+		t.Fatalf("解析规则失败: %v", err)
+	}
+	service := &ContextService{
+		config:        &config.Config{DefaultMemoryPriority: "P2", PriorityHighConfidence: 0.9, PriorityLowConfidence: 0.3},
+		priorityRules: rules,
+	}
+	analysis := func(eventType string, confidence float64) *models.SmartAnalysisResult {
+		return &models.SmartAnalysisResult{
+			ConfidenceAssessment:   &models.ConfidenceAssessment{OverallConfidence: confidence},
+			StorageRecommendations: &models.StorageRecommendations{TimelineStorage: &models.StorageRecommendation{EventType: eventType}},
+		}
+	}
+
+	cases := []struct {
+		name     string
+		priority string
+		analysis *models.SmartAnalysisResult
+		want     string
+		reason   string
+	}{
+		{"显式优先级", "P3", analysis("decision", 0.95), "P3", "explicit"},
+		{"决策事件", "", analysis("decision", 0.5), "P1", "event_type=decision"},
+		{"问题解决事件", "", analysis("problem_solve", 0.1), "P0", "event_type=problem_solve"},
+		{"高置信度", "", analysis("discussion", 0.95), "P1", "confidence=0.95>=0.90"},
+		{"低置信度闲聊", "", analysis("", 0.1), "P3", "confidence=0.10<0.30"},
+		{"普通内容", "", analysis("discussion", 0.6), "P2", "default"},
+		{"无分析结果", "", nil, "P2", "default"},
+	}
+	for _, tc := range cases {
+		req := models.StoreContextRequest{SessionID: "s1", Content: "好的", Priority: tc.priority}
+		priority, reason := service.inferStorePriority(req, tc.analysis)
+		if priority != tc.want || reason != tc.reason {
+			t.Errorf("%s: 期望%s(%s)，实际%s(%s)", tc.name, tc.want, tc.reason, priority, reason)
+		}
+	}
+
+	if _, err := parsePriorityInferenceRules("decision=P5"); err == nil {
+		t.Error("无效优先级应返回错误")
+	}
+}
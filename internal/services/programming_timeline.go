@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/timeline"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+const (
+	// programmingTimelineQueryLimit 合并到活动统计的时间线事件数上限
+	programmingTimelineQueryLimit = 200
+	// programmingTimelineResultLimit 编程上下文中返回的时间线事件数上限
+	programmingTimelineResultLimit = 50
+)
+
+// GetProgrammingContextWithOptions 获取编程上下文，请求或配置开启时合并TimescaleDB中的时间线事件
+// TimescaleDB未启用或查询失败时只返回会话内的编辑历史统计
+func (s *ContextService) GetProgrammingContextWithOptions(ctx context.Context, req models.ProgrammingContextRequest) (*models.ProgrammingContext, error) {
+	result, err := s.buildProgrammingContext(ctx, req.SessionID, req.Query)
+	if err != nil {
+		return nil, err
+	}
+	if !req.IncludeTimeline && (s.config == nil || !s.config.ProgrammingContextTimeline) {
+		return result, nil
+	}
+
+	timescaleConfig := s.getTimescaleDBConfig()
+	if timescaleConfig == nil {
+		log.Printf("ℹ️ [编程上下文] TimescaleDB未启用，跳过时间线合并")
+		return result, nil
+	}
+	events, err := s.queryProgrammingTimeline(ctx, timescaleConfig, req.SessionID)
+	if err != nil {
+		log.Printf("⚠️ [编程上下文] %v，跳过时间线合并", err)
+		return result, nil
+	}
+	mergeTimelineActivity(result, events)
+	log.Printf("🕒 [编程上下文] 合并时间线事件%d条，会话: %s", len(events), req.SessionID)
+	return result, nil
+}
+
+// queryProgrammingTimeline 查询会话所属工作空间的时间线事件，无法确定工作空间时只查询当前会话
+func (s *ContextService) queryProgrammingTimeline(ctx context.Context, timescaleConfig *timeline.TimescaleDBConfig, sessionID string) ([]timeline.TimelineEvent, error) {
+	userID, err := s.GetUserIDFromSessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	timelineEngine, err := s.getTimelineEngine(ctx, timescaleConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &timeline.TimelineQuery{
+		UserID:  userID,
+		Limit:   programmingTimelineQueryLimit,
+		OrderBy: "timestamp",
+	}
+	if workspaceName := s.extractWorkspaceName(sessionID); workspaceName != "" {
+		query.WorkspaceID = workspaceName
+	} else {
+		query.SessionID = sessionID
+	}
+	timelineResult, err := timelineEngine.RetrieveEvents(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return timelineResult.Events, nil
+}
+
+// mergeTimelineActivity 将时间线事件计入活动统计并附加到编程上下文，跳过与会话编辑历史ID相同的事件
+func mergeTimelineActivity(result *models.ProgrammingContext, events []timeline.TimelineEvent) {
+	editIDs := make(map[string]bool, len(result.RecentEdits))
+	for _, edit := range result.RecentEdits {
+		if edit.ID != "" {
+			editIDs[edit.ID] = true
+		}
+	}
+
+	for _, event := range events {
+		if editIDs[event.ID] {
+			continue
+		}
+		eventType := event.EventType
+		if eventType == "" {
+			eventType = "unknown"
+		}
+		addActivity(&result.Statistics, event.Timestamp.Unix(), eventType)
+
+		activity := models.TimelineActivity{
+			ID:           event.ID,
+			Timestamp:    event.Timestamp.Unix(),
+			EventType:    eventType,
+			Title:        event.Title,
+			SessionID:    event.SessionID,
+			RelatedFiles: event.RelatedFiles,
+		}
+		if event.Summary != nil {
+			activity.Summary = *event.Summary
+		}
+		result.Timeline = append(result.Timeline, activity)
+	}
+
+	sort.SliceStable(result.Timeline, func(i, j int) bool {
+		return result.Timeline[i].Timestamp > result.Timeline[j].Timestamp
+	})
+	if len(result.Timeline) > programmingTimelineResultLimit {
+		result.Timeline = result.Timeline[:programmingTimelineResultLimit]
+	}
+}
+
+// addActivity 按日期和事件类型累计一次活动
+func addActivity(stats *models.ProgrammingStatistics, timestamp int64, eventType string) {
+	if stats.ActivityByDay == nil {
+		stats.ActivityByDay = make(map[string]int)
+		stats.ActivityByType = make(map[string]int)
+		stats.ActivityByDayType = make(map[string]map[string]int)
+	}
+	day := time.Unix(timestamp, 0).Format("2006-01-02")
+	stats.ActivityByDay[day]++
+	stats.ActivityByType[eventType]++
+	if stats.ActivityByDayType[day] == nil {
+		stats.ActivityByDayType[day] = make(map[string]int)
+	}
+	stats.ActivityByDayType[day][eventType]++
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/timeline"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestMergeTimelineActivity 测试时间线事件按日期和事件类型计入活动统计，并跳过与编辑历史重复的事件
+func TestMergeTimelineActivity(t *testing.T) {
+	day1 := time.Date(2025, 3, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.Add(24 * time.Hour)
+	summary := "发布v1.2"
+
+	result := &models.ProgrammingContext{
+		RecentEdits: []models.EditInfo{{ID: "edit-1", Timestamp: day1.Unix(), FilePath: "main.go"}},
+	}
+	addActivity(&result.Statistics, day1.Unix(), models.ActivityTypeCodeEdit)
+
+	mergeTimelineActivity(result, []timeline.TimelineEvent{
+		{ID: "edit-1", EventType: "code_edit", Timestamp: day1},
+		{ID: "decision-1", EventType: "decision", Timestamp: day1},
+		{ID: "deploy-1", EventType: "deployment", Timestamp: day2, Summary: &summary},
+	})
+
+	stats := result.Statistics
+	if stats.ActivityByDay["2025-03-01"] != 2 || stats.ActivityByDay["2025-03-02"] != 1 {
+		t.Errorf("按日期统计错误: %v", stats.ActivityByDay)
+	}
+	if stats.ActivityByType[models.ActivityTypeCodeEdit] != 1 || stats.ActivityByType["decision"] != 1 || stats.ActivityByType["deployment"] != 1 {
+		t.Errorf("按事件类型统计错误，重复的编辑事件不应计入: %v", stats.ActivityByType)
+	}
+	if stats.ActivityByDayType["2025-03-01"]["decision"] != 1 || stats.ActivityByDayType["2025-03-02"]["deployment"] != 1 {
+		t.Errorf("按日期和事件类型统计错误: %v", stats.ActivityByDayType)
+	}
+	if len(result.Timeline) != 2 || result.Timeline[0].ID != "deploy-1" || result.Timeline[0].Summary != summary {
+		t.Errorf("时间线应按时间倒序且不含重复事件: %+v", result.Timeline)
+	}
+}
+
+// TestFormatProgrammingContextRelevance 测试相关上下文按0-1相似度原样展示相关度
+func TestFormatProgrammingContextRelevance(t *testing.T) {
+	formatted := (&CursorAdapter{}).FormatProgrammingContext(&models.ProgrammingContext{
+		RelatedContexts: []models.ContextReference{{Type: "conversation", Content: "讨论缓存淘汰策略", RelevanceScore: 0.9}},
+	})
+	if !strings.Contains(formatted, "相关度: 0.9000") {
+		t.Errorf("相关度应展示为0.9000:\n%s", formatted)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 就绪探测：检查向量库、Neo4j、TimescaleDB是否可达
+// =============================================================================
+
+const (
+	// readinessProbeTimeout 单个后端探测的超时时间，保证就绪检查接口快速返回
+	readinessProbeTimeout = 3 * time.Second
+	// readinessProbeSessionID 向量库计数探测使用的会话ID，不对应真实数据
+	readinessProbeSessionID = "__readiness_probe__"
+)
+
+// CheckReadiness 并行探测所有后端依赖，未启用的后端标记为disabled
+func (s *ContextService) CheckReadiness(ctx context.Context) []models.BackendStatus {
+	probes := map[string]func(context.Context) error{
+		"vector_store": s.probeVectorStore,
+	}
+
+	// 各引擎分别加载配置，一个引擎配置不完整不影响另一个引擎的探测
+	multiDimEnabled := s.config != nil && s.config.EnableMultiDimensionalStorage
+	if multiDimEnabled {
+		for _, name := range storageEngineNames {
+			if probe, enabled := storageEngineProbe(name); enabled {
+				probes[name] = probe
+			}
+		}
+	}
+
+	names := []string{"vector_store", "neo4j", "timescaledb"}
+	results := make([]models.BackendStatus, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		probe, enabled := probes[name]
+		if !enabled {
+			results[i] = models.BackendStatus{Name: name, Status: models.BackendStatusDisabled}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, name string, probe func(context.Context) error) {
+			defer wg.Done()
+			results[i] = runReadinessProbe(ctx, name, probe)
+		}(i, name, probe)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runReadinessProbe 在超时时间内执行探测；底层调用不支持context时，超时后直接返回，不等待其结束
+func runReadinessProbe(ctx context.Context, name string, probe func(context.Context) error) models.BackendStatus {
+	probeCtx, cancel := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- probe(probeCtx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-probeCtx.Done():
+		err = fmt.Errorf("探测超时(%v)", readinessProbeTimeout)
+	}
+
+	status := models.BackendStatus{
+		Name:      name,
+		Status:    models.BackendStatusOK,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		status.Status = models.BackendStatusError
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// probeVectorStore 对当前向量存储执行一次轻量计数查询
+func (s *ContextService) probeVectorStore(ctx context.Context) error {
+	if s.vectorStore != nil {
+		_, err := s.vectorStore.CountMemories(readinessProbeSessionID)
+		return err
+	}
+	if s.vectorService != nil {
+		_, err := s.vectorService.CountSessionMemories(readinessProbeSessionID)
+		return err
+	}
+	return apperrors.ErrVectorStoreUnconfigured
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestCheckReadiness 测试未配置向量服务时报告错误，未启用多维度存储时图谱和时间线标记为disabled
+func TestCheckReadiness(t *testing.T) {
+	s := &ContextService{config: &config.Config{EnableMultiDimensionalStorage: false}}
+
+	backends := s.CheckReadiness(context.Background())
+	if len(backends) != 3 {
+		t.Fatalf("期望3个后端，实际%d个", len(backends))
+	}
+
+	want := map[string]string{
+		"vector_store": models.BackendStatusError,
+		"neo4j":        models.BackendStatusDisabled,
+		"timescaledb":  models.BackendStatusDisabled,
+	}
+	for _, backend := range backends {
+		if backend.Status != want[backend.Name] {
+			t.Errorf("%s 状态错误: %+v", backend.Name, backend)
+		}
+	}
+}
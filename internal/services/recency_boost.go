@@ -0,0 +1,72 @@
+package services
+
+import (
+	"math"
+	"time"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+const (
+	// defaultRecencyBoostWeight 未配置时时间衰减得分在混合得分中的权重
+	defaultRecencyBoostWeight = 0.2
+	// maxRecencyBoostWeight 时间衰减权重上限，与优先级权重一致
+	maxRecencyBoostWeight = 0.5
+	// defaultRecencyHalfLifeHours 未配置时的半衰期：存储7天后的记忆时间衰减得分为0.5
+	defaultRecencyHalfLifeHours = 168
+	// maxBoostTotalWeight 同时启用优先级和时间衰减加权时两者权重之和的上限，保证相似度始终占多数
+	maxBoostTotalWeight = 0.5
+)
+
+// recencyBoostWeight 获取本次检索的时间衰减权重，请求未指定时使用配置值
+func (s *ContextService) recencyBoostWeight(req models.RetrieveContextRequest) (float64, error) {
+	if req.RecencyWeight < 0 || req.RecencyWeight > maxRecencyBoostWeight {
+		return 0, apperrors.ErrInvalidArgument.WithMessagef("recencyWeight必须在0-%.1f之间: %.4f", maxRecencyBoostWeight, req.RecencyWeight)
+	}
+	if req.RecencyWeight > 0 {
+		return req.RecencyWeight, nil
+	}
+	if s.config != nil && s.config.RecencyBoostWeight > 0 && s.config.RecencyBoostWeight <= maxRecencyBoostWeight {
+		return s.config.RecencyBoostWeight, nil
+	}
+	return defaultRecencyBoostWeight, nil
+}
+
+// recencyHalfLife 获取本次检索的时间衰减半衰期，请求未指定时使用配置值
+func (s *ContextService) recencyHalfLife(req models.RetrieveContextRequest) (time.Duration, error) {
+	if req.RecencyHalfLife < 0 {
+		return 0, apperrors.ErrInvalidArgument.WithMessagef("recencyHalfLife不能为负数: %.2f", req.RecencyHalfLife)
+	}
+	hours := float64(defaultRecencyHalfLifeHours)
+	if req.RecencyHalfLife > 0 {
+		hours = req.RecencyHalfLife
+	} else if s.config != nil && s.config.RecencyHalfLife > 0 {
+		hours = s.config.RecencyHalfLife
+	}
+	return time.Duration(hours * float64(time.Hour)), nil
+}
+
+// capBoostWeights 两种加权权重之和超过上限时按比例缩小，避免相似度权重被压到一半以下
+func capBoostWeights(priorityWeight, recencyWeight float64) (float64, float64) {
+	total := priorityWeight + recencyWeight
+	if total <= maxBoostTotalWeight {
+		return priorityWeight, recencyWeight
+	}
+	scale := maxBoostTotalWeight / total
+	return priorityWeight * scale, recencyWeight * scale
+}
+
+// resultRecency 记录的时间衰减得分(0-1]：按存储时间指数衰减，每经过一个半衰期减半
+// 缺少时间戳的记录得分为0，时间戳晚于当前时间的按刚存储处理
+func resultRecency(result models.SearchResult, now time.Time, halfLife time.Duration) float64 {
+	timestamp := getResultTimestamp(result)
+	if timestamp <= 0 || halfLife <= 0 {
+		return 0
+	}
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age < 0 {
+		age = 0
+	}
+	return math.Exp(-math.Ln2 * age.Hours() / halfLife.Hours())
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestRankByRecency 测试时间衰减按半衰期减半、新近记忆靠前，并可与优先级加权组合
+func TestRankByRecency(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := &ContextService{config: &config.Config{RecencyBoostWeight: 0.2, RecencyHalfLife: 24}}
+	service.SetClock(&fixedClock{now: now})
+
+	result := func(id, priority string, score float64, age time.Duration) models.SearchResult {
+		return models.SearchResult{ID: id, Score: score, Fields: map[string]interface{}{
+			"priority":  priority,
+			"timestamp": now.Add(-age).Unix(),
+		}}
+	}
+	results := []models.SearchResult{
+		result("stale", models.PriorityP2, 0.82, 30*24*time.Hour),
+		result("fresh", models.PriorityP2, 0.80, time.Hour),
+		result("exact", models.PriorityP2, 0.98, 60*24*time.Hour),
+	}
+
+	weight, err := service.recencyBoostWeight(models.RetrieveContextRequest{RecencyBoost: true})
+	if err != nil || weight != 0.2 {
+		t.Fatalf("应使用配置的权重0.2: %v, %v", weight, err)
+	}
+	halfLife, err := service.recencyHalfLife(models.RetrieveContextRequest{RecencyBoost: true})
+	if err != nil || halfLife != 24*time.Hour {
+		t.Fatalf("应使用配置的半衰期24小时: %v, %v", halfLife, err)
+	}
+
+	boost := retrievalBoost{recencyWeight: weight, halfLife: halfLife, now: service.now()}
+	ranked, adjusted, recency := service.rankByBoost(results, nil, boost)
+	if ranked[0].ID != "fresh" || ranked[1].ID != "exact" || ranked[2].ID != "stale" {
+		t.Errorf("排序错误: %v, 加权得分: %v", []string{ranked[0].ID, ranked[1].ID, ranked[2].ID}, adjusted)
+	}
+	if got := resultRecency(result("day", models.PriorityP2, 0, 24*time.Hour), now, halfLife); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("经过一个半衰期时间衰减得分应为0.5: %v", got)
+	}
+	if recency["fresh"] <= recency["stale"] {
+		t.Errorf("新近记忆的时间衰减得分应更高: %v", recency)
+	}
+	if got := resultRecency(models.SearchResult{ID: "unknown"}, now, halfLife); got != 0 {
+		t.Errorf("缺少时间戳的记录时间衰减得分应为0: %v", got)
+	}
+
+	// 同时启用优先级加权时权重之和超过上限按比例缩小
+	priorityWeight, recencyWeight := capBoostWeights(0.4, 0.4)
+	if math.Abs(priorityWeight+recencyWeight-maxBoostTotalWeight) > 1e-9 || priorityWeight != recencyWeight {
+		t.Errorf("权重之和应缩小到%.1f: %v, %v", maxBoostTotalWeight, priorityWeight, recencyWeight)
+	}
+	boost.priorityWeight, boost.recencyWeight = priorityWeight, recencyWeight
+	results[0].Fields["priority"] = models.PriorityP0
+	_, adjusted, recency = service.rankByBoost(results, nil, boost)
+	if want := 0.5*0.82 + 0.25*1 + 0.25*recency["stale"]; math.Abs(adjusted["stale"]-want) > 1e-9 {
+		t.Errorf("加权得分应为相似度、优先级和时间衰减的加权和: %v, 期望%v", adjusted["stale"], want)
+	}
+
+	if _, err := service.recencyHalfLife(models.RetrieveContextRequest{RecencyHalfLife: -1}); err == nil {
+		t.Error("半衰期为负数时应返回错误")
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/contextkeeper/service/internal/llm"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// LLM重排序：对检索结果按查询意图重新打分排序
+// =============================================================================
+
+const (
+	// maxRerankCandidates 参与重排序的最大候选数，控制LLM调用成本
+	maxRerankCandidates = 20
+	// maxRerankSnippetRunes 每条候选发送给LLM的最大字符数
+	maxRerankSnippetRunes = 500
+)
+
+// rerankLLMResponse LLM重排序响应
+type rerankLLMResponse struct {
+	Scores []struct {
+		Index int     `json:"index"`
+		Score float64 `json:"score"`
+	} `json:"scores"`
+}
+
+// rerankSearchResults 将查询和前N条候选发送给LLM打分，按得分重排前N条，其余结果保持原顺序
+func (s *ContextService) rerankSearchResults(ctx context.Context, query string, results []models.SearchResult) ([]models.SearchResult, map[string]models.RerankScore, error) {
+	if len(results) == 0 {
+		return results, nil, nil
+	}
+
+	llmProvider := s.config.MultiDimLLMProvider
+	llmModel := s.config.MultiDimLLMModel
+	if llmProvider == "" {
+		return nil, nil, fmt.Errorf("LLM提供商未配置")
+	}
+
+	llmClient, err := s.createStandardLLMClient(llmProvider, llmModel)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建LLM客户端失败: %w", err)
+	}
+
+	candidateCount := len(results)
+	if candidateCount > maxRerankCandidates {
+		candidateCount = maxRerankCandidates
+	}
+	candidates := results[:candidateCount]
+
+	llmRequest := &llm.LLMRequest{
+		Prompt:      buildRerankPrompt(query, candidates),
+		MaxTokens:   1000,
+		Temperature: 0,
+		Format:      "json",
+		Model:       llmModel,
+		Metadata: map[string]interface{}{
+			"task":       "context_rerank",
+			"candidates": candidateCount,
+		},
+	}
+
+	llmCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	log.Printf("🚀 [检索重排] 调用LLM重排序，提供商: %s，模型: %s，候选数: %d", llmProvider, llmModel, candidateCount)
+	llmResponse, err := llmClient.Complete(llmCtx, llmRequest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("LLM API调用失败: %w", err)
+	}
+	s.recordLLMUsage(llmRequest, llmResponse)
+
+	scores, err := parseRerankResponse(s.cleanLLMResponse(llmResponse.Content), candidateCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reranked, rerankScores := applyRerankScores(candidates, scores)
+	reranked = append(reranked, results[candidateCount:]...)
+
+	log.Printf("✅ [检索重排] 重排序完成，Token使用: %d", llmResponse.TokensUsed)
+	return reranked, rerankScores, nil
+}
+
+// buildRerankPrompt 构建重排序提示词
+func buildRerankPrompt(query string, candidates []models.SearchResult) string {
+	var snippets strings.Builder
+	for i, result := range candidates {
+		content, _ := result.Fields["content"].(string)
+		if runes := []rune(content); len(runes) > maxRerankSnippetRunes {
+			content = string(runes[:maxRerankSnippetRunes]) + "..."
+		}
+		snippets.WriteString(fmt.Sprintf("[%d] %s\n", i, strings.ReplaceAll(content, "\n", " ")))
+	}
+
+	return fmt.Sprintf(`你是检索结果相关性评估专家。请根据用户查询的真实意图，为每条候选内容打分。
+
+用户查询：%s
+
+候选内容：
+%s
+评分标准：0表示完全无关，1表示完全满足查询意图，可使用两位小数。
+请只输出JSON，不要添加额外说明，格式如下：
+{"scores": [{"index": 0, "score": 0.85}, {"index": 1, "score": 0.2}]}`, query, snippets.String())
+}
+
+// parseRerankResponse 解析LLM重排序响应，返回每个候选序号的得分，未返回的候选记为0分
+func parseRerankResponse(content string, candidateCount int) ([]float64, error) {
+	jsonText, ok := extractFirstJSONObject(content)
+	if !ok {
+		return nil, fmt.Errorf("重排序响应中未找到JSON对象")
+	}
+
+	var response rerankLLMResponse
+	if err := json.Unmarshal([]byte(jsonText), &response); err != nil {
+		return nil, fmt.Errorf("解析重排序响应失败: %w", err)
+	}
+	if len(response.Scores) == 0 {
+		return nil, fmt.Errorf("重排序响应缺少scores字段")
+	}
+
+	scores := make([]float64, candidateCount)
+	for _, item := range response.Scores {
+		if item.Index < 0 || item.Index >= candidateCount {
+			continue
+		}
+		score := item.Score
+		if score < 0 {
+			score = 0
+		} else if score > 1 {
+			score = 1
+		}
+		scores[item.Index] = score
+	}
+	return scores, nil
+}
+
+// applyRerankScores 按得分从高到低重排候选，得分相同时保持原顺序
+func applyRerankScores(candidates []models.SearchResult, scores []float64) ([]models.SearchResult, map[string]models.RerankScore) {
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	reranked := make([]models.SearchResult, 0, len(candidates))
+	rerankScores := make(map[string]models.RerankScore, len(candidates))
+	for _, index := range order {
+		result := candidates[index]
+		reranked = append(reranked, result)
+		rerankScores[result.ID] = models.RerankScore{
+			ID:           result.ID,
+			Score:        scores[index],
+			OriginalRank: index + 1,
+		}
+	}
+	return reranked, rerankScores
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestParseRerankResponse 测试解析重排序响应：越界序号忽略，得分截断到0-1，缺失记为0
+func TestParseRerankResponse(t *testing.T) {
+	content := "以下是评分结果：\n" + `{"scores": [{"index": 0, "score": 0.3}, {"index": 2, "score": 1.4}, {"index": 5, "score": 0.9}]}`
+	scores, err := parseRerankResponse(content, 3)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if scores[0] != 0.3 || scores[1] != 0 || scores[2] != 1 {
+		t.Errorf("得分解析错误: %v", scores)
+	}
+
+	for _, invalid := range []string{"无法评分", `{"result": []}`} {
+		if _, err := parseRerankResponse(invalid, 3); err == nil {
+			t.Errorf("期望解析失败: %s", invalid)
+		}
+	}
+}
+
+// TestApplyRerankScores 测试按得分重排并记录原始位置
+func TestApplyRerankScores(t *testing.T) {
+	candidates := []models.SearchResult{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	reranked, scores := applyRerankScores(candidates, []float64{0.2, 0.9, 0.2})
+
+	var order []string
+	for _, result := range reranked {
+		order = append(order, result.ID)
+	}
+	if len(order) != 3 || order[0] != "b" || order[1] != "a" || order[2] != "c" {
+		t.Errorf("重排顺序错误: %v", order)
+	}
+	if scores["b"].OriginalRank != 2 || scores["b"].Score != 0.9 {
+		t.Errorf("得分明细错误: %+v", scores["b"])
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 检索诊断中命中的过滤条件
+const (
+	explainFilterUserID    = "userId"
+	explainFilterSession   = "session"
+	explainFilterWorkspace = "workspace"
+	explainFilterTimeRange = "timeRange"
+)
+
+// retrievalExplainer 收集一次检索的诊断信息，只在请求explain=true时创建
+// 方法对nil接收者是空操作，检索流程中无需判断是否开启；诊断结果只保留当前会话用户的记录
+type retrievalExplainer struct {
+	explain    models.RetrievalExplain
+	userID     string
+	sessionID  string
+	workspace  string
+	startTime  int64
+	endTime    int64
+	records    map[string]models.SearchResult
+	candidates map[string]*models.ExplainCandidate
+	order      []string
+
+	lookupWorkspace   func(sessionID string) string
+	sessionWorkspaces map[string]string
+}
+
+// newRetrievalExplainer 为检索请求创建诊断收集器，未开启explain时返回nil
+// 用户按请求会话确定，无法确定时诊断结果不包含任何候选
+func (s *ContextService) newRetrievalExplainer(req models.RetrieveContextRequest) *retrievalExplainer {
+	if !req.Explain {
+		return nil
+	}
+	userID, err := s.GetUserIDFromSessionID(req.SessionID)
+	if err != nil {
+		log.Printf("⚠️ [检索诊断] 获取会话用户失败，诊断结果不包含候选: %v", err)
+	}
+	return &retrievalExplainer{
+		explain: models.RetrievalExplain{
+			Mode:          models.ExplainModeSession,
+			Threshold:     req.Threshold,
+			SkipThreshold: req.SkipThreshold,
+		},
+		userID:     userID,
+		sessionID:  req.SessionID,
+		workspace:  s.sessionWorkspacePath(req.SessionID),
+		startTime:  req.StartTime,
+		endTime:    req.EndTime,
+		records:    make(map[string]models.SearchResult),
+		candidates: make(map[string]*models.ExplainCandidate),
+
+		lookupWorkspace:   s.sessionWorkspacePath,
+		sessionWorkspaces: make(map[string]string),
+	}
+}
+
+// setMode 记录检索方式
+func (e *retrievalExplainer) setMode(mode string) {
+	if e == nil {
+		return
+	}
+	e.explain.Mode = mode
+}
+
+// setFilter 记录向量检索最终使用的过滤条件，时间范围以timestamp条件追加
+func (e *retrievalExplainer) setFilter(filter string) {
+	if e == nil {
+		return
+	}
+	clauses := []string{}
+	if filter != "" {
+		clauses = append(clauses, filter)
+	}
+	if e.startTime > 0 {
+		clauses = append(clauses, fmt.Sprintf("timestamp>=%d", e.startTime))
+	}
+	if e.endTime > 0 {
+		clauses = append(clauses, fmt.Sprintf("timestamp<=%d", e.endTime))
+	}
+	e.explain.Filter = strings.Join(clauses, " AND ")
+}
+
+// recordVectorCandidates 记录向量检索的候选：all为跳过阈值的检索结果，passed为正常检索（应用阈值）的结果
+// passed为nil表示本次检索未应用阈值，所有候选都视为通过
+func (e *retrievalExplainer) recordVectorCandidates(all, passed []models.SearchResult) {
+	if e == nil {
+		return
+	}
+	var passedIDs map[string]bool
+	if passed != nil {
+		passedIDs = make(map[string]bool, len(passed))
+		for _, result := range passed {
+			passedIDs[result.ID] = true
+		}
+	}
+	for _, result := range all {
+		candidate := e.add(result, models.RetrievalSourceVector)
+		candidate.PassedThreshold = passedIDs == nil || passedIDs[result.ID]
+	}
+}
+
+// recordRanking 记录候选在重排序前(before=true)或重排序后的排名，此前未出现的结果按defaultSource记录来源
+func (e *retrievalExplainer) recordRanking(results []models.SearchResult, before bool) {
+	if e == nil {
+		return
+	}
+	for i, result := range results {
+		candidate := e.add(result, e.defaultSource())
+		if before {
+			candidate.RankBefore = i + 1
+		} else {
+			candidate.RankAfter = i + 1
+		}
+	}
+}
+
+// recordBoost 记录按优先级和时间衰减加权后的得分及各加权分量，原始得分保留在Score中
+func (e *retrievalExplainer) recordBoost(results []models.SearchResult, boost retrievalBoost, adjusted, recency map[string]float64) {
+	if e == nil {
+		return
+	}
+	for _, result := range results {
+		candidate := e.add(result, e.defaultSource())
+		if boost.priorityWeight > 0 {
+			candidate.Priority, _ = result.Fields["priority"].(string)
+		}
+		if boost.recencyWeight > 0 {
+			candidate.RecencyScore = recency[result.ID]
+		}
+		candidate.AdjustedScore = adjusted[result.ID]
+	}
+}
+
+// recordFinal 记录最终返回结果中的位置，图谱扩展追加的记忆在此时加入
+func (e *retrievalExplainer) recordFinal(results []models.SearchResult, reranked bool) {
+	if e == nil {
+		return
+	}
+	e.explain.Reranked = reranked
+	for i, result := range results {
+		source := e.defaultSource()
+		if resultRetrievalSource(result) == models.RetrievalSourceGraph {
+			source = models.RetrievalSourceGraph
+		}
+		e.add(result, source).FinalRank = i + 1
+	}
+}
+
+// build 生成诊断结果：计算每个候选命中的过滤条件，去掉不属于当前用户的记录
+func (e *retrievalExplainer) build() *models.RetrievalExplain {
+	if e == nil {
+		return nil
+	}
+	explain := e.explain
+	explain.Candidates = []models.ExplainCandidate{}
+	hidden := 0
+	for _, id := range e.order {
+		record := e.records[id]
+		if e.userID == "" || getResultUserID(record) != e.userID {
+			hidden++
+			continue
+		}
+		candidate := *e.candidates[id]
+		candidate.MatchedFilters = e.matchedFilters(record)
+		explain.Candidates = append(explain.Candidates, candidate)
+	}
+	if hidden > 0 {
+		log.Printf("🔒 [检索诊断] 隐藏了%d条不属于当前用户的候选", hidden)
+	}
+	return &explain
+}
+
+// add 按ID登记候选，已登记的候选保持原来源
+func (e *retrievalExplainer) add(result models.SearchResult, source string) *models.ExplainCandidate {
+	if candidate, ok := e.candidates[result.ID]; ok {
+		return candidate
+	}
+	candidate := &models.ExplainCandidate{
+		ID:              result.ID,
+		Score:           result.Score,
+		Source:          source,
+		PassedThreshold: true,
+	}
+	e.candidates[result.ID] = candidate
+	e.records[result.ID] = result
+	e.order = append(e.order, result.ID)
+	return candidate
+}
+
+// defaultSource 未经向量检索登记的候选来源：向量检索时为混合检索的关键词候选，其余按检索方式确定
+func (e *retrievalExplainer) defaultSource() string {
+	switch e.explain.Mode {
+	case models.ExplainModeVector:
+		return models.ExplainSourceKeyword
+	case models.ExplainModeMemoryID, models.ExplainModeBatchID:
+		return models.ExplainSourceID
+	default:
+		return models.ExplainSourceSession
+	}
+}
+
+// matchedFilters 计算记录命中的过滤条件
+func (e *retrievalExplainer) matchedFilters(record models.SearchResult) []string {
+	matched := []string{explainFilterUserID}
+	sessionID, _ := record.Fields["session_id"].(string)
+	if sessionID != "" && sessionID == e.sessionID {
+		matched = append(matched, explainFilterSession)
+	}
+	if e.workspace != "" && sessionID != "" && e.workspaceOf(sessionID) == e.workspace {
+		matched = append(matched, explainFilterWorkspace)
+	}
+	if e.startTime > 0 || e.endTime > 0 {
+		if timestamp := getResultTimestamp(record); (e.startTime <= 0 || timestamp >= e.startTime) && (e.endTime <= 0 || timestamp <= e.endTime) {
+			matched = append(matched, explainFilterTimeRange)
+		}
+	}
+	return matched
+}
+
+// workspaceOf 获取候选所属会话的工作空间路径，同一会话只查询一次
+func (e *retrievalExplainer) workspaceOf(sessionID string) string {
+	if sessionID == e.sessionID {
+		return e.workspace
+	}
+	workspace, ok := e.sessionWorkspaces[sessionID]
+	if !ok {
+		workspace = e.lookupWorkspace(sessionID)
+		e.sessionWorkspaces[sessionID] = workspace
+	}
+	return workspace
+}
+
+// sessionWorkspacePath 获取会话元数据中的工作空间路径，会话不存在时返回空（不会创建会话）
+func (s *ContextService) sessionWorkspacePath(sessionID string) string {
+	if s.sessionStore == nil || sessionID == "" {
+		return ""
+	}
+	session, err := s.sessionStore.GetSessionSnapshot(sessionID)
+	if err != nil || session.Metadata == nil {
+		return ""
+	}
+	workspacePath, _ := session.Metadata["workspacePath"].(string)
+	return workspacePath
+}
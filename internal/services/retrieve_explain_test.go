@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestRetrieveContextExplain 测试检索诊断：阈值通过情况、命中的过滤条件、最终排名，且不包含其他用户的记录
+func TestRetrieveContextExplain(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	for id, workspace := range map[string]string{"s1": "/ws/app", "s2": "/ws/app", "s3": "/ws/other"} {
+		session := models.NewSession(id)
+		session.Metadata = map[string]interface{}{"userId": "user_a", "workspacePath": workspace}
+		if err := sessionStore.SaveSession(session); err != nil {
+			t.Fatalf("保存会话失败: %v", err)
+		}
+	}
+
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+	for _, m := range []struct{ id, sessionID, userID, content string }{
+		{"exact", "s1", "user_a", "登录超时"},
+		{"same_ws", "s2", "user_a", "支付回调失败排查"},
+		{"other_ws", "s3", "user_a", "部署脚本权限问题"},
+		{"other_user", "s1", "user_b", "登录超时"},
+	} {
+		memory := models.NewMemory(m.sessionID, m.content, "P1", nil)
+		memory.ID = m.id
+		memory.UserID = m.userID
+		memory.Vector, _ = vectorStore.GenerateEmbedding(m.content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	resp, err := service.RetrieveContext(ctx, models.RetrieveContextRequest{SessionID: "s1", Query: "登录超时", Threshold: 0.99, Explain: true})
+	if err != nil {
+		t.Fatalf("RetrieveContext failed: %v", err)
+	}
+	explain := resp.Explain
+	if explain == nil || explain.Mode != models.ExplainModeVector || !strings.Contains(explain.Filter, `userId="user_a"`) {
+		t.Fatalf("诊断信息缺少检索方式或过滤条件: %+v", explain)
+	}
+
+	candidates := make(map[string]models.ExplainCandidate)
+	for _, candidate := range explain.Candidates {
+		candidates[candidate.ID] = candidate
+	}
+	if _, leaked := candidates["other_user"]; leaked || len(candidates) != 3 {
+		t.Fatalf("诊断候选应只包含当前用户的3条记录: %+v", explain.Candidates)
+	}
+	if c := candidates["exact"]; !c.PassedThreshold || c.FinalRank != 1 || strings.Join(c.MatchedFilters, ",") != "userId,session,workspace" {
+		t.Errorf("完全匹配的记录诊断错误: %+v", c)
+	}
+	if c := candidates["same_ws"]; c.PassedThreshold || c.FinalRank != 0 || strings.Join(c.MatchedFilters, ",") != "userId,workspace" {
+		t.Errorf("同工作空间的记录诊断错误: %+v", c)
+	}
+	if c := candidates["other_ws"]; c.PassedThreshold || strings.Join(c.MatchedFilters, ",") != "userId" {
+		t.Errorf("其他工作空间的记录诊断错误: %+v", c)
+	}
+
+	plain, err := service.RetrieveContext(ctx, models.RetrieveContextRequest{SessionID: "s1", Query: "登录超时"})
+	if err != nil || plain.Explain != nil {
+		t.Errorf("未开启explain时不应返回诊断信息: %+v, %v", plain.Explain, err)
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 检索结果分组方式
+const (
+	retrieveGroupByBatch   = "batch"
+	retrieveGroupBySession = "session"
+
+	// maxGroupMembers 每组最多返回的成员数，超出部分只计入memberCount
+	maxGroupMembers = 5
+	// conversationSummaryType 对话批次摘要的记忆类型，命中时作为批次组的摘要
+	conversationSummaryType = "conversation_summary"
+)
+
+// validateRetrieveGroupBy 校验分组方式
+func validateRetrieveGroupBy(groupBy string) error {
+	switch groupBy {
+	case "", retrieveGroupByBatch, retrieveGroupBySession:
+		return nil
+	default:
+		return fmt.Errorf("不支持的分组方式: %s，可选: batch, session", groupBy)
+	}
+}
+
+// memoryGroupKey 结果所属分组的键，batch取metadata.batchId，session取会话ID；缺失时以记忆ID单独成组
+func memoryGroupKey(result models.MemoryResult, groupBy string) string {
+	key := ""
+	switch groupBy {
+	case retrieveGroupByBatch:
+		key, _ = result.Metadata["batchId"].(string)
+	case retrieveGroupBySession:
+		key = result.SessionID
+	}
+	if key == "" {
+		return result.MemoryID
+	}
+	return key
+}
+
+// groupMemoryResults 按批次或会话聚合检索结果
+// 分组顺序与各组首个成员在结果中的位置一致（即沿用相似度/重排序/时间排序），组内成员按时间正序；
+// 批次组命中对话摘要时将其作为组摘要而不列为成员，sessionSummary用于获取会话组的摘要，可为nil
+func groupMemoryResults(results []models.MemoryResult, groupBy string, sessionSummary func(sessionID string) string) []models.MemoryGroup {
+	var groups []*models.MemoryGroup
+	index := make(map[string]*models.MemoryGroup)
+	for _, result := range results {
+		key := memoryGroupKey(result, groupBy)
+		group, ok := index[key]
+		if !ok {
+			group = &models.MemoryGroup{Key: key, BestScore: result.Score}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		if result.Score > group.BestScore {
+			group.BestScore = result.Score
+		}
+		if groupBy == retrieveGroupByBatch && result.Type == conversationSummaryType && group.Summary == "" {
+			group.Summary = result.Content
+			continue
+		}
+		group.Members = append(group.Members, result)
+	}
+
+	grouped := make([]models.MemoryGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.SliceStable(group.Members, func(i, j int) bool {
+			return group.Members[i].Timestamp < group.Members[j].Timestamp
+		})
+		group.MemberCount = len(group.Members)
+		if len(group.Members) > maxGroupMembers {
+			group.Members = group.Members[:maxGroupMembers]
+		}
+		if groupBy == retrieveGroupBySession && group.Summary == "" && sessionSummary != nil {
+			group.Summary = sessionSummary(group.Key)
+		}
+		grouped = append(grouped, *group)
+	}
+	return grouped
+}
+
+// sessionGroupSummary 会话组的摘要，取自会话存储中已生成的会话摘要
+func (s *ContextService) sessionGroupSummary(sessionID string) string {
+	if s.sessionStore == nil {
+		return ""
+	}
+	session, err := s.sessionStore.GetSessionSnapshot(sessionID)
+	if err != nil || session == nil {
+		return ""
+	}
+	return session.Summary
+}
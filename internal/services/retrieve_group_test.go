@@ -0,0 +1,51 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestGroupMemoryResults 测试按批次聚合时组按首次命中排序、成员按时间正序并限制条数，批次摘要作为组摘要；按会话聚合时使用会话摘要
+func TestGroupMemoryResults(t *testing.T) {
+	result := func(id, batchID, sessionID, resultType string, score float64, timestamp int64) models.MemoryResult {
+		memory := models.MemoryResult{MemoryID: id, Content: "内容-" + id, Score: score, Type: resultType, Timestamp: timestamp, SessionID: sessionID}
+		if batchID != "" {
+			memory.Metadata = map[string]interface{}{"batchId": batchID}
+		}
+		return memory
+	}
+	results := []models.MemoryResult{
+		result("b1-late", "batch-1", "s1", "conversation_message", 0.9, 300),
+		result("loose", "", "s2", "memory", 0.8, 50),
+		result("b1-early", "batch-1", "s1", "conversation_message", 0.7, 100),
+		result("b1-summary", "batch-1", "s1", conversationSummaryType, 0.95, 400),
+	}
+	for i := 0; i < maxGroupMembers+2; i++ {
+		results = append(results, result(fmt.Sprintf("b2-%d", i), "batch-2", "s2", "conversation_message", 0.5, int64(1000-i)))
+	}
+
+	groups := groupMemoryResults(results, retrieveGroupByBatch, nil)
+	if len(groups) != 3 || groups[0].Key != "batch-1" || groups[1].Key != "loose" || groups[2].Key != "batch-2" {
+		t.Fatalf("应按首次命中顺序返回batch-1、单独成组的记忆和batch-2: %+v", groups)
+	}
+	batch1 := groups[0]
+	if batch1.BestScore != 0.95 || batch1.Summary != "内容-b1-summary" || batch1.MemberCount != 2 ||
+		batch1.Members[0].MemoryID != "b1-early" || batch1.Members[1].MemoryID != "b1-late" {
+		t.Errorf("batch-1应以批次摘要为组摘要，成员按时间正序: %+v", batch1)
+	}
+	if batch2 := groups[2]; batch2.MemberCount != maxGroupMembers+2 || len(batch2.Members) != maxGroupMembers {
+		t.Errorf("每组成员应截断为%d条并保留总数: count=%d, members=%d", maxGroupMembers, batch2.MemberCount, len(batch2.Members))
+	}
+
+	summaries := map[string]string{"s1": "讨论会话缓存方案"}
+	groups = groupMemoryResults(results, retrieveGroupBySession, func(sessionID string) string { return summaries[sessionID] })
+	if len(groups) != 2 || groups[0].Key != "s1" || groups[0].Summary != "讨论会话缓存方案" || groups[0].MemberCount != 3 {
+		t.Errorf("按会话聚合错误: %+v", groups)
+	}
+
+	if err := validateRetrieveGroupBy("thread"); err == nil {
+		t.Error("不支持的分组方式应返回错误")
+	}
+}
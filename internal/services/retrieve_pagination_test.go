@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestPaginateSearchResults 测试偏移量和页大小的边界、hasMore和nextOffset
+func TestPaginateSearchResults(t *testing.T) {
+	results := make([]models.SearchResult, 5)
+	for i := range results {
+		results[i].ID = fmt.Sprintf("m%d", i)
+	}
+
+	cases := []struct {
+		name       string
+		offset     int
+		pageSize   int
+		wantIDs    []string
+		hasMore    bool
+		nextOffset int
+	}{
+		{"第一页", 0, 2, []string{"m0", "m1"}, true, 2},
+		{"中间页", 2, 2, []string{"m2", "m3"}, true, 4},
+		{"最后一页不足一页", 4, 2, []string{"m4"}, false, 5},
+		{"恰好取完", 3, 2, []string{"m3", "m4"}, false, 5},
+		{"页大小超过结果数", 0, 10, []string{"m0", "m1", "m2", "m3", "m4"}, false, 5},
+		{"偏移量等于结果数", 5, 2, []string{}, false, 5},
+		{"偏移量超出结果数", 8, 2, []string{}, false, 8},
+		{"页大小为0", 1, 0, []string{}, true, 1},
+	}
+	for _, c := range cases {
+		page, hasMore, nextOffset := paginateSearchResults(results, c.offset, c.pageSize)
+		var ids []string
+		for _, result := range page {
+			ids = append(ids, result.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(c.wantIDs) {
+			t.Errorf("%s: 期望%v，实际%v", c.name, c.wantIDs, ids)
+		}
+		if hasMore != c.hasMore || nextOffset != c.nextOffset {
+			t.Errorf("%s: 期望hasMore=%v nextOffset=%d，实际hasMore=%v nextOffset=%d",
+				c.name, c.hasMore, c.nextOffset, hasMore, nextOffset)
+		}
+	}
+
+	if page, hasMore, nextOffset := paginateSearchResults(nil, 0, 2); len(page) != 0 || hasMore || nextOffset != 0 {
+		t.Errorf("空结果应返回空页: %v, %v, %d", page, hasMore, nextOffset)
+	}
+}
+
+// newRetrieveTestService 创建会话s1属于user_a、使用内存向量存储的服务，threshold为存储配置的相似度阈值
+func newRetrieveTestService(t *testing.T, threshold float64, contents map[string]string) *ContextService {
+	t.Helper()
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	session := models.NewSession("s1")
+	session.Metadata = map[string]interface{}{"userId": "user_a"}
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, threshold)
+	service.SetVectorStore(vectorStore)
+	for id, content := range contents {
+		memory := models.NewMemory("s1", content, "P1", nil)
+		memory.ID = id
+		memory.UserID = "user_a"
+		if memory.Vector, err = vectorStore.GenerateEmbedding(content); err != nil {
+			t.Fatalf("GenerateEmbedding failed: %v", err)
+		}
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+	return service
+}
+
+// TestRetrieveContextPaginatesAfterThreshold 测试分页在阈值过滤之后进行：逐页取完恰好是全部通过阈值的记录，
+// 未通过阈值的记录不占用页内位置，最后一页hasMore为false
+func TestRetrieveContextPaginatesAfterThreshold(t *testing.T) {
+	contents := map[string]string{}
+	for i := 0; i < 5; i++ {
+		contents[fmt.Sprintf("match%d", i)] = "登录超时"
+		contents[fmt.Sprintf("other%d", i)] = fmt.Sprintf("部署脚本权限问题 %d", i)
+	}
+	service := newRetrieveTestService(t, 0, contents)
+
+	seen := make(map[string]bool)
+	offset := 0
+	for page := 1; ; page++ {
+		resp, err := service.RetrieveContext(context.Background(), models.RetrieveContextRequest{
+			SessionID: "s1", Query: "登录超时", Threshold: 0.99, PageSize: 2, Offset: offset, Structured: true,
+		})
+		if err != nil {
+			t.Fatalf("RetrieveContext failed: %v", err)
+		}
+		wantLen, wantMore := 2, page < 3
+		if page == 3 {
+			wantLen = 1
+		}
+		if len(resp.Results) != wantLen || resp.HasMore != wantMore || resp.NextOffset != offset+wantLen {
+			t.Fatalf("第%d页错误: 本页%d条, hasMore=%v, nextOffset=%d", page, len(resp.Results), resp.HasMore, resp.NextOffset)
+		}
+		for _, result := range resp.Results {
+			if contents[result.MemoryID] != "登录超时" || seen[result.MemoryID] {
+				t.Errorf("第%d页包含未通过阈值或重复的记录: %s", page, result.MemoryID)
+			}
+			seen[result.MemoryID] = true
+		}
+		if !resp.HasMore {
+			break
+		}
+		offset = resp.NextOffset
+	}
+	if len(seen) != 5 {
+		t.Errorf("逐页应取完全部5条通过阈值的记录，实际%d条", len(seen))
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// RetrievalStreamEmitter 发送一条流式检索事件，返回错误时停止检索
+type RetrievalStreamEmitter func(event string, data interface{}) error
+
+// retrievalCandidateObserverKey 检索候选观察者在context中的键
+type retrievalCandidateObserverKey struct{}
+
+// StreamRetrieveContext 检索上下文并逐条发送结果
+// 向量检索返回并完成过滤后立即逐条发送当前页的候选（candidate），客户端可先展示排名靠前的结果；
+// 开启重排序时候选为重排序前的顺序。之后按最终顺序发送result，最后发送complete；
+// ctx取消或发送失败时取消后续的向量检索和LLM调用
+func (s *ContextService) StreamRetrieveContext(ctx context.Context, req models.RetrieveContextRequest, emit RetrievalStreamEmitter) error {
+	if req.GroupBy != "" {
+		return apperrors.ErrInvalidArgument.WithMessagef("流式检索不支持groupBy")
+	}
+	req.Structured = true
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 观察者与检索在同一goroutine中同步调用，无需加锁
+	var emitErr error
+	send := func(event string, data interface{}) bool {
+		if emitErr != nil {
+			return false
+		}
+		if err := emit(event, data); err != nil {
+			emitErr = err
+			cancel()
+			return false
+		}
+		return true
+	}
+
+	candidateCount := 0
+	ctx = context.WithValue(ctx, retrievalCandidateObserverKey{}, func(candidates []models.MemoryResult) {
+		for i, candidate := range candidates {
+			if !send(models.RetrievalEventCandidate, models.RetrievalStreamItem{Rank: i + 1, MemoryResult: candidate}) {
+				return
+			}
+			candidateCount++
+		}
+	})
+
+	resp, err := s.RetrieveContext(ctx, req)
+	if emitErr != nil {
+		return fmt.Errorf("发送检索事件失败: %w", emitErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, result := range resp.Results {
+		if !send(models.RetrievalEventResult, models.RetrievalStreamItem{Rank: i + 1, MemoryResult: result}) {
+			return fmt.Errorf("发送检索事件失败: %w", emitErr)
+		}
+	}
+	if !send(models.RetrievalEventComplete, models.RetrievalStreamComplete{
+		Total:      len(resp.Results),
+		HasMore:    resp.HasMore,
+		NextOffset: resp.NextOffset,
+		Reranked:   len(resp.RerankScores) > 0,
+	}) {
+		return fmt.Errorf("发送检索事件失败: %w", emitErr)
+	}
+
+	log.Printf("📡 [流式检索] 会话 %s 发送完成: 候选=%d, 结果=%d", req.SessionID, candidateCount, len(resp.Results))
+	return nil
+}
+
+// notifyRetrievalCandidates 把当前页的候选交给流式检索的观察者，未设置观察者时不做任何事
+func notifyRetrievalCandidates(ctx context.Context, results []models.SearchResult, offset, pageSize int) {
+	observer, ok := ctx.Value(retrievalCandidateObserverKey{}).(func([]models.MemoryResult))
+	if !ok {
+		return
+	}
+
+	page, _, _ := paginateSearchResults(results, offset, pageSize)
+	candidates := make([]models.MemoryResult, 0, len(page))
+	for _, result := range page {
+		if content, ok := result.Fields["content"].(string); ok {
+			candidates = append(candidates, buildMemoryResult(result, content))
+		}
+	}
+	observer(candidates)
+}
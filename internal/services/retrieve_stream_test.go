@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestNotifyRetrievalCandidates 测试只把当前页内有内容的候选交给观察者，未设置观察者时不报错
+func TestNotifyRetrievalCandidates(t *testing.T) {
+	results := []models.SearchResult{
+		{ID: "m1", Score: 0.9, Fields: map[string]interface{}{"content": "第一条"}},
+		{ID: "m2", Score: 0.8, Fields: map[string]interface{}{"content": "第二条"}},
+		{ID: "m3", Score: 0.7, Fields: map[string]interface{}{}},
+		{ID: "m4", Score: 0.6, Fields: map[string]interface{}{"content": "第四条"}},
+	}
+
+	notifyRetrievalCandidates(context.Background(), results, 0, 2)
+
+	var got []models.MemoryResult
+	ctx := context.WithValue(context.Background(), retrievalCandidateObserverKey{}, func(candidates []models.MemoryResult) {
+		got = candidates
+	})
+	notifyRetrievalCandidates(ctx, results, 1, 2)
+	if len(got) != 1 || got[0].MemoryID != "m2" || got[0].Content != "第二条" {
+		t.Fatalf("应只发送第二页中有内容的候选m2: %+v", got)
+	}
+}
+
+// TestStreamRetrieveContextRejectsGroupBy 测试流式检索不支持groupBy，且不会发送任何事件
+func TestStreamRetrieveContextRejectsGroupBy(t *testing.T) {
+	service := &ContextService{}
+	emitted := 0
+	err := service.StreamRetrieveContext(context.Background(), models.RetrieveContextRequest{SessionID: "s1", GroupBy: retrieveGroupByBatch},
+		func(event string, data interface{}) error {
+			emitted++
+			return nil
+		})
+	if err == nil || emitted != 0 {
+		t.Fatalf("groupBy请求应直接返回错误: err=%v, emitted=%d", err, emitted)
+	}
+}
+
+// TestStreamRetrieveContextWithoutRerank 测试未开启重排序时向量检索完成后即逐条发送候选，之后发送最终结果和complete；
+// 发送失败时停止检索，不再发送后续事件
+func TestStreamRetrieveContextWithoutRerank(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	session := models.NewSession("s1")
+	session.Metadata = map[string]interface{}{"userId": "user_a"}
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+	for _, content := range []string{"登录超时", "登录失败重试", "部署脚本"} {
+		memory := models.NewMemory("s1", content, "P1", nil)
+		memory.UserID = "user_a"
+		memory.Vector, _ = vectorStore.GenerateEmbedding(content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+	req := models.RetrieveContextRequest{SessionID: "s1", Query: "登录超时", SkipThreshold: true, PageSize: 2}
+
+	var events []string
+	err = service.StreamRetrieveContext(context.Background(), req, func(event string, data interface{}) error {
+		events = append(events, event)
+		if complete, ok := data.(models.RetrievalStreamComplete); ok && (complete.Total != 2 || !complete.HasMore || complete.Reranked) {
+			t.Errorf("complete事件错误: %+v", complete)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamRetrieveContext failed: %v", err)
+	}
+	want := []string{models.RetrievalEventCandidate, models.RetrievalEventCandidate,
+		models.RetrievalEventResult, models.RetrievalEventResult, models.RetrievalEventComplete}
+	if len(events) != len(want) {
+		t.Fatalf("期望事件%v，实际%v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("期望事件%v，实际%v", want, events)
+		}
+	}
+
+	sent := 0
+	err = service.StreamRetrieveContext(context.Background(), req, func(event string, data interface{}) error {
+		sent++
+		return errors.New("客户端已断开")
+	})
+	if err == nil || sent != 1 {
+		t.Errorf("第一个候选发送失败后应停止: err=%v, 发送%d次", err, sent)
+	}
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 结构化检索结果的默认类型
+const (
+	memoryResultTypeMemory  = "memory"
+	memoryResultTypeMessage = "message"
+)
+
+// buildMemoryResult 将搜索结果转换为结构化的检索结果
+// memoryId优先取分块记忆所属的memory_id，类型取自metadata.type，缺失时按是否为对话消息区分
+func buildMemoryResult(result models.SearchResult, content string) models.MemoryResult {
+	memoryID := result.ID
+	if id, ok := result.Fields["memory_id"].(string); ok && id != "" {
+		memoryID = id
+	}
+
+	metadata := parseResultMetadata(result)
+	resultType := memoryResultTypeMemory
+	if role, _ := result.Fields["role"].(string); role != "" {
+		resultType = memoryResultTypeMessage
+	}
+	if t, ok := metadata[models.MetadataTypeKey].(string); ok && t != "" {
+		resultType = t
+	}
+
+	contentType, contentRef := metadataContentReference(metadata)
+	sessionID, _ := result.Fields["session_id"].(string)
+	return models.MemoryResult{
+		MemoryID:    memoryID,
+		Content:     content,
+		Score:       result.Score,
+		Type:        resultType,
+		Timestamp:   getResultTimestamp(result),
+		Source:      resultRetrievalSource(result),
+		ContentType: contentType,
+		ContentRef:  contentRef,
+		SessionID:   sessionID,
+		Metadata:    metadata,
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestBuildMemoryResult 测试结构化结果取分块所属的memoryId，类型优先取metadata.type，缺失时区分记忆和对话消息
+func TestBuildMemoryResult(t *testing.T) {
+	chunk := models.SearchResult{ID: "chunk-1", Score: 0.42, Fields: map[string]interface{}{
+		"content":   "采用Redis缓存会话",
+		"memory_id": "mem-1",
+		"timestamp": float64(1700000000),
+		"metadata":  `{"type":"decision","file_path":"main.go"}`,
+	}}
+	result := buildMemoryResult(chunk, "采用Redis缓存会话")
+	if result.MemoryID != "mem-1" || result.Score != 0.42 || result.Type != "decision" || result.Timestamp != 1700000000 {
+		t.Errorf("结构化结果错误: %+v", result)
+	}
+	if result.Metadata["file_path"] != "main.go" {
+		t.Errorf("metadata解析错误: %+v", result.Metadata)
+	}
+
+	message := buildMemoryResult(models.SearchResult{ID: "msg-1", Fields: map[string]interface{}{"role": "user"}}, "你好")
+	if message.MemoryID != "msg-1" || message.Type != memoryResultTypeMessage || message.Metadata != nil {
+		t.Errorf("对话消息结果错误: %+v", message)
+	}
+
+	memory := buildMemoryResult(models.SearchResult{ID: "mem-2", Fields: map[string]interface{}{}}, "内容")
+	if memory.Type != memoryResultTypeMemory {
+		t.Errorf("缺少类型时应为memory，实际为%s", memory.Type)
+	}
+}
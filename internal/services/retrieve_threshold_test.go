@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestRetrieveContextThresholdOverride 测试单次调用的相似度阈值覆盖配置的阈值（可调高也可调低），skipThreshold时两者都不生效
+func TestRetrieveContextThresholdOverride(t *testing.T) {
+	// 与查询的相似度分别为1、约0.67和0
+	contents := map[string]string{"exact": "登录超时", "related": "登录超时后重试失败", "unrelated": "部署脚本权限问题"}
+
+	count := func(service *ContextService, req models.RetrieveContextRequest) int {
+		t.Helper()
+		req.SessionID, req.Query, req.Structured = "s1", "登录超时", true
+		resp, err := service.RetrieveContext(context.Background(), req)
+		if err != nil {
+			t.Fatalf("RetrieveContext failed: %v", err)
+		}
+		return len(resp.Results)
+	}
+
+	configured := newRetrieveTestService(t, 0.9, contents)
+	if got := count(configured, models.RetrieveContextRequest{}); got != 1 {
+		t.Errorf("未指定阈值时应使用配置的阈值0.9，期望1条，实际%d条", got)
+	}
+	if got := count(configured, models.RetrieveContextRequest{Threshold: 0.5}); got != 2 {
+		t.Errorf("单次调用的阈值0.5应覆盖配置的阈值，期望2条，实际%d条", got)
+	}
+	if got := count(configured, models.RetrieveContextRequest{Threshold: 0.9, SkipThreshold: true}); got != 3 {
+		t.Errorf("skipThreshold时不应过滤，期望3条，实际%d条", got)
+	}
+
+	unconfigured := newRetrieveTestService(t, 0, contents)
+	if got := count(unconfigured, models.RetrieveContextRequest{}); got != 3 {
+		t.Errorf("未配置阈值时不应过滤，期望3条，实际%d条", got)
+	}
+	if got := count(unconfigured, models.RetrieveContextRequest{Threshold: 0.9}); got != 1 {
+		t.Errorf("单次调用的阈值0.9应生效，期望1条，实际%d条", got)
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 检索结果排序方式
+const (
+	retrieveSortBySimilarity = ""
+	retrieveSortByTime       = "time"
+)
+
+// validateRetrieveTimeRange 校验检索的时间范围和排序参数，时间为unix秒
+func validateRetrieveTimeRange(req models.RetrieveContextRequest) error {
+	if req.StartTime < 0 || req.EndTime < 0 {
+		return fmt.Errorf("startTime和endTime必须是非负的unix秒")
+	}
+	if req.StartTime > 0 && req.EndTime > 0 && req.StartTime > req.EndTime {
+		return fmt.Errorf("startTime(%d)不能晚于endTime(%d)", req.StartTime, req.EndTime)
+	}
+	switch req.SortBy {
+	case retrieveSortBySimilarity, retrieveSortByTime:
+		return nil
+	default:
+		return fmt.Errorf("不支持的排序方式: %s，可选: time", req.SortBy)
+	}
+}
+
+// filterResultsByTimeRange 按timestamp字段过滤检索结果（含边界），保持原有顺序
+// 传统向量服务不一定支持服务端范围过滤，因此所有检索路径都在服务层再过滤一次
+func filterResultsByTimeRange(results []models.SearchResult, startTime, endTime int64) []models.SearchResult {
+	if startTime <= 0 && endTime <= 0 {
+		return results
+	}
+
+	filtered := make([]models.SearchResult, 0, len(results))
+	for _, result := range results {
+		timestamp := getResultTimestamp(result)
+		if startTime > 0 && timestamp < startTime {
+			continue
+		}
+		if endTime > 0 && timestamp > endTime {
+			continue
+		}
+		filtered = append(filtered, result)
+	}
+	return filtered
+}
+
+// sortResultsByTime 按timestamp倒序排列（新的在前），时间相同时保持相似度顺序
+func sortResultsByTime(results []models.SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return getResultTimestamp(results[i]) > getResultTimestamp(results[j])
+	})
+}
+
+// getResultTimestamp 获取搜索结果的时间戳（unix秒），兼容数字和字符串形式，缺失时返回0
+func getResultTimestamp(result models.SearchResult) int64 {
+	switch v := result.Fields["timestamp"].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case string:
+		if timestamp, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return timestamp
+		}
+	}
+	return 0
+}
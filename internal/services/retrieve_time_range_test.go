@@ -0,0 +1,31 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestFilterResultsByTimeRange 测试按unix秒过滤时包含边界且保持相似度顺序，sortBy=time时按时间倒序
+func TestFilterResultsByTimeRange(t *testing.T) {
+	results := []models.SearchResult{
+		{ID: "a", Score: 0.1, Fields: map[string]interface{}{"timestamp": float64(100)}},
+		{ID: "b", Score: 0.2, Fields: map[string]interface{}{"timestamp": float64(300)}},
+		{ID: "c", Score: 0.3, Fields: map[string]interface{}{"timestamp": float64(200)}},
+		{ID: "d", Score: 0.4, Fields: map[string]interface{}{}},
+	}
+
+	filtered := filterResultsByTimeRange(results, 100, 300)
+	if len(filtered) != 3 || filtered[0].ID != "a" || filtered[1].ID != "b" || filtered[2].ID != "c" {
+		t.Fatalf("过滤结果错误: %+v", filtered)
+	}
+
+	sortResultsByTime(filtered)
+	if filtered[0].ID != "b" || filtered[1].ID != "c" || filtered[2].ID != "a" {
+		t.Errorf("按时间排序错误: %s %s %s", filtered[0].ID, filtered[1].ID, filtered[2].ID)
+	}
+
+	if err := validateRetrieveTimeRange(models.RetrieveContextRequest{StartTime: 300, EndTime: 100}); err == nil {
+		t.Error("startTime晚于endTime时应返回错误")
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestResolveRetrievePageSize 测试topK校验、默认值和上限截断
+func TestResolveRetrievePageSize(t *testing.T) {
+	cases := []struct {
+		req     models.RetrieveContextRequest
+		want    int
+		wantErr bool
+	}{
+		{models.RetrieveContextRequest{}, defaultRetrievePageSize, false},
+		{models.RetrieveContextRequest{TopK: 25}, 25, false},
+		{models.RetrieveContextRequest{PageSize: 5}, 5, false},
+		{models.RetrieveContextRequest{TopK: 5, PageSize: 5}, 5, false},
+		{models.RetrieveContextRequest{TopK: 500}, maxRetrievePageSize, false},
+		{models.RetrieveContextRequest{TopK: -1}, 0, true},
+		{models.RetrieveContextRequest{TopK: 5, PageSize: 8}, 0, true},
+	}
+	for _, c := range cases {
+		got, err := resolveRetrievePageSize(c.req)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("resolveRetrievePageSize(%+v) = %d, %v; want %d, err=%v", c.req, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+// TestRetrieveContextTopK 测试topK控制返回条数，且只返回当前用户的记忆
+func TestRetrieveContextTopK(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	session := models.NewSession("s1")
+	session.Metadata = map[string]interface{}{"userId": "user_a"}
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+	for i := 0; i < 30; i++ {
+		userID := "user_a"
+		if i%3 == 0 {
+			userID = "user_b"
+		}
+		content := fmt.Sprintf("登录超时 修复记录 %d", i)
+		memory := models.NewMemory("s1", content, "P1", nil)
+		memory.ID = fmt.Sprintf("m%d", i)
+		memory.UserID = userID
+		if memory.Vector, err = vectorStore.GenerateEmbedding(content); err != nil {
+			t.Fatalf("GenerateEmbedding failed: %v", err)
+		}
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+
+	resp, err := service.RetrieveContext(context.Background(), models.RetrieveContextRequest{
+		SessionID: "s1", Query: "登录超时", TopK: 15, Structured: true,
+	})
+	if err != nil {
+		t.Fatalf("RetrieveContext failed: %v", err)
+	}
+	if len(resp.Results) != 15 || !resp.HasMore {
+		t.Errorf("Expected 15 results with more pages, got %d (hasMore=%v)", len(resp.Results), resp.HasMore)
+	}
+	for _, result := range resp.Results {
+		var index int
+		fmt.Sscanf(result.MemoryID, "m%d", &index)
+		if index%3 == 0 {
+			t.Errorf("Result %s belongs to another user", result.MemoryID)
+		}
+	}
+}
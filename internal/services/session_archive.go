@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// 会话元数据中记录消息归档进度的键
+const (
+	metadataArchiveCursor   = "message_archive_cursor"    // 最后一条已归档消息的ID
+	metadataArchiveMemoryID = "message_archive_memory_id" // 最近一次归档生成的长期记忆ID
+	metadataArchiveTime     = "message_archive_time"      // 最近一次归档时间
+	metadataArchivedCount   = "archived_message_count"    // 累计归档的消息数
+)
+
+// archiveSessionOverflow 会话消息数超过上限时，将最旧的超限消息汇总为长期记忆并移出会话，返回归档的消息数
+// 归档游标记录在会话元数据中：游标及之前的消息视为已归档，重复执行时只移除而不会再次汇总
+func (s *ContextService) archiveSessionOverflow(ctx context.Context, sessionStore *store.SessionStore, sessionID string, maxMessages int) (int, error) {
+	if maxMessages <= 0 {
+		return 0, nil
+	}
+
+	key := sessionStore.GetStorePath() + "|" + sessionID
+	if !s.acquireArchive(key) {
+		log.Printf("[消息归档] 会话 %s 正在归档，跳过", sessionID)
+		return 0, nil
+	}
+	defer s.releaseArchive(key)
+
+	snapshot, err := sessionStore.GetSessionSnapshot(sessionID)
+	if err != nil {
+		return 0, err
+	}
+	if len(snapshot.Messages) <= maxMessages {
+		return 0, nil
+	}
+
+	// 游标之前的消息已汇总过（例如上次移除后又被合并回会话），直接移除
+	cursor, _ := snapshot.Metadata[metadataArchiveCursor].(string)
+	pending := snapshot.Messages
+	if index := messageIndex(pending, cursor); index >= 0 {
+		pending = pending[index+1:]
+	}
+	if len(pending) <= maxMessages {
+		return 0, removeArchivedMessages(sessionStore, sessionID, cursor)
+	}
+
+	overflow := pending[:len(pending)-maxMessages]
+	summary := s.summarizeMessages(ctx, sessionID, overflow)
+	if summary == "" {
+		return 0, fmt.Errorf("会话%s的超限消息摘要为空", sessionID)
+	}
+
+	userID, _ := snapshot.Metadata["userId"].(string)
+	lastID := overflow[len(overflow)-1].ID
+	memoryID, err := s.StoreContext(ctx, models.StoreContextRequest{
+		SessionID: sessionID,
+		UserID:    userID,
+		Content:   summary,
+		Priority:  "P1",
+		Metadata: map[string]interface{}{
+			"type":          "session_archive",
+			"timestamp":     time.Now().Unix(),
+			"message_count": len(overflow),
+			"cursor_start":  overflow[0].ID,
+			"cursor_end":    lastID,
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("存储归档摘要失败: %w", err)
+	}
+
+	err = sessionStore.ModifySession(sessionID, func(session *models.Session) error {
+		if session.Metadata == nil {
+			session.Metadata = make(map[string]interface{})
+		}
+		// 从文件加载的元数据中数值为float64
+		archivedCount := 0
+		switch count := session.Metadata[metadataArchivedCount].(type) {
+		case int:
+			archivedCount = count
+		case float64:
+			archivedCount = int(count)
+		}
+		session.Metadata[metadataArchiveCursor] = lastID
+		session.Metadata[metadataArchiveMemoryID] = memoryID
+		session.Metadata[metadataArchiveTime] = time.Now().Unix()
+		session.Metadata[metadataArchivedCount] = archivedCount + len(overflow)
+		if index := messageIndex(session.Messages, lastID); index >= 0 {
+			session.Messages = session.Messages[index+1:]
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("移除已归档消息失败: %w", err)
+	}
+
+	log.Printf("📦 [消息归档] 会话 %s 归档 %d 条最旧消息，长期记忆ID: %s", sessionID, len(overflow), memoryID)
+	return len(overflow), nil
+}
+
+// removeArchivedMessages 移除会话中游标及之前的消息
+func removeArchivedMessages(sessionStore *store.SessionStore, sessionID, cursor string) error {
+	return sessionStore.ModifySession(sessionID, func(session *models.Session) error {
+		if index := messageIndex(session.Messages, cursor); index >= 0 {
+			session.Messages = session.Messages[index+1:]
+		}
+		return nil
+	})
+}
+
+// messageIndex 查找消息ID在消息列表中的位置，不存在时返回-1
+func messageIndex(messages []*models.Message, messageID string) int {
+	if messageID == "" {
+		return -1
+	}
+	for i, message := range messages {
+		if message.ID == messageID {
+			return i
+		}
+	}
+	return -1
+}
+
+// acquireArchive 标记会话的归档任务开始，已在进行时返回false
+func (s *ContextService) acquireArchive(key string) bool {
+	s.archiveMutex.Lock()
+	defer s.archiveMutex.Unlock()
+
+	if s.archiveRunning == nil {
+		s.archiveRunning = make(map[string]bool)
+	}
+	if s.archiveRunning[key] {
+		return false
+	}
+	s.archiveRunning[key] = true
+	return true
+}
+
+// releaseArchive 清除会话的归档任务标记
+func (s *ContextService) releaseArchive(key string) {
+	s.archiveMutex.Lock()
+	defer s.archiveMutex.Unlock()
+	delete(s.archiveRunning, key)
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestArchiveSessionOverflow 测试超出上限的最旧消息汇总为长期记忆后移出会话，游标记录在元数据中且重复执行不会再次归档
+func TestArchiveSessionOverflow(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	session := models.NewSession("s1")
+	session.Metadata = map[string]interface{}{"userId": "user_a"}
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+	messages := make([]*models.Message, 0, 5)
+	for i := 1; i <= 5; i++ {
+		message := models.NewMessage("s1", "user", fmt.Sprintf("第%d条消息：排查登录超时", i), "text", "P2", nil)
+		message.ID = fmt.Sprintf("msg-%d", i)
+		messages = append(messages, message)
+	}
+	if err := sessionStore.StoreMessages("s1", messages); err != nil {
+		t.Fatalf("存储消息失败: %v", err)
+	}
+
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+
+	archived, err := service.archiveSessionOverflow(context.Background(), sessionStore, "s1", 2)
+	if err != nil {
+		t.Fatalf("归档失败: %v", err)
+	}
+	if archived != 3 || vectorStore.Len() != 1 {
+		t.Fatalf("应归档3条消息并生成1条长期记忆，实际归档%d条, 记忆%d条", archived, vectorStore.Len())
+	}
+
+	snapshot, err := sessionStore.GetSessionSnapshot("s1")
+	if err != nil {
+		t.Fatalf("获取会话失败: %v", err)
+	}
+	if len(snapshot.Messages) != 2 || snapshot.Messages[0].ID != "msg-4" {
+		t.Errorf("会话应只保留最近2条消息: %+v", snapshot.Messages)
+	}
+	if snapshot.Metadata[metadataArchiveCursor] != "msg-3" || snapshot.Metadata[metadataArchivedCount] != float64(3) {
+		t.Errorf("归档游标记录错误: %v", snapshot.Metadata)
+	}
+
+	// 已归档的消息重新出现在会话中时只移除，不再重复汇总
+	if err := sessionStore.ModifySession("s1", func(session *models.Session) error {
+		session.Messages = append([]*models.Message{messages[2]}, session.Messages...)
+		return nil
+	}); err != nil {
+		t.Fatalf("修改会话失败: %v", err)
+	}
+	archived, err = service.archiveSessionOverflow(context.Background(), sessionStore, "s1", 2)
+	if err != nil || archived != 0 || vectorStore.Len() != 1 {
+		t.Errorf("重复执行不应再次归档: archived=%d, 记忆%d条, err=%v", archived, vectorStore.Len(), err)
+	}
+	if remaining, _ := sessionStore.GetMessages("s1", 0); len(remaining) != 2 {
+		t.Errorf("游标之前的消息应被移除，剩余%d条", len(remaining))
+	}
+}
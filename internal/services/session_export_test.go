@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// newSessionExportTestService 创建使用内存向量存储和临时用户会话存储的服务，user_a名下有会话s1，
+// 向量存储中有s1的一条长期记忆、一条消息记录和一条其他用户的记忆
+func newSessionExportTestService(t *testing.T) (*ContextService, *vectorstore.InMemoryVectorStore) {
+	t.Helper()
+	service := &ContextService{
+		config:             &config.Config{},
+		userSessionManager: store.NewUserSessionManager(t.TempDir()),
+	}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+
+	session := models.NewSession("s1")
+	session.Metadata = map[string]interface{}{"userId": "user_a", "title": "登录问题排查"}
+	session.Messages = []*models.Message{
+		models.NewMessage("s1", models.RoleUser, "登录超时怎么排查", "text", "P2", map[string]interface{}{"userId": "user_a"}),
+	}
+	saveUserSession(t, service, "user_a", session)
+
+	add := func(id, userID, content string) {
+		memory := models.NewMemory("s1", content, "P1", map[string]interface{}{"userId": userID})
+		memory.ID = id
+		memory.UserID = userID
+		memory.Vector, _ = vectorStore.GenerateEmbedding(content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+	add("m1", "user_a", "登录超时是连接池耗尽导致的")
+	add("m2", "user_b", "其他用户的记忆")
+	message := models.NewMessage("s1", models.RoleUser, "登录超时怎么排查", "text", "P2", nil)
+	message.Vector, _ = vectorStore.GenerateEmbedding(message.Content)
+	if err := vectorStore.StoreMessage(message); err != nil {
+		t.Fatalf("StoreMessage failed: %v", err)
+	}
+	return service, vectorStore
+}
+
+// saveUserSession 把会话写入指定用户的会话存储
+func saveUserSession(t *testing.T, service *ContextService, userID string, session *models.Session) {
+	t.Helper()
+	userStore, err := service.GetUserSessionStore(userID)
+	if err != nil {
+		t.Fatalf("获取用户会话存储失败: %v", err)
+	}
+	if err := userStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+}
+
+// TestExportImportSessionRoundTrip 测试导出的数据经JSON序列化后导入到其他用户名下：会话内容和长期记忆完整恢复，
+// 用户ID重映射为导入者；导出只包含本用户的长期记忆，不重复包含消息记录；已存在的会话需要force才能覆盖
+func TestExportImportSessionRoundTrip(t *testing.T) {
+	service, vectorStore := newSessionExportTestService(t)
+	ctx := context.Background()
+
+	export, err := service.ExportSession(ctx, "user_a", "s1")
+	if err != nil {
+		t.Fatalf("ExportSession failed: %v", err)
+	}
+	if len(export.Memories) != 1 || export.Memories[0].ID != "m1" || len(export.Session.Messages) != 1 {
+		t.Fatalf("导出应包含会话消息和本用户的1条长期记忆: %+v", export.Memories)
+	}
+
+	encoded, err := json.Marshal(export)
+	if err != nil {
+		t.Fatalf("序列化导出数据失败: %v", err)
+	}
+	data, err := ParseSessionExport(string(encoded))
+	if err != nil {
+		t.Fatalf("ParseSessionExport failed: %v", err)
+	}
+
+	response, err := service.ImportSession(ctx, models.ImportSessionRequest{UserID: "user_c", Data: data, TargetSessionID: "s2"})
+	if err != nil {
+		t.Fatalf("ImportSession failed: %v", err)
+	}
+	if response.SessionID != "s2" || response.MessageCount != 1 || response.MemoriesRestored != 1 || response.Overwritten {
+		t.Errorf("导入结果错误: %+v", response)
+	}
+
+	userStore, _ := service.GetUserSessionStore("user_c")
+	imported, err := userStore.GetSessionSnapshot("s2")
+	if err != nil {
+		t.Fatalf("导入的会话不存在: %v", err)
+	}
+	if imported.Metadata["userId"] != "user_c" || imported.Metadata["title"] != "登录问题排查" {
+		t.Errorf("会话元数据应保留并重映射用户: %v", imported.Metadata)
+	}
+	if len(imported.Messages) != 1 || imported.Messages[0].SessionID != "s2" || imported.Messages[0].Metadata["userId"] != "user_c" {
+		t.Errorf("消息应重映射会话和用户: %+v", imported.Messages)
+	}
+
+	// m1属于user_a，以新ID写入user_c名下，原记录不受影响
+	original, _ := vectorStore.SearchByID(ctx, "m1", nil)
+	if len(original) != 1 || getResultUserID(original[0]) != "user_a" {
+		t.Errorf("原记忆不应被覆盖: %+v", original)
+	}
+	restored, err := vectorStore.SearchByFilter(ctx, `session_id="s2"`, &models.SearchOptions{Limit: 10, UserID: "user_c"})
+	if err != nil || len(restored) != 1 || restored[0].ID == "m1" || restored[0].Fields["content"] != "登录超时是连接池耗尽导致的" {
+		t.Errorf("长期记忆应以新ID恢复到user_c名下: %+v, %v", restored, err)
+	}
+
+	// 再次导入到同一会话需要force
+	if _, err := service.ImportSession(ctx, models.ImportSessionRequest{UserID: "user_c", Data: data, TargetSessionID: "s2"}); !errors.Is(err, store.ErrSessionExists) {
+		t.Errorf("会话已存在时应拒绝导入: %v", err)
+	}
+	response, err = service.ImportSession(ctx, models.ImportSessionRequest{UserID: "user_c", Data: data, TargetSessionID: "s2", Force: true})
+	if err != nil || !response.Overwritten {
+		t.Errorf("force时应覆盖已有会话: %+v, %v", response, err)
+	}
+}
+
+// TestExportImportSessionOwnership 测试不能导出其他用户的会话，导入时即使force也不能覆盖其他用户的会话
+func TestExportImportSessionOwnership(t *testing.T) {
+	service, _ := newSessionExportTestService(t)
+	ctx := context.Background()
+
+	// user_b的存储中没有s1
+	if _, err := service.ExportSession(ctx, "user_b", "s1"); err == nil {
+		t.Error("不应导出其他用户存储中的会话")
+	}
+
+	// user_b的存储中有一个属于user_a的会话
+	foreign := models.NewSession("foreign")
+	foreign.Metadata = map[string]interface{}{"userId": "user_a"}
+	saveUserSession(t, service, "user_b", foreign)
+	if _, err := service.ExportSession(ctx, "user_b", "foreign"); err == nil {
+		t.Error("会话归属其他用户时不应导出")
+	}
+
+	export, err := service.ExportSession(ctx, "user_a", "s1")
+	if err != nil {
+		t.Fatalf("ExportSession failed: %v", err)
+	}
+	_, err = service.ImportSession(ctx, models.ImportSessionRequest{UserID: "user_b", Data: export, TargetSessionID: "foreign", Force: true})
+	if err == nil {
+		t.Fatal("不应覆盖其他用户的会话")
+	}
+	userStore, _ := service.GetUserSessionStore("user_b")
+	if existing, _ := userStore.GetSessionSnapshot("foreign"); existing == nil || existing.Metadata["userId"] != "user_a" || len(existing.Messages) != 0 {
+		t.Errorf("被拒绝的导入不应修改原会话: %+v", existing)
+	}
+}
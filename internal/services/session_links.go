@@ -0,0 +1,185 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// inverseSessionRelations 建立关联时可选的关系及其在对方会话上记录的反向关系
+var inverseSessionRelations = map[string]string{
+	models.SessionRelationContinues:  models.SessionRelationContinuedBy,
+	models.SessionRelationRelated:    models.SessionRelationRelated,
+	models.SessionRelationForkedFrom: models.SessionRelationForkedInto,
+}
+
+// LinkSessions 在两个会话之间建立带类型的关联，双向记录在会话元数据的linked_sessions中
+// 两个会话都必须属于当前用户；不允许关联自身，已关联的会话不会重复关联。任一写入失败时撤销已写入的关联
+func (s *ContextService) LinkSessions(req models.LinkSessionsRequest) (*models.LinkSessionsResponse, error) {
+	if req.UserID == "" {
+		return nil, apperrors.ErrUserNotInitialized
+	}
+	if req.SourceSessionID == "" || req.TargetSessionID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("sourceSessionId和targetSessionId不能为空")
+	}
+	if req.SourceSessionID == req.TargetSessionID {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("不能将会话关联到自身: %s", req.SourceSessionID)
+	}
+	if req.Relationship == "" {
+		req.Relationship = models.SessionRelationRelated
+	}
+	inverse, ok := inverseSessionRelations[req.Relationship]
+	if !ok {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("不支持的关联类型: %s，可选: %s, %s, %s", req.Relationship,
+			models.SessionRelationContinues, models.SessionRelationRelated, models.SessionRelationForkedFrom)
+	}
+
+	userSessionStore, err := s.GetUserSessionStore(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户会话存储失败: %w", err)
+	}
+	stores := []*store.SessionStore{userSessionStore}
+	if s.sessionStore != nil && s.sessionStore != userSessionStore {
+		stores = append(stores, s.sessionStore)
+	}
+
+	// 会话可能同时存在于用户会话存储和全局会话存储中，两处都记录关联
+	holders := make(map[string][]*store.SessionStore, 2)
+	for _, sessionID := range []string{req.SourceSessionID, req.TargetSessionID} {
+		other := req.TargetSessionID
+		if sessionID == req.TargetSessionID {
+			other = req.SourceSessionID
+		}
+		for _, sessionStore := range stores {
+			session, err := sessionStore.GetSessionSnapshot(sessionID)
+			if err != nil {
+				continue
+			}
+			if ownerID, _ := session.Metadata["userId"].(string); ownerID != "" && ownerID != req.UserID {
+				return nil, fmt.Errorf("无权关联其他用户的会话: %s", sessionID)
+			}
+			if hasSessionLink(session, other) {
+				return nil, apperrors.ErrInvalidArgument.WithMessagef("会话%s与%s已关联", req.SourceSessionID, req.TargetSessionID)
+			}
+			holders[sessionID] = append(holders[sessionID], sessionStore)
+		}
+		if len(holders[sessionID]) == 0 {
+			return nil, apperrors.ErrSessionNotFound.WithMessagef("会话不存在: %s", sessionID)
+		}
+	}
+
+	now := time.Now().Unix()
+	topics := normalizeLinkTopics(req.Topics)
+	sourceLink := models.SessionReference{SessionID: req.TargetSessionID, Relationship: req.Relationship,
+		Description: req.Description, Timestamp: now, Topics: topics}
+	targetLink := models.SessionReference{SessionID: req.SourceSessionID, Relationship: inverse,
+		Description: req.Description, Timestamp: now, Topics: topics}
+
+	type appliedLink struct {
+		sessionStore *store.SessionStore
+		sessionID    string
+		linkedID     string
+	}
+	var applied []appliedLink
+	for _, write := range []struct {
+		sessionID string
+		link      models.SessionReference
+	}{{req.SourceSessionID, sourceLink}, {req.TargetSessionID, targetLink}} {
+		for _, sessionStore := range holders[write.sessionID] {
+			if err := appendSessionLink(sessionStore, write.sessionID, write.link); err != nil {
+				for _, done := range applied {
+					if rollbackErr := removeSessionLink(done.sessionStore, done.sessionID, done.linkedID); rollbackErr != nil {
+						log.Printf("⚠️ [会话关联] 撤销会话%s的关联失败: %v", done.sessionID, rollbackErr)
+					}
+				}
+				return nil, fmt.Errorf("记录会话关联失败: %w", err)
+			}
+			applied = append(applied, appliedLink{sessionStore, write.sessionID, write.link.SessionID})
+		}
+	}
+
+	log.Printf("🔗 [会话关联] %s -[%s]-> %s, 用户=%s", req.SourceSessionID, req.Relationship, req.TargetSessionID, req.UserID)
+	return &models.LinkSessionsResponse{
+		SourceSessionID: req.SourceSessionID,
+		TargetSessionID: req.TargetSessionID,
+		SourceLink:      sourceLink,
+		TargetLink:      targetLink,
+	}, nil
+}
+
+// hasSessionLink 判断会话是否已关联到另一个会话
+func hasSessionLink(session *models.Session, linkedID string) bool {
+	links, _ := session.Metadata[models.SessionMetadataLinkedSessions].([]interface{})
+	for _, link := range links {
+		if linkMap, ok := link.(map[string]interface{}); ok && getStringFromMap(linkMap, "session_id", "") == linkedID {
+			return true
+		}
+	}
+	return false
+}
+
+// appendSessionLink 在会话元数据中追加一条关联，字段与buildProgrammingContext读取的格式一致
+func appendSessionLink(sessionStore *store.SessionStore, sessionID string, link models.SessionReference) error {
+	return sessionStore.ModifySession(sessionID, func(session *models.Session) error {
+		if session.Metadata == nil {
+			session.Metadata = make(map[string]interface{})
+		}
+		if hasSessionLink(session, link.SessionID) {
+			return apperrors.ErrInvalidArgument.WithMessagef("会话%s与%s已关联", sessionID, link.SessionID)
+		}
+		entry := map[string]interface{}{
+			"session_id":   link.SessionID,
+			"relationship": link.Relationship,
+			"timestamp":    link.Timestamp,
+		}
+		if link.Description != "" {
+			entry["description"] = link.Description
+		}
+		if len(link.Topics) > 0 {
+			topics := make([]interface{}, len(link.Topics))
+			for i, topic := range link.Topics {
+				topics[i] = topic
+			}
+			entry["topics"] = topics
+		}
+		links, _ := session.Metadata[models.SessionMetadataLinkedSessions].([]interface{})
+		session.Metadata[models.SessionMetadataLinkedSessions] = append(links, entry)
+		return nil
+	})
+}
+
+// removeSessionLink 删除会话元数据中指向另一个会话的关联
+func removeSessionLink(sessionStore *store.SessionStore, sessionID, linkedID string) error {
+	return sessionStore.ModifySession(sessionID, func(session *models.Session) error {
+		links, _ := session.Metadata[models.SessionMetadataLinkedSessions].([]interface{})
+		kept := make([]interface{}, 0, len(links))
+		for _, link := range links {
+			if linkMap, ok := link.(map[string]interface{}); ok && getStringFromMap(linkMap, "session_id", "") == linkedID {
+				continue
+			}
+			kept = append(kept, link)
+		}
+		session.Metadata[models.SessionMetadataLinkedSessions] = kept
+		return nil
+	})
+}
+
+// normalizeLinkTopics 去除主题中的空白项和重复项
+func normalizeLinkTopics(topics []string) []string {
+	seen := make(map[string]bool, len(topics))
+	var normalized []string
+	for _, topic := range topics {
+		topic = strings.TrimSpace(topic)
+		if topic == "" || seen[topic] {
+			continue
+		}
+		seen[topic] = true
+		normalized = append(normalized, topic)
+	}
+	return normalized
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// TestLinkSessions 测试关联双向记录并能被编程上下文读取，拒绝自关联、重复关联、未知关系和其他用户的会话
+func TestLinkSessions(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	service := &ContextService{
+		sessionStore:       sessionStore,
+		userSessionManager: store.NewUserSessionManager(t.TempDir()),
+		config:             &config.Config{},
+	}
+	now := time.Now()
+	for id, owner := range map[string]string{"s1": "user_a", "s2": "user_a", "other": "user_b"} {
+		session := &models.Session{ID: id, CreatedAt: now, LastActive: now, Status: "active",
+			Metadata: map[string]interface{}{"userId": owner}}
+		if _, err := sessionStore.ImportSession(session, false); err != nil {
+			t.Fatalf("导入会话失败: %v", err)
+		}
+	}
+
+	result, err := service.LinkSessions(models.LinkSessionsRequest{UserID: "user_a", SourceSessionID: "s2", TargetSessionID: "s1",
+		Relationship: models.SessionRelationContinues, Description: "继续缓存重构", Topics: []string{"cache", " cache ", ""}})
+	if err != nil {
+		t.Fatalf("关联会话失败: %v", err)
+	}
+	if result.TargetLink.Relationship != models.SessionRelationContinuedBy || len(result.SourceLink.Topics) != 1 {
+		t.Errorf("目标会话应记录反向关系并去重主题: %+v", result)
+	}
+
+	progContext, err := service.buildProgrammingContext(context.Background(), "s1", "")
+	if err != nil {
+		t.Fatalf("获取编程上下文失败: %v", err)
+	}
+	if len(progContext.LinkedSessions) != 1 || progContext.LinkedSessions[0].SessionID != "s2" ||
+		progContext.LinkedSessions[0].Relationship != models.SessionRelationContinuedBy || progContext.LinkedSessions[0].Topics[0] != "cache" {
+		t.Errorf("编程上下文应返回关联会话: %+v", progContext.LinkedSessions)
+	}
+
+	for name, req := range map[string]models.LinkSessionsRequest{
+		"重复关联":  {UserID: "user_a", SourceSessionID: "s1", TargetSessionID: "s2"},
+		"自关联":   {UserID: "user_a", SourceSessionID: "s1", TargetSessionID: "s1"},
+		"未知关系":  {UserID: "user_a", SourceSessionID: "s1", TargetSessionID: "s2", Relationship: "duplicates"},
+		"其他用户":  {UserID: "user_a", SourceSessionID: "s1", TargetSessionID: "other"},
+		"会话不存在": {UserID: "user_a", SourceSessionID: "s1", TargetSessionID: "missing"},
+	} {
+		if _, err := service.LinkSessions(req); err == nil {
+			t.Errorf("%s应返回错误", name)
+		}
+	}
+	snapshot, _ := sessionStore.GetSessionSnapshot("other")
+	if hasSessionLink(snapshot, "s1") {
+		t.Error("失败的关联不应写入会话元数据")
+	}
+}
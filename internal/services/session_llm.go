@@ -0,0 +1,137 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/llm"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// protectedSessionMetadataKeys 由服务维护的会话元数据，不允许通过update操作修改
+var protectedSessionMetadataKeys = map[string]bool{
+	"userId":                         true,
+	"workspaceHash":                  true,
+	models.SessionMetadataPinned:     true,
+	models.SessionMetadataMergedInto: true,
+}
+
+// validateLLMProvider 检查LLM提供商是否受支持
+func validateLLMProvider(provider string) error {
+	switch llm.LLMProvider(provider) {
+	case llm.ProviderDeepSeek, llm.ProviderOpenAI, llm.ProviderClaude, llm.ProviderQianwen, llm.ProviderOllamaLocal:
+		return nil
+	default:
+		return apperrors.ErrInvalidArgument.WithMessagef("不支持的LLM提供商: %s", provider)
+	}
+}
+
+// UpdateSessionMetadata 合并更新会话元数据，值为null的键会被删除
+// llmProvider/llmModel为会话级LLM覆盖配置，写入前校验提供商；只设置模型时要求会话已有或同时设置提供商
+func (s *ContextService) UpdateSessionMetadata(userID, sessionID string, metadata map[string]interface{}) (map[string]interface{}, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	if sessionID == "" {
+		return nil, fmt.Errorf("会话ID不能为空")
+	}
+	if len(metadata) == 0 {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("metadata不能为空")
+	}
+	for key, value := range metadata {
+		if protectedSessionMetadataKeys[key] {
+			return nil, apperrors.ErrInvalidArgument.WithMessagef("会话元数据%s不允许修改", key)
+		}
+		if key != models.SessionMetadataLLMProvider && key != models.SessionMetadataLLMModel || value == nil {
+			continue
+		}
+		text, ok := value.(string)
+		if !ok || strings.TrimSpace(text) == "" {
+			return nil, apperrors.ErrInvalidArgument.WithMessagef("%s必须是非空字符串，清除覆盖请传null", key)
+		}
+		if key == models.SessionMetadataLLMProvider {
+			if err := validateLLMProvider(text); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	userSessionStore, err := s.GetUserSessionStore(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户会话存储失败: %w", err)
+	}
+
+	var updatedMetadata map[string]interface{}
+	for _, sessionStore := range []*store.SessionStore{userSessionStore, s.sessionStore} {
+		if sessionStore == nil {
+			continue
+		}
+		session, err := sessionStore.GetSessionSnapshot(sessionID)
+		if err != nil {
+			continue
+		}
+		if ownerID, _ := session.Metadata["userId"].(string); ownerID != "" && ownerID != userID {
+			return nil, fmt.Errorf("无权修改其他用户的会话: %s", sessionID)
+		}
+		if err := sessionStore.ModifySession(sessionID, func(session *models.Session) error {
+			merged := make(map[string]interface{}, len(session.Metadata)+len(metadata))
+			for key, value := range session.Metadata {
+				merged[key] = value
+			}
+			for key, value := range metadata {
+				if value == nil {
+					delete(merged, key)
+				} else {
+					merged[key] = value
+				}
+			}
+			if _, hasModel := merged[models.SessionMetadataLLMModel]; hasModel {
+				if _, hasProvider := merged[models.SessionMetadataLLMProvider]; !hasProvider {
+					return apperrors.ErrInvalidArgument.WithMessagef("设置llmModel时必须同时设置llmProvider")
+				}
+			}
+			session.Metadata = merged
+			updatedMetadata = merged
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if updatedMetadata == nil {
+		return nil, apperrors.ErrSessionNotFound.WithMessagef("会话不存在: %s", sessionID)
+	}
+	log.Printf("[上下文服务] 会话元数据已更新: sessionID=%s, userID=%s, keys=%d", sessionID, userID, len(metadata))
+	return updatedMetadata, nil
+}
+
+// sessionLLMConfig 获取会话使用的LLM提供商和模型
+// 会话元数据中设置了llmProvider时优先使用，未指定模型且提供商与全局不同时模型留空，由客户端使用提供商默认模型
+func (s *ContextService) sessionLLMConfig(sessionID string) (string, string) {
+	provider, model := s.config.MultiDimLLMProvider, s.config.MultiDimLLMModel
+	if s.sessionStore == nil || sessionID == "" {
+		return provider, model
+	}
+	session, err := s.sessionStore.GetSessionSnapshot(sessionID)
+	if err != nil {
+		return provider, model
+	}
+
+	overrideProvider, _ := session.Metadata[models.SessionMetadataLLMProvider].(string)
+	if overrideProvider == "" {
+		return provider, model
+	}
+	if err := validateLLMProvider(overrideProvider); err != nil {
+		log.Printf("⚠️ [LLM客户端] 会话 %s 的LLM覆盖配置无效，使用全局配置: %v", sessionID, err)
+		return provider, model
+	}
+	overrideModel, _ := session.Metadata[models.SessionMetadataLLMModel].(string)
+	if overrideModel == "" && overrideProvider == provider {
+		overrideModel = model
+	}
+	log.Printf("🔀 [LLM客户端] 会话 %s 使用LLM覆盖配置: 提供商=%s, 模型=%s", sessionID, overrideProvider, overrideModel)
+	return overrideProvider, overrideModel
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// TestSessionLLMOverride 测试会话元数据中的LLM覆盖配置在写入时校验，并在存储分析链路中优先于全局配置
+func TestSessionLLMOverride(t *testing.T) {
+	baseDir := t.TempDir()
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	service := &ContextService{
+		sessionStore:       sessionStore,
+		userSessionManager: store.NewUserSessionManager(baseDir),
+		config:             &config.Config{MultiDimLLMProvider: "deepseek", MultiDimLLMModel: "deepseek-chat"},
+	}
+	now := time.Now()
+	session := &models.Session{ID: "s1", CreatedAt: now, LastActive: now, Status: "active",
+		Metadata: map[string]interface{}{"userId": "user_a", "project": "demo"}}
+	if _, err := sessionStore.ImportSession(session, false); err != nil {
+		t.Fatalf("导入会话失败: %v", err)
+	}
+
+	if provider, model := service.sessionLLMConfig("s1"); provider != "deepseek" || model != "deepseek-chat" {
+		t.Fatalf("未设置覆盖时应使用全局配置: %s/%s", provider, model)
+	}
+
+	if _, err := service.UpdateSessionMetadata("user_a", "s1", map[string]interface{}{models.SessionMetadataLLMProvider: "gemini"}); err == nil {
+		t.Error("不支持的提供商应被拒绝")
+	}
+	if _, err := service.UpdateSessionMetadata("user_a", "s1", map[string]interface{}{models.SessionMetadataLLMModel: "gpt-4o"}); err == nil {
+		t.Error("只设置模型时应要求同时设置提供商")
+	}
+	if _, err := service.UpdateSessionMetadata("user_a", "s1", map[string]interface{}{"userId": "user_b"}); err == nil {
+		t.Error("服务维护的元数据不允许修改")
+	}
+	if _, err := service.UpdateSessionMetadata("user_b", "s1", map[string]interface{}{"project": "x"}); err == nil {
+		t.Error("不应允许修改其他用户的会话")
+	}
+
+	metadata, err := service.UpdateSessionMetadata("user_a", "s1", map[string]interface{}{
+		models.SessionMetadataLLMProvider: "openai",
+		models.SessionMetadataLLMModel:    "gpt-4o",
+	})
+	if err != nil {
+		t.Fatalf("更新会话元数据失败: %v", err)
+	}
+	if metadata["project"] != "demo" || metadata["userId"] != "user_a" {
+		t.Errorf("更新应合并而不是替换原有元数据: %v", metadata)
+	}
+	if provider, model := service.sessionLLMConfig("s1"); provider != "openai" || model != "gpt-4o" {
+		t.Errorf("应使用会话覆盖配置: %s/%s", provider, model)
+	}
+
+	if _, err := service.UpdateSessionMetadata("user_a", "s1", map[string]interface{}{
+		models.SessionMetadataLLMProvider: nil,
+		models.SessionMetadataLLMModel:    nil,
+	}); err != nil {
+		t.Fatalf("清除覆盖配置失败: %v", err)
+	}
+	if provider, model := service.sessionLLMConfig("s1"); provider != "deepseek" || model != "deepseek-chat" {
+		t.Errorf("清除覆盖后应回退到全局配置: %s/%s", provider, model)
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 会话合并时读取的向量记录上限，超出时拒绝合并以免只迁移一部分
+const maxSessionMergeRecords = 1000
+
+// MergeSessions 将源会话的消息、代码上下文、编辑历史和长期记忆并入目标会话，并归档源会话
+// 先改挂向量存储中的记录，任一步失败时把已改挂的记录恢复到源会话，不留下只合并了一半的数据
+func (s *ContextService) MergeSessions(ctx context.Context, req models.MergeSessionsRequest) (*models.MergeSessionsResponse, error) {
+	if req.UserID == "" {
+		return nil, apperrors.ErrUserNotInitialized
+	}
+	if req.TargetSessionID == "" || req.SourceSessionID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("targetSessionId和sourceSessionId不能为空")
+	}
+	if req.TargetSessionID == req.SourceSessionID {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("不能将会话合并到自身: %s", req.SourceSessionID)
+	}
+
+	log.Printf("🔀 [会话合并] 开始合并: %s -> %s, 用户=%s", req.SourceSessionID, req.TargetSessionID, req.UserID)
+
+	userSessionStore, err := s.GetUserSessionStore(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户会话存储失败: %w", err)
+	}
+
+	// 两个会话都必须属于当前用户
+	for _, sessionID := range []string{req.TargetSessionID, req.SourceSessionID} {
+		session, err := userSessionStore.GetSessionSnapshot(sessionID)
+		if err != nil {
+			return nil, apperrors.ErrSessionNotFound.WithMessagef("会话不存在: %s", sessionID)
+		}
+		if ownerID, _ := session.Metadata["userId"].(string); ownerID != "" && ownerID != req.UserID {
+			return nil, fmt.Errorf("无权合并其他用户的会话: %s", sessionID)
+		}
+	}
+
+	records, err := s.searchBySessionID(ctx, req.SourceSessionID, maxSessionMergeRecords)
+	if err != nil {
+		return nil, fmt.Errorf("查询源会话向量记录失败: %w", err)
+	}
+	if len(records) >= maxSessionMergeRecords {
+		return nil, fmt.Errorf("源会话的向量记录数达到上限 %d，无法完整合并", maxSessionMergeRecords)
+	}
+
+	// 部分向量存储不支持按用户过滤，他人的记录不迁移
+	owned := records[:0]
+	for _, record := range records {
+		if ownerID := getResultUserID(record); ownerID == "" || ownerID == req.UserID {
+			owned = append(owned, record)
+		}
+	}
+
+	var moved []models.SearchResult
+	mergedMemories := 0
+	for _, record := range owned {
+		if err := s.reparentRecord(ctx, record, req.TargetSessionID); err != nil {
+			s.rollbackReparentedRecords(ctx, moved, req.SourceSessionID)
+			return nil, fmt.Errorf("迁移向量记录 %s 失败，已回滚 %d 条已迁移记录: %w", record.ID, len(moved), err)
+		}
+		moved = append(moved, record)
+		if role, _ := record.Fields["role"].(string); role == "" {
+			mergedMemories++
+		}
+	}
+
+	merged, err := userSessionStore.MergeSessions(req.TargetSessionID, req.SourceSessionID)
+	if err != nil {
+		s.rollbackReparentedRecords(ctx, moved, req.SourceSessionID)
+		return nil, fmt.Errorf("合并会话文件失败，已回滚 %d 条向量记录: %w", len(moved), err)
+	}
+
+	log.Printf("✅ [会话合并] 合并完成: %s -> %s, 消息=%d, 长期记忆=%d, 向量记录=%d",
+		req.SourceSessionID, req.TargetSessionID, merged.Messages, mergedMemories, len(moved))
+
+	return &models.MergeSessionsResponse{
+		TargetSessionID: req.TargetSessionID,
+		SourceSessionID: req.SourceSessionID,
+		MergedMessages:  merged.Messages,
+		MergedMemories:  mergedMemories,
+		MergedEdits:     merged.Edits,
+		MergedCodeFiles: merged.CodeFiles,
+		SourceArchived:  true,
+		Session:         merged.Session,
+	}, nil
+}
+
+// rollbackReparentedRecords 把已迁移的向量记录恢复到源会话，失败的记录只记录日志
+func (s *ContextService) rollbackReparentedRecords(ctx context.Context, moved []models.SearchResult, sessionID string) {
+	for _, record := range moved {
+		if err := s.reparentRecord(ctx, record, sessionID); err != nil {
+			log.Printf("❌ [会话合并] 回滚向量记录 %s 失败: %v", record.ID, err)
+		}
+	}
+}
+
+// reparentRecord 以原ID将向量记录改写到指定会话
+func (s *ContextService) reparentRecord(ctx context.Context, record models.SearchResult, sessionID string) error {
+	return s.rewriteRecord(ctx, record, record.ID, func() error {
+		return s.storeRecordInSession(ctx, record, sessionID)
+	})
+}
+
+// storeRecordInSession 按记录类型重建消息或记忆并写入指定会话
+func (s *ContextService) storeRecordInSession(ctx context.Context, record models.SearchResult, sessionID string) error {
+	content, _ := record.Fields["content"].(string)
+	priority, _ := record.Fields["priority"].(string)
+	metadata := parseResultMetadata(record)
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+
+	var timestamp int64
+	if value, ok := record.Fields["timestamp"].(float64); ok && value > 0 {
+		timestamp = int64(value)
+	}
+
+	vector, err := s.generateEmbedding(content)
+	if err != nil {
+		return fmt.Errorf("生成向量失败: %w", err)
+	}
+
+	if role, _ := record.Fields["role"].(string); role != "" {
+		contentType, _ := record.Fields["content_type"].(string)
+		message := models.NewMessage(sessionID, role, content, contentType, priority, metadata)
+		message.ID = record.ID
+		if messageID, ok := record.Fields["message_id"].(string); ok && messageID != "" {
+			message.ID = messageID
+		}
+		if timestamp > 0 {
+			message.Timestamp = timestamp
+		}
+		message.Vector = vector
+
+		if err := s.storeMessage(message); err != nil {
+			return fmt.Errorf("写入消息失败: %w", err)
+		}
+		return nil
+	}
+
+	// 以原记录ID写入（batchId存储的记录保留原始memory_id）
+	memory := models.NewMemory(sessionID, content, priority, metadata)
+	memory.ID = record.ID
+	if memoryID, ok := record.Fields["memory_id"].(string); ok && memoryID != "" {
+		memory.ID = memoryID
+	}
+	if timestamp > 0 {
+		memory.Timestamp = timestamp
+	}
+	memory.BizType = getResultBizType(record)
+	memory.UserID = getResultUserID(record)
+	memory.Vector = vector
+
+	if err := s.storeMemoryWithRetry(ctx, memory); err != nil {
+		return fmt.Errorf("写入记忆失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// mergeTestStore 按记录ID保存写入结果的向量存储，未覆盖的方法不会被调用
+type mergeTestStore struct {
+	models.VectorStore
+	records  []models.SearchResult
+	sessions map[string]string // 记录ID -> 最后写入的会话ID
+	failOnID string
+}
+
+func (f *mergeTestStore) GetProvider() models.VectorStoreType { return models.VectorStoreTypeQdrant }
+
+func (f *mergeTestStore) GenerateEmbedding(text string) ([]float32, error) {
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func (f *mergeTestStore) SearchByFilter(ctx context.Context, filter string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	return append([]models.SearchResult(nil), f.records...), nil
+}
+
+func (f *mergeTestStore) StoreMemory(memory *models.Memory) error {
+	if memory.ID == f.failOnID {
+		return errors.New("写入失败")
+	}
+	f.sessions[memory.ID] = memory.SessionID
+	return nil
+}
+
+func (f *mergeTestStore) StoreMessage(message *models.Message) error {
+	f.sessions[message.ID] = message.SessionID
+	return nil
+}
+
+// newMergeTestService 创建包含两个用户会话的服务
+func newMergeTestService(t *testing.T, vectorStore *mergeTestStore) (*ContextService, *store.SessionStore) {
+	baseDir := t.TempDir()
+	service := &ContextService{
+		vectorStore:        vectorStore,
+		userSessionManager: store.NewUserSessionManager(baseDir),
+		config:             &config.Config{StoragePath: baseDir, StoreRetryMaxAttempts: 1},
+	}
+	sessionStore, err := service.GetUserSessionStore("user_a")
+	if err != nil {
+		t.Fatalf("GetUserSessionStore failed: %v", err)
+	}
+
+	now := time.Now()
+	for _, session := range []*models.Session{
+		{ID: "target", CreatedAt: now, LastActive: now, Status: "active",
+			Metadata:    map[string]interface{}{"userId": "user_a"},
+			Messages:    []*models.Message{{ID: "m1", SessionID: "target", Role: "user", Content: "早", Timestamp: 100}},
+			CodeContext: map[string]*models.CodeFile{"main.go": {Path: "main.go", LastEdit: 100}}},
+		{ID: "source", CreatedAt: now, LastActive: now, Status: "active",
+			Metadata:    map[string]interface{}{"userId": "user_a"},
+			Messages:    []*models.Message{{ID: "m2", SessionID: "source", Role: "user", Content: "晚", Timestamp: 200}},
+			EditHistory: []*models.EditAction{{ID: "e1", FilePath: "main.go", Timestamp: 200}},
+			CodeContext: map[string]*models.CodeFile{"main.go": {Path: "main.go", LastEdit: 200}}},
+	} {
+		if _, err := sessionStore.ImportSession(session, false); err != nil {
+			t.Fatalf("ImportSession failed: %v", err)
+		}
+	}
+	return service, sessionStore
+}
+
+// TestMergeSessions 测试合并后向量记录改挂到目标会话、会话内容合并且源会话归档
+func TestMergeSessions(t *testing.T) {
+	vectorStore := &mergeTestStore{
+		sessions: make(map[string]string),
+		records: []models.SearchResult{
+			{ID: "mem-1", Fields: map[string]interface{}{"content": "记忆", "userId": "user_a", "session_id": "source"}},
+			{ID: "msg-1", Fields: map[string]interface{}{"content": "晚", "role": "user", "session_id": "source", "message_id": "m2"}},
+			{ID: "mem-2", Fields: map[string]interface{}{"content": "他人的记忆", "userId": "user_b", "session_id": "source"}},
+		},
+	}
+	service, sessionStore := newMergeTestService(t, vectorStore)
+
+	result, err := service.MergeSessions(context.Background(), models.MergeSessionsRequest{
+		UserID: "user_a", TargetSessionID: "target", SourceSessionID: "source",
+	})
+	if err != nil {
+		t.Fatalf("MergeSessions failed: %v", err)
+	}
+
+	if result.MergedMessages != 1 || result.MergedMemories != 1 || result.MergedEdits != 1 || !result.SourceArchived {
+		t.Errorf("Unexpected counts: %+v", result)
+	}
+	if vectorStore.sessions["mem-1"] != "target" || vectorStore.sessions["m2"] != "target" {
+		t.Errorf("Expected records reparented to target, got %v", vectorStore.sessions)
+	}
+	if _, ok := vectorStore.sessions["mem-2"]; ok {
+		t.Error("Records of other users must not be moved")
+	}
+
+	session := result.Session
+	if len(session.Messages) != 2 || session.Messages[1].ID != "m2" || session.Messages[1].SessionID != "target" {
+		t.Errorf("Expected messages merged in timestamp order, got %+v", session.Messages)
+	}
+	if session.CodeContext["main.go"].LastEdit != 200 {
+		t.Errorf("Expected newer code file to win, got %+v", session.CodeContext["main.go"])
+	}
+	if _, err := sessionStore.GetSessionSnapshot("source"); err == nil {
+		t.Error("Expected source session to be archived")
+	}
+}
+
+// TestMergeSessionsRollsBackOnFailure 测试向量记录迁移失败时已迁移记录恢复到源会话，会话文件不变
+func TestMergeSessionsRollsBackOnFailure(t *testing.T) {
+	vectorStore := &mergeTestStore{
+		sessions: make(map[string]string),
+		failOnID: "mem-2",
+		records: []models.SearchResult{
+			{ID: "mem-1", Fields: map[string]interface{}{"content": "记忆一", "userId": "user_a", "session_id": "source"}},
+			{ID: "mem-2", Fields: map[string]interface{}{"content": "记忆二", "userId": "user_a", "session_id": "source"}},
+		},
+	}
+	service, sessionStore := newMergeTestService(t, vectorStore)
+
+	_, err := service.MergeSessions(context.Background(), models.MergeSessionsRequest{
+		UserID: "user_a", TargetSessionID: "target", SourceSessionID: "source",
+	})
+	if err == nil {
+		t.Fatal("Expected merge to fail")
+	}
+	if vectorStore.sessions["mem-1"] != "source" {
+		t.Errorf("Expected moved record rolled back to source, got %v", vectorStore.sessions)
+	}
+
+	source, err := sessionStore.GetSessionSnapshot("source")
+	if err != nil || len(source.Messages) != 1 {
+		t.Errorf("Expected source session untouched, got %+v, %v", source, err)
+	}
+	if target, _ := sessionStore.GetSessionSnapshot("target"); len(target.Messages) != 1 {
+		t.Errorf("Expected target session untouched, got %d messages", len(target.Messages))
+	}
+
+	if _, err := service.MergeSessions(context.Background(), models.MergeSessionsRequest{
+		UserID: "user_a", TargetSessionID: "target", SourceSessionID: "target",
+	}); err == nil {
+		t.Error("Expected merging a session into itself to fail")
+	}
+}
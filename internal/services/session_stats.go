@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// GetSessionStats 统计会话的记忆分布、token估算和最近活动
+// 记忆分布来自对会话和用户过滤后的单次向量存储扫描，只统计当前用户自己的记录
+func (s *ContextService) GetSessionStats(ctx context.Context, sessionID string) (*models.SessionStats, error) {
+	userID, err := s.GetUserIDFromSessionID(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户ID失败: %w", err)
+	}
+
+	results, err := s.searchSessionMemories(ctx, sessionID, userID, maxListMemoriesScan)
+	if err != nil {
+		return nil, fmt.Errorf("查询会话记忆失败: %w", err)
+	}
+
+	stats := &models.SessionStats{
+		SessionID:       sessionID,
+		ByType:          make(map[string]int),
+		ByPriority:      make(map[string]int),
+		ByStorageEngine: make(map[string]int),
+		Truncated:       len(results) >= maxListMemoriesScan,
+		GeneratedAt:     time.Now().Unix(),
+	}
+	for _, result := range results {
+		// 部分向量存储不支持按会话过滤，这里再次校验会话和用户
+		if resultSessionID, _ := result.Fields["session_id"].(string); resultSessionID != "" && resultSessionID != sessionID {
+			continue
+		}
+		if getResultUserID(result) != userID {
+			continue
+		}
+		if isArchivedResult(result) {
+			stats.ArchivedCount++
+			continue
+		}
+
+		stats.TotalMemories++
+		stats.ByType[getResultMemoryType(result)]++
+		priority, _ := result.Fields["priority"].(string)
+		if priority == "" {
+			priority = models.PriorityP2
+		}
+		stats.ByPriority[priority]++
+		for _, engine := range resultStorageEngines(result) {
+			stats.ByStorageEngine[engine]++
+		}
+
+		content, _ := result.Fields["content"].(string)
+		stats.EstimatedTokens += estimateTokens(content)
+		if timestamp := getResultTimestamp(result); timestamp > 0 {
+			if stats.FirstMemoryAt == 0 || timestamp < stats.FirstMemoryAt {
+				stats.FirstMemoryAt = timestamp
+			}
+			if timestamp > stats.LastMemoryAt {
+				stats.LastMemoryAt = timestamp
+			}
+		}
+	}
+
+	if session := s.sessionStatsSnapshot(userID, sessionID); session != nil {
+		stats.LastActive = session.LastActive
+		stats.Status = session.Status
+		stats.MessageCount = len(session.Messages)
+		for _, message := range session.Messages {
+			stats.MessageTokens += estimateTokens(message.Content)
+		}
+	}
+
+	log.Printf("📊 [会话统计] 会话=%s, 记忆=%d(归档%d), 消息=%d, 类型=%v, 引擎=%v",
+		sessionID, stats.TotalMemories, stats.ArchivedCount, stats.MessageCount, stats.ByType, stats.ByStorageEngine)
+	return stats, nil
+}
+
+// sessionStatsSnapshot 获取会话快照，对话消息保存在用户会话存储中，找不到时回退到全局会话存储
+func (s *ContextService) sessionStatsSnapshot(userID, sessionID string) *models.Session {
+	if s.userSessionManager != nil && userID != "" {
+		if userStore, err := s.userSessionManager.GetUserSessionStore(userID); err == nil {
+			if session, err := userStore.GetSessionSnapshot(sessionID); err == nil && session != nil {
+				return session
+			}
+		}
+	}
+	if s.sessionStore != nil {
+		if session, err := s.sessionStore.GetSessionSnapshot(sessionID); err == nil {
+			return session
+		}
+	}
+	return nil
+}
+
+// withStorageEngines 在metadata中记录计划写入的存储引擎，返回新的metadata，不修改调用方的map
+func withStorageEngines(metadata map[string]interface{}, timeline, knowledge, vector bool) map[string]interface{} {
+	engines := make([]string, 0, 3)
+	if timeline {
+		engines = append(engines, models.StorageEngineTimeline)
+	}
+	if knowledge {
+		engines = append(engines, models.StorageEngineKnowledgeGraph)
+	}
+	if vector {
+		engines = append(engines, models.StorageEngineVector)
+	}
+
+	merged := make(map[string]interface{}, len(metadata)+1)
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	merged[models.MetadataStorageEnginesKey] = engines
+	return merged
+}
+
+// resultStorageEngines 记录写入的存储引擎；未记录时（原有存储逻辑、低置信度仅记录上下文）只写入了向量存储
+func resultStorageEngines(result models.SearchResult) []string {
+	var engines []string
+	switch raw := parseResultMetadata(result)[models.MetadataStorageEnginesKey].(type) {
+	case []string:
+		engines = raw
+	case []interface{}:
+		for _, item := range raw {
+			if engine, ok := item.(string); ok && engine != "" {
+				engines = append(engines, engine)
+			}
+		}
+	}
+	if len(engines) == 0 {
+		return []string{models.StorageEngineVector}
+	}
+	return engines
+}
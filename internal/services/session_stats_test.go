@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestGetSessionStats 测试会话统计按类型、优先级和存储引擎分布，单独计数归档记录，并且不统计其他用户的记录
+func TestGetSessionStats(t *testing.T) {
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	session := models.NewSession("s1")
+	session.Metadata = map[string]interface{}{"userId": "user_a"}
+	session.Messages = []*models.Message{
+		models.NewMessage("s1", "user", "如何调大连接池", "text", "P2", nil),
+		models.NewMessage("s1", "assistant", "修改max_connections", "text", "P2", nil),
+	}
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	service := &ContextService{sessionStore: sessionStore, config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+	storeMemory := func(id, userID, priority string, metadata map[string]interface{}) {
+		memory := models.NewMemory("s1", "数据库连接池配置 "+id, priority, metadata)
+		memory.ID = id
+		memory.UserID = userID
+		memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+	}
+	storeMemory("decision", "user_a", "P1", withStorageEngines(map[string]interface{}{"type": "decision"}, true, true, true))
+	storeMemory("note", "user_a", "P2", map[string]interface{}{"type": "long_term_memory"})
+	storeMemory("old", "user_a", "P3", map[string]interface{}{"type": "long_term_memory", models.MetadataArchivedKey: true})
+	storeMemory("secret", "user_b", "P0", map[string]interface{}{"type": "decision"})
+
+	stats, err := service.GetSessionStats(context.Background(), "s1")
+	if err != nil {
+		t.Fatalf("获取会话统计失败: %v", err)
+	}
+	if stats.TotalMemories != 2 || stats.ArchivedCount != 1 {
+		t.Fatalf("应统计user_a的2条记忆和1条归档记忆: %+v", stats)
+	}
+	if stats.ByType["decision"] != 1 || stats.ByType["long_term_memory"] != 1 || stats.ByPriority["P0"] != 0 || stats.ByPriority["P1"] != 1 {
+		t.Errorf("类型和优先级分布错误: %v, %v", stats.ByType, stats.ByPriority)
+	}
+	engines := stats.ByStorageEngine
+	if engines[models.StorageEngineVector] != 2 || engines[models.StorageEngineTimeline] != 1 || engines[models.StorageEngineKnowledgeGraph] != 1 {
+		t.Errorf("存储引擎分布错误，未记录引擎的记忆应计为仅向量存储: %v", engines)
+	}
+	if stats.EstimatedTokens == 0 || stats.MessageCount != 2 || stats.MessageTokens == 0 || stats.LastMemoryAt == 0 {
+		t.Errorf("token估算和消息统计错误: %+v", stats)
+	}
+}
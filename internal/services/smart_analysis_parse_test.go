@@ -0,0 +1,77 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+const smartAnalysisJSON = `{
+  "intent_analysis": {
+    "core_intent_text": "修复{session}解析问题",
+    "domain_context_text": "Go服务",
+    "scenario_text": "调试",
+    "intent_count": 1
+  },
+  "confidence_assessment": {
+    "semantic_clarity": 0.9,
+    "information_completeness": 0.8,
+    "intent_confidence": 0.85,
+    "overall_confidence": 0.86
+  },
+  "storage_recommendations": {
+    "timeline_storage": {"should_store": false, "reason": "无时间事件"},
+    "knowledge_graph_storage": {"should_store": false, "reason": "无实体关系"},
+    "vector_storage": {"should_store": true, "reason": "语义内容", "enabled_dimensions": ["core_intent"]}
+  }
+}`
+
+// TestParseSmartAnalysisResponseWithFence 测试带```json代码块标记的响应
+func TestParseSmartAnalysisResponseWithFence(t *testing.T) {
+	s := &ContextService{}
+	result, err := s.parseSmartAnalysisResponse("```json\n" + smartAnalysisJSON + "\n```")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if result.ConfidenceAssessment == nil || result.ConfidenceAssessment.OverallConfidence != 0.86 {
+		t.Errorf("置信度解析错误: %+v", result.ConfidenceAssessment)
+	}
+}
+
+// TestParseSmartAnalysisResponseWithTrailingText 测试JSON后附带解释文字的响应
+func TestParseSmartAnalysisResponseWithTrailingText(t *testing.T) {
+	s := &ContextService{}
+	response := "```json\n" + smartAnalysisJSON + "\n```\n\n以上分析基于用户输入，如有{疑问}请补充说明。"
+	result, err := s.parseSmartAnalysisResponse(response)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if result.IntentAnalysis == nil || result.IntentAnalysis.IntentCount != 1 {
+		t.Errorf("意图解析错误: %+v", result.IntentAnalysis)
+	}
+}
+
+// TestParseSmartAnalysisResponseWithBracesInStrings 测试字符串值中包含花括号和转义引号
+func TestParseSmartAnalysisResponseWithBracesInStrings(t *testing.T) {
+	s := &ContextService{}
+	response := strings.Replace(smartAnalysisJSON, `"修复{session}解析问题"`, `"处理 \"}\" 和 {nested} 字符"`, 1) + " 说明文字 }"
+	result, err := s.parseSmartAnalysisResponse(response)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if got := result.IntentAnalysis.CoreIntentText; got != `处理 "}" 和 {nested} 字符` {
+		t.Errorf("字符串值解析错误: %s", got)
+	}
+	if result.StorageRecommendations.VectorStorage == nil || !result.StorageRecommendations.VectorStorage.ShouldStore {
+		t.Errorf("存储建议解析错误: %+v", result.StorageRecommendations)
+	}
+}
+
+// TestParseSmartAnalysisResponseUnparseable 测试无法解析的响应仍然返回错误
+func TestParseSmartAnalysisResponseUnparseable(t *testing.T) {
+	s := &ContextService{}
+	for _, response := range []string{"抱歉，我无法完成分析", `{"intent_analysis": {"core_intent_text": "未闭合"`} {
+		if _, err := s.parseSmartAnalysisResponse(response); err == nil {
+			t.Errorf("期望解析失败: %s", response)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// engineResultTestStore 可配置写入失败的向量存储，未覆盖的方法不会被调用
+type engineResultTestStore struct {
+	models.VectorStore
+	fail     bool
+	metadata map[string]interface{} // 最后一次写入的记忆元数据
+}
+
+func (f *engineResultTestStore) GenerateEmbedding(text string) ([]float32, error) {
+	return []float32{float32(len(text)), 1}, nil
+}
+
+func (f *engineResultTestStore) StoreMemory(memory *models.Memory) error {
+	if f.fail {
+		return errors.New("写入失败")
+	}
+	f.metadata = memory.Metadata
+	return nil
+}
+
+// TestExecuteSmartStorageEngineResults 测试智能存储返回各存储引擎的结果，执行的引擎全部失败时返回错误
+func TestExecuteSmartStorageEngineResults(t *testing.T) {
+	vectorStore := &engineResultTestStore{}
+	service := &ContextService{vectorStore: vectorStore, config: &config.Config{StoreRetryMaxAttempts: 1}}
+	analysisResult := &models.SmartAnalysisResult{
+		IntentAnalysis:       &models.IntentAnalysisResult{CoreIntentText: "修复登录超时"},
+		ConfidenceAssessment: &models.ConfidenceAssessment{OverallConfidence: 0.9},
+		StorageRecommendations: &models.StorageRecommendations{
+			TimelineStorage:       &models.StorageRecommendation{},
+			KnowledgeGraphStorage: &models.StorageRecommendation{},
+			VectorStorage: &models.VectorStorageRecommendation{
+				StorageRecommendation: &models.StorageRecommendation{ShouldStore: true},
+				EnabledDimensions:     []string{"core_intent"},
+			},
+		},
+	}
+	req := models.StoreContextRequest{SessionID: "s1", Content: "登录超时已修复"}
+
+	outcome, err := service.executeSmartStorage(context.Background(), analysisResult, req)
+	if err != nil {
+		t.Fatalf("executeSmartStorage failed: %v", err)
+	}
+	if len(outcome.engineResults) != 1 || outcome.engineResults[0].Engine != models.StorageEngineVector || !outcome.engineResults[0].Success {
+		t.Errorf("Expected successful vector result, got %+v", outcome.engineResults)
+	}
+
+	vectorStore.fail = true
+	if _, err := service.executeSmartStorage(context.Background(), analysisResult, req); err == nil {
+		t.Error("Expected error when every attempted engine fails")
+	}
+
+	response := &models.StoreContextResponse{}
+	storeOutcome{engineResults: []models.StorageEngineResult{
+		{Engine: models.StorageEngineTimeline, Success: true},
+		{Engine: models.StorageEngineKnowledgeGraph, Error: "连接失败"},
+	}}.applyEngineResults(response)
+	if !response.PartialFailure || len(response.FailedEngines()) != 1 || response.FailedEngines()[0] != models.StorageEngineKnowledgeGraph {
+		t.Errorf("Expected knowledge graph partial failure, got %+v", response)
+	}
+}
+
+// blockingTestStore 写入一直阻塞到release关闭的向量存储
+// TestPlannedStorageEnginesMatchesSmartStorage 测试试运行列出的存储引擎与智能存储实际写入的一致，不可用的引擎同样被跳过
+func TestPlannedStorageEnginesMatchesSmartStorage(t *testing.T) {
+	vectorStore := &engineResultTestStore{}
+	service := &ContextService{vectorStore: vectorStore, config: &config.Config{
+		EnableMultiDimensionalStorage: true,
+		StoreRetryMaxAttempts:         1,
+	}}
+	service.engines.set(engineNameTimescaleDB, models.EngineStateDisabled, "", service.now())
+	service.engines.set(engineNameNeo4j, models.EngineStateDisabled, "", service.now())
+	analysisResult := &models.SmartAnalysisResult{
+		IntentAnalysis:       &models.IntentAnalysisResult{CoreIntentText: "修复登录超时"},
+		ConfidenceAssessment: &models.ConfidenceAssessment{OverallConfidence: 0.9},
+		StorageRecommendations: &models.StorageRecommendations{
+			TimelineStorage:       &models.StorageRecommendation{TimelineTime: "now"},
+			KnowledgeGraphStorage: &models.StorageRecommendation{ShouldStore: true},
+			VectorStorage: &models.VectorStorageRecommendation{
+				StorageRecommendation: &models.StorageRecommendation{ShouldStore: true},
+				EnabledDimensions:     []string{"core_intent"},
+			},
+		},
+	}
+
+	planned := service.plannedStorageEngines(analysisResult, "full_storage")
+	if len(planned) != 1 || planned[0] != models.StorageEngineVector {
+		t.Fatalf("不可用的引擎不应列入计划: %v", planned)
+	}
+	req := models.StoreContextRequest{SessionID: "s1", Content: "登录超时已修复"}
+	if _, err := service.executeSmartStorage(context.Background(), analysisResult, req); err != nil {
+		t.Fatalf("executeSmartStorage failed: %v", err)
+	}
+	if stored := vectorStore.metadata[models.MetadataStorageEnginesKey]; fmt.Sprint(stored) != fmt.Sprint(planned) {
+		t.Errorf("实际写入的存储引擎%v与计划%v不一致", stored, planned)
+	}
+}
+
+type blockingTestStore struct {
+	engineResultTestStore
+	release chan struct{}
+}
+
+func (f *blockingTestStore) StoreMemory(memory *models.Memory) error {
+	<-f.release
+	return nil
+}
+
+// TestExecuteSmartStorageCancellation 测试请求取消时智能存储及时返回，未完成的引擎记为已取消
+func TestExecuteSmartStorageCancellation(t *testing.T) {
+	vectorStore := &blockingTestStore{release: make(chan struct{})}
+	defer close(vectorStore.release)
+	service := &ContextService{vectorStore: vectorStore, config: &config.Config{StoreRetryMaxAttempts: 1}}
+	analysisResult := &models.SmartAnalysisResult{
+		IntentAnalysis:       &models.IntentAnalysisResult{CoreIntentText: "修复登录超时"},
+		ConfidenceAssessment: &models.ConfidenceAssessment{OverallConfidence: 0.9},
+		StorageRecommendations: &models.StorageRecommendations{
+			TimelineStorage:       &models.StorageRecommendation{},
+			KnowledgeGraphStorage: &models.StorageRecommendation{},
+			VectorStorage: &models.VectorStorageRecommendation{
+				StorageRecommendation: &models.StorageRecommendation{ShouldStore: true},
+				EnabledDimensions:     []string{"core_intent"},
+			},
+		},
+	}
+	req := models.StoreContextRequest{SessionID: "s1", Content: "登录超时已修复"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := service.executeSmartStorage(ctx, analysisResult, req)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected prompt return after cancellation, took %v", elapsed)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// 超时同样中止等待
+	service.config.SmartStorageTimeout = 50 * time.Millisecond
+	start = time.Now()
+	_, err = service.executeSmartStorage(context.Background(), analysisResult, req)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected prompt return after timeout, took %v", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
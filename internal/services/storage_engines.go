@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/knowledge"
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/timeline"
+)
+
+// 复用的存储引擎连接池健康检查间隔和超时
+const (
+	engineHealthCheckInterval = 30 * time.Second
+	engineHealthCheckTimeout  = 3 * time.Second
+)
+
+// cachedEngine 复用的存储引擎，零值可用
+// 首次使用时创建，之后复用同一个连接池；距上次检查超过间隔时做健康检查，连接失效则关闭并重建
+type cachedEngine[T any] struct {
+	mu        sync.Mutex
+	engine    T
+	ready     bool
+	checkedAt time.Time
+	now       func() time.Time // 测试时替换
+}
+
+// get 获取复用的引擎，必要时创建或重建
+func (c *cachedEngine[T]) get(ctx context.Context, name string, create func() (T, error), healthCheck func(context.Context, T) error, closeEngine func(T)) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+
+	if c.ready {
+		if now().Sub(c.checkedAt) < engineHealthCheckInterval {
+			return c.engine, nil
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, engineHealthCheckTimeout)
+		err := healthCheck(checkCtx, c.engine)
+		cancel()
+		if err == nil {
+			c.checkedAt = now()
+			return c.engine, nil
+		}
+		log.Printf("⚠️ [存储引擎] %s连接已失效，重新连接: %v", name, err)
+		closeEngine(c.engine)
+		c.reset()
+	}
+
+	engine, err := create()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	log.Printf("🔌 [存储引擎] 已创建%s连接池，后续存储复用该连接", name)
+	c.engine, c.ready, c.checkedAt = engine, true, now()
+	return engine, nil
+}
+
+// close 关闭并清除缓存的引擎
+func (c *cachedEngine[T]) close(closeEngine func(T)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ready {
+		closeEngine(c.engine)
+		c.reset()
+	}
+}
+
+// reset 清除缓存的引擎，调用方需持有锁
+func (c *cachedEngine[T]) reset() {
+	var zero T
+	c.engine, c.ready = zero, false
+}
+
+// getTimelineEngine 获取复用的TimescaleDB引擎
+func (s *ContextService) getTimelineEngine(ctx context.Context, config *timeline.TimescaleDBConfig) (*timeline.TimescaleDBEngine, error) {
+	return s.timelineEngine.get(ctx, "TimescaleDB",
+		func() (*timeline.TimescaleDBEngine, error) {
+			engine, err := s.createTimescaleDBEngine(config)
+			if err != nil {
+				return nil, fmt.Errorf("创建TimescaleDB引擎失败: %w", err)
+			}
+			return engine, nil
+		},
+		func(ctx context.Context, engine *timeline.TimescaleDBEngine) error { return engine.HealthCheck(ctx) },
+		closeTimelineEngine)
+}
+
+// getKnowledgeEngine 获取复用的Neo4j引擎
+func (s *ContextService) getKnowledgeEngine(ctx context.Context, config *knowledge.Neo4jConfig) (*knowledge.Neo4jEngine, error) {
+	return s.knowledgeEngine.get(ctx, "Neo4j",
+		func() (*knowledge.Neo4jEngine, error) {
+			engine, err := s.createNeo4jEngine(config)
+			if err != nil {
+				return nil, fmt.Errorf("创建Neo4j引擎失败: %w", err)
+			}
+			return engine, nil
+		},
+		func(ctx context.Context, engine *knowledge.Neo4jEngine) error { return engine.HealthCheck(ctx) },
+		closeKnowledgeEngine)
+}
+
+// Close 服务关闭时释放复用的TimescaleDB和Neo4j连接池
+func (s *ContextService) Close() {
+	s.timelineEngine.close(closeTimelineEngine)
+	s.knowledgeEngine.close(closeKnowledgeEngine)
+}
+
+func closeTimelineEngine(engine *timeline.TimescaleDBEngine) {
+	if err := engine.Close(); err != nil {
+		log.Printf("⚠️ [存储引擎] 关闭TimescaleDB连接池失败: %v", err)
+	}
+}
+
+func closeKnowledgeEngine(engine *knowledge.Neo4jEngine) {
+	ctx, cancel := context.WithTimeout(context.Background(), engineHealthCheckTimeout)
+	defer cancel()
+	if err := engine.Close(ctx); err != nil {
+		log.Printf("⚠️ [存储引擎] 关闭Neo4j连接池失败: %v", err)
+	}
+}
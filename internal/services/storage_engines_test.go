@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeEngine 记录是否已关闭的测试引擎
+type fakeEngine struct {
+	id     int
+	closed bool
+}
+
+// TestCachedEngineReuseAndReconnect 测试引擎复用、超过检查间隔后健康检查以及连接失效时重建
+func TestCachedEngineReuseAndReconnect(t *testing.T) {
+	now := time.Now()
+	cache := &cachedEngine[*fakeEngine]{now: func() time.Time { return now }}
+
+	created := 0
+	create := func() (*fakeEngine, error) {
+		created++
+		return &fakeEngine{id: created}, nil
+	}
+	var healthErr error
+	checks := 0
+	healthCheck := func(ctx context.Context, engine *fakeEngine) error {
+		checks++
+		return healthErr
+	}
+	closeEngine := func(engine *fakeEngine) { engine.closed = true }
+	get := func() *fakeEngine {
+		engine, err := cache.get(context.Background(), "test", create, healthCheck, closeEngine)
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		return engine
+	}
+
+	first := get()
+	if second := get(); second != first || checks != 0 {
+		t.Errorf("Expected engine reused without health check, created=%d checks=%d", created, checks)
+	}
+
+	now = now.Add(engineHealthCheckInterval)
+	if engine := get(); engine != first || checks != 1 {
+		t.Errorf("Expected healthy engine reused after check, checks=%d", checks)
+	}
+
+	now = now.Add(engineHealthCheckInterval)
+	healthErr = errors.New("connection reset")
+	reconnected := get()
+	if reconnected == first || !first.closed || created != 2 {
+		t.Errorf("Expected stale engine closed and recreated, created=%d", created)
+	}
+
+	cache.close(closeEngine)
+	if !reconnected.closed {
+		t.Error("Expected engine closed on shutdown")
+	}
+	if _, err := cache.get(context.Background(), "test", func() (*fakeEngine, error) {
+		return nil, errors.New("refused")
+	}, healthCheck, closeEngine); err == nil {
+		t.Error("Expected create error to be returned")
+	}
+}
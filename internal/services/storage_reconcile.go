@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// reconcileVectorScanLimit 一致性检查时扫描的用户向量记录上限
+const reconcileVectorScanLimit = 10000
+
+// ReconcileStorage 检查用户的向量记录与会话存储是否一致，返回检查报告
+// 正向检查所属会话已不存在的孤立向量（非演练模式下删除）；反向检查会话中已写入向量存储（带batchId）的消息对应的向量记录是否仍存在，只报告不修复
+func (s *ContextService) ReconcileStorage(ctx context.Context, userID string, dryRun bool) (*models.ReconcileReport, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	if s.vectorStore == nil && s.vectorService == nil {
+		return nil, fmt.Errorf("向量存储未配置，无法检查一致性")
+	}
+	// 删除孤立向量时与记忆重建、数据清除互斥
+	if !dryRun {
+		if !s.acquireReindex(userID) {
+			return nil, ErrPurgeUserConflict
+		}
+		defer s.releaseReindex(userID)
+	}
+
+	log.Printf("🔍 [一致性检查] 开始检查用户 %s 的存储一致性, dryRun=%v", userID, dryRun)
+	report := &models.ReconcileReport{
+		UserID:          userID,
+		DryRun:          dryRun,
+		OrphanedVectors: []models.OrphanedVector{},
+		MissingMemories: []models.MissingMemoryRef{},
+	}
+
+	records, err := s.searchByUserID(ctx, userID, reconcileVectorScanLimit)
+	if err != nil {
+		return nil, fmt.Errorf("扫描用户向量记录失败: %w", err)
+	}
+	report.Truncated = len(records) >= reconcileVectorScanLimit
+
+	userSessionStore, err := s.GetUserSessionStore(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取用户会话存储失败: %w", err)
+	}
+	sessionExists := func(sessionID string) bool {
+		if _, err := userSessionStore.GetSessionSnapshot(sessionID); err == nil {
+			return true
+		}
+		// 早期会话保存在全局会话存储中
+		if s.sessionStore != nil {
+			if _, err := s.sessionStore.GetSessionSnapshot(sessionID); err == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 正向检查：向量记录所属会话是否存在；没有会话ID的记录（如用户级记忆）不检查
+	vectorIDs := make(map[string]bool)
+	checkedSessions := make(map[string]bool)
+	var orphanIDs []string
+	for _, record := range records {
+		if getResultUserID(record) != userID {
+			continue
+		}
+		report.ScannedVectors++
+		vectorIDs[record.ID] = true
+		vectorIDs[resultMemoryID(record)] = true
+
+		sessionID, _ := record.Fields["session_id"].(string)
+		if sessionID == "" {
+			continue
+		}
+		exists, checked := checkedSessions[sessionID]
+		if !checked {
+			exists = sessionExists(sessionID)
+			checkedSessions[sessionID] = exists
+		}
+		if exists {
+			continue
+		}
+		report.OrphanedVectors = append(report.OrphanedVectors, models.OrphanedVector{
+			ID:        record.ID,
+			MemoryID:  resultMemoryID(record),
+			SessionID: sessionID,
+			Type:      getResultMemoryType(record),
+			Timestamp: getResultTimestamp(record),
+		})
+		orphanIDs = append(orphanIDs, record.ID)
+	}
+
+	// 反向检查：批量存储的对话消息同时写入了向量存储（阿里云以batchId为主键，其他存储以消息ID为主键）
+	// 扫描被截断时向量记录不完整，无法判断缺失，跳过反向检查
+	sessions := userSessionStore.GetSessionList()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	for _, session := range sessions {
+		snapshot, err := userSessionStore.GetSessionSnapshot(session.ID)
+		if err != nil {
+			continue
+		}
+		report.ScannedSessions++
+		if report.Truncated {
+			continue
+		}
+		for _, message := range snapshot.Messages {
+			batchID, _ := message.Metadata["batchId"].(string)
+			if batchID == "" || vectorIDs[message.ID] || vectorIDs[batchID] {
+				continue
+			}
+			report.MissingMemories = append(report.MissingMemories, models.MissingMemoryRef{
+				SessionID: snapshot.ID,
+				MessageID: message.ID,
+				BatchID:   batchID,
+			})
+		}
+	}
+
+	if !dryRun && len(orphanIDs) > 0 {
+		if err := s.deleteMemories(ctx, orphanIDs); err != nil {
+			return nil, fmt.Errorf("删除孤立向量失败: %w", err)
+		}
+		report.RemovedVectors = len(orphanIDs)
+	}
+	report.CheckedAt = time.Now()
+
+	log.Printf("✅ [一致性检查] 用户 %s: 扫描向量=%d, 扫描会话=%d, 孤立向量=%d, 已删除=%d, 缺失记忆=%d, 截断=%v",
+		userID, report.ScannedVectors, report.ScannedSessions, len(report.OrphanedVectors),
+		report.RemovedVectors, len(report.MissingMemories), report.Truncated)
+	return report, nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestReconcileStorage 测试检测孤立向量和缺失记忆，演练模式不删除，非演练模式只删除孤立向量
+func TestReconcileStorage(t *testing.T) {
+	manager := store.NewUserSessionManager(t.TempDir())
+	userStore, err := manager.GetUserSessionStore("user_a")
+	if err != nil {
+		t.Fatalf("创建用户会话存储失败: %v", err)
+	}
+	kept := models.NewMessage("s1", "user", "已写入向量的消息", "text", "P2", map[string]interface{}{"batchId": "b1"})
+	lost := models.NewMessage("s1", "user", "向量已丢失的消息", "text", "P2", map[string]interface{}{"batchId": "b2"})
+	local := models.NewMessage("s1", "user", "只在会话中的消息", "text", "P2", nil)
+	session := models.NewSession("s1")
+	session.Messages = []*models.Message{kept, lost, local}
+	if err := userStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service := &ContextService{userSessionManager: manager}
+	service.SetVectorStore(vectorStore)
+	for id, sessionID := range map[string]string{kept.ID: "s1", "m-live": "s1", "m-orphan": "s-deleted", "m-user": ""} {
+		memory := models.NewMemory(sessionID, "记忆 "+id, "P2", nil)
+		memory.ID = id
+		memory.UserID = "user_a"
+		memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("StoreMemory failed: %v", err)
+		}
+	}
+
+	report, err := service.ReconcileStorage(context.Background(), "user_a", true)
+	if err != nil {
+		t.Fatalf("ReconcileStorage failed: %v", err)
+	}
+	if report.ScannedVectors != 4 || report.ScannedSessions != 1 || report.RemovedVectors != 0 || vectorStore.Len() != 4 {
+		t.Errorf("Unexpected dry run report: %+v", report)
+	}
+	if len(report.OrphanedVectors) != 1 || report.OrphanedVectors[0].ID != "m-orphan" {
+		t.Errorf("Expected m-orphan orphaned, got %+v", report.OrphanedVectors)
+	}
+	if len(report.MissingMemories) != 1 || report.MissingMemories[0].MessageID != lost.ID {
+		t.Errorf("Expected %s missing, got %+v", lost.ID, report.MissingMemories)
+	}
+
+	report, err = service.ReconcileStorage(context.Background(), "user_a", false)
+	if err != nil {
+		t.Fatalf("ReconcileStorage failed: %v", err)
+	}
+	if report.RemovedVectors != 1 || vectorStore.Len() != 3 {
+		t.Errorf("Expected orphan removed, got %+v with %d records", report, vectorStore.Len())
+	}
+}
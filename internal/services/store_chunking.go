@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/google/uuid"
+)
+
+// =============================================================================
+// 超长内容分块存储：代码按顶层声明切分，文本按段落/句子边界切分为重叠的分块，每块单独生成向量
+// 分块共享同一个父ID，分块记忆ID为 {parentId}-{chunkIndex}
+// =============================================================================
+
+// 分块记忆的元数据字段
+const (
+	chunkMetaParentID = "parentId"
+	chunkMetaIndex    = "chunkIndex"
+	chunkMetaCount    = "chunkCount"
+	chunkMetaOverlap  = "chunkOverlap" // 分块开头与上一块重叠的字符数，重组时去掉
+	chunkMetaType     = "chunkType"    // 分块方式: code, prose
+	chunkMetaSymbols  = "chunkSymbols" // 代码分块中声明的函数、类型等标识符
+)
+
+// contentChunk 切分后的单个分块
+type contentChunk struct {
+	Text    string // 分块内容，包含与上一块重叠的前缀
+	Overlap int    // 开头与上一块重叠的字符数
+}
+
+// storeChunkMaxChars 获取分块阈值，<=0表示不分块
+func (s *ContextService) storeChunkMaxChars() int {
+	if s.config == nil {
+		return 0
+	}
+	return s.config.StoreChunkMaxChars
+}
+
+// shouldChunkContent 判断内容是否超过分块阈值（按字符数计）
+func (s *ContextService) shouldChunkContent(content string) bool {
+	maxChars := s.storeChunkMaxChars()
+	return maxChars > 0 && len([]rune(content)) > maxChars
+}
+
+// storeChunkedContext 将超长内容分块存储，返回父ID
+// 分块只走向量存储；任一分块失败时删除已写入的分块，避免留下不完整的内容
+func (s *ContextService) storeChunkedContext(ctx context.Context, req models.StoreContextRequest) (storeOutcome, error) {
+	chunkType, language := s.detectChunkType(req)
+	var chunks []contentChunk
+	if chunkType == chunkTypeCode {
+		chunks = splitCodeIntoChunks(req.Content, language, s.storeChunkMaxChars(), s.config.StoreChunkOverlap)
+	} else {
+		chunks = splitContentIntoChunks(req.Content, s.storeChunkMaxChars(), s.config.StoreChunkOverlap)
+	}
+	parentID := uuid.New().String()
+	log.Printf("✂️ [分块存储] 内容长度%d字符，按%s方式切分为%d块，父ID: %s", len([]rune(req.Content)), chunkType, len(chunks), parentID)
+
+	if req.Dedup {
+		log.Printf("ℹ️ [分块存储] 分块存储不支持去重，忽略dedup参数")
+	}
+
+	var storedIDs []string
+	for i, chunk := range chunks {
+		metadata := make(map[string]interface{}, len(req.Metadata)+6)
+		for key, value := range req.Metadata {
+			metadata[key] = value
+		}
+		metadata[chunkMetaParentID] = parentID
+		metadata[chunkMetaIndex] = i
+		metadata[chunkMetaCount] = len(chunks)
+		metadata[chunkMetaOverlap] = chunk.Overlap
+		metadata[chunkMetaType] = chunkType
+		if chunkType == chunkTypeCode {
+			if symbols := extractCodeFeatures(string([]rune(chunk.Text)[chunk.Overlap:]), language); len(symbols) > 0 {
+				metadata[chunkMetaSymbols] = symbols
+			}
+		}
+
+		memory := models.NewMemory(req.SessionID, chunk.Text, req.Priority, metadata)
+		memory.ID = chunkMemoryID(parentID, i)
+		if req.BizType > 0 {
+			memory.BizType = req.BizType
+		}
+		if req.UserID != "" {
+			memory.UserID = req.UserID
+		}
+
+		vector, err := s.generateEmbedding(chunk.Text)
+		if err == nil {
+			memory.Vector = vector
+			err = s.storeMemoryWithRetry(ctx, memory)
+		}
+		if err != nil {
+			s.rollbackChunks(ctx, storedIDs)
+			return storeOutcome{}, fmt.Errorf("存储第%d/%d个分块失败: %w", i+1, len(chunks), err)
+		}
+		storedIDs = append(storedIDs, memory.ID)
+	}
+
+	if err := s.sessionStore.UpdateSession(req.SessionID, req.Content); err != nil {
+		log.Printf("[上下文服务] 警告: 更新会话信息失败: %v", err)
+	}
+
+	log.Printf("✅ [分块存储] 存储完成，父ID: %s, 分块数: %d", parentID, len(chunks))
+	return storeOutcome{memoryID: parentID, chunkCount: len(chunks)}, nil
+}
+
+// rollbackChunks 删除已写入的分块，失败时只记录日志
+func (s *ContextService) rollbackChunks(ctx context.Context, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	if err := s.deleteMemories(ctx, ids); err != nil {
+		log.Printf("⚠️ [分块存储] 回滚已写入的%d个分块失败: %v", len(ids), err)
+	}
+}
+
+// chunkMemoryID 生成分块的记忆ID
+func chunkMemoryID(parentID string, index int) string {
+	return fmt.Sprintf("%s-%d", parentID, index)
+}
+
+// AssembleChunkedMemory 按父ID读取全部分块并重组为原始内容，parentID也可以是任一分块的ID
+// 返回的结果ID为父ID，元数据中chunkCount为分块数；不是分块记忆时返回错误
+func (s *ContextService) AssembleChunkedMemory(ctx context.Context, parentID string) (*models.SearchResult, error) {
+	first, err := s.findChunk(ctx, chunkMemoryID(parentID, 0))
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		// 传入的可能是分块ID，读取该分块记录的父ID
+		if record, err := s.findChunk(ctx, parentID); err == nil && record != nil {
+			if id, _ := parseResultMetadata(*record)[chunkMetaParentID].(string); id != "" && id != parentID {
+				return s.AssembleChunkedMemory(ctx, id)
+			}
+		}
+		return nil, fmt.Errorf("未找到分块记忆: %s", parentID)
+	}
+
+	count := getMetadataInt(parseResultMetadata(*first), chunkMetaCount)
+	if count <= 0 {
+		return nil, fmt.Errorf("记忆%s不是分块记忆", parentID)
+	}
+
+	chunks := []models.SearchResult{*first}
+	for i := 1; i < count; i++ {
+		chunk, err := s.findChunk(ctx, chunkMemoryID(parentID, i))
+		if err != nil {
+			return nil, err
+		}
+		if chunk == nil {
+			return nil, fmt.Errorf("分块记忆%s不完整，缺少第%d块", parentID, i)
+		}
+		chunks = append(chunks, *chunk)
+	}
+
+	assembled := models.SearchResult{
+		ID:     parentID,
+		Score:  first.Score,
+		Fields: make(map[string]interface{}, len(first.Fields)),
+	}
+	for key, value := range first.Fields {
+		assembled.Fields[key] = value
+	}
+	assembled.Fields["content"] = assembleChunkContents(chunks)
+	assembled.Fields["chunkCount"] = count
+
+	log.Printf("🧩 [分块重组] 父ID: %s, 分块数: %d", parentID, count)
+	return &assembled, nil
+}
+
+// findChunk 按ID精确查找分块记录，不存在时返回nil
+func (s *ContextService) findChunk(ctx context.Context, id string) (*models.SearchResult, error) {
+	results, err := s.searchByID(ctx, id, "id")
+	if err != nil {
+		return nil, fmt.Errorf("查询分块%s失败: %w", id, err)
+	}
+	for i := range results {
+		if results[i].ID == id {
+			return &results[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// assembleChunkContents 按chunkIndex排序后拼接分块内容，去掉每块开头的重叠部分
+func assembleChunkContents(chunks []models.SearchResult) string {
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return getMetadataInt(parseResultMetadata(chunks[i]), chunkMetaIndex) <
+			getMetadataInt(parseResultMetadata(chunks[j]), chunkMetaIndex)
+	})
+
+	var builder strings.Builder
+	for _, chunk := range chunks {
+		content, _ := chunk.Fields["content"].(string)
+		runes := []rune(content)
+		overlap := getMetadataInt(parseResultMetadata(chunk), chunkMetaOverlap)
+		if overlap > len(runes) {
+			overlap = len(runes)
+		}
+		builder.WriteString(string(runes[overlap:]))
+	}
+	return builder.String()
+}
+
+// getMetadataInt 读取元数据中的整数，兼容JSON解析后的float64
+func getMetadataInt(metadata map[string]interface{}, key string) int {
+	switch v := metadata[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case int64:
+		return int(v)
+	}
+	return 0
+}
+
+// splitContentIntoChunks 将内容切分为不超过maxChars个字符的分块
+// 优先在代码块之外的段落边界切分，其次是行边界，都没有时按字符数硬切分；
+// 每块开头带上上一块末尾的overlap个字符，分块内容总长（含重叠）不超过maxChars
+func splitContentIntoChunks(content string, maxChars, overlap int) []contentChunk {
+	runes := []rune(content)
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return []contentChunk{{Text: content}}
+	}
+	if overlap < 0 {
+		overlap = 0
+	}
+	if overlap > maxChars/2 {
+		overlap = maxChars / 2
+	}
+
+	inFence := codeFenceMask(runes)
+	var chunks []contentChunk
+	start := 0
+	for start < len(runes) {
+		prefix := overlap
+		if prefix > start {
+			prefix = start
+		}
+
+		end := start + maxChars - prefix
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			end = chunkBoundary(runes, inFence, start, end)
+		}
+
+		chunks = append(chunks, contentChunk{Text: string(runes[start-prefix : end]), Overlap: prefix})
+		start = end
+	}
+	return chunks
+}
+
+// chunkBoundary 在(start, end]的后半段中从后往前查找切分位置
+// 优先级：代码块外的空行 > 代码块外的换行 > 代码块外的句末 > 任意换行 > end
+func chunkBoundary(runes []rune, inFence []bool, start, end int) int {
+	paragraph, line, sentence, anyLine := -1, -1, -1, -1
+	for pos := end; pos > start+(end-start)/2; pos-- {
+		if runes[pos-1] != '\n' {
+			if sentence < 0 && !inFence[pos] && isSentenceEnd(runes, pos) {
+				sentence = pos
+			}
+			continue
+		}
+		if anyLine < 0 {
+			anyLine = pos
+		}
+		if inFence[pos] {
+			continue
+		}
+		if pos >= 2 && runes[pos-2] == '\n' {
+			paragraph = pos
+			break
+		}
+		if line < 0 {
+			line = pos
+		}
+	}
+
+	switch {
+	case paragraph > 0:
+		return paragraph
+	case line > 0:
+		return line
+	case sentence > 0:
+		return sentence
+	case anyLine > 0:
+		return anyLine
+	default:
+		return end
+	}
+}
+
+// isSentenceEnd 位置pos之前是否为句末：中文句末标点，或英文句末标点后跟空白
+func isSentenceEnd(runes []rune, pos int) bool {
+	switch runes[pos-1] {
+	case '。', '！', '？', '；':
+		return true
+	case '.', '!', '?':
+		return pos == len(runes) || unicode.IsSpace(runes[pos])
+	}
+	return false
+}
+
+// codeFenceMask 标记每个位置是否位于```代码块内部，长度为len(runes)+1
+func codeFenceMask(runes []rune) []bool {
+	mask := make([]bool, len(runes)+1)
+	inside := false
+	for lineStart := 0; lineStart < len(runes); {
+		lineEnd := lineStart
+		for lineEnd < len(runes) && runes[lineEnd] != '\n' {
+			lineEnd++
+		}
+		if lineEnd < len(runes) {
+			lineEnd++ // 包含换行符
+		}
+
+		for pos := lineStart + 1; pos < lineEnd; pos++ {
+			mask[pos] = inside
+		}
+		if strings.HasPrefix(strings.TrimSpace(string(runes[lineStart:lineEnd])), "```") {
+			inside = !inside
+		}
+		mask[lineEnd] = inside
+		lineStart = lineEnd
+	}
+	return mask
+}
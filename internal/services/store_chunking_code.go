@@ -0,0 +1,150 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 分块方式
+const (
+	chunkTypeCode  = "code"  // 按顶层声明切分，每个函数/类型尽量单独成块
+	chunkTypeProse = "prose" // 按段落和句子边界切分，相邻分块重叠
+)
+
+// codeChunkMinChars 短于该字符数的代码段与后一段合并，避免import、单个常量等单独成块
+const codeChunkMinChars = 200
+
+// codeDeclarationPatterns 各语言顶层声明的行首特征，只匹配没有缩进的行
+var codeDeclarationPatterns = map[string]*regexp.Regexp{
+	"go":     regexp.MustCompile(`^(func|type|var|const)\b`),
+	"python": regexp.MustCompile(`^(async\s+def|def|class)\s`),
+	"rust":   regexp.MustCompile(`^(pub(\([\w:]+\))?\s+)?(async\s+)?(unsafe\s+)?(fn|struct|enum|trait|impl|mod|type|const|static|union|macro_rules!)\b`),
+}
+
+// jsDeclarationPattern JavaScript/TypeScript的顶层声明，含export和default修饰
+var jsDeclarationPattern = regexp.MustCompile(`^(export\s+)?(default\s+)?(declare\s+)?(async\s+)?(function\*?|class|abstract\s+class|const|let|var|interface|type|enum)\b`)
+
+// genericDeclarationPattern 其他语言的顶层声明：常见的声明关键字和访问修饰符
+var genericDeclarationPattern = regexp.MustCompile(`^(public|private|protected|internal|static|final|abstract|sealed|data|open|export|async|def|fun|func|function|class|interface|struct|enum|object|module|namespace|impl|fn|void|int|char|bool)\b`)
+
+// proseLanguages 按文本方式切分的文件语言
+var proseLanguages = map[string]bool{
+	"markdown": true,
+}
+
+// detectChunkType 判断内容按代码还是文本方式切分，返回分块方式和代码语言
+// 代码文件(type=code_file)和可推断出语言的内容按代码切分；含```代码块的混合内容按文本切分
+func (s *ContextService) detectChunkType(req models.StoreContextRequest) (string, string) {
+	memoryType, _ := req.Metadata[models.MetadataTypeKey].(string)
+	language, _ := req.Metadata["language"].(string)
+	filePath, _ := req.Metadata["file_path"].(string)
+	if language == "" {
+		language = s.InferCodeLanguage(filePath, req.Content)
+	}
+	language = strings.ToLower(language)
+
+	if proseLanguages[language] {
+		return chunkTypeProse, language
+	}
+	if memoryType == "code_file" {
+		return chunkTypeCode, language
+	}
+	if language != "" && !strings.Contains(req.Content, "```") {
+		return chunkTypeCode, language
+	}
+	return chunkTypeProse, ""
+}
+
+// splitCodeIntoChunks 按顶层声明切分代码，声明前的注释、装饰器和属性随声明一起
+// 短段与后一段合并；单个声明超过maxChars时按行边界继续切分并带重叠，其余分块之间没有重叠
+func splitCodeIntoChunks(content, language string, maxChars, overlap int) []contentChunk {
+	if maxChars <= 0 || len([]rune(content)) <= maxChars {
+		return []contentChunk{{Text: content}}
+	}
+
+	var chunks []contentChunk
+	for _, segment := range mergeShortCodeSegments(splitCodeDeclarations(content, language), codeChunkMinChars) {
+		if len([]rune(segment)) <= maxChars {
+			chunks = append(chunks, contentChunk{Text: segment})
+			continue
+		}
+		chunks = append(chunks, splitContentIntoChunks(segment, maxChars, overlap)...)
+	}
+	return chunks
+}
+
+// splitCodeDeclarations 在顶层声明的起始行切分代码，各段拼接后与原文一致
+func splitCodeDeclarations(content, language string) []string {
+	pattern := codeDeclarationPattern(language)
+	lines := strings.SplitAfter(content, "\n")
+
+	var segments []string
+	segmentStart := 0
+	for i := 1; i < len(lines); i++ {
+		if !pattern.MatchString(lines[i]) {
+			continue
+		}
+		// 声明前紧邻的注释、装饰器和属性属于该声明
+		start := i
+		for start-1 > segmentStart && isCodeLeadingLine(lines[start-1]) {
+			start--
+		}
+		if start <= segmentStart {
+			continue
+		}
+		segments = append(segments, strings.Join(lines[segmentStart:start], ""))
+		segmentStart = start
+	}
+	return append(segments, strings.Join(lines[segmentStart:], ""))
+}
+
+// codeDeclarationPattern 获取语言的顶层声明特征，语言别名与extractCodeFeatures一致
+func codeDeclarationPattern(language string) *regexp.Regexp {
+	switch language {
+	case "javascript", "typescript", "jsx", "tsx":
+		return jsDeclarationPattern
+	case "rs":
+		language = "rust"
+	}
+	if pattern, ok := codeDeclarationPatterns[language]; ok {
+		return pattern
+	}
+	return genericDeclarationPattern
+}
+
+// isCodeLeadingLine 是否为声明前的注释、装饰器或属性行
+func isCodeLeadingLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return false
+	}
+	for _, prefix := range []string{"//", "/*", "*", "#", "@"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeShortCodeSegments 将短于minChars的段与后一段合并，末尾的短段并入前一段
+func mergeShortCodeSegments(segments []string, minChars int) []string {
+	var merged []string
+	pending := ""
+	for _, segment := range segments {
+		pending += segment
+		if len([]rune(pending)) >= minChars {
+			merged = append(merged, pending)
+			pending = ""
+		}
+	}
+	if pending != "" {
+		if len(merged) > 0 {
+			merged[len(merged)-1] += pending
+		} else {
+			merged = append(merged, pending)
+		}
+	}
+	return merged
+}
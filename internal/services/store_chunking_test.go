@@ -0,0 +1,108 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestSplitContentIntoChunks 测试分块不超过上限、不在代码块内部切分，去掉重叠后可还原原文
+func TestSplitContentIntoChunks(t *testing.T) {
+	paragraph := strings.Repeat("上下文管理段落内容。", 8)
+	code := "```go\nfunc main() {\n\n\tfmt.Println(\"hello\")\n}\n```"
+	content := strings.Join([]string{paragraph, code, paragraph, paragraph}, "\n\n")
+
+	chunks := splitContentIntoChunks(content, 120, 20)
+	if len(chunks) < 2 {
+		t.Fatalf("期望切分为多块，实际%d块", len(chunks))
+	}
+
+	results := make([]models.SearchResult, 0, len(chunks))
+	for i, chunk := range chunks {
+		if n := len([]rune(chunk.Text)); n > 120 {
+			t.Errorf("第%d块长度%d超过上限", i, n)
+		}
+		if i > 0 && chunk.Overlap == 0 {
+			t.Errorf("第%d块缺少重叠前缀", i)
+		}
+		if strings.Count(string([]rune(chunk.Text)[chunk.Overlap:]), "```")%2 != 0 {
+			t.Errorf("第%d块在代码块内部切分: %q", i, chunk.Text)
+		}
+		results = append(results, models.SearchResult{Fields: map[string]interface{}{
+			"content":  chunk.Text,
+			"metadata": map[string]interface{}{chunkMetaIndex: float64(i), chunkMetaOverlap: float64(chunk.Overlap)},
+		}})
+	}
+
+	// 乱序传入，按chunkIndex重组
+	results[0], results[len(results)-1] = results[len(results)-1], results[0]
+	if assembled := assembleChunkContents(results); assembled != content {
+		t.Errorf("重组内容与原文不一致:\n%s", assembled)
+	}
+
+	if short := splitContentIntoChunks("短内容", 120, 20); len(short) != 1 || short[0].Text != "短内容" {
+		t.Errorf("未超过阈值时不应分块: %+v", short)
+	}
+}
+
+// TestSplitCodeIntoChunks 测试代码按顶层声明切分，注释随声明一起，短段合并，拼接后与原文一致
+func TestSplitCodeIntoChunks(t *testing.T) {
+	body := strings.Repeat("\tresult = append(result, item)\n", 8)
+	content := "package cache\n\nimport \"sync\"\n\n" +
+		"// Alpha 读取缓存\nfunc Alpha() {\n" + body + "}\n\n" +
+		"// Beta 写入缓存\nfunc Beta() {\n" + body + "}\n\n" +
+		"type Store struct {\n\tmu sync.Mutex\n}\n"
+
+	chunks := splitCodeIntoChunks(content, "go", 400, 50)
+	if len(chunks) != 2 {
+		t.Fatalf("期望按Alpha、Beta切分为2块，实际%d块: %+v", len(chunks), chunks)
+	}
+	if !strings.HasPrefix(chunks[0].Text, "package cache") || !strings.Contains(chunks[0].Text, "func Alpha") {
+		t.Errorf("包声明应与第一个函数合并: %q", chunks[0].Text)
+	}
+	if !strings.HasPrefix(chunks[1].Text, "// Beta") || !strings.Contains(chunks[1].Text, "type Store") {
+		t.Errorf("注释应随声明切分，末尾短段应并入前一块: %q", chunks[1].Text)
+	}
+
+	var assembled strings.Builder
+	for _, chunk := range chunks {
+		if chunk.Overlap != 0 {
+			t.Errorf("按声明切分的代码分块不应有重叠: %+v", chunk)
+		}
+		assembled.WriteString(chunk.Text)
+	}
+	if assembled.String() != content {
+		t.Errorf("拼接内容与原文不一致:\n%s", assembled.String())
+	}
+	if symbols := extractCodeFeatures(chunks[1].Text, "go"); len(symbols) != 2 || symbols[0] != "Beta" {
+		t.Errorf("第二块应只声明Beta和Store: %v", symbols)
+	}
+
+	service := &ContextService{}
+	code := models.StoreContextRequest{Content: "print(1)", Metadata: map[string]interface{}{"type": "code_file", "language": "python"}}
+	if chunkType, language := service.detectChunkType(code); chunkType != chunkTypeCode || language != "python" {
+		t.Errorf("代码文件应按代码切分: %s, %s", chunkType, language)
+	}
+	mixed := models.StoreContextRequest{Content: "说明\n```go\npackage main\n\nfunc main() {}\n```"}
+	if chunkType, _ := service.detectChunkType(mixed); chunkType != chunkTypeProse {
+		t.Errorf("含代码块的说明文字应按文本切分: %s", chunkType)
+	}
+}
+
+// TestSplitProseAtSentences 测试没有换行的长文本在句末切分并保留重叠
+func TestSplitProseAtSentences(t *testing.T) {
+	content := strings.Repeat("检索链路先生成查询向量再过滤。", 10)
+	chunks := splitContentIntoChunks(content, 60, 10)
+	if len(chunks) < 2 {
+		t.Fatalf("期望切分为多块，实际%d块", len(chunks))
+	}
+	for i, chunk := range chunks[:len(chunks)-1] {
+		if !strings.HasSuffix(chunk.Text, "。") {
+			t.Errorf("第%d块应在句末切分: %q", i, chunk.Text)
+		}
+	}
+	if chunks[1].Overlap != 10 {
+		t.Errorf("文本分块应带重叠前缀: %d", chunks[1].Overlap)
+	}
+}
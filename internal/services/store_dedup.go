@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 存储去重：写入前检查同会话/用户下是否已有近似重复的记忆
+// =============================================================================
+
+const (
+	// defaultStoreDedupThreshold 未配置去重阈值时使用的默认相似度
+	defaultStoreDedupThreshold = 0.97
+	// storeDedupCandidates 去重检查时取回的候选记忆数
+	storeDedupCandidates = 3
+)
+
+// storeOutcome 单次存储的结果
+type storeOutcome struct {
+	memoryID       string
+	deduplicated   bool                         // 命中近似重复记忆，未写入新记录
+	analysisResult *models.SmartAnalysisResult  // LLM驱动存储的分析结果，原有存储逻辑为nil
+	chunkCount     int                          // 超长内容分块存储的分块数，未分块时为0
+	engineResults  []models.StorageEngineResult // 多维度存储时各存储引擎的写入结果
+	priority       string                       // 实际使用的优先级（显式指定或推断）
+}
+
+// applyEngineResults 将各存储引擎的写入结果写入响应，部分引擎失败时标记partialFailure
+func (o storeOutcome) applyEngineResults(response *models.StoreContextResponse) {
+	response.EngineResults = o.engineResults
+	response.PartialFailure = len(response.FailedEngines()) > 0
+}
+
+// storeDedupThreshold 获取去重相似度阈值
+func (s *ContextService) storeDedupThreshold() float64 {
+	if s.config != nil && s.config.StoreDedupThreshold > 0 {
+		return s.config.StoreDedupThreshold
+	}
+	return defaultStoreDedupThreshold
+}
+
+// findDuplicateMemory 查找同会话/用户下与vector相似度达到阈值的已有记忆
+// 去重只是优化，搜索失败时直接按未命中处理，不影响正常写入
+func (s *ContextService) findDuplicateMemory(ctx context.Context, req models.StoreContextRequest, vector []float32) (string, bool) {
+	results, err := s.searchByVector(ctx, vector, req.SessionID, map[string]interface{}{
+		"limit":                 storeDedupCandidates,
+		"skip_threshold_filter": true,
+	})
+	if err != nil {
+		log.Printf("⚠️ [存储去重] 相似记忆搜索失败，跳过去重: %v", err)
+		return "", false
+	}
+
+	threshold := s.storeDedupThreshold()
+	for _, result := range results {
+		if sessionID, ok := result.Fields["session_id"].(string); ok && sessionID != "" && sessionID != req.SessionID {
+			continue
+		}
+		if userID, ok := result.Fields["userId"].(string); ok && userID != "" && req.UserID != "" && userID != req.UserID {
+			continue
+		}
+
+		similarity := result.Score
+		if similarity >= threshold {
+			log.Printf("♻️ [存储去重] 命中重复记忆: %s, 相似度: %.4f >= %.4f", result.ID, similarity, threshold)
+			return result.ID, true
+		}
+	}
+	return "", false
+}
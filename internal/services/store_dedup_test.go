@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestFindDuplicateMemoryWithInMemoryStore 测试使用内存向量存储时，同会话的相同内容命中去重，其他会话不命中
+func TestFindDuplicateMemoryWithInMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	service := &ContextService{config: &config.Config{StoreDedupThreshold: 0.95}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+
+	vector, err := service.generateEmbedding("修复登录超时 bug")
+	if err != nil {
+		t.Fatalf("generateEmbedding failed: %v", err)
+	}
+	memory := models.NewMemory("s1", "修复登录超时 bug", "P1", nil)
+	memory.UserID = "user_a"
+	memory.Vector = vector
+	if err := vectorStore.StoreMemory(memory); err != nil {
+		t.Fatalf("StoreMemory failed: %v", err)
+	}
+
+	req := models.StoreContextRequest{SessionID: "s1", UserID: "user_a", Content: "修复登录超时 bug"}
+	if id, ok := service.findDuplicateMemory(ctx, req, vector); !ok || id != memory.ID {
+		t.Errorf("Expected duplicate %s, got %q (%v)", memory.ID, id, ok)
+	}
+
+	req.SessionID = "s2"
+	if _, ok := service.findDuplicateMemory(ctx, req, vector); ok {
+		t.Error("Expected no duplicate across sessions")
+	}
+
+	other, _ := service.generateEmbedding("deploy kubernetes cluster")
+	req.SessionID = "s1"
+	if _, ok := service.findDuplicateMemory(ctx, req, other); ok {
+		t.Error("Expected no duplicate for unrelated content")
+	}
+}
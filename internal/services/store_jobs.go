@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/google/uuid"
+)
+
+// =============================================================================
+// 异步存储任务：请求入队后立即返回jobId，由后台worker执行LLM分析和存储
+// =============================================================================
+
+// ErrStoreJobNotFound 任务不存在、已过期清理或不属于该会话
+var ErrStoreJobNotFound = errors.New("存储任务不存在或已过期")
+
+// storeJobQueue 异步存储任务队列，并发安全
+type storeJobQueue struct {
+	store     func(ctx context.Context, req models.StoreContextRequest) (*models.StoreContextResponse, error)
+	resultTTL time.Duration
+
+	mu      sync.RWMutex
+	jobs    map[string]*models.StoreJob
+	pending chan storeJobTask
+}
+
+// storeJobTask 排队中的任务
+type storeJobTask struct {
+	jobID string
+	req   models.StoreContextRequest
+}
+
+// newStoreJobQueue 创建任务队列并启动worker和过期清理
+func newStoreJobQueue(workers, queueSize int, resultTTL time.Duration, store func(ctx context.Context, req models.StoreContextRequest) (*models.StoreContextResponse, error)) *storeJobQueue {
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+	if resultTTL <= 0 {
+		resultTTL = time.Hour
+	}
+
+	q := &storeJobQueue{
+		store:     store,
+		resultTTL: resultTTL,
+		jobs:      make(map[string]*models.StoreJob),
+		pending:   make(chan storeJobTask, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker(i)
+	}
+	go q.gcLoop()
+	return q
+}
+
+// enqueue 创建任务并加入队列，队列已满时返回错误
+func (q *storeJobQueue) enqueue(req models.StoreContextRequest) (*models.StoreJob, error) {
+	job := &models.StoreJob{
+		JobID:     uuid.New().String(),
+		SessionID: req.SessionID,
+		Status:    models.StoreJobQueued,
+		CreatedAt: time.Now(),
+	}
+
+	q.mu.Lock()
+	q.jobs[job.JobID] = job
+	q.mu.Unlock()
+
+	select {
+	case q.pending <- storeJobTask{jobID: job.JobID, req: req}:
+	default:
+		q.mu.Lock()
+		delete(q.jobs, job.JobID)
+		q.mu.Unlock()
+		return nil, fmt.Errorf("异步存储队列已满(%d)，请稍后重试", cap(q.pending))
+	}
+
+	log.Printf("📥 [异步存储] 任务已入队: jobId=%s, 会话=%s, 排队数=%d", job.JobID, req.SessionID, len(q.pending))
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// get 获取任务状态副本，任务必须属于sessionID
+func (q *storeJobQueue) get(sessionID, jobID string) (*models.StoreJob, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	job, exists := q.jobs[jobID]
+	if !exists || job.SessionID != sessionID {
+		return nil, ErrStoreJobNotFound
+	}
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// worker 循环处理队列中的任务
+func (q *storeJobQueue) worker(id int) {
+	for task := range q.pending {
+		q.process(id, task)
+	}
+}
+
+// process 执行单个任务；panic只会让当前任务失败，worker继续处理后续任务
+func (q *storeJobQueue) process(workerID int, task storeJobTask) {
+	startedAt := time.Now()
+	q.update(task.jobID, func(job *models.StoreJob) {
+		job.Status = models.StoreJobProcessing
+		job.StartedAt = &startedAt
+	})
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("❌ [异步存储] worker-%d 处理任务 %s 时发生panic: %v", workerID, task.jobID, r)
+			buf := make([]byte, 4096)
+			n := runtime.Stack(buf, false)
+			log.Printf("❌ [异步存储] 堆栈: %s", buf[:n])
+			q.finish(task.jobID, nil, fmt.Errorf("处理时发生panic: %v", r))
+		}
+	}()
+
+	response, err := q.store(context.Background(), task.req)
+	q.finish(task.jobID, response, err)
+}
+
+// finish 记录任务结果
+func (q *storeJobQueue) finish(jobID string, response *models.StoreContextResponse, err error) {
+	finishedAt := time.Now()
+	q.update(jobID, func(job *models.StoreJob) {
+		job.FinishedAt = &finishedAt
+		if err != nil {
+			job.Status = models.StoreJobFailed
+			job.Error = err.Error()
+			log.Printf("❌ [异步存储] 任务失败: jobId=%s, 错误: %v", jobID, err)
+			return
+		}
+
+		job.Status = models.StoreJobDone
+		job.MemoryID = response.MemoryID
+		job.Deduplicated = response.Deduplicated
+		job.AnalysisResult = response.AnalysisResult
+		job.StorageStrategy = response.StorageStrategy
+		job.Confidence = response.Confidence
+		job.EngineResults = response.EngineResults
+		job.PartialFailure = response.PartialFailure
+		log.Printf("✅ [异步存储] 任务完成: jobId=%s, memoryId=%s, 耗时: %v", jobID, response.MemoryID, finishedAt.Sub(job.CreatedAt))
+	})
+}
+
+// update 在锁内修改任务，任务已被清理时忽略
+func (q *storeJobQueue) update(jobID string, modify func(job *models.StoreJob)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job, exists := q.jobs[jobID]; exists {
+		modify(job)
+	}
+}
+
+// gcLoop 定期清理超过保留时间的已完成任务
+func (q *storeJobQueue) gcLoop() {
+	interval := q.resultTTL / 2
+	if interval > 10*time.Minute {
+		interval = 10 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if removed := q.removeExpired(time.Now()); removed > 0 {
+			log.Printf("🧹 [异步存储] 清理过期任务 %d 个", removed)
+		}
+	}
+}
+
+// removeExpired 删除完成时间早于now-resultTTL的任务，排队和处理中的任务不清理
+func (q *storeJobQueue) removeExpired(now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	removed := 0
+	for jobID, job := range q.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > q.resultTTL {
+			delete(q.jobs, jobID)
+			removed++
+		}
+	}
+	return removed
+}
+
+// EnqueueStoreContext 将存储请求加入异步队列，立即返回排队中的任务
+func (s *ContextService) EnqueueStoreContext(req models.StoreContextRequest) (*models.StoreJob, error) {
+	if s.storeJobs == nil {
+		return nil, fmt.Errorf("异步存储未启用")
+	}
+	if err := normalizeContentReference(&req); err != nil {
+		return nil, err
+	}
+	if err := normalizeStoreCollection(&req); err != nil {
+		return nil, err
+	}
+	return s.storeJobs.enqueue(req)
+}
+
+// GetStoreJob 查询异步存储任务状态，只能查询本会话提交的任务
+func (s *ContextService) GetStoreJob(sessionID, jobID string) (*models.StoreJob, error) {
+	if s.storeJobs == nil {
+		return nil, fmt.Errorf("异步存储未启用")
+	}
+	return s.storeJobs.get(sessionID, jobID)
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// waitStoreJob 等待任务进入完成或失败状态
+func waitStoreJob(t *testing.T, q *storeJobQueue, sessionID, jobID string) *models.StoreJob {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.get(sessionID, jobID)
+		if err != nil {
+			t.Fatalf("查询任务失败: %v", err)
+		}
+		if job.Status == models.StoreJobDone || job.Status == models.StoreJobFailed {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("任务 %s 未在超时前完成", jobID)
+	return nil
+}
+
+// TestStoreJobQueueSurvivesPanic 测试panic的任务标记为failed，worker继续处理后续任务
+func TestStoreJobQueueSurvivesPanic(t *testing.T) {
+	q := newStoreJobQueue(1, 10, time.Hour, func(ctx context.Context, req models.StoreContextRequest) (*models.StoreContextResponse, error) {
+		if req.Content == "panic" {
+			panic("boom")
+		}
+		return &models.StoreContextResponse{MemoryID: "mem-1", StorageStrategy: "full_storage", Confidence: 0.9}, nil
+	})
+
+	failedJob, err := q.enqueue(models.StoreContextRequest{SessionID: "s1", Content: "panic"})
+	if err != nil {
+		t.Fatalf("入队失败: %v", err)
+	}
+	doneJob, err := q.enqueue(models.StoreContextRequest{SessionID: "s1", Content: "ok"})
+	if err != nil {
+		t.Fatalf("入队失败: %v", err)
+	}
+
+	if job := waitStoreJob(t, q, "s1", failedJob.JobID); job.Status != models.StoreJobFailed || job.Error == "" {
+		t.Errorf("panic任务应标记为failed: %+v", job)
+	}
+	job := waitStoreJob(t, q, "s1", doneJob.JobID)
+	if job.Status != models.StoreJobDone || job.MemoryID != "mem-1" || job.StorageStrategy != "full_storage" {
+		t.Errorf("后续任务结果错误: %+v", job)
+	}
+
+	if _, err := q.get("other-session", doneJob.JobID); err != ErrStoreJobNotFound {
+		t.Errorf("其他会话不应能查询任务, err=%v", err)
+	}
+}
+
+// TestStoreJobQueueRemoveExpired 测试只清理超过保留时间的已完成任务
+func TestStoreJobQueueRemoveExpired(t *testing.T) {
+	q := &storeJobQueue{resultTTL: time.Minute, jobs: make(map[string]*models.StoreJob)}
+	now := time.Now()
+	expired := now.Add(-2 * time.Minute)
+	recent := now.Add(-10 * time.Second)
+	q.jobs["expired"] = &models.StoreJob{JobID: "expired", Status: models.StoreJobDone, FinishedAt: &expired}
+	q.jobs["recent"] = &models.StoreJob{JobID: "recent", Status: models.StoreJobFailed, FinishedAt: &recent}
+	q.jobs["queued"] = &models.StoreJob{JobID: "queued", Status: models.StoreJobQueued, CreatedAt: expired}
+
+	if removed := q.removeExpired(now); removed != 1 {
+		t.Fatalf("期望清理1个任务，实际%d个", removed)
+	}
+	if _, exists := q.jobs["expired"]; exists {
+		t.Error("过期任务未被清理")
+	}
+	if len(q.jobs) != 2 {
+		t.Errorf("未过期任务被误删: %v", q.jobs)
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// isTrivialStoreContent 判断内容是否低于配置的最小长度，过短的内容（如"ok"、"谢谢"）不写入长期记忆
+// 图片记忆的内容是说明文字或文件名，不受该限制；阈值<=0时不限制
+func (s *ContextService) isTrivialStoreContent(req models.StoreContextRequest) (bool, int, int) {
+	if s.config == nil || req.ContentType == models.ContentTypeImage {
+		return false, 0, 0
+	}
+	minChars, minWords := s.config.StoreMinContentChars, s.config.StoreMinContentWords
+	if minChars <= 0 && minWords <= 0 {
+		return false, 0, 0
+	}
+
+	content := strings.TrimSpace(req.Content)
+	chars := len([]rune(content))
+	words := countContentWords(content)
+	return (minChars > 0 && chars < minChars) || (minWords > 0 && words < minWords), chars, words
+}
+
+// countContentWords 统计词数：按空白和标点切分，中日韩字符每字计一词
+func countContentWords(content string) int {
+	count := 0
+	inWord := false
+	for _, r := range content {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			count++
+			inWord = false
+		case r == '\'' && inWord:
+			// 英文缩写中的撇号不切分单词
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				count++
+				inWord = true
+			}
+		default:
+			inWord = false
+		}
+	}
+	return count
+}
+
+// skipTrivialStore 内容过短时跳过长期存储（不生成向量），返回skipped响应；短期会话消息由调用方单独保存，不受影响
+func (s *ContextService) skipTrivialStore(req models.StoreContextRequest) (*models.StoreContextResponse, bool) {
+	trivial, chars, words := s.isTrivialStoreContent(req)
+	if !trivial {
+		return nil, false
+	}
+	log.Printf("⏭️ [上下文服务] 内容过短，跳过长期存储: 会话=%s, 字符数=%d(最小%d), 词数=%d(最小%d)",
+		req.SessionID, chars, s.config.StoreMinContentChars, words, s.config.StoreMinContentWords)
+	return &models.StoreContextResponse{
+		Status:   "skipped",
+		Priority: req.Priority,
+		Skipped:  true,
+	}, true
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestCountContentWords 测试英文按单词计数、缩写不切分，中日韩字符每字计一词
+func TestCountContentWords(t *testing.T) {
+	cases := map[string]int{
+		"ok":                  1,
+		"don't worry, thanks": 3,
+		"谢谢":                  2,
+		"修复 login bug":        4,
+		"  ":                  0,
+	}
+	for content, want := range cases {
+		if got := countContentWords(content); got != want {
+			t.Errorf("countContentWords(%q) = %d, want %d", content, got, want)
+		}
+	}
+}
+
+// TestStoreContextSkipsTrivialContent 测试内容低于最小长度时不生成向量也不写入，阈值未配置时正常存储
+func TestStoreContextSkipsTrivialContent(t *testing.T) {
+	ctx := context.Background()
+	service := &ContextService{config: &config.Config{StoreMinContentChars: 5, StoreMinContentWords: 2}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+
+	for _, content := range []string{"ok", "thanks!", " 好的 "} {
+		response, err := service.StoreContextDetailed(ctx, models.StoreContextRequest{SessionID: "s1", UserID: "user_a", Content: content})
+		if err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+		if !response.Skipped || response.MemoryID != "" || response.Status != "skipped" {
+			t.Errorf("%q应被跳过: %+v", content, response)
+		}
+	}
+	if results, _ := vectorStore.SearchByFilter(ctx, "", &models.SearchOptions{Limit: 10}); len(results) != 0 {
+		t.Fatalf("跳过的内容不应写入向量存储: %d条", len(results))
+	}
+
+	if trivial, _, _ := service.isTrivialStoreContent(models.StoreContextRequest{Content: "修复登录超时"}); trivial {
+		t.Error("达到最小长度的内容不应被跳过")
+	}
+	if trivial, _, _ := service.isTrivialStoreContent(models.StoreContextRequest{Content: "a.png", ContentType: models.ContentTypeImage}); trivial {
+		t.Error("图片记忆不受最小长度限制")
+	}
+	service.config = &config.Config{}
+	if trivial, _, _ := service.isTrivialStoreContent(models.StoreContextRequest{Content: "ok"}); trivial {
+		t.Error("未配置阈值时不应跳过")
+	}
+}
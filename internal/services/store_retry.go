@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 向量存储写入重试：瞬时错误（超时、连接中断、5xx/429）按指数退避重试
+// =============================================================================
+
+const (
+	// maxStoreRetryAttempts 最大尝试次数上限，避免后端宕机时存储请求长时间挂起
+	maxStoreRetryAttempts = 5
+)
+
+// storeRetryPolicy 向量存储写入重试策略
+type storeRetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+// transientStatusPattern 匹配错误信息中的5xx、429状态码（阿里云"状态码: 503"、Qdrant"HTTP 503"）
+var transientStatusPattern = regexp.MustCompile(`(状态码: ?|HTTP )(5\d\d|429)\b`)
+
+// storeRetryPolicy 从配置获取重试策略，非法值使用默认值
+func (s *ContextService) storeRetryPolicy() storeRetryPolicy {
+	policy := storeRetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		Jitter:      0.2,
+	}
+	if s.config != nil {
+		policy.MaxAttempts = s.config.StoreRetryMaxAttempts
+		if s.config.StoreRetryBaseDelay > 0 {
+			policy.BaseDelay = s.config.StoreRetryBaseDelay
+		}
+		if s.config.StoreRetryMaxDelay > 0 {
+			policy.MaxDelay = s.config.StoreRetryMaxDelay
+		}
+		if s.config.StoreRetryJitter >= 0 && s.config.StoreRetryJitter <= 1 {
+			policy.Jitter = s.config.StoreRetryJitter
+		}
+	}
+
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	} else if policy.MaxAttempts > maxStoreRetryAttempts {
+		policy.MaxAttempts = maxStoreRetryAttempts
+	}
+	return policy
+}
+
+// delay 计算第attempt次失败后的等待时间：BaseDelay*2^(attempt-1)，不超过MaxDelay，并加入随机抖动
+func (p storeRetryPolicy) delay(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration(float64(delay) * p.Jitter * (2*rand.Float64() - 1))
+	}
+	return delay
+}
+
+// storeMemoryWithRetry 带重试的记忆存储，重试耗尽的瞬时错误标记为ErrTransientBackend
+func (s *ContextService) storeMemoryWithRetry(ctx context.Context, memory *models.Memory) error {
+	err := s.retryStoreWrite(ctx, "存储记忆 "+memory.ID, func() error {
+		return s.storeMemory(memory)
+	})
+	if isTransientStoreError(err) {
+		return apperrors.ErrTransientBackend.Wrap(err)
+	}
+	return err
+}
+
+// rewriteMemoryRecord 以新记忆替换向量存储中的原记录，统一写入顺序和重试
+func (s *ContextService) rewriteMemoryRecord(ctx context.Context, old models.SearchResult, memory *models.Memory) error {
+	return s.rewriteRecord(ctx, old, memoryStorageID(memory), func() error {
+		return s.storeMemoryWithRetry(ctx, memory)
+	})
+}
+
+// rewriteRecord 以store写入的新记录替换原记录，保证任何一步失败都不会丢失记录：
+// 支持按ID覆盖写入的存储直接写入；新记录存储ID与原记录不同时先写入新记录再删除原记录；
+// 存储ID相同且存储不支持覆盖时只能先删除原记录，写入失败时重新生成向量写回原记录
+func (s *ContextService) rewriteRecord(ctx context.Context, old models.SearchResult, storageID string, store func() error) error {
+	if storageID != old.ID || s.vectorStoreUpserts() {
+		if err := store(); err != nil {
+			return err
+		}
+		if storageID != old.ID {
+			if err := s.deleteMemories(ctx, []string{old.ID}); err != nil {
+				return fmt.Errorf("新记录%s已写入，删除原记录%s失败: %w", storageID, old.ID, err)
+			}
+		}
+		return nil
+	}
+
+	if err := s.deleteMemories(ctx, []string{old.ID}); err != nil {
+		return fmt.Errorf("删除原记录失败: %w", err)
+	}
+	if err := store(); err != nil {
+		sessionID, _ := old.Fields["session_id"].(string)
+		if restoreErr := s.storeRecordInSession(ctx, old, sessionID); restoreErr != nil {
+			log.Printf("❌ [记录改写] 写回原记录 %s 失败: %v", old.ID, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// memoryStorageID 记忆在向量存储中的主键（元数据中有batchId时使用batchId，与各存储实现一致）
+func memoryStorageID(memory *models.Memory) string {
+	if batchID, ok := memory.Metadata["batchId"].(string); ok && batchID != "" {
+		return batchID
+	}
+	return memory.ID
+}
+
+// retryStoreWrite 按重试策略执行向量存储写入，仅对瞬时错误重试，重试耗尽时返回最后一次错误
+func (s *ContextService) retryStoreWrite(ctx context.Context, operation string, write func() error) error {
+	policy := s.storeRetryPolicy()
+
+	var err error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if err = write(); err == nil {
+			if attempt > 1 {
+				log.Printf("✅ [存储重试] %s 第%d次尝试成功", operation, attempt)
+			}
+			return nil
+		}
+
+		if !isTransientStoreError(err) {
+			return err
+		}
+		if attempt == policy.MaxAttempts {
+			break
+		}
+
+		delay := policy.delay(attempt)
+		log.Printf("🔁 [存储重试] %s 第%d/%d次尝试失败（瞬时错误），%v后重试: %v",
+			operation, attempt, policy.MaxAttempts, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("等待重试时上下文已结束(已尝试%d次): %w", attempt, err)
+		case <-time.After(delay):
+		}
+	}
+
+	log.Printf("❌ [存储重试] %s 共尝试%d次仍失败: %v", operation, policy.MaxAttempts, err)
+	return err
+}
+
+// isTransientStoreError 判断是否为可重试的瞬时错误（网络超时、连接中断、5xx、429）
+// 维度不匹配、参数校验等错误重试也不会成功，直接返回
+func isTransientStoreError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if apperrors.IsRetryable(err) {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	// 部分存储实现使用%v包装错误，丢失了错误链，按错误信息判断
+	message := err.Error()
+	if transientStatusPattern.MatchString(message) {
+		return true
+	}
+	lower := strings.ToLower(message)
+	for _, keyword := range []string{"timeout", "connection reset", "connection refused", "bad gateway", "service unavailable", "gateway timeout"} {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return false
+}
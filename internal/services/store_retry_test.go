@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestRetryStoreWrite 测试瞬时错误重试、非瞬时错误不重试以及重试耗尽返回最后一次错误
+func TestRetryStoreWrite(t *testing.T) {
+	s := &ContextService{config: &config.Config{
+		StoreRetryMaxAttempts: 3,
+		StoreRetryBaseDelay:   time.Millisecond,
+		StoreRetryMaxDelay:    time.Millisecond,
+	}}
+
+	attempts := 0
+	err := s.retryStoreWrite(context.Background(), "test", func() error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("API返回错误状态码: 503, 响应: busy")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("瞬时错误应重试直到成功: err=%v, attempts=%d", err, attempts)
+	}
+
+	attempts = 0
+	err = s.retryStoreWrite(context.Background(), "test", func() error {
+		attempts++
+		return fmt.Errorf("API返回错误状态码: 400, 响应: dimension mismatch")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("非瞬时错误不应重试: err=%v, attempts=%d", err, attempts)
+	}
+
+	attempts = 0
+	lastErr := errors.New("read tcp: i/o timeout")
+	err = s.retryStoreWrite(context.Background(), "test", func() error {
+		attempts++
+		return lastErr
+	})
+	if err != lastErr || attempts != 3 {
+		t.Errorf("重试耗尽应返回最后一次错误: err=%v, attempts=%d", err, attempts)
+	}
+}
+
+// rewriteTestStore 按存储ID保存记录内容的向量存储，记录写入和删除的顺序；阿里云类型时重复ID写入失败
+type rewriteTestStore struct {
+	models.VectorStore
+	provider      models.VectorStoreType
+	contents      map[string]string
+	ops           []string
+	failOnContent string
+}
+
+func (f *rewriteTestStore) GetProvider() models.VectorStoreType { return f.provider }
+
+func (f *rewriteTestStore) GenerateEmbedding(text string) ([]float32, error) {
+	return []float32{1}, nil
+}
+
+func (f *rewriteTestStore) StoreMemory(memory *models.Memory) error {
+	id := memoryStorageID(memory)
+	if memory.Content == f.failOnContent {
+		return errors.New("写入失败")
+	}
+	if _, exists := f.contents[id]; exists && f.provider == models.VectorStoreTypeAliyun {
+		return fmt.Errorf("duplicate id: %s", id)
+	}
+	f.contents[id] = memory.Content
+	f.ops = append(f.ops, "store "+id)
+	return nil
+}
+
+func (f *rewriteTestStore) DeleteMemories(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		delete(f.contents, id)
+		f.ops = append(f.ops, "delete "+id)
+	}
+	return nil
+}
+
+// TestRewriteMemoryRecord 测试改写记录的写入顺序：覆盖写入、存储ID变化时先写后删、仅插入存储写入失败时写回原记录
+func TestRewriteMemoryRecord(t *testing.T) {
+	old := models.SearchResult{ID: "m1", Fields: map[string]interface{}{
+		"content": "旧内容", "session_id": "s1", "userId": "user_a",
+	}}
+	newMemory := func(metadata map[string]interface{}) *models.Memory {
+		memory := models.NewMemory("s1", "新内容", "P1", metadata)
+		memory.ID = "m1"
+		return memory
+	}
+
+	tests := []struct {
+		name          string
+		provider      models.VectorStoreType
+		metadata      map[string]interface{}
+		failOnContent string
+		wantErr       bool
+		wantOps       []string
+		wantContents  map[string]string
+	}{
+		{"覆盖写入", models.VectorStoreTypeQdrant, nil, "", false,
+			[]string{"store m1"}, map[string]string{"m1": "新内容"}},
+		{"存储ID变化先写后删", models.VectorStoreTypeAliyun, map[string]interface{}{"batchId": "b2"}, "", false,
+			[]string{"store b2", "delete m1"}, map[string]string{"b2": "新内容"}},
+		{"仅插入存储同ID", models.VectorStoreTypeAliyun, nil, "", false,
+			[]string{"delete m1", "store m1"}, map[string]string{"m1": "新内容"}},
+		{"写入失败写回原记录", models.VectorStoreTypeAliyun, nil, "新内容", true,
+			[]string{"delete m1", "store m1"}, map[string]string{"m1": "旧内容"}},
+		{"存储ID变化写入失败保留原记录", models.VectorStoreTypeAliyun, map[string]interface{}{"batchId": "b2"}, "新内容", true,
+			nil, map[string]string{"m1": "旧内容"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vectorStore := &rewriteTestStore{
+				provider:      tt.provider,
+				contents:      map[string]string{"m1": "旧内容"},
+				failOnContent: tt.failOnContent,
+			}
+			s := &ContextService{vectorStore: vectorStore, config: &config.Config{StoreRetryMaxAttempts: 1}}
+
+			err := s.rewriteMemoryRecord(context.Background(), old, newMemory(tt.metadata))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fmt.Sprint(vectorStore.ops) != fmt.Sprint(tt.wantOps) {
+				t.Errorf("ops = %v, want %v", vectorStore.ops, tt.wantOps)
+			}
+			if fmt.Sprint(vectorStore.contents) != fmt.Sprint(tt.wantContents) {
+				t.Errorf("contents = %v, want %v", vectorStore.contents, tt.wantContents)
+			}
+		})
+	}
+}
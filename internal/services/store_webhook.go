@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 重要记忆出站Webhook：存储完成后异步通知集成方，投递失败只记录日志，不影响存储结果
+// =============================================================================
+
+const (
+	// storeWebhookEvent Webhook事件名
+	storeWebhookEvent = "memory.stored"
+	// storeWebhookSignatureHeader 请求体HMAC-SHA256签名的请求头
+	storeWebhookSignatureHeader = "X-ContextKeeper-Signature"
+	// maxStoreWebhookSummaryRunes 通知中摘要的最大字符数
+	maxStoreWebhookSummaryRunes = 500
+)
+
+// errWebhookPermanent 不可重试的投递失败（如4xx）
+var errWebhookPermanent = errors.New("Webhook投递失败且不可重试")
+
+// notifyStoredMemory 存储完成后判断是否需要通知，需要时在后台投递Webhook
+// 去重命中（未写入新记录）时不通知
+func (s *ContextService) notifyStoredMemory(req models.StoreContextRequest, response *models.StoreContextResponse) {
+	if s.config == nil || s.config.StoreWebhookURL == "" || response == nil || response.Deduplicated {
+		return
+	}
+
+	payload, ok := s.storeWebhookPayload(req, response)
+	if !ok {
+		return
+	}
+	go func() {
+		if err := s.deliverStoreWebhook(context.Background(), payload); err != nil {
+			log.Printf("⚠️ [存储Webhook] 记忆 %s 通知失败: %v", payload.MemoryID, err)
+		}
+	}()
+}
+
+// storeWebhookPayload 构建通知内容，重要性未达到阈值且事件类型不在配置列表中时返回false
+// 重要性优先使用智能分析的置信度，未分析时按优先级换算；事件类型优先使用LLM判断的类型，否则按关键词判断
+func (s *ContextService) storeWebhookPayload(req models.StoreContextRequest, response *models.StoreContextResponse) (*models.StoreWebhookPayload, bool) {
+	analysisResult := response.AnalysisResult
+
+	importance := priorityImportance[models.PriorityP2]
+	if analysisResult != nil && analysisResult.ConfidenceAssessment != nil {
+		importance = analysisResult.ConfidenceAssessment.OverallConfidence
+	} else if score, ok := priorityImportance[req.Priority]; ok {
+		importance = score
+	}
+
+	eventType := storeEventType(req, analysisResult)
+
+	if importance < s.config.StoreWebhookMinImportance && !s.isWebhookEventType(eventType) {
+		return nil, false
+	}
+
+	userID := req.UserID
+	if userID == "" {
+		userID, _ = s.GetUserIDFromSessionID(req.SessionID)
+	}
+	title, summary := s.simpleTitle(req.Content), req.Content
+	if analysisResult != nil {
+		title, summary = s.extractTitleSummary(req.Content, analysisResult)
+	}
+	if runes := []rune(summary); len(runes) > maxStoreWebhookSummaryRunes {
+		summary = string(runes[:maxStoreWebhookSummaryRunes]) + "..."
+	}
+
+	return &models.StoreWebhookPayload{
+		Event:      storeWebhookEvent,
+		MemoryID:   response.MemoryID,
+		EventType:  eventType,
+		Title:      title,
+		Summary:    summary,
+		UserID:     userID,
+		SessionID:  req.SessionID,
+		Importance: importance,
+		Timestamp:  time.Now().Unix(),
+	}, true
+}
+
+// isWebhookEventType 事件类型是否在STORE_WEBHOOK_EVENT_TYPES中
+func (s *ContextService) isWebhookEventType(eventType string) bool {
+	if eventType == "" {
+		return false
+	}
+	for _, configured := range strings.Split(s.config.StoreWebhookEventTypes, ",") {
+		if strings.EqualFold(strings.TrimSpace(configured), eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeWebhookRetryPolicy Webhook投递的重试策略，次数上限与向量存储写入重试相同
+func (s *ContextService) storeWebhookRetryPolicy() storeRetryPolicy {
+	policy := storeRetryPolicy{
+		MaxAttempts: s.config.StoreWebhookMaxAttempts,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+		Jitter:      0.2,
+	}
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	} else if policy.MaxAttempts > maxStoreRetryAttempts {
+		policy.MaxAttempts = maxStoreRetryAttempts
+	}
+	return policy
+}
+
+// deliverStoreWebhook 投递通知，网络错误、5xx和429按指数退避重试
+func (s *ContextService) deliverStoreWebhook(ctx context.Context, payload *models.StoreWebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("序列化通知失败: %w", err)
+	}
+
+	policy := s.storeWebhookRetryPolicy()
+	for attempt := 1; ; attempt++ {
+		err = s.postStoreWebhook(ctx, body)
+		if err == nil {
+			log.Printf("✅ [存储Webhook] 记忆 %s 通知成功 (第%d次)", payload.MemoryID, attempt)
+			return nil
+		}
+		if errors.Is(err, errWebhookPermanent) || attempt >= policy.MaxAttempts {
+			return fmt.Errorf("已尝试%d次: %w", attempt, err)
+		}
+
+		delay := policy.delay(attempt)
+		log.Printf("⚠️ [存储Webhook] 记忆 %s 第%d次通知失败，%v后重试: %v", payload.MemoryID, attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// postStoreWebhook 发送一次通知，配置了密钥时附带请求体的HMAC-SHA256签名
+func (s *ContextService) postStoreWebhook(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.StoreWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: 创建请求失败: %v", errWebhookPermanent, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if s.config.StoreWebhookSecret != "" {
+		request.Header.Set(storeWebhookSignatureHeader, "sha256="+signWebhookBody(s.config.StoreWebhookSecret, body))
+	}
+
+	client := &http.Client{Timeout: s.config.StoreWebhookTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return nil
+	case response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("状态码: %d", response.StatusCode)
+	default:
+		return fmt.Errorf("%w: 状态码: %d", errWebhookPermanent, response.StatusCode)
+	}
+}
+
+// signWebhookBody 计算请求体的HMAC-SHA256签名（十六进制）
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
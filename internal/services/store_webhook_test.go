@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestStoreWebhook 测试只有重要记忆或指定事件类型触发通知，投递5xx时重试且请求体带HMAC签名
+func TestStoreWebhook(t *testing.T) {
+	var attempts int32
+	received := make(chan models.StoreWebhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(storeWebhookSignatureHeader) != "sha256="+signWebhookBody("secret", body) {
+			t.Errorf("签名错误: %s", r.Header.Get(storeWebhookSignatureHeader))
+		}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var payload models.StoreWebhookPayload
+		json.Unmarshal(body, &payload)
+		received <- payload
+	}))
+	defer server.Close()
+
+	service := &ContextService{config: &config.Config{
+		StoreWebhookURL:           server.URL,
+		StoreWebhookSecret:        "secret",
+		StoreWebhookMinImportance: 0.8,
+		StoreWebhookEventTypes:    "decision, deployment",
+		StoreWebhookMaxAttempts:   3,
+		StoreWebhookTimeout:       time.Second,
+	}}
+
+	stored := &models.StoreContextResponse{MemoryID: "m1", Status: "success"}
+	chatty := models.StoreContextRequest{SessionID: "s1", UserID: "user_a", Content: "今天天气不错", Priority: models.PriorityP2}
+	if _, ok := service.storeWebhookPayload(chatty, stored); ok {
+		t.Error("普通记忆不应触发通知")
+	}
+	urgent := chatty
+	urgent.Priority = models.PriorityP0
+	if _, ok := service.storeWebhookPayload(urgent, stored); !ok {
+		t.Error("P0记忆应触发通知")
+	}
+
+	decision := models.StoreContextRequest{SessionID: "s1", UserID: "user_a", Content: "决定采用Qdrant作为向量存储", Priority: models.PriorityP2}
+	payload, ok := service.storeWebhookPayload(decision, stored)
+	if !ok || payload.EventType != "decision" || payload.MemoryID != "m1" || payload.UserID != "user_a" {
+		t.Fatalf("决策记忆应触发通知: %+v", payload)
+	}
+	if err := service.deliverStoreWebhook(context.Background(), payload); err != nil {
+		t.Fatalf("投递失败: %v", err)
+	}
+	got := <-received
+	if atomic.LoadInt32(&attempts) != 2 || got.Title != payload.Title || got.Event != storeWebhookEvent {
+		t.Errorf("应在第2次投递成功: attempts=%d, payload=%+v", attempts, got)
+	}
+
+	// 4xx不重试
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	service.config.StoreWebhookURL = notFound.URL
+	if err := service.deliverStoreWebhook(context.Background(), payload); err == nil {
+		t.Error("4xx应返回错误")
+	}
+}
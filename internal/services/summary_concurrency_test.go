@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+)
+
+// TestAutoSummaryConcurrency 测试自动汇总的并发数受配置、全局LLM并发上限和会话数约束，worker池处理全部会话且同时运行的数量不超过上限
+func TestAutoSummaryConcurrency(t *testing.T) {
+	service := &ContextService{config: &config.Config{SummaryConcurrency: 4, LLMMaxConcurrency: 3}}
+	if workers := service.autoSummaryWorkers(10); workers != 3 {
+		t.Errorf("并发数应受全局LLM并发上限约束: %d", workers)
+	}
+	if workers := service.autoSummaryWorkers(2); workers != 2 {
+		t.Errorf("并发数不应超过会话数: %d", workers)
+	}
+	service.config.SummaryConcurrency = 0
+	if workers := service.autoSummaryWorkers(10); workers != 1 {
+		t.Errorf("未配置并发数时应逐个处理: %d", workers)
+	}
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	processed := make([]bool, 20)
+	forEachConcurrently(context.Background(), len(processed), 3, func(i int) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		processed[i] = true
+		mu.Unlock()
+	})
+	if peak != 3 {
+		t.Errorf("同时处理的会话数应达到且不超过3，实际峰值: %d", peak)
+	}
+	for i, done := range processed {
+		if !done {
+			t.Errorf("会话%d未被处理", i)
+		}
+	}
+
+	if !service.acquireAutoSummary() || service.acquireAutoSummary() {
+		t.Error("上一轮自动汇总未完成时不应开始新一轮")
+	}
+	service.releaseAutoSummary()
+	if !service.acquireAutoSummary() {
+		t.Error("上一轮完成后应可以开始新一轮")
+	}
+}
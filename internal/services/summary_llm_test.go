@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// TestSummarizeMessagesFallsBackToHeuristic 测试摘要LLM未配置或不可用时使用启发式摘要
+func TestSummarizeMessagesFallsBackToHeuristic(t *testing.T) {
+	messages := []*models.Message{
+		{Role: models.RoleUser, Content: "我们决定使用Qdrant作为向量存储", Timestamp: 1700000000},
+		{Role: models.RoleUser, Content: "如何配置集合的维度？", Timestamp: 1700000060},
+	}
+
+	for _, provider := range []string{"", "unsupported_provider"} {
+		service := &ContextService{config: &config.Config{SummaryLLMProvider: provider}}
+		want := service.GenerateEnhancedSummary(messages)
+		if got := service.summarizeMessages(context.Background(), "session_1", messages); got != want || got == "" {
+			t.Errorf("provider=%q: expected heuristic summary %q, got %q", provider, want, got)
+		}
+	}
+
+	if got := (&ContextService{config: &config.Config{}}).summarizeMessages(context.Background(), "session_1", nil); got != "" {
+		t.Errorf("Expected empty summary for no messages, got %q", got)
+	}
+}
+
+// newSummarizeTestService 创建会话s1有一条历史记录和两条对话消息的服务
+func newSummarizeTestService(t *testing.T) (*ContextService, []*models.Message) {
+	t.Helper()
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	if err := sessionStore.UpdateSession("s1", "排查登录超时问题"); err != nil {
+		t.Fatalf("写入会话历史失败: %v", err)
+	}
+	messages := []*models.Message{
+		{Role: models.RoleUser, Content: "我们决定使用Qdrant作为向量存储", Timestamp: 1700000000},
+		{Role: models.RoleAssistant, Content: "好的，集合维度需要与嵌入模型一致", Timestamp: 1700000060},
+	}
+	if err := sessionStore.StoreMessages("s1", messages); err != nil {
+		t.Fatalf("写入会话消息失败: %v", err)
+	}
+	return &ContextService{sessionStore: sessionStore, config: &config.Config{}}, messages
+}
+
+// TestSummarizeContextUsesLLMSummary 测试摘要LLM收到历史记录和对话消息，生成的摘要按历史指纹缓存，
+// 历史未变化时不再调用LLM，格式变化时重新生成
+func TestSummarizeContextUsesLLMSummary(t *testing.T) {
+	service, _ := newSummarizeTestService(t)
+	ctx := context.Background()
+
+	calls := 0
+	var gotHistory []string
+	var gotFormat string
+	generate := func(ctx context.Context, sessionID string, history []string, format string) (string, error) {
+		calls++
+		gotHistory, gotFormat = history, format
+		return "LLM摘要-" + format, nil
+	}
+
+	summary, err := service.summarizeContext(ctx, models.SummarizeContextRequest{SessionID: "s1"}, generate)
+	if err != nil {
+		t.Fatalf("summarizeContext failed: %v", err)
+	}
+	if summary != "LLM摘要-text" || gotFormat != "text" {
+		t.Errorf("未指定格式时应按text生成并返回LLM摘要: %q, format=%q", summary, gotFormat)
+	}
+	wantHistory := []string{"排查登录超时问题", "[user] 我们决定使用Qdrant作为向量存储", "[assistant] 好的，集合维度需要与嵌入模型一致"}
+	if strings.Join(gotHistory, "|") != strings.Join(wantHistory, "|") {
+		t.Errorf("LLM应收到历史记录和对话消息: %q", gotHistory)
+	}
+
+	summary, err = service.summarizeContext(ctx, models.SummarizeContextRequest{SessionID: "s1"}, generate)
+	if err != nil || summary != "LLM摘要-text" || calls != 1 {
+		t.Errorf("历史未变化时应复用缓存摘要: %q, %v, 调用%d次", summary, err, calls)
+	}
+
+	summary, err = service.summarizeContext(ctx, models.SummarizeContextRequest{SessionID: "s1", Format: "bullet"}, generate)
+	if err != nil || summary != "LLM摘要-bullet" || calls != 2 {
+		t.Errorf("格式变化时应重新生成: %q, %v, 调用%d次", summary, err, calls)
+	}
+}
+
+// TestSummarizeContextFallsBackToHeuristic 测试LLM失败时降级为基于对话消息的启发式摘要，降级摘要不缓存，
+// 下次仍尝试调用LLM；只有历史记录没有消息时降级为历史记录拼接
+func TestSummarizeContextFallsBackToHeuristic(t *testing.T) {
+	service, messages := newSummarizeTestService(t)
+	ctx := context.Background()
+
+	calls := 0
+	failing := func(ctx context.Context, sessionID string, history []string, format string) (string, error) {
+		calls++
+		return "", errors.New("LLM不可用")
+	}
+
+	want := service.GenerateEnhancedSummary(messages)
+	for i := 1; i <= 2; i++ {
+		summary, err := service.summarizeContext(ctx, models.SummarizeContextRequest{SessionID: "s1"}, failing)
+		if err != nil {
+			t.Fatalf("summarizeContext failed: %v", err)
+		}
+		if summary != want || !strings.Contains(summary, "我们决定使用Qdrant作为向量存储") {
+			t.Errorf("降级摘要应基于对话消息生成: %q", summary)
+		}
+		if calls != i {
+			t.Errorf("降级摘要不应缓存，第%d次请求应调用LLM，实际调用%d次", i, calls)
+		}
+	}
+	if session, _ := service.sessionStore.GetSession("s1"); session.Summary != want || session.SummaryKey != "" {
+		t.Errorf("降级摘要应写入会话但不记录指纹: %q, key=%q", session.Summary, session.SummaryKey)
+	}
+
+	// 只有历史记录没有消息
+	if err := service.sessionStore.UpdateSession("s2", "部署脚本权限问题"); err != nil {
+		t.Fatalf("写入会话历史失败: %v", err)
+	}
+	summary, err := service.summarizeContext(ctx, models.SummarizeContextRequest{SessionID: "s2"}, failing)
+	if err != nil || summary != buildNaiveSummary([]string{"部署脚本权限问题"}) {
+		t.Errorf("没有对话消息时应降级为历史记录摘要: %q, %v", summary, err)
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestSummaryTokenTrigger 测试少量长消息的累计token数达到阈值即触发汇总，并记录到trigger_type
+func TestSummaryTokenTrigger(t *testing.T) {
+	service := &ContextService{config: &config.Config{SummaryTokenThreshold: 1000}}
+
+	long := []*models.Message{
+		{Content: strings.Repeat("数据库迁移方案", 100)},
+		{Content: strings.Repeat("rollback plan ", 100)},
+	}
+	tokens, fired := service.summaryTokenTrigger(long)
+	if !fired || tokens != 700+300 {
+		t.Errorf("两条长消息应触发token阈值: tokens=%d, fired=%v", tokens, fired)
+	}
+
+	short := []*models.Message{{Content: "好的"}, {Content: "ok"}}
+	if _, fired := service.summaryTokenTrigger(short); fired {
+		t.Error("短消息不应触发token阈值")
+	}
+
+	service.config.SummaryTokenThreshold = 0
+	if _, fired := service.summaryTokenTrigger(long); fired {
+		t.Error("阈值为0时不应启用token触发")
+	}
+
+	if got := summaryTriggerType(false, false, true, false, false); got != "token_count" {
+		t.Errorf("trigger_type错误: %s", got)
+	}
+	if got := summaryTriggerType(true, true, true, false, true); got != "time+message_count+token_count+recently_expired" {
+		t.Errorf("多个条件同时满足时应按顺序连接: %s", got)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/engines/multi_dimensional_retrieval/timeline"
+)
+
+// TestParseTimelineQueryTime 测试RFC3339、Unix秒、日期时间、日期和相对时间的解析，无法解析时报错
+func TestParseTimelineQueryTime(t *testing.T) {
+	cases := map[string]time.Time{
+		"":                          {},
+		"2025-03-01T08:30:00Z":      time.Date(2025, 3, 1, 8, 30, 0, 0, time.UTC),
+		"1740817800":                time.Unix(1740817800, 0),
+		"2025-03-01 08:30:00":       time.Date(2025, 3, 1, 8, 30, 0, 0, time.Local),
+		" 2025-03-01 ":              time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local),
+		"2025-03-01T08:30:00+08:00": time.Date(2025, 3, 1, 0, 30, 0, 0, time.UTC),
+	}
+	for value, want := range cases {
+		got, err := ParseTimelineQueryTime(value)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseTimelineQueryTime(%q) = %v, %v; 期望 %v", value, got, err, want)
+		}
+	}
+
+	yesterday, err := ParseTimelineQueryTime("昨天")
+	if err != nil || time.Since(yesterday) < 23*time.Hour || time.Since(yesterday) > 25*time.Hour {
+		t.Errorf("相对时间解析错误: %v, %v", yesterday, err)
+	}
+	if _, err := ParseTimelineQueryTime("上上周三"); err == nil {
+		t.Error("无法解析的时间应报错")
+	}
+}
+
+// TestQueryTimelineRangeAndLimit 测试默认时间窗口、结束时间早于开始时间时报错、事件类型透传和条数上限
+func TestQueryTimelineRangeAndLimit(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	service := &ContextService{}
+	service.SetClock(&fixedClock{now: now})
+
+	var got *timeline.TimelineQuery
+	query := func(ctx context.Context, q *timeline.TimelineQuery) (*timeline.TimelineResult, error) {
+		got = q
+		return &timeline.TimelineResult{
+			Events:          []timeline.TimelineEvent{{ID: "e1", EventType: "decision", Timestamp: now.Add(-time.Hour)}},
+			Total:           3,
+			EventTypeCounts: map[string]int{"decision": 3},
+		}, nil
+	}
+
+	response, err := service.queryTimeline(context.Background(), "user_a", "ws1", time.Time{}, time.Time{}, []string{"decision"}, 0, query)
+	if err != nil {
+		t.Fatalf("queryTimeline failed: %v", err)
+	}
+	if !got.EndTime.Equal(now) || !got.StartTime.Equal(now.Add(-defaultTimelineQueryRange)) {
+		t.Errorf("未指定时间时应查询最近7天: %v ~ %v", got.StartTime, got.EndTime)
+	}
+	if got.UserID != "user_a" || got.WorkspaceID != "ws1" || !reflect.DeepEqual(got.EventTypes, []string{"decision"}) || got.Limit != defaultTimelineQueryLimit {
+		t.Errorf("查询条件错误: %+v", got)
+	}
+	if len(response.Events) != 1 || response.Events[0].ID != "e1" || response.Total != 3 || response.EventTypeCounts["decision"] != 3 {
+		t.Errorf("响应错误: %+v", response)
+	}
+
+	// 只指定开始时间时结束时间为当前时间，条数超过上限时截断
+	from := now.Add(-30 * 24 * time.Hour)
+	if _, err := service.queryTimeline(context.Background(), "user_a", "", from, time.Time{}, nil, 10000, query); err != nil {
+		t.Fatalf("queryTimeline failed: %v", err)
+	}
+	if !got.StartTime.Equal(from) || !got.EndTime.Equal(now) || got.Limit != maxTimelineQueryLimit || got.EventTypes != nil {
+		t.Errorf("时间范围或条数上限错误: %+v", got)
+	}
+
+	got = nil
+	if _, err := service.queryTimeline(context.Background(), "user_a", "", now, now.Add(-time.Hour), nil, 10, query); err == nil || got != nil {
+		t.Errorf("结束时间早于开始时间时应报错且不查询: err=%v", err)
+	}
+	if _, err := service.queryTimeline(context.Background(), "", "", time.Time{}, time.Time{}, nil, 10, query); err == nil || got != nil {
+		t.Errorf("用户ID为空时应报错且不查询: err=%v", err)
+	}
+}
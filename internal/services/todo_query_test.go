@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/vectorstore"
+)
+
+// TestRetrieveTodosByQuery 测试按查询检索只返回当前用户的待办，按相关度排序、带得分，并可与状态过滤组合
+func TestRetrieveTodosByQuery(t *testing.T) {
+	service := &ContextService{config: &config.Config{}}
+	vectorStore := vectorstore.NewInMemoryVectorStore(64, 0)
+	service.SetVectorStore(vectorStore)
+
+	store := func(id, userID, content, status string, bizType int) {
+		memory := models.NewMemory("s1", content, "P1", map[string]interface{}{"status": status})
+		memory.ID = id
+		memory.UserID = userID
+		memory.BizType = bizType
+		vector, err := vectorStore.GenerateEmbedding(content)
+		if err != nil {
+			t.Fatalf("生成向量失败: %v", err)
+		}
+		memory.Vector = vector
+		if err := vectorStore.StoreMemory(memory); err != nil {
+			t.Fatalf("存储失败: %v", err)
+		}
+	}
+	store("auth", "user_a", "TODO auth refactor token middleware", "pending", models.BizTypeTodo)
+	store("docs", "user_a", "TODO update release docs", "pending", models.BizTypeTodo)
+	store("auth-done", "user_a", "TODO auth refactor session cookie", "completed", models.BizTypeTodo)
+	store("other", "user_b", "TODO auth refactor token middleware", "pending", models.BizTypeTodo)
+	store("note", "user_a", "auth refactor token middleware notes", "", 0)
+
+	resp, err := service.RetrieveTodos(context.Background(), models.RetrieveTodosRequest{
+		UserID: "user_a", Status: "all", Limit: 10, Query: "auth refactor token middleware",
+	})
+	if err != nil {
+		t.Fatalf("检索待办失败: %v", err)
+	}
+	if resp.Total != 3 || resp.Items[0].ID != "auth" || *resp.Items[0].Score <= *resp.Items[2].Score {
+		t.Fatalf("应只返回user_a的3条待办且按相关度排序: %+v", resp.Items)
+	}
+	for _, item := range resp.Items {
+		if item.Score == nil || *item.Score < 0 || *item.Score > 1 {
+			t.Errorf("待办 %s 应返回[0, 1]的得分: %v", item.ID, item.Score)
+		}
+	}
+
+	resp, err = service.RetrieveTodos(context.Background(), models.RetrieveTodosRequest{
+		UserID: "user_a", Status: "completed", Limit: 10, Query: "auth refactor",
+	})
+	if err != nil || resp.Total != 1 || resp.Items[0].ID != "auth-done" {
+		t.Errorf("状态过滤应与查询组合生效: %+v, %v", resp, err)
+	}
+}
+
+// insertOnlyTodoStore 模拟不支持按ID覆盖写入的存储，failCompleted为true时写入已完成状态的待办失败
+type insertOnlyTodoStore struct {
+	*vectorstore.InMemoryVectorStore
+	failCompleted bool
+}
+
+func (f *insertOnlyTodoStore) GetProvider() models.VectorStoreType {
+	return models.VectorStoreTypeAliyun
+}
+
+func (f *insertOnlyTodoStore) StoreMemory(memory *models.Memory) error {
+	if f.failCompleted && memory.Metadata["status"] == "completed" {
+		return errors.New("写入失败")
+	}
+	return f.InMemoryVectorStore.StoreMemory(memory)
+}
+
+// TestUpdateTodoKeepsRecordOnStoreFailure 测试不支持覆盖写入的存储重新写入待办失败时保留原待办，成功时更新状态
+func TestUpdateTodoKeepsRecordOnStoreFailure(t *testing.T) {
+	vectorStore := &insertOnlyTodoStore{InMemoryVectorStore: vectorstore.NewInMemoryVectorStore(64, 0), failCompleted: true}
+	service := &ContextService{config: &config.Config{StoreRetryMaxAttempts: 1}}
+	service.SetVectorStore(vectorStore)
+
+	memory := models.NewMemory("s1", "TODO fix flaky test", "P1", map[string]interface{}{"status": "pending"})
+	memory.ID = "todo1"
+	memory.UserID = "user_a"
+	memory.BizType = models.BizTypeTodo
+	memory.Vector, _ = vectorStore.GenerateEmbedding(memory.Content)
+	if err := vectorStore.InMemoryVectorStore.StoreMemory(memory); err != nil {
+		t.Fatalf("存储失败: %v", err)
+	}
+
+	req := models.UpdateTodoRequest{UserID: "user_a", MemoryID: "todo1", Status: "completed"}
+	if _, err := service.UpdateTodo(context.Background(), req); err == nil {
+		t.Fatal("写入失败时应返回错误")
+	}
+	resp, err := service.RetrieveTodos(context.Background(), models.RetrieveTodosRequest{UserID: "user_a", Status: "all", Limit: 10})
+	if err != nil || resp.Total != 1 || resp.Items[0].Status != "pending" {
+		t.Fatalf("写入失败后应保留原待办: %+v, %v", resp, err)
+	}
+
+	vectorStore.failCompleted = false
+	item, err := service.UpdateTodo(context.Background(), req)
+	if err != nil || item.Status != "completed" || vectorStore.Len() != 1 {
+		t.Errorf("应更新为已完成且只保留一条记录: %+v, %v, 记录数=%d", item, err, vectorStore.Len())
+	}
+}
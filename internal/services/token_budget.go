@@ -0,0 +1,177 @@
+package services
+
+import (
+	"unicode"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 按token预算装配上下文时的参数
+const (
+	maxRetrieveTokens      = 200000 // maxTokens上限
+	minTruncatedItemTokens = 16     // 剩余预算少于此值时不再截断放入，直接丢弃
+	budgetTruncationSuffix = "…"
+	budgetItemShortTerm    = "short_term"
+	budgetItemLongTerm     = "long_term"
+	asciiCharsPerToken     = 4 // 英文等字符约4个字符一个token
+)
+
+// validateMaxTokens 校验token预算参数，0表示不限制
+func validateMaxTokens(maxTokens int) error {
+	if maxTokens < 0 || maxTokens > maxRetrieveTokens {
+		return apperrors.ErrInvalidArgument.WithMessagef("maxTokens必须在0-%d之间: %d", maxRetrieveTokens, maxTokens)
+	}
+	return nil
+}
+
+// estimateTokens 估算文本的token数：汉字等CJK字符按每字1个token，其余非空白字符按每4个字符1个token
+// 只用于预算分配，不追求与具体模型的分词结果一致
+func estimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			cjk++
+		case unicode.IsSpace(r):
+		default:
+			other++
+		}
+	}
+	return cjk + (other+asciiCharsPerToken-1)/asciiCharsPerToken
+}
+
+// truncateToTokens 截断文本使估算token数不超过maxTokens（含省略号）
+func truncateToTokens(text string, maxTokens int) string {
+	if estimateTokens(text) <= maxTokens {
+		return text
+	}
+	runes := []rune(text)
+	n := tokenPrefixLen(runes, maxTokens-estimateTokens(budgetTruncationSuffix))
+	return string(runes[:n]) + budgetTruncationSuffix
+}
+
+// tokenPrefixLen 估算token数不超过maxTokens的最长前缀的字符数
+func tokenPrefixLen(runes []rune, maxTokens int) int {
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if estimateTokens(string(runes[:mid])) <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// tokenSuffixLen 估算token数不超过maxTokens的最长后缀的字符数
+func tokenSuffixLen(runes []rune, maxTokens int) int {
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if estimateTokens(string(runes[len(runes)-mid:])) <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// budgetKey 保留记忆的索引：类型和在原列表中的位置
+type budgetKey struct {
+	kind  string
+	index int
+}
+
+// budgetCandidate 参与token预算分配的一条记忆
+type budgetCandidate struct {
+	kind    string
+	id      string
+	index   int
+	content string
+}
+
+// fitTokenBudget 按优先级贪心填充token预算：先从最新的短期记忆开始，再按排序放入长期记忆
+// 放不下的第一条记忆在剩余预算足够时截断放入，之后的记忆全部丢弃；返回保留的记忆（截断后的内容）和装配报告
+func fitTokenBudget(shortTerm, longTerm []string, longTermIDs []string, maxTokens int) (map[budgetKey]string, *models.TokenBudgetReport) {
+	var candidates []budgetCandidate
+	for i := len(shortTerm) - 1; i >= 0; i-- {
+		candidates = append(candidates, budgetCandidate{kind: budgetItemShortTerm, index: i, content: shortTerm[i]})
+	}
+	for i, content := range longTerm {
+		candidate := budgetCandidate{kind: budgetItemLongTerm, index: i, content: content}
+		if i < len(longTermIDs) {
+			candidate.id = longTermIDs[i]
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	kept := make(map[budgetKey]string)
+	report := &models.TokenBudgetReport{MaxTokens: maxTokens, Included: []models.BudgetItem{}}
+	remaining := maxTokens
+	for _, candidate := range candidates {
+		item := models.BudgetItem{Kind: candidate.kind, ID: candidate.id, Index: candidate.index, Tokens: estimateTokens(candidate.content)}
+		content := candidate.content
+		if item.Tokens > remaining {
+			if remaining < minTruncatedItemTokens {
+				report.Dropped = append(report.Dropped, item)
+				remaining = 0
+				continue
+			}
+			content = truncateToTokens(content, remaining)
+			item.Tokens, item.Truncated = estimateTokens(content), true
+		}
+		remaining -= item.Tokens
+		report.UsedTokens += item.Tokens
+		report.Included = append(report.Included, item)
+		kept[budgetKey{candidate.kind, candidate.index}] = content
+	}
+	return kept, report
+}
+
+// applyTokenBudget 对最近对话和相关历史应用token预算
+// 返回保留的短期记忆、保留的长期记忆（可能被截断）及其在longTerm中的位置和装配报告；longTermIDs与longTerm一一对应
+func applyTokenBudget(maxTokens int, shortTerm, longTerm, longTermIDs []string) ([]string, []string, []int, *models.TokenBudgetReport) {
+	kept, report := fitTokenBudget(shortTerm, longTerm, longTermIDs, maxTokens)
+
+	var keptShort []string
+	for i := range shortTerm {
+		if content, ok := kept[budgetKey{budgetItemShortTerm, i}]; ok {
+			keptShort = append(keptShort, content)
+		}
+	}
+	var keptLong []string
+	var keptIndexes []int
+	for i := range longTerm {
+		if content, ok := kept[budgetKey{budgetItemLongTerm, i}]; ok {
+			keptLong = append(keptLong, content)
+			keptIndexes = append(keptIndexes, i)
+		}
+	}
+	return keptShort, keptLong, keptIndexes, report
+}
+
+// filterBudgetScores 只保留预算内长期记忆的得分明细
+func filterBudgetScores(report *models.TokenBudgetReport, hybrid []models.HybridScore, rerank []models.RerankScore) ([]models.HybridScore, []models.RerankScore) {
+	included := make(map[string]bool)
+	for _, item := range report.Included {
+		if item.Kind == budgetItemLongTerm {
+			included[item.ID] = true
+		}
+	}
+	var keptHybrid []models.HybridScore
+	for _, score := range hybrid {
+		if included[score.ID] {
+			keptHybrid = append(keptHybrid, score)
+		}
+	}
+	var keptRerank []models.RerankScore
+	for _, score := range rerank {
+		if included[score.ID] {
+			keptRerank = append(keptRerank, score)
+		}
+	}
+	return keptHybrid, keptRerank
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestEstimateTokens 测试汉字按字计数、英文按4字符计数
+func TestEstimateTokens(t *testing.T) {
+	cases := map[string]int{
+		"":              0,
+		"登录超时":          4,
+		"fix login bug": 3,
+		"修复login超时问题":   6 + 2,
+	}
+	for text, want := range cases {
+		if got := estimateTokens(text); got != want {
+			t.Errorf("estimateTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+	if got := truncateToTokens(strings.Repeat("记", 50), 10); estimateTokens(got) > 10 || !strings.HasSuffix(got, budgetTruncationSuffix) {
+		t.Errorf("Unexpected truncation: %q", got)
+	}
+}
+
+// TestApplyTokenBudget 测试优先保留最新的短期记忆，再按排序保留长期记忆，超出预算的截断或丢弃
+func TestApplyTokenBudget(t *testing.T) {
+	shortTerm := []string{strings.Repeat("旧", 30), strings.Repeat("新", 30)}
+	longTerm := []string{strings.Repeat("甲", 40), strings.Repeat("乙", 40), strings.Repeat("丙", 40)}
+	ids := []string{"m1", "m2", "m3"}
+
+	keptShort, keptLong, indexes, report := applyTokenBudget(120, shortTerm, longTerm, ids)
+
+	if len(keptShort) != 2 || keptShort[1] != shortTerm[1] {
+		t.Errorf("Expected both short-term memories kept, got %v", keptShort)
+	}
+	if len(keptLong) != 2 || keptLong[0] != longTerm[0] || indexes[1] != 1 || !strings.HasSuffix(keptLong[1], budgetTruncationSuffix) {
+		t.Errorf("Expected m1 kept and m2 truncated, got %v %v", keptLong, indexes)
+	}
+	if report.UsedTokens > 120 || len(report.Included) != 4 || len(report.Dropped) != 1 || report.Dropped[0].ID != "m3" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if !report.Included[3].Truncated || report.Included[0].Kind != budgetItemShortTerm || report.Included[0].Index != 1 {
+		t.Errorf("Unexpected included items: %+v", report.Included)
+	}
+
+	hybrid, rerank := filterBudgetScores(report, []models.HybridScore{{ID: "m1"}, {ID: "m3"}}, []models.RerankScore{{ID: "m3"}})
+	if len(hybrid) != 1 || hybrid[0].ID != "m1" || len(rerank) != 0 {
+		t.Errorf("Expected only in-budget scores, got %v %v", hybrid, rerank)
+	}
+}
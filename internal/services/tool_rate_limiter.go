@@ -0,0 +1,274 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/metrics"
+)
+
+// =============================================================================
+// MCP工具调用限流 - 按用户的令牌桶，用户总额度与单个工具额度同时生效
+// =============================================================================
+
+// rateLimitExemptTools 不受限流的工具：用户初始化阶段还没有用户ID
+var rateLimitExemptTools = map[string]bool{
+	"user_init_dialog": true,
+}
+
+// rateLimitSweepInterval 清理已回满的令牌桶的间隔，避免长期运行后桶数量无限增长
+const rateLimitSweepInterval = 5 * time.Minute
+
+// 限流范围
+const (
+	RateLimitScopeUser = "user" // 用户所有工具调用的总额度
+	RateLimitScopeTool = "tool" // 用户对单个工具的额度
+)
+
+// RateLimitError 工具调用超出限流时返回的错误
+type RateLimitError struct {
+	UserID     string
+	Tool       string
+	Scope      string
+	RetryAfter time.Duration
+}
+
+// Error 实现error接口
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("工具 %s 调用过于频繁（%s级限流），请在 %d 秒后重试", e.Tool, e.Scope, e.RetryAfterSeconds())
+}
+
+// Unwrap 关联限流错误码，便于客户端统一按错误码判断是否重试
+func (e *RateLimitError) Unwrap() error {
+	return apperrors.ErrRateLimited
+}
+
+// RetryAfterSeconds 建议的重试等待秒数，向上取整且至少为1
+func (e *RateLimitError) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// ToResponse 转换为返回给MCP客户端的结构化错误
+func (e *RateLimitError) ToResponse() map[string]interface{} {
+	return map[string]interface{}{
+		"success":    false,
+		"error":      "rate_limited",
+		"code":       string(apperrors.CodeRateLimited),
+		"message":    e.Error(),
+		"tool":       e.Tool,
+		"scope":      e.Scope,
+		"retryAfter": e.RetryAfterSeconds(),
+	}
+}
+
+// tokenBucket 令牌桶，tokens按rate每秒匀速补充，上限为capacity
+type tokenBucket struct {
+	tokens   float64
+	capacity float64
+	rate     float64
+	last     time.Time
+}
+
+// refill 按经过的时间补充令牌
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+// wait 距离下一个令牌可用的等待时间，调用前需先refill
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// toolRateLimiter 按用户和工具的限流器，并发安全
+type toolRateLimiter struct {
+	mu sync.Mutex
+
+	userPerMinute int            // 用户所有工具调用的每分钟额度，<=0表示不限制
+	userOverrides map[string]int // 指定用户的每分钟额度，<=0表示不限制
+	toolLimits    map[string]int // 单个工具的每用户每分钟额度，未配置的工具只受用户总额度限制
+	burst         int            // 令牌桶容量上限，允许的瞬时突发调用数
+
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// newToolRateLimiter 根据配置创建限流器，未启用时返回nil
+func newToolRateLimiter(cfg *config.Config) *toolRateLimiter {
+	if cfg == nil || !cfg.RateLimitEnabled {
+		return nil
+	}
+
+	userOverrides, err := parseRateLimitSpec(cfg.RateLimitUserOverrides)
+	if err != nil {
+		log.Printf("⚠️ [限流] 用户额度配置解析失败，忽略用户单独额度: %v", err)
+		userOverrides = map[string]int{}
+	}
+	toolLimits, err := parseRateLimitSpec(cfg.RateLimitToolLimits)
+	if err != nil {
+		log.Printf("⚠️ [限流] 工具额度配置解析失败，忽略工具单独额度: %v", err)
+		toolLimits = map[string]int{}
+	}
+
+	return &toolRateLimiter{
+		userPerMinute: cfg.RateLimitUserPerMinute,
+		userOverrides: userOverrides,
+		toolLimits:    toolLimits,
+		burst:         cfg.RateLimitBurst,
+		buckets:       make(map[string]*tokenBucket),
+		now:           time.Now,
+	}
+}
+
+// parseRateLimitSpec 解析 name=每分钟次数 格式的额度配置，逗号分隔
+func parseRateLimitSpec(spec string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("无效的限流配置: %s", item)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("无效的限流次数 %s: %w", item, err)
+		}
+		limits[strings.TrimSpace(parts[0])] = limit
+	}
+	return limits, nil
+}
+
+// allow 检查并消耗一次调用额度，超出时不消耗任何桶并返回限流错误
+func (l *toolRateLimiter) allow(userID, tool string) *RateLimitError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	userLimit := l.userPerMinute
+	if override, ok := l.userOverrides[userID]; ok {
+		userLimit = override
+	}
+
+	type scopedBucket struct {
+		scope  string
+		bucket *tokenBucket
+	}
+	var checked []scopedBucket
+	if userLimit > 0 {
+		checked = append(checked, scopedBucket{RateLimitScopeUser, l.bucket(userID, userLimit, now)})
+	}
+	if toolLimit := l.toolLimits[tool]; toolLimit > 0 {
+		checked = append(checked, scopedBucket{RateLimitScopeTool, l.bucket(userID+"\x00"+tool, toolLimit, now)})
+	}
+
+	// 所有桶都有额度时才一起扣减，避免被拒绝的调用占用另一个桶的额度
+	var limited *RateLimitError
+	for _, c := range checked {
+		if wait := c.bucket.wait(); wait > 0 && (limited == nil || wait > limited.RetryAfter) {
+			limited = &RateLimitError{UserID: userID, Tool: tool, Scope: c.scope, RetryAfter: wait}
+		}
+	}
+	if limited != nil {
+		return limited
+	}
+	for _, c := range checked {
+		c.bucket.tokens--
+	}
+	return nil
+}
+
+// bucket 获取令牌桶并补充到当前时间，不存在时创建满桶；调用方需持有锁
+func (l *toolRateLimiter) bucket(key string, perMinute int, now time.Time) *tokenBucket {
+	capacity := float64(perMinute)
+	if l.burst > 0 && float64(l.burst) < capacity {
+		capacity = float64(l.burst)
+	}
+	rate := float64(perMinute) / 60
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	// 配置可能随用户额度覆盖变化，每次按当前额度更新
+	b.capacity = capacity
+	b.rate = rate
+	b.refill(now)
+	return b
+}
+
+// sweep 删除已回满的令牌桶，回满的桶与新建的桶等价；调用方需持有锁
+func (l *toolRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= b.capacity {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// CheckToolRateLimit 检查工具调用是否超出限流，超出时返回*RateLimitError
+// 用户ID按会话绑定的用户、参数中的userId、defaultUserID的顺序解析
+// 限流未启用、用户ID未知（如用户初始化流程）或工具豁免时不限流
+func (s *ContextService) CheckToolRateLimit(tool string, params map[string]interface{}, defaultUserID string) error {
+	if s.toolRateLimiter == nil || rateLimitExemptTools[tool] {
+		return nil
+	}
+
+	userID := s.toolCallUserID(params)
+	if userID == "" {
+		userID = defaultUserID
+	}
+	if userID == "" {
+		return nil
+	}
+
+	if limited := s.toolRateLimiter.allow(userID, tool); limited != nil {
+		log.Printf("🚦 [限流] 用户 %s 调用工具 %s 超出%s级额度，建议 %d 秒后重试",
+			userID, tool, limited.Scope, limited.RetryAfterSeconds())
+		metrics.ToolRateLimited.Inc(tool, limited.Scope)
+		return limited
+	}
+	return nil
+}
+
+// toolCallUserID 解析工具调用所属的用户ID，优先使用会话绑定的用户，其次使用参数中的userId
+func (s *ContextService) toolCallUserID(params map[string]interface{}) string {
+	if sessionID, ok := params["sessionId"].(string); ok && sessionID != "" {
+		if userID, err := s.GetUserIDFromSessionID(sessionID); err == nil && userID != "" {
+			return userID
+		}
+	}
+	if userID, ok := params["userId"].(string); ok {
+		return userID
+	}
+	return ""
+}
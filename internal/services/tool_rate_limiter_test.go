@@ -0,0 +1,111 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/config"
+)
+
+// newTestToolRateLimiter 创建使用可控时钟的限流器
+func newTestToolRateLimiter(cfg *config.Config, now *time.Time) *toolRateLimiter {
+	cfg.RateLimitEnabled = true
+	limiter := newToolRateLimiter(cfg)
+	limiter.now = func() time.Time { return *now }
+	return limiter
+}
+
+// TestToolRateLimiterToolLimit 测试单个工具额度耗尽后返回retryAfter，并随时间恢复
+func TestToolRateLimiterToolLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newTestToolRateLimiter(&config.Config{
+		RateLimitUserPerMinute: 120,
+		RateLimitToolLimits:    "store_conversation=2",
+	}, &now)
+
+	for i := 0; i < 2; i++ {
+		if limited := limiter.allow("user_a", "store_conversation"); limited != nil {
+			t.Fatalf("Call %d should be allowed, got %v", i, limited)
+		}
+	}
+
+	limited := limiter.allow("user_a", "store_conversation")
+	if limited == nil {
+		t.Fatal("Expected third call to be rate limited")
+	}
+	if limited.Scope != RateLimitScopeTool {
+		t.Errorf("Expected tool scope, got %s", limited.Scope)
+	}
+	// 2次/分钟即每30秒补充一个令牌
+	if limited.RetryAfterSeconds() != 30 {
+		t.Errorf("Expected retryAfter 30s, got %d", limited.RetryAfterSeconds())
+	}
+	if limited.ToResponse()["retryAfter"] != 30 {
+		t.Errorf("Expected retryAfter in response, got %v", limited.ToResponse())
+	}
+
+	// 其他工具和其他用户不受影响
+	if limited := limiter.allow("user_a", "retrieve_context"); limited != nil {
+		t.Errorf("Expected other tool to be allowed, got %v", limited)
+	}
+	if limited := limiter.allow("user_b", "store_conversation"); limited != nil {
+		t.Errorf("Expected other user to be allowed, got %v", limited)
+	}
+
+	now = now.Add(30 * time.Second)
+	if limited := limiter.allow("user_a", "store_conversation"); limited != nil {
+		t.Errorf("Expected call to be allowed after refill, got %v", limited)
+	}
+}
+
+// TestToolRateLimiterUserOverride 测试用户总额度与单独额度覆盖
+func TestToolRateLimiterUserOverride(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newTestToolRateLimiter(&config.Config{
+		RateLimitUserPerMinute: 1,
+		RateLimitUserOverrides: "vip=0",
+	}, &now)
+
+	if limited := limiter.allow("user_a", "retrieve_context"); limited != nil {
+		t.Fatalf("First call should be allowed, got %v", limited)
+	}
+	limited := limiter.allow("user_a", "list_memories")
+	if limited == nil || limited.Scope != RateLimitScopeUser {
+		t.Fatalf("Expected user scope limit, got %v", limited)
+	}
+
+	for i := 0; i < 10; i++ {
+		if limited := limiter.allow("vip", "retrieve_context"); limited != nil {
+			t.Fatalf("Unlimited user should not be limited, got %v", limited)
+		}
+	}
+}
+
+// TestCheckToolRateLimitSkipsUnknownUser 测试未启用、用户未知和豁免工具时不限流
+func TestCheckToolRateLimitSkipsUnknownUser(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	service := &ContextService{toolRateLimiter: newTestToolRateLimiter(&config.Config{
+		RateLimitUserPerMinute: 1,
+	}, &now)}
+
+	for i := 0; i < 3; i++ {
+		if err := service.CheckToolRateLimit("user_init_dialog", map[string]interface{}{"userId": "user_a"}, ""); err != nil {
+			t.Fatalf("Exempt tool should not be limited: %v", err)
+		}
+		if err := service.CheckToolRateLimit("retrieve_context", map[string]interface{}{}, ""); err != nil {
+			t.Fatalf("Unknown user should not be limited: %v", err)
+		}
+	}
+
+	if err := service.CheckToolRateLimit("retrieve_context", map[string]interface{}{}, "user_a"); err != nil {
+		t.Fatalf("First call should be allowed: %v", err)
+	}
+	err := service.CheckToolRateLimit("retrieve_context", map[string]interface{}{"userId": "user_a"}, "")
+	if _, ok := err.(*RateLimitError); !ok {
+		t.Fatalf("Expected *RateLimitError, got %v", err)
+	}
+
+	if err := (&ContextService{}).CheckToolRateLimit("retrieve_context", map[string]interface{}{"userId": "user_a"}, ""); err != nil {
+		t.Errorf("Disabled limiter should not limit: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 清除用户向量记录时每轮扫描的记录数和最多扫描轮数
+const (
+	purgeVectorScanLimit  = 1000
+	purgeVectorScanRounds = 100
+)
+
+// ErrPurgeUserConflict 用户的记忆重建或数据清除正在进行
+var ErrPurgeUserConflict = errors.New("该用户的记忆重建或数据清除正在进行，请稍后重试")
+
+// PurgeUser 清除用户在会话存储、向量存储、时间线和知识图谱中的全部数据，返回各后端的清除结果
+// 单个后端失败不影响其他后端，结果中complete为false时可重新执行；已清除的数据再次执行时删除数为0
+func (s *ContextService) PurgeUser(ctx context.Context, userID string) (*models.PurgeUserReport, error) {
+	if userID == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	// 与记忆重建共用任务标记，避免清除过程中重建任务重新写入向量
+	if !s.acquireReindex(userID) {
+		return nil, ErrPurgeUserConflict
+	}
+	defer s.releaseReindex(userID)
+
+	log.Printf("🗑️ [清除用户] 开始清除用户 %s 的全部数据", userID)
+	report := &models.PurgeUserReport{UserID: userID, Complete: true}
+	for _, purge := range []func(context.Context, string) models.PurgeBackendReport{
+		s.purgeUserVectors,
+		s.purgeUserTimeline,
+		s.purgeUserKnowledgeGraph,
+		s.purgeUserSessionStore,
+	} {
+		backend := purge(ctx, userID)
+		if backend.Status == models.BackendStatusError {
+			report.Complete = false
+			log.Printf("❌ [清除用户] %s 清除失败: %s", backend.Backend, backend.Error)
+		}
+		report.Backends = append(report.Backends, backend)
+	}
+	report.PurgedAt = time.Now()
+
+	log.Printf("✅ [清除用户] 用户 %s 清除结束, complete=%v", userID, report.Complete)
+	return report, nil
+}
+
+// purgeUserVectors 分轮扫描并删除用户的向量记录，直到扫描不到新的记录
+func (s *ContextService) purgeUserVectors(ctx context.Context, userID string) models.PurgeBackendReport {
+	report := models.PurgeBackendReport{Backend: models.PurgeBackendVector, Status: models.BackendStatusOK}
+	if s.vectorStore == nil && s.vectorService == nil {
+		report.Status = models.BackendStatusDisabled
+		return report
+	}
+
+	deleted := make(map[string]bool)
+	for round := 0; round < purgeVectorScanRounds; round++ {
+		records, err := s.searchByUserID(ctx, userID, purgeVectorScanLimit)
+		if err != nil {
+			return purgeFailed(report, fmt.Errorf("扫描用户向量记录失败: %w", err))
+		}
+
+		// 部分向量存储不支持按用户过滤，这里再次校验用户；删除后仍返回的记录不重复删除
+		var ids []string
+		for _, record := range records {
+			if getResultUserID(record) == userID && !deleted[record.ID] {
+				ids = append(ids, record.ID)
+			}
+		}
+		if len(ids) == 0 {
+			return report
+		}
+
+		if err := s.deleteMemories(ctx, ids); err != nil {
+			return purgeFailed(report, fmt.Errorf("删除用户向量记录失败: %w", err))
+		}
+		for _, id := range ids {
+			deleted[id] = true
+		}
+		report.Removed += len(ids)
+	}
+	return purgeFailed(report, fmt.Errorf("扫描%d轮后仍有未删除的向量记录", purgeVectorScanRounds))
+}
+
+// purgeUserTimeline 删除用户的全部时间线事件
+func (s *ContextService) purgeUserTimeline(ctx context.Context, userID string) models.PurgeBackendReport {
+	report := models.PurgeBackendReport{Backend: models.PurgeBackendTimeline, Status: models.BackendStatusOK}
+	timescaleConfig := s.getTimescaleDBConfig()
+	if timescaleConfig == nil {
+		report.Status = models.BackendStatusDisabled
+		return report
+	}
+
+	timelineEngine, err := s.getTimelineEngine(ctx, timescaleConfig)
+	if err != nil {
+		return purgeFailed(report, err)
+	}
+	deleted, err := timelineEngine.DeleteUserEvents(ctx, userID)
+	if err != nil {
+		return purgeFailed(report, err)
+	}
+	report.Removed = int(deleted)
+	return report
+}
+
+// purgeUserKnowledgeGraph 删除用户独有的概念和关系，共享的只移除该用户归属
+func (s *ContextService) purgeUserKnowledgeGraph(ctx context.Context, userID string) models.PurgeBackendReport {
+	report := models.PurgeBackendReport{Backend: models.PurgeBackendKnowledgeGraph, Status: models.BackendStatusOK}
+	neo4jConfig := s.getNeo4jConfig()
+	if neo4jConfig == nil {
+		report.Status = models.BackendStatusDisabled
+		return report
+	}
+
+	knowledgeEngine, err := s.getKnowledgeEngine(ctx, neo4jConfig)
+	if err != nil {
+		return purgeFailed(report, err)
+	}
+	counts, err := knowledgeEngine.PurgeUser(ctx, userID)
+	report.Removed = counts.Concepts + counts.Relations + counts.Users
+	report.Detached = counts.SharedConcepts + counts.SharedRelations
+	if err != nil {
+		return purgeFailed(report, err)
+	}
+	return report
+}
+
+// purgeUserSessionStore 删除用户的会话存储目录和记忆重建进度文件
+func (s *ContextService) purgeUserSessionStore(ctx context.Context, userID string) models.PurgeBackendReport {
+	report := models.PurgeBackendReport{Backend: models.PurgeBackendSessionStore, Status: models.BackendStatusOK}
+	if s.userSessionManager == nil {
+		report.Status = models.BackendStatusDisabled
+		return report
+	}
+
+	removed, err := s.userSessionManager.PurgeUserStore(userID)
+	if err != nil {
+		return purgeFailed(report, err)
+	}
+	report.Removed = removed
+
+	if path := s.reindexStatePath(userID); path != "" {
+		err := os.Remove(path)
+		if err == nil {
+			report.Removed++
+		} else if !os.IsNotExist(err) {
+			return purgeFailed(report, fmt.Errorf("删除记忆重建进度文件失败: %w", err))
+		}
+	}
+	return report
+}
+
+// purgeFailed 标记后端清除失败，已删除的计数保留
+func purgeFailed(report models.PurgeBackendReport, err error) models.PurgeBackendReport {
+	report.Status = models.BackendStatusError
+	report.Error = err.Error()
+	return report
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/config"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// purgeTestStore 按页返回记录并记录删除操作的向量存储，未覆盖的方法不会被调用
+type purgeTestStore struct {
+	models.VectorStore
+	records []models.SearchResult
+	deleted []string
+}
+
+func (f *purgeTestStore) GetProvider() models.VectorStoreType { return models.VectorStoreTypeQdrant }
+
+func (f *purgeTestStore) SearchByFilter(ctx context.Context, filter string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	if len(f.records) > options.Limit {
+		return append([]models.SearchResult(nil), f.records[:options.Limit]...), nil
+	}
+	return append([]models.SearchResult(nil), f.records...), nil
+}
+
+func (f *purgeTestStore) DeleteMemories(ctx context.Context, ids []string) error {
+	f.deleted = append(f.deleted, ids...)
+	remove := make(map[string]bool)
+	for _, id := range ids {
+		remove[id] = true
+	}
+	remaining := f.records[:0]
+	for _, record := range f.records {
+		if !remove[record.ID] {
+			remaining = append(remaining, record)
+		}
+	}
+	f.records = remaining
+	return nil
+}
+
+// TestPurgeUserVectorsAndSessionStore 测试只删除该用户的向量记录和会话目录，重复执行时删除数为0
+func TestPurgeUserVectorsAndSessionStore(t *testing.T) {
+	vectorStore := &purgeTestStore{records: []models.SearchResult{
+		{ID: "mem-1", Fields: map[string]interface{}{"userId": "user_a"}},
+		{ID: "mem-2", Fields: map[string]interface{}{"userId": "user_b"}},
+		{ID: "msg-1", Fields: map[string]interface{}{"userId": "user_a", "role": "user"}},
+	}}
+	storagePath := t.TempDir()
+	manager := store.NewUserSessionManager(storagePath)
+	sessionStore, err := manager.GetUserSessionStore("user_a")
+	if err != nil {
+		t.Fatalf("创建用户会话存储失败: %v", err)
+	}
+	if err := sessionStore.SaveSession(models.NewSession("session_1")); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	service := &ContextService{
+		vectorStore:        vectorStore,
+		userSessionManager: manager,
+		config:             &config.Config{StoragePath: storagePath},
+	}
+
+	vectors := service.purgeUserVectors(context.Background(), "user_a")
+	if vectors.Status != models.BackendStatusOK || vectors.Removed != 2 || len(vectorStore.records) != 1 {
+		t.Errorf("向量清除结果错误: %+v, 剩余: %+v", vectors, vectorStore.records)
+	}
+	sessions := service.purgeUserSessionStore(context.Background(), "user_a")
+	if sessions.Status != models.BackendStatusOK || sessions.Removed == 0 {
+		t.Errorf("会话存储清除结果错误: %+v", sessions)
+	}
+	if _, err := os.Stat(filepath.Join(storagePath, "users", "user_a")); !os.IsNotExist(err) {
+		t.Errorf("用户会话目录应已删除: %v", err)
+	}
+
+	// 重复执行不报错，删除数为0
+	if again := service.purgeUserVectors(context.Background(), "user_a"); again.Status != models.BackendStatusOK || again.Removed != 0 {
+		t.Errorf("重复清除向量结果错误: %+v", again)
+	}
+	if again := service.purgeUserSessionStore(context.Background(), "user_a"); again.Status != models.BackendStatusOK || again.Removed != 0 {
+		t.Errorf("重复清除会话存储结果错误: %+v", again)
+	}
+	if failed := service.purgeUserSessionStore(context.Background(), "../user_b"); failed.Status != models.BackendStatusError {
+		t.Errorf("应拒绝跳出用户目录的用户ID: %+v", failed)
+	}
+}
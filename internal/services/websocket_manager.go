@@ -13,10 +13,11 @@ import (
 
 // WebSocket连接管理器
 type WebSocketManager struct {
-	connections         map[string]*websocket.Conn            // connectionID -> WebSocket连接
-	userToConnections   map[string][]string                   // userID -> []connectionID (支持一个用户多个连接)
-	sessionToConnection map[string]string                     // sessionID -> connectionID (精确定向推送)
-	callbacks           map[string]chan models.CallbackResult // callbackID -> 结果通道
+	connections         map[string]*websocket.Conn              // connectionID -> WebSocket连接
+	userToConnections   map[string][]string                     // userID -> []connectionID (支持一个用户多个连接)
+	sessionToConnection map[string]string                       // sessionID -> connectionID (精确定向推送)
+	callbacks           map[string]chan models.CallbackResult   // callbackID -> 结果通道
+	pending             map[string][]*models.PendingInstruction // userID -> 待确认的本地指令
 	mutex               sync.RWMutex
 }
 
@@ -26,6 +27,7 @@ var GlobalWSManager = &WebSocketManager{
 	userToConnections:   make(map[string][]string),
 	sessionToConnection: make(map[string]string),
 	callbacks:           make(map[string]chan models.CallbackResult),
+	pending:             make(map[string][]*models.PendingInstruction),
 }
 
 // 用户连接注册 - 支持工作空间级别的连接隔离
@@ -81,6 +83,9 @@ func (wsm *WebSocketManager) RegisterUser(connectionID string, conn *websocket.C
 
 	// 启动连接监听
 	go wsm.handleConnection(connectionID, conn)
+
+	// 重新推送断线期间未确认的指令
+	go wsm.redeliverPending(userID)
 }
 
 // 🔥 简化：从连接ID中提取用户ID
@@ -341,6 +346,9 @@ func (wsm *WebSocketManager) PushInstruction(userID string, instruction models.L
 
 // 处理回调结果
 func (wsm *WebSocketManager) HandleCallback(callbackID string, result models.CallbackResult) {
+	// 超时后才到达的回调同样视为确认
+	wsm.ackPending(callbackID)
+
 	wsm.mutex.RLock()
 	callbackChan, exists := wsm.callbacks[callbackID]
 	wsm.mutex.RUnlock()
@@ -501,10 +509,16 @@ func (wsm *WebSocketManager) GetConnectionStats() map[string]interface{} {
 	wsm.mutex.RLock()
 	defer wsm.mutex.RUnlock()
 
+	pendingCount := 0
+	for _, queue := range wsm.pending {
+		pendingCount += len(queue)
+	}
+
 	stats := map[string]interface{}{
-		"total_connections": len(wsm.connections),
-		"online_users":      len(wsm.userToConnections),
-		"user_connections":  make(map[string]int),
+		"total_connections":    len(wsm.connections),
+		"online_users":         len(wsm.userToConnections),
+		"user_connections":     make(map[string]int),
+		"pending_instructions": pendingCount,
 	}
 
 	for userID, connections := range wsm.userToConnections {
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// 待确认本地指令的队列上限、推送次数上限、回调等待时间和保留时间
+const (
+	maxPendingInstructionsPerUser  = 100
+	maxInstructionDeliveryAttempts = 3
+	instructionCallbackTimeout     = 30 * time.Second
+	pendingInstructionTTL          = 24 * time.Hour
+)
+
+// DeliverInstruction 推送本地指令并登记为待确认，客户端断线或未确认时在重连后重新推送
+// 优先按会话精确推送，失败时回退到用户级推送；返回是否已推送到在线连接
+func (wsm *WebSocketManager) DeliverInstruction(sessionID, userID string, instruction models.LocalInstruction) bool {
+	wsm.enqueuePending(userID, sessionID, instruction)
+	return wsm.attemptDelivery(userID, instruction.CallbackID)
+}
+
+// GetPendingInstructions 获取用户尚未确认的本地指令，供客户端补拉断线期间错过的指令
+func (wsm *WebSocketManager) GetPendingInstructions(userID string) []models.PendingInstruction {
+	wsm.mutex.Lock()
+	defer wsm.mutex.Unlock()
+
+	wsm.pruneExpiredPendingLocked(userID)
+	result := make([]models.PendingInstruction, 0, len(wsm.pending[userID]))
+	for _, entry := range wsm.pending[userID] {
+		result = append(result, *entry)
+	}
+	return result
+}
+
+// PendingInstructionCount 所有用户待确认本地指令的总数
+func (wsm *WebSocketManager) PendingInstructionCount() int {
+	wsm.mutex.RLock()
+	defer wsm.mutex.RUnlock()
+
+	count := 0
+	for _, queue := range wsm.pending {
+		count += len(queue)
+	}
+	return count
+}
+
+// enqueuePending 登记待确认指令，队列已满时丢弃最早的指令
+func (wsm *WebSocketManager) enqueuePending(userID, sessionID string, instruction models.LocalInstruction) {
+	wsm.mutex.Lock()
+	defer wsm.mutex.Unlock()
+
+	if wsm.pending == nil {
+		wsm.pending = make(map[string][]*models.PendingInstruction)
+	}
+	wsm.pruneExpiredPendingLocked(userID)
+
+	queue := wsm.pending[userID]
+	if len(queue) >= maxPendingInstructionsPerUser {
+		log.Printf("[WebSocket] ⚠️ 用户 %s 的待确认指令已达上限 %d，丢弃最早的指令: %s",
+			userID, maxPendingInstructionsPerUser, queue[0].Instruction.CallbackID)
+		queue = queue[1:]
+	}
+	wsm.pending[userID] = append(queue, &models.PendingInstruction{
+		Instruction: instruction,
+		SessionID:   sessionID,
+		CreatedAt:   time.Now(),
+	})
+}
+
+// attemptDelivery 推送一条待确认指令，推送次数达到上限时不再推送并移出队列
+// 用户不在线时不计入推送次数
+func (wsm *WebSocketManager) attemptDelivery(userID, callbackID string) bool {
+	wsm.mutex.Lock()
+	entry := wsm.findPendingLocked(userID, callbackID)
+	if entry == nil {
+		wsm.mutex.Unlock()
+		return false
+	}
+	if entry.Attempts >= maxInstructionDeliveryAttempts {
+		wsm.removePendingLocked(userID, callbackID)
+		wsm.mutex.Unlock()
+		log.Printf("[WebSocket] ❌ 本地指令推送 %d 次仍未确认，放弃: %s", entry.Attempts, callbackID)
+		return false
+	}
+	instruction := entry.Instruction
+	sessionID := entry.SessionID
+	wsm.mutex.Unlock()
+
+	var callbackChan chan models.CallbackResult
+	if sessionID != "" {
+		if sessionChan, sessionErr := wsm.PushInstructionToSession(sessionID, instruction); sessionErr == nil {
+			callbackChan = sessionChan
+		} else {
+			log.Printf("[WebSocket] 精确推送失败 (会话 %s 未注册)，回退到用户级别推送: %v", sessionID, sessionErr)
+		}
+	}
+	if callbackChan == nil {
+		userChan, userErr := wsm.PushInstruction(userID, instruction)
+		if userErr != nil {
+			log.Printf("[WebSocket] 推送指令失败: %v, 指令保留待重连后推送: %s", userErr, callbackID)
+			return false
+		}
+		callbackChan = userChan
+	}
+
+	wsm.mutex.Lock()
+	if entry := wsm.findPendingLocked(userID, callbackID); entry != nil {
+		now := time.Now()
+		entry.Attempts++
+		entry.LastAttemptAt = &now
+	}
+	wsm.mutex.Unlock()
+
+	go wsm.awaitCallback(userID, callbackID, callbackChan)
+	return true
+}
+
+// awaitCallback 等待客户端回调，超时后清理回调通道，避免客户端从不确认时通道和协程泄漏
+func (wsm *WebSocketManager) awaitCallback(userID, callbackID string, callbackChan chan models.CallbackResult) {
+	select {
+	case callbackResult := <-callbackChan:
+		log.Printf("[WebSocket] 本地指令执行完成: %s - %s", callbackID, callbackResult.Message)
+		return
+	case <-time.After(instructionCallbackTimeout):
+	}
+
+	wsm.mutex.Lock()
+	defer wsm.mutex.Unlock()
+
+	// 重新推送时会注册新通道，只清理本次推送的通道；不关闭通道，避免与并发到达的回调竞争
+	if current, exists := wsm.callbacks[callbackID]; exists && current == callbackChan {
+		delete(wsm.callbacks, callbackID)
+	}
+
+	entry := wsm.findPendingLocked(userID, callbackID)
+	if entry == nil {
+		return
+	}
+	if entry.Attempts >= maxInstructionDeliveryAttempts {
+		wsm.removePendingLocked(userID, callbackID)
+		log.Printf("[WebSocket] ❌ 本地指令执行超时且已达推送上限 %d 次，放弃: %s", maxInstructionDeliveryAttempts, callbackID)
+		return
+	}
+	log.Printf("[WebSocket] 本地指令执行超时，保留待重连后推送: %s (已推送 %d 次)", callbackID, entry.Attempts)
+}
+
+// redeliverPending 用户重连后重新推送未确认的指令
+func (wsm *WebSocketManager) redeliverPending(userID string) {
+	wsm.mutex.Lock()
+	wsm.pruneExpiredPendingLocked(userID)
+	callbackIDs := make([]string, 0, len(wsm.pending[userID]))
+	for _, entry := range wsm.pending[userID] {
+		callbackIDs = append(callbackIDs, entry.Instruction.CallbackID)
+	}
+	wsm.mutex.Unlock()
+
+	if len(callbackIDs) == 0 {
+		return
+	}
+
+	log.Printf("[WebSocket] 🔁 用户 %s 重连，重新推送 %d 条未确认指令", userID, len(callbackIDs))
+	for _, callbackID := range callbackIDs {
+		wsm.attemptDelivery(userID, callbackID)
+	}
+}
+
+// ackPending 收到回调后将指令移出待确认队列
+func (wsm *WebSocketManager) ackPending(callbackID string) {
+	wsm.mutex.Lock()
+	defer wsm.mutex.Unlock()
+
+	for userID := range wsm.pending {
+		if wsm.removePendingLocked(userID, callbackID) {
+			return
+		}
+	}
+}
+
+// findPendingLocked 查找待确认指令，调用方需持有锁
+func (wsm *WebSocketManager) findPendingLocked(userID, callbackID string) *models.PendingInstruction {
+	for _, entry := range wsm.pending[userID] {
+		if entry.Instruction.CallbackID == callbackID {
+			return entry
+		}
+	}
+	return nil
+}
+
+// removePendingLocked 移除待确认指令，调用方需持有锁
+func (wsm *WebSocketManager) removePendingLocked(userID, callbackID string) bool {
+	queue := wsm.pending[userID]
+	for i, entry := range queue {
+		if entry.Instruction.CallbackID != callbackID {
+			continue
+		}
+		queue = append(queue[:i], queue[i+1:]...)
+		if len(queue) == 0 {
+			delete(wsm.pending, userID)
+		} else {
+			wsm.pending[userID] = queue
+		}
+		return true
+	}
+	return false
+}
+
+// pruneExpiredPendingLocked 清理超过保留时间的待确认指令，调用方需持有锁
+func (wsm *WebSocketManager) pruneExpiredPendingLocked(userID string) {
+	queue := wsm.pending[userID]
+	if len(queue) == 0 {
+		return
+	}
+
+	cutoff := time.Now().Add(-pendingInstructionTTL)
+	kept := queue[:0]
+	for _, entry := range queue {
+		if entry.CreatedAt.After(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == 0 {
+		delete(wsm.pending, userID)
+	} else {
+		wsm.pending[userID] = kept
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+// newTestWSManager 创建没有任何连接的WebSocket管理器
+func newTestWSManager() *WebSocketManager {
+	return &WebSocketManager{
+		connections:         make(map[string]*websocket.Conn),
+		userToConnections:   make(map[string][]string),
+		sessionToConnection: make(map[string]string),
+		callbacks:           make(map[string]chan models.CallbackResult),
+	}
+}
+
+// TestPendingInstructionsKeptUntilAck 测试离线时指令保留在队列中，收到回调（包括超时后到达的回调）后移除
+func TestPendingInstructionsKeptUntilAck(t *testing.T) {
+	wsm := newTestWSManager()
+
+	if wsm.DeliverInstruction("session_1", "user_a", models.LocalInstruction{Type: models.LocalInstructionShortMemory, CallbackID: "cb-1"}) {
+		t.Fatal("Expected delivery to fail while user is offline")
+	}
+	wsm.DeliverInstruction("session_1", "user_a", models.LocalInstruction{Type: models.LocalInstructionShortMemory, CallbackID: "cb-2"})
+
+	pending := wsm.GetPendingInstructions("user_a")
+	if len(pending) != 2 || pending[0].Instruction.CallbackID != "cb-1" || pending[0].Attempts != 0 {
+		t.Fatalf("Expected 2 pending instructions without attempts, got %+v", pending)
+	}
+	if wsm.PendingInstructionCount() != 2 || wsm.GetConnectionStats()["pending_instructions"] != 2 {
+		t.Errorf("Expected queue depth 2, got %d", wsm.PendingInstructionCount())
+	}
+
+	wsm.HandleCallback("cb-1", models.CallbackResult{Success: true, Timestamp: time.Now()})
+	if pending := wsm.GetPendingInstructions("user_a"); len(pending) != 1 || pending[0].Instruction.CallbackID != "cb-2" {
+		t.Errorf("Expected cb-1 acknowledged, got %+v", pending)
+	}
+}
+
+// TestPendingInstructionsBounded 测试队列长度和推送次数都有上限
+func TestPendingInstructionsBounded(t *testing.T) {
+	wsm := newTestWSManager()
+
+	for i := 0; i < maxPendingInstructionsPerUser+5; i++ {
+		wsm.enqueuePending("user_a", "", models.LocalInstruction{CallbackID: fmt.Sprintf("cb-%d", i)})
+	}
+	pending := wsm.GetPendingInstructions("user_a")
+	if len(pending) != maxPendingInstructionsPerUser || pending[0].Instruction.CallbackID != "cb-5" {
+		t.Fatalf("Expected oldest instructions dropped, got %d starting at %s", len(pending), pending[0].Instruction.CallbackID)
+	}
+
+	wsm.mutex.Lock()
+	wsm.findPendingLocked("user_a", "cb-5").Attempts = maxInstructionDeliveryAttempts
+	wsm.mutex.Unlock()
+	if wsm.attemptDelivery("user_a", "cb-5") {
+		t.Error("Expected delivery to stop after max attempts")
+	}
+	if len(wsm.GetPendingInstructions("user_a")) != maxPendingInstructionsPerUser-1 {
+		t.Error("Expected instruction exceeding max attempts to be dropped")
+	}
+}
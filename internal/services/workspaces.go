@@ -0,0 +1,161 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/internal/utils"
+)
+
+// =============================================================================
+// 工作空间列表与切换：工作空间由用户会话元数据中的workspaceHash/workspacePath归纳，
+// 名称与extractWorkspaceName一致取路径最后一级目录，哈希与GenerateWorkspaceHash一致
+// =============================================================================
+
+// workspaceSession 带工作空间标识的用户会话及其所在存储
+type workspaceSession struct {
+	store   *store.SessionStore
+	session *models.Session
+	hash    string
+	path    string
+}
+
+// userWorkspaceSessions 收集用户专属存储和全局存储中属于该用户且带工作空间标识的会话
+// stdio在用户专属存储中创建会话，HTTP在全局存储中创建会话，两处都需要扫描；全局存储按元数据userId过滤
+func (s *ContextService) userWorkspaceSessions(userID string) ([]workspaceSession, error) {
+	if userID == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("用户ID不能为空")
+	}
+
+	userSessionStore, err := s.GetUserSessionStore(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var sessions []workspaceSession
+	for _, sessionStore := range []*store.SessionStore{userSessionStore, s.sessionStore} {
+		if sessionStore == nil {
+			continue
+		}
+		for _, listed := range sessionStore.GetSessionList() {
+			if seen[listed.ID] {
+				continue
+			}
+			// 使用快照读取元数据，避免与并发写入会话的请求竞争
+			session, err := sessionStore.GetSessionSnapshot(listed.ID)
+			if err != nil || session.Metadata == nil {
+				continue
+			}
+			ownerID, _ := session.Metadata["userId"].(string)
+			if ownerID != userID && (ownerID != "" || sessionStore != userSessionStore) {
+				continue
+			}
+
+			hash, _ := session.Metadata["workspaceHash"].(string)
+			path, _ := session.Metadata["workspacePath"].(string)
+			if hash == "" && path != "" {
+				hash = utils.GenerateWorkspaceHash(path)
+			}
+			if hash == "" {
+				continue
+			}
+			seen[session.ID] = true
+			sessions = append(sessions, workspaceSession{store: sessionStore, session: session, hash: hash, path: path})
+		}
+	}
+	return sessions, nil
+}
+
+// ListWorkspaces 返回用户会话涉及的工作空间，按最近活跃时间倒序
+func (s *ContextService) ListWorkspaces(userID string) ([]models.WorkspaceInfo, error) {
+	sessions, err := s.userWorkspaceSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byHash := make(map[string]*models.WorkspaceInfo)
+	activeSince := make(map[string]time.Time)
+	for _, ws := range sessions {
+		info, exists := byHash[ws.hash]
+		if !exists {
+			info = &models.WorkspaceInfo{Hash: ws.hash}
+			byHash[ws.hash] = info
+		}
+		info.SessionCount++
+		if info.Path == "" {
+			info.Path = ws.path
+		}
+		if ws.session.LastActive.After(info.LastActive) {
+			info.LastActive = ws.session.LastActive
+		}
+		if ws.session.Status == models.SessionStatusActive && ws.session.LastActive.After(activeSince[ws.hash]) {
+			info.ActiveSessionID = ws.session.ID
+			activeSince[ws.hash] = ws.session.LastActive
+		}
+	}
+
+	workspaces := make([]models.WorkspaceInfo, 0, len(byHash))
+	for _, info := range byHash {
+		info.Name = info.Hash
+		if info.Path != "" {
+			info.Name = utils.ExtractWorkspaceNameFromPath(info.Path)
+		}
+		workspaces = append(workspaces, *info)
+	}
+	sort.Slice(workspaces, func(i, j int) bool {
+		return workspaces[i].LastActive.After(workspaces[j].LastActive)
+	})
+
+	log.Printf("📂 [工作空间] 用户 %s 共有 %d 个工作空间", userID, len(workspaces))
+	return workspaces, nil
+}
+
+// SwitchWorkspace 切换到指定工作空间，返回该工作空间最近活跃的活跃会话并刷新其活跃时间
+// workspace可以是工作空间哈希或工作空间根路径；没有活跃会话时返回ErrSessionNotFound，由客户端改用get_or_create创建
+func (s *ContextService) SwitchWorkspace(userID, workspace string) (*models.Session, error) {
+	if workspace == "" {
+		return nil, apperrors.ErrInvalidArgument.WithMessagef("workspaceHash或workspaceRoot不能为空")
+	}
+
+	sessions, err := s.userWorkspaceSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 升级前创建的会话仍按规范化之前的旧哈希记录
+	pathHash, legacyHash := utils.GenerateWorkspaceHash(workspace), utils.LegacyWorkspaceHash(workspace)
+	var latest *workspaceSession
+	for i := range sessions {
+		ws := &sessions[i]
+		if ws.hash != workspace && ws.hash != pathHash && ws.hash != legacyHash {
+			continue
+		}
+		if ws.session.Status != models.SessionStatusActive {
+			continue
+		}
+		if latest == nil || ws.session.LastActive.After(latest.session.LastActive) {
+			latest = ws
+		}
+	}
+	if latest == nil {
+		return nil, apperrors.ErrSessionNotFound.WithMessagef("工作空间没有活跃会话: %s，请使用get_or_create创建", workspace)
+	}
+
+	now := time.Now()
+	if err := latest.store.ModifySession(latest.session.ID, func(session *models.Session) error {
+		session.LastActive = now
+		return nil
+	}); err != nil {
+		log.Printf("⚠️ [工作空间] 更新会话 %s 活跃时间失败: %v", latest.session.ID, err)
+	} else {
+		latest.session.LastActive = now
+	}
+
+	log.Printf("📂 [工作空间] 用户 %s 切换到工作空间 %s，会话: %s", userID, latest.hash, latest.session.ID)
+	return latest.session, nil
+}
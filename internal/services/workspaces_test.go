@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	apperrors "github.com/contextkeeper/service/internal/errors"
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+	"github.com/contextkeeper/service/internal/utils"
+)
+
+// TestListAndSwitchWorkspaces 测试按工作空间哈希归并用户会话，切换时返回该工作空间最近活跃的活跃会话
+func TestListAndSwitchWorkspaces(t *testing.T) {
+	manager := store.NewUserSessionManager(t.TempDir())
+	userStore, err := manager.GetUserSessionStore("user_a")
+	if err != nil {
+		t.Fatalf("创建用户会话存储失败: %v", err)
+	}
+	globalStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建全局会话存储失败: %v", err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	save := func(sessionStore *store.SessionStore, id, userID, path, status string, lastActive time.Time) {
+		session := models.NewSession(id)
+		session.Status = status
+		session.LastActive = lastActive
+		session.Metadata = map[string]interface{}{"userId": userID, "workspacePath": path}
+		if path != "/work/legacy" {
+			session.Metadata["workspaceHash"] = utils.GenerateWorkspaceHash(path)
+		}
+		if err := sessionStore.SaveSession(session); err != nil {
+			t.Fatalf("保存会话失败: %v", err)
+		}
+	}
+	save(userStore, "app-old", "user_a", "/work/app", models.SessionStatusActive, base)
+	save(userStore, "app-new", "user_a", "/work/app", models.SessionStatusActive, base.Add(10*time.Minute))
+	save(globalStore, "app-archived", "user_a", "/work/app", models.SessionStatusArchived, base.Add(20*time.Minute))
+	save(globalStore, "legacy", "user_a", "/work/legacy", models.SessionStatusInactive, base.Add(30*time.Minute))
+	save(globalStore, "other-user", "user_b", "/work/secret", models.SessionStatusActive, base.Add(40*time.Minute))
+
+	service := &ContextService{sessionStore: globalStore, userSessionManager: manager}
+	workspaces, err := service.ListWorkspaces("user_a")
+	if err != nil {
+		t.Fatalf("列出工作空间失败: %v", err)
+	}
+	if len(workspaces) != 2 || workspaces[0].Name != "legacy" || workspaces[1].Name != "app" {
+		t.Fatalf("应按最近活跃倒序返回legacy和app两个工作空间: %+v", workspaces)
+	}
+	app := workspaces[1]
+	if app.Hash != utils.GenerateWorkspaceHash("/work/app") || app.SessionCount != 3 || app.ActiveSessionID != "app-new" {
+		t.Errorf("app工作空间信息错误: %+v", app)
+	}
+	if workspaces[0].Hash != utils.GenerateWorkspaceHash("/work/legacy") || workspaces[0].ActiveSessionID != "" {
+		t.Errorf("缺少workspaceHash的旧会话应按路径计算哈希且没有活跃会话: %+v", workspaces[0])
+	}
+
+	for _, workspace := range []string{app.Hash, "/work/app"} {
+		session, err := service.SwitchWorkspace("user_a", workspace)
+		if err != nil || session.ID != "app-new" {
+			t.Fatalf("按%s切换应返回最近活跃会话app-new: %+v, %v", workspace, session, err)
+		}
+	}
+	if _, err := service.SwitchWorkspace("user_a", "/work/legacy"); !errors.Is(err, apperrors.ErrSessionNotFound) {
+		t.Errorf("没有活跃会话的工作空间应返回ErrSessionNotFound: %v", err)
+	}
+	if _, err := service.SwitchWorkspace("user_a", "/work/secret"); !errors.Is(err, apperrors.ErrSessionNotFound) {
+		t.Errorf("不应切换到其他用户的工作空间: %v", err)
+	}
+}
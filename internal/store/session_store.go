@@ -3,10 +3,12 @@ package store
 import (
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -191,6 +193,12 @@ func (s *SessionStore) GetRecentHistory(sessionID string, count int) ([]string,
 
 // UpdateSessionSummary 更新会话摘要
 func (s *SessionStore) UpdateSessionSummary(sessionID string, summary string) error {
+	return s.UpdateSessionSummaryWithKey(sessionID, summary, "")
+}
+
+// UpdateSessionSummaryWithKey 更新会话摘要，并记录生成摘要时的历史指纹
+// summaryKey为空表示该摘要不可复用，下次摘要时会重新生成
+func (s *SessionStore) UpdateSessionSummaryWithKey(sessionID string, summary string, summaryKey string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -201,6 +209,7 @@ func (s *SessionStore) UpdateSessionSummary(sessionID string, summary string) er
 
 	// 更新摘要
 	session.Summary = summary
+	session.SummaryKey = summaryKey
 	session.LastActive = time.Now()
 
 	// 保存会话
@@ -476,39 +485,187 @@ func (s *SessionStore) RecordEditAction(sessionID, filePath, editType string, po
 	return nil
 }
 
-// CleanupInactiveSessions 清理不活跃的会话
+// SessionRetainFunc 判断过期会话是否需要保留，返回非空原因表示保留
+type SessionRetainFunc func(sessionID string) string
+
+// SessionCleanupResult 不活跃会话清理结果
+type SessionCleanupResult struct {
+	Archived         int                        `json:"archived"`
+	RetainedPinned   int                        `json:"retained_pinned"`
+	RetainedByPolicy int                        `json:"retained_by_policy"` // 由保留策略保留（如最新记忆为P0）
+	Entries          []models.CleanupAuditEntry `json:"entries,omitempty"`  // 每个过期会话的处理明细
+}
+
+// CleanupInactiveSessions 清理不活跃的会话，置顶会话不会被清理
 func (s *SessionStore) CleanupInactiveSessions(timeout time.Duration) int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.CleanupInactiveSessionsWithRetain(timeout, nil).Archived
+}
 
-	// 清理过期会话
-	var cleanedCount int
-	now := time.Now()
+// CleanupInactiveSessionsWithRetain 清理不活跃的会话
+// 置顶会话始终保留；retain不为空时对其余过期会话调用，返回非空原因则保留
+func (s *SessionStore) CleanupInactiveSessionsWithRetain(timeout time.Duration, retain SessionRetainFunc) SessionCleanupResult {
+	return s.CleanupInactiveSessionsWithOptions(timeout, retain, false)
+}
+
+// CleanupInactiveSessionsWithOptions 清理不活跃的会话，dryRun为true时只统计将被归档的会话，不修改任何数据
+func (s *SessionStore) CleanupInactiveSessionsWithOptions(timeout time.Duration, retain SessionRetainFunc, dryRun bool) SessionCleanupResult {
+	return s.CleanupInactiveSessionsAt(time.Now(), timeout, retain, dryRun)
+}
+
+// CleanupInactiveSessionsAt 以now为当前时间清理不活跃的会话
+// retain可能较慢（如查询向量存储），因此在锁外执行，归档前重新检查会话状态
+func (s *SessionStore) CleanupInactiveSessionsAt(now time.Time, timeout time.Duration, retain SessionRetainFunc, dryRun bool) SessionCleanupResult {
+	var result SessionCleanupResult
 
+	// 1. 收集过期会话，跳过置顶会话
+	s.mu.RLock()
+	var expired []string
 	for id, session := range s.sessions {
-		// 检查上次活动时间
-		if now.Sub(session.LastActive) > timeout {
-			// 设置会话为已归档
-			session.Status = "archived"
-
-			// 保存更新的状态
-			if err := s.saveSession(session); err != nil {
-				log.Printf("保存归档会话状态失败: %v", err)
+		if now.Sub(session.LastActive) <= timeout {
+			continue
+		}
+		if isSessionPinned(session) {
+			log.Printf("[会话存储] 保留会话 %s: 会话已置顶", id)
+			result.RetainedPinned++
+			result.Entries = append(result.Entries, newCleanupAuditEntry(session, models.CleanupActionRetain, "会话已置顶", 0))
+			continue
+		}
+		expired = append(expired, id)
+	}
+	s.mu.RUnlock()
+
+	// 2. 在锁外执行保留策略
+	var candidates []string
+	for _, id := range expired {
+		if retain != nil {
+			if reason := retain(id); reason != "" {
+				log.Printf("[会话存储] 保留会话 %s: %s", id, reason)
+				result.RetainedByPolicy++
+				result.Entries = append(result.Entries, models.CleanupAuditEntry{
+					SessionID: id, Action: models.CleanupActionRetain, Reason: reason,
+				})
 				continue
 			}
+		}
+		candidates = append(candidates, id)
+	}
+
+	// 3. 归档，期间被访问或置顶的会话跳过
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-			// 从内存中移除
-			delete(s.sessions, id)
-			delete(s.histories, id)
-			cleanedCount++
+	for _, id := range candidates {
+		session, exists := s.sessions[id]
+		if !exists || now.Sub(session.LastActive) <= timeout || isSessionPinned(session) {
+			continue
+		}
+
+		entry := newCleanupAuditEntry(session, models.CleanupActionArchive,
+			fmt.Sprintf("超过%v未活跃", timeout), len(session.Messages))
+		if dryRun {
+			log.Printf("[会话存储] 演练: 将归档会话 %s (%s, 消息%d条)", id, entry.Reason, entry.MessageCount)
+			result.Entries = append(result.Entries, entry)
+			result.Archived++
+			continue
 		}
+
+		// 设置会话为已归档
+		session.Status = models.SessionStatusArchived
+
+		// 保存更新的状态
+		if err := s.saveSession(session); err != nil {
+			log.Printf("保存归档会话状态失败: %v", err)
+			continue
+		}
+
+		// 从内存中移除
+		delete(s.sessions, id)
+		delete(s.histories, id)
+		result.Entries = append(result.Entries, entry)
+		result.Archived++
 	}
 
-	return cleanedCount
+	return result
+}
+
+// newCleanupAuditEntry 根据会话创建清理明细
+func newCleanupAuditEntry(session *models.Session, action, reason string, messageCount int) models.CleanupAuditEntry {
+	return models.CleanupAuditEntry{
+		SessionID:    session.ID,
+		Action:       action,
+		Reason:       reason,
+		MessageCount: messageCount,
+		LastActive:   session.LastActive.Unix(),
+	}
+}
+
+// SetSessionPinned 设置会话置顶状态，置顶会话不会被不活跃清理归档
+func (s *SessionStore) SetSessionPinned(sessionID string, pinned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("会话不存在: %s", sessionID)
+	}
+
+	if session.Metadata == nil {
+		session.Metadata = make(map[string]interface{})
+	}
+	session.Metadata[models.SessionMetadataPinned] = pinned
+
+	if err := s.saveSession(session); err != nil {
+		return fmt.Errorf("保存会话失败: %w", err)
+	}
+
+	log.Printf("[会话存储] 会话置顶状态已更新: ID=%s, pinned=%v", sessionID, pinned)
+	return nil
+}
+
+// SaveContextModel 保存会话的LLM驱动语境模型
+func (s *SessionStore) SaveContextModel(sessionID string, contextModel *models.PersistedContextModel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("会话不存在: %s", sessionID)
+	}
+
+	session.ContextModel = contextModel
+	if err := s.saveSession(session); err != nil {
+		return fmt.Errorf("保存会话失败: %w", err)
+	}
+	return nil
+}
+
+// isSessionPinned 检查会话元数据中的置顶标记
+func isSessionPinned(session *models.Session) bool {
+	if session == nil || session.Metadata == nil {
+		return false
+	}
+	pinned, _ := session.Metadata[models.SessionMetadataPinned].(bool)
+	return pinned
+}
+
+// ShortTermCleanupResult 短期记忆清理结果
+type ShortTermCleanupResult struct {
+	Removed int                        `json:"removed"`
+	Entries []models.CleanupAuditEntry `json:"entries,omitempty"` // 每个有消息被清理的会话
 }
 
 // CleanupShortTermMemory 清理短期记忆，只保留最近指定天数的数据
 func (s *SessionStore) CleanupShortTermMemory(days int) int {
+	return s.CleanupShortTermMemoryWithOptions(days, false).Removed
+}
+
+// CleanupShortTermMemoryWithOptions 清理短期记忆，dryRun为true时只统计将被清理的消息，不修改会话
+func (s *SessionStore) CleanupShortTermMemoryWithOptions(days int, dryRun bool) ShortTermCleanupResult {
+	return s.CleanupShortTermMemoryAt(time.Now(), days, dryRun)
+}
+
+// CleanupShortTermMemoryAt 以now为当前时间清理短期记忆，只保留最近days天的消息
+func (s *SessionStore) CleanupShortTermMemoryAt(now time.Time, days int, dryRun bool) ShortTermCleanupResult {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -517,8 +674,8 @@ func (s *SessionStore) CleanupShortTermMemory(days int) int {
 	}
 
 	// 计算截止时间
-	cutoffTime := time.Now().AddDate(0, 0, -days)
-	var cleanedCount int
+	cutoffTime := now.AddDate(0, 0, -days)
+	var result ShortTermCleanupResult
 
 	// 遍历会话
 	for _, session := range s.sessions {
@@ -533,19 +690,33 @@ func (s *SessionStore) CleanupShortTermMemory(days int) int {
 			}
 
 			// 如果有消息被过滤掉
-			if len(recentMessages) < len(session.Messages) {
-				cleanedCount += len(session.Messages) - len(recentMessages)
+			if removed := len(session.Messages) - len(recentMessages); removed > 0 {
+				entry := newCleanupAuditEntry(session, models.CleanupActionRemoveMessages,
+					fmt.Sprintf("消息超过%d天", days), removed)
+				if dryRun {
+					log.Printf("[会话存储] 演练: 将清理会话 %s 的%d条过期消息", session.ID, removed)
+					result.Removed += removed
+					result.Entries = append(result.Entries, entry)
+					continue
+				}
+
 				session.Messages = recentMessages
 				// 保存更新的会话
 				if err := s.saveSession(session); err != nil {
 					log.Printf("保存清理后的会话失败: %v", err)
 				}
+				result.Removed += removed
+				result.Entries = append(result.Entries, entry)
 			}
 		}
 	}
 
-	log.Printf("短期记忆清理完成: 清理了%d条超过%d天的消息", cleanedCount, days)
-	return cleanedCount
+	if dryRun {
+		log.Printf("短期记忆清理演练完成: 将清理%d条超过%d天的消息", result.Removed, days)
+	} else {
+		log.Printf("短期记忆清理完成: 清理了%d条超过%d天的消息", result.Removed, days)
+	}
+	return result
 }
 
 // loadSessions 从文件加载会话
@@ -623,29 +794,78 @@ func (s *SessionStore) saveSession(session *models.Session) error {
 	absPath, _ := filepath.Abs(filePath)
 	log.Printf("[会话存储] 文件绝对路径: %s", absPath)
 
-	// 序列化会话为JSON
-	data, err := json.Marshal(session)
-	if err != nil {
-		log.Printf("[会话存储] 错误: 序列化会话失败: %v", err)
-		return fmt.Errorf("序列化会话失败: %w", err)
-	}
-
 	// 如果目录不存在，则创建目录
 	if err := os.MkdirAll(sessionsPath, 0755); err != nil {
 		log.Printf("[会话存储] 错误: 创建目录失败: %s, 错误: %v", sessionsPath, err)
 		return fmt.Errorf("创建目录失败: %w", err)
 	}
 
-	// 写入文件
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		log.Printf("[会话存储] 错误: 写入会话文件失败: %v", err)
-		return fmt.Errorf("写入会话文件失败: %w", err)
+	// 序列化并写入文件
+	if _, err := writeSessionFile(filePath, session, json.Marshal); err != nil {
+		log.Printf("[会话存储] 错误: %v", err)
+		return err
 	}
 
 	log.Printf("[会话存储] 成功保存会话到文件: %s", filePath)
 	return nil
 }
 
+// sessionFileLocks 会话文件写锁，按文件路径区分，同一目录下的多个SessionStore实例共享
+var sessionFileLocks sync.Map // 文件路径 -> *sync.Mutex
+
+// lockSessionFile 获取会话文件写锁，返回解锁函数
+func lockSessionFile(filePath string) func() {
+	value, _ := sessionFileLocks.LoadOrStore(filePath, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// writeSessionFile 在会话文件写锁内序列化会话并原子写入，同一会话的写入串行执行
+func writeSessionFile(filePath string, session *models.Session, marshal func(v interface{}) ([]byte, error)) ([]byte, error) {
+	unlock := lockSessionFile(filePath)
+	defer unlock()
+
+	data, err := marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("序列化会话失败: %w", err)
+	}
+	if err := writeFileAtomic(filePath, data); err != nil {
+		return nil, fmt.Errorf("写入会话文件失败: %w", err)
+	}
+	return data, nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名覆盖目标文件，避免中途失败留下写了一半的文件
+// 临时文件名不以.json结尾，加载会话时会被忽略
+func writeFileAtomic(filePath string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // 重命名成功后临时文件已不存在
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("同步临时文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("关闭临时文件失败: %w", err)
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return fmt.Errorf("设置文件权限失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("重命名临时文件失败: %w", err)
+	}
+	return nil
+}
+
 // saveHistory 保存历史记录到文件
 func (s *SessionStore) saveHistory(sessionID string, history []string) error {
 	historyPath := filepath.Join(s.storePath, "histories")
@@ -672,7 +892,7 @@ func (s *SessionStore) saveHistory(sessionID string, history []string) error {
 	}
 
 	// 写入文件
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := writeFileAtomic(filePath, data); err != nil {
 		log.Printf("[会话存储] 错误: 写入历史记录文件失败: %v", err)
 		return fmt.Errorf("写入历史记录文件失败: %w", err)
 	}
@@ -761,23 +981,211 @@ func (s *SessionStore) SaveSession(session *models.Session) error {
 		return fmt.Errorf("创建会话目录失败: %w", err)
 	}
 
-	// 序列化会话
-	data, err := json.MarshalIndent(session, "", "  ")
+	// 序列化并写入文件
+	data, err := writeSessionFile(filePath, session, func(v interface{}) ([]byte, error) {
+		return json.MarshalIndent(v, "", "  ")
+	})
 	if err != nil {
-		log.Printf("[会话存储] 错误: 序列化会话失败: %v", err)
-		return fmt.Errorf("序列化会话失败: %w", err)
-	}
-
-	// 写入文件
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		log.Printf("[会话存储] 错误: 写入会话文件失败: %v", err)
-		return fmt.Errorf("写入会话文件失败: %w", err)
+		log.Printf("[会话存储] 错误: %v", err)
+		return err
 	}
 
 	log.Printf("[会话存储] 成功保存会话到文件: %s, 大小=%d字节", filePath, len(data))
 	return nil
 }
 
+// ModifySession 在存储写锁内修改并保存会话，会话不存在时返回错误
+// 修改已有会话应通过此方法进行：直接修改GetSession返回的会话再调用SaveSession，会与清理任务等并发写入交错
+func (s *SessionStore) ModifySession(sessionID string, modify func(session *models.Session) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return fmt.Errorf("会话不存在: %s", sessionID)
+	}
+	if err := modify(session); err != nil {
+		return err
+	}
+	if err := s.saveSession(session); err != nil {
+		return fmt.Errorf("保存会话失败: %w", err)
+	}
+	return nil
+}
+
+// MigrateWorkspaceHash 将用户工作空间哈希为fromHash的会话改为toHash并保存，返回迁移的会话数
+// 用于工作空间哈希算法变化后找回按旧哈希记录的会话；保存失败的会话跳过，下次调用时重试
+func (s *SessionStore) MigrateWorkspaceHash(userID, fromHash, toHash string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	migrated := 0
+	for _, session := range s.sessions {
+		if session.Metadata == nil {
+			continue
+		}
+		ownerID, _ := session.Metadata["userId"].(string)
+		hash, _ := session.Metadata["workspaceHash"].(string)
+		if ownerID != userID || hash != fromHash {
+			continue
+		}
+		session.Metadata["workspaceHash"] = toHash
+		if err := s.saveSession(session); err != nil {
+			session.Metadata["workspaceHash"] = fromHash
+			log.Printf("[会话存储] 迁移会话工作空间哈希失败: ID=%s, 错误: %v", session.ID, err)
+			continue
+		}
+		migrated++
+	}
+	return migrated
+}
+
+// ErrSessionExists 导入会话时目标会话已存在
+var ErrSessionExists = errors.New("会话已存在")
+
+// GetSessionSnapshot 获取会话的深拷贝，会话不存在时返回错误（不会自动创建）
+func (s *SessionStore) GetSessionSnapshot(sessionID string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("会话不存在: %s", sessionID)
+	}
+	return cloneSession(session)
+}
+
+// cloneSession 深拷贝会话
+func cloneSession(session *models.Session) (*models.Session, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("序列化会话失败: %w", err)
+	}
+	var snapshot models.Session
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("复制会话失败: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// ImportSession 写入导入的会话，目标会话已存在且未指定force时返回ErrSessionExists
+// 返回值表示是否覆盖了已有会话
+func (s *SessionStore) ImportSession(session *models.Session, force bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.sessions[session.ID]
+	if exists && !force {
+		return false, fmt.Errorf("%w: %s", ErrSessionExists, session.ID)
+	}
+
+	if err := s.saveSession(session); err != nil {
+		return false, err
+	}
+	s.sessions[session.ID] = session
+
+	log.Printf("[会话存储] 成功导入会话: ID=%s, 消息数=%d, 覆盖=%v", session.ID, len(session.Messages), exists)
+	return exists, nil
+}
+
+// SessionMergeResult 会话合并结果
+type SessionMergeResult struct {
+	Messages  int
+	Edits     int
+	CodeFiles int
+	Session   *models.Session // 合并后目标会话的快照
+}
+
+// MergeSessions 将源会话的消息、编辑历史和代码上下文并入目标会话，并归档源会话
+// 在同一把锁内完成，合并期间的写入不会丢失；源会话归档失败时恢复目标会话文件
+func (s *SessionStore) MergeSessions(targetID, sourceID string) (*SessionMergeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	target, exists := s.sessions[targetID]
+	if !exists {
+		return nil, fmt.Errorf("会话不存在: %s", targetID)
+	}
+	source, exists := s.sessions[sourceID]
+	if !exists {
+		return nil, fmt.Errorf("会话不存在: %s", sourceID)
+	}
+
+	// 在副本上合并，文件写入成功后再替换内存中的会话
+	merged, err := cloneSession(target)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := cloneSession(source)
+	if err != nil {
+		return nil, err
+	}
+	result := &SessionMergeResult{}
+
+	for _, message := range archived.Messages {
+		message.SessionID = targetID
+		merged.Messages = append(merged.Messages, message)
+		result.Messages++
+	}
+	sort.SliceStable(merged.Messages, func(i, j int) bool {
+		return merged.Messages[i].Timestamp < merged.Messages[j].Timestamp
+	})
+
+	merged.EditHistory = append(merged.EditHistory, archived.EditHistory...)
+	result.Edits = len(archived.EditHistory)
+	sort.SliceStable(merged.EditHistory, func(i, j int) bool {
+		return merged.EditHistory[i].Timestamp < merged.EditHistory[j].Timestamp
+	})
+
+	// 同一文件保留最近编辑的版本
+	if len(archived.CodeContext) > 0 && merged.CodeContext == nil {
+		merged.CodeContext = make(map[string]*models.CodeFile)
+	}
+	for path, file := range archived.CodeContext {
+		if existing, ok := merged.CodeContext[path]; !ok || file.LastEdit > existing.LastEdit {
+			merged.CodeContext[path] = file
+		}
+		result.CodeFiles++
+	}
+
+	if archived.LastActive.After(merged.LastActive) {
+		merged.LastActive = archived.LastActive
+	}
+
+	archived.Messages = nil
+	archived.EditHistory = nil
+	archived.CodeContext = nil
+	archived.Status = models.SessionStatusArchived
+	if archived.Metadata == nil {
+		archived.Metadata = make(map[string]interface{})
+	}
+	archived.Metadata[models.SessionMetadataMergedInto] = targetID
+
+	if err := s.saveSession(merged); err != nil {
+		return nil, fmt.Errorf("保存目标会话失败: %w", err)
+	}
+	if err := s.saveSession(archived); err != nil {
+		if restoreErr := s.saveSession(target); restoreErr != nil {
+			log.Printf("[会话存储] 错误: 恢复目标会话文件失败: ID=%s, 错误: %v", targetID, restoreErr)
+		}
+		return nil, fmt.Errorf("归档源会话失败: %w", err)
+	}
+
+	s.sessions[targetID] = merged
+	delete(s.sessions, sourceID)
+	delete(s.histories, sourceID)
+
+	snapshot, err := cloneSession(merged)
+	if err != nil {
+		return nil, err
+	}
+	result.Session = snapshot
+
+	log.Printf("[会话存储] 会话合并完成: %s -> %s, 消息数=%d, 编辑数=%d, 代码文件数=%d",
+		sourceID, targetID, result.Messages, result.Edits, result.CodeFiles)
+	return result, nil
+}
+
 // GetLastActiveTime 获取此存储中最近的活跃时间
 func (s *SessionStore) GetLastActiveTime() time.Time {
 	s.mu.RLock()
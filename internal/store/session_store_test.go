@@ -0,0 +1,152 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+func TestCleanupInactiveSessionsRetainsPinned(t *testing.T) {
+	sessionStore, err := NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+
+	for _, id := range []string{"pinned", "important", "stale"} {
+		session := models.NewSession(id)
+		session.LastActive = time.Now().Add(-2 * time.Hour)
+		if err := sessionStore.SaveSession(session); err != nil {
+			t.Fatalf("保存会话失败: %v", err)
+		}
+	}
+	if err := sessionStore.SetSessionPinned("pinned", true); err != nil {
+		t.Fatalf("置顶会话失败: %v", err)
+	}
+
+	result := sessionStore.CleanupInactiveSessionsWithRetain(time.Hour, func(sessionID string) string {
+		if sessionID == "important" {
+			return "最新记忆优先级为P0"
+		}
+		return ""
+	})
+
+	if result.Archived != 1 || result.RetainedPinned != 1 || result.RetainedByPolicy != 1 {
+		t.Errorf("清理结果错误: %+v", result)
+	}
+	if sessionStore.GetSessionCount() != 2 {
+		t.Errorf("期望保留2个会话，实际%d个", sessionStore.GetSessionCount())
+	}
+	if _, err := sessionStore.GetSessionSnapshot("stale"); err == nil {
+		t.Errorf("未置顶的过期会话应被归档")
+	}
+
+	if err := sessionStore.SetSessionPinned("missing", true); err == nil {
+		t.Errorf("置顶不存在的会话应返回错误")
+	}
+}
+
+// TestCleanupDryRunKeepsData 测试演练模式只返回清理明细，不归档会话也不删除消息
+func TestCleanupDryRunKeepsData(t *testing.T) {
+	sessionStore, err := NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+
+	session := models.NewSession("stale")
+	session.LastActive = time.Now().Add(-2 * time.Hour)
+	session.Messages = []*models.Message{
+		{ID: "old", SessionID: "stale", Timestamp: time.Now().AddDate(0, 0, -5).Unix()},
+		{ID: "new", SessionID: "stale", Timestamp: time.Now().Unix()},
+	}
+	if err := sessionStore.SaveSession(session); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	messages := sessionStore.CleanupShortTermMemoryWithOptions(2, true)
+	if messages.Removed != 1 || len(messages.Entries) != 1 || messages.Entries[0].Action != models.CleanupActionRemoveMessages {
+		t.Errorf("消息清理演练结果错误: %+v", messages)
+	}
+	result := sessionStore.CleanupInactiveSessionsWithOptions(time.Hour, nil, true)
+	if result.Archived != 1 || len(result.Entries) != 1 || result.Entries[0].MessageCount != 2 {
+		t.Errorf("会话清理演练结果错误: %+v", result)
+	}
+
+	snapshot, err := sessionStore.GetSessionSnapshot("stale")
+	if err != nil || len(snapshot.Messages) != 2 {
+		t.Fatalf("演练不应修改会话: %+v, %v", snapshot, err)
+	}
+
+	if removed := sessionStore.CleanupShortTermMemory(2); removed != 1 {
+		t.Errorf("期望清理1条过期消息，实际%d条", removed)
+	}
+}
+
+// TestConcurrentSessionWrites 测试同一会话的并发修改、保存、读取和清理不会产生损坏的会话文件或丢失修改
+func TestConcurrentSessionWrites(t *testing.T) {
+	dir := t.TempDir()
+	sessionStore, err := NewSessionStore(dir)
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	if _, err := sessionStore.GetSession("shared"); err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+
+	const workers, rounds = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				err := sessionStore.ModifySession("shared", func(session *models.Session) error {
+					if session.Metadata == nil {
+						session.Metadata = make(map[string]interface{})
+					}
+					count, _ := session.Metadata["count"].(float64)
+					session.Metadata["count"] = count + 1
+					session.Metadata[fmt.Sprintf("worker_%d", w)] = i
+					session.LastActive = time.Now()
+					return nil
+				})
+				if err != nil {
+					t.Errorf("修改会话失败: %v", err)
+					return
+				}
+				if _, err := sessionStore.GetSessionSnapshot("shared"); err != nil {
+					t.Errorf("读取会话失败: %v", err)
+					return
+				}
+				sessionStore.CleanupShortTermMemory(2)
+				sessionStore.CleanupInactiveSessions(time.Hour)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(filepath.Join(dir, "sessions", "shared.json"))
+	if err != nil {
+		t.Fatalf("读取会话文件失败: %v", err)
+	}
+	var saved models.Session
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("会话文件已损坏: %v", err)
+	}
+	if count, _ := saved.Metadata["count"].(float64); count != workers*rounds {
+		t.Errorf("期望计数%d，实际%v", workers*rounds, saved.Metadata["count"])
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "sessions"))
+	if err != nil {
+		t.Fatalf("读取会话目录失败: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("不应残留临时文件: %d个文件", len(entries))
+	}
+}
@@ -1,7 +1,9 @@
 package store
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
@@ -78,6 +80,62 @@ func (m *UserSessionManager) GetUserSessionStore(userID string) (*SessionStore,
 	return store, nil
 }
 
+// ListUserIDs 列出存储目录中已有会话存储的用户ID，按字典序返回
+func (m *UserSessionManager) ListUserIDs() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(m.baseStorePath, "users"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取用户存储目录失败: %w", err)
+	}
+
+	var userIDs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			userIDs = append(userIDs, entry.Name())
+		}
+	}
+	return userIDs, nil
+}
+
+// PurgeUserStore 删除用户的会话存储目录并移除缓存的存储实例，返回删除的文件数
+// 目录不存在时返回0，可重复执行
+func (m *UserSessionManager) PurgeUserStore(userID string) (int, error) {
+	// 用户ID作为目录名，拒绝可能跳出users目录的值
+	if userID == "" || userID == "." || userID == ".." || userID != filepath.Base(userID) {
+		return 0, fmt.Errorf("无效的用户ID: %q", userID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.userStores, userID)
+
+	userStorePath := filepath.Join(m.baseStorePath, "users", userID)
+	removed := 0
+	err := filepath.WalkDir(userStorePath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			removed++
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("扫描用户存储目录失败: %w", err)
+	}
+	if err := os.RemoveAll(userStorePath); err != nil {
+		return 0, fmt.Errorf("删除用户存储目录失败: %w", err)
+	}
+
+	log.Printf("[用户会话管理] 已删除用户%s的会话存储目录，文件数: %d", userID, removed)
+	return removed, nil
+}
+
 // CleanupInactiveUserStores 清理不活跃的用户存储
 func (m *UserSessionManager) CleanupInactiveUserStores(inactiveThreshold time.Duration) int {
 	m.mu.Lock()
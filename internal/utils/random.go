@@ -26,12 +26,24 @@ func GenerateWorkspaceHash(workspacePath string) string {
 	if workspacePath == "" {
 		return "default"
 	}
-	// 使用标准化路径生成一致的哈希
-	cleanPath := filepath.Clean(workspacePath)
+	// 使用规范化路径生成一致的哈希：末尾分隔符、符号链接和大小写不敏感文件系统上的大小写差异不影响结果
+	return hashWorkspaceKey(workspaceHashKey(workspacePath))
+}
+
+// LegacyWorkspaceHash 路径规范化之前的工作空间哈希（只做filepath.Clean），用于找回升级前创建的会话
+func LegacyWorkspaceHash(workspacePath string) string {
+	if workspacePath == "" {
+		return "default"
+	}
+	return hashWorkspaceKey(filepath.Clean(workspacePath))
+}
+
+// hashWorkspaceKey 计算路径的SHA-256，取前16个字符作为工作空间标识
+func hashWorkspaceKey(key string) string {
 	hasher := sha256.New()
-	hasher.Write([]byte(cleanPath))
+	hasher.Write([]byte(key))
 	hash := fmt.Sprintf("%x", hasher.Sum(nil))
-	return hash[:16] // 取前16个字符作为工作空间标识
+	return hash[:16]
 }
 
 // 🔥 新增：GetWorkspaceIdentifier 统一的工作空间标识获取方法
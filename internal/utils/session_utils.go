@@ -30,6 +30,13 @@ func GetWorkspaceSessionID(
 		return nil, false, fmt.Errorf("工作空间路径不能为空，session必须基于用户+工作空间隔离")
 	}
 
+	// 规范化路径，同一目录的不同写法（末尾斜杠、符号链接）归入同一工作空间
+	legacyHash := LegacyWorkspaceHash(workspacePath)
+	if canonical := CanonicalWorkspacePath(workspacePath); canonical != workspacePath {
+		log.Printf("🔍 [会话工具] 工作空间路径规范化: %s -> %s", workspacePath, canonical)
+		workspacePath = canonical
+	}
+
 	var session *models.Session
 	var isNewSession bool
 	var err error
@@ -69,6 +76,13 @@ func GetWorkspaceSessionID(
 	workspaceHash := GenerateWorkspaceHash(workspacePath)
 	log.Printf("🔍 [会话工具] 步骤2 - 工作空间: '%s' -> 哈希: '%s'", workspacePath, workspaceHash)
 
+	// 路径规范化改变了部分工作空间的哈希，将升级前按旧哈希记录的会话迁移到新哈希，避免丢失会话
+	if legacyHash != workspaceHash {
+		if migrated := sessionStore.MigrateWorkspaceHash(userID, legacyHash, workspaceHash); migrated > 0 {
+			log.Printf("🔍 [会话工具] 步骤2 - 已将%d个会话的工作空间哈希从旧哈希'%s'迁移到'%s'", migrated, legacyHash, workspaceHash)
+		}
+	}
+
 	// 🔥 强制使用工作空间会话模式
 	log.Printf("🔍 [会话工具] 步骤3 - 使用工作空间会话模式")
 	session, isNewSession, err = sessionStore.GetOrCreateActiveSessionWithWorkspace(userID, workspaceHash, sessionTimeout)
@@ -85,36 +99,38 @@ func GetWorkspaceSessionID(
 		log.Printf("🔍 [会话工具] 复用工作空间会话: %s (工作空间: %s)", session.ID, workspaceHash)
 	}
 
-	// 确保会话元数据包含工作空间信息
-	if session.Metadata == nil {
-		session.Metadata = make(map[string]interface{})
-	}
-	session.Metadata["workspaceHash"] = workspaceHash
-	session.Metadata["workspacePath"] = workspacePath
-
-	// 🔥 修复：关键问题 - 必须将userId存储到metadata中
-	// 这是其他MCP工具能够从会话中获取用户ID的关键
-	session.Metadata["userId"] = userID
-	log.Printf("🔍 [会话工具] 🔥 关键修复 - 已将userId存储到会话metadata: %s", userID)
-
-	// 更新会话活跃时间
-	log.Printf("🔍 [会话工具] 步骤4 - 更新会话活跃时间")
-	session.LastActive = time.Now()
-
-	// 如果提供了额外元数据，合并到会话中
-	if metadata != nil && len(metadata) > 0 {
-		log.Printf("🔍 [会话工具] 步骤5 - 合并额外元数据，数量: %d", len(metadata))
-		for k, v := range metadata {
-			// 不允许覆盖工作空间相关的元数据
-			if k != "workspaceHash" && k != "workspacePath" {
-				log.Printf("🔍 [会话工具] 步骤5 - 设置元数据 %s: %+v", k, v)
-				session.Metadata[k] = v
+	// 在存储写锁内更新元数据和活跃时间并保存，避免与清理任务等并发写入交错
+	err = sessionStore.ModifySession(session.ID, func(session *models.Session) error {
+		// 确保会话元数据包含工作空间信息
+		if session.Metadata == nil {
+			session.Metadata = make(map[string]interface{})
+		}
+		session.Metadata["workspaceHash"] = workspaceHash
+		session.Metadata["workspacePath"] = workspacePath
+
+		// 🔥 修复：关键问题 - 必须将userId存储到metadata中
+		// 这是其他MCP工具能够从会话中获取用户ID的关键
+		session.Metadata["userId"] = userID
+		log.Printf("🔍 [会话工具] 🔥 关键修复 - 已将userId存储到会话metadata: %s", userID)
+
+		// 更新会话活跃时间
+		log.Printf("🔍 [会话工具] 步骤4 - 更新会话活跃时间")
+		session.LastActive = time.Now()
+
+		// 如果提供了额外元数据，合并到会话中
+		if metadata != nil && len(metadata) > 0 {
+			log.Printf("🔍 [会话工具] 步骤5 - 合并额外元数据，数量: %d", len(metadata))
+			for k, v := range metadata {
+				// 不允许覆盖工作空间相关的元数据
+				if k != "workspaceHash" && k != "workspacePath" {
+					log.Printf("🔍 [会话工具] 步骤5 - 设置元数据 %s: %+v", k, v)
+					session.Metadata[k] = v
+				}
 			}
 		}
-	}
-
-	// 保存会话
-	if err := sessionStore.SaveSession(session); err != nil {
+		return nil
+	})
+	if err != nil {
 		log.Printf("🔍 [会话工具] 步骤6 - 保存会话失败: %v", err)
 	} else {
 		log.Printf("🔍 [会话工具] 步骤6 - 保存会话成功")
@@ -127,6 +143,7 @@ func GetWorkspaceSessionID(
 // ExtractWorkspaceNameFromPath 从完整路径提取工作空间名称
 // 🔥 这是所有服务共用的工具函数，避免重复定义
 func ExtractWorkspaceNameFromPath(workspacePath string) string {
+	workspacePath = CanonicalWorkspacePath(workspacePath)
 	if workspacePath == "" {
 		return ""
 	}
@@ -57,8 +57,18 @@ type DialogState struct {
 	LastTime time.Time // 上次更新时间
 }
 
-// 存储会话状态，用于对话式初始化
-var dialogStates = make(map[string]*DialogState) // sessionID -> DialogState
+// dialogSession 单个会话的对话状态，mu串行化同一会话的初始化和响应处理
+type dialogSession struct {
+	mu    sync.Mutex
+	state *DialogState // 未初始化时为nil
+}
+
+// 存储会话状态，用于对话式初始化；dialogStatesMutex只保护map本身，
+// 会话内的读写由各自的dialogSession.mu保护，不同会话的云端校验互不阻塞
+var (
+	dialogStates      = make(map[string]*dialogSession) // sessionID -> dialogSession
+	dialogStatesMutex sync.Mutex
+)
 
 // InitUserCache 初始化用户缓存
 // 应在程序启动时调用此方法，加载用户信息到内存
@@ -166,8 +176,67 @@ func GetUserIDFromMetadata(metadata map[string]interface{}) string {
 	return ""
 }
 
+// lockDialogSession 获取（不存在时创建）会话的对话条目并加锁，调用方负责解锁
+func lockDialogSession(sessionID string) *dialogSession {
+	dialogStatesMutex.Lock()
+	session, exists := dialogStates[sessionID]
+	if !exists {
+		session = &dialogSession{}
+		dialogStates[sessionID] = session
+	}
+	dialogStatesMutex.Unlock()
+
+	session.mu.Lock()
+	return session
+}
+
+// copyDialogState 复制对话状态，返回给调用方的状态不与内部状态共享
+func copyDialogState(state *DialogState) *DialogState {
+	if state == nil {
+		return nil
+	}
+	snapshot := *state
+	return &snapshot
+}
+
 // InitializeUserByDialog 初始化用户对话状态
 func InitializeUserByDialog(sessionID string) (*DialogState, error) {
+	session := lockDialogSession(sessionID)
+	defer session.mu.Unlock()
+
+	state, err := initializeDialogLocked(sessionID, session)
+	return copyDialogState(state), err
+}
+
+// HandleUserDialogResponse 处理用户对话响应（支持云端校验的版本）
+func HandleUserDialogResponse(sessionID, response string) (*DialogState, error) {
+	session := lockDialogSession(sessionID)
+	defer session.mu.Unlock()
+
+	if session.state == nil {
+		log.Printf("[用户初始化] 错误: 会话状态不存在，sessionID=%s", sessionID)
+		return nil, fmt.Errorf("会话状态不存在")
+	}
+	state, err := handleDialogResponseLocked(sessionID, session.state, response)
+	return copyDialogState(state), err
+}
+
+// ProcessUserDialog 原子地完成"确保对话状态已初始化，再处理用户响应"，response为空时只初始化或返回当前状态
+// 同一会话的并发请求按顺序执行，不会基于过期状态推进对话
+func ProcessUserDialog(sessionID, response string) (*DialogState, error) {
+	session := lockDialogSession(sessionID)
+	defer session.mu.Unlock()
+
+	state, err := initializeDialogLocked(sessionID, session)
+	if err != nil || response == "" {
+		return copyDialogState(state), err
+	}
+	state, err = handleDialogResponseLocked(sessionID, state, response)
+	return copyDialogState(state), err
+}
+
+// initializeDialogLocked 初始化或返回会话的对话状态，调用方需持有session.mu
+func initializeDialogLocked(sessionID string, session *dialogSession) (*DialogState, error) {
 	log.Printf("[用户初始化] 开始初始化用户对话，sessionID=%s", sessionID)
 
 	// 检查是否已有缓存的用户配置
@@ -179,7 +248,7 @@ func InitializeUserByDialog(sessionID string) (*DialogState, error) {
 			UserID:   cachedUserID,
 			LastTime: time.Now(),
 		}
-		dialogStates[sessionID] = state
+		session.state = state
 		return state, nil
 	}
 
@@ -196,12 +265,12 @@ func InitializeUserByDialog(sessionID string) (*DialogState, error) {
 			UserID:   config.UserID,
 			LastTime: time.Now(),
 		}
-		dialogStates[sessionID] = state
+		session.state = state
 		return state, nil
 	}
 
 	// 检查是否已有对话状态
-	if state, exists := dialogStates[sessionID]; exists {
+	if state := session.state; state != nil {
 		log.Printf("[用户初始化] 找到现有对话状态: state=%s, userID=%s", state.State, state.UserID)
 		return state, nil
 	}
@@ -212,23 +281,16 @@ func InitializeUserByDialog(sessionID string) (*DialogState, error) {
 		State:    DialogStateAsking, // 保持现有状态名，但语义改为直接询问
 		LastTime: time.Now(),
 	}
-	dialogStates[sessionID] = state
+	session.state = state
 	log.Printf("[用户初始化] 创建新的对话状态: state=%s, sessionID=%s", state.State, sessionID)
 
 	return state, nil
 }
 
-// HandleUserDialogResponse 处理用户对话响应（支持云端校验的版本）
-func HandleUserDialogResponse(sessionID, response string) (*DialogState, error) {
+// handleDialogResponseLocked 根据用户响应推进对话状态，调用方需持有会话的dialogSession.mu
+func handleDialogResponseLocked(sessionID string, state *DialogState, response string) (*DialogState, error) {
 	log.Printf("[用户初始化] 开始处理用户对话响应，sessionID=%s, response=%q", sessionID, response)
 
-	// 获取对话状态
-	state, exists := dialogStates[sessionID]
-	if !exists {
-		log.Printf("[用户初始化] 错误: 会话状态不存在，sessionID=%s", sessionID)
-		return nil, fmt.Errorf("会话状态不存在")
-	}
-
 	log.Printf("[用户初始化] 当前对话状态: state=%s, userID=%s", state.State, state.UserID)
 
 	// 检查是否是重置指令
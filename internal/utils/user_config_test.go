@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestProcessUserDialogConcurrentResponses 测试同一会话的两个并发响应按顺序推进对话：只有一个基于询问状态进入existing流程
+func TestProcessUserDialogConcurrentResponses(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	SetCachedUserID("")
+
+	const sessionID = "session-dialog-race"
+	for round := 0; round < 20; round++ {
+		if _, err := ProcessUserDialog(sessionID, "重置"); err != nil {
+			t.Fatalf("重置对话失败: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		states := make([]*DialogState, 2)
+		errs := make([]error, 2)
+		for i := range states {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				states[i], errs[i] = ProcessUserDialog(sessionID, "是")
+			}(i)
+		}
+		wg.Wait()
+
+		// 第一个响应将询问状态推进到existing，第二个响应在existing状态下不是有效的用户ID
+		succeeded := 0
+		for i := range states {
+			if errs[i] == nil {
+				succeeded++
+				if states[i].State != DialogStateExisting {
+					t.Fatalf("成功的响应应进入existing状态: %+v", states[i])
+				}
+			}
+		}
+		if succeeded != 1 {
+			t.Fatalf("第%d轮应恰好有一个响应基于询问状态推进对话: states=%+v, errs=%v", round, states, errs)
+		}
+
+		current, err := InitializeUserByDialog(sessionID)
+		if err != nil || current.State != DialogStateExisting {
+			t.Fatalf("最终状态应为existing: %+v, %v", current, err)
+		}
+		current.State = DialogStateCompleted
+		if again, _ := InitializeUserByDialog(sessionID); again.State != DialogStateExisting {
+			t.Fatal("修改返回的状态不应影响内部状态")
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// windowsDrivePathPattern Windows客户端上报的盘符路径，如 C:\Users\x\proj
+var windowsDrivePathPattern = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+// caseInsensitiveDirs 缓存目录所在文件系统是否大小写不敏感，避免每次计算哈希都探测
+var caseInsensitiveDirs sync.Map // 目录 -> bool
+
+// CanonicalWorkspacePath 规范化工作空间路径：去除首尾空白和末尾分隔符、统一Windows分隔符，
+// 路径在本机存在时解析符号链接；保留原有大小写，用于存储和展示
+func CanonicalWorkspacePath(workspacePath string) string {
+	workspacePath = strings.TrimSpace(workspacePath)
+	if workspacePath == "" {
+		return ""
+	}
+
+	// Windows盘符路径统一为正斜杠，服务端运行在Unix上时filepath无法识别反斜杠
+	if windowsDrivePathPattern.MatchString(workspacePath) {
+		workspacePath = strings.ReplaceAll(workspacePath, `\`, "/")
+		workspacePath = strings.TrimRight(workspacePath, "/")
+		if len(workspacePath) == 2 { // 仅有盘符
+			workspacePath += "/"
+		}
+		return workspacePath
+	}
+
+	cleanPath := filepath.Clean(workspacePath)
+	if resolved, err := filepath.EvalSymlinks(cleanPath); err == nil {
+		cleanPath = resolved
+	}
+	return cleanPath
+}
+
+// workspaceHashKey 计算工作空间哈希使用的路径：在规范化路径基础上，
+// 大小写不敏感的文件系统（Windows盘符路径、探测确认的本机目录）统一转为小写
+func workspaceHashKey(workspacePath string) string {
+	canonical := CanonicalWorkspacePath(workspacePath)
+	if windowsDrivePathPattern.MatchString(canonical) || isCaseInsensitivePath(canonical) {
+		return strings.ToLower(canonical)
+	}
+	return canonical
+}
+
+// isCaseInsensitivePath 探测路径所在文件系统是否大小写不敏感：
+// 将路径中的字母大小写互换后仍指向同一文件即为不敏感；路径不存在或不含字母时按敏感处理
+func isCaseInsensitivePath(path string) bool {
+	if cached, ok := caseInsensitiveDirs.Load(path); ok {
+		return cached.(bool)
+	}
+
+	swapped := strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, path)
+	insensitive := false
+	if swapped != path {
+		original, err := os.Stat(path)
+		if err == nil {
+			if other, err := os.Stat(swapped); err == nil {
+				insensitive = os.SameFile(original, other)
+			}
+		}
+	}
+
+	// 只缓存存在的路径，尚未创建的目录下次重新探测
+	if _, err := os.Stat(path); err == nil {
+		caseInsensitiveDirs.Store(path, insensitive)
+	}
+	return insensitive
+}
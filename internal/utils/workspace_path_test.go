@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/internal/store"
+)
+
+// TestWorkspaceHashCanonicalization 测试同一目录的不同写法（末尾斜杠、多余分隔符、符号链接、Windows大小写）得到同一哈希，不同目录不冲突
+func TestWorkspaceHashCanonicalization(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "Proj")
+	other := filepath.Join(root, "proj-other")
+	for _, dir := range []string{project, other} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatalf("创建目录失败: %v", err)
+		}
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(project, link); err != nil {
+		t.Fatalf("创建符号链接失败: %v", err)
+	}
+
+	expected := GenerateWorkspaceHash(project)
+	for _, variant := range []string{project + "/", project + "//", root + "/./Proj", " " + project + " ", link, link + "/"} {
+		if got := GenerateWorkspaceHash(variant); got != expected {
+			t.Errorf("路径 %q 应与 %q 得到相同哈希: %s != %s", variant, project, got, expected)
+		}
+	}
+	if GenerateWorkspaceHash(other) == expected || GenerateWorkspaceHash(root) == expected {
+		t.Error("不同目录不应得到相同哈希")
+	}
+
+	// 大小写变体只在大小写不敏感的文件系统上视为同一目录
+	upper := filepath.Join(root, "PROJ")
+	if sameCase := GenerateWorkspaceHash(upper) == expected; sameCase != isCaseInsensitivePath(project) {
+		t.Errorf("大小写变体的哈希应与文件系统大小写敏感性一致: sameHash=%v", sameCase)
+	}
+
+	windows := GenerateWorkspaceHash(`C:\Users\Dev\Proj\`)
+	if windows != GenerateWorkspaceHash("c:/users/dev/proj") || windows == GenerateWorkspaceHash(`C:\Users\Dev\Proj2`) {
+		t.Error("Windows路径应忽略分隔符和大小写差异，且不同目录不冲突")
+	}
+
+	if name := ExtractWorkspaceNameFromPath(project + "/"); name != "Proj" {
+		t.Errorf("末尾带斜杠的路径应提取工作空间名Proj，实际为%q", name)
+	}
+	if name := ExtractWorkspaceNameFromPath(`C:\Users\Dev\Proj\`); name != "Proj" {
+		t.Errorf("Windows路径应提取工作空间名Proj，实际为%q", name)
+	}
+	if canonical := CanonicalWorkspacePath(link); !strings.HasSuffix(canonical, "Proj") {
+		t.Errorf("符号链接应解析为目标目录: %s", canonical)
+	}
+}
+
+// TestWorkspaceSessionLegacyHash 测试升级前按旧哈希（只做filepath.Clean）记录的会话在规范化后仍能找回，并迁移到新哈希
+func TestWorkspaceSessionLegacyHash(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "proj")
+	if err := os.Mkdir(project, 0o755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(project, link); err != nil {
+		t.Fatalf("创建符号链接失败: %v", err)
+	}
+	if LegacyWorkspaceHash(link) == GenerateWorkspaceHash(link) {
+		t.Fatal("符号链接路径的新旧哈希应不同")
+	}
+
+	sessionStore, err := store.NewSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建会话存储失败: %v", err)
+	}
+	legacy := models.NewSession("legacy-session")
+	legacy.Metadata = map[string]interface{}{
+		"userId":        "user_a",
+		"workspaceHash": LegacyWorkspaceHash(link),
+		"workspacePath": link,
+	}
+	if err := sessionStore.SaveSession(legacy); err != nil {
+		t.Fatalf("保存会话失败: %v", err)
+	}
+
+	session, isNew, err := GetWorkspaceSessionID(sessionStore, "user_a", "", link, nil, time.Hour)
+	if err != nil {
+		t.Fatalf("获取工作空间会话失败: %v", err)
+	}
+	if isNew || session.ID != "legacy-session" {
+		t.Fatalf("应找回升级前创建的会话，实际: %s (新建=%v)", session.ID, isNew)
+	}
+	if hash := session.Metadata["workspaceHash"]; hash != GenerateWorkspaceHash(link) {
+		t.Errorf("会话应迁移到新哈希，实际: %v", hash)
+	}
+
+	// 其他用户按旧哈希记录的会话不迁移
+	if migrated := sessionStore.MigrateWorkspaceHash("user_b", GenerateWorkspaceHash(link), "x"); migrated != 0 {
+		t.Errorf("不应迁移其他用户的会话: %d", migrated)
+	}
+}
@@ -30,7 +30,8 @@ func (s *VectorService) SearchWithText(ctx context.Context, query string, limit
 }
 
 // SearchWithTextAndFilters 使用文本查询和过滤条件搜索向量数据库
-func (s *VectorService) SearchWithTextAndFilters(ctx context.Context, query string, limit int, filters map[string]interface{}, skipThreshold bool) ([]models.SearchResult, error) {
+// threshold大于0时覆盖配置的相似度阈值，仅对本次搜索生效
+func (s *VectorService) SearchWithTextAndFilters(ctx context.Context, query string, limit int, filters map[string]interface{}, skipThreshold bool, threshold float64) ([]models.SearchResult, error) {
 	// 1. 生成查询的向量表示
 	vector, err := s.GenerateEmbedding(query)
 	if err != nil {
@@ -50,7 +51,7 @@ func (s *VectorService) SearchWithTextAndFilters(ctx context.Context, query stri
 				if key == "batchId" {
 					filterParts = append(filterParts, fmt.Sprintf("metadata LIKE '%%\"%s\":%%'", v))
 				} else {
-					filterParts = append(filterParts, fmt.Sprintf("%s = '%s'", key, v))
+					filterParts = append(filterParts, key+" = "+models.QuoteFilterValue(v))
 				}
 			case int, int64, float32, float64:
 				filterParts = append(filterParts, fmt.Sprintf("%s = %v", key, v))
@@ -79,6 +80,10 @@ func (s *VectorService) SearchWithTextAndFilters(ctx context.Context, query stri
 	options := map[string]interface{}{}
 	if skipThreshold {
 		options["skip_threshold"] = true
+		options["skip_threshold_filter"] = true
+	}
+	if threshold > 0 {
+		options["similarity_threshold"] = threshold
 	}
 	if filterStr != "" {
 		options["filter"] = filterStr
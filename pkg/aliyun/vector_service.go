@@ -36,6 +36,9 @@ type VectorService struct {
 	VectorDBDimension   int
 	VectorDBMetric      string
 	SimilarityThreshold float64
+
+	// embeddingProvider 外部嵌入服务，设置后GenerateEmbedding委托给它而不调用阿里云嵌入API
+	embeddingProvider models.EmbeddingProvider
 }
 
 // NewVectorService 创建新的阿里云向量服务客户端
@@ -53,8 +56,17 @@ func NewVectorService(embeddingAPIURL, embeddingAPIKey, vectorDBURL, vectorDBAPI
 	}
 }
 
+// SetEmbeddingProvider 设置外部嵌入服务（如OpenAI兼容服务），向量数据库仍使用阿里云DashVector
+func (s *VectorService) SetEmbeddingProvider(provider models.EmbeddingProvider) {
+	s.embeddingProvider = provider
+}
+
 // GenerateEmbedding 生成文本的向量表示
 func (s *VectorService) GenerateEmbedding(text string) ([]float32, error) {
+	if s.embeddingProvider != nil {
+		return s.embeddingProvider.GenerateEmbedding(text)
+	}
+
 	log.Printf("\n[向量服务] 开始生成文本嵌入向量 ============================")
 	log.Printf("[向量服务] 文本长度: %d 字符", len(text))
 
@@ -131,6 +143,78 @@ func (s *VectorService) GenerateEmbedding(text string) ([]float32, error) {
 	return result.Data[0].Embedding, nil
 }
 
+// GenerateEmbeddings 在一次请求中批量生成文本向量，返回的向量与输入文本按下标一一对应
+// 设置了外部嵌入服务时委托给它，外部服务不支持批量时返回错误，由调用方逐条生成
+func (s *VectorService) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	if s.embeddingProvider != nil {
+		batchProvider, ok := s.embeddingProvider.(models.BatchEmbeddingProvider)
+		if !ok {
+			return nil, fmt.Errorf("外部嵌入服务不支持批量生成向量")
+		}
+		return batchProvider.GenerateEmbeddings(texts)
+	}
+
+	log.Printf("[向量服务] 批量生成文本嵌入向量，文本数: %d", len(texts))
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"model":           "text-embedding-v1",
+		"input":           texts,
+		"encoding_format": "float",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", s.EmbeddingAPIURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.EmbeddingAPIKey)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("API请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API返回错误状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w, 响应内容: %s", err, string(respBody))
+	}
+
+	// 按index放回对应位置，不依赖返回顺序
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) || len(item.Embedding) == 0 {
+			return nil, fmt.Errorf("返回了无效的嵌入向量: index=%d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, fmt.Errorf("缺少第%d条文本的嵌入向量", i)
+		}
+	}
+
+	log.Printf("[向量服务] 批量生成向量成功，数量: %d", len(vectors))
+	return vectors, nil
+}
+
 // GenerateMultiDimensionalVectors 生成多维度向量（重新设计：基于LLM的一次性多维度数据抽取）
 func (s *VectorService) GenerateMultiDimensionalVectors(content string, llmAPIKey string) (*models.MultiDimensionalVectors, error) {
 	log.Printf("\n[多维度向量生成] 🔥 开始基于LLM的一次性多维度数据抽取 ============================")
@@ -779,7 +863,7 @@ func (s *VectorService) SearchVectors(vector []float32, sessionID string, topK i
 	// 构建过滤条件（可选，只搜索特定会话的记忆）
 	var filter string
 	if sessionID != "" {
-		filter = fmt.Sprintf("session_id = '%s'", sessionID)
+		filter = "session_id = " + models.QuoteFilterValue(sessionID)
 	}
 
 	// 构建请求体
@@ -1415,7 +1499,7 @@ func (s *VectorService) SearchMessages(vector []float32, sessionID string, topK
 	// 构建过滤条件（可选，只搜索特定会话的记忆）
 	var filter string
 	if sessionID != "" {
-		filter = fmt.Sprintf("session_id = '%s'", sessionID)
+		filter = "session_id = " + models.QuoteFilterValue(sessionID)
 	}
 
 	// 构建请求体
@@ -1999,7 +2083,7 @@ func (s *VectorService) SearchByID(id string, fieldName string) ([]models.Search
 		searchReq["id"] = id
 	} else {
 		// 其他字段直接匹配filter
-		filter := fmt.Sprintf("%s = '%s'", fieldName, id)
+		filter := fieldName + " = " + models.QuoteFilterValue(id)
 		log.Printf("[ID搜索] 使用字段匹配，过滤条件: %s", filter)
 		searchReq["filter"] = filter
 	}
@@ -2160,7 +2244,7 @@ func (s *VectorService) SearchBySessionID(sessionID string, limit int) ([]models
 	}
 
 	// 构建过滤条件 - 精确匹配sessionID
-	filter := fmt.Sprintf("session_id = '%s'", sessionID)
+	filter := "session_id = " + models.QuoteFilterValue(sessionID)
 
 	// 构建请求体
 	searchReq := map[string]interface{}{
@@ -2440,7 +2524,7 @@ func (s *VectorService) SearchByKeywordsFilter(field string, value string, limit
 	}
 
 	// 构建过滤条件 - 使用标准格式
-	filter := fmt.Sprintf("%s = \"%s\"", field, value)
+	filter := field + " = " + models.QuoteFilterValue(value)
 	log.Printf("[关键词过滤] 使用条件: %s", filter)
 
 	// 构建请求体
@@ -2616,7 +2700,7 @@ func (s *VectorService) SearchVectorsAdvanced(vector []float32, sessionID string
 	// 构建过滤条件（可选，只搜索特定会话的记忆）
 	var filter string
 	if sessionID != "" {
-		filter = fmt.Sprintf("session_id = '%s'", sessionID)
+		filter = "session_id = " + models.QuoteFilterValue(sessionID)
 	}
 
 	// 如果options中提供了filter，优先使用options中的filter
@@ -2760,16 +2844,26 @@ func (s *VectorService) SearchVectorsAdvanced(vector []float32, sessionID string
 		skipFilter = skip
 	}
 
+	// 本次搜索使用的阈值：调用方指定时覆盖全局配置
+	threshold := s.SimilarityThreshold
+	if customThreshold, ok := options["similarity_threshold"].(float64); ok && customThreshold > 0 {
+		threshold = customThreshold
+	}
+
 	// 构造返回结果
 	var searchResults []models.SearchResult
 	var mostSimilarItem *models.SearchResult
 	var smallestScore float64 = 999.0 // 初始化为一个很大的值
 
-	log.Printf("[高级向量搜索] 开始评估数据，相似度阈值: %.4f (小于等于此值视为相关)", s.SimilarityThreshold)
+	if skipFilter {
+		log.Printf("[高级向量搜索] 开始评估数据，已跳过相似度阈值过滤")
+	} else {
+		log.Printf("[高级向量搜索] 开始评估数据，相似度阈值: %.4f (小于等于此值视为相关, 全局配置: %.4f)", threshold, s.SimilarityThreshold)
+	}
 
 	for _, item := range result.Output {
 		// 应用相似度阈值过滤（余弦距离：越小越相似）
-		if skipFilter || item.Score <= s.SimilarityThreshold {
+		if skipFilter || item.Score <= threshold {
 			newResult := models.SearchResult{
 				ID:     item.Id,
 				Score:  item.Score,
@@ -2791,7 +2885,7 @@ func (s *VectorService) SearchVectorsAdvanced(vector []float32, sessionID string
 			}
 		} else {
 			log.Printf("[高级向量搜索] 过滤掉的数据项: ID=%s, 相似度=%.4f (大于阈值 %.4f)",
-				item.Id, item.Score, s.SimilarityThreshold)
+				item.Id, item.Score, threshold)
 		}
 	}
 
@@ -2824,7 +2918,7 @@ func (s *VectorService) CountSessionMemories(sessionID string) (int, error) {
 	log.Printf("[向量搜索] 会话ID: %s", sessionID)
 
 	// 构建过滤查询请求体
-	filter := fmt.Sprintf(`fields.session_id = "%s"`, sessionID)
+	filter := "fields.session_id = " + models.QuoteFilterValue(sessionID)
 	requestBody := map[string]interface{}{
 		"filter": filter,
 		"limit":  1, // 只需要计数，不需要实际数据
@@ -2888,6 +2982,70 @@ func (s *VectorService) CountSessionMemories(sessionID string) (int, error) {
 	return result.Output.Count, nil
 }
 
+// DeleteVectors 根据主键ID批量删除向量记录
+func (s *VectorService) DeleteVectors(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	log.Printf("[向量删除] 开始删除记录, 数量: %d, IDs: %v", len(ids), ids)
+
+	// 序列化请求
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"ids": ids,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化删除请求失败: %w", err)
+	}
+
+	// 创建HTTP请求
+	url := fmt.Sprintf("%s/v1/collections/%s/docs", s.VectorDBURL, s.VectorDBCollection)
+	req, err := http.NewRequest("DELETE", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+
+	// 设置请求头
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("dashvector-auth-token", s.VectorDBAPIKey)
+
+	// 发送请求
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("API请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 读取响应
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	// 检查状态码
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API返回错误状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+	}
+
+	// 解析响应
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	// 检查API结果码
+	if result.Code != 0 {
+		return fmt.Errorf("API返回错误: %d, %s", result.Code, result.Message)
+	}
+
+	log.Printf("[向量删除] 删除成功, 数量: %d", len(ids))
+	return nil
+}
+
 // UserInfo类型现在定义在models包中
 
 const (
@@ -2910,7 +3068,7 @@ func (vs *VectorService) CheckUserIDUniqueness(userID string) (bool, error) {
 
 	// 构造查询请求
 	searchRequest := map[string]interface{}{
-		"filter":        fmt.Sprintf(`fields.userId = "%s"`, userID),
+		"filter":        "fields.userId = " + models.QuoteFilterValue(userID),
 		"limit":         1,
 		"output_fields": []string{"fields.userId"},
 	}
@@ -0,0 +1,193 @@
+package embedding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OpenAIClient OpenAI兼容协议的文本嵌入客户端
+// 适用于OpenAI、Azure OpenAI以及本地部署的兼容/v1/embeddings协议的服务
+type OpenAIClient struct {
+	BaseURL    string // 如 https://api.openai.com/v1 或 Azure的 https://xxx.openai.azure.com/openai/deployments/<deployment>
+	APIKey     string
+	Model      string
+	Dimension  int    // 期望的向量维度，需与向量数据库一致，<=0表示不校验
+	APIVersion string // Azure OpenAI的api-version，非空时使用api-key请求头
+
+	httpClient *http.Client
+}
+
+// NewOpenAIClient 创建OpenAI兼容的文本嵌入客户端
+func NewOpenAIClient(baseURL, apiKey, model string, dimension int, apiVersion string) *OpenAIClient {
+	return &OpenAIClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		Dimension:  dimension,
+		APIVersion: apiVersion,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// GenerateEmbedding 生成文本的向量表示
+func (c *OpenAIClient) GenerateEmbedding(text string) ([]float32, error) {
+	log.Printf("[OpenAI嵌入] 开始生成文本嵌入向量，模型: %s，文本长度: %d 字符", c.Model, len(text))
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"model":           c.Model,
+		"input":           []string{text},
+		"encoding_format": "float",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.endpoint(), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		if c.APIVersion != "" {
+			req.Header.Set("api-key", c.APIKey)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+c.APIKey)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("API请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API返回错误状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w, 响应内容: %s", err, string(respBody))
+	}
+
+	if len(result.Data) == 0 || len(result.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("未返回有效的嵌入向量")
+	}
+
+	vector := result.Data[0].Embedding
+	if c.Dimension > 0 && len(vector) != c.Dimension {
+		return nil, fmt.Errorf("向量维度不匹配: 模型%s返回%d维，VECTOR_DB_DIMENSION配置为%d维，请调整模型或向量库维度",
+			c.Model, len(vector), c.Dimension)
+	}
+
+	log.Printf("[OpenAI嵌入] 成功生成向量，维度: %d", len(vector))
+	return vector, nil
+}
+
+// GenerateEmbeddings 在一次请求中批量生成文本向量，返回的向量与输入文本按下标一一对应
+func (c *OpenAIClient) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	log.Printf("[OpenAI嵌入] 批量生成文本嵌入向量，模型: %s，文本数: %d", c.Model, len(texts))
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"model":           c.Model,
+		"input":           texts,
+		"encoding_format": "float",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.endpoint(), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		if c.APIVersion != "" {
+			req.Header.Set("api-key", c.APIKey)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+c.APIKey)
+		}
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("API请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API返回错误状态码: %d, 响应: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w, 响应内容: %s", err, string(respBody))
+	}
+
+	// 按index放回对应位置，不依赖返回顺序
+	vectors := make([][]float32, len(texts))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(texts) || len(item.Embedding) == 0 {
+			return nil, fmt.Errorf("返回了无效的嵌入向量: index=%d", item.Index)
+		}
+		if c.Dimension > 0 && len(item.Embedding) != c.Dimension {
+			return nil, fmt.Errorf("向量维度不匹配: 模型%s返回%d维，VECTOR_DB_DIMENSION配置为%d维，请调整模型或向量库维度",
+				c.Model, len(item.Embedding), c.Dimension)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if vector == nil {
+			return nil, fmt.Errorf("缺少第%d条文本的嵌入向量", i)
+		}
+	}
+
+	log.Printf("[OpenAI嵌入] 批量生成向量成功，数量: %d", len(vectors))
+	return vectors, nil
+}
+
+// GetEmbeddingDimension 获取向量维度
+func (c *OpenAIClient) GetEmbeddingDimension() int {
+	return c.Dimension
+}
+
+// endpoint 构建embeddings接口地址
+func (c *OpenAIClient) endpoint() string {
+	endpoint := c.BaseURL
+	if !strings.HasSuffix(endpoint, "/embeddings") {
+		endpoint += "/embeddings"
+	}
+	if c.APIVersion != "" {
+		endpoint += "?api-version=" + url.QueryEscape(c.APIVersion)
+	}
+	return endpoint
+}
@@ -0,0 +1,82 @@
+package embedding
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newEmbeddingServer 创建返回固定维度向量的模拟embeddings服务
+func newEmbeddingServer(t *testing.T, dimension int, check func(r *http.Request)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		vector := make([]float32, dimension)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{{"embedding": vector}},
+		})
+	}))
+}
+
+// TestOpenAIClientGenerateEmbedding 测试OpenAI协议请求格式
+func TestOpenAIClientGenerateEmbedding(t *testing.T) {
+	server := newEmbeddingServer(t, 4, func(r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("请求路径错误: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization请求头错误: %s", got)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["model"] != "test-model" {
+			t.Errorf("模型参数错误: %v", body["model"])
+		}
+	})
+	defer server.Close()
+
+	client := NewOpenAIClient(server.URL+"/v1/", "test-key", "test-model", 4, "")
+	vector, err := client.GenerateEmbedding("hello")
+	if err != nil {
+		t.Fatalf("生成向量失败: %v", err)
+	}
+	if len(vector) != 4 {
+		t.Errorf("向量维度错误: %d", len(vector))
+	}
+}
+
+// TestOpenAIClientAzure 测试Azure OpenAI的api-key请求头和api-version参数
+func TestOpenAIClientAzure(t *testing.T) {
+	server := newEmbeddingServer(t, 4, func(r *http.Request) {
+		if got := r.Header.Get("api-key"); got != "azure-key" {
+			t.Errorf("api-key请求头错误: %s", got)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-02-01" {
+			t.Errorf("api-version参数错误: %s", got)
+		}
+	})
+	defer server.Close()
+
+	client := NewOpenAIClient(server.URL+"/openai/deployments/emb", "azure-key", "emb", 4, "2024-02-01")
+	if _, err := client.GenerateEmbedding("hello"); err != nil {
+		t.Fatalf("生成向量失败: %v", err)
+	}
+}
+
+// TestOpenAIClientDimensionMismatch 测试维度与VECTOR_DB_DIMENSION不一致时返回明确错误
+func TestOpenAIClientDimensionMismatch(t *testing.T) {
+	server := newEmbeddingServer(t, 3, nil)
+	defer server.Close()
+
+	client := NewOpenAIClient(server.URL, "", "small-model", 1536, "")
+	_, err := client.GenerateEmbedding("hello")
+	if err == nil {
+		t.Fatal("期望维度不匹配错误")
+	}
+	if !strings.Contains(err.Error(), "VECTOR_DB_DIMENSION") {
+		t.Errorf("错误信息不明确: %v", err)
+	}
+}
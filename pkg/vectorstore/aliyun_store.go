@@ -35,6 +35,11 @@ func (a *AliyunVectorStore) GenerateEmbedding(text string) ([]float32, error) {
 	return a.vectorService.GenerateEmbedding(text)
 }
 
+// GenerateEmbeddings 批量生成文本向量
+func (a *AliyunVectorStore) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	return a.vectorService.GenerateEmbeddings(texts)
+}
+
 // GetEmbeddingDimension 获取向量维度
 func (a *AliyunVectorStore) GetEmbeddingDimension() int {
 	return a.vectorService.GetDimension()
@@ -78,6 +83,12 @@ func (a *AliyunVectorStore) StoreEnhancedMessage(message *models.EnhancedMessage
 	return a.vectorService.StoreEnhancedMessage(message)
 }
 
+// DeleteMemories 根据主键ID批量删除记忆
+func (a *AliyunVectorStore) DeleteMemories(ctx context.Context, ids []string) error {
+	log.Printf("[阿里云向量存储] 删除记忆: 数量=%d", len(ids))
+	return a.vectorService.DeleteVectors(ids)
+}
+
 // =============================================================================
 // VectorSearcher 接口实现
 // =============================================================================
@@ -87,10 +98,17 @@ func (a *AliyunVectorStore) SearchByVector(ctx context.Context, vector []float32
 	log.Printf("[阿里云向量存储] 向量搜索: 维度=%d, 限制=%d", len(vector), options.Limit)
 
 	// 构建搜索选项
-	searchOptions := a.buildSearchOptions(options)
+	searchOptions, err := a.buildSearchOptions(options)
+	if err != nil {
+		return nil, err
+	}
 
-	// 调用原有的高级搜索方法
-	return a.vectorService.SearchVectorsAdvanced(vector, options.SessionID, options.Limit, searchOptions)
+	// 调用原有的高级搜索方法，返回的余弦距离转换为相似度
+	results, err := a.vectorService.SearchVectorsAdvanced(vector, options.SessionID, options.Limit, searchOptions)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeResultScores(results, a.similarity), nil
 }
 
 // SearchByText 使用文本进行搜索（内部转换为向量）
@@ -105,8 +123,16 @@ func (a *AliyunVectorStore) SearchByText(ctx context.Context, query string, opti
 		}
 	}
 
-	// 调用原有的文本搜索方法
-	return a.vectorService.SearchWithTextAndFilters(ctx, query, options.Limit, filters, options.SkipThreshold)
+	// 调用原有的文本搜索方法，阈值转换为距离阈值，返回的距离转换为相似度
+	threshold := 0.0
+	if options.Threshold > 0 {
+		threshold = a.distanceThreshold(options.Threshold)
+	}
+	results, err := a.vectorService.SearchWithTextAndFilters(ctx, query, options.Limit, filters, options.SkipThreshold, threshold)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeResultScores(results, a.similarity), nil
 }
 
 // SearchByID 根据ID精确搜索
@@ -119,6 +145,19 @@ func (a *AliyunVectorStore) SearchByID(ctx context.Context, id string, options *
 
 // SearchByFilter 根据过滤条件搜索
 func (a *AliyunVectorStore) SearchByFilter(ctx context.Context, filter string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	if options.Filter != nil {
+		compiled, err := CompileAliyunFilter(*options.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("编译过滤条件失败: %w", err)
+		}
+		var conditions []string
+		for _, condition := range []string{filter, compiled} {
+			if condition != "" {
+				conditions = append(conditions, condition)
+			}
+		}
+		filter = joinFilters(conditions, " AND ")
+	}
 	log.Printf("[阿里云向量存储] 过滤搜索: 过滤条件='%s', 限制=%d", filter, options.Limit)
 
 	// 调用原有的过滤搜索方法
@@ -186,7 +225,7 @@ func (a *AliyunVectorStore) InitUserStorage() error {
 // =============================================================================
 
 // buildSearchOptions 构建搜索选项，将抽象选项转换为阿里云特定选项
-func (a *AliyunVectorStore) buildSearchOptions(options *models.SearchOptions) map[string]interface{} {
+func (a *AliyunVectorStore) buildSearchOptions(options *models.SearchOptions) (map[string]interface{}, error) {
 	searchOptions := make(map[string]interface{})
 
 	// 跳过阈值过滤
@@ -195,9 +234,14 @@ func (a *AliyunVectorStore) buildSearchOptions(options *models.SearchOptions) ma
 		searchOptions["skip_threshold_filter"] = true
 	}
 
+	// 本次搜索的相似度阈值（覆盖全局配置），阿里云按距离过滤
+	if options.Threshold > 0 {
+		searchOptions["similarity_threshold"] = a.distanceThreshold(options.Threshold)
+	}
+
 	// 用户ID过滤
 	if options.UserID != "" {
-		searchOptions["filter"] = fmt.Sprintf(`userId="%s"`, options.UserID)
+		searchOptions["filter"] = "userId=" + models.QuoteFilterValue(options.UserID)
 	}
 
 	// 额外过滤条件
@@ -212,9 +256,12 @@ func (a *AliyunVectorStore) buildSearchOptions(options *models.SearchOptions) ma
 
 		// 添加额外过滤条件
 		for key, value := range options.ExtraFilters {
+			if err := checkFilterField(key); err != nil {
+				return nil, err
+			}
 			switch v := value.(type) {
 			case string:
-				filterConditions = append(filterConditions, fmt.Sprintf(`%s="%s"`, key, v))
+				filterConditions = append(filterConditions, key+"="+models.QuoteFilterValue(v))
 			case int, int64, float32, float64:
 				filterConditions = append(filterConditions, fmt.Sprintf(`%s=%v`, key, v))
 			case bool:
@@ -228,7 +275,112 @@ func (a *AliyunVectorStore) buildSearchOptions(options *models.SearchOptions) ma
 		}
 	}
 
-	return searchOptions
+	// 时间范围过滤
+	if timeFilter := timeRangeFilter(options.StartTime, options.EndTime); timeFilter != "" {
+		appendAliyunFilter(searchOptions, timeFilter)
+	}
+
+	// 结构化过滤条件
+	if options.Filter != nil {
+		compiled, err := CompileAliyunFilter(*options.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("编译过滤条件失败: %w", err)
+		}
+		if compiled != "" {
+			appendAliyunFilter(searchOptions, compiled)
+		}
+	}
+
+	if filter, ok := searchOptions["filter"].(string); ok {
+		log.Printf("[阿里云向量存储] 最终过滤条件: %s", filter)
+	}
+	return searchOptions, nil
+}
+
+// appendAliyunFilter 以AND追加过滤条件
+func appendAliyunFilter(searchOptions map[string]interface{}, condition string) {
+	if existingFilter, ok := searchOptions["filter"].(string); ok && existingFilter != "" {
+		searchOptions["filter"] = existingFilter + " AND " + condition
+	} else {
+		searchOptions["filter"] = condition
+	}
+}
+
+// CompileAliyunFilter 将结构化过滤条件编译为DashVector过滤表达式，字符串值加双引号并转义，空条件返回空字符串
+func CompileAliyunFilter(filter models.Filter) (string, error) {
+	switch filter.Op {
+	case "":
+		return "", nil
+	case models.FilterOpEq:
+		if err := checkFilterField(filter.Field); err != nil {
+			return "", err
+		}
+		value, err := aliyunFilterValue(filter.Value)
+		if err != nil {
+			return "", fmt.Errorf("字段%s: %w", filter.Field, err)
+		}
+		return fmt.Sprintf("%s = %s", filter.Field, value), nil
+	case models.FilterOpRange:
+		if err := checkFilterField(filter.Field); err != nil {
+			return "", err
+		}
+		var conditions []string
+		if filter.Min > 0 {
+			conditions = append(conditions, fmt.Sprintf("%s >= %d", filter.Field, filter.Min))
+		}
+		if filter.Max > 0 {
+			conditions = append(conditions, fmt.Sprintf("%s <= %d", filter.Field, filter.Max))
+		}
+		return joinFilters(conditions, " AND "), nil
+	case models.FilterOpAnd, models.FilterOpOr:
+		separator := " AND "
+		if filter.Op == models.FilterOpOr {
+			separator = " OR "
+		}
+		var conditions []string
+		for _, child := range filter.Children {
+			condition, err := CompileAliyunFilter(child)
+			if err != nil {
+				return "", err
+			}
+			if condition == "" {
+				continue
+			}
+			if child.Op == models.FilterOpAnd || child.Op == models.FilterOpOr || child.Op == models.FilterOpRange {
+				condition = "(" + condition + ")"
+			}
+			conditions = append(conditions, condition)
+		}
+		return joinFilters(conditions, separator), nil
+	default:
+		return "", fmt.Errorf("不支持的过滤条件类型: %s", filter.Op)
+	}
+}
+
+// aliyunFilterValue 生成过滤表达式中的值
+func aliyunFilterValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return models.QuoteFilterValue(v), nil
+	case int, int32, int64, float32, float64:
+		return fmt.Sprintf("%v", v), nil
+	case bool:
+		return fmt.Sprintf("%t", v), nil
+	default:
+		return "", fmt.Errorf("不支持的过滤值类型: %T", value)
+	}
+}
+
+// timeRangeFilter 生成timestamp字段的范围过滤条件（unix秒，含边界），无范围时返回空字符串
+func timeRangeFilter(startTime, endTime int64) string {
+	var conditions []string
+	if startTime > 0 {
+		conditions = append(conditions, fmt.Sprintf("timestamp >= %d", startTime))
+	}
+	if endTime > 0 {
+		conditions = append(conditions, fmt.Sprintf("timestamp <= %d", endTime))
+	}
+	return joinFilters(conditions, " AND ")
 }
 
 // joinFilters 连接过滤条件
@@ -247,6 +399,16 @@ func joinFilters(conditions []string, separator string) string {
 	return result
 }
 
+// similarity 将阿里云返回的距离得分转换为0-1相似度
+func (a *AliyunVectorStore) similarity(distance float64) float64 {
+	return SimilarityFromDistance(a.vectorService.GetMetric(), distance)
+}
+
+// distanceThreshold 将0-1相似度阈值转换为阿里云使用的距离阈值
+func (a *AliyunVectorStore) distanceThreshold(similarity float64) float64 {
+	return DistanceThreshold(a.vectorService.GetMetric(), similarity)
+}
+
 // GetConfig 获取配置信息
 func (a *AliyunVectorStore) GetConfig() *models.VectorStoreConfig {
 	return a.config
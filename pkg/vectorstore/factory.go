@@ -113,6 +113,8 @@ func (f *VectorStoreFactory) createVectorStoreInstance(storeType models.VectorSt
 		return f.createOpenAIVectorStore(config)
 	case models.VectorStoreTypePinecone:
 		return f.createPineconeVectorStore(config)
+	case models.VectorStoreTypeQdrant:
+		return f.createQdrantVectorStore(config)
 	case models.VectorStoreTypeLocal:
 		return f.createLocalVectorStore(config)
 	default:
@@ -207,6 +209,57 @@ func (f *VectorStoreFactory) createVearchVectorStore(config *models.VectorStoreC
 	return store, nil
 }
 
+// createQdrantVectorStore 创建Qdrant向量存储
+// 嵌入服务优先复用已初始化的阿里云embedding服务，否则使用Qdrant配置中的embedding配置创建
+func (f *VectorStoreFactory) createQdrantVectorStore(config *models.VectorStoreConfig) (models.VectorStore, error) {
+	log.Printf("[向量存储工厂] 创建Qdrant向量存储")
+
+	embeddingService := f.aliyunEmbeddingService
+	if embeddingService == nil && config.EmbeddingConfig.APIEndpoint != "" && config.EmbeddingConfig.APIKey != "" {
+		// 只使用embedding能力，数据库参数留空
+		embeddingService = aliyun.NewVectorService(
+			config.EmbeddingConfig.APIEndpoint,
+			config.EmbeddingConfig.APIKey,
+			"", "", "",
+			config.EmbeddingConfig.Dimension,
+			config.DatabaseConfig.Metric,
+			config.SimilarityThreshold,
+		)
+	}
+
+	var embeddingProvider models.EmbeddingProvider
+	if embeddingService != nil {
+		embeddingProvider = &AliyunEmbeddingAdapter{service: embeddingService}
+	} else {
+		log.Printf("[向量存储工厂] ⚠️ Qdrant未配置embedding服务，需要由上层通过SetEmbeddingProvider提供")
+	}
+
+	qdrantConfig := &QdrantConfig{
+		URL:                   config.DatabaseConfig.Endpoint,
+		APIKey:                config.DatabaseConfig.APIKey,
+		Collection:            config.DatabaseConfig.Collection,
+		Dimension:             config.EmbeddingConfig.Dimension,
+		Metric:                config.DatabaseConfig.Metric,
+		SimilarityThreshold:   config.SimilarityThreshold,
+		RequestTimeoutSeconds: getExtraParamInt(config.DatabaseConfig.ExtraParams, "request_timeout_seconds", 30),
+	}
+	qdrantConfig.MultiVector, _ = config.DatabaseConfig.ExtraParams["multi_vector"].(bool)
+
+	store := NewQdrantStore(qdrantConfig, embeddingProvider)
+
+	// 自动创建集合
+	if err := store.EnsureCollection(qdrantConfig.Collection); err != nil {
+		return nil, fmt.Errorf("Qdrant集合初始化失败: %w", err)
+	}
+	if err := store.InitUserStorage(); err != nil {
+		log.Printf("[向量存储工厂] ⚠️ Qdrant用户集合初始化失败: %v", err)
+	}
+
+	log.Printf("[向量存储工厂] Qdrant存储创建成功: url=%s, collection=%s, 多维度向量=%v",
+		qdrantConfig.URL, qdrantConfig.Collection, qdrantConfig.MultiVector)
+	return store, nil
+}
+
 // 辅助函数：从ExtraParams中获取字符串参数
 func getExtraParam(params map[string]interface{}, key, defaultValue string) string {
 	if params == nil {
@@ -272,9 +325,9 @@ func (f *VectorStoreFactory) createLocalVectorStore(config *models.VectorStoreCo
 	return nil, fmt.Errorf("本地向量存储尚未实现")
 }
 
-// GetVectorStoreTypeFromEnv 从环境变量获取向量存储类型
+// GetVectorStoreTypeFromEnv 从环境变量获取向量存储类型（VECTOR_STORE_TYPE，兼容VECTOR_STORE_PROVIDER）
 func GetVectorStoreTypeFromEnv() models.VectorStoreType {
-	envType := os.Getenv("VECTOR_STORE_TYPE")
+	envType := getEnvWithFallback("VECTOR_STORE_TYPE", "VECTOR_STORE_PROVIDER")
 	if envType == "" {
 		envType = "aliyun" // 默认使用阿里云
 	}
@@ -295,6 +348,8 @@ func GetVectorStoreTypeFromEnv() models.VectorStoreType {
 		return models.VectorStoreTypePinecone
 	case "weaviate":
 		return models.VectorStoreTypeWeaviate
+	case "qdrant":
+		return models.VectorStoreTypeQdrant
 	case "local":
 		return models.VectorStoreTypeLocal
 	default:
@@ -314,6 +369,8 @@ func LoadConfigFromEnv(storeType models.VectorStoreType) (*models.VectorStoreCon
 		return loadVearchConfigFromEnv()
 	case models.VectorStoreTypeTencent:
 		return loadTencentConfigFromEnv()
+	case models.VectorStoreTypeQdrant:
+		return loadQdrantConfigFromEnv()
 	default:
 		return nil, fmt.Errorf("不支持从环境变量加载配置: %s", storeType)
 	}
@@ -445,6 +502,64 @@ func loadVearchConfigFromEnv() (*models.VectorStoreConfig, error) {
 	return config, nil
 }
 
+// loadQdrantConfigFromEnv 从环境变量加载Qdrant配置
+// 集合名称和维度未单独配置时沿用VECTOR_DB_COLLECTION、VECTOR_DB_DIMENSION
+func loadQdrantConfigFromEnv() (*models.VectorStoreConfig, error) {
+	qdrantURL := os.Getenv("QDRANT_URL")
+	if qdrantURL == "" {
+		return nil, fmt.Errorf("Qdrant配置不完整，请检查环境变量: QDRANT_URL")
+	}
+
+	collection := getEnvWithFallback("QDRANT_COLLECTION", "VECTOR_DB_COLLECTION")
+	if collection == "" {
+		collection = "context_keeper"
+	}
+
+	dimension := 1536 // 默认维度
+	if dimensionStr := getEnvWithFallback("QDRANT_DIMENSION", "VECTOR_DB_DIMENSION"); dimensionStr != "" {
+		if dim, err := strconv.Atoi(dimensionStr); err == nil {
+			dimension = dim
+		}
+	}
+
+	metric := os.Getenv("QDRANT_METRIC")
+	if metric == "" {
+		metric = "cosine"
+	}
+
+	similarityThreshold := 0.5 // Qdrant返回相似度，越大越相似
+	if envThreshold := os.Getenv("QDRANT_SIMILARITY_THRESHOLD"); envThreshold != "" {
+		if threshold, err := strconv.ParseFloat(envThreshold, 64); err == nil {
+			similarityThreshold = threshold
+		}
+	}
+
+	config := &models.VectorStoreConfig{
+		Provider: string(models.VectorStoreTypeQdrant),
+		EmbeddingConfig: &models.EmbeddingConfig{
+			APIEndpoint: os.Getenv("EMBEDDING_API_URL"),
+			APIKey:      os.Getenv("EMBEDDING_API_KEY"),
+			Model:       "text-embedding-v1",
+			Dimension:   dimension,
+		},
+		DatabaseConfig: &models.DatabaseConfig{
+			Endpoint:   qdrantURL,
+			APIKey:     os.Getenv("QDRANT_API_KEY"),
+			Collection: collection,
+			Metric:     metric,
+			ExtraParams: map[string]interface{}{
+				"request_timeout_seconds": getEnvInt("QDRANT_REQUEST_TIMEOUT", 30),
+				"multi_vector":            os.Getenv("QDRANT_MULTI_VECTOR") == "true",
+			},
+		},
+		DefaultCollection:   collection,
+		SimilarityThreshold: similarityThreshold,
+	}
+
+	log.Printf("[向量存储工厂] Qdrant配置加载完成: URL=%s, Collection=%s", qdrantURL, collection)
+	return config, nil
+}
+
 // loadTencentConfigFromEnv 从环境变量加载腾讯云配置（待实现）
 func loadTencentConfigFromEnv() (*models.VectorStoreConfig, error) {
 	return nil, fmt.Errorf("腾讯云配置加载尚未实现")
@@ -512,12 +627,22 @@ func InitializeFactoryFromEnv() (*VectorStoreFactory, error) {
 		log.Printf("[向量存储工厂] ⚠️ Vearch配置加载失败: %v", err)
 	}
 
-	// 3. 可以扩展更多类型...
+	// 3. 加载Qdrant配置（如果环境变量存在）
+	if os.Getenv("QDRANT_URL") != "" {
+		if qdrantConfig, err := loadQdrantConfigFromEnv(); err == nil {
+			factory.RegisterConfig(models.VectorStoreTypeQdrant, qdrantConfig)
+			log.Printf("[向量存储工厂] ✅ Qdrant配置注册成功")
+		} else {
+			log.Printf("[向量存储工厂] ⚠️ Qdrant配置加载失败: %v", err)
+		}
+	}
+
+	// 4. 可以扩展更多类型...
 	// if tencentConfig, err := loadTencentConfigFromEnv(); err == nil {
 	//     factory.RegisterConfig(models.VectorStoreTypeTencent, tencentConfig)
 	// }
 
-	// 4. 预初始化所有已注册的向量存储实例
+	// 5. 预初始化所有已注册的向量存储实例
 	if err := factory.InitializeAllInstances(); err != nil {
 		log.Printf("[向量存储工厂] ⚠️ 部分实例初始化失败: %v", err)
 		// 不返回错误，允许部分初始化成功
@@ -0,0 +1,17 @@
+package vectorstore
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// filterFieldPattern 结构化过滤条件允许的字段名：标识符，可用点号访问嵌套字段
+var filterFieldPattern = regexp.MustCompile(`^[A-Za-z_][\w]*(\.[A-Za-z_][\w]*)*$`)
+
+// checkFilterField 校验结构化过滤条件中的字段名，字段名会直接写入各存储的过滤语法
+func checkFilterField(field string) error {
+	if !filterFieldPattern.MatchString(field) {
+		return fmt.Errorf("无效的过滤字段名: %q", field)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package vectorstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestCompileFilter 测试结构化过滤条件编译为各存储的语法，用户ID中的引号被转义而不会改写过滤表达式
+func TestCompileFilter(t *testing.T) {
+	filter := models.FilterAnd(
+		models.FilterEq(models.FilterFieldUserID, `user_a" OR userId!="`),
+		models.FilterOr(models.FilterEq("session_id", "s1"), models.FilterEq("session_id", "s2")),
+		models.FilterRange(models.FilterFieldTimestamp, 100, 0),
+	)
+
+	aliyun, err := CompileAliyunFilter(filter)
+	if err != nil {
+		t.Fatalf("编译阿里云过滤条件失败: %v", err)
+	}
+	expected := `userId = "user_a\" OR userId!=\"" AND (session_id = "s1" OR session_id = "s2") AND (timestamp >= 100)`
+	if aliyun != expected {
+		t.Errorf("阿里云过滤条件错误:\n got: %s\nwant: %s", aliyun, expected)
+	}
+
+	conditions, err := compileVearchConditions(filter)
+	if err != nil {
+		t.Fatalf("编译Vearch过滤条件失败: %v", err)
+	}
+	if len(conditions) != 3 || conditions[0].Field != "user_id" || conditions[1].Operator != "IN" || len(conditions[1].Value.([]interface{})) != 2 {
+		t.Errorf("Vearch过滤条件错误: %+v", conditions)
+	}
+	if _, err := compileVearchConditions(models.FilterOr(models.FilterEq("a", "1"), models.FilterEq("b", "2"))); err == nil {
+		t.Error("Vearch不支持不同字段的OR组合，应返回错误")
+	}
+	if _, err := CompileAliyunFilter(models.FilterEq(`userId="x" OR 1`, "y")); err == nil {
+		t.Error("非法字段名应返回错误")
+	}
+}
+
+// TestInMemoryVectorStoreStructuredFilter 测试内存存储按结构化过滤条件（含OR）过滤
+func TestInMemoryVectorStoreStructuredFilter(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryVectorStore(64, 0)
+	storeTestMemory(t, store, "m1", "s1", "user_a", "修复登录超时 bug")
+	storeTestMemory(t, store, "m2", "s2", "user_a", "修复登录超时问题")
+	storeTestMemory(t, store, "m3", "s3", "user_a", "修复登录超时")
+	storeTestMemory(t, store, "m4", "s1", "user_b", "修复登录超时 bug")
+
+	filter := models.FilterAnd(
+		models.FilterEq(models.FilterFieldUserID, "user_a"),
+		models.FilterOr(models.FilterEq("session_id", "s1"), models.FilterEq("session_id", "s2")),
+	)
+	results, err := store.SearchByText(ctx, "登录超时", &models.SearchOptions{Limit: 10, SkipThreshold: true, Filter: &filter})
+	if err != nil {
+		t.Fatalf("SearchByText failed: %v", err)
+	}
+	ids := map[string]bool{}
+	for _, result := range results {
+		ids[result.ID] = true
+	}
+	if len(results) != 2 || !ids["m1"] || !ids["m2"] {
+		t.Errorf("Expected m1 and m2, got %+v", results)
+	}
+}
+
+// TestQuotedFilterValues 测试含引号、空格、AND/OR关键字的会话ID和用户ID经转义拼接后，过滤字符串仍解析为原有的两个条件
+func TestQuotedFilterValues(t *testing.T) {
+	adversarial := []string{
+		`user_a" OR userId="user_b`,
+		`s1" AND userId!="x`,
+		`with space AND or OR`,
+		`back\slash\" and 'single'`,
+	}
+	for _, value := range adversarial {
+		filter := "session_id=" + models.QuoteFilterValue(value) + " AND userId=" + models.QuoteFilterValue(value)
+		parsed, err := parseQdrantFilter(filter)
+		if err != nil {
+			t.Fatalf("解析过滤条件失败 %s: %v", filter, err)
+		}
+		if len(parsed.Must) != 2 || len(parsed.MustNot) != 0 {
+			t.Fatalf("过滤条件结构被改写 %s: %+v", filter, parsed)
+		}
+		for _, condition := range parsed.Must {
+			if condition.Match["value"] != value {
+				t.Errorf("字段%s的值应为%q，实际为%q", condition.Key, value, condition.Match["value"])
+			}
+		}
+	}
+
+	store := NewInMemoryVectorStore(64, 0)
+	storeTestMemory(t, store, "m1", "s1", "user_a", "修复登录超时 bug")
+	storeTestMemory(t, store, "m2", "s1", "user_b", "修复登录超时 bug")
+	results, err := store.SearchByFilter(context.Background(), "userId="+models.QuoteFilterValue(`user_a" OR userId="user_b`), &models.SearchOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchByFilter failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("注入的OR条件不应匹配任何用户，实际返回: %+v", results)
+	}
+}
+
+// TestIsValidUserID 测试用户ID格式校验拒绝含引号、空格等字符的ID
+func TestIsValidUserID(t *testing.T) {
+	for _, userID := range []string{"user_a", "user_abc12345", "user_Dev_01"} {
+		if !models.IsValidUserID(userID) {
+			t.Errorf("%q 应为合法用户ID", userID)
+		}
+	}
+	for _, userID := range []string{"", "user_", "admin", `user_a"`, "user_a b", "user_a OR 1", `user_a\`, "user_a-b"} {
+		if models.IsValidUserID(userID) {
+			t.Errorf("%q 应被拒绝", userID)
+		}
+	}
+}
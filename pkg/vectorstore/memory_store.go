@@ -0,0 +1,718 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 测试用内存向量存储
+// =============================================================================
+
+// 确保内存向量存储实现了服务层使用的全部接口
+var (
+	_ models.VectorStore            = (*InMemoryVectorStore)(nil)
+	_ models.MultiVectorSearcher    = (*InMemoryVectorStore)(nil)
+	_ models.BatchEmbeddingProvider = (*InMemoryVectorStore)(nil)
+)
+
+// InMemoryVectorStore 仅供测试使用的内存向量存储，不依赖阿里云、Vearch等外部服务
+// 字段与Qdrant实现保持一致（userId、session_id、bizType等），写入时经过一次JSON编解码，
+// 数字字段与真实后端一样以float64返回；得分为余弦相似度（越大越相似），同ID写入时覆盖
+type InMemoryVectorStore struct {
+	mu                  sync.RWMutex
+	dimension           int
+	similarityThreshold float64
+	multiVector         bool
+	embedder            *DeterministicEmbeddingProvider
+	records             map[string]*memoryRecord
+	order               []string // 写入顺序，过滤搜索按此顺序返回
+	collections         map[string]bool
+	users               map[string]*models.UserInfo
+}
+
+// memoryRecord 内存中的一条记录
+type memoryRecord struct {
+	vector     []float32
+	dimensions map[string][]float32 // 多维度向量，键为维度字段名
+	fields     map[string]interface{}
+}
+
+// NewInMemoryVectorStore 创建内存向量存储，使用确定性的假嵌入生成向量
+// similarityThreshold<=0表示不过滤
+func NewInMemoryVectorStore(dimension int, similarityThreshold float64) *InMemoryVectorStore {
+	if dimension <= 0 {
+		dimension = 64
+	}
+	return &InMemoryVectorStore{
+		dimension:           dimension,
+		similarityThreshold: similarityThreshold,
+		embedder:            NewDeterministicEmbeddingProvider(dimension),
+		records:             make(map[string]*memoryRecord),
+		collections:         make(map[string]bool),
+		users:               make(map[string]*models.UserInfo),
+	}
+}
+
+// EnableMultiVector 启用多维度向量，写入记忆时同时保存维度向量
+func (m *InMemoryVectorStore) EnableMultiVector() *InMemoryVectorStore {
+	m.multiVector = true
+	return m
+}
+
+// Len 返回当前记录数
+func (m *InMemoryVectorStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.records)
+}
+
+// =============================================================================
+// EmbeddingProvider 接口实现
+// =============================================================================
+
+// GenerateEmbedding 使用确定性的假嵌入生成向量
+func (m *InMemoryVectorStore) GenerateEmbedding(text string) ([]float32, error) {
+	return m.embedder.GenerateEmbedding(text)
+}
+
+// GenerateEmbeddings 批量生成向量
+func (m *InMemoryVectorStore) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	return m.embedder.GenerateEmbeddings(texts)
+}
+
+// GetEmbeddingDimension 获取向量维度
+func (m *InMemoryVectorStore) GetEmbeddingDimension() int {
+	return m.dimension
+}
+
+// =============================================================================
+// MemoryStorage 接口实现
+// =============================================================================
+
+// StoreMemory 存储记忆
+func (m *InMemoryVectorStore) StoreMemory(memory *models.Memory) error {
+	if len(memory.Vector) == 0 {
+		return fmt.Errorf("存储前必须先生成向量")
+	}
+
+	storageID, metadataStr := storageIDAndMetadata(memory.ID, memory.Metadata)
+	fields := map[string]interface{}{
+		"id":             storageID,
+		"session_id":     memory.SessionID,
+		"content":        memory.Content,
+		"timestamp":      memory.Timestamp,
+		"formatted_time": time.Unix(memory.Timestamp, 0).Format("2006-01-02 15:04:05"),
+		"priority":       memory.Priority,
+		"metadata":       metadataStr,
+		"memory_id":      memory.ID,
+		"bizType":        memory.BizType,
+		"userId":         memory.UserID,
+	}
+	fields[models.MetadataPayloadField] = structuredMetadata(memory.Metadata)
+
+	var dimensions map[string][]float32
+	if m.multiVector && memory.MultiVectorData != nil {
+		dimensions = make(map[string][]float32)
+		for field, dimension := range map[string]struct {
+			vector []float32
+			weight float64
+		}{
+			models.VectorFieldCoreIntent:    {memory.MultiVectorData.CoreIntentVector, memory.MultiVectorData.CoreIntentWeight},
+			models.VectorFieldDomainContext: {memory.MultiVectorData.DomainContextVector, memory.MultiVectorData.DomainContextWeight},
+			models.VectorFieldScenario:      {memory.MultiVectorData.ScenarioVector, memory.MultiVectorData.ScenarioWeight},
+		} {
+			if len(dimension.vector) == 0 {
+				continue
+			}
+			dimensions[field] = dimension.vector
+			fields[field+"_weight"] = dimension.weight
+		}
+	}
+	return m.put(storageID, memory.Vector, dimensions, fields)
+}
+
+// StoreMessage 存储消息
+func (m *InMemoryVectorStore) StoreMessage(message *models.Message) error {
+	if len(message.Vector) == 0 {
+		return fmt.Errorf("存储前必须先生成向量")
+	}
+
+	storageID, metadataStr := storageIDAndMetadata(message.ID, message.Metadata)
+	fields := map[string]interface{}{
+		"id":             storageID,
+		"session_id":     message.SessionID,
+		"role":           message.Role,
+		"content":        message.Content,
+		"content_type":   message.ContentType,
+		"timestamp":      message.Timestamp,
+		"formatted_time": time.Unix(message.Timestamp, 0).Format("2006-01-02 15:04:05"),
+		"priority":       message.Priority,
+		"metadata":       metadataStr,
+		"message_id":     message.ID,
+	}
+	fields[models.MetadataPayloadField] = structuredMetadata(message.Metadata)
+	return m.put(storageID, message.Vector, nil, fields)
+}
+
+// CountMemories 统计指定会话的记录数
+func (m *InMemoryVectorStore) CountMemories(sessionID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, record := range m.records {
+		if record.fields["session_id"] == sessionID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// StoreEnhancedMemory 存储增强的多维度记忆，多维度分析结果作为附加字段保存
+func (m *InMemoryVectorStore) StoreEnhancedMemory(memory *models.EnhancedMemory) error {
+	if memory.Memory == nil {
+		return fmt.Errorf("增强记忆缺少基础记忆")
+	}
+	if err := m.StoreMemory(memory.Memory); err != nil {
+		return err
+	}
+	storageID, _ := storageIDAndMetadata(memory.Memory.ID, memory.Memory.Metadata)
+	return m.merge(storageID, map[string]interface{}{
+		"semantic_tags":    memory.SemanticTags,
+		"concept_entities": memory.ConceptEntities,
+		"related_concepts": memory.RelatedConcepts,
+		"importance_score": memory.ImportanceScore,
+		"relevance_score":  memory.RelevanceScore,
+		"context_summary":  memory.ContextSummary,
+		"tech_stack":       memory.TechStack,
+		"project_context":  memory.ProjectContext,
+		"event_type":       memory.EventType,
+	})
+}
+
+// StoreEnhancedMessage 存储增强的多维度消息，多维度分析结果作为附加字段保存
+func (m *InMemoryVectorStore) StoreEnhancedMessage(message *models.EnhancedMessage) error {
+	if message.Message == nil {
+		return fmt.Errorf("增强消息缺少基础消息")
+	}
+	if err := m.StoreMessage(message.Message); err != nil {
+		return err
+	}
+	storageID, _ := storageIDAndMetadata(message.Message.ID, message.Message.Metadata)
+	return m.merge(storageID, map[string]interface{}{
+		"semantic_tags":    message.SemanticTags,
+		"concept_entities": message.ConceptEntities,
+		"related_concepts": message.RelatedConcepts,
+		"importance_score": message.ImportanceScore,
+		"relevance_score":  message.RelevanceScore,
+		"context_summary":  message.ContextSummary,
+		"tech_stack":       message.TechStack,
+		"project_context":  message.ProjectContext,
+		"event_type":       message.EventType,
+	})
+}
+
+// DeleteMemories 根据主键ID批量删除记录，不存在的ID忽略
+func (m *InMemoryVectorStore) DeleteMemories(ctx context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		delete(m.records, id)
+	}
+	order := m.order[:0]
+	for _, id := range m.order {
+		if _, ok := m.records[id]; ok {
+			order = append(order, id)
+		}
+	}
+	m.order = order
+	return nil
+}
+
+// =============================================================================
+// VectorSearcher 接口实现
+// =============================================================================
+
+// SearchByVector 按余弦相似度搜索，支持会话、用户、额外条件和时间范围过滤
+func (m *InMemoryVectorStore) SearchByVector(ctx context.Context, vector []float32, options *models.SearchOptions) ([]models.SearchResult, error) {
+	return m.searchVectors(vector, "", options)
+}
+
+// SearchByText 使用假嵌入生成查询向量后搜索
+func (m *InMemoryVectorStore) SearchByText(ctx context.Context, query string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	vector, err := m.GenerateEmbedding(query)
+	if err != nil {
+		return nil, fmt.Errorf("生成查询向量失败: %w", err)
+	}
+	return m.SearchByVector(ctx, vector, options)
+}
+
+// SearchByID 根据存储ID（batchId或memoryId）精确搜索
+func (m *InMemoryVectorStore) SearchByID(ctx context.Context, id string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, ok := m.records[id]
+	if !ok {
+		return []models.SearchResult{}, nil
+	}
+	return []models.SearchResult{{ID: id, Fields: copyFields(record.fields)}}, nil
+}
+
+// SearchByFilter 根据过滤条件搜索，过滤字符串格式与Qdrant实现一致，按写入顺序返回
+func (m *InMemoryVectorStore) SearchByFilter(ctx context.Context, filter string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	if options == nil {
+		options = &models.SearchOptions{}
+	}
+	conditions, err := buildQdrantFilter(filter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := []models.SearchResult{}
+	for _, id := range m.order {
+		record := m.records[id]
+		if !matchesMemoryFilter(record.fields, conditions) {
+			continue
+		}
+		results = append(results, models.SearchResult{ID: id, Fields: copyFields(record.fields)})
+		if len(results) >= qdrantLimit(options.Limit) {
+			break
+		}
+	}
+	return results, nil
+}
+
+// SupportsStructuredMetadata 记录中以结构化对象保存了metadata，可按 metadata_fields.<键> 过滤
+func (m *InMemoryVectorStore) SupportsStructuredMetadata() bool {
+	return true
+}
+
+// =============================================================================
+// MultiVectorSearcher 接口实现
+// =============================================================================
+
+// SupportsMultiVector 是否已启用多维度向量
+func (m *InMemoryVectorStore) SupportsMultiVector() bool {
+	return m.multiVector
+}
+
+// SearchByVectorField 在指定维度向量上搜索，过滤和阈值规则与SearchByVector一致
+func (m *InMemoryVectorStore) SearchByVectorField(ctx context.Context, field string, vector []float32, options *models.SearchOptions) ([]models.SearchResult, error) {
+	if !m.multiVector {
+		return nil, fmt.Errorf("内存向量存储未启用多维度向量")
+	}
+	if !isQdrantDimensionField(field) {
+		return nil, fmt.Errorf("不支持的维度向量字段: %s", field)
+	}
+	return m.searchVectors(vector, field, options)
+}
+
+// DefaultSimilarityThreshold 未指定阈值时使用的相似度阈值
+func (m *InMemoryVectorStore) DefaultSimilarityThreshold() float64 {
+	return m.similarityThreshold
+}
+
+// =============================================================================
+// CollectionManager 接口实现
+// =============================================================================
+
+// EnsureCollection 确保集合存在
+func (m *InMemoryVectorStore) EnsureCollection(collectionName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.collections[collectionName] = true
+	return nil
+}
+
+// CreateCollection 创建新集合
+func (m *InMemoryVectorStore) CreateCollection(name string, config *models.CollectionConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.collections[name] {
+		return fmt.Errorf("集合已存在: %s", name)
+	}
+	m.collections[name] = true
+	return nil
+}
+
+// DeleteCollection 删除集合
+func (m *InMemoryVectorStore) DeleteCollection(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.collections, name)
+	return nil
+}
+
+// CollectionExists 检查集合是否存在
+func (m *InMemoryVectorStore) CollectionExists(name string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.collections[name], nil
+}
+
+// =============================================================================
+// UserDataStorage 接口实现
+// =============================================================================
+
+// StoreUserInfo 存储用户信息
+func (m *InMemoryVectorStore) StoreUserInfo(userInfo *models.UserInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *userInfo
+	m.users[userInfo.UserID] = &stored
+	return nil
+}
+
+// GetUserInfo 获取用户信息，不存在时返回nil
+func (m *InMemoryVectorStore) GetUserInfo(userID string) (*models.UserInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	userInfo, ok := m.users[userID]
+	if !ok {
+		return nil, nil
+	}
+	stored := *userInfo
+	return &stored, nil
+}
+
+// CheckUserExists 检查用户是否存在
+func (m *InMemoryVectorStore) CheckUserExists(userID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.users[userID]
+	return ok, nil
+}
+
+// InitUserStorage 初始化用户存储
+func (m *InMemoryVectorStore) InitUserStorage() error {
+	return nil
+}
+
+// GetProvider 获取提供商类型
+func (m *InMemoryVectorStore) GetProvider() models.VectorStoreType {
+	return models.VectorStoreTypeLocal
+}
+
+// =============================================================================
+// 内部辅助方法
+// =============================================================================
+
+// put 写入或覆盖一条记录，字段经过JSON编解码以模拟真实后端返回的类型
+func (m *InMemoryVectorStore) put(id string, vector []float32, dimensions map[string][]float32, fields map[string]interface{}) error {
+	if len(vector) != m.dimension {
+		return fmt.Errorf("向量维度不匹配: 期望%d, 实际%d", m.dimension, len(vector))
+	}
+	normalized, err := normalizeFields(fields)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.records[id]; !exists {
+		m.order = append(m.order, id)
+	}
+	m.records[id] = &memoryRecord{
+		vector:     append([]float32(nil), vector...),
+		dimensions: dimensions,
+		fields:     normalized,
+	}
+	return nil
+}
+
+// merge 向已有记录追加字段
+func (m *InMemoryVectorStore) merge(id string, fields map[string]interface{}) error {
+	normalized, err := normalizeFields(fields)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[id]
+	if !ok {
+		return fmt.Errorf("记录不存在: %s", id)
+	}
+	for key, value := range normalized {
+		record.fields[key] = value
+	}
+	return nil
+}
+
+// searchVectors 在主向量（field为空）或指定维度向量上按余弦相似度搜索
+func (m *InMemoryVectorStore) searchVectors(vector []float32, field string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	if options == nil {
+		options = &models.SearchOptions{}
+	}
+	conditions, err := buildQdrantFilter("", options)
+	if err != nil {
+		return nil, err
+	}
+	threshold := m.similarityThreshold
+	if options.Threshold > 0 {
+		threshold = options.Threshold
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := []models.SearchResult{}
+	for _, id := range m.order {
+		record := m.records[id]
+		candidate := record.vector
+		if field != "" {
+			candidate = record.dimensions[field]
+		}
+		if len(candidate) == 0 || !matchesMemoryFilter(record.fields, conditions) {
+			continue
+		}
+		score := clampSimilarity(cosineSimilarity(vector, candidate))
+		if !options.SkipThreshold && threshold > 0 && score < threshold {
+			continue
+		}
+		results = append(results, models.SearchResult{ID: id, Score: score, Fields: copyFields(record.fields)})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if limit := qdrantLimit(options.Limit); len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// matchesMemoryFilter 判断记录字段是否满足过滤条件，值按字符串形式比较以兼容JSON数字类型
+func matchesMemoryFilter(fields map[string]interface{}, filter *qdrantFilter) bool {
+	if filter == nil {
+		return true
+	}
+	for _, condition := range filter.Must {
+		if !matchesMemoryCondition(fields, condition) {
+			return false
+		}
+	}
+	for _, condition := range filter.MustNot {
+		if matchesMemoryCondition(fields, condition) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesMemoryCondition 判断单个字段条件，支持精确匹配、gte/lte范围和嵌套的must/should条件
+func matchesMemoryCondition(fields map[string]interface{}, condition qdrantCondition) bool {
+	if len(condition.Must) > 0 || len(condition.Should) > 0 {
+		for _, child := range condition.Must {
+			if !matchesMemoryCondition(fields, child) {
+				return false
+			}
+		}
+		if len(condition.Should) == 0 {
+			return true
+		}
+		for _, child := range condition.Should {
+			if matchesMemoryCondition(fields, child) {
+				return true
+			}
+		}
+		return false
+	}
+	value, ok := lookupFieldPath(fields, condition.Key)
+	if !ok {
+		return false
+	}
+	if expected, ok := condition.Match["value"]; ok && !matchesFieldValue(value, expected) {
+		return false
+	}
+	if len(condition.Range) > 0 {
+		number, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		if gte, ok := condition.Range["gte"].(int64); ok && number < float64(gte) {
+			return false
+		}
+		if lte, ok := condition.Range["lte"].(int64); ok && number > float64(lte) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupFieldPath 查找字段，键中的点号按嵌套对象逐级访问（与Qdrant的嵌套payload键一致）
+func lookupFieldPath(fields map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := fields[key]; ok {
+		return value, true
+	}
+	head, rest, found := strings.Cut(key, ".")
+	if !found {
+		return nil, false
+	}
+	nested, ok := fields[head].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookupFieldPath(nested, rest)
+}
+
+// matchesFieldValue 按字符串形式比较字段值，字段为数组时任一元素相等即匹配（与Qdrant一致）
+func matchesFieldValue(value, expected interface{}) bool {
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if fmt.Sprint(item) == fmt.Sprint(expected) {
+				return true
+			}
+		}
+		return false
+	}
+	return fmt.Sprint(value) == fmt.Sprint(expected)
+}
+
+// normalizeFields 对字段做一次JSON编解码
+func normalizeFields(fields map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("序列化字段失败: %w", err)
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, fmt.Errorf("解析字段失败: %w", err)
+	}
+	return normalized, nil
+}
+
+// copyFields 复制字段，避免调用方修改存储中的记录
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		copied[key] = value
+	}
+	return copied
+}
+
+// cosineSimilarity 计算余弦相似度，维度不一致或零向量时返回0
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// =============================================================================
+// 确定性假嵌入
+// =============================================================================
+
+// DeterministicEmbeddingProvider 仅供测试使用的确定性嵌入，相同文本总是得到相同向量
+// 英文按单词、中文按单字切分，词项哈希到固定维度后归一化，共享词项越多的文本余弦相似度越高
+type DeterministicEmbeddingProvider struct {
+	dimension int
+}
+
+// NewDeterministicEmbeddingProvider 创建确定性假嵌入
+func NewDeterministicEmbeddingProvider(dimension int) *DeterministicEmbeddingProvider {
+	if dimension <= 0 {
+		dimension = 64
+	}
+	return &DeterministicEmbeddingProvider{dimension: dimension}
+}
+
+// GenerateEmbedding 生成文本的假向量，空文本返回错误
+func (p *DeterministicEmbeddingProvider) GenerateEmbedding(text string) ([]float32, error) {
+	terms := embeddingTerms(text)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("文本内容为空")
+	}
+
+	vector := make([]float32, p.dimension)
+	for _, term := range terms {
+		hash := fnv.New64a()
+		hash.Write([]byte(term))
+		sum := hash.Sum64()
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vector[sum%uint64(p.dimension)] += sign
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range vector {
+			vector[i] *= scale
+		}
+	}
+	return vector, nil
+}
+
+// GenerateEmbeddings 批量生成假向量
+func (p *DeterministicEmbeddingProvider) GenerateEmbeddings(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vector, err := p.GenerateEmbedding(text)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, vector)
+	}
+	return vectors, nil
+}
+
+// GetEmbeddingDimension 获取向量维度
+func (p *DeterministicEmbeddingProvider) GetEmbeddingDimension() int {
+	return p.dimension
+}
+
+// embeddingTerms 将文本切分为小写单词和单个汉字
+func embeddingTerms(text string) []string {
+	var terms []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			terms = append(terms, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			terms = append(terms, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return terms
+}
@@ -0,0 +1,78 @@
+package vectorstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+func storeTestMemory(t *testing.T, store *InMemoryVectorStore, id, sessionID, userID, content string) {
+	t.Helper()
+	vector, err := store.GenerateEmbedding(content)
+	if err != nil {
+		t.Fatalf("GenerateEmbedding failed: %v", err)
+	}
+	memory := models.NewMemory(sessionID, content, "P1", map[string]interface{}{"type": "long_term_memory"})
+	memory.ID = id
+	memory.UserID = userID
+	memory.Vector = vector
+	if err := store.StoreMemory(memory); err != nil {
+		t.Fatalf("StoreMemory failed: %v", err)
+	}
+}
+
+// TestDeterministicEmbedding 测试假嵌入对相同文本结果一致，共享词项越多相似度越高
+func TestDeterministicEmbedding(t *testing.T) {
+	provider := NewDeterministicEmbeddingProvider(64)
+	a, _ := provider.GenerateEmbedding("修复登录超时 bug")
+	b, _ := provider.GenerateEmbedding("修复登录超时 bug")
+	if cosineSimilarity(a, b) < 0.999 {
+		t.Errorf("Expected identical vectors for identical text")
+	}
+	similar, _ := provider.GenerateEmbedding("登录超时问题")
+	unrelated, _ := provider.GenerateEmbedding("deploy kubernetes cluster")
+	if cosineSimilarity(a, similar) <= cosineSimilarity(a, unrelated) {
+		t.Errorf("Expected related text to score higher than unrelated text")
+	}
+	if _, err := provider.GenerateEmbedding("  "); err == nil {
+		t.Error("Expected error for empty text")
+	}
+}
+
+// TestInMemoryVectorStoreSearch 测试相似度搜索、用户和会话过滤、阈值及删除
+func TestInMemoryVectorStoreSearch(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryVectorStore(64, 0.5)
+	storeTestMemory(t, store, "m1", "s1", "user_a", "修复登录超时 bug")
+	storeTestMemory(t, store, "m2", "s2", "user_a", "deploy kubernetes cluster")
+	storeTestMemory(t, store, "m3", "s1", "user_b", "修复登录超时 bug")
+
+	results, err := store.SearchByText(ctx, "登录超时", &models.SearchOptions{Limit: 10, UserID: "user_a"})
+	if err != nil {
+		t.Fatalf("SearchByText failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "m1" {
+		t.Errorf("Expected only m1 above threshold for user_a, got %+v", results)
+	}
+	if timestamp, ok := results[0].Fields["timestamp"].(float64); !ok || timestamp <= 0 {
+		t.Errorf("Expected numeric fields decoded as float64, got %T", results[0].Fields["timestamp"])
+	}
+
+	results, _ = store.SearchByText(ctx, "登录超时", &models.SearchOptions{Limit: 10, UserID: "user_a", SkipThreshold: true})
+	if len(results) != 2 || results[0].ID != "m1" {
+		t.Errorf("Expected both user_a records ranked by similarity when skipping threshold, got %+v", results)
+	}
+
+	results, _ = store.SearchByFilter(ctx, `session_id="s1" AND userId="user_b"`, &models.SearchOptions{Limit: 10})
+	if len(results) != 1 || results[0].ID != "m3" {
+		t.Errorf("Expected m3 from filter search, got %+v", results)
+	}
+
+	if err := store.DeleteMemories(ctx, []string{"m1", "missing"}); err != nil {
+		t.Fatalf("DeleteMemories failed: %v", err)
+	}
+	if results, _ := store.SearchByID(ctx, "m1", nil); len(results) != 0 || store.Len() != 2 {
+		t.Errorf("Expected m1 deleted, got %+v", results)
+	}
+}
@@ -0,0 +1,154 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// MultiVectorSearcher 接口实现
+// =============================================================================
+
+// 主集合只有一个未命名向量，无法追加命名向量；维度向量单独存放在 <Collection>_dims，
+// 点ID与主集合一致，payload复制主记录的字段并附带各维度的存储权重
+
+// qdrantDimensionFields 维度集合中的命名向量
+var qdrantDimensionFields = []string{
+	models.VectorFieldCoreIntent,
+	models.VectorFieldDomainContext,
+	models.VectorFieldScenario,
+}
+
+// SupportsMultiVector 是否已启用多维度向量
+func (q *QdrantStore) SupportsMultiVector() bool {
+	return q.config.MultiVector
+}
+
+// DefaultSimilarityThreshold 未指定阈值时使用的相似度阈值
+func (q *QdrantStore) DefaultSimilarityThreshold() float64 {
+	return q.config.SimilarityThreshold
+}
+
+// SearchByVectorField 在维度集合的指定命名向量上搜索，过滤和阈值规则与SearchByVector一致
+func (q *QdrantStore) SearchByVectorField(ctx context.Context, field string, vector []float32, options *models.SearchOptions) ([]models.SearchResult, error) {
+	if !q.config.MultiVector {
+		return nil, fmt.Errorf("Qdrant未启用多维度向量")
+	}
+	if !isQdrantDimensionField(field) {
+		return nil, fmt.Errorf("不支持的维度向量字段: %s", field)
+	}
+	if options == nil {
+		options = &models.SearchOptions{}
+	}
+	log.Printf("[Qdrant存储] 维度向量搜索: 字段=%s, 维度=%d, 限制=%d", field, len(vector), options.Limit)
+
+	filter, err := buildQdrantFilter("", options)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"vector":       map[string]interface{}{"name": field, "vector": vector},
+		"limit":        qdrantLimit(options.Limit),
+		"with_payload": true,
+	}
+	if filter != nil {
+		body["filter"] = filter
+	}
+	if !options.SkipThreshold {
+		threshold := q.config.SimilarityThreshold
+		if options.Threshold > 0 {
+			threshold = options.Threshold
+		}
+		if threshold > 0 {
+			body["score_threshold"] = q.scoreThreshold(threshold)
+		}
+	}
+
+	var points []qdrantPoint
+	if _, err := q.doRequest(ctx, http.MethodPost, q.collectionPath(q.dimensionCollection())+"/points/search", body, &points); err != nil {
+		return nil, fmt.Errorf("维度向量搜索失败: %w", err)
+	}
+
+	log.Printf("[Qdrant存储] 维度向量搜索完成: 字段=%s, 结果数=%d", field, len(points))
+	return normalizeResultScores(toSearchResults(points), q.similarity), nil
+}
+
+// ensureDimensionCollection 确保维度集合存在，每个维度一个命名向量
+func (q *QdrantStore) ensureDimensionCollection() error {
+	name := q.dimensionCollection()
+	exists, err := q.CollectionExists(name)
+	if err != nil || exists {
+		return err
+	}
+
+	log.Printf("[Qdrant存储] 创建维度集合: %s, 维度=%d", name, q.config.Dimension)
+	if q.config.Dimension <= 0 {
+		return fmt.Errorf("无效的向量维度: %d", q.config.Dimension)
+	}
+
+	vectors := make(map[string]interface{}, len(qdrantDimensionFields))
+	for _, field := range qdrantDimensionFields {
+		vectors[field] = map[string]interface{}{
+			"size":     q.config.Dimension,
+			"distance": qdrantDistance(q.config.Metric),
+		}
+	}
+	if _, err := q.doRequest(context.Background(), http.MethodPut, q.collectionPath(name), map[string]interface{}{"vectors": vectors}, nil); err != nil {
+		return fmt.Errorf("创建维度集合失败: %w", err)
+	}
+
+	q.createPayloadIndexes(name)
+	return nil
+}
+
+// upsertDimensionPoint 写入记录的维度向量，只写入已生成的维度
+func (q *QdrantStore) upsertDimensionPoint(storageID string, data *models.MultiVectorData, payload map[string]interface{}) error {
+	vectors := make(map[string][]float32)
+	dimensionPayload := make(map[string]interface{}, len(payload)+len(qdrantDimensionFields))
+	for key, value := range payload {
+		dimensionPayload[key] = value
+	}
+
+	for field, dimension := range map[string]struct {
+		vector []float32
+		weight float64
+	}{
+		models.VectorFieldCoreIntent:    {data.CoreIntentVector, data.CoreIntentWeight},
+		models.VectorFieldDomainContext: {data.DomainContextVector, data.DomainContextWeight},
+		models.VectorFieldScenario:      {data.ScenarioVector, data.ScenarioWeight},
+	} {
+		if len(dimension.vector) == 0 {
+			continue
+		}
+		vectors[field] = dimension.vector
+		dimensionPayload[field+"_weight"] = dimension.weight
+	}
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	if err := q.upsertPoint(q.dimensionCollection(), storageID, vectors, dimensionPayload); err != nil {
+		return fmt.Errorf("写入维度向量失败: %w", err)
+	}
+	return nil
+}
+
+// dimensionCollection 维度向量集合名称
+func (q *QdrantStore) dimensionCollection() string {
+	return q.config.Collection + "_dims"
+}
+
+// isQdrantDimensionField 是否为维度集合中的命名向量
+func isQdrantDimensionField(field string) bool {
+	for _, candidate := range qdrantDimensionFields {
+		if candidate == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,874 @@
+package vectorstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// QdrantConfig Qdrant向量存储配置
+type QdrantConfig struct {
+	URL                   string  // 如 http://localhost:6333
+	APIKey                string  // 自托管未开启鉴权时留空
+	Collection            string  // 记忆集合名称，用户信息存放在 <Collection>_users
+	Dimension             int     // 向量维度
+	Metric                string  // cosine、dot、euclid
+	SimilarityThreshold   float64 // 0-1相似度阈值（越大越严格，Euclid按1/(1+距离)换算），<=0表示不过滤
+	RequestTimeoutSeconds int
+	MultiVector           bool // 启用多维度向量，维度向量存放在 <Collection>_dims
+}
+
+// QdrantStore Qdrant向量存储实现
+// 业务ID（batchId或memoryId）映射为UUID作为点ID，原始ID保存在payload的id字段；
+// 其余字段与阿里云实现保持一致（userId、session_id、bizType等），现有过滤字符串可直接转换为payload过滤条件
+type QdrantStore struct {
+	config            *QdrantConfig
+	httpClient        *http.Client
+	embeddingProvider models.EmbeddingProvider
+}
+
+// NewQdrantStore 创建Qdrant向量存储
+func NewQdrantStore(config *QdrantConfig, embeddingProvider models.EmbeddingProvider) *QdrantStore {
+	timeout := time.Duration(config.RequestTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &QdrantStore{
+		config:            config,
+		httpClient:        &http.Client{Timeout: timeout},
+		embeddingProvider: embeddingProvider,
+	}
+}
+
+// =============================================================================
+// EmbeddingProvider 接口实现
+// =============================================================================
+
+// GenerateEmbedding 将文本转换为向量表示，委托给配置的嵌入服务
+func (q *QdrantStore) GenerateEmbedding(text string) ([]float32, error) {
+	if q.embeddingProvider == nil {
+		return nil, fmt.Errorf("Qdrant存储未配置嵌入服务")
+	}
+	return q.embeddingProvider.GenerateEmbedding(text)
+}
+
+// GetEmbeddingDimension 获取向量维度
+func (q *QdrantStore) GetEmbeddingDimension() int {
+	return q.config.Dimension
+}
+
+// =============================================================================
+// MemoryStorage 接口实现
+// =============================================================================
+
+// StoreMemory 存储记忆到向量数据库
+func (q *QdrantStore) StoreMemory(memory *models.Memory) error {
+	log.Printf("[Qdrant存储] 存储记忆: ID=%s, 会话=%s", memory.ID, memory.SessionID)
+	if len(memory.Vector) == 0 {
+		return fmt.Errorf("存储前必须先生成向量")
+	}
+
+	storageID, metadataStr := storageIDAndMetadata(memory.ID, memory.Metadata)
+	payload := map[string]interface{}{
+		"id":             storageID,
+		"session_id":     memory.SessionID,
+		"content":        memory.Content,
+		"timestamp":      memory.Timestamp,
+		"formatted_time": time.Unix(memory.Timestamp, 0).Format("2006-01-02 15:04:05"),
+		"priority":       memory.Priority,
+		"metadata":       metadataStr,
+		"memory_id":      memory.ID,
+		"bizType":        memory.BizType,
+		"userId":         memory.UserID,
+	}
+	payload[models.MetadataPayloadField] = structuredMetadata(memory.Metadata)
+
+	if err := q.upsertPoint(q.config.Collection, storageID, memory.Vector, payload); err != nil {
+		return err
+	}
+	if q.config.MultiVector && memory.MultiVectorData != nil {
+		return q.upsertDimensionPoint(storageID, memory.MultiVectorData, payload)
+	}
+	return nil
+}
+
+// StoreMessage 存储消息到向量数据库
+func (q *QdrantStore) StoreMessage(message *models.Message) error {
+	log.Printf("[Qdrant存储] 存储消息: ID=%s, 会话=%s", message.ID, message.SessionID)
+	if len(message.Vector) == 0 {
+		return fmt.Errorf("存储前必须先生成向量")
+	}
+
+	storageID, metadataStr := storageIDAndMetadata(message.ID, message.Metadata)
+	payload := map[string]interface{}{
+		"id":             storageID,
+		"session_id":     message.SessionID,
+		"role":           message.Role,
+		"content":        message.Content,
+		"content_type":   message.ContentType,
+		"timestamp":      message.Timestamp,
+		"formatted_time": time.Unix(message.Timestamp, 0).Format("2006-01-02 15:04:05"),
+		"priority":       message.Priority,
+		"metadata":       metadataStr,
+		"message_id":     message.ID,
+	}
+	payload[models.MetadataPayloadField] = structuredMetadata(message.Metadata)
+
+	return q.upsertPoint(q.config.Collection, storageID, message.Vector, payload)
+}
+
+// CountMemories 统计指定会话的记忆数量
+func (q *QdrantStore) CountMemories(sessionID string) (int, error) {
+	body := map[string]interface{}{
+		"filter": &qdrantFilter{Must: []qdrantCondition{newQdrantCondition("session_id", sessionID)}},
+		"exact":  true,
+	}
+
+	var result struct {
+		Count int `json:"count"`
+	}
+	if _, err := q.doRequest(context.Background(), http.MethodPost, q.collectionPath(q.config.Collection)+"/points/count", body, &result); err != nil {
+		return 0, fmt.Errorf("统计会话记忆失败: %w", err)
+	}
+	return result.Count, nil
+}
+
+// StoreEnhancedMemory 存储增强的多维度记忆，多维度分析结果作为附加payload字段保存
+func (q *QdrantStore) StoreEnhancedMemory(memory *models.EnhancedMemory) error {
+	if memory.Memory == nil {
+		return fmt.Errorf("增强记忆缺少基础记忆")
+	}
+	log.Printf("[Qdrant存储] 存储增强记忆: ID=%s, 会话=%s", memory.Memory.ID, memory.Memory.SessionID)
+	if len(memory.Memory.Vector) == 0 {
+		return fmt.Errorf("存储前必须先生成基础向量")
+	}
+
+	storageID, metadataStr := storageIDAndMetadata(memory.Memory.ID, memory.Memory.Metadata)
+	payload := map[string]interface{}{
+		"id":               storageID,
+		"session_id":       memory.Memory.SessionID,
+		"content":          memory.Memory.Content,
+		"timestamp":        memory.Memory.Timestamp,
+		"formatted_time":   time.Unix(memory.Memory.Timestamp, 0).Format("2006-01-02 15:04:05"),
+		"priority":         memory.Memory.Priority,
+		"metadata":         metadataStr,
+		"memory_id":        memory.Memory.ID,
+		"bizType":          memory.Memory.BizType,
+		"userId":           memory.Memory.UserID,
+		"semantic_tags":    memory.SemanticTags,
+		"concept_entities": memory.ConceptEntities,
+		"related_concepts": memory.RelatedConcepts,
+		"importance_score": memory.ImportanceScore,
+		"relevance_score":  memory.RelevanceScore,
+		"context_summary":  memory.ContextSummary,
+		"tech_stack":       memory.TechStack,
+		"project_context":  memory.ProjectContext,
+		"event_type":       memory.EventType,
+	}
+	payload[models.MetadataPayloadField] = structuredMetadata(memory.Memory.Metadata)
+
+	return q.upsertPoint(q.config.Collection, storageID, memory.Memory.Vector, payload)
+}
+
+// StoreEnhancedMessage 存储增强的多维度消息，多维度分析结果作为附加payload字段保存
+func (q *QdrantStore) StoreEnhancedMessage(message *models.EnhancedMessage) error {
+	if message.Message == nil {
+		return fmt.Errorf("增强消息缺少基础消息")
+	}
+	log.Printf("[Qdrant存储] 存储增强消息: ID=%s, 会话=%s", message.Message.ID, message.Message.SessionID)
+	if len(message.Message.Vector) == 0 {
+		return fmt.Errorf("存储前必须先生成基础向量")
+	}
+
+	storageID, metadataStr := storageIDAndMetadata(message.Message.ID, message.Message.Metadata)
+	payload := map[string]interface{}{
+		"id":               storageID,
+		"session_id":       message.Message.SessionID,
+		"role":             message.Message.Role,
+		"content":          message.Message.Content,
+		"content_type":     message.Message.ContentType,
+		"timestamp":        message.Message.Timestamp,
+		"formatted_time":   time.Unix(message.Message.Timestamp, 0).Format("2006-01-02 15:04:05"),
+		"priority":         message.Message.Priority,
+		"metadata":         metadataStr,
+		"message_id":       message.Message.ID,
+		"semantic_tags":    message.SemanticTags,
+		"concept_entities": message.ConceptEntities,
+		"related_concepts": message.RelatedConcepts,
+		"importance_score": message.ImportanceScore,
+		"relevance_score":  message.RelevanceScore,
+		"context_summary":  message.ContextSummary,
+		"tech_stack":       message.TechStack,
+		"project_context":  message.ProjectContext,
+		"event_type":       message.EventType,
+	}
+	payload[models.MetadataPayloadField] = structuredMetadata(message.Message.Metadata)
+
+	return q.upsertPoint(q.config.Collection, storageID, message.Message.Vector, payload)
+}
+
+// DeleteMemories 根据主键ID批量删除记忆
+func (q *QdrantStore) DeleteMemories(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	log.Printf("[Qdrant存储] 删除记忆: 数量=%d", len(ids))
+
+	pointIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		pointIDs = append(pointIDs, qdrantPointID(id))
+	}
+
+	body := map[string]interface{}{"points": pointIDs}
+	if _, err := q.doRequest(ctx, http.MethodPost, q.collectionPath(q.config.Collection)+"/points/delete?wait=true", body, nil); err != nil {
+		return fmt.Errorf("删除记忆失败: %w", err)
+	}
+	if q.config.MultiVector {
+		if _, err := q.doRequest(ctx, http.MethodPost, q.collectionPath(q.dimensionCollection())+"/points/delete?wait=true", body, nil); err != nil {
+			log.Printf("[Qdrant存储] 警告: 删除维度向量失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// =============================================================================
+// VectorSearcher 接口实现
+// =============================================================================
+
+// SearchByVector 使用向量进行相似度搜索
+func (q *QdrantStore) SearchByVector(ctx context.Context, vector []float32, options *models.SearchOptions) ([]models.SearchResult, error) {
+	if options == nil {
+		options = &models.SearchOptions{}
+	}
+	log.Printf("[Qdrant存储] 向量搜索: 维度=%d, 限制=%d", len(vector), options.Limit)
+
+	filter, err := buildQdrantFilter("", options)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"vector":       vector,
+		"limit":        qdrantLimit(options.Limit),
+		"with_payload": true,
+	}
+	if filter != nil {
+		body["filter"] = filter
+	}
+	if !options.SkipThreshold {
+		threshold := q.config.SimilarityThreshold
+		if options.Threshold > 0 {
+			threshold = options.Threshold
+		}
+		if threshold > 0 {
+			body["score_threshold"] = q.scoreThreshold(threshold)
+		}
+	}
+
+	var points []qdrantPoint
+	if _, err := q.doRequest(ctx, http.MethodPost, q.collectionPath(q.config.Collection)+"/points/search", body, &points); err != nil {
+		return nil, fmt.Errorf("向量搜索失败: %w", err)
+	}
+
+	log.Printf("[Qdrant存储] 向量搜索完成: 结果数=%d", len(points))
+	return normalizeResultScores(toSearchResults(points), q.similarity), nil
+}
+
+// SearchByText 使用文本进行搜索（内部转换为向量）
+func (q *QdrantStore) SearchByText(ctx context.Context, query string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	vector, err := q.GenerateEmbedding(query)
+	if err != nil {
+		return nil, fmt.Errorf("生成查询向量失败: %w", err)
+	}
+	return q.SearchByVector(ctx, vector, options)
+}
+
+// SearchByID 根据ID精确搜索（ID为存储时使用的batchId或memoryId）
+func (q *QdrantStore) SearchByID(ctx context.Context, id string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	log.Printf("[Qdrant存储] ID搜索: ID='%s'", id)
+
+	body := map[string]interface{}{
+		"ids":          []string{qdrantPointID(id)},
+		"with_payload": true,
+	}
+
+	var points []qdrantPoint
+	if _, err := q.doRequest(ctx, http.MethodPost, q.collectionPath(q.config.Collection)+"/points", body, &points); err != nil {
+		return nil, fmt.Errorf("ID搜索失败: %w", err)
+	}
+	return toSearchResults(points), nil
+}
+
+// SearchByFilter 根据过滤条件搜索，支持 key="value" AND key=123 形式的过滤字符串
+func (q *QdrantStore) SearchByFilter(ctx context.Context, filter string, options *models.SearchOptions) ([]models.SearchResult, error) {
+	if options == nil {
+		options = &models.SearchOptions{}
+	}
+	log.Printf("[Qdrant存储] 过滤搜索: 过滤条件='%s', 限制=%d", filter, options.Limit)
+
+	qFilter, err := buildQdrantFilter(filter, options)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"limit":        qdrantLimit(options.Limit),
+		"with_payload": true,
+	}
+	if qFilter != nil {
+		body["filter"] = qFilter
+	}
+
+	var result struct {
+		Points []qdrantPoint `json:"points"`
+	}
+	if _, err := q.doRequest(ctx, http.MethodPost, q.collectionPath(q.config.Collection)+"/points/scroll", body, &result); err != nil {
+		return nil, fmt.Errorf("过滤搜索失败: %w", err)
+	}
+	return toSearchResults(result.Points), nil
+}
+
+// =============================================================================
+// CollectionManager 接口实现
+// =============================================================================
+
+// EnsureCollection 确保集合存在，不存在则创建并建立常用过滤字段的payload索引
+func (q *QdrantStore) EnsureCollection(collectionName string) error {
+	if collectionName == "" {
+		collectionName = q.config.Collection
+	}
+	log.Printf("[Qdrant存储] 确保集合存在: %s", collectionName)
+
+	exists, err := q.CollectionExists(collectionName)
+	if err != nil {
+		return err
+	}
+	if q.config.MultiVector && collectionName == q.config.Collection {
+		if err := q.ensureDimensionCollection(); err != nil {
+			return err
+		}
+	}
+	if exists {
+		return nil
+	}
+
+	if err := q.CreateCollection(collectionName, &models.CollectionConfig{
+		Dimension: q.config.Dimension,
+		Metric:    q.config.Metric,
+	}); err != nil {
+		return err
+	}
+
+	q.createPayloadIndexes(collectionName)
+	return nil
+}
+
+// createPayloadIndexes 为现有过滤条件使用的字段建立索引
+func (q *QdrantStore) createPayloadIndexes(collectionName string) {
+	indexes := map[string]string{
+		"userId":     "keyword",
+		"session_id": "keyword",
+		"id":         "keyword",
+		"bizType":    "integer",
+	}
+	for field, schema := range indexes {
+		body := map[string]interface{}{"field_name": field, "field_schema": schema}
+		if _, err := q.doRequest(context.Background(), http.MethodPut, q.collectionPath(collectionName)+"/index?wait=true", body, nil); err != nil {
+			log.Printf("[Qdrant存储] 警告: 创建payload索引失败: 字段=%s, 错误=%v", field, err)
+		}
+	}
+}
+
+// CreateCollection 创建新集合
+func (q *QdrantStore) CreateCollection(name string, config *models.CollectionConfig) error {
+	log.Printf("[Qdrant存储] 创建集合: %s, 维度=%d, 度量=%s", name, config.Dimension, config.Metric)
+	if config.Dimension <= 0 {
+		return fmt.Errorf("无效的向量维度: %d", config.Dimension)
+	}
+
+	body := map[string]interface{}{
+		"vectors": map[string]interface{}{
+			"size":     config.Dimension,
+			"distance": qdrantDistance(config.Metric),
+		},
+	}
+	if _, err := q.doRequest(context.Background(), http.MethodPut, q.collectionPath(name), body, nil); err != nil {
+		return fmt.Errorf("创建集合失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteCollection 删除集合
+func (q *QdrantStore) DeleteCollection(name string) error {
+	log.Printf("[Qdrant存储] 删除集合: %s", name)
+	if _, err := q.doRequest(context.Background(), http.MethodDelete, q.collectionPath(name), nil, nil); err != nil {
+		return fmt.Errorf("删除集合失败: %w", err)
+	}
+	return nil
+}
+
+// CollectionExists 检查集合是否存在
+func (q *QdrantStore) CollectionExists(name string) (bool, error) {
+	statusCode, err := q.doRequest(context.Background(), http.MethodGet, q.collectionPath(name), nil, nil)
+	if statusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("检查集合失败: %w", err)
+	}
+	return true, nil
+}
+
+// =============================================================================
+// UserDataStorage 接口实现
+// =============================================================================
+
+// StoreUserInfo 存储用户信息（用户集合只使用payload，向量为1维占位）
+func (q *QdrantStore) StoreUserInfo(userInfo *models.UserInfo) error {
+	log.Printf("[Qdrant存储] 存储用户信息: 用户ID=%s", userInfo.UserID)
+
+	metadataStr := "{}"
+	if userInfo.Metadata != nil {
+		if metadataBytes, err := json.Marshal(userInfo.Metadata); err == nil {
+			metadataStr = string(metadataBytes)
+		}
+	}
+
+	payload := map[string]interface{}{
+		"id":         userInfo.UserID,
+		"userId":     userInfo.UserID,
+		"firstUsed":  userInfo.FirstUsed,
+		"lastActive": userInfo.LastActive,
+		"deviceInfo": userInfo.DeviceInfo,
+		"metadata":   metadataStr,
+		"createdAt":  userInfo.CreatedAt,
+		"updatedAt":  userInfo.UpdatedAt,
+	}
+	return q.upsertPoint(q.userCollection(), userInfo.UserID, []float32{1}, payload)
+}
+
+// GetUserInfo 获取用户信息，用户不存在时返回nil
+func (q *QdrantStore) GetUserInfo(userID string) (*models.UserInfo, error) {
+	body := map[string]interface{}{
+		"ids":          []string{qdrantPointID(userID)},
+		"with_payload": true,
+	}
+
+	var points []qdrantPoint
+	if _, err := q.doRequest(context.Background(), http.MethodPost, q.collectionPath(q.userCollection())+"/points", body, &points); err != nil {
+		return nil, fmt.Errorf("获取用户信息失败: %w", err)
+	}
+	if len(points) == 0 {
+		return nil, nil
+	}
+
+	payload := points[0].Payload
+	userInfo := &models.UserInfo{UserID: userID}
+	userInfo.FirstUsed, _ = payload["firstUsed"].(string)
+	userInfo.LastActive, _ = payload["lastActive"].(string)
+	userInfo.CreatedAt, _ = payload["createdAt"].(string)
+	userInfo.UpdatedAt, _ = payload["updatedAt"].(string)
+	userInfo.DeviceInfo, _ = payload["deviceInfo"].(map[string]interface{})
+	if metadataStr, ok := payload["metadata"].(string); ok && metadataStr != "" {
+		json.Unmarshal([]byte(metadataStr), &userInfo.Metadata)
+	}
+	return userInfo, nil
+}
+
+// CheckUserExists 检查用户是否存在
+func (q *QdrantStore) CheckUserExists(userID string) (bool, error) {
+	userInfo, err := q.GetUserInfo(userID)
+	if err != nil {
+		return false, err
+	}
+	return userInfo != nil, nil
+}
+
+// InitUserStorage 初始化用户存储
+func (q *QdrantStore) InitUserStorage() error {
+	name := q.userCollection()
+	exists, err := q.CollectionExists(name)
+	if err != nil || exists {
+		return err
+	}
+	return q.CreateCollection(name, &models.CollectionConfig{Dimension: 1, Metric: "dot"})
+}
+
+// GetProvider 获取提供商类型
+func (q *QdrantStore) GetProvider() models.VectorStoreType {
+	return models.VectorStoreTypeQdrant
+}
+
+// =============================================================================
+// 内部辅助方法
+// =============================================================================
+
+// qdrantPoint Qdrant返回的点
+type qdrantPoint struct {
+	ID      interface{}            `json:"id"`
+	Score   float64                `json:"score"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// qdrantFilter Qdrant payload过滤条件
+type qdrantFilter struct {
+	Must    []qdrantCondition `json:"must,omitempty"`
+	MustNot []qdrantCondition `json:"must_not,omitempty"`
+}
+
+// qdrantCondition 单个字段匹配条件，Must/Should不为空时为嵌套过滤条件（用于结构化过滤中的AND/OR组合）
+type qdrantCondition struct {
+	Key    string                 `json:"key,omitempty"`
+	Match  map[string]interface{} `json:"match,omitempty"`
+	Range  map[string]interface{} `json:"range,omitempty"`
+	Must   []qdrantCondition      `json:"must,omitempty"`
+	Should []qdrantCondition      `json:"should,omitempty"`
+}
+
+func newQdrantCondition(key string, value interface{}) qdrantCondition {
+	return qdrantCondition{Key: key, Match: map[string]interface{}{"value": value}}
+}
+
+// qdrantFilterClause 匹配 key="value"、key='value'、key=123 以及 != 形式的条件
+var qdrantFilterClause = regexp.MustCompile(`^([A-Za-z_][\w.]*)\s*(!=|=)\s*(.+)$`)
+
+// qdrantFilterAnd 条件之间的AND分隔符（不区分大小写）
+var qdrantFilterAnd = regexp.MustCompile(`(?i)\s+AND\s+`)
+
+// qdrantFilterUnescaper 还原带引号值中转义的反斜杠和引号
+var qdrantFilterUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\'`, `'`)
+
+// splitFilterClauses 按AND拆分过滤字符串，忽略引号内（含转义引号）的AND
+func splitFilterClauses(filter string) []string {
+	inQuote := make([]bool, len(filter))
+	var quote byte
+	for i := 0; i < len(filter); i++ {
+		c := filter[i]
+		switch {
+		case quote == 0:
+			if c == '"' || c == '\'' {
+				quote = c
+			}
+		case c == '\\' && i+1 < len(filter):
+			inQuote[i] = true
+			i++
+		case c == quote:
+			quote = 0
+		}
+		if quote != 0 && i < len(filter) {
+			inQuote[i] = true
+		}
+	}
+
+	var clauses []string
+	start := 0
+	for _, loc := range qdrantFilterAnd.FindAllStringIndex(filter, -1) {
+		if inQuote[loc[0]] {
+			continue
+		}
+		clauses = append(clauses, filter[start:loc[0]])
+		start = loc[1]
+	}
+	return append(clauses, filter[start:])
+}
+
+// parseQdrantFilter 将现有过滤字符串（如 userId="xxx" AND bizType=3）转换为Qdrant过滤条件
+// 阿里云风格的 fields.session_id 前缀会被去掉；带引号的值按字符串匹配，否则依次尝试整数、布尔
+func parseQdrantFilter(filter string) (*qdrantFilter, error) {
+	result := &qdrantFilter{}
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return result, nil
+	}
+
+	for _, clause := range splitFilterClauses(filter) {
+		matches := qdrantFilterClause.FindStringSubmatch(strings.TrimSpace(clause))
+		if matches == nil {
+			return nil, fmt.Errorf("不支持的过滤条件: %s", clause)
+		}
+
+		key := strings.TrimPrefix(matches[1], "fields.")
+		condition := newQdrantCondition(key, parseQdrantFilterValue(strings.TrimSpace(matches[3])))
+		if matches[2] == "!=" {
+			result.MustNot = append(result.MustNot, condition)
+		} else {
+			result.Must = append(result.Must, condition)
+		}
+	}
+	return result, nil
+}
+
+// parseQdrantFilterValue 解析过滤条件中的值
+func parseQdrantFilterValue(raw string) interface{} {
+	if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') && raw[len(raw)-1] == raw[0] {
+		return qdrantFilterUnescaper.Replace(raw[1 : len(raw)-1])
+	}
+	if intValue, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return intValue
+	}
+	if boolValue, err := strconv.ParseBool(raw); err == nil {
+		return boolValue
+	}
+	return raw
+}
+
+// buildQdrantFilter 合并过滤字符串和搜索选项中的会话、用户及额外过滤条件，无条件时返回nil
+func buildQdrantFilter(filter string, options *models.SearchOptions) (*qdrantFilter, error) {
+	result, err := parseQdrantFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.SessionID != "" {
+		result.Must = append(result.Must, newQdrantCondition("session_id", options.SessionID))
+	}
+	if options.UserID != "" {
+		result.Must = append(result.Must, newQdrantCondition("userId", options.UserID))
+	}
+	for key, value := range options.ExtraFilters {
+		result.Must = append(result.Must, newQdrantCondition(key, value))
+	}
+	if options.StartTime > 0 || options.EndTime > 0 {
+		timeRange := make(map[string]interface{})
+		if options.StartTime > 0 {
+			timeRange["gte"] = options.StartTime
+		}
+		if options.EndTime > 0 {
+			timeRange["lte"] = options.EndTime
+		}
+		result.Must = append(result.Must, qdrantCondition{Key: "timestamp", Range: timeRange})
+	}
+	if options.Filter != nil && !options.Filter.IsEmpty() {
+		condition, err := compileQdrantCondition(*options.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("编译过滤条件失败: %w", err)
+		}
+		result.Must = append(result.Must, condition)
+	}
+
+	if len(result.Must) == 0 && len(result.MustNot) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// compileQdrantCondition 将结构化过滤条件编译为Qdrant条件，AND/OR编译为嵌套的must/should过滤
+func compileQdrantCondition(filter models.Filter) (qdrantCondition, error) {
+	switch filter.Op {
+	case models.FilterOpEq:
+		if err := checkFilterField(filter.Field); err != nil {
+			return qdrantCondition{}, err
+		}
+		switch filter.Value.(type) {
+		case string, int, int32, int64, bool:
+		default:
+			return qdrantCondition{}, fmt.Errorf("字段%s: 不支持的过滤值类型: %T", filter.Field, filter.Value)
+		}
+		return newQdrantCondition(filter.Field, filter.Value), nil
+	case models.FilterOpRange:
+		if err := checkFilterField(filter.Field); err != nil {
+			return qdrantCondition{}, err
+		}
+		valueRange := make(map[string]interface{})
+		if filter.Min > 0 {
+			valueRange["gte"] = filter.Min
+		}
+		if filter.Max > 0 {
+			valueRange["lte"] = filter.Max
+		}
+		return qdrantCondition{Key: filter.Field, Range: valueRange}, nil
+	case models.FilterOpAnd, models.FilterOpOr:
+		children := make([]qdrantCondition, 0, len(filter.Children))
+		for _, child := range filter.Children {
+			condition, err := compileQdrantCondition(child)
+			if err != nil {
+				return qdrantCondition{}, err
+			}
+			children = append(children, condition)
+		}
+		if filter.Op == models.FilterOpOr {
+			return qdrantCondition{Should: children}, nil
+		}
+		return qdrantCondition{Must: children}, nil
+	default:
+		return qdrantCondition{}, fmt.Errorf("不支持的过滤条件类型: %s", filter.Op)
+	}
+}
+
+// qdrantPointID 将业务ID映射为确定性的UUID，Qdrant只接受无符号整数或UUID作为点ID
+func qdrantPointID(id string) string {
+	sum := md5.Sum([]byte(id))
+	sum[6] = (sum[6] & 0x0f) | 0x30 // version 3
+	sum[8] = (sum[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// qdrantDistance 将度量名称转换为Qdrant的distance取值
+func qdrantDistance(metric string) string {
+	switch strings.ToLower(metric) {
+	case "dot", "inner_product", "dotproduct":
+		return "Dot"
+	case "euclid", "euclidean", "l2":
+		return "Euclid"
+	default:
+		return "Cosine"
+	}
+}
+
+// similarity 将Qdrant的得分转换为0-1相似度：Euclid返回距离，Cosine和Dot返回相似度
+func (q *QdrantStore) similarity(score float64) float64 {
+	if qdrantDistance(q.config.Metric) == "Euclid" {
+		return SimilarityFromDistance(MetricEuclidean, score)
+	}
+	return clampSimilarity(score)
+}
+
+// scoreThreshold 将0-1相似度阈值转换为Qdrant的score_threshold，Euclid时为距离上限
+func (q *QdrantStore) scoreThreshold(similarity float64) float64 {
+	if qdrantDistance(q.config.Metric) == "Euclid" {
+		return DistanceThreshold(MetricEuclidean, similarity)
+	}
+	return similarity
+}
+
+// qdrantLimit 搜索条数默认值
+func qdrantLimit(limit int) int {
+	if limit <= 0 {
+		return 10
+	}
+	return limit
+}
+
+// structuredMetadata 以结构化对象保存的metadata，供按metadata键的服务端过滤使用；metadata为空时为空对象
+func structuredMetadata(metadata map[string]interface{}) map[string]interface{} {
+	if metadata == nil {
+		return map[string]interface{}{}
+	}
+	return metadata
+}
+
+// SupportsStructuredMetadata payload中以结构化对象保存了metadata，可按 metadata_fields.<键> 过滤
+func (q *QdrantStore) SupportsStructuredMetadata() bool {
+	return true
+}
+
+// storageIDAndMetadata 获取存储ID（元数据中有batchId时使用batchId，与阿里云实现一致）和JSON字符串形式的元数据
+func storageIDAndMetadata(id string, metadata map[string]interface{}) (string, string) {
+	storageID := id
+	metadataStr := "{}"
+	if metadata != nil {
+		if batchID, ok := metadata["batchId"].(string); ok && batchID != "" {
+			storageID = batchID
+		}
+		if metadataBytes, err := json.Marshal(metadata); err == nil {
+			metadataStr = string(metadataBytes)
+		} else {
+			log.Printf("[Qdrant存储] 警告: 无法序列化元数据: %v", err)
+		}
+	}
+	return storageID, metadataStr
+}
+
+// toSearchResults 将Qdrant点转换为搜索结果，结果ID使用payload中的原始业务ID
+func toSearchResults(points []qdrantPoint) []models.SearchResult {
+	results := make([]models.SearchResult, 0, len(points))
+	for _, point := range points {
+		id, _ := point.Payload["id"].(string)
+		if id == "" {
+			id = fmt.Sprint(point.ID)
+		}
+		results = append(results, models.SearchResult{
+			ID:     id,
+			Score:  point.Score,
+			Fields: point.Payload,
+		})
+	}
+	return results
+}
+
+// collectionPath 集合API路径
+func (q *QdrantStore) collectionPath(name string) string {
+	return "/collections/" + name
+}
+
+// userCollection 用户信息集合名称
+func (q *QdrantStore) userCollection() string {
+	return q.config.Collection + "_users"
+}
+
+// upsertPoint 写入单个点，vector为单个向量或按名称组织的多个向量
+func (q *QdrantStore) upsertPoint(collection, id string, vector interface{}, payload map[string]interface{}) error {
+	body := map[string]interface{}{
+		"points": []map[string]interface{}{
+			{
+				"id":      qdrantPointID(id),
+				"vector":  vector,
+				"payload": payload,
+			},
+		},
+	}
+	if _, err := q.doRequest(context.Background(), http.MethodPut, q.collectionPath(collection)+"/points?wait=true", body, nil); err != nil {
+		return fmt.Errorf("写入向量失败: %w", err)
+	}
+	return nil
+}
+
+// doRequest 发送请求并将响应的result字段解析到out（out为nil时忽略），返回HTTP状态码
+func (q *QdrantStore) doRequest(ctx context.Context, method, path string, body interface{}, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("序列化请求失败: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(q.config.URL, "/")+path, reader)
+	if err != nil {
+		return 0, fmt.Errorf("创建HTTP请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if q.config.APIKey != "" {
+		req.Header.Set("api-key", q.config.APIKey)
+	}
+
+	resp, err := q.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("API请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	if out != nil {
+		var envelope struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(respBody, &envelope); err != nil {
+			return resp.StatusCode, fmt.Errorf("解析响应失败: %w", err)
+		}
+		if err := json.Unmarshal(envelope.Result, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("解析响应结果失败: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,128 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// TestParseQdrantFilter 测试现有过滤字符串转换为Qdrant payload过滤条件
+func TestParseQdrantFilter(t *testing.T) {
+	filter, err := parseQdrantFilter(`bizType=3 AND userId="user_1" and fields.session_id='s1' AND role!="assistant"`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+
+	want := &qdrantFilter{
+		Must: []qdrantCondition{
+			newQdrantCondition("bizType", int64(3)),
+			newQdrantCondition("userId", "user_1"),
+			newQdrantCondition("session_id", "s1"),
+		},
+		MustNot: []qdrantCondition{newQdrantCondition("role", "assistant")},
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("过滤条件错误: %+v", filter)
+	}
+
+	if _, err := parseQdrantFilter(`userId IN ("a")`); err == nil {
+		t.Error("期望不支持的过滤条件返回错误")
+	}
+}
+
+// TestQdrantStoreSearchByFilter 测试过滤搜索请求体及结果ID映射
+func TestQdrantStoreSearchByFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/collections/memories/points/scroll" {
+			t.Errorf("请求路径错误: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("api-key"); got != "test-key" {
+			t.Errorf("api-key请求头错误: %s", got)
+		}
+
+		var body struct {
+			Filter qdrantFilter `json:"filter"`
+			Limit  int          `json:"limit"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Limit != 5 || len(body.Filter.Must) != 2 || body.Filter.Must[1].Key != "userId" {
+			t.Errorf("请求体错误: %+v", body)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": map[string]interface{}{
+				"points": []map[string]interface{}{
+					{"id": qdrantPointID("batch_1"), "payload": map[string]interface{}{"id": "batch_1", "content": "hello"}},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	store := NewQdrantStore(&QdrantConfig{URL: server.URL, APIKey: "test-key", Collection: "memories", Dimension: 4}, nil)
+	results, err := store.SearchByFilter(context.Background(), `session_id="s1"`, &models.SearchOptions{Limit: 5, UserID: "user_1"})
+	if err != nil {
+		t.Fatalf("过滤搜索失败: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "batch_1" || results[0].Fields["content"] != "hello" {
+		t.Errorf("搜索结果错误: %+v", results)
+	}
+}
+
+// TestQdrantPointID 测试点ID是确定性的UUID
+func TestQdrantPointID(t *testing.T) {
+	id := qdrantPointID("memory_1")
+	if id != qdrantPointID("memory_1") || id == qdrantPointID("memory_2") {
+		t.Errorf("点ID应当确定且唯一: %s", id)
+	}
+	if len(id) != 36 || id[14] != '3' {
+		t.Errorf("点ID格式错误: %s", id)
+	}
+}
+
+// TestQdrantStoreSearchByVectorField 测试维度向量搜索使用维度集合中的命名向量
+func TestQdrantStoreSearchByVectorField(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/collections/memories_dims/points/search" {
+			t.Errorf("请求路径错误: %s", r.URL.Path)
+		}
+
+		var body struct {
+			Vector struct {
+				Name string `json:"name"`
+			} `json:"vector"`
+			ScoreThreshold *float64 `json:"score_threshold"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Vector.Name != models.VectorFieldDomainContext || body.ScoreThreshold != nil {
+			t.Errorf("请求体错误: %+v", body)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result": []map[string]interface{}{
+				{"id": qdrantPointID("memory_1"), "score": 0.8, "payload": map[string]interface{}{"id": "memory_1", "domain_context_weight": 0.3}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	store := NewQdrantStore(&QdrantConfig{URL: server.URL, Collection: "memories", Dimension: 4, SimilarityThreshold: 0.5}, nil)
+	if _, err := store.SearchByVectorField(context.Background(), models.VectorFieldDomainContext, []float32{1, 0, 0, 0}, nil); err == nil {
+		t.Error("期望未启用多维度向量时返回错误")
+	}
+
+	store.config.MultiVector = true
+	results, err := store.SearchByVectorField(context.Background(), models.VectorFieldDomainContext, []float32{1, 0, 0, 0},
+		&models.SearchOptions{Limit: 5, SkipThreshold: true})
+	if err != nil {
+		t.Fatalf("维度向量搜索失败: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "memory_1" || results[0].Fields["domain_context_weight"] != 0.3 {
+		t.Errorf("搜索结果错误: %+v", results)
+	}
+}
@@ -0,0 +1,74 @@
+package vectorstore
+
+import (
+	"math"
+	"strings"
+
+	"github.com/contextkeeper/service/internal/models"
+)
+
+// =============================================================================
+// 得分归一化：各向量存储返回的得分统一为0-1的相似度（越大越相似）
+// 阿里云DashVector的cosine返回余弦距离，euclidean返回欧氏距离；Qdrant的Euclid返回距离；
+// 内积和Qdrant的Cosine/Dot返回相似度。调用方只处理归一化后的相似度，阈值也使用相似度
+// =============================================================================
+
+// 归一化后的相似度度量
+const (
+	MetricCosine     = "cosine"
+	MetricEuclidean  = "euclidean"
+	MetricDotProduct = "dotproduct"
+)
+
+// NormalizeMetric 将各存储的度量名称统一为cosine、euclidean或dotproduct，未知名称按cosine处理
+func NormalizeMetric(metric string) string {
+	switch strings.ToLower(strings.TrimSpace(metric)) {
+	case "euclid", "euclidean", "l2":
+		return MetricEuclidean
+	case "dot", "dotproduct", "dot_product", "inner_product", "innerproduct", "ip":
+		return MetricDotProduct
+	default:
+		return MetricCosine
+	}
+}
+
+// SimilarityFromDistance 将返回距离的存储得分转换为0-1相似度
+// cosine: 1-距离；euclidean: 1/(1+距离)；dotproduct返回的是内积，本身即为相似度
+func SimilarityFromDistance(metric string, distance float64) float64 {
+	switch NormalizeMetric(metric) {
+	case MetricEuclidean:
+		return clampSimilarity(1 / (1 + math.Max(0, distance)))
+	case MetricDotProduct:
+		return clampSimilarity(distance)
+	default:
+		return clampSimilarity(1 - distance)
+	}
+}
+
+// DistanceThreshold 将0-1相似度阈值转换为以距离过滤的存储使用的距离阈值（SimilarityFromDistance的逆运算）
+func DistanceThreshold(metric string, similarity float64) float64 {
+	switch NormalizeMetric(metric) {
+	case MetricEuclidean:
+		if similarity <= 0 {
+			return math.MaxFloat64
+		}
+		return 1/similarity - 1
+	case MetricDotProduct:
+		return similarity
+	default:
+		return 1 - similarity
+	}
+}
+
+// clampSimilarity 将相似度截断到[0, 1]，负相关按0处理
+func clampSimilarity(similarity float64) float64 {
+	return math.Max(0, math.Min(1, similarity))
+}
+
+// normalizeResultScores 用转换函数原地归一化结果得分
+func normalizeResultScores(results []models.SearchResult, normalize func(float64) float64) []models.SearchResult {
+	for i := range results {
+		results[i].Score = normalize(results[i].Score)
+	}
+	return results
+}
@@ -0,0 +1,80 @@
+package vectorstore
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/contextkeeper/service/internal/models"
+	"github.com/contextkeeper/service/pkg/aliyun"
+)
+
+// TestPerfectMatchSimilarity 测试完全匹配的向量在各度量和各存储下得分均约为1.0，相似度阈值按度量换算
+func TestPerfectMatchSimilarity(t *testing.T) {
+	for metric, perfect := range map[string]float64{"cosine": 0, "euclidean": 0, "l2": 0, "dotproduct": 1, "inner_product": 1} {
+		if got := SimilarityFromDistance(metric, perfect); math.Abs(got-1) > 1e-9 {
+			t.Errorf("%s 完全匹配的相似度应为1，实际%.4f", metric, got)
+		}
+		if got := SimilarityFromDistance(metric, DistanceThreshold(metric, 0.8)); math.Abs(got-0.8) > 1e-9 {
+			t.Errorf("%s 阈值换算后应还原为0.8，实际%.4f", metric, got)
+		}
+	}
+	if got := SimilarityFromDistance("cosine", 1.6); got != 0 {
+		t.Errorf("反向向量的相似度应截断为0，实际%.4f", got)
+	}
+
+	ctx := context.Background()
+	memoryStore := NewInMemoryVectorStore(64, 0)
+	storeTestMemory(t, memoryStore, "m1", "s1", "user_a", "修复登录超时 bug")
+	vector, _ := memoryStore.GenerateEmbedding("修复登录超时 bug")
+	results, err := memoryStore.SearchByVector(ctx, vector, &models.SearchOptions{Limit: 1})
+	if err != nil || len(results) != 1 || math.Abs(results[0].Score-1) > 1e-6 {
+		t.Errorf("内存存储完全匹配得分应约为1: %+v, %v", results, err)
+	}
+
+	// 阿里云返回余弦距离，0为完全匹配；0.9的相似度阈值对应0.1的距离阈值
+	dashVector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"code": 0,
+			"output": []map[string]interface{}{
+				{"id": "exact", "score": 0.0, "fields": map[string]interface{}{"content": "a"}},
+				{"id": "far", "score": 0.5, "fields": map[string]interface{}{"content": "b"}},
+			},
+		})
+	}))
+	defer dashVector.Close()
+	aliyunStore := NewAliyunVectorStore(aliyun.NewVectorService("", "", dashVector.URL, "", "memories", 4, "cosine", 0.3), nil)
+	results, err = aliyunStore.SearchByVector(ctx, []float32{1, 0, 0, 0}, &models.SearchOptions{Limit: 5, Threshold: 0.9})
+	if err != nil || len(results) != 1 || results[0].ID != "exact" || results[0].Score != 1 {
+		t.Errorf("阿里云完全匹配得分应为1且按相似度阈值过滤: %+v, %v", results, err)
+	}
+
+	// Qdrant的Cosine返回相似度，Euclid返回距离
+	for metric, score := range map[string]float64{"cosine": 1.0, "euclid": 0.0} {
+		var threshold float64
+		qdrant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var body struct {
+				ScoreThreshold float64 `json:"score_threshold"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			threshold = body.ScoreThreshold
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": []map[string]interface{}{
+					{"id": qdrantPointID("m1"), "score": score, "payload": map[string]interface{}{"id": "m1"}},
+				},
+			})
+		}))
+		store := NewQdrantStore(&QdrantConfig{URL: qdrant.URL, Collection: "memories", Dimension: 4, Metric: metric}, nil)
+		results, err := store.SearchByVector(ctx, []float32{1, 0, 0, 0}, &models.SearchOptions{Limit: 1, Threshold: 0.5})
+		qdrant.Close()
+		if err != nil || len(results) != 1 || results[0].Score != 1 {
+			t.Errorf("Qdrant(%s)完全匹配得分应为1: %+v, %v", metric, results, err)
+		}
+		if want := map[string]float64{"cosine": 0.5, "euclid": 1}[metric]; threshold != want {
+			t.Errorf("Qdrant(%s)的score_threshold应为%.1f，实际%.4f", metric, want, threshold)
+		}
+	}
+}
@@ -644,6 +644,28 @@ func (v *VearchStore) StoreEnhancedMessage(message *models.EnhancedMessage) erro
 	return nil
 }
 
+// DeleteMemories 根据主键ID批量删除记忆
+func (v *VearchStore) DeleteMemories(ctx context.Context, ids []string) error {
+	log.Printf("[京东云向量存储] 删除记忆: 数量=%d", len(ids))
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if !v.initialized {
+		if err := v.Initialize(); err != nil {
+			return err
+		}
+	}
+
+	if err := v.client.Delete(v.database, "context_keeper_vector", ids); err != nil {
+		return fmt.Errorf("从Vearch删除记忆失败: %v", err)
+	}
+
+	log.Printf("[京东云向量存储] 记忆删除成功: 数量=%d", len(ids))
+	return nil
+}
+
 // =============================================================================
 // VectorSearcher 接口实现
 // =============================================================================
@@ -710,6 +732,25 @@ func (v *VearchStore) SearchByVector(ctx context.Context, vector []float32, opti
 		Limit:         options.Limit,
 	}
 
+	// 时间范围过滤（timestamp为标量索引字段）
+	if options.StartTime > 0 {
+		searchReq.Filters.Conditions = append(searchReq.Filters.Conditions,
+			VearchCondition{Field: "timestamp", Operator: ">=", Value: options.StartTime})
+	}
+	if options.EndTime > 0 {
+		searchReq.Filters.Conditions = append(searchReq.Filters.Conditions,
+			VearchCondition{Field: "timestamp", Operator: "<=", Value: options.EndTime})
+	}
+
+	// 结构化过滤条件
+	if options.Filter != nil {
+		conditions, err := compileVearchConditions(*options.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("编译过滤条件失败: %w", err)
+		}
+		searchReq.Filters.Conditions = append(searchReq.Filters.Conditions, conditions...)
+	}
+
 	// 🔥 详细日志：打印完整请求参数
 	log.Printf("[Vearch搜索] === SearchByVector 请求详情 ===")
 	log.Printf("[Vearch搜索] 数据库: %s, 空间: context_keeper_vector", v.database)
@@ -757,7 +798,8 @@ func (v *VearchStore) SearchByVector(ctx context.Context, vector []float32, opti
 	})
 
 	log.Printf("[Vearch存储] 搜索完成: 找到%d个结果", len(results))
-	return results, nil
+	// 内积得分即相似度，截断到0-1
+	return normalizeResultScores(results, clampSimilarity), nil
 }
 
 // SearchByText 文本搜索
@@ -824,7 +866,8 @@ func (v *VearchStore) SearchByText(ctx context.Context, query string, options *m
 	})
 
 	log.Printf("[Vearch存储] 文本搜索完成: 找到%d个结果", len(results))
-	return results, nil
+	// 内积得分即相似度，截断到0-1
+	return normalizeResultScores(results, clampSimilarity), nil
 }
 
 // SearchByID 根据ID精确搜索
@@ -1027,6 +1070,15 @@ func (v *VearchStore) SearchByFilter(ctx context.Context, filter string, options
 		Limit: options.Limit,
 	}
 
+	// 结构化过滤条件
+	if options.Filter != nil {
+		conditions, err := compileVearchConditions(*options.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("编译过滤条件失败: %w", err)
+		}
+		searchReq.Filters.Conditions = append(searchReq.Filters.Conditions, conditions...)
+	}
+
 	// 🔥 详细日志：打印完整请求参数
 	log.Printf("[Vearch搜索] === SearchByFilter 请求详情 ===")
 	log.Printf("[Vearch搜索] 数据库: %s, 空间: context_keeper_vector", v.database)
@@ -1591,3 +1643,85 @@ func getFloat64(data map[string]interface{}, key string) float64 {
 func (v *VearchStore) GetProvider() models.VectorStoreType {
 	return models.VectorStoreTypeVearch
 }
+
+// vearchFilterFields 结构化过滤条件的逻辑字段名到Vearch表字段名的映射
+var vearchFilterFields = map[string]string{
+	models.FilterFieldUserID: "user_id",
+}
+
+// compileVearchConditions 将结构化过滤条件编译为Vearch过滤条件（顶层以AND组合）
+// Vearch过滤只支持AND组合，OR只支持同一字段的多个字符串等值条件（编译为IN）
+func compileVearchConditions(filter models.Filter) ([]VearchCondition, error) {
+	switch filter.Op {
+	case "":
+		return nil, nil
+	case models.FilterOpEq:
+		field, err := vearchFilterField(filter.Field)
+		if err != nil {
+			return nil, err
+		}
+		switch v := filter.Value.(type) {
+		case string:
+			return []VearchCondition{{Field: field, Operator: "IN", Value: []interface{}{v}}}, nil
+		case int, int32, int64, float32, float64:
+			return []VearchCondition{
+				{Field: field, Operator: ">=", Value: v},
+				{Field: field, Operator: "<=", Value: v},
+			}, nil
+		default:
+			return nil, fmt.Errorf("字段%s: Vearch不支持的过滤值类型: %T", filter.Field, filter.Value)
+		}
+	case models.FilterOpRange:
+		field, err := vearchFilterField(filter.Field)
+		if err != nil {
+			return nil, err
+		}
+		var conditions []VearchCondition
+		if filter.Min > 0 {
+			conditions = append(conditions, VearchCondition{Field: field, Operator: ">=", Value: filter.Min})
+		}
+		if filter.Max > 0 {
+			conditions = append(conditions, VearchCondition{Field: field, Operator: "<=", Value: filter.Max})
+		}
+		return conditions, nil
+	case models.FilterOpAnd:
+		var conditions []VearchCondition
+		for _, child := range filter.Children {
+			childConditions, err := compileVearchConditions(child)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, childConditions...)
+		}
+		return conditions, nil
+	case models.FilterOpOr:
+		var field string
+		values := make([]interface{}, 0, len(filter.Children))
+		for _, child := range filter.Children {
+			value, ok := child.Value.(string)
+			if child.Op != models.FilterOpEq || !ok || (field != "" && child.Field != field) {
+				return nil, fmt.Errorf("Vearch只支持同一字段字符串等值条件的OR组合: %s", filter)
+			}
+			field = child.Field
+			values = append(values, value)
+		}
+		vearchField, err := vearchFilterField(field)
+		if err != nil {
+			return nil, err
+		}
+		return []VearchCondition{{Field: vearchField, Operator: "IN", Value: values}}, nil
+	default:
+		return nil, fmt.Errorf("不支持的过滤条件类型: %s", filter.Op)
+	}
+}
+
+// vearchFilterField 校验并映射过滤字段名
+func vearchFilterField(field string) (string, error) {
+	if err := checkFilterField(field); err != nil {
+		return "", err
+	}
+	if mapped, ok := vearchFilterFields[field]; ok {
+		return mapped, nil
+	}
+	return field, nil
+}